@@ -68,11 +68,32 @@ type Config struct {
 	SIPProfilesPath    string // Path for FreeSWITCH SIP profile XML files
 	FreeSwitchConfPath string // Path for FreeSWITCH configuration directory
 
+	// Recording retention
+	RecordingArchivePath      string // Where expired recordings are moved when archiving is enabled
+	RecordingRetentionMinutes int    // Retention job interval
+
+	// Object storage for recordings, voicemail, fax and media
+	StorageBackend        string // "local" (default) or "s3"
+	StorageLocalRoot      string // Optional mirror directory for the local backend (e.g. a NAS mount)
+	StorageS3Endpoint     string
+	StorageS3Region       string
+	StorageS3Bucket       string
+	StorageS3AccessKey    string
+	StorageS3SecretKey    string
+	StorageS3PathStyle    bool // Path-style addressing (MinIO, Ceph)
+	StorageKeepLocal      bool // Keep local copies after upload instead of evicting them
+	StoragePresignTTL     int  // Seconds presigned download URLs stay valid; 0 streams through the API
+	StorageMigrateMinutes int  // Migration/verification job interval
+
 	// Telnyx messaging settings
 	TelnyxAPIKey           string
 	TelnyxMessagingProfile string
 	TelnyxWebhookSecret    string
 
+	// Public base URL carriers reach the API at (e.g. https://pbx.example.com);
+	// used for delivery status callbacks and Twilio signature checks
+	MessagingWebhookBaseURL string
+
 	// Media transcoding settings
 	MaxMMSSizeKB    int
 	FFmpegPath      string
@@ -90,6 +111,21 @@ type Config struct {
 	OpenAIAPIKey     string
 	TTSDefaultEngine string // Default engine: "flite", "elevenlabs", "openai"
 
+	// Speech-to-text transcription
+	TranscriptionEnabled     bool   // Run the transcription worker
+	WhisperURL               string // Default Whisper-compatible endpoint when a tenant has none
+	TranscriptionPollSeconds int    // Worker poll interval
+	TranscriptionMaxAttempts int    // Attempts before a transcription is marked failed
+
+	// IMAP access to voicemail boxes for mail and visual voicemail clients
+	IMAPEnabled        bool   // Run the IMAP server
+	IMAPAddr           string // Listen address (e.g., :1143, or :993 with implicit TLS)
+	IMAPTLSCert        string // Certificate file; when set, logins require TLS
+	IMAPTLSKey         string // Private key file for IMAPTLSCert
+	IMAPImplicitTLS    bool   // TLS from the first byte instead of STARTTLS
+	IMAPAllowPlaintext bool   // Allow logins without TLS (local testing only)
+	IMAPPublicHost     string // Host name shown to users; defaults to SIP_DOMAIN
+
 	// WebRTC / Softphone settings
 	SIPWssURL   string // WebSocket URL for SIP.js (e.g., wss://sip.example.com:7443)
 	SIPDomain   string // SIP domain for registration (e.g., sip.example.com)
@@ -161,11 +197,30 @@ func Load() *Config {
 		SIPProfilesPath:    getEnv("SIP_PROFILES_PATH", "/etc/freeswitch/sip_profiles"),
 		FreeSwitchConfPath: getEnv("FREESWITCH_CONF_PATH", "/etc/freeswitch"),
 
+		// Recording retention
+		RecordingArchivePath:      getEnv("RECORDING_ARCHIVE_PATH", "/var/lib/callsign/recordings/archive"),
+		RecordingRetentionMinutes: getEnvAsInt("RECORDING_RETENTION_INTERVAL_MINUTES", 60),
+
+		// Object storage
+		StorageBackend:        getEnv("STORAGE_BACKEND", "local"),
+		StorageLocalRoot:      getEnv("STORAGE_LOCAL_ROOT", ""),
+		StorageS3Endpoint:     getEnv("STORAGE_S3_ENDPOINT", ""),
+		StorageS3Region:       getEnv("STORAGE_S3_REGION", "us-east-1"),
+		StorageS3Bucket:       getEnv("STORAGE_S3_BUCKET", ""),
+		StorageS3AccessKey:    getEnv("STORAGE_S3_ACCESS_KEY", ""),
+		StorageS3SecretKey:    getEnv("STORAGE_S3_SECRET_KEY", ""),
+		StorageS3PathStyle:    getEnvAsBool("STORAGE_S3_PATH_STYLE", true),
+		StorageKeepLocal:      getEnvAsBool("STORAGE_KEEP_LOCAL", true),
+		StoragePresignTTL:     getEnvAsInt("STORAGE_PRESIGN_TTL_SECONDS", 300),
+		StorageMigrateMinutes: getEnvAsInt("STORAGE_MIGRATE_INTERVAL_MINUTES", 60),
+
 		// Telnyx
 		TelnyxAPIKey:           getEnv("TELNYX_API_KEY", ""),
 		TelnyxMessagingProfile: getEnv("TELNYX_MESSAGING_PROFILE_ID", ""),
 		TelnyxWebhookSecret:    getEnv("TELNYX_WEBHOOK_SECRET", ""),
 
+		MessagingWebhookBaseURL: getEnv("MESSAGING_WEBHOOK_BASE_URL", ""),
+
 		// Media transcoding
 		MaxMMSSizeKB:    getEnvAsInt("MAX_MMS_SIZE_KB", 600),
 		FFmpegPath:      getEnv("FFMPEG_PATH", "ffmpeg"),
@@ -183,6 +238,21 @@ func Load() *Config {
 		OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
 		TTSDefaultEngine: getEnv("TTS_DEFAULT_ENGINE", "flite"),
 
+		// Transcription
+		TranscriptionEnabled:     getEnvAsBool("TRANSCRIPTION_ENABLED", true),
+		WhisperURL:               getEnv("WHISPER_URL", "http://127.0.0.1:9000"),
+		TranscriptionPollSeconds: getEnvAsInt("TRANSCRIPTION_POLL_SECONDS", 30),
+		TranscriptionMaxAttempts: getEnvAsInt("TRANSCRIPTION_MAX_ATTEMPTS", 3),
+
+		// IMAP voicemail access
+		IMAPEnabled:        getEnvAsBool("IMAP_ENABLED", false),
+		IMAPAddr:           getEnv("IMAP_ADDR", ":1143"),
+		IMAPTLSCert:        getEnv("IMAP_TLS_CERT", ""),
+		IMAPTLSKey:         getEnv("IMAP_TLS_KEY", ""),
+		IMAPImplicitTLS:    getEnvAsBool("IMAP_IMPLICIT_TLS", false),
+		IMAPAllowPlaintext: getEnvAsBool("IMAP_ALLOW_PLAINTEXT", false),
+		IMAPPublicHost:     getEnv("IMAP_PUBLIC_HOST", ""),
+
 		// WebRTC / Softphone
 		SIPWssURL:   getEnv("SIP_WSS_URL", ""),
 		SIPDomain:   getEnv("SIP_DOMAIN", ""),
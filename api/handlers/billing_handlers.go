@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"bytes"
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/rating"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Rate Decks (system)
+// =====================
+
+// rateDeckInput is the create/update payload. Increments may be sent as
+// "6/6" instead of the two separate fields.
+type rateDeckInput struct {
+	models.RateDeck
+	Increments string `json:"increments"`
+}
+
+// apply validates the input's increments onto the deck
+func (in *rateDeckInput) apply() error {
+	if in.Increments != "" {
+		initial, increment, err := models.ParseIncrements(in.Increments)
+		if err != nil {
+			return err
+		}
+		in.InitialIncrement, in.Increment = initial, increment
+	}
+	if in.InitialIncrement < 0 || in.Increment < 0 {
+		return errors.New("increments must be positive")
+	}
+	if in.Currency != "" && len(in.Currency) != 3 {
+		return errors.New("currency must be an ISO 4217 code")
+	}
+	in.Currency = strings.ToUpper(in.Currency)
+	return nil
+}
+
+// ListRateDecks returns all rate decks with their entry counts
+func (h *Handler) ListRateDecks(c *fiber.Ctx) error {
+	var decks []models.RateDeck
+	if err := h.DB.Order("name").Find(&decks).Error; err != nil {
+		h.logError("BILLING", "ListRateDecks: query failed", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list rate decks"})
+	}
+	for i := range decks {
+		h.DB.Model(&models.RateDeckEntry{}).Where("rate_deck_id = ?", decks[i].ID).Count(&decks[i].EntryCount)
+	}
+	return c.JSON(fiber.Map{"data": decks})
+}
+
+// CreateRateDeck creates an empty rate deck; entries are loaded with
+// ImportRateDeck
+func (h *Handler) CreateRateDeck(c *fiber.Ctx) error {
+	var input rateDeckInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+	if err := input.apply(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	deck := input.RateDeck
+	deck.ID = 0
+	if err := h.DB.Create(&deck).Error; err != nil {
+		h.logError("BILLING", "CreateRateDeck: failed to create deck", h.reqFields(c, map[string]interface{}{"error": err.Error(), "name": deck.Name}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create rate deck"})
+	}
+
+	h.logInfo("BILLING", "CreateRateDeck: deck created", h.reqFields(c, map[string]interface{}{"deck_id": deck.ID, "name": deck.Name}))
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": deck, "message": "Rate deck created"})
+}
+
+// GetRateDeck returns a rate deck and where it is assigned
+func (h *Handler) GetRateDeck(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+	h.DB.Model(&models.RateDeckEntry{}).Where("rate_deck_id = ?", deck.ID).Count(&deck.EntryCount)
+
+	var tenants, profiles, gateways []uint
+	h.DB.Model(&models.Tenant{}).Where("rate_deck_id = ?", deck.ID).Pluck("id", &tenants)
+	h.DB.Model(&models.TenantProfile{}).Where("rate_deck_id = ?", deck.ID).Pluck("id", &profiles)
+	h.DB.Model(&models.Gateway{}).Where("rate_deck_id = ?", deck.ID).Pluck("id", &gateways)
+
+	return c.JSON(fiber.Map{
+		"data": deck,
+		"assignments": fiber.Map{
+			"tenant_ids":         tenants,
+			"tenant_profile_ids": profiles,
+			"gateway_ids":        gateways,
+		},
+	})
+}
+
+// UpdateRateDeck updates a deck's settings. Changes that affect pricing
+// re-rate the current month's calls in the background.
+func (h *Handler) UpdateRateDeck(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+
+	input := rateDeckInput{RateDeck: deck}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.apply(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	updates := map[string]interface{}{
+		"name":              input.Name,
+		"description":       input.Description,
+		"currency":          input.Currency,
+		"enabled":           input.Enabled,
+		"initial_increment": input.InitialIncrement,
+		"increment":         input.Increment,
+	}
+	repriced := input.Currency != deck.Currency || input.Enabled != deck.Enabled ||
+		input.InitialIncrement != deck.InitialIncrement || input.Increment != deck.Increment
+	if err := h.DB.Model(&deck).Updates(updates).Error; err != nil {
+		h.logError("BILLING", "UpdateRateDeck: failed to update deck", h.reqFields(c, map[string]interface{}{"error": err.Error(), "deck_id": deck.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update rate deck"})
+	}
+	if repriced {
+		h.rerateInBackground(rating.RerateScope{DeckID: deck.ID, Since: currentBillingMonth()})
+	}
+
+	h.DB.First(&deck, deck.ID)
+	return c.JSON(fiber.Map{"data": deck, "message": "Rate deck updated", "rerating": repriced})
+}
+
+// DeleteRateDeck deletes an unassigned deck and its entries. Rated CDRs
+// keep their cost.
+func (h *Handler) DeleteRateDeck(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+
+	var tenants, profiles, gateways int64
+	h.DB.Model(&models.Tenant{}).Where("rate_deck_id = ?", deck.ID).Count(&tenants)
+	h.DB.Model(&models.TenantProfile{}).Where("rate_deck_id = ?", deck.ID).Count(&profiles)
+	h.DB.Model(&models.Gateway{}).Where("rate_deck_id = ?", deck.ID).Count(&gateways)
+	if tenants+profiles+gateways > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":         "Rate deck is assigned",
+			"tenant_count":  tenants,
+			"profile_count": profiles,
+			"gateway_count": gateways,
+		})
+	}
+
+	h.DB.Where("rate_deck_id = ?", deck.ID).Delete(&models.RateDeckEntry{})
+	if err := h.DB.Delete(&deck).Error; err != nil {
+		h.logError("BILLING", "DeleteRateDeck: failed to delete deck", h.reqFields(c, map[string]interface{}{"error": err.Error(), "deck_id": deck.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete rate deck"})
+	}
+
+	h.logInfo("BILLING", "DeleteRateDeck: deck deleted", h.reqFields(c, map[string]interface{}{"deck_id": deck.ID, "name": deck.Name}))
+	return c.JSON(fiber.Map{"message": "Rate deck deleted"})
+}
+
+// ListRateDeckEntries pages through a deck's prefixes, optionally filtered
+// by ?prefix= (starts with) or ?q= (description contains)
+func (h *Handler) ListRateDeckEntries(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	page = max(page, 1)
+	limit = min(max(limit, 1), 1000)
+
+	query := h.DB.Model(&models.RateDeckEntry{}).Where("rate_deck_id = ?", deck.ID)
+	if prefix := c.Query("prefix"); prefix != "" {
+		query = query.Where("prefix LIKE ?", strings.TrimPrefix(prefix, "+")+"%")
+	}
+	if q := c.Query("q"); q != "" {
+		query = query.Where("LOWER(description) LIKE ?", "%"+strings.ToLower(q)+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+	var entries []models.RateDeckEntry
+	query.Order("prefix").Offset((page - 1) * limit).Limit(limit).Find(&entries)
+
+	return c.JSON(fiber.Map{"data": entries, "total": total, "page": page, "limit": limit})
+}
+
+// ImportRateDeck loads entries from CSV or JSON, sent as the request body
+// or as a multipart "file". The format comes from ?format= or the content
+// type. ?replace=true clears the deck first. Calls of the current month
+// are re-rated in the background.
+func (h *Handler) ImportRateDeck(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+
+	format := strings.ToLower(c.Query("format"))
+	var body io.Reader = bytes.NewReader(c.Body())
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to read upload"})
+		}
+		defer f.Close()
+		body = f
+		if format == "" && strings.HasSuffix(strings.ToLower(file.Filename), ".json") {
+			format = "json"
+		}
+	} else if format == "" && strings.Contains(c.Get(fiber.HeaderContentType), "json") {
+		format = "json"
+	}
+
+	var rows []rating.ImportRow
+	var err error
+	if format == "json" {
+		rows, err = rating.ParseJSON(body)
+	} else {
+		rows, err = rating.ParseCSV(body)
+	}
+	if err == nil {
+		var result *rating.ImportResult
+		result, err = rating.Import(h.DB, &deck, rows, c.QueryBool("replace"))
+		if err == nil {
+			h.logInfo("BILLING", "ImportRateDeck: deck imported", h.reqFields(c, map[string]interface{}{
+				"deck_id": deck.ID, "imported": result.Imported, "cleared": result.Cleared,
+			}))
+			h.rerateInBackground(rating.RerateScope{DeckID: deck.ID, Since: currentBillingMonth()})
+			return c.JSON(fiber.Map{"data": result, "message": "Rate deck imported", "rerating": true})
+		}
+	}
+
+	var importErr *rating.ImportError
+	if errors.As(err, &importErr) {
+		h.logWarn("BILLING", "ImportRateDeck: invalid rows", h.reqFields(c, map[string]interface{}{"deck_id": deck.ID, "rows": len(importErr.Rows)}))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rows in import", "details": importErr.Rows})
+	}
+	h.logWarn("BILLING", "ImportRateDeck: import failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "deck_id": deck.ID}))
+	return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Import failed", "details": err.Error()})
+}
+
+// LookupRate shows which entry of a deck would price ?number= and what a
+// call of ?seconds= would cost
+func (h *Handler) LookupRate(c *fiber.Ctx) error {
+	var deck models.RateDeck
+	if err := h.DB.First(&deck, c.Params("id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Rate deck not found"})
+	}
+	number := rating.NormalizeNumber(c.Query("number"))
+	if number == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "number is required"})
+	}
+
+	entry, err := rating.Lookup(h.DB, deck.ID, number)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Lookup failed"})
+	}
+	if entry == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No prefix matches", "number": number})
+	}
+	seconds := c.QueryInt("seconds", 60)
+	cost, billed := entry.Charge(&deck, seconds)
+	return c.JSON(fiber.Map{
+		"data":       entry,
+		"number":     number,
+		"seconds":    seconds,
+		"billed_sec": billed,
+		"cost":       cost,
+		"currency":   deck.Currency,
+	})
+}
+
+// RerateCalls re-prices carrier calls with the current decks, e.g. after
+// assigning a deck to a tenant. Body: {"since": "2026-09-01", "tenant_id":
+// 0, "deck_id": 0}; since defaults to the start of the current month.
+func (h *Handler) RerateCalls(c *fiber.Ctx) error {
+	var input struct {
+		Since    string `json:"since"`
+		TenantID uint   `json:"tenant_id"`
+		DeckID   uint   `json:"deck_id"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	scope := rating.RerateScope{TenantID: input.TenantID, DeckID: input.DeckID, Since: currentBillingMonth()}
+	if input.Since != "" {
+		since, err := time.Parse("2006-01-02", input.Since)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "since must be YYYY-MM-DD"})
+		}
+		scope.Since = since
+	}
+
+	count, err := rating.Rerate(h.DB, scope)
+	if err != nil {
+		h.logError("BILLING", "RerateCalls: rerate failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "rerated": count}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Rerate failed", "rerated": count})
+	}
+
+	h.logInfo("BILLING", "RerateCalls: calls re-rated", h.reqFields(c, map[string]interface{}{
+		"rerated": count, "tenant_id": scope.TenantID, "deck_id": scope.DeckID, "since": scope.Since,
+	}))
+	return c.JSON(fiber.Map{"rerated": count, "since": scope.Since})
+}
+
+// rerateInBackground re-rates after a deck change without holding up the
+// request
+func (h *Handler) rerateInBackground(scope rating.RerateScope) {
+	go func() {
+		count, err := rating.Rerate(h.DB, scope)
+		fields := map[string]interface{}{"deck_id": scope.DeckID, "since": scope.Since, "rerated": count}
+		if err != nil {
+			fields["error"] = err.Error()
+			h.logError("BILLING", "Rerate after deck change failed", fields)
+			return
+		}
+		h.logInfo("BILLING", "Re-rated calls after deck change", fields)
+	}()
+}
+
+// currentBillingMonth is the default start for re-rating: closed months
+// are only re-rated on request
+func currentBillingMonth() time.Time {
+	month, _ := rating.ParseMonth("")
+	return month
+}
+
+// =====================
+// Invoices
+// =====================
+
+// ListInvoices returns every tenant's invoice summary for ?month=YYYY-MM
+// (default current month) as JSON or, with ?format=csv, as a CSV export
+func (h *Handler) ListInvoices(c *fiber.Ctx) error {
+	month, err := rating.ParseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	invoices, err := rating.MonthlyInvoices(h.DB, month)
+	if err != nil {
+		h.logError("BILLING", "ListInvoices: failed to build invoices", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build invoices"})
+	}
+
+	if c.Query("format") == "csv" {
+		c.Set("Content-Type", "text/csv")
+		c.Set("Content-Disposition", "attachment; filename=invoices-"+month.Format("2006-01")+".csv")
+		return rating.WriteInvoicesCSV(c, invoices)
+	}
+	return c.JSON(fiber.Map{"data": invoices, "month": month.Format("2006-01")})
+}
+
+// GetTenantInvoice returns one tenant's invoice with destination lines
+func (h *Handler) GetTenantInvoice(c *fiber.Ctx) error {
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, c.Params("tenant_id")).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+	}
+	return h.sendInvoice(c, &tenant, false)
+}
+
+// GetInvoice returns the current tenant's own invoice, without the
+// carrier cost and margin
+func (h *Handler) GetInvoice(c *fiber.Ctx) error {
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, middleware.GetTenantID(c)).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+	}
+	return h.sendInvoice(c, &tenant, true)
+}
+
+func (h *Handler) sendInvoice(c *fiber.Ctx, tenant *models.Tenant, retail bool) error {
+	month, err := rating.ParseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	inv, err := rating.MonthlyInvoice(h.DB, tenant, month, true)
+	if err != nil {
+		h.logError("BILLING", "Invoice: failed to build invoice", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": tenant.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build invoice"})
+	}
+	if retail {
+		inv.Retail()
+	}
+
+	if c.Query("format") == "csv" {
+		c.Set("Content-Type", "text/csv")
+		c.Set("Content-Disposition", "attachment; filename=invoice-"+strconv.FormatUint(uint64(tenant.ID), 10)+"-"+inv.Month+".csv")
+		return rating.WriteInvoiceCSV(c, inv)
+	}
+	return c.JSON(fiber.Map{"data": inv})
+}
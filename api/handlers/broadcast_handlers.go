@@ -3,9 +3,13 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"callsign/services/broadcast"
+	"encoding/csv"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/lib/pq"
@@ -15,6 +19,23 @@ import (
 // Call Broadcast Campaigns
 // =====================
 
+// validateBroadcast checks the calling window and interactive options
+func validateBroadcast(campaign *models.BroadcastCampaign) error {
+	if _, _, err := broadcast.ParseCallWindow(campaign.CallWindowStart, campaign.CallWindowEnd); err != nil {
+		return err
+	}
+	switch campaign.Type {
+	case "", models.BroadcastTypeMessage, models.BroadcastTypeSurvey:
+	case models.BroadcastTypeTransfer:
+		if campaign.TransferDestination == "" {
+			return errors.New("transfer campaigns require a transfer_destination")
+		}
+	default:
+		return errors.New("invalid campaign type")
+	}
+	return nil
+}
+
 // ListBroadcasts returns all broadcast campaigns for the current tenant
 func (h *Handler) ListBroadcasts(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
@@ -79,6 +100,11 @@ func (h *Handler) CreateBroadcast(c *fiber.Ctx) error {
 		campaign.Recipients = cleaned
 	}
 
+	if err := validateBroadcast(&campaign); err != nil {
+		h.logWarn("BROADCAST", "CreateBroadcast: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	if err := h.DB.Create(&campaign).Error; err != nil {
 		h.logError("BROADCAST", "CreateBroadcast: Failed to create campaign", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create campaign"})
@@ -136,6 +162,19 @@ func (h *Handler) UpdateBroadcast(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
+	if err := validateBroadcast(&updates); err != nil {
+		h.logWarn("BROADCAST", "UpdateBroadcast: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Numbers already dialed keep their results by position; once started,
+	// a campaign's list can only be appended to
+	if existing.StartedAt != nil && updates.Recipients != nil &&
+		!models.RecipientsAppended(existing.Recipients, updates.Recipients) {
+		h.logWarn("BROADCAST", "UpdateBroadcast: Recipients of a started campaign can only be appended to", h.reqFields(c, nil))
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Recipients of a started campaign can only be appended to"})
+	}
+
 	updates.ID = existing.ID
 	updates.TenantID = tenantID
 	if err := h.DB.Model(&existing).Updates(updates).Error; err != nil {
@@ -162,6 +201,12 @@ func (h *Handler) DeleteBroadcast(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Campaign not found"})
 	}
 
+	if h.BroadcastWorker != nil && h.BroadcastWorker.IsCampaignRunning(uint(id)) {
+		h.BroadcastWorker.CancelCampaign(uint(id))
+	}
+	h.DB.Where("campaign_id = ?", id).Delete(&models.BroadcastRecipient{})
+	h.DB.Where("campaign_id = ?", id).Delete(&models.BroadcastResult{})
+
 	return c.JSON(fiber.Map{"message": "Campaign deleted"})
 }
 
@@ -196,6 +241,15 @@ func (h *Handler) StartBroadcast(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Broadcast worker not configured"})
 	}
 
+	// Campaigns with a future start time are left for the scheduler
+	if campaign.ScheduledAt != nil && campaign.ScheduledAt.After(time.Now()) {
+		if err := h.DB.Model(&campaign).Update("status", models.BroadcastStatusScheduled).Error; err != nil {
+			h.logError("BROADCAST", "StartBroadcast: Failed to schedule campaign", h.reqFields(c, nil))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to schedule campaign"})
+		}
+		return c.JSON(fiber.Map{"message": "Campaign scheduled", "scheduled_at": campaign.ScheduledAt})
+	}
+
 	// Launch async broadcast worker - it handles status update internally
 	if err := h.BroadcastWorker.StartCampaign(uint(id)); err != nil {
 		h.logError("BROADCAST", "StartBroadcast: Failed to start campaign: "+err.Error(), h.reqFields(c, nil))
@@ -205,7 +259,72 @@ func (h *Handler) StartBroadcast(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Campaign started"})
 }
 
-// StopBroadcast stops a running broadcast campaign
+// ResumeBroadcast resumes a paused campaign from where it stopped
+func (h *Handler) ResumeBroadcast(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		h.logWarn("BROADCAST", "ResumeBroadcast: Invalid campaign ID", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid campaign ID"})
+	}
+
+	var campaign models.BroadcastCampaign
+	if err := h.DB.Where("id = ? AND tenant_id = ? AND status = ?", id, tenantID, models.BroadcastStatusPaused).First(&campaign).Error; err != nil {
+		h.logWarn("BROADCAST", "ResumeBroadcast: Paused campaign not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Paused campaign not found"})
+	}
+
+	if h.BroadcastWorker == nil {
+		h.logError("BROADCAST", "ResumeBroadcast: Broadcast worker not configured", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Broadcast worker not configured"})
+	}
+
+	// A paused campaign stays registered until its in-flight calls finish
+	if h.BroadcastWorker.IsCampaignRunning(uint(id)) {
+		h.logWarn("BROADCAST", "ResumeBroadcast: Campaign is still finishing active calls", h.reqFields(c, nil))
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Campaign is still finishing active calls, try again shortly"})
+	}
+
+	if err := h.BroadcastWorker.StartCampaign(uint(id)); err != nil {
+		h.logError("BROADCAST", "ResumeBroadcast: Failed to resume campaign: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resume campaign"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Campaign resumed"})
+}
+
+// CancelBroadcast stops a campaign permanently
+func (h *Handler) CancelBroadcast(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		h.logWarn("BROADCAST", "CancelBroadcast: Invalid campaign ID", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid campaign ID"})
+	}
+
+	var campaign models.BroadcastCampaign
+	if err := h.DB.Where("id = ? AND tenant_id = ? AND status IN ?", id, tenantID, []models.BroadcastStatus{
+		models.BroadcastStatusRunning, models.BroadcastStatusScheduled, models.BroadcastStatusPaused,
+	}).First(&campaign).Error; err != nil {
+		h.logWarn("BROADCAST", "CancelBroadcast: Active campaign not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Active campaign not found"})
+	}
+
+	if h.BroadcastWorker == nil {
+		h.logError("BROADCAST", "CancelBroadcast: Broadcast worker not configured", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Broadcast worker not configured"})
+	}
+
+	if err := h.BroadcastWorker.CancelCampaign(uint(id)); err != nil {
+		h.logWarn("BROADCAST", "CancelBroadcast: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel campaign"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Campaign cancelled"})
+}
+
+// StopBroadcast pauses a running broadcast campaign. Recipient progress is
+// kept, so ResumeBroadcast continues where it stopped.
 func (h *Handler) StopBroadcast(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
@@ -227,12 +346,12 @@ func (h *Handler) StopBroadcast(c *fiber.Ctx) error {
 	}
 
 	// Signal broadcast worker to stop
-	if err := h.BroadcastWorker.StopCampaign(uint(id)); err != nil {
+	if err := h.BroadcastWorker.PauseCampaign(uint(id)); err != nil {
 		h.logWarn("BROADCAST", "StopBroadcast: "+err.Error(), h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to stop campaign"})
 	}
 
-	return c.JSON(fiber.Map{"message": "Campaign stopped"})
+	return c.JSON(fiber.Map{"message": "Campaign paused"})
 }
 
 // GetBroadcastStats returns statistics for a broadcast campaign
@@ -250,16 +369,121 @@ func (h *Handler) GetBroadcastStats(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Campaign not found"})
 	}
 
+	// Per-recipient state counts (pending, retry, answered, ...)
+	type statusCount struct {
+		Status models.BroadcastRecipientStatus
+		Count  int64
+	}
+	var counts []statusCount
+	h.DB.Model(&models.BroadcastRecipient{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", campaign.ID).
+		Group("status").
+		Scan(&counts)
+	recipients := make(map[models.BroadcastRecipientStatus]int64, len(counts))
+	for _, sc := range counts {
+		recipients[sc.Status] = sc.Count
+	}
+
+	// Call outcomes (human, machine, busy, ...) across all attempts
+	type outcomeCount struct {
+		Outcome models.BroadcastOutcome
+		Count   int64
+	}
+	var outcomeCounts []outcomeCount
+	h.DB.Model(&models.BroadcastResult{}).
+		Select("outcome, COUNT(*) AS count").
+		Where("campaign_id = ?", campaign.ID).
+		Group("outcome").
+		Scan(&outcomeCounts)
+	outcomes := make(map[models.BroadcastOutcome]int64, len(outcomeCounts))
+	for _, oc := range outcomeCounts {
+		outcomes[oc.Outcome] = oc.Count
+	}
+
+	var transferred, voicemailDrops int64
+	h.DB.Model(&models.BroadcastResult{}).Where("campaign_id = ? AND transferred = ?", campaign.ID, true).Count(&transferred)
+	h.DB.Model(&models.BroadcastResult{}).Where("campaign_id = ? AND voicemail_dropped = ?", campaign.ID, true).Count(&voicemailDrops)
+
+	// Survey answers by digits pressed
+	type responseCount struct {
+		Digits string
+		Count  int64
+	}
+	var responseCounts []responseCount
+	h.DB.Model(&models.BroadcastResult{}).
+		Select("digits, COUNT(*) AS count").
+		Where("campaign_id = ? AND digits <> ''", campaign.ID).
+		Group("digits").
+		Scan(&responseCounts)
+	responses := make(map[string]int64, len(responseCounts))
+	for _, rc := range responseCounts {
+		responses[rc.Digits] = rc.Count
+	}
+
 	return c.JSON(fiber.Map{
-		"total_recipients": len(campaign.Recipients),
-		"total_calls":      campaign.TotalCalls,
-		"answered_calls":   campaign.AnsweredCalls,
-		"failed_calls":     campaign.FailedCalls,
-		"busy_calls":       campaign.BusyCalls,
-		"no_answer_calls":  campaign.NoAnswerCalls,
-		"progress":         campaign.Progress(),
-		"status":           campaign.Status,
-		"started_at":       campaign.StartedAt,
-		"completed_at":     campaign.CompletedAt,
+		"type":                 campaign.Type,
+		"outcomes":             outcomes,
+		"transferred":          transferred,
+		"voicemail_drops":      voicemailDrops,
+		"responses":            responses,
+		"total_recipients":     len(campaign.Recipients),
+		"completed_recipients": campaign.CompletedRecipients,
+		"recipients":           recipients,
+		"total_calls":          campaign.TotalCalls,
+		"answered_calls":       campaign.AnsweredCalls,
+		"failed_calls":         campaign.FailedCalls,
+		"busy_calls":           campaign.BusyCalls,
+		"no_answer_calls":      campaign.NoAnswerCalls,
+		"progress":             campaign.Progress(),
+		"status":               campaign.Status,
+		"started_at":           campaign.StartedAt,
+		"completed_at":         campaign.CompletedAt,
 	})
 }
+
+// ExportBroadcastResults streams per-attempt call results as CSV
+func (h *Handler) ExportBroadcastResults(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		h.logWarn("BROADCAST", "ExportBroadcastResults: Invalid campaign ID", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid campaign ID"})
+	}
+
+	var campaign models.BroadcastCampaign
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&campaign).Error; err != nil {
+		h.logWarn("BROADCAST", "ExportBroadcastResults: Campaign not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Campaign not found"})
+	}
+
+	var results []models.BroadcastResult
+	h.DB.Where("campaign_id = ?", campaign.ID).Order("created_at ASC").Find(&results)
+
+	c.Set("Content-Type", "text/csv")
+	c.Set("Content-Disposition", "attachment; filename=broadcast-"+strconv.FormatUint(id, 10)+"-results.csv")
+
+	w := csv.NewWriter(c)
+	w.Write([]string{"Date", "Phone Number", "Attempt", "Outcome", "Digits", "Transferred", "Voicemail Drop", "Hangup Cause", "Duration (s)", "Answered At"})
+	for _, r := range results {
+		answeredAt := ""
+		if r.AnsweredAt != nil {
+			answeredAt = r.AnsweredAt.Format("2006-01-02 15:04:05")
+		}
+		w.Write([]string{
+			r.CreatedAt.Format("2006-01-02 15:04:05"),
+			r.PhoneNumber,
+			strconv.Itoa(r.Attempt),
+			string(r.Outcome),
+			r.Digits,
+			strconv.FormatBool(r.Transferred),
+			strconv.FormatBool(r.VoicemailDropped),
+			r.HangupCause,
+			strconv.Itoa(r.Duration),
+			answeredAt,
+		})
+	}
+	w.Flush()
+
+	return w.Error()
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"callsign/middleware"
 	"callsign/models"
+	"callsign/services/esl/modules/callcontrol"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -261,3 +263,82 @@ func (h *Handler) ReorderProfileCallHandlingRules(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "Rules reordered"})
 }
+
+// ============ Dry-run Evaluation ============
+
+// EvaluateCallHandlingRules explains which call handling rule would fire for a
+// given caller and time without placing a call. When no event is supplied the
+// rules are evaluated for every trigger event.
+func (h *Handler) EvaluateCallHandlingRules(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	extID, _ := strconv.Atoi(c.Params("ext"))
+
+	var ext models.Extension
+	if err := h.DB.Where("id = ? AND tenant_id = ?", extID, tenantID).First(&ext).Error; err != nil {
+		h.logWarn("CALL", "EvaluateCallHandlingRules: Extension not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Extension not found"})
+	}
+
+	var input struct {
+		CallerID   string `json:"caller_id"`
+		CallerName string `json:"caller_name"`
+		Event      string `json:"event"` // any_call, on_phone, no_answer, unavailable
+		Time       string `json:"time"`  // RFC3339; defaults to now
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, ext.TenantID).Error; err != nil {
+		h.logError("CALL", "EvaluateCallHandlingRules: Failed to fetch tenant", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch tenant"})
+	}
+	loc := tenant.Location()
+
+	at := time.Now().In(loc)
+	if input.Time != "" {
+		parsed, err := time.Parse(time.RFC3339, input.Time)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "time must be RFC3339"})
+		}
+		at = parsed.In(loc)
+	}
+
+	events := callcontrol.AllCallHandlingEvents
+	if input.Event != "" {
+		valid := false
+		for _, e := range callcontrol.AllCallHandlingEvents {
+			if e == input.Event {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown event: " + input.Event})
+		}
+		events = []string{input.Event}
+	}
+
+	rules, err := callcontrol.LoadCallHandlingRules(h.DB, &ext)
+	if err != nil {
+		h.logError("CALL", "EvaluateCallHandlingRules: Failed to load call handling rules", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load call handling rules"})
+	}
+
+	evaluator := callcontrol.NewRuleEvaluator(h.DB, loc)
+	call := callcontrol.CallInfo{CallerID: input.CallerID, CallerName: input.CallerName, Time: at}
+
+	decisions := make([]callcontrol.RuleDecision, 0, len(events))
+	for _, event := range events {
+		decisions = append(decisions, evaluator.Evaluate(rules, event, call))
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"extension": ext.Extension,
+		"caller_id": input.CallerID,
+		"time":      at,
+		"timezone":  loc.String(),
+		"decisions": decisions,
+	}})
+}
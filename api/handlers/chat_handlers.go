@@ -111,6 +111,12 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 	msg.TenantID = tenantID
 	msg.ThreadID = threadID
 
+	if h.MsgManager != nil && (thread.Channel == models.ChannelSMS || thread.Channel == models.ChannelMMS) && msg.SenderType == "extension" {
+		if err := h.MsgManager.CheckConsent(tenantID, thread.LocalNumber, thread.RemoteNumber); err != nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Recipient has opted out of messages from this number", "code": "recipient_opted_out"})
+		}
+	}
+
 	// Encrypt body for external channels (fail loud if encryption fails)
 	if msg.Body != "" && h.EncMgr != nil && (thread.Channel == models.ChannelSMS || thread.Channel == models.ChannelMMS) {
 		encrypted, err := h.EncMgr.Encrypt(msg.Body)
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/messaging"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Chat Queues
+// =====================
+
+// GetChatQueue returns a chat queue with its agents and the threads waiting
+// in or assigned from it
+func (h *Handler) GetChatQueue(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "GetChatQueue")
+	if !ok {
+		return nil
+	}
+
+	var threads []models.ChatThread
+	h.DB.Where("queue_id = ? AND status IN ?", queue.ID, []string{"open", "pending"}).
+		Order("queued_at ASC").Find(&threads)
+
+	waiting, assigned := []models.ChatThread{}, []models.ChatThread{}
+	for _, t := range threads {
+		if t.AssignedTo == nil {
+			waiting = append(waiting, t)
+		} else {
+			assigned = append(assigned, t)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"queue":    queue,
+		"waiting":  waiting,
+		"assigned": assigned,
+	})
+}
+
+// UpdateChatQueue updates a chat queue's routing, SLA and auto-response settings
+func (h *Handler) UpdateChatQueue(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "UpdateChatQueue")
+	if !ok {
+		return nil
+	}
+
+	input := *queue
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	input.ID, input.TenantID, input.Agents = queue.ID, queue.TenantID, queue.Agents
+	if msg := h.validateChatQueue(&input); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.DB.Model(queue).Select("name", "description", "strategy", "max_wait_seconds",
+		"target_response_ms", "agent_timeout_seconds", "welcome_message", "away_message",
+		"business_hours_id", "enabled").Updates(&input).Error; err != nil {
+		h.logError("MESSAGING", "UpdateChatQueue: Failed to update queue", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update queue"})
+	}
+
+	h.logInfo("MESSAGING", "UpdateChatQueue: Queue updated", h.reqFields(c, map[string]interface{}{"queue_id": queue.ID}))
+	h.dispatchChatQueue(queue.ID)
+	return c.JSON(input)
+}
+
+// DeleteChatQueue deletes a chat queue and its agents. Threads waiting in
+// it stay open but are no longer routed.
+func (h *Handler) DeleteChatQueue(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "DeleteChatQueue")
+	if !ok {
+		return nil
+	}
+
+	h.DB.Where("queue_id = ?", queue.ID).Delete(&models.ChatQueueAgent{})
+	if err := h.DB.Delete(queue).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete queue"})
+	}
+
+	h.logInfo("MESSAGING", "DeleteChatQueue: Queue deleted", h.reqFields(c, map[string]interface{}{"queue_id": queue.ID}))
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// AddChatQueueAgent adds an extension to a chat queue
+func (h *Handler) AddChatQueueAgent(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "AddChatQueueAgent")
+	if !ok {
+		return nil
+	}
+
+	var agent models.ChatQueueAgent
+	if err := c.BodyParser(&agent); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var ext models.Extension
+	if err := h.DB.Where("id = ? AND tenant_id = ?", agent.ExtensionID, queue.TenantID).First(&ext).Error; err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Extension not found"})
+	}
+	var count int64
+	h.DB.Model(&models.ChatQueueAgent{}).Where("queue_id = ? AND extension_id = ?", queue.ID, ext.ID).Count(&count)
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Extension is already an agent of this queue"})
+	}
+
+	agent.ID = 0
+	agent.QueueID = queue.ID
+	agent.ActiveChats = 0
+	if agent.Status == "" {
+		agent.Status = models.ChatAgentAvailable
+	}
+	if !validChatAgentStatus(agent.Status) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid agent status"})
+	}
+	if err := h.DB.Create(&agent).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add agent"})
+	}
+
+	h.logInfo("MESSAGING", "AddChatQueueAgent: Agent added", h.reqFields(c, map[string]interface{}{"queue_id": queue.ID, "extension_id": ext.ID}))
+	h.dispatchChatQueue(queue.ID)
+	return c.Status(http.StatusCreated).JSON(agent)
+}
+
+// UpdateChatQueueAgent changes an agent's limits, priority or status
+func (h *Handler) UpdateChatQueueAgent(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "UpdateChatQueueAgent")
+	if !ok {
+		return nil
+	}
+
+	var agent models.ChatQueueAgent
+	if err := h.DB.Where("id = ? AND queue_id = ?", c.Params("agentId"), queue.ID).First(&agent).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Agent not found"})
+	}
+
+	input := agent
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !validChatAgentStatus(input.Status) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid agent status"})
+	}
+
+	if err := h.DB.Model(&agent).Select("max_concurrent_chats", "priority", "enabled", "status").
+		Updates(&input).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update agent"})
+	}
+	input.ID, input.QueueID, input.ExtensionID, input.ActiveChats = agent.ID, agent.QueueID, agent.ExtensionID, agent.ActiveChats
+
+	h.dispatchChatQueue(queue.ID)
+	return c.JSON(input)
+}
+
+// RemoveChatQueueAgent removes an agent from a chat queue. Threads already
+// assigned to them stay with them.
+func (h *Handler) RemoveChatQueueAgent(c *fiber.Ctx) error {
+	queue, ok := h.chatQueue(c, "RemoveChatQueueAgent")
+	if !ok {
+		return nil
+	}
+
+	result := h.DB.Where("id = ? AND queue_id = ?", c.Params("agentId"), queue.ID).Delete(&models.ChatQueueAgent{})
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Agent not found"})
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// SetChatAgentStatus sets the logged-in extension's status in every chat
+// queue they work
+func (h *Handler) SetChatAgentStatus(c *fiber.Ctx) error {
+	ext, ok := h.resolveExtension(c)
+	if !ok {
+		return nil
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !validChatAgentStatus(input.Status) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid agent status"})
+	}
+
+	queueIDs := h.DB.Model(&models.ChatQueue{}).Select("id").Where("tenant_id = ?", ext.TenantID)
+	var agents []models.ChatQueueAgent
+	h.DB.Where("extension_id = ? AND queue_id IN (?)", ext.ID, queueIDs).Find(&agents)
+	if len(agents) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Extension is not a chat queue agent"})
+	}
+
+	h.DB.Model(&models.ChatQueueAgent{}).Where("extension_id = ? AND queue_id IN (?)", ext.ID, queueIDs).
+		Update("status", input.Status)
+	for i := range agents {
+		agents[i].Status = input.Status
+		h.dispatchChatQueue(agents[i].QueueID)
+	}
+
+	return c.JSON(agents)
+}
+
+// AcceptChatThread assigns a waiting queued thread to the logged-in agent
+func (h *Handler) AcceptChatThread(c *fiber.Ctx) error {
+	ext, ok := h.resolveExtension(c)
+	if !ok {
+		return nil
+	}
+	thread, ok := h.chatThread(c, "AcceptChatThread")
+	if !ok {
+		return nil
+	}
+	if h.MsgManager == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Messaging is not available"})
+	}
+
+	if err := h.MsgManager.ChatRouter.Accept(thread, ext.ID); err != nil {
+		status := http.StatusConflict
+		switch {
+		case errors.Is(err, messaging.ErrChatNotAgent):
+			status = http.StatusForbidden
+		case errors.Is(err, messaging.ErrChatNotQueued):
+			status = http.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(thread)
+}
+
+// ResolveChatThread closes out a conversation, freeing the agent's slot
+func (h *Handler) ResolveChatThread(c *fiber.Ctx) error {
+	thread, ok := h.chatThread(c, "ResolveChatThread")
+	if !ok {
+		return nil
+	}
+	if h.MsgManager == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Messaging is not available"})
+	}
+
+	if err := h.MsgManager.ChatRouter.Release(thread); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve thread"})
+	}
+	return c.JSON(thread)
+}
+
+// chatQueue loads the :id chat queue of the tenant with its agents,
+// writing a 404 when missing
+func (h *Handler) chatQueue(c *fiber.Ctx, fn string) (*models.ChatQueue, bool) {
+	var queue models.ChatQueue
+	if err := h.DB.Preload("Agents").
+		Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&queue).Error; err != nil {
+		h.logWarn("MESSAGING", fn+": Queue not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Queue not found"})
+		return nil, false
+	}
+	return &queue, true
+}
+
+// chatThread loads the :id chat thread of the tenant, writing a 404 when
+// missing
+func (h *Handler) chatThread(c *fiber.Ctx, fn string) (*models.ChatThread, bool) {
+	var thread models.ChatThread
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&thread).Error; err != nil {
+		h.logWarn("MESSAGING", fn+": Thread not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Thread not found"})
+		return nil, false
+	}
+	return &thread, true
+}
+
+// dispatchChatQueue routes a queue's waiting threads after its agents change
+func (h *Handler) dispatchChatQueue(queueID uint) {
+	if h.MsgManager != nil {
+		go h.MsgManager.ChatRouter.Dispatch(queueID)
+	}
+}
+
+// validateChatQueue checks a queue's strategy, timings and business hours,
+// returning a message when they are rejected
+func (h *Handler) validateChatQueue(q *models.ChatQueue) string {
+	switch q.Strategy {
+	case "":
+		q.Strategy = models.ChatStrategyRoundRobin
+	case models.ChatStrategyRoundRobin, models.ChatStrategyLeastBusy, models.ChatStrategyBroadcast:
+	default:
+		return "Strategy must be round-robin, least-busy or broadcast"
+	}
+	if q.MaxWaitSeconds < 0 || q.TargetResponseMs < 0 || q.AgentTimeoutSeconds < 0 {
+		return "Timings cannot be negative"
+	}
+	if q.BusinessHoursID != nil {
+		var count int64
+		h.DB.Model(&models.TimeCondition{}).Where("id = ? AND tenant_id = ?", *q.BusinessHoursID, q.TenantID).Count(&count)
+		if count == 0 {
+			return "Business hours time condition not found"
+		}
+	}
+	return ""
+}
+
+// validChatAgentStatus reports whether s is a chat agent status
+func validChatAgentStatus(s string) bool {
+	switch s {
+	case models.ChatAgentAvailable, models.ChatAgentBusy, models.ChatAgentAway, models.ChatAgentOffline:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/meeting"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// =============================
+// Scheduled Conference Meetings
+// =============================
+
+const (
+	// maxMeetingDuration bounds one meeting's window
+	maxMeetingDuration = 24 * time.Hour
+	// maxMeetingAttendees bounds the invite list of one meeting
+	maxMeetingAttendees = 200
+	// defaultReminderMinutes applies when a meeting is created without one
+	defaultReminderMinutes = 15
+)
+
+// conferenceMeetingInput is the body for scheduling or updating a meeting
+type conferenceMeetingInput struct {
+	ConferenceID    uint                             `json:"conference_id"`
+	Title           string                           `json:"title"`
+	Description     string                           `json:"description"`
+	OrganizerName   string                           `json:"organizer_name"`
+	OrganizerEmail  string                           `json:"organizer_email"`
+	DialInNumber    string                           `json:"dial_in_number"`
+	StartAt         time.Time                        `json:"start_at"`
+	EndAt           time.Time                        `json:"end_at"`
+	ReminderMinutes *int                             `json:"reminder_minutes"`
+	Attendees       []conferenceMeetingAttendeeInput `json:"attendees"`
+}
+
+// conferenceMeetingAttendeeInput is one invitee; an email gets a calendar
+// invite and a phone with dial_out gets called at start time
+type conferenceMeetingAttendeeInput struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Moderator bool   `json:"moderator"`
+	DialOut   bool   `json:"dial_out"`
+}
+
+// key identifies an attendee across edits: their email, else their phone
+func (a conferenceMeetingAttendeeInput) key() string {
+	if a.Email != "" {
+		return strings.ToLower(a.Email)
+	}
+	return a.Phone
+}
+
+// ListConferenceMeetings lists scheduled meetings, filtered by room, status
+// and a start_at window (RFC 3339 "from" and "to")
+func (h *Handler) ListConferenceMeetings(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.ConferenceMeeting{}).Where("tenant_id = ?", middleware.GetTenantID(c))
+	if conferenceID := c.QueryInt("conference_id"); conferenceID > 0 {
+		query = query.Where("conference_id = ?", conferenceID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	for param, cond := range map[string]string{"from": "start_at >= ?", "to": "start_at < ?"} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + param + " time, use RFC 3339"})
+			}
+			query = query.Where(cond, t)
+		}
+	}
+
+	page := max(c.QueryInt("page", 1), 1)
+	limit := min(max(c.QueryInt("limit", 50), 1), 500)
+
+	var total int64
+	query.Count(&total)
+
+	var meetings []models.ConferenceMeeting
+	if err := query.Preload("Attendees", "removed = ?", false).
+		Order("start_at ASC").Offset((page - 1) * limit).Limit(limit).Find(&meetings).Error; err != nil {
+		h.logError("API", "ListConferenceMeetings: Failed to fetch meetings", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch meetings"})
+	}
+	return c.JSON(fiber.Map{"data": meetings, "total": total, "page": page, "limit": limit})
+}
+
+// GetConferenceMeeting returns a meeting with its attendees and their
+// invite and dial-out status
+func (h *Handler) GetConferenceMeeting(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "GetConferenceMeeting")
+	if !ok {
+		return nil
+	}
+	return c.JSON(fiber.Map{"data": m})
+}
+
+// CreateConferenceMeeting schedules a meeting in a conference room with
+// fresh one-time PINs. Invites go out on the scheduler's next pass.
+func (h *Handler) CreateConferenceMeeting(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var input conferenceMeetingInput
+	if err := c.BodyParser(&input); err != nil {
+		h.logWarn("API", "CreateConferenceMeeting: Invalid request payload", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	if claims := middleware.GetClaims(c); claims != nil {
+		if input.OrganizerEmail == "" {
+			input.OrganizerEmail = claims.Email
+		}
+		if input.OrganizerName == "" {
+			input.OrganizerName = claims.Username
+		}
+	}
+	if input.ReminderMinutes == nil {
+		reminder := defaultReminderMinutes
+		input.ReminderMinutes = &reminder
+	}
+
+	m := models.ConferenceMeeting{TenantID: tenantID, Status: models.MeetingScheduled}
+	if status, msg := h.applyConferenceMeetingInput(&m, &input); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	m.GeneratePINs()
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&m).Error; err != nil {
+			return err
+		}
+		for _, a := range input.Attendees {
+			attendee := newMeetingAttendee(&m, a)
+			if err := tx.Create(&attendee).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logError("API", "CreateConferenceMeeting: Failed to create meeting", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create meeting"})
+	}
+
+	h.logInfo("API", "CreateConferenceMeeting: Meeting scheduled", h.reqFields(c, map[string]interface{}{"meeting_id": m.ID}))
+	h.DB.Preload("Attendees", "removed = ?", false).First(&m, m.ID)
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": m, "message": "Meeting scheduled"})
+}
+
+// UpdateConferenceMeeting replaces a meeting's details and attendee list.
+// Everyone invited gets an updated invite, and dropped attendees a
+// cancellation. PINs are kept.
+func (h *Handler) UpdateConferenceMeeting(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "UpdateConferenceMeeting")
+	if !ok {
+		return nil
+	}
+	if m.Status != models.MeetingScheduled && m.Status != models.MeetingInProgress {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Meeting is " + string(m.Status)})
+	}
+
+	var input conferenceMeetingInput
+	if err := c.BodyParser(&input); err != nil {
+		h.logWarn("API", "UpdateConferenceMeeting: Invalid request payload", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	if input.ReminderMinutes == nil {
+		input.ReminderMinutes = &m.ReminderMinutes
+	}
+	if m.Status == models.MeetingInProgress && (input.ConferenceID != m.ConferenceID || !input.StartAt.Equal(m.StartAt)) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A meeting in progress cannot change its room or start time"})
+	}
+
+	previousStart, previousReminder := m.StartAt, m.ReminderMinutes
+	if status, msg := h.applyConferenceMeetingInput(m, &input); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	m.Sequence++
+	if !m.StartAt.Equal(previousStart) || m.ReminderMinutes != previousReminder {
+		m.ReminderSentAt = nil
+	}
+
+	existing := make(map[string]models.ConferenceMeetingAttendee, len(m.Attendees))
+	for _, a := range m.Attendees {
+		key := a.Phone
+		if a.Email != "" {
+			key = strings.ToLower(a.Email)
+		}
+		existing[key] = a
+	}
+	now := time.Now()
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Attendees", "Conference").Save(m).Error; err != nil {
+			return err
+		}
+		for _, in := range input.Attendees {
+			a, found := existing[in.key()]
+			if !found {
+				a = newMeetingAttendee(m, in)
+				if a.DialOut && m.Status == models.MeetingInProgress {
+					a.DialStatus, a.NextDialAt = models.MeetingDialPending, &now
+				}
+				if err := tx.Create(&a).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			delete(existing, in.key())
+			a.Name, a.Email, a.Phone = in.Name, in.Email, in.Phone
+			a.Moderator, a.DialOut = in.Moderator, in.DialOut && in.Phone != ""
+			a.InviteStatus, a.InviteError = inviteStatusFor(a.Email), ""
+			if err := tx.Save(&a).Error; err != nil {
+				return err
+			}
+		}
+
+		// Whoever is left was dropped: cancel what they were sent
+		for _, a := range existing {
+			if a.Email == "" || a.InvitedAt == nil {
+				if err := tx.Delete(&a).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(&a).Updates(map[string]interface{}{
+				"removed":       true,
+				"invite_status": models.MeetingInviteCancelPending,
+				"next_dial_at":  nil,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logError("API", "UpdateConferenceMeeting: Failed to update meeting", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update meeting"})
+	}
+
+	h.logInfo("API", "UpdateConferenceMeeting: Meeting updated", h.reqFields(c, map[string]interface{}{"meeting_id": m.ID}))
+	h.DB.Preload("Attendees", "removed = ?", false).First(m, m.ID)
+	return c.JSON(fiber.Map{"data": m, "message": "Meeting updated"})
+}
+
+// CancelConferenceMeeting cancels a meeting: its PINs stop working, pending
+// dial-outs are dropped and invited attendees get a cancellation
+func (h *Handler) CancelConferenceMeeting(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "CancelConferenceMeeting")
+	if !ok {
+		return nil
+	}
+	if m.Status == models.MeetingCancelled || m.Status == models.MeetingCompleted {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Meeting is already " + string(m.Status)})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(m).Updates(map[string]interface{}{
+			"status":   models.MeetingCancelled,
+			"sequence": gorm.Expr("sequence + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ConferenceMeetingAttendee{}).
+			Where("meeting_id = ?", m.ID).Update("next_dial_at", nil).Error; err != nil {
+			return err
+		}
+		// Attendees never reached need no cancellation
+		if err := tx.Model(&models.ConferenceMeetingAttendee{}).
+			Where("meeting_id = ? AND invited_at IS NULL", m.ID).
+			Update("invite_status", "").Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ConferenceMeetingAttendee{}).
+			Where("meeting_id = ? AND email <> '' AND invited_at IS NOT NULL", m.ID).
+			Update("invite_status", models.MeetingInviteCancelPending).Error
+	})
+	if err != nil {
+		h.logError("API", "CancelConferenceMeeting: Failed to cancel meeting", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel meeting"})
+	}
+
+	h.logInfo("API", "CancelConferenceMeeting: Meeting cancelled", h.reqFields(c, map[string]interface{}{"meeting_id": m.ID}))
+	return c.JSON(fiber.Map{"message": "Meeting cancelled"})
+}
+
+// ResendConferenceMeetingInvites queues the invite again for every attendee
+// with an email address
+func (h *Handler) ResendConferenceMeetingInvites(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "ResendConferenceMeetingInvites")
+	if !ok {
+		return nil
+	}
+	if m.Status != models.MeetingScheduled && m.Status != models.MeetingInProgress {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Meeting is " + string(m.Status)})
+	}
+
+	result := h.DB.Model(&models.ConferenceMeetingAttendee{}).
+		Where("meeting_id = ? AND removed = ? AND email <> ''", m.ID, false).
+		Updates(map[string]interface{}{"invite_status": models.MeetingInvitePending, "invite_error": ""})
+	if result.Error != nil {
+		h.logError("API", "ResendConferenceMeetingInvites: Failed to queue invites", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to queue invites"})
+	}
+	return c.JSON(fiber.Map{"message": fmt.Sprintf("%d invites queued", result.RowsAffected), "queued": result.RowsAffected})
+}
+
+// DialConferenceMeetingAttendees calls attendees into an open meeting now.
+// Send {"attendee_ids": [...]} to pick attendees; by default every
+// dial-out attendee not already in the room is called.
+func (h *Handler) DialConferenceMeetingAttendees(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "DialConferenceMeetingAttendees")
+	if !ok {
+		return nil
+	}
+	if !m.IsOpen(time.Now()) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Meeting is not open"})
+	}
+
+	var input struct {
+		AttendeeIDs []uint `json:"attendee_ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			h.logWarn("API", "DialConferenceMeetingAttendees: Invalid request payload", h.reqFields(c, nil))
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+		}
+	}
+
+	query := h.DB.Model(&models.ConferenceMeetingAttendee{}).
+		Where("meeting_id = ? AND removed = ? AND phone <> '' AND (dial_status IS NULL OR dial_status <> ?)",
+			m.ID, false, models.MeetingDialDialing)
+	if len(input.AttendeeIDs) > 0 {
+		query = query.Where("id IN ?", input.AttendeeIDs)
+	} else {
+		query = query.Where("dial_out = ? AND (dial_status IS NULL OR dial_status <> ?)", true, models.MeetingDialAnswered)
+	}
+	result := query.Updates(map[string]interface{}{
+		"dial_status":   models.MeetingDialPending,
+		"dial_attempts": 0,
+		"next_dial_at":  time.Now(),
+	})
+	if result.Error != nil {
+		h.logError("API", "DialConferenceMeetingAttendees: Failed to queue calls", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to queue calls"})
+	}
+
+	h.logInfo("API", "DialConferenceMeetingAttendees: Dial-out queued", h.reqFields(c, map[string]interface{}{"meeting_id": m.ID, "queued": result.RowsAffected}))
+	return c.JSON(fiber.Map{"message": fmt.Sprintf("%d calls queued", result.RowsAffected), "queued": result.RowsAffected})
+}
+
+// GetConferenceMeetingICS downloads the meeting as an .ics file carrying
+// the moderator PIN, for the organizer's own calendar
+func (h *Handler) GetConferenceMeetingICS(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "GetConferenceMeetingICS")
+	if !ok {
+		return nil
+	}
+
+	var room models.Conference
+	var tenant models.Tenant
+	if h.DB.Unscoped().First(&room, m.ConferenceID).Error != nil || h.DB.First(&tenant, m.TenantID).Error != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Conference not found"})
+	}
+
+	method := meeting.MethodRequest
+	if m.Status == models.MeetingCancelled {
+		method = meeting.MethodCancel
+	}
+	c.Set("Content-Type", "text/calendar; charset=utf-8; method="+method)
+	c.Set("Content-Disposition", "attachment; filename=meeting-"+strconv.FormatUint(uint64(m.ID), 10)+".ics")
+	return c.Send(meeting.BuildICS(m, &room, tenant.Domain, nil, method))
+}
+
+// GetConferenceMeetingSessions reports the conference sessions a meeting
+// ran, with their participants
+func (h *Handler) GetConferenceMeetingSessions(c *fiber.Ctx) error {
+	m, ok := h.conferenceMeeting(c, "GetConferenceMeetingSessions")
+	if !ok {
+		return nil
+	}
+
+	var sessions []models.ConferenceSession
+	if err := h.DB.Where("meeting_id = ? AND tenant_id = ?", m.ID, m.TenantID).
+		Preload("Participants").Order("start_time ASC").Find(&sessions).Error; err != nil {
+		h.logError("API", "GetConferenceMeetingSessions: Failed to fetch sessions", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	minutes, participants := 0, 0
+	for _, s := range sessions {
+		minutes += s.Duration() / 60
+		participants += len(s.Participants)
+	}
+	answered := 0
+	for _, a := range m.Attendees {
+		if a.DialStatus == models.MeetingDialAnswered {
+			answered++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"data": sessions,
+		"summary": fiber.Map{
+			"sessions":          len(sessions),
+			"total_minutes":     minutes,
+			"participants":      participants,
+			"attendees":         len(m.Attendees),
+			"dial_outs_joined":  answered,
+			"meeting_status":    m.Status,
+			"meeting_starts_at": m.StartAt,
+		},
+	})
+}
+
+// conferenceMeeting loads the :id meeting of the tenant with its current
+// attendees, writing a 404 when missing
+func (h *Handler) conferenceMeeting(c *fiber.Ctx, fn string) (*models.ConferenceMeeting, bool) {
+	var m models.ConferenceMeeting
+	if err := h.DB.Preload("Attendees", "removed = ?", false).
+		Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&m).Error; err != nil {
+		h.logWarn("API", fn+": Meeting not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Meeting not found"})
+		return nil, false
+	}
+	return &m, true
+}
+
+// applyConferenceMeetingInput validates input onto m, returning an HTTP
+// status and message when it is rejected
+func (h *Handler) applyConferenceMeetingInput(m *models.ConferenceMeeting, input *conferenceMeetingInput) (int, string) {
+	input.Title = strings.TrimSpace(input.Title)
+	if input.Title == "" {
+		return http.StatusBadRequest, "Title is required"
+	}
+	if input.StartAt.IsZero() || input.EndAt.IsZero() {
+		return http.StatusBadRequest, "start_at and end_at are required (RFC 3339)"
+	}
+	if !input.EndAt.After(input.StartAt) {
+		return http.StatusBadRequest, "end_at must be after start_at"
+	}
+	if input.EndAt.Sub(input.StartAt) > maxMeetingDuration {
+		return http.StatusBadRequest, "Meetings can last at most 24 hours"
+	}
+	if !input.EndAt.After(time.Now()) {
+		return http.StatusBadRequest, "Meeting would already be over"
+	}
+	if *input.ReminderMinutes < 0 || *input.ReminderMinutes > 7*24*60 {
+		return http.StatusBadRequest, "reminder_minutes must be between 0 and 10080"
+	}
+	if input.OrganizerEmail != "" && !isValidEmail(input.OrganizerEmail) {
+		return http.StatusBadRequest, "Invalid organizer email"
+	}
+	if len(input.Attendees) > maxMeetingAttendees {
+		return http.StatusBadRequest, fmt.Sprintf("A meeting can have at most %d attendees", maxMeetingAttendees)
+	}
+
+	seen := make(map[string]bool, len(input.Attendees))
+	for i := range input.Attendees {
+		a := &input.Attendees[i]
+		a.Name, a.Email, a.Phone = strings.TrimSpace(a.Name), strings.TrimSpace(a.Email), strings.TrimSpace(a.Phone)
+		if a.Email == "" && a.Phone == "" {
+			return http.StatusBadRequest, "Each attendee needs an email or a phone number"
+		}
+		if a.Email != "" && !isValidEmail(a.Email) {
+			return http.StatusBadRequest, "Invalid attendee email: " + a.Email
+		}
+		if a.DialOut && a.Phone == "" {
+			return http.StatusBadRequest, "Dial-out attendees need a phone number"
+		}
+		if a.Phone != "" && !meeting.ValidPhone(a.Phone) {
+			return http.StatusBadRequest, "Invalid attendee phone (digits with an optional leading +): " + a.Phone
+		}
+		if seen[a.key()] {
+			return http.StatusBadRequest, "Duplicate attendee: " + a.key()
+		}
+		seen[a.key()] = true
+	}
+
+	var room models.Conference
+	if err := h.DB.Where("id = ? AND tenant_id = ?", input.ConferenceID, m.TenantID).First(&room).Error; err != nil {
+		return http.StatusBadRequest, "Conference not found"
+	}
+	if !room.Enabled {
+		return http.StatusBadRequest, "Conference is disabled"
+	}
+
+	// A room hosts one meeting at a time, as the meeting's PINs replace its own
+	var overlapping int64
+	h.DB.Model(&models.ConferenceMeeting{}).
+		Where("conference_id = ? AND id <> ? AND status IN ? AND start_at < ? AND end_at > ?",
+			room.ID, m.ID, []models.ConferenceMeetingStatus{models.MeetingScheduled, models.MeetingInProgress},
+			input.EndAt, input.StartAt).
+		Count(&overlapping)
+	if overlapping > 0 {
+		return http.StatusConflict, "Another meeting is booked in this conference room at that time"
+	}
+
+	m.ConferenceID = room.ID
+	m.Title = input.Title
+	m.Description = input.Description
+	m.OrganizerName = strings.TrimSpace(input.OrganizerName)
+	m.OrganizerEmail = strings.TrimSpace(input.OrganizerEmail)
+	m.DialInNumber = strings.TrimSpace(input.DialInNumber)
+	m.StartAt, m.EndAt = input.StartAt, input.EndAt
+	m.ReminderMinutes = *input.ReminderMinutes
+	return 0, ""
+}
+
+// newMeetingAttendee builds an attendee row queued for its invite
+func newMeetingAttendee(m *models.ConferenceMeeting, in conferenceMeetingAttendeeInput) models.ConferenceMeetingAttendee {
+	return models.ConferenceMeetingAttendee{
+		MeetingID:    m.ID,
+		TenantID:     m.TenantID,
+		Name:         in.Name,
+		Email:        in.Email,
+		Phone:        in.Phone,
+		Moderator:    in.Moderator,
+		DialOut:      in.DialOut,
+		InviteStatus: inviteStatusFor(in.Email),
+	}
+}
+
+// inviteStatusFor is the initial invite state of an attendee
+func inviteStatusFor(email string) string {
+	if email == "" {
+		return ""
+	}
+	return models.MeetingInvitePending
+}
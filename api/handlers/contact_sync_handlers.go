@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/contactsync"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Contact Sources
+// =====================
+
+// contactWebhookInput is a contact source as written by the API. Credentials
+// are write-only: they are encrypted on save and never returned.
+type contactWebhookInput struct {
+	models.ContactWebhook
+	AuthConfig *contactsync.AuthConfig `json:"auth_config"`
+}
+
+// ListContactWebhooks lists the tenant's contact sources
+func (h *Handler) ListContactWebhooks(c *fiber.Ctx) error {
+	var webhooks []models.ContactWebhook
+	h.DB.Where("tenant_id = ?", middleware.GetTenantID(c)).Order("name").Find(&webhooks)
+	return c.JSON(webhooks)
+}
+
+// CreateContactWebhook adds a contact source
+func (h *Handler) CreateContactWebhook(c *fiber.Ctx) error {
+	input := contactWebhookInput{ContactWebhook: models.ContactWebhook{Enabled: true, SyncInterval: 3600}}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	webhook := input.ContactWebhook
+	webhook.ID = 0
+	webhook.TenantID = middleware.GetTenantID(c)
+	webhook.AuthConfig = ""
+	webhook.LastSyncAt, webhook.LastSyncStatus, webhook.LastSyncError = nil, "", ""
+	if msg := validateContactWebhook(&webhook); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := h.sealContactAuth(&webhook, input.AuthConfig); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.DB.Create(&webhook).Error; err != nil {
+		h.logError("MESSAGING", "CreateContactWebhook: Failed to create source", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create contact source"})
+	}
+	// Zero values the column defaults would otherwise replace
+	h.DB.Model(&webhook).Select("sync_interval", "enabled").Updates(&webhook)
+
+	h.logInfo("MESSAGING", "CreateContactWebhook: Source created", h.reqFields(c, map[string]interface{}{"webhook_id": webhook.ID}))
+	return c.Status(http.StatusCreated).JSON(webhook)
+}
+
+// GetContactWebhook returns a contact source
+func (h *Handler) GetContactWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.contactWebhook(c, "GetContactWebhook")
+	if !ok {
+		return nil
+	}
+	return c.JSON(webhook)
+}
+
+// UpdateContactWebhook updates a contact source. Stored credentials are
+// kept unless auth_config is sent.
+func (h *Handler) UpdateContactWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.contactWebhook(c, "UpdateContactWebhook")
+	if !ok {
+		return nil
+	}
+
+	input := contactWebhookInput{ContactWebhook: *webhook}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	updated := input.ContactWebhook
+	updated.ID, updated.UUID, updated.TenantID = webhook.ID, webhook.UUID, webhook.TenantID
+	updated.AuthConfig = webhook.AuthConfig
+	updated.LastSyncAt, updated.LastSyncStatus, updated.LastSyncError = webhook.LastSyncAt, webhook.LastSyncStatus, webhook.LastSyncError
+	if msg := validateContactWebhook(&updated); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := h.sealContactAuth(&updated, input.AuthConfig); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.DB.Model(webhook).Select("name", "description", "source", "fetch_url", "fetch_method",
+		"fetch_headers", "auth_type", "auth_config", "field_mapping", "list_url", "list_path",
+		"external_id_field", "pagination", "page_param", "page_size_param", "page_size", "next_path",
+		"conflict_policy", "delete_policy", "sync_interval", "enabled").Updates(&updated).Error; err != nil {
+		h.logError("MESSAGING", "UpdateContactWebhook: Failed to update source", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update contact source"})
+	}
+
+	h.logInfo("MESSAGING", "UpdateContactWebhook: Source updated", h.reqFields(c, map[string]interface{}{"webhook_id": webhook.ID}))
+	return c.JSON(updated)
+}
+
+// DeleteContactWebhook deletes a contact source and its sync history. Its
+// contacts are kept.
+func (h *Handler) DeleteContactWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.contactWebhook(c, "DeleteContactWebhook")
+	if !ok {
+		return nil
+	}
+
+	h.DB.Where("webhook_id = ?", webhook.ID).Delete(&models.ContactSyncRun{})
+	if err := h.DB.Delete(webhook).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete contact source"})
+	}
+
+	h.logInfo("MESSAGING", "DeleteContactWebhook: Source deleted", h.reqFields(c, map[string]interface{}{"webhook_id": webhook.ID}))
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// SyncContactWebhook starts a full pull of a contact source in the
+// background and returns its run
+func (h *Handler) SyncContactWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.contactWebhook(c, "SyncContactWebhook")
+	if !ok {
+		return nil
+	}
+	if h.ContactSync == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Contact sync is not running"})
+	}
+
+	run, err := h.ContactSync.Trigger(webhook, contactsync.TriggerManual)
+	switch {
+	case errors.Is(err, contactsync.ErrNoListURL):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Contact source has no list URL"})
+	case errors.Is(err, contactsync.ErrSyncRunning):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A sync is already running for this source"})
+	case err != nil:
+		h.logError("MESSAGING", "SyncContactWebhook: Failed to start sync", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start sync"})
+	}
+
+	h.logInfo("MESSAGING", "SyncContactWebhook: Sync started", h.reqFields(c, map[string]interface{}{"webhook_id": webhook.ID, "run_id": run.ID}))
+	return c.Status(http.StatusAccepted).JSON(run)
+}
+
+// ListContactSyncRuns returns a contact source's sync history, newest first
+func (h *Handler) ListContactSyncRuns(c *fiber.Ctx) error {
+	webhook, ok := h.contactWebhook(c, "ListContactSyncRuns")
+	if !ok {
+		return nil
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	var runs []models.ContactSyncRun
+	h.DB.Where("webhook_id = ?", webhook.ID).Order("id DESC").Limit(limit).Find(&runs)
+	return c.JSON(runs)
+}
+
+// contactWebhook loads the :id contact source of the tenant, writing a 404
+// when missing
+func (h *Handler) contactWebhook(c *fiber.Ctx, fn string) (*models.ContactWebhook, bool) {
+	var webhook models.ContactWebhook
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&webhook).Error; err != nil {
+		h.logWarn("MESSAGING", fn+": Contact source not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Contact source not found"})
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// sealContactAuth encrypts new credentials onto a source, or clears them
+// when it no longer authenticates. It returns a status and message on error.
+func (h *Handler) sealContactAuth(w *models.ContactWebhook, auth *contactsync.AuthConfig) (int, string) {
+	if w.AuthType == "none" {
+		w.AuthConfig = ""
+		return 0, ""
+	}
+	if auth == nil {
+		if w.AuthConfig == "" {
+			return http.StatusBadRequest, "auth_config is required for " + w.AuthType + " auth"
+		}
+		return 0, ""
+	}
+	if err := auth.Validate(w.AuthType); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if h.ContactSync == nil {
+		return http.StatusServiceUnavailable, "Contact sync is not running"
+	}
+	sealed, err := h.ContactSync.EncryptAuthConfig(auth)
+	if errors.Is(err, contactsync.ErrNoEncryption) {
+		return http.StatusBadRequest, "Encryption is not configured; credentials cannot be stored"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to encrypt credentials"
+	}
+	w.AuthConfig = sealed
+	return 0, ""
+}
+
+// validateContactWebhook checks a contact source and fills in defaults. It
+// returns a message describing the first problem found.
+func validateContactWebhook(w *models.ContactWebhook) string {
+	if w.Name == "" || w.Source == "" {
+		return "Name and source are required"
+	}
+	for _, u := range []string{w.FetchURL, w.ListURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "Fetch and list URLs must be http or https URLs"
+		}
+	}
+	if w.FetchMethod == "" {
+		w.FetchMethod = http.MethodGet
+	}
+
+	switch w.AuthType {
+	case "":
+		w.AuthType = "none"
+	case "none", "basic", "bearer", "oauth2":
+	default:
+		return "Auth type must be none, basic, bearer or oauth2"
+	}
+
+	switch w.Pagination {
+	case "":
+		w.Pagination = "none"
+	case "none", "page", "offset", "cursor", "link":
+	default:
+		return "Pagination must be none, page, offset, cursor or link"
+	}
+	if w.PageSize == 0 {
+		w.PageSize = 100
+	}
+	if w.PageSize < 1 || w.PageSize > 1000 {
+		return "Page size must be between 1 and 1000"
+	}
+	if w.ExternalIDField == "" {
+		w.ExternalIDField = "id"
+	}
+
+	switch w.ConflictPolicy {
+	case "":
+		w.ConflictPolicy = models.ContactConflictRemote
+	case models.ContactConflictRemote, models.ContactConflictLocal:
+	default:
+		return "Conflict policy must be remote or local"
+	}
+	switch w.DeletePolicy {
+	case "":
+		w.DeletePolicy = models.ContactDeleteArchive
+	case models.ContactDeleteArchive, models.ContactDeleteDelete, models.ContactDeleteIgnore:
+	default:
+		return "Delete policy must be archive, delete or ignore"
+	}
+
+	if w.SyncInterval < 0 {
+		return "Sync interval cannot be negative"
+	}
+	if w.SyncInterval > 0 && w.SyncInterval < 300 {
+		return "Sync interval must be at least 300 seconds, or 0 to sync on demand only"
+	}
+	return ""
+}
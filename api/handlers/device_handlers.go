@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"bytes"
 	"callsign/middleware"
 	"callsign/models"
+	"callsign/services/provisioning"
+	"encoding/xml"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -350,6 +357,7 @@ func (h *Handler) GetDeviceConfigSecure(c *fiber.Ctx) error {
 				"mac":    mac,
 			})
 		}
+		h.recordProvision(c, &tenant, nil, normalizedMAC, fiber.StatusForbidden, "provisioning_disabled")
 
 		c.Status(fiber.StatusForbidden)
 		return c.SendString("Provisioning disabled for this tenant")
@@ -367,6 +375,7 @@ func (h *Handler) GetDeviceConfigSecure(c *fiber.Ctx) error {
 				"user_agent": userAgent,
 			})
 		}
+		h.recordProvision(c, &tenant, nil, normalizedMAC, fiber.StatusForbidden, "invalid_secret")
 
 		c.Status(fiber.StatusForbidden)
 		return c.SendString("Invalid provisioning URL")
@@ -380,54 +389,12 @@ func (h *Handler) GetDeviceConfigSecure(c *fiber.Ctx) error {
 		Preload("Lines").
 		Preload("Lines.Extension").
 		First(&device).Error; err != nil {
+		h.recordProvision(c, &tenant, nil, normalizedMAC, fiber.StatusNotFound, "unknown_device")
 		c.Status(fiber.StatusNotFound)
 		return c.SendString("Device not found")
 	}
 
-	if !device.Enabled {
-		c.Status(fiber.StatusForbidden)
-		return c.SendString("Device is disabled")
-	}
-
-	// Get template (from device, profile, or default for manufacturer)
-	var tmpl models.DeviceTemplate
-	if device.TemplateID != nil {
-		h.DB.First(&tmpl, *device.TemplateID)
-	} else if device.Profile != nil && device.Profile.TemplateID != nil {
-		h.DB.First(&tmpl, *device.Profile.TemplateID)
-	} else {
-		// Try to find default template for manufacturer/model
-		h.DB.Where("manufacturer = ? AND (model = ? OR model = '' OR model IS NULL) AND enabled = ?",
-			device.Manufacturer, device.Model, true).
-			Order("model DESC").
-			First(&tmpl)
-	}
-
-	if tmpl.ID == 0 || tmpl.ConfigTemplate == "" {
-		c.Status(fiber.StatusNotFound)
-		return c.SendString("No template available for this device")
-	}
-
-	// Verify User-Agent if pattern is set
-	if tmpl.UserAgentPattern != "" {
-		userAgent := c.Get("User-Agent")
-		matched, _ := regexp.MatchString(tmpl.UserAgentPattern, userAgent)
-		if !matched {
-			c.Status(fiber.StatusForbidden)
-			return c.SendString("Device not authorized")
-		}
-	}
-
-	// Verify MAC pattern if set
-	if tmpl.MACPattern != "" {
-		matched, _ := regexp.MatchString(tmpl.MACPattern, normalizedMAC)
-		if !matched {
-			c.Status(fiber.StatusForbidden)
-			return c.SendString("Device model mismatch")
-		}
-	}
-
-	return h.renderDeviceConfig(c, &device, &tmpl, &tenant)
+	return h.provisionDevice(c, &device, &tenant)
 }
 
 // GetDeviceConfig returns the provisioning configuration for a device (legacy, no auth)
@@ -446,38 +413,159 @@ func (h *Handler) GetDeviceConfig(c *fiber.Ctx) error {
 		return c.SendString("Device not found")
 	}
 
+	// Get tenant for domain
+	var tenant models.Tenant
+	h.DB.First(&tenant, device.TenantID)
+
+	return h.provisionDevice(c, &device, &tenant)
+}
+
+// provisionDevice resolves the device's template chain, enforces its access
+// rules and renders the config. Every outcome is written to the device's
+// provisioning access log.
+func (h *Handler) provisionDevice(c *fiber.Ctx, device *models.Device, tenant *models.Tenant) error {
 	if !device.Enabled {
+		h.recordProvision(c, tenant, device, device.MAC, fiber.StatusForbidden, "device_disabled")
 		c.Status(fiber.StatusForbidden)
 		return c.SendString("Device is disabled")
 	}
 
-	// Get template
+	chain, err := h.deviceTemplateChain(device)
+	if err != nil {
+		h.logError("PROVISION", "provisionDevice: "+err.Error(), h.reqFields(c, map[string]interface{}{"mac": device.MAC}))
+		h.recordProvision(c, tenant, device, device.MAC, fiber.StatusInternalServerError, "template_chain")
+		c.Status(fiber.StatusInternalServerError)
+		return c.SendString("Template inheritance error")
+	}
+	if chain == nil {
+		h.recordProvision(c, tenant, device, device.MAC, fiber.StatusNotFound, "no_template")
+		c.Status(fiber.StatusNotFound)
+		return c.SendString("No template available for this device")
+	}
+
+	if reason, msg := h.provisionDenied(c, chain, device.MAC); reason != "" {
+		h.recordProvision(c, tenant, device, device.MAC, fiber.StatusForbidden, reason)
+		c.Status(fiber.StatusForbidden)
+		return c.SendString(msg)
+	}
+
+	if err := h.renderDeviceConfig(c, device, chain, tenant); err != nil {
+		h.recordProvision(c, tenant, device, device.MAC, fiber.StatusInternalServerError, "render_error")
+		c.Status(fiber.StatusInternalServerError)
+		return c.SendString("Template error: " + err.Error())
+	}
+
+	h.recordProvision(c, tenant, device, device.MAC, fiber.StatusOK, "")
+	return nil
+}
+
+// deviceTemplateChain picks the device's template (from the device, its
+// profile, or the manufacturer/model default) and loads its ancestors.
+// Returns nil when no template applies.
+func (h *Handler) deviceTemplateChain(device *models.Device) (models.TemplateChain, error) {
 	var tmpl models.DeviceTemplate
 	if device.TemplateID != nil {
 		h.DB.First(&tmpl, *device.TemplateID)
+	} else if device.Profile != nil && device.Profile.TemplateID != nil {
+		h.DB.First(&tmpl, *device.Profile.TemplateID)
 	} else {
-		// Try to find default template for manufacturer/model
+		// Try to find default template for manufacturer/model, preferring
+		// the tenant's own override over system templates
 		h.DB.Where("manufacturer = ? AND (model = ? OR model = '' OR model IS NULL) AND enabled = ?",
 			device.Manufacturer, device.Model, true).
+			Where("tenant_id = ? OR tenant_id IS NULL", device.TenantID).
 			Order("model DESC").
+			Order("tenant_id IS NULL").
 			First(&tmpl)
 	}
+	if tmpl.ID == 0 {
+		return nil, nil
+	}
 
-	if tmpl.ID == 0 || tmpl.ConfigTemplate == "" {
-		c.Status(fiber.StatusNotFound)
-		return c.SendString("No template available for this device")
+	chain, err := models.LoadTemplateChain(h.DB, tmpl)
+	if err != nil {
+		return nil, err
 	}
+	for _, t := range chain {
+		if t.ConfigTemplate != "" {
+			return chain, nil
+		}
+	}
+	return nil, nil
+}
 
-	// Get tenant for domain
-	var tenant models.Tenant
-	h.DB.First(&tenant, device.TenantID)
+// provisionDenied applies the chain's access rules to the request and
+// returns a log reason and response message when the phone is refused
+func (h *Handler) provisionDenied(c *fiber.Ctx, chain models.TemplateChain, mac string) (string, string) {
+	if chain.RequireHTTPS() && c.Protocol() != "https" {
+		return "https_required", "HTTPS required"
+	}
+	if !models.IPAllowed(chain.IPWhitelist(), c.IP()) {
+		return "ip_not_allowed", "Device not authorized"
+	}
+	if pattern := chain.UserAgentPattern(); pattern != "" {
+		if matched, _ := regexp.MatchString(pattern, c.Get("User-Agent")); !matched {
+			return "user_agent_mismatch", "Device not authorized"
+		}
+	}
+	if pattern := chain.MACPattern(); pattern != "" {
+		if matched, _ := regexp.MatchString(pattern, strings.ToLower(models.NormalizeMAC(mac))); !matched {
+			return "mac_mismatch", "Device model mismatch"
+		}
+	}
+	return "", ""
+}
+
+// renderDeviceConfig renders the provisioning template chain
+func (h *Handler) renderDeviceConfig(c *fiber.Ctx, device *models.Device, chain models.TemplateChain, tenant *models.Tenant) error {
+	config, err := h.deviceConfig(c, device, chain, tenant)
+	if err != nil {
+		return err
+	}
 
-	return h.renderDeviceConfig(c, &device, &tmpl, &tenant)
+	// Serve it anyway, the template was validated when saved; this catches
+	// values that break the syntax (e.g. unescaped & in an XML label)
+	if err := provisioning.Validate(chain.ConfigType(), config); err != nil {
+		h.logWarn("PROVISION", "renderDeviceConfig: Rendered config is invalid",
+			h.reqFields(c, map[string]interface{}{"mac": device.MAC, "template": chain.Leaf().Name, "error": err.Error()}))
+	}
+
+	c.Set("Content-Type", configContentType(chain.ConfigType()))
+
+	// Update last provision time
+	h.DB.Model(device).Updates(map[string]interface{}{
+		"last_provision":    time.Now(),
+		"last_provision_ip": c.IP(),
+		"last_config":       string(config),
+		"provision_count":   device.ProvisionCount + 1,
+	})
+
+	return c.Send(config)
 }
 
-// renderDeviceConfig renders the provisioning template
-func (h *Handler) renderDeviceConfig(c *fiber.Ctx, device *models.Device, tmpl *models.DeviceTemplate, tenant *models.Tenant) error {
-	// Build provisioning variables
+// configContentType maps a template ConfigType to its Content-Type
+func configContentType(configType string) string {
+	switch configType {
+	case "xml":
+		return "application/xml"
+	case "json":
+		return "application/json"
+	default:
+		return "text/plain"
+	}
+}
+
+// deviceConfig renders the config the device receives when it next fetches
+func (h *Handler) deviceConfig(c *fiber.Ctx, device *models.Device, chain models.TemplateChain, tenant *models.Tenant) ([]byte, error) {
+	var out bytes.Buffer
+	if err := chain.Render(&out, h.provisioningVariables(c, device, chain, tenant)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// provisioningVariables builds the template variables for a device
+func (h *Handler) provisioningVariables(c *fiber.Ctx, device *models.Device, chain models.TemplateChain, tenant *models.Tenant) models.ProvisioningVariables {
 	vars := models.ProvisioningVariables{
 		MAC:          device.MAC,
 		DeviceName:   device.Name,
@@ -485,10 +573,50 @@ func (h *Handler) renderDeviceConfig(c *fiber.Ctx, device *models.Device, tmpl *
 		Manufacturer: device.Manufacturer,
 		Server:       tenant.Domain,
 		Domain:       tenant.Domain,
+		ServerPort:   device.SIPPort,
+		Transport:    device.SIPTransport,
 		TenantName:   tenant.Name,
 		TenantDomain: tenant.Domain,
 		Timestamp:    time.Now(),
 		Lines:        make(map[int]models.LineVariables),
+		Codecs:       models.ParseCodecs(device.SupportedCodecs),
+		Keys:         h.deviceKeys(device.TenantID),
+		Custom:       make(map[string]string),
+		DirectoryURL: provisionURL(c, tenant, device, "directory"),
+	}
+	if vars.ServerPort == 0 {
+		vars.ServerPort = 5060
+	}
+	if vars.Transport == "" {
+		vars.Transport = "udp"
+	}
+
+	// Profile time zone wins over the tenant's
+	loc := tenant.Location()
+	if device.Profile != nil && device.Profile.Timezone != "" {
+		if l, err := time.LoadLocation(device.Profile.Timezone); err == nil {
+			loc = l
+		}
+	}
+	vars.SetTimezone(loc, vars.Timestamp)
+
+	// Tenant defaults first, device-specific values override them
+	var custom []models.ProvisioningVariable
+	h.DB.Where("tenant_id = ? AND (device_id IS NULL OR device_id = ?)", device.TenantID, device.ID).
+		Order("device_id IS NOT NULL").
+		Find(&custom)
+	for _, v := range custom {
+		vars.Custom[v.Name] = v.Value
+	}
+	vars.NTPServer = vars.Custom["ntp_server"]
+	if vars.NTPServer == "" {
+		vars.NTPServer = "pool.ntp.org"
+	}
+
+	if fw := h.deviceFirmware(device, chain); fw != nil {
+		vars.FirmwareURL = firmwareURL(c, tenant, device, fw)
+		vars.FirmwareVersion = fw.Version
+		vars.FirmwareChecksum = fw.Checksum
 	}
 
 	// Add line variables
@@ -520,37 +648,468 @@ func (h *Handler) renderDeviceConfig(c *fiber.Ctx, device *models.Device, tmpl *
 		}
 	}
 
-	// Render template
-	t, err := template.New("config").Parse(tmpl.ConfigTemplate)
+	return vars
+}
+
+// deviceKeys builds the programmable keys shared by a tenant's phones: its
+// speed dials (BLF when the destination is a local extension) followed by
+// its park slots
+func (h *Handler) deviceKeys(tenantID uint) []models.KeyVariables {
+	var groups []models.SpeedDialGroup
+	h.DB.Where("tenant_id = ? AND enabled = ?", tenantID, true).Order("name ASC").Find(&groups)
+
+	var destinations []string
+	for _, g := range groups {
+		for _, e := range g.Entries {
+			destinations = append(destinations, e.Destination)
+		}
+	}
+	local := make(map[string]bool)
+	if len(destinations) > 0 {
+		var exts []string
+		h.DB.Model(&models.Extension{}).
+			Where("tenant_id = ? AND extension IN ?", tenantID, destinations).
+			Pluck("extension", &exts)
+		for _, e := range exts {
+			local[e] = true
+		}
+	}
+
+	var keys []models.KeyVariables
+	for _, g := range groups {
+		entries := append(models.SpeedDialEntries(nil), g.Entries...)
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Slot < entries[j].Slot })
+		for _, e := range entries {
+			if e.Destination == "" {
+				continue
+			}
+			key := models.KeyVariables{Type: models.KeyTypeSpeedDial, Label: e.Label, Value: e.Destination}
+			if local[e.Destination] {
+				key.Type = models.KeyTypeBLF
+				key.BLF = e.Destination
+			}
+			if key.Label == "" {
+				key.Label = e.Destination
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	var slots []models.ParkSlot
+	h.DB.Where("tenant_id = ? AND lot_name = ?", tenantID, "default").Order("slot_number ASC").Find(&slots)
+	for _, slot := range slots {
+		ext := slot.Extension
+		if ext == "" {
+			ext = fmt.Sprintf("*57%02d", slot.SlotNumber)
+		}
+		keys = append(keys, models.KeyVariables{
+			Type:  models.KeyTypePark,
+			Label: fmt.Sprintf("Park %d", slot.SlotNumber),
+			Value: ext,
+			BLF:   "park+" + ext,
+		})
+	}
+
+	for i := range keys {
+		keys[i].Index = i + 1
+	}
+	return keys
+}
+
+// deviceFirmware returns the firmware a device should run: the profile's
+// pinned firmware, else the closest one in its template chain, else the
+// default for its manufacturer/model. Entries without an uploaded file are
+// skipped.
+func (h *Handler) deviceFirmware(device *models.Device, chain models.TemplateChain) *models.Firmware {
+	var id *uint
+	if device.Profile != nil && device.Profile.FirmwareID != nil {
+		id = device.Profile.FirmwareID
+	} else {
+		id = chain.FirmwareID()
+	}
+
+	var fw *models.Firmware
+	if id != nil {
+		var pinned models.Firmware
+		if err := h.DB.Where("enabled = ?", true).First(&pinned, *id).Error; err == nil {
+			fw = &pinned
+		}
+	} else if def, err := models.DefaultFirmware(h.DB, device.Manufacturer, device.Model); err == nil {
+		fw = def
+	}
+
+	if fw == nil || fw.FilePath == "" {
+		return nil
+	}
+	return fw
+}
+
+// provisionURL builds a URL under the device's secure provisioning path on
+// the same scheme and host the phone used to fetch its config
+func provisionURL(c *fiber.Ctx, tenant *models.Tenant, device *models.Device, suffix string) string {
+	if tenant.ProvisioningSecret == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s/api/provision/%s/%s/%s/%s",
+		c.Protocol(), c.Hostname(), tenant.UUID, tenant.ProvisioningSecret,
+		strings.ToLower(models.NormalizeMAC(device.MAC)), suffix)
+}
+
+// firmwareURL is the device's download URL for fw
+func firmwareURL(c *fiber.Ctx, tenant *models.Tenant, device *models.Device, fw *models.Firmware) string {
+	return provisionURL(c, tenant, device, "firmware/"+url.PathEscape(firmwareFileName(fw)))
+}
+
+// firmwareFileName is the name a firmware file is served under
+func firmwareFileName(fw *models.Firmware) string {
+	if fw.FileName != "" {
+		return fw.FileName
+	}
+	return filepath.Base(fw.FilePath)
+}
+
+// recordProvision appends a phone fetch to the provisioning access log. The
+// tenant secret is masked in the stored path.
+func (h *Handler) recordProvision(c *fiber.Ctx, tenant *models.Tenant, device *models.Device, mac string, status int, reason string) {
+	path := c.Path()
+	if tenant.ProvisioningSecret != "" {
+		path = strings.ReplaceAll(path, tenant.ProvisioningSecret, "***")
+	}
+
+	entry := models.DeviceProvisionLog{
+		TenantID:  tenant.ID,
+		MAC:       mac,
+		IP:        c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		Protocol:  c.Protocol(),
+		Path:      path,
+		Status:    status,
+		Reason:    reason,
+	}
+	if device != nil {
+		entry.DeviceID = &device.ID
+	}
+	if err := h.DB.Create(&entry).Error; err != nil {
+		h.logError("PROVISION", "recordProvision: Failed to write access log", h.reqFields(c, map[string]interface{}{"mac": mac}))
+	}
+}
+
+// provisionFetch is an authorized request for a device's provisioning
+// resources (firmware, directory)
+type provisionFetch struct {
+	tenant models.Tenant
+	device models.Device
+	chain  models.TemplateChain
+}
+
+// authorizeProvisionFetch checks the tenant secret, the device and its
+// template access rules for /provision/{tenant_uuid}/{secret}/{mac}/...
+// requests. On failure the response has been written and nil is returned.
+func (h *Handler) authorizeProvisionFetch(c *fiber.Ctx) (*provisionFetch, error) {
+	f := &provisionFetch{}
+	mac := strings.ToLower(models.NormalizeMAC(c.Params("mac")))
+
+	if err := h.DB.Where("uuid = ? AND enabled = ?", c.Params("tenant"), true).First(&f.tenant).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return nil, c.SendString("Invalid provisioning URL")
+	}
+	if !f.tenant.ProvisioningEnabled || f.tenant.ProvisioningSecret == "" || f.tenant.ProvisioningSecret != c.Params("secret") {
+		if h.LogManager != nil {
+			h.LogManager.Warn("PROVISION_BRUTE_FORCE", "Provisioning fetch with invalid secret", map[string]interface{}{
+				"reason": "invalid_secret",
+				"ip":     c.IP(),
+				"tenant": f.tenant.Domain,
+				"mac":    mac,
+				"path":   strings.ReplaceAll(c.Path(), c.Params("secret"), "***"),
+			})
+		}
+		h.recordProvision(c, &f.tenant, nil, mac, fiber.StatusForbidden, "invalid_secret")
+		c.Status(fiber.StatusForbidden)
+		return nil, c.SendString("Invalid provisioning URL")
+	}
+
+	if err := h.DB.Where("mac = ? AND tenant_id = ?", mac, f.tenant.ID).
+		Preload("Profile").
+		First(&f.device).Error; err != nil {
+		h.recordProvision(c, &f.tenant, nil, mac, fiber.StatusNotFound, "unknown_device")
+		c.Status(fiber.StatusNotFound)
+		return nil, c.SendString("Device not found")
+	}
+	if !f.device.Enabled {
+		h.recordProvision(c, &f.tenant, &f.device, mac, fiber.StatusForbidden, "device_disabled")
+		c.Status(fiber.StatusForbidden)
+		return nil, c.SendString("Device is disabled")
+	}
+
+	chain, err := h.deviceTemplateChain(&f.device)
 	if err != nil {
+		h.recordProvision(c, &f.tenant, &f.device, mac, fiber.StatusInternalServerError, "template_chain")
 		c.Status(fiber.StatusInternalServerError)
-		return c.SendString("Template parse error: " + err.Error())
+		return nil, c.SendString("Template inheritance error")
 	}
+	if chain != nil {
+		if reason, msg := h.provisionDenied(c, chain, mac); reason != "" {
+			h.recordProvision(c, &f.tenant, &f.device, mac, fiber.StatusForbidden, reason)
+			c.Status(fiber.StatusForbidden)
+			return nil, c.SendString(msg)
+		}
+	}
+	f.chain = chain
 
-	// Set content type based on config type
-	switch tmpl.ConfigType {
-	case "xml":
-		c.Set("Content-Type", "application/xml")
-	case "cfg":
-		c.Set("Content-Type", "text/plain")
-	case "json":
-		c.Set("Content-Type", "application/json")
-	default:
-		c.Set("Content-Type", "text/plain")
+	return f, nil
+}
+
+// DownloadDeviceFirmware serves the firmware resolved for a device
+// URL: /provision/{tenant_uuid}/{secret}/{mac}/firmware/{filename}
+func (h *Handler) DownloadDeviceFirmware(c *fiber.Ctx) error {
+	f, err := h.authorizeProvisionFetch(c)
+	if f == nil {
+		return err
 	}
 
-	if err := t.Execute(c.Response().BodyWriter(), vars); err != nil {
-		c.Status(fiber.StatusInternalServerError)
-		return c.SendString("Template execution error: " + err.Error())
+	fw := h.deviceFirmware(&f.device, f.chain)
+	filename, _ := url.PathUnescape(c.Params("filename"))
+	if fw == nil || filename != firmwareFileName(fw) {
+		h.recordProvision(c, &f.tenant, &f.device, f.device.MAC, fiber.StatusNotFound, "no_firmware")
+		c.Status(fiber.StatusNotFound)
+		return c.SendString("Firmware not found")
 	}
 
-	// Update last provision time
-	h.DB.Model(device).Updates(map[string]interface{}{
-		"last_provision":  time.Now(),
-		"provision_count": device.ProvisionCount + 1,
-	})
+	basePath := h.Config.FirmwarePath
+	if basePath == "" {
+		basePath = "/usr/share/freeswitch/firmware"
+	}
+	fullPath := filepath.Join(basePath, filepath.Clean("/"+fw.FilePath))
+	if _, err := os.Stat(fullPath); err != nil {
+		h.logError("PROVISION", "DownloadDeviceFirmware: Firmware file missing", h.reqFields(c, map[string]interface{}{"firmware_id": fw.ID}))
+		h.recordProvision(c, &f.tenant, &f.device, f.device.MAC, fiber.StatusNotFound, "firmware_missing")
+		c.Status(fiber.StatusNotFound)
+		return c.SendString("Firmware not found")
+	}
 
-	return nil
+	h.recordProvision(c, &f.tenant, &f.device, f.device.MAC, fiber.StatusOK, "")
+	if fw.Checksum != "" {
+		c.Set("X-Checksum-SHA256", fw.Checksum)
+	}
+	return c.Download(fullPath, filename)
+}
+
+// directoryRoots are the remote phonebook root elements per ?format=; the
+// entries share Cisco's DirectoryEntry/Name/Telephone layout
+var directoryRoots = map[string]string{
+	"cisco":   "CiscoIPPhoneDirectory",
+	"snom":    "SnomIPPhoneDirectory",
+	"yealink": "YealinkIPPhoneDirectory",
+}
+
+// DeviceDirectory serves the tenant's extension directory as a remote
+// phonebook (?format=yealink|cisco|snom|fanvil|grandstream)
+// URL: /provision/{tenant_uuid}/{secret}/{mac}/directory
+func (h *Handler) DeviceDirectory(c *fiber.Ctx) error {
+	f, err := h.authorizeProvisionFetch(c)
+	if f == nil {
+		return err
+	}
+
+	var exts []models.Extension
+	h.DB.Where("tenant_id = ? AND enabled = ? AND directory_visible = ?", f.tenant.ID, true, true).
+		Order("extension ASC").
+		Find(&exts)
+
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	format := c.Query("format")
+	if format == "grandstream" {
+		sb.WriteString("<AddressBook>\n")
+		for _, ext := range exts {
+			first, last := ext.DirectoryFirstName, ext.DirectoryLastName
+			if first == "" && last == "" {
+				first = directoryName(&ext)
+			}
+			fmt.Fprintf(&sb, "  <Contact>\n    <FirstName>%s</FirstName>\n    <LastName>%s</LastName>\n"+
+				"    <Phone>\n      <phonenumber>%s</phonenumber>\n      <accountindex>1</accountindex>\n    </Phone>\n  </Contact>\n",
+				xmlEscape(first), xmlEscape(last), xmlEscape(ext.Extension))
+		}
+		sb.WriteString("</AddressBook>\n")
+	} else {
+		root := directoryRoots[format]
+		if root == "" {
+			root = "IPPhoneDirectory"
+		}
+		fmt.Fprintf(&sb, "<%s>\n  <Title>%s</Title>\n", root, xmlEscape(f.tenant.Name))
+		for _, ext := range exts {
+			fmt.Fprintf(&sb, "  <DirectoryEntry>\n    <Name>%s</Name>\n    <Telephone>%s</Telephone>\n  </DirectoryEntry>\n",
+				xmlEscape(directoryName(&ext)), xmlEscape(ext.Extension))
+		}
+		fmt.Fprintf(&sb, "</%s>\n", root)
+	}
+
+	h.recordProvision(c, &f.tenant, &f.device, f.device.MAC, fiber.StatusOK, "")
+	c.Set("Content-Type", "application/xml")
+	return c.SendString(sb.String())
+}
+
+// directoryName is the name an extension is listed under
+func directoryName(ext *models.Extension) string {
+	if name := strings.TrimSpace(ext.DirectoryFirstName + " " + ext.DirectoryLastName); name != "" {
+		return name
+	}
+	if ext.EffectiveCallerIDName != "" {
+		return ext.EffectiveCallerIDName
+	}
+	return ext.Extension
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// PreviewDeviceConfig renders the exact config a MAC would receive now,
+// without counting it as a fetch. Access rules are reported, not enforced.
+func (h *Handler) PreviewDeviceConfig(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	mac := strings.ToLower(models.NormalizeMAC(c.Params("mac")))
+
+	var device models.Device
+	if err := h.DB.Where("mac = ? AND tenant_id = ?", mac, tenantID).
+		Preload("Profile").
+		Preload("Lines").
+		Preload("Lines.Extension").
+		First(&device).Error; err != nil {
+		h.logWarn("DEVICE", "PreviewDeviceConfig: Device not found", h.reqFields(c, nil))
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
+	}
+	var tenant models.Tenant
+	h.DB.First(&tenant, tenantID)
+
+	chain, config, err := h.pendingDeviceConfig(c, &device, &tenant)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	names := make([]string, len(chain))
+	for i, t := range chain {
+		names[i] = t.Name
+	}
+	result := fiber.Map{
+		"mac":            device.MAC,
+		"device_id":      device.ID,
+		"template_chain": names,
+		"config_type":    chain.ConfigType(),
+		"content_type":   configContentType(chain.ConfigType()),
+		"config":         string(config),
+		"valid":          true,
+		"require_https":  chain.RequireHTTPS(),
+		"ip_whitelist":   chain.IPWhitelist(),
+	}
+	if err := provisioning.Validate(chain.ConfigType(), config); err != nil {
+		result["valid"] = false
+		result["validation_error"] = err.Error()
+	}
+
+	return c.JSON(fiber.Map{"data": result})
+}
+
+// GetDeviceConfigDiff shows what would change for a device on its next
+// fetch, compared to the config it last received
+func (h *Handler) GetDeviceConfigDiff(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var device models.Device
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), tenantID).
+		Preload("Profile").
+		Preload("Lines").
+		Preload("Lines.Extension").
+		First(&device).Error; err != nil {
+		h.logWarn("DEVICE", "GetDeviceConfigDiff: Device not found", h.reqFields(c, nil))
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	diff, err := h.deviceConfigDiff(c, &device)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": diff})
+}
+
+// pendingDeviceConfig resolves the template chain and renders the config a
+// device would receive now
+func (h *Handler) pendingDeviceConfig(c *fiber.Ctx, device *models.Device, tenant *models.Tenant) (models.TemplateChain, []byte, error) {
+	chain, err := h.deviceTemplateChain(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chain == nil {
+		return nil, nil, fmt.Errorf("no template available for this device")
+	}
+	config, err := h.deviceConfig(c, device, chain, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, config, nil
+}
+
+// deviceConfigDiff compares a device's last served config with the config
+// it would receive now
+func (h *Handler) deviceConfigDiff(c *fiber.Ctx, device *models.Device) (fiber.Map, error) {
+	var tenant models.Tenant
+	h.DB.First(&tenant, device.TenantID)
+
+	chain, config, err := h.pendingDeviceConfig(c, device, &tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := provisioning.Diff("last provisioned", "pending", device.LastConfig, string(config))
+	result := fiber.Map{
+		"changed":           diff != "",
+		"diff":              diff,
+		"never_provisioned": device.LastConfig == "",
+		"last_provision":    device.LastProvision,
+		"valid":             true,
+	}
+	if err := provisioning.Validate(chain.ConfigType(), config); err != nil {
+		result["valid"] = false
+		result["validation_error"] = err.Error()
+	}
+	return result, nil
+}
+
+// ListDeviceProvisionLog returns a device's provisioning access log, newest first
+func (h *Handler) ListDeviceProvisionLog(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	id := c.Params("id")
+
+	var device models.Device
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&device).Error; err != nil {
+		h.logWarn("DEVICE", "ListDeviceProvisionLog: Device not found", h.reqFields(c, nil))
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := h.DB.Where("tenant_id = ? AND (device_id = ? OR mac = ?)", tenantID, device.ID, device.MAC)
+	if c.Query("denied") == "true" {
+		query = query.Where("status <> ?", fiber.StatusOK)
+	}
+
+	var entries []models.DeviceProvisionLog
+	if err := query.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		h.logError("DEVICE", "ListDeviceProvisionLog: Failed to fetch log", h.reqFields(c, nil))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch provisioning log"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":              entries,
+		"last_provision":    device.LastProvision,
+		"last_provision_ip": device.LastProvisionIP,
+		"provision_count":   device.ProvisionCount,
+	})
 }
 
 // ReprovisionDevice triggers a re-provision (SIP NOTIFY)
@@ -559,19 +1118,29 @@ func (h *Handler) ReprovisionDevice(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	var device models.Device
-	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&device).Error; err != nil {
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).
+		Preload("Profile").
+		Preload("Lines").
+		Preload("Lines.Extension").
+		First(&device).Error; err != nil {
 		h.logWarn("DEVICE", "ReprovisionDevice: Device not found", h.reqFields(c, nil))
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
 	}
 
+	// Show what the push would change (?dry_run=true stops here)
+	diff, err := h.deviceConfigDiff(c, &device)
+	if err != nil {
+		diff = fiber.Map{"error": err.Error()}
+	}
+	if c.Query("dry_run") == "true" {
+		return c.JSON(fiber.Map{"data": diff, "message": "Dry run, nothing pushed"})
+	}
+
 	// Send SIP NOTIFY to trigger re-provision via ESL
-	if h.ESLManager != nil && h.ESLManager.IsConnected() {
+	if h.ESLManager != nil && h.ESLManager.IsConnected() && len(device.Lines) > 0 {
 		// Get the device's extension and domain for the flush command
 		var ext models.Extension
 		var tenant models.Tenant
-		if device.Lines != nil && len(device.Lines) > 0 {
-			h.DB.Preload("Lines.Extension").First(&device, device.ID)
-		}
 		h.DB.First(&tenant, device.TenantID)
 
 		if err := h.DB.Where("id = ?", device.Lines[0].ExtensionID).First(&ext).Error; err == nil {
@@ -581,7 +1150,7 @@ func (h *Handler) ReprovisionDevice(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(fiber.Map{"message": "Reprovision triggered"})
+	return c.JSON(fiber.Map{"data": diff, "message": "Reprovision triggered"})
 }
 
 // RebootDevice sends a reboot command to a device via ESL
@@ -649,6 +1218,12 @@ func (h *Handler) CreateDeviceTemplate(c *fiber.Ctx) error {
 
 	tmpl.TenantID = &tenantID
 	tmpl.IsSystem = false // Tenant can't create system templates
+	tmpl.Pack = ""
+
+	if err := h.validateDeviceTemplate(&tmpl); err != nil {
+		h.logWarn("DEVICE", "CreateDeviceTemplate: Template validation failed", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Template validation failed", "details": err.Error()})
+	}
 
 	if err := h.DB.Create(&tmpl).Error; err != nil {
 		h.logError("DEVICE", "CreateDeviceTemplate: Failed to create template", h.reqFields(c, nil))
@@ -658,6 +1233,32 @@ func (h *Handler) CreateDeviceTemplate(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": tmpl, "message": "Template created"})
 }
 
+// validateDeviceTemplate checks a template before it is saved: its parent
+// must be a system template or one of the same tenant's, and the chain must
+// render the sample device to valid config for its ConfigType
+func (h *Handler) validateDeviceTemplate(tmpl *models.DeviceTemplate) error {
+	if tmpl.ParentID != nil {
+		var parent models.DeviceTemplate
+		if err := h.DB.First(&parent, *tmpl.ParentID).Error; err != nil {
+			return fmt.Errorf("parent template %d not found", *tmpl.ParentID)
+		}
+		if parent.TenantID != nil && (tmpl.TenantID == nil || *parent.TenantID != *tmpl.TenantID) {
+			return fmt.Errorf("parent template %d not found", *tmpl.ParentID)
+		}
+	}
+
+	chain, err := models.LoadTemplateChain(h.DB, *tmpl)
+	if err != nil {
+		return err
+	}
+	for _, t := range chain {
+		if t.ConfigTemplate != "" {
+			return provisioning.ValidateChain(chain)
+		}
+	}
+	return nil
+}
+
 // ==================
 // Device Profile Handlers (Tenant)
 // ==================
@@ -411,9 +411,8 @@ func (fh *FaxHandler) DownloadFax(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No fax file available"})
 	}
 
-	c.Set("Content-Type", contentType)
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=fax-%s.%s", job.UUID.String()[:8], c.Query("format", "pdf")))
-	return c.SendFile(filePath)
+	return fh.Handler.sendStoredFile(c, filePath, contentType)
 }
 
 // GetActiveFaxes returns currently active/in-progress fax jobs
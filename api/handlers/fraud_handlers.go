@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/fraud"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Fraud Policies (system)
+// =====================
+
+// validateFraudPolicy checks a policy payload's thresholds
+func validateFraudPolicy(p *models.FraudPolicy) error {
+	if p.WindowMinutes < 1 || p.WindowMinutes > 1440 {
+		return errors.New("window_minutes must be between 1 and 1440")
+	}
+	if p.MaxSpend < 0 || p.MaxMinutes < 0 {
+		return errors.New("thresholds must not be negative")
+	}
+	p.HomeCountryCode = strings.TrimPrefix(strings.TrimSpace(p.HomeCountryCode), "+")
+	if strings.Trim(p.HomeCountryCode, "0123456789") != "" || len(p.HomeCountryCode) > 3 {
+		return errors.New("home_country_code must be an E.164 country code")
+	}
+	return nil
+}
+
+// ListFraudPolicies returns the system default policy and every tenant
+// override
+func (h *Handler) ListFraudPolicies(c *fiber.Ctx) error {
+	var policies []models.FraudPolicy
+	if err := h.DB.Order("tenant_id NULLS FIRST").Find(&policies).Error; err != nil {
+		h.logError("FRAUD", "ListFraudPolicies: query failed", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list fraud policies"})
+	}
+	return c.JSON(fiber.Map{"data": policies})
+}
+
+// UpsertFraudPolicy creates or replaces the system default policy
+// (/fraud/policies/default) or a tenant's override
+// (/fraud/policies/:tenant_id)
+func (h *Handler) UpsertFraudPolicy(c *fiber.Ctx) error {
+	var tenantID *uint
+	if param := c.Params("tenant_id"); param != "default" {
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tenant ID"})
+		}
+		var tenant models.Tenant
+		if err := h.DB.Select("id").First(&tenant, id).Error; err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+		}
+		tenantID = &tenant.ID
+	}
+
+	var policy models.FraudPolicy
+	query := h.DB.Where("tenant_id IS NULL")
+	if tenantID != nil {
+		query = h.DB.Where("tenant_id = ?", *tenantID)
+	}
+	query.Limit(1).Find(&policy)
+
+	// Defaults for a new policy; a partial update keeps the current values
+	if policy.ID == 0 {
+		policy = models.FraudPolicy{Enabled: true, WindowMinutes: 60, HomeCountryCode: "1", AutoBlock: true}
+	}
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	policy.TenantID = tenantID
+	if err := validateFraudPolicy(&policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var err error
+	if policy.ID == 0 {
+		// A false flag would take the column default on insert, so the
+		// flags are written again once the row exists
+		enabled, autoBlock := policy.Enabled, policy.AutoBlock
+		if err = h.DB.Create(&policy).Error; err == nil {
+			policy.Enabled, policy.AutoBlock = enabled, autoBlock
+			err = h.DB.Model(&policy).Select("enabled", "auto_block").Updates(&policy).Error
+		}
+	} else {
+		err = h.DB.Save(&policy).Error
+	}
+	if err != nil {
+		h.logError("FRAUD", "UpsertFraudPolicy: failed to save policy", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant": c.Params("tenant_id")}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save fraud policy"})
+	}
+
+	h.logInfo("FRAUD", "UpsertFraudPolicy: policy saved", h.reqFields(c, map[string]interface{}{
+		"tenant": c.Params("tenant_id"), "max_spend": policy.MaxSpend, "max_minutes": policy.MaxMinutes, "auto_block": policy.AutoBlock,
+	}))
+	return c.JSON(fiber.Map{"data": policy})
+}
+
+// DeleteFraudPolicy removes a tenant's override so the system default
+// applies again
+func (h *Handler) DeleteFraudPolicy(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	}
+	result := h.DB.Where("tenant_id = ?", id).Delete(&models.FraudPolicy{})
+	if result.Error != nil {
+		h.logError("FRAUD", "DeleteFraudPolicy: failed to delete policy", h.reqFields(c, map[string]interface{}{"error": result.Error.Error(), "tenant_id": id}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete fraud policy"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant has no fraud policy"})
+	}
+	return c.JSON(fiber.Map{"message": "Fraud policy deleted"})
+}
+
+// ListFraudEvents returns breaches and block changes, newest first,
+// optionally for one tenant
+func (h *Handler) ListFraudEvents(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.FraudEvent{})
+	if tenantID := c.QueryInt("tenant_id"); tenantID > 0 {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var events []models.FraudEvent
+	if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		h.logError("FRAUD", "ListFraudEvents: query failed", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list fraud events"})
+	}
+	return c.JSON(fiber.Map{"data": events})
+}
+
+// GetTenantFraudStatus returns a tenant's block state, effective policy and
+// current window usage
+func (h *Handler) GetTenantFraudStatus(c *fiber.Ctx) error {
+	tenant, ok := h.fraudTenant(c)
+	if !ok {
+		return nil
+	}
+	return h.sendFraudStatus(c, tenant)
+}
+
+// BlockTenantOutbound blocks a tenant's outbound calling by hand
+func (h *Handler) BlockTenantOutbound(c *fiber.Ctx) error {
+	tenant, ok := h.fraudTenant(c)
+	if !ok {
+		return nil
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&req)
+	if strings.TrimSpace(req.Reason) == "" {
+		req.Reason = "Blocked by administrator"
+	}
+	if tenant.OutboundBlocked {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Outbound calling is already blocked"})
+	}
+
+	if err := h.fraudGuard().Block(tenant, req.Reason, h.actorID(c)); err != nil {
+		h.logError("FRAUD", "BlockTenantOutbound: block failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": tenant.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to block outbound calling"})
+	}
+	h.logWarn("FRAUD", "BlockTenantOutbound: outbound calling blocked", h.reqFields(c, map[string]interface{}{"tenant_id": tenant.ID, "reason": req.Reason}))
+	return c.JSON(fiber.Map{"data": tenant})
+}
+
+// UnblockTenantOutbound re-enables a tenant's outbound calling after a
+// fraud block
+func (h *Handler) UnblockTenantOutbound(c *fiber.Ctx) error {
+	tenant, ok := h.fraudTenant(c)
+	if !ok {
+		return nil
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.BodyParser(&req)
+	if !tenant.OutboundBlocked {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Outbound calling is not blocked"})
+	}
+
+	if err := h.fraudGuard().Unblock(tenant, req.Note, h.actorID(c)); err != nil {
+		h.logError("FRAUD", "UnblockTenantOutbound: unblock failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": tenant.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unblock outbound calling"})
+	}
+	h.logInfo("FRAUD", "UnblockTenantOutbound: outbound calling unblocked", h.reqFields(c, map[string]interface{}{"tenant_id": tenant.ID, "note": req.Note}))
+	return c.JSON(fiber.Map{"data": tenant})
+}
+
+// =====================
+// Fraud Status (tenant)
+// =====================
+
+// GetFraudStatus returns the current tenant's block state, effective policy,
+// window usage and recent events
+func (h *Handler) GetFraudStatus(c *fiber.Ctx) error {
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, middleware.GetTenantID(c)).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+	}
+	return h.sendFraudStatus(c, &tenant)
+}
+
+func (h *Handler) sendFraudStatus(c *fiber.Ctx, tenant *models.Tenant) error {
+	policy, err := fraud.PolicyFor(h.DB, tenant.ID)
+	if err != nil {
+		h.logError("FRAUD", "FraudStatus: policy lookup failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": tenant.ID}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load fraud policy"})
+	}
+	var usage *fraud.Usage
+	if policy != nil {
+		if usage, err = fraud.WindowUsage(h.DB, tenant.ID, policy, time.Now()); err != nil {
+			h.logError("FRAUD", "FraudStatus: usage query failed", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": tenant.ID}))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load usage"})
+		}
+	}
+
+	var events []models.FraudEvent
+	h.DB.Where("tenant_id = ?", tenant.ID).Order("created_at DESC").Limit(10).Find(&events)
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"tenant_id":             tenant.ID,
+		"outbound_blocked":      tenant.OutboundBlocked,
+		"outbound_blocked_at":   tenant.OutboundBlockedAt,
+		"outbound_block_reason": tenant.OutboundBlockReason,
+		"policy":                policy,
+		"usage":                 usage,
+		"recent_events":         events,
+	}})
+}
+
+// fraudTenant loads the tenant named by the :tenant_id param, writing the
+// error response itself when it can't
+func (h *Handler) fraudTenant(c *fiber.Ctx) (*models.Tenant, bool) {
+	id, err := strconv.Atoi(c.Params("tenant_id"))
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tenant ID"})
+		return nil, false
+	}
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, id).Error; err != nil {
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+		return nil, false
+	}
+	return &tenant, true
+}
+
+// fraudGuard returns the wired guard, or one without cache, WebSocket or
+// email when none was wired (tests, tools)
+func (h *Handler) fraudGuard() *fraud.Guard {
+	if h.Fraud != nil {
+		return h.Fraud
+	}
+	return fraud.NewGuard(h.DB, h.XMLCache, h.WSHub)
+}
+
+// actorID returns the authenticated user's ID for event attribution
+func (h *Handler) actorID(c *fiber.Ctx) *uint {
+	if claims := middleware.GetClaims(c); claims != nil && claims.UserID != 0 {
+		id := claims.UserID
+		return &id
+	}
+	return nil
+}
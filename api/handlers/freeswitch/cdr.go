@@ -2,6 +2,7 @@ package freeswitch
 
 import (
 	"callsign/models"
+	"callsign/services/rating"
 	"encoding/xml"
 	"net/http"
 	"net/url"
@@ -111,6 +112,12 @@ func (h *FSHandler) HandleXMLCDR(c *fiber.Ctx) error {
 	// Convert to CallRecord
 	record := h.xmlToCallRecord(&xmlCDR)
 
+	// Price carrier calls; an unrated CDR is still stored and can be
+	// re-rated later
+	if err := rating.Rate(h.DB, record); err != nil {
+		log.Warnf("CDR: rating failed for %s: %v", record.UUID, err)
+	}
+
 	// Save to PostgreSQL
 	if err := h.DB.Create(record).Error; err != nil {
 		log.Errorf("CDR: database save failed: %v", err)
@@ -123,8 +130,18 @@ func (h *FSHandler) HandleXMLCDR(c *fiber.Ctx) error {
 		"dest":     record.DestinationNumber,
 		"duration": record.Duration,
 		"hangup":   record.HangupCause,
+		"cost":     record.Cost,
 	}).Info("CDR: received and stored")
 
+	// Carrier calls count toward the tenant's toll-fraud thresholds
+	if h.Fraud != nil && record.GatewayName != "" && record.TenantID != 0 {
+		go func(tenantID uint) {
+			if err := h.Fraud.Check(tenantID); err != nil {
+				log.Warnf("CDR: fraud check failed for tenant %d: %v", tenantID, err)
+			}
+		}(record.TenantID)
+	}
+
 	// Return 200 OK to indicate successful receipt
 	return c.SendStatus(http.StatusOK)
 }
@@ -228,6 +228,13 @@ func (h *FSHandler) buildMultiDialplan(req *XMLCurlRequest) string {
 			hasContent = true
 		}
 
+		// 2e'. Add voicemail distribution lists
+		vmListXML := h.buildVoicemailListDialplans(req)
+		if vmListXML != "" {
+			b.WriteString(vmListXML)
+			hasContent = true
+		}
+
 		// 2f. Add outbound routes (gateway routing for PSTN calls)
 		outboundXML := h.buildOutboundRouteDialplans(req)
 		if outboundXML != "" {
@@ -820,6 +827,54 @@ func (h *FSHandler) buildConferenceDialplans(req *XMLCurlRequest) string {
 	return b.String()
 }
 
+// buildVoicemailListDialplans routes voicemail distribution list numbers to
+// the voicemail ESL socket, which records once and copies to every member
+func (h *FSHandler) buildVoicemailListDialplans(req *XMLCurlRequest) string {
+	domain := req.Context
+	if domain == "default" || domain == "" {
+		domain = req.Domain
+	}
+
+	var tenant models.Tenant
+	if err := h.DB.Where("domain = ?", domain).First(&tenant).Error; err != nil {
+		return ""
+	}
+
+	var lists []models.VoicemailDistributionList
+	h.DB.Where("tenant_id = ? AND enabled = ? AND extension != ''", tenant.ID, true).Find(&lists)
+
+	if len(lists) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`      <!-- Voicemail Distribution Lists -->`)
+	b.WriteString("\n")
+
+	for _, list := range lists {
+		b.WriteString(fmt.Sprintf(`      <extension name="vm_list_%s" continue="false">`, xmlEscape(list.Extension)))
+		b.WriteString("\n")
+		b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="^%s$">`, xmlEscape(list.Extension)))
+		b.WriteString("\n")
+
+		b.WriteString(`          <action application="set" data="voicemail_action=deposit"/>`)
+		b.WriteString("\n")
+		b.WriteString(fmt.Sprintf(`          <action application="set" data="tenant_id=%d"/>`, tenant.ID))
+		b.WriteString("\n")
+
+		// Route to voicemail ESL socket
+		b.WriteString(`          <action application="socket" data="127.0.0.2:9001 async full"/>`)
+		b.WriteString("\n")
+
+		b.WriteString(`        </condition>`)
+		b.WriteString("\n")
+		b.WriteString(`      </extension>`)
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
 // buildQueueDialplans generates dialplan entries for call center queues
 func (h *FSHandler) buildQueueDialplans(req *XMLCurlRequest) string {
 	domain := req.Context
@@ -876,6 +931,14 @@ func (h *FSHandler) buildOutboundRouteDialplans(req *XMLCurlRequest) string {
 		return ""
 	}
 
+	// The calling tenant, for its outbound block and concurrent call limit
+	domain := req.Context
+	if domain == "default" || domain == "" {
+		domain = req.Domain
+	}
+	var tenant models.Tenant
+	h.DB.Preload("Profile").Where("domain = ?", domain).Limit(1).Find(&tenant)
+
 	// Build a map of gateways by ID
 	var gateways []models.Gateway
 	h.DB.Where("enabled = ?", true).Find(&gateways)
@@ -888,25 +951,43 @@ func (h *FSHandler) buildOutboundRouteDialplans(req *XMLCurlRequest) string {
 	b.WriteString(`      <!-- Outbound Routes -->`)
 	b.WriteString("\n")
 
+	// Concurrent call limits come first and match any route, so a number
+	// matching several routes is still counted once
+	if !tenant.OutboundBlocked {
+		var patterns []string
+		for _, route := range routes {
+			if gatewayMap[route.GatewayID] != nil {
+				patterns = append(patterns, "(?:"+outboundRoutePattern(&route)+")")
+			}
+		}
+		if len(patterns) > 0 {
+			anyRoute := strings.Join(patterns, "|")
+			// The caller's limit (limit_max from the directory)
+			b.WriteString(outboundExtensionLimitXML("routes", anyRoute))
+			if limit := tenant.ConcurrentCallLimit(); tenant.ID != 0 && limit >= 0 {
+				b.WriteString(outboundTenantLimitXML(tenant.ID, limit, anyRoute))
+			}
+		}
+	}
+
 	for _, route := range routes {
 		gw := gatewayMap[route.GatewayID]
 		if gw == nil {
 			continue // No gateway assigned, skip
 		}
+		pattern := outboundRoutePattern(&route)
 
-		// Build regex pattern from route config
-		var pattern string
-		if route.DialString != "" {
-			// Custom dial string pattern
-			pattern = route.DialString
-		} else {
-			// Build from digit prefix/min/max
-			if route.DigitPrefix != "" {
-				digitRange := fmt.Sprintf("{%d,%d}", route.DigitMin-len(route.DigitPrefix), route.DigitMax-len(route.DigitPrefix))
-				pattern = fmt.Sprintf("^%s(\\d%s)$", route.DigitPrefix, digitRange)
-			} else {
-				pattern = fmt.Sprintf("^(\\d{%d,%d})$", route.DigitMin, route.DigitMax)
-			}
+		// A tenant blocked for toll fraud reaches no route at all
+		if tenant.OutboundBlocked {
+			b.WriteString(outboundBlockedXML(route.Name, pattern))
+			continue
+		}
+
+		// Class-of-service guards: callers whose extension profile denies
+		// outbound (or international) dialing are rejected before the route
+		b.WriteString(outboundDenyXML(route.Name, "outbound_allowed", pattern))
+		if route.IsInternational() {
+			b.WriteString(outboundDenyXML(route.Name+"_intl", "international_allowed", pattern))
 		}
 
 		b.WriteString(fmt.Sprintf(`      <extension name="outbound_%s" continue="true">`, xmlEscape(route.Name)))
@@ -931,18 +1012,16 @@ func (h *FSHandler) buildOutboundRouteDialplans(req *XMLCurlRequest) string {
 			dialDest = route.PrependDigits + dialDest
 		}
 
-		bridgeStr := fmt.Sprintf("sofia/gateway/%s/%s", gw.GatewayName, dialDest)
+		routeGateways := []*models.Gateway{gw}
 
 		// Add failover gateway if configured
 		if route.Gateway2ID != nil {
-			gw2 := gatewayMap[*route.Gateway2ID]
-			if gw2 != nil {
-				bridgeStr += fmt.Sprintf("|sofia/gateway/%s/%s", gw2.GatewayName, dialDest)
+			if gw2 := gatewayMap[*route.Gateway2ID]; gw2 != nil {
+				routeGateways = append(routeGateways, gw2)
 			}
 		}
 
-		b.WriteString(fmt.Sprintf(`          <action application="bridge" data="%s"/>`, xmlEscape(bridgeStr)))
-		b.WriteString("\n")
+		b.WriteString(outboundBridgeXML(routeGateways, dialDest))
 
 		b.WriteString(`        </condition>`)
 		b.WriteString("\n")
@@ -953,6 +1032,131 @@ func (h *FSHandler) buildOutboundRouteDialplans(req *XMLCurlRequest) string {
 	return b.String()
 }
 
+// outboundRoutePattern returns the destination_number regex of a route
+func outboundRoutePattern(route *models.DefaultOutboundRoute) string {
+	if route.DialString != "" {
+		// Custom dial string pattern
+		return route.DialString
+	}
+	// Build from digit prefix/min/max
+	if route.DigitPrefix != "" {
+		digitRange := fmt.Sprintf("{%d,%d}", route.DigitMin-len(route.DigitPrefix), route.DigitMax-len(route.DigitPrefix))
+		return fmt.Sprintf("^%s(\\d%s)$", route.DigitPrefix, digitRange)
+	}
+	return fmt.Sprintf("^(\\d{%d,%d})$", route.DigitMin, route.DigitMax)
+}
+
+// outboundBridgeXML bridges to the route's gateways in order. Without
+// channel limits this is one bridge with "|" failover; a gateway with a
+// channel limit gets its own limit_execute bridge, which is skipped while
+// the gateway is full so the call fails over to the next one.
+func outboundBridgeXML(gateways []*models.Gateway, dialDest string) string {
+	limited := false
+	dials := make([]string, len(gateways))
+	for i, gw := range gateways {
+		dials[i] = fmt.Sprintf("sofia/gateway/%s/%s", gw.GatewayName, dialDest)
+		limited = limited || gw.Channels > 0
+	}
+
+	var b strings.Builder
+	if !limited {
+		b.WriteString(fmt.Sprintf(`          <action application="bridge" data="%s"/>`, xmlEscape(strings.Join(dials, "|"))))
+		b.WriteString("\n")
+		return b.String()
+	}
+	for i, gw := range gateways {
+		if gw.Channels > 0 {
+			b.WriteString(fmt.Sprintf(`          <action application="limit_execute" data="hash %s %s %d bridge %s"/>`,
+				models.LimitRealmGateway, xmlEscape(gw.GatewayName), gw.Channels, xmlEscape(dials[i])))
+		} else {
+			b.WriteString(fmt.Sprintf(`          <action application="bridge" data="%s"/>`, xmlEscape(dials[i])))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// outboundExtensionLimitXML generates an extension that counts the caller's
+// outbound calls against the limit_max set on it in the directory; past the
+// limit the call goes to limit_destination. Callers without a positive
+// limit_max (trunks, unlimited extensions) are not counted.
+func outboundExtensionLimitXML(name, pattern string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`      <extension name="outbound_limit_%s" continue="true">`, xmlEscape(name)))
+	b.WriteString("\n")
+	b.WriteString(`        <condition field="${limit_max}" expression="^[1-9][0-9]*$"/>`)
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="%s">`, xmlEscape(pattern)))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`          <action application="limit" data="hash ${domain_name} %s ${limit_max} ${limit_destination}"/>`,
+		models.ExtensionLimitResource("${user_name}")))
+	b.WriteString("\n")
+	b.WriteString(`        </condition>`)
+	b.WriteString("\n")
+	b.WriteString(`      </extension>`)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// outboundTenantLimitXML generates an extension that counts every call
+// matching pattern against the tenant's concurrent call limit, rejecting
+// calls past it
+func outboundTenantLimitXML(tenantID uint, limit int, pattern string) string {
+	var b strings.Builder
+	b.WriteString(`      <extension name="outbound_limit_tenant" continue="true">`)
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="%s">`, xmlEscape(pattern)))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`          <action application="limit" data="hash %s %d %d !NORMAL_CIRCUIT_CONGESTION"/>`,
+		models.LimitRealmTenant, tenantID, limit))
+	b.WriteString("\n")
+	b.WriteString(`        </condition>`)
+	b.WriteString("\n")
+	b.WriteString(`      </extension>`)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// outboundBlockedXML generates an extension that rejects every call
+// matching pattern, for a tenant whose outbound calling is blocked
+func outboundBlockedXML(name, pattern string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`      <extension name="outbound_blocked_%s" continue="false">`, xmlEscape(name)))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="%s">`, xmlEscape(pattern)))
+	b.WriteString("\n")
+	b.WriteString(`          <action application="respond" data="403 Forbidden"/>`)
+	b.WriteString("\n")
+	b.WriteString(`          <action application="hangup" data="OUTGOING_CALL_BARRED"/>`)
+	b.WriteString("\n")
+	b.WriteString(`        </condition>`)
+	b.WriteString("\n")
+	b.WriteString(`      </extension>`)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// outboundDenyXML generates an extension that rejects calls matching pattern
+// when the caller's permission variable (set from the directory) is false
+func outboundDenyXML(name, variable, pattern string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`      <extension name="outbound_deny_%s" continue="false">`, xmlEscape(name)))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`        <condition field="${%s}" expression="^false$"/>`, variable))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="%s">`, xmlEscape(pattern)))
+	b.WriteString("\n")
+	b.WriteString(`          <action application="respond" data="403 Forbidden"/>`)
+	b.WriteString("\n")
+	b.WriteString(`          <action application="hangup" data="OUTGOING_CALL_BARRED"/>`)
+	b.WriteString("\n")
+	b.WriteString(`        </condition>`)
+	b.WriteString("\n")
+	b.WriteString(`      </extension>`)
+	b.WriteString("\n")
+	return b.String()
+}
+
 // buildExtensionDialplans generates per-extension routing that sends calls
 // to the ESL socket for multi-device ringing across all registered endpoints.
 // For each extension in the tenant, this creates a dialplan entry that:
@@ -978,11 +1182,23 @@ func (h *FSHandler) buildExtensionDialplans(req *XMLCurlRequest) string {
 		return ""
 	}
 
+	// Extension profiles may override the ring strategy
+	var profiles []models.ExtensionProfile
+	h.DB.Where("tenant_id = ?", tenant.ID).Find(&profiles)
+	profileMap := make(map[uint]*models.ExtensionProfile, len(profiles))
+	for i := range profiles {
+		profileMap[profiles[i].ID] = &profiles[i]
+	}
 	var b strings.Builder
 	b.WriteString(`      <!-- Extension Routing (multi-device) -->`)
 	b.WriteString("\n")
 
 	for _, ext := range extensions {
+		strategy := ext.RingStrategy
+		if ext.ProfileID != nil {
+			strategy = profileMap[*ext.ProfileID].RingStrategy(strategy)
+		}
+
 		b.WriteString(fmt.Sprintf(`      <extension name="ext_%s" continue="false">`, xmlEscape(ext.Extension)))
 		b.WriteString("\n")
 		b.WriteString(fmt.Sprintf(`        <condition field="destination_number" expression="^%s$">`, xmlEscape(ext.Extension)))
@@ -993,7 +1209,7 @@ func (h *FSHandler) buildExtensionDialplans(req *XMLCurlRequest) string {
 		b.WriteString("\n")
 		b.WriteString(fmt.Sprintf(`          <action application="set" data="dialed_extension=%s"/>`, xmlEscape(ext.Extension)))
 		b.WriteString("\n")
-		b.WriteString(fmt.Sprintf(`          <action application="set" data="ring_strategy=%s"/>`, xmlEscape(ext.RingStrategy)))
+		b.WriteString(fmt.Sprintf(`          <action application="set" data="ring_strategy=%s"/>`, xmlEscape(strategy)))
 		b.WriteString("\n")
 		b.WriteString(fmt.Sprintf(`          <action application="set" data="tenant_id=%d"/>`, tenant.ID))
 		b.WriteString("\n")
@@ -197,6 +197,7 @@ func (h *FSHandler) buildDeviceDirectoryXML(device *models.Device, req *XMLCurlR
 				b.WriteString(fmt.Sprintf(`                <variable name="toll_allow" value="%s"/>`, xmlEscape(ext.TollAllow)))
 				b.WriteString("\n")
 			}
+			h.writePermissionVariables(&b, &ext)
 			if ext.EffectiveCallerIDName != "" {
 				b.WriteString(fmt.Sprintf(`                <variable name="effective_caller_id_name" value="%s"/>`, xmlEscape(ext.EffectiveCallerIDName)))
 				b.WriteString("\n")
@@ -353,6 +354,7 @@ func (h *FSHandler) buildClientDirectoryXML(reg *models.ClientRegistration, req
 				b.WriteString(fmt.Sprintf(`                <variable name="toll_allow" value="%s"/>`, xmlEscape(ext.TollAllow)))
 				b.WriteString("\n")
 			}
+			h.writePermissionVariables(&b, &ext)
 			if ext.EffectiveCallerIDName != "" {
 				b.WriteString(fmt.Sprintf(`                <variable name="effective_caller_id_name" value="%s"/>`, xmlEscape(ext.EffectiveCallerIDName)))
 				b.WriteString("\n")
@@ -521,6 +523,7 @@ func (h *FSHandler) buildDirectoryXML(ext *models.Extension, req *XMLCurlRequest
 		b.WriteString(fmt.Sprintf(`                <variable name="toll_allow" value="%s"/>`, xmlEscape(ext.TollAllow)))
 		b.WriteString("\n")
 	}
+	h.writePermissionVariables(&b, ext)
 
 	// Hold music
 	if ext.HoldMusic != "" {
@@ -636,20 +639,26 @@ func (h *FSHandler) buildDirectoryXML(ext *models.Extension, req *XMLCurlRequest
 		b.WriteString("\n")
 	}
 
-	// Limit (max concurrent calls)
+	// Limit (max concurrent outbound calls, enforced by the outbound routes)
 	b.WriteString(fmt.Sprintf(`                <variable name="limit_max" value="%d"/>`, ext.LimitMax))
 	b.WriteString("\n")
-	if ext.LimitDestination != "" {
-		b.WriteString(fmt.Sprintf(`                <variable name="limit_destination" value="%s"/>`, xmlEscape(ext.LimitDestination)))
-		b.WriteString("\n")
+	limitDestination := ext.LimitDestination
+	if limitDestination == "" {
+		limitDestination = "!USER_BUSY"
 	}
+	b.WriteString(fmt.Sprintf(`                <variable name="limit_destination" value="%s"/>`, xmlEscape(limitDestination)))
+	b.WriteString("\n")
 
 	// Standard export vars
 	b.WriteString(`                <variable name="record_stereo" value="true"/>`)
 	b.WriteString("\n")
 	b.WriteString(`                <variable name="transfer_fallback_extension" value="operator"/>`)
 	b.WriteString("\n")
-	b.WriteString(`                <variable name="export_vars" value="domain_name,domain_uuid"/>`)
+	// tenant_id rides along to the carrier leg so its CDR is billed to the
+	// right tenant
+	b.WriteString(fmt.Sprintf(`                <variable name="tenant_id" value="%d"/>`, ext.TenantID))
+	b.WriteString("\n")
+	b.WriteString(`                <variable name="export_vars" value="domain_name,domain_uuid,tenant_id"/>`)
 	b.WriteString("\n")
 
 	b.WriteString(`              </variables>`)
@@ -862,3 +871,22 @@ func xmlEscape(s string) string {
 	xml.EscapeText(&b, []byte(s))
 	return b.String()
 }
+
+// writePermissionVariables exposes the extension profile's class-of-service
+// permissions as channel variables. The dialplan is cached per context, so
+// per-caller gating is done with conditions on these variables.
+func (h *FSHandler) writePermissionVariables(b *strings.Builder, ext *models.Extension) {
+	perms := models.ExtensionPermissionsFor(h.DB, ext)
+	for _, v := range []struct {
+		name    string
+		allowed bool
+	}{
+		{"outbound_allowed", perms.Outbound},
+		{"international_allowed", perms.International},
+		{"recording_allowed", perms.Recording},
+		{"voicemail_allowed", perms.Voicemail},
+	} {
+		b.WriteString(fmt.Sprintf(`                <variable name="%s" value="%t"/>`, v.name, v.allowed))
+		b.WriteString("\n")
+	}
+}
@@ -2,6 +2,7 @@ package freeswitch
 
 import (
 	"callsign/config"
+	"callsign/services/fraud"
 	"callsign/services/xmlcache"
 	"encoding/base64"
 	"net/http"
@@ -73,6 +74,9 @@ type FSHandler struct {
 	DB     *gorm.DB
 	Config *config.Config
 	Cache  *xmlcache.XMLCache
+
+	// Fraud checks each stored carrier CDR; nil disables them
+	Fraud *fraud.Guard
 }
 
 // NewFSHandler creates a new FreeSWITCH handler
@@ -5,11 +5,18 @@ import (
 	"callsign/middleware"
 	"callsign/models"
 	"callsign/services/broadcast"
+	"callsign/services/callcenter"
 	"callsign/services/cdr"
+	"callsign/services/contactsync"
 	"callsign/services/esl"
+	"callsign/services/fraud"
 	"callsign/services/logging"
 	"callsign/services/messaging"
+	"callsign/services/pms"
 	"callsign/services/email"
+	"callsign/services/retention"
+	"callsign/services/storage"
+	"callsign/services/transcription"
 	"callsign/services/websocket"
 	"callsign/services/xmlcache"
 	"crypto/rand"
@@ -40,6 +47,13 @@ type Handler struct {
 	XMLCache            *xmlcache.XMLCache
 	BroadcastWorker     *broadcast.BroadcastWorker
 	EmailService        *email.Service
+	Transcriber         *transcription.Worker
+	Retention           *retention.Job
+	Storage             *storage.Manager
+	PMSConnector        *pms.Connector
+	CallCenter          *callcenter.Monitor
+	Fraud               *fraud.Guard
+	ContactSync         *contactsync.Syncer
 }
 
 // NewHandler creates a new Handler instance
@@ -86,6 +100,41 @@ func (h *Handler) SetBroadcastWorker(worker *broadcast.BroadcastWorker) {
 	h.BroadcastWorker = worker
 }
 
+// SetPMSConnector sets the hotel PMS connector reference
+func (h *Handler) SetPMSConnector(connector *pms.Connector) {
+	h.PMSConnector = connector
+}
+
+// SetCallCenterMonitor sets the contact-center monitor reference
+func (h *Handler) SetCallCenterMonitor(monitor *callcenter.Monitor) {
+	h.CallCenter = monitor
+}
+
+// SetFraudGuard sets the toll-fraud guard reference
+func (h *Handler) SetFraudGuard(guard *fraud.Guard) {
+	h.Fraud = guard
+}
+
+// SetTranscriptionWorker sets the speech-to-text worker reference
+func (h *Handler) SetTranscriptionWorker(worker *transcription.Worker) {
+	h.Transcriber = worker
+}
+
+// SetRetentionJob sets the recording retention job reference
+func (h *Handler) SetRetentionJob(job *retention.Job) {
+	h.Retention = job
+}
+
+// SetStorage sets the object storage manager reference
+func (h *Handler) SetStorage(m *storage.Manager) {
+	h.Storage = m
+}
+
+// SetContactSyncer sets the contact source sync scheduler reference
+func (h *Handler) SetContactSyncer(syncer *contactsync.Syncer) {
+	h.ContactSync = syncer
+}
+
 // flushXMLCache invalidates the xmlcache so the next mod_xml_curl request
 // from FreeSWITCH fetches fresh data from the database. Since all config
 // (directory, dialplan, configuration, ACLs) is served dynamically via
@@ -559,6 +608,12 @@ func (h *Handler) ExtensionLogin(c *fiber.Ctx) error {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
+	// Extension profiles can revoke portal access
+	if !models.ExtensionPermissionsFor(h.DB, &ext).Portal {
+		h.logWarn("AUTH", "ExtensionLogin: Portal access disabled by extension profile", h.reqFields(c, nil))
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Portal access is disabled for this extension"})
+	}
+
 	// Generate JWT with extension context
 	token, err := h.Auth.GenerateExtensionToken(&ext)
 	if err != nil {
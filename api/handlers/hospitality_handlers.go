@@ -3,6 +3,8 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"callsign/services/hospitality"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -65,7 +67,9 @@ func (h *Handler) GetRoom(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": room})
 }
 
-// UpdateRoom updates a hotel room
+// UpdateRoom updates a hotel room. Only the room's own fields are editable;
+// the wake-up scheduler's claim and attempt columns are left to the scheduler,
+// which may claim the room while this request is in flight.
 func (h *Handler) UpdateRoom(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	id := c.Params("id")
@@ -76,14 +80,96 @@ func (h *Handler) UpdateRoom(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
 	}
 
-	if err := c.BodyParser(&room); err != nil {
+	var req struct {
+		RoomNumber    *string    `json:"room_number"`
+		RoomType      *string    `json:"room_type"`
+		Extension     *string    `json:"extension"`
+		ExtensionID   *uint      `json:"extension_id"`
+		Floor         *string    `json:"floor"`
+		Status        *string    `json:"status"`
+		GuestName     *string    `json:"guest_name"`
+		WakeupTime    *time.Time `json:"wakeup_time"`
+		WakeupEnabled *bool      `json:"wakeup_enabled"`
+		DNDEnabled    *bool      `json:"dnd_enabled"`
+		CIDName       *string    `json:"cid_name"`
+		CIDNumber     *string    `json:"cid_number"`
+		Notes         *string    `json:"notes"`
+		Enabled       *bool      `json:"enabled"`
+	}
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	room.TenantID = tenantID
-	h.DB.Save(&room)
+	updates := map[string]interface{}{}
+	if req.RoomNumber != nil {
+		updates["room_number"] = *req.RoomNumber
+	}
+	if req.RoomType != nil {
+		updates["room_type"] = *req.RoomType
+	}
+	if req.Extension != nil {
+		updates["extension"] = *req.Extension
+	}
+	if req.ExtensionID != nil {
+		updates["extension_id"] = *req.ExtensionID
+	}
+	if req.Floor != nil {
+		updates["floor"] = *req.Floor
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+	if req.GuestName != nil {
+		updates["guest_name"] = *req.GuestName
+	}
+	if req.DNDEnabled != nil {
+		updates["dnd_enabled"] = *req.DNDEnabled
+	}
+	if req.CIDName != nil {
+		updates["cid_name"] = *req.CIDName
+	}
+	if req.CIDNumber != nil {
+		updates["cid_number"] = *req.CIDNumber
+	}
+	if req.Notes != nil {
+		updates["notes"] = *req.Notes
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
 
-	return c.JSON(fiber.Map{"data": room, "message": "Room updated"})
+	// Editing the wake-up fields reschedules the call from scratch
+	wakeupEnabled, wakeupTime := room.WakeupEnabled, room.WakeupTime
+	if req.WakeupEnabled != nil {
+		wakeupEnabled = *req.WakeupEnabled
+	}
+	if req.WakeupTime != nil {
+		wakeupTime = req.WakeupTime
+	}
+	if wakeupEnabled != room.WakeupEnabled || !sameTime(wakeupTime, room.WakeupTime) {
+		if wakeupEnabled {
+			room.SetWakeup(wakeupTime)
+		} else {
+			room.SetWakeup(nil)
+		}
+		updates["wakeup_enabled"] = room.WakeupEnabled
+		updates["wakeup_time"] = room.WakeupTime
+		updates["wakeup_next_attempt_at"] = room.WakeupNextAttemptAt
+		updates["wakeup_claimed_at"] = nil
+		updates["wakeup_attempts"] = 0
+		updates["wakeup_audio"] = room.WakeupAudio
+	}
+
+	if len(updates) > 0 {
+		if err := h.DB.Model(&models.HotelRoom{}).Where("id = ?", room.ID).Updates(updates).Error; err != nil {
+			h.logError("HOSPITALITY", "UpdateRoom: Failed to update room", h.reqFields(c, nil))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update room"})
+		}
+	}
+	var updated models.HotelRoom
+	h.DB.First(&updated, room.ID)
+
+	return c.JSON(fiber.Map{"data": updated, "message": "Room updated"})
 }
 
 // DeleteRoom deletes a hotel room
@@ -100,6 +186,11 @@ func (h *Handler) DeleteRoom(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Room deleted"})
 }
 
+// stays returns the service that applies check-ins and check-outs to rooms
+func (h *Handler) stays() *hospitality.StayService {
+	return hospitality.NewStayService(h.DB, h.Storage, h.ESLManager, h.XMLCache)
+}
+
 // CheckInGuest checks a guest into a room
 func (h *Handler) CheckInGuest(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
@@ -120,23 +211,17 @@ func (h *Handler) CheckInGuest(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	now := time.Now()
-	room.Status = "occupied"
-	room.GuestName = req.GuestName
-	room.CheckInTime = &now
-	room.CheckOutTime = nil
-	room.CIDName = req.CIDName
-	room.CIDNumber = req.CIDNumber
-	room.DNDEnabled = false
-	room.WakeupEnabled = false
-	room.WakeupTime = nil
-
-	h.DB.Save(&room)
+	guest := hospitality.Guest{Name: req.GuestName, CIDName: req.CIDName, CIDNumber: req.CIDNumber}
+	if err := h.stays().CheckIn(&room, guest, hospitality.DefaultStayOptions); err != nil {
+		h.logError("HOSPITALITY", "CheckInGuest: Failed to check in guest", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check in guest"})
+	}
 
 	return c.JSON(fiber.Map{"data": room, "message": "Guest checked in"})
 }
 
-// CheckOutGuest checks a guest out of a room
+// CheckOutGuest checks a guest out of a room, restoring the extension's caller
+// ID name and purging the guest's voicemail
 func (h *Handler) CheckOutGuest(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	id := c.Params("id")
@@ -147,22 +232,18 @@ func (h *Handler) CheckOutGuest(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
 	}
 
-	now := time.Now()
-	room.Status = "vacant"
-	room.GuestName = ""
-	room.CheckOutTime = &now
-	room.CIDName = ""
-	room.CIDNumber = ""
-	room.DNDEnabled = false
-	room.WakeupEnabled = false
-	room.WakeupTime = nil
-
-	h.DB.Save(&room)
+	if err := h.stays().CheckOut(&room, hospitality.DefaultStayOptions); err != nil {
+		h.logError("HOSPITALITY", "CheckOutGuest: Failed to check out guest", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check out guest"})
+	}
 
 	return c.JSON(fiber.Map{"data": room, "message": "Guest checked out"})
 }
 
-// ScheduleWakeupCall sets or clears a wakeup call for a room
+// ScheduleWakeupCall sets or clears a wakeup call for a room. The time is
+// either an absolute wakeup_time or a wall-clock time (HH:MM, with an optional
+// YYYY-MM-DD date) in the tenant's timezone. The wake-up scheduler dials the
+// room when it falls due.
 func (h *Handler) ScheduleWakeupCall(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	id := c.Params("id")
@@ -174,17 +255,228 @@ func (h *Handler) ScheduleWakeupCall(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Enabled    bool       `json:"enabled"`
-		WakeupTime *time.Time `json:"wakeup_time"`
+		Enabled     bool       `json:"enabled"`
+		WakeupTime  *time.Time `json:"wakeup_time"`
+		Time        string     `json:"time"` // HH:MM in the tenant's timezone
+		Date        string     `json:"date"` // YYYY-MM-DD, defaults to the next occurrence
+		RecordingID *uint      `json:"recording_id,omitempty"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	room.WakeupEnabled = req.Enabled
-	room.WakeupTime = req.WakeupTime
-
-	h.DB.Save(&room)
+	if err := h.setRoomWakeup(&room, req.Enabled, req.WakeupTime, req.Time, req.Date, req.RecordingID); err != nil {
+		h.logWarn("HOSPITALITY", "ScheduleWakeupCall: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return c.JSON(fiber.Map{"data": room, "message": "Wakeup call updated"})
 }
+
+// setRoomWakeup validates and stores a room's wake-up call and logs the change
+// to the room history
+func (h *Handler) setRoomWakeup(room *models.HotelRoom, enabled bool, at *time.Time, clock, date string, recordingID *uint) error {
+	if !enabled {
+		wasEnabled := room.WakeupEnabled
+		room.SetWakeup(nil)
+		if err := h.DB.Save(room).Error; err != nil {
+			return err
+		}
+		if wasEnabled {
+			models.LogRoomEvent(h.DB, room, models.HotelRoomEvent{Event: models.RoomEventWakeupCancelled})
+		}
+		return nil
+	}
+
+	var tenant models.Tenant
+	h.DB.First(&tenant, room.TenantID)
+	loc := tenant.Location()
+
+	if clock != "" {
+		t, err := hospitality.ResolveWakeupTime(clock, date, loc, time.Now())
+		if err != nil {
+			return err
+		}
+		at = &t
+	}
+	if at == nil {
+		return fmt.Errorf("wakeup_time or time is required")
+	}
+	if !at.After(time.Now()) {
+		return fmt.Errorf("wake-up time must be in the future")
+	}
+	if room.Extension == "" {
+		return fmt.Errorf("room has no extension")
+	}
+
+	room.SetWakeup(at)
+	room.WakeupAudio = ""
+	if recordingID != nil {
+		var rec models.Recording
+		if err := h.DB.Where("id = ? AND tenant_id = ?", *recordingID, room.TenantID).First(&rec).Error; err != nil {
+			return fmt.Errorf("recording not found")
+		}
+		if !models.ValidWakeupAudio(rec.FilePath) {
+			return fmt.Errorf("recording path can't be used as a wake-up message")
+		}
+		room.WakeupAudio = rec.FilePath
+	}
+	if err := h.DB.Save(room).Error; err != nil {
+		return err
+	}
+	models.LogRoomEvent(h.DB, room, models.HotelRoomEvent{
+		Event:  models.RoomEventWakeupScheduled,
+		Detail: at.In(loc).Format("2006-01-02 15:04 MST"),
+	})
+	return nil
+}
+
+// GetRoomHistory returns a room's stays and wake-up call attempts, newest first
+func (h *Handler) GetRoomHistory(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	id := c.Params("id")
+
+	var room models.HotelRoom
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&room).Error; err != nil {
+		h.logWarn("HOSPITALITY", "GetRoomHistory: Room not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var events []models.HotelRoomEvent
+	query := h.DB.Where("room_id = ? AND tenant_id = ?", room.ID, tenantID)
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	query.Order("created_at DESC, id DESC").Limit(limit).Find(&events)
+
+	return c.JSON(fiber.Map{"data": events})
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// GetPMSInterface returns the tenant's PMS link configuration and status
+func (h *Handler) GetPMSInterface(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var iface models.PMSInterface
+	if err := h.DB.Where("tenant_id = ?", tenantID).First(&iface).Error; err != nil {
+		return c.JSON(fiber.Map{"data": models.PMSInterface{
+			TenantID:            tenantID,
+			Protocol:            "fias",
+			PostCharges:         true,
+			PurgeVoicemail:      true,
+			UpdateCallerID:      true,
+			ReportWakeupResults: true,
+			LinkStatus:          models.PMSLinkDisabled,
+		}})
+	}
+
+	return c.JSON(fiber.Map{"data": iface})
+}
+
+// UpdatePMSInterface creates or updates the tenant's PMS link and restarts it
+func (h *Handler) UpdatePMSInterface(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var req struct {
+		Enabled             bool   `json:"enabled"`
+		Protocol            string `json:"protocol"`
+		Host                string `json:"host"`
+		Port                int    `json:"port"`
+		PostCharges         bool   `json:"post_charges"`
+		PostFreeCalls       bool   `json:"post_free_calls"`
+		PurgeVoicemail      bool   `json:"purge_voicemail"`
+		UpdateCallerID      bool   `json:"update_caller_id"`
+		ReportWakeupResults bool   `json:"report_wakeup_results"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		h.logWarn("HOSPITALITY", "UpdatePMSInterface: Invalid request body", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Protocol == "" {
+		req.Protocol = "fias"
+	}
+	if req.Protocol != "fias" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported PMS protocol (supported: fias)"})
+	}
+	if req.Enabled && (req.Host == "" || req.Port <= 0 || req.Port > 65535) {
+		h.logWarn("HOSPITALITY", "UpdatePMSInterface: Host and port required", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "PMS host and port are required"})
+	}
+
+	var iface models.PMSInterface
+	if err := h.DB.Where(models.PMSInterface{TenantID: tenantID}).FirstOrCreate(&iface).Error; err != nil {
+		h.logError("HOSPITALITY", "UpdatePMSInterface: Failed to load PMS interface", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save PMS interface"})
+	}
+
+	iface.Enabled = req.Enabled
+	iface.Protocol = req.Protocol
+	iface.Host = req.Host
+	iface.Port = req.Port
+	iface.PostCharges = req.PostCharges
+	iface.PostFreeCalls = req.PostFreeCalls
+	iface.PurgeVoicemail = req.PurgeVoicemail
+	iface.UpdateCallerID = req.UpdateCallerID
+	iface.ReportWakeupResults = req.ReportWakeupResults
+	if err := h.DB.Save(&iface).Error; err != nil {
+		h.logError("HOSPITALITY", "UpdatePMSInterface: Failed to save PMS interface", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save PMS interface"})
+	}
+
+	if h.PMSConnector != nil {
+		h.PMSConnector.Reload(tenantID)
+	}
+
+	return c.JSON(fiber.Map{"data": iface, "message": "PMS interface updated"})
+}
+
+// ResyncPMS asks the PMS to resend the occupancy of every room
+func (h *Handler) ResyncPMS(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	if h.PMSConnector == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "PMS connector not running"})
+	}
+	if err := h.PMSConnector.Resync(tenantID); err != nil {
+		h.logWarn("HOSPITALITY", "ResyncPMS: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Database resync requested"})
+}
+
+// ListPMSPostings returns call charges posted to guest folios
+func (h *Handler) ListPMSPostings(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	query := h.DB.Model(&models.PMSPosting{}).Where("tenant_id = ?", tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if room := c.Query("room"); room != "" {
+		query = query.Where("room_number = ?", room)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var postings []models.PMSPosting
+	query.Order("id DESC").Limit(limit).Offset(c.QueryInt("offset", 0)).Find(&postings)
+
+	return c.JSON(fiber.Map{"data": postings, "total": total})
+}
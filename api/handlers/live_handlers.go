@@ -5,6 +5,7 @@ import (
 	"callsign/models"
 	"fmt"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 	"time"
@@ -33,6 +34,15 @@ func (h *Handler) StartCallRecording(c *fiber.Ctx) error {
 		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "FreeSWITCH not connected"})
 	}
 
+	// Refuse new recordings while the tenant is over its storage quota
+	// (tenants with a rotate policy have old recordings purged instead)
+	if h.Retention != nil {
+		if err := h.Retention.CheckQuota(tenantID); err != nil {
+			h.logWarn("LIVE", "StartCallRecording: "+err.Error(), h.reqFields(c, nil))
+			return c.Status(http.StatusInsufficientStorage).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	// Generate recording path
 	timestamp := time.Now().Format("20060102-150405")
 	filename := fmt.Sprintf("call_%s_%s.wav", req.UUID[:8], timestamp)
@@ -47,11 +57,14 @@ func (h *Handler) StartCallRecording(c *fiber.Ctx) error {
 
 	// Save recording record to DB
 	recording := &models.CallRecording{
-		TenantID:  tenantID,
-		CallUUID:  req.UUID,
-		FilePath:  recordPath,
-		StartTime: time.Now(),
-		Notes:     "live-recording-in-progress",
+		TenantID:    tenantID,
+		CallUUID:    req.UUID,
+		FileName:    filename,
+		FilePath:    recordPath,
+		FileFormat:  "wav",
+		StorageType: "local",
+		StartTime:   time.Now(),
+		Notes:       "live-recording-in-progress",
 	}
 	h.DB.Create(recording)
 
@@ -84,14 +97,22 @@ func (h *Handler) StopCallRecording(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to stop recording: " + err.Error()})
 	}
 
-	// Update recording record in DB
+	// Update recording record in DB with the final duration and file size
 	now := time.Now()
-	h.DB.Model(&models.CallRecording{}).
-		Where("call_uuid = ? AND notes = ?", req.UUID, "live-recording-in-progress").
-		Updates(map[string]interface{}{
+	var recordings []models.CallRecording
+	h.DB.Where("call_uuid = ? AND notes = ?", req.UUID, "live-recording-in-progress").Find(&recordings)
+	for _, rec := range recordings {
+		updates := map[string]interface{}{
 			"notes":    "completed",
 			"end_time": now,
-		})
+			"duration": int(now.Sub(rec.StartTime).Seconds()),
+		}
+		if info, err := os.Stat(rec.FilePath); err == nil {
+			updates["file_size"] = info.Size()
+		}
+		h.DB.Model(&rec).Updates(updates)
+		h.Storage.StoreAsync(models.StorageCategoryRecording, rec.TenantID, rec.FilePath, "")
+	}
 
 	return c.JSON(fiber.Map{"message": "Recording stopped"})
 }
@@ -168,7 +189,9 @@ type WakeupCallSchedule struct {
 	RecordingID   *uint  `json:"recording_id,omitempty"`
 }
 
-// ScheduleWakeupESL schedules a wake-up call via FreeSWITCH sched_api
+// ScheduleWakeupESL schedules a wake-up call for the hotel room with the given
+// extension. The call is stored on the room and dialed by the wake-up
+// scheduler, so it survives FreeSWITCH and API restarts.
 func (h *Handler) ScheduleWakeupESL(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 
@@ -178,51 +201,22 @@ func (h *Handler) ScheduleWakeupESL(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
-	if h.ESLManager == nil || !h.ESLManager.IsConnected() {
-		h.logWarn("LIVE", "ScheduleWakeupESL: FreeSWITCH not connected", h.reqFields(c, nil))
-		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "FreeSWITCH not connected"})
-	}
-
-	// Parse the target time
-	targetTime, err := time.Parse("2006-01-02 15:04", req.Date+" "+req.Time)
-	if err != nil {
-		h.logWarn("LIVE", "ScheduleWakeupESL: Invalid date/time format", h.reqFields(c, nil))
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date/time format"})
+	var room models.HotelRoom
+	if err := h.DB.Where("tenant_id = ? AND extension = ?", tenantID, req.RoomExtension).First(&room).Error; err != nil {
+		h.logWarn("LIVE", "ScheduleWakeupESL: No room for extension", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No hotel room uses this extension"})
 	}
 
-	// Calculate seconds from now
-	delay := int(time.Until(targetTime).Seconds())
-	if delay <= 0 {
-		h.logWarn("LIVE", "ScheduleWakeupESL: Scheduled time must be in the future", h.reqFields(c, nil))
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Scheduled time must be in the future"})
-	}
-
-	// Get a recording path for the wakeup message
-	audioPath := "voicemail/vm-wakeup_call.wav" // Default
-	if req.RecordingID != nil {
-		var rec models.Recording
-		if err := h.DB.Where("id = ? AND tenant_id = ?", *req.RecordingID, tenantID).First(&rec).Error; err == nil {
-			audioPath = rec.FilePath
-		}
-	}
-
-	// Schedule via FreeSWITCH sched_api
-	// This creates a scheduled originate that calls the room extension and plays the recording
-	groupCall := fmt.Sprintf("originate {ignore_early_media=true}user/%s &playback(%s)", req.RoomExtension, audioPath)
-	schedID := fmt.Sprintf("wakeup_%d_%s", tenantID, req.RoomExtension)
-	cmd := fmt.Sprintf("sched_api +%d %s %s", delay, schedID, groupCall)
-
-	_, err = h.ESLManager.Client.API(cmd)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to schedule wake-up call: " + err.Error()})
+	if err := h.setRoomWakeup(&room, true, nil, req.Time, req.Date, req.RecordingID); err != nil {
+		h.logWarn("LIVE", "ScheduleWakeupESL: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{
-		"message":    "Wake-up call scheduled",
-		"sched_id":   schedID,
-		"target":     req.RoomExtension,
-		"scheduled":  targetTime,
-		"delay_secs": delay,
+		"message":   "Wake-up call scheduled",
+		"room_id":   room.ID,
+		"target":    req.RoomExtension,
+		"scheduled": room.WakeupTime,
 	})
 }
 
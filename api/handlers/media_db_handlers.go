@@ -3,6 +3,7 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -220,6 +221,8 @@ func (h *Handler) UploadMediaFile(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create database record"})
 	}
 
+	h.Storage.StoreAsync(models.StorageCategoryMedia, tenantID, dstPath, mediaFile.MimeType)
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "File uploaded successfully", "data": mediaFile})
 }
 
@@ -298,7 +301,7 @@ func (h *Handler) DeleteMediaFile(c *fiber.Ctx) error {
 	}
 
 	// Try removing file, but don't fail hard if missing (could be manually deleted)
-	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+	if err := h.Storage.Delete(context.Background(), fullPath); err != nil && !os.IsNotExist(err) {
 		// Log warning?
 		fmt.Printf("Warning: Failed to delete file %s: %v\n", fullPath, err)
 	}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"callsign/middleware"
+	"callsign/models"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -230,6 +232,9 @@ func (h *Handler) UploadSystemSound(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save file"})
 	}
 
+	// Mirror to object storage (media stays local for FreeSWITCH playback)
+	h.Storage.StoreAsync(models.StorageCategoryMedia, 0, dstPath, "")
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "File uploaded successfully", "path": filepath.Join(targetPath, finalFilename), "filename": finalFilename})
 }
 
@@ -294,6 +299,9 @@ func (h *Handler) UploadSystemMusic(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save file"})
 	}
 
+	// Mirror to object storage (media stays local for FreeSWITCH playback)
+	h.Storage.StoreAsync(models.StorageCategoryMedia, 0, dstPath, "")
+
 	resultPath := filepath.Join(rate, finalFilename)
 	if folder != "" {
 		resultPath = filepath.Join(rate, folder, finalFilename)
@@ -444,6 +452,9 @@ func (h *Handler) UploadTenantSound(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save file"})
 	}
 
+	// Mirror to object storage (media stays local for FreeSWITCH playback)
+	h.Storage.StoreAsync(models.StorageCategoryMedia, tenantID, dstPath, "")
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "File uploaded successfully", "path": filepath.Join(targetPath, finalFilename), "filename": finalFilename, "is_override": true})
 }
 
@@ -478,6 +489,7 @@ func (h *Handler) DeleteTenantSound(c *fiber.Ctx) error {
 		h.logError("MEDIA", "DeleteTenantSound: Failed to delete file", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete file"})
 	}
+	h.Storage.Delete(context.Background(), fullPath)
 
 	return c.JSON(fiber.Map{"message": "File deleted, revert to system sound if applicable"})
 }
@@ -585,6 +597,9 @@ func (h *Handler) UploadTenantMusic(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save file"})
 	}
 
+	// Mirror to object storage (media stays local for FreeSWITCH playback)
+	h.Storage.StoreAsync(models.StorageCategoryMedia, tenantID, dstPath, "")
+
 	resultPath := filepath.Join(rate, finalFilename)
 	if folder != "" {
 		resultPath = filepath.Join(rate, folder, finalFilename)
@@ -624,6 +639,7 @@ func (h *Handler) DeleteTenantMusic(c *fiber.Ctx) error {
 		h.logError("MEDIA", "DeleteTenantMusic: Failed to delete file", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete file"})
 	}
+	h.Storage.Delete(context.Background(), fullPath)
 
 	return c.JSON(fiber.Map{"message": "File deleted"})
 }
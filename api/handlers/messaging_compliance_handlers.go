@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Messaging Brands
+// =====================
+
+// ListMessagingBrands lists the tenant's registered brands
+func (h *Handler) ListMessagingBrands(c *fiber.Ctx) error {
+	var brands []models.MessagingBrand
+	h.DB.Where("tenant_id = ?", middleware.GetTenantID(c)).Order("name").Find(&brands)
+	return c.JSON(brands)
+}
+
+// CreateMessagingBrand records a brand
+func (h *Handler) CreateMessagingBrand(c *fiber.Ctx) error {
+	var brand models.MessagingBrand
+	if err := c.BodyParser(&brand); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	brand.ID = 0
+	brand.TenantID = middleware.GetTenantID(c)
+	if brand.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	if err := h.DB.Create(&brand).Error; err != nil {
+		h.logError("MESSAGING", "CreateMessagingBrand: Failed to create brand", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create brand"})
+	}
+
+	h.logInfo("MESSAGING", "CreateMessagingBrand: Brand created", h.reqFields(c, map[string]interface{}{"brand_id": brand.ID}))
+	return c.Status(http.StatusCreated).JSON(brand)
+}
+
+// GetMessagingBrand returns a brand
+func (h *Handler) GetMessagingBrand(c *fiber.Ctx) error {
+	brand, ok := h.messagingBrand(c, "GetMessagingBrand")
+	if !ok {
+		return nil
+	}
+	return c.JSON(brand)
+}
+
+// UpdateMessagingBrand updates a brand
+func (h *Handler) UpdateMessagingBrand(c *fiber.Ctx) error {
+	brand, ok := h.messagingBrand(c, "UpdateMessagingBrand")
+	if !ok {
+		return nil
+	}
+
+	updated := *brand
+	if err := c.BodyParser(&updated); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	updated.ID, updated.UUID, updated.TenantID = brand.ID, brand.UUID, brand.TenantID
+	if updated.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	if err := h.DB.Model(brand).Select("name", "display_name", "entity_type", "tax_id", "country", "website",
+		"vertical", "email", "phone", "registry_id", "status", "status_reason").Updates(&updated).Error; err != nil {
+		h.logError("MESSAGING", "UpdateMessagingBrand: Failed to update brand", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update brand"})
+	}
+
+	h.logInfo("MESSAGING", "UpdateMessagingBrand: Brand updated", h.reqFields(c, map[string]interface{}{"brand_id": brand.ID}))
+	return c.JSON(updated)
+}
+
+// DeleteMessagingBrand deletes a brand that has no campaigns
+func (h *Handler) DeleteMessagingBrand(c *fiber.Ctx) error {
+	brand, ok := h.messagingBrand(c, "DeleteMessagingBrand")
+	if !ok {
+		return nil
+	}
+
+	var campaigns int64
+	h.DB.Model(&models.MessagingCampaign{}).Where("brand_id = ?", brand.ID).Count(&campaigns)
+	if campaigns > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Brand still has campaigns"})
+	}
+	if err := h.DB.Delete(brand).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete brand"})
+	}
+
+	h.logInfo("MESSAGING", "DeleteMessagingBrand: Brand deleted", h.reqFields(c, map[string]interface{}{"brand_id": brand.ID}))
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// messagingBrand loads the :id brand of the tenant, writing a 404 when missing
+func (h *Handler) messagingBrand(c *fiber.Ctx, fn string) (*models.MessagingBrand, bool) {
+	var brand models.MessagingBrand
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&brand).Error; err != nil {
+		h.logWarn("MESSAGING", fn+": Brand not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Brand not found"})
+		return nil, false
+	}
+	return &brand, true
+}
+
+// =====================
+// Messaging Campaigns
+// =====================
+
+// ListMessagingCampaigns lists the tenant's campaigns with their brand and numbers
+func (h *Handler) ListMessagingCampaigns(c *fiber.Ctx) error {
+	var campaigns []models.MessagingCampaign
+	h.DB.Preload("Brand").Preload("Numbers").Where("tenant_id = ?", middleware.GetTenantID(c)).
+		Order("name").Find(&campaigns)
+	return c.JSON(campaigns)
+}
+
+// CreateMessagingCampaign records a campaign of one of the tenant's brands
+func (h *Handler) CreateMessagingCampaign(c *fiber.Ctx) error {
+	var campaign models.MessagingCampaign
+	if err := c.BodyParser(&campaign); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	campaign.ID = 0
+	campaign.TenantID = middleware.GetTenantID(c)
+	campaign.Brand, campaign.Numbers = nil, nil
+	if msg := h.validateMessagingCampaign(&campaign); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.DB.Create(&campaign).Error; err != nil {
+		h.logError("MESSAGING", "CreateMessagingCampaign: Failed to create campaign", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create campaign"})
+	}
+
+	h.logInfo("MESSAGING", "CreateMessagingCampaign: Campaign created", h.reqFields(c, map[string]interface{}{"campaign_id": campaign.ID}))
+	return c.Status(http.StatusCreated).JSON(campaign)
+}
+
+// GetMessagingCampaign returns a campaign with its brand and numbers
+func (h *Handler) GetMessagingCampaign(c *fiber.Ctx) error {
+	campaign, ok := h.messagingCampaign(c, "GetMessagingCampaign")
+	if !ok {
+		return nil
+	}
+	h.DB.Preload("Brand").Preload("Numbers").First(campaign, campaign.ID)
+	return c.JSON(campaign)
+}
+
+// UpdateMessagingCampaign updates a campaign
+func (h *Handler) UpdateMessagingCampaign(c *fiber.Ctx) error {
+	campaign, ok := h.messagingCampaign(c, "UpdateMessagingCampaign")
+	if !ok {
+		return nil
+	}
+
+	updated := *campaign
+	if err := c.BodyParser(&updated); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	updated.ID, updated.UUID, updated.TenantID = campaign.ID, campaign.UUID, campaign.TenantID
+	updated.Brand, updated.Numbers = nil, nil
+	if msg := h.validateMessagingCampaign(&updated); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.DB.Model(campaign).Select("brand_id", "name", "type", "use_case", "description", "opt_in_description",
+		"sample_messages", "help_message", "opt_out_message", "opt_in_message", "rate_limit_per_second",
+		"rate_limit_per_minute", "registry_id", "status", "status_reason").Updates(&updated).Error; err != nil {
+		h.logError("MESSAGING", "UpdateMessagingCampaign: Failed to update campaign", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update campaign"})
+	}
+
+	h.logInfo("MESSAGING", "UpdateMessagingCampaign: Campaign updated", h.reqFields(c, map[string]interface{}{"campaign_id": campaign.ID}))
+	return c.JSON(updated)
+}
+
+// DeleteMessagingCampaign deletes a campaign, detaching its numbers
+func (h *Handler) DeleteMessagingCampaign(c *fiber.Ctx) error {
+	campaign, ok := h.messagingCampaign(c, "DeleteMessagingCampaign")
+	if !ok {
+		return nil
+	}
+
+	h.DB.Model(&models.MessagingNumber{}).Where("campaign_id = ?", campaign.ID).Update("campaign_id", nil)
+	if err := h.DB.Delete(campaign).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete campaign"})
+	}
+
+	h.logInfo("MESSAGING", "DeleteMessagingCampaign: Campaign deleted", h.reqFields(c, map[string]interface{}{"campaign_id": campaign.ID}))
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// SetMessagingCampaignNumbers sets which of the tenant's messaging numbers
+// send under a campaign; numbers left out are detached from it
+func (h *Handler) SetMessagingCampaignNumbers(c *fiber.Ctx) error {
+	campaign, ok := h.messagingCampaign(c, "SetMessagingCampaignNumbers")
+	if !ok {
+		return nil
+	}
+
+	var input struct {
+		NumberIDs []uint `json:"number_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(input.NumberIDs) > 0 {
+		var owned int64
+		h.DB.Model(&models.MessagingNumber{}).Where("id IN ? AND tenant_id = ?", input.NumberIDs, campaign.TenantID).Count(&owned)
+		if int(owned) != len(input.NumberIDs) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Messaging number not found"})
+		}
+	}
+
+	detach := h.DB.Model(&models.MessagingNumber{}).Where("campaign_id = ?", campaign.ID)
+	if len(input.NumberIDs) > 0 {
+		detach = detach.Where("id NOT IN ?", input.NumberIDs)
+	}
+	detach.Update("campaign_id", nil)
+	if len(input.NumberIDs) > 0 {
+		if err := h.DB.Model(&models.MessagingNumber{}).Where("id IN ?", input.NumberIDs).
+			Update("campaign_id", campaign.ID).Error; err != nil {
+			h.logError("MESSAGING", "SetMessagingCampaignNumbers: Failed to attach numbers", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to attach numbers"})
+		}
+	}
+
+	h.logInfo("MESSAGING", "SetMessagingCampaignNumbers: Numbers set", h.reqFields(c, map[string]interface{}{"campaign_id": campaign.ID, "numbers": len(input.NumberIDs)}))
+	h.DB.Preload("Brand").Preload("Numbers").First(campaign, campaign.ID)
+	return c.JSON(campaign)
+}
+
+// messagingCampaign loads the :id campaign of the tenant, writing a 404 when missing
+func (h *Handler) messagingCampaign(c *fiber.Ctx, fn string) (*models.MessagingCampaign, bool) {
+	var campaign models.MessagingCampaign
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&campaign).Error; err != nil {
+		h.logWarn("MESSAGING", fn+": Campaign not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Campaign not found"})
+		return nil, false
+	}
+	return &campaign, true
+}
+
+// validateMessagingCampaign checks a campaign and fills in defaults. It
+// returns a message describing the first problem found.
+func (h *Handler) validateMessagingCampaign(campaign *models.MessagingCampaign) string {
+	if campaign.Name == "" {
+		return "Name is required"
+	}
+	var brands int64
+	h.DB.Model(&models.MessagingBrand{}).Where("id = ? AND tenant_id = ?", campaign.BrandID, campaign.TenantID).Count(&brands)
+	if brands == 0 {
+		return "Brand not found"
+	}
+	switch campaign.Type {
+	case "":
+		campaign.Type = models.CampaignType10DLC
+	case models.CampaignType10DLC, models.CampaignTypeTollFree, models.CampaignTypeShortCode:
+	default:
+		return "Type must be 10dlc, toll_free or short_code"
+	}
+	if campaign.RateLimitPerSecond < 0 || campaign.RateLimitPerMinute < 0 {
+		return "Rate limits cannot be negative"
+	}
+	return ""
+}
+
+// =====================
+// Consent Ledger
+// =====================
+
+// ListMessagingConsent returns consent ledger entries, newest first,
+// optionally for one number, recipient or status
+func (h *Handler) ListMessagingConsent(c *fiber.Ctx) error {
+	query := h.DB.Where("tenant_id = ?", middleware.GetTenantID(c))
+	if number := c.Query("number"); number != "" {
+		query = query.Where("number = ?", number)
+	}
+	if recipient := c.Query("recipient"); recipient != "" {
+		query = query.Where("recipient = ?", recipient)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	var entries []models.MessagingConsent
+	query.Order("id DESC").Limit(limit).Find(&entries)
+	return c.JSON(entries)
+}
+
+// ListMessagingOptOuts returns the recipients currently opted out, as
+// their latest ledger entries, optionally for one number
+func (h *Handler) ListMessagingOptOuts(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	latest := h.DB.Model(&models.MessagingConsent{}).Select("MAX(id)").Where("tenant_id = ?", tenantID)
+	if number := c.Query("number"); number != "" {
+		latest = latest.Where("number = ?", number)
+	}
+
+	var entries []models.MessagingConsent
+	h.DB.Where("id IN (?) AND status = ?", latest.Group("number, recipient"), models.ConsentOptOut).
+		Order("id DESC").Find(&entries)
+	return c.JSON(entries)
+}
+
+// RecordMessagingConsent records an opt-in or opt-out for a recipient of
+// one of the tenant's numbers, e.g. consent given on a web form
+func (h *Handler) RecordMessagingConsent(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	var input struct {
+		Number    string `json:"number"`
+		Recipient string `json:"recipient"`
+		Status    string `json:"status"`
+		Note      string `json:"note"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Number == "" || input.Recipient == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Number and recipient are required"})
+	}
+	if input.Status != models.ConsentOptIn && input.Status != models.ConsentOptOut {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Status must be opt_in or opt_out"})
+	}
+	if h.MsgManager == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Messaging not configured"})
+	}
+
+	var owned int64
+	h.DB.Model(&models.MessagingNumber{}).Where("phone_number = ? AND tenant_id = ?", input.Number, tenantID).Count(&owned)
+	if owned == 0 {
+		h.DB.Model(&models.Destination{}).Where("destination_number = ? AND tenant_id = ?", input.Number, tenantID).Count(&owned)
+	}
+	if owned == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Number not found"})
+	}
+
+	entry := models.MessagingConsent{
+		TenantID:  tenantID,
+		Number:    input.Number,
+		Recipient: input.Recipient,
+		Status:    input.Status,
+		Source:    models.ConsentSourceAPI,
+		Note:      input.Note,
+	}
+	if userID := middleware.GetUserID(c); userID != 0 {
+		entry.UserID = &userID
+	}
+	if err := h.MsgManager.RecordConsent(&entry); err != nil {
+		h.logError("MESSAGING", "RecordMessagingConsent: Failed to record consent", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record consent"})
+	}
+
+	h.logInfo("MESSAGING", "RecordMessagingConsent: Consent recorded", h.reqFields(c, map[string]interface{}{"number": entry.Number, "status": entry.Status}))
+	return c.Status(http.StatusCreated).JSON(entry)
+}
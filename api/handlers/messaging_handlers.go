@@ -3,6 +3,7 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"callsign/services/contactsync"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -59,6 +60,13 @@ func (h *Handler) SendMessage(c *fiber.Ctx) error {
 	msg.Direction = "outbound"
 	msg.Status = "pending"
 
+	if h.MsgManager != nil {
+		if err := h.MsgManager.CheckConsent(tenantID, msg.From, msg.To); err != nil {
+			h.logWarn("MESSAGING", "SendMessage: Recipient opted out", h.reqFields(c, map[string]interface{}{"from": msg.From, "to": msg.To}))
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Recipient has opted out of messages from this number", "code": "recipient_opted_out"})
+		}
+	}
+
 	if err := h.DB.Create(&msg).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -206,9 +214,17 @@ func (h *Handler) SyncContact(c *fiber.Ctx) error {
 	// Set default headers
 	req.Header.Set("Accept", "application/json")
 
-	// Apply custom headers from webhook configuration
-	if webhook.FetchHeaders != "" {
-		applyWebhookHeaders(req, webhook.FetchHeaders)
+	// Apply custom headers and the source's credentials
+	if h.ContactSync != nil {
+		if err := h.ContactSync.Authorize(req, &webhook); err != nil {
+			h.logError("MESSAGING", "SyncContact: Failed to authorize request", h.reqFields(c, map[string]interface{}{
+				"contact_id": id,
+				"error":      err.Error(),
+			}))
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "Failed to authenticate with webhook source"})
+		}
+	} else {
+		contactsync.ApplyHeaders(req, webhook.FetchHeaders)
 	}
 
 	// Execute the webhook request
@@ -254,7 +270,7 @@ func (h *Handler) SyncContact(c *fiber.Ctx) error {
 	}
 
 	// Apply field mapping if configured
-	updatedContact := applyFieldMapping(contact, webhookData, webhook.FieldMapping)
+	updatedContact := contactsync.ApplyFieldMapping(contact, webhookData, webhook.FieldMapping)
 
 	// Update sync timestamp
 	now := time.Now()
@@ -289,123 +305,6 @@ func replaceURLTemplate(templateURL, externalID string) string {
 	return templateURL
 }
 
-// applyWebhookHeaders parses and applies custom headers to the request
-func applyWebhookHeaders(req *http.Request, headersJSON string) {
-	var headers map[string]string
-	if err := json.Unmarshal([]byte(headersJSON), &headers); err != nil {
-		return
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-}
-
-// applyFieldMapping maps webhook data to contact fields based on field mapping config
-func applyFieldMapping(contact models.Contact, data map[string]interface{}, fieldMappingJSON string) models.Contact {
-	// If no field mapping, try auto-mapping based on common field names
-	if fieldMappingJSON == "" {
-		contact = autoMapFields(contact, data)
-		return contact
-	}
-
-	// Parse field mapping configuration
-	var fieldMapping map[string]string
-	if err := json.Unmarshal([]byte(fieldMappingJSON), &fieldMapping); err != nil {
-		// Fall back to auto-mapping on parse error
-		return autoMapFields(contact, data)
-	}
-
-	// Apply configured mappings
-	for contactField, dataKey := range fieldMapping {
-		if value, exists := data[dataKey]; exists {
-			contact = setContactField(contact, contactField, value)
-		}
-	}
-
-	return contact
-}
-
-// autoMapFields attempts to map common field names automatically
-func autoMapFields(contact models.Contact, data map[string]interface{}) models.Contact {
-	// Map common field names from various CRM/webhook systems
-	fieldMappings := map[string][]string{
-		"FirstName":   {"first_name", "firstName", "given_name", "givenName", "name"},
-		"LastName":    {"last_name", "lastName", "family_name", "familyName", "surname"},
-		"DisplayName": {"display_name", "displayName", "full_name", "fullName", "name"},
-		"Company":     {"company", "company_name", "companyName", "organization", "org"},
-		"Title":       {"title", "job_title", "jobTitle", "position"},
-		"Email":       {"email", "email_address", "emailAddress"},
-		"Phone":       {"phone", "phone_number", "phoneNumber", "telephone"},
-		"MobilePhone": {"mobile_phone", "mobilePhone", "cell_phone", "cellPhone", "mobile"},
-		"Address1":    {"address1", "address_1", "street_address", "streetAddress", "address"},
-		"City":        {"city", "town"},
-		"State":       {"state", "province", "region"},
-		"PostalCode":  {"postal_code", "postalCode", "zip", "zip_code", "zipCode"},
-		"Country":     {"country"},
-	}
-
-	for contactField, dataKeys := range fieldMappings {
-		for _, dataKey := range dataKeys {
-			if value, exists := data[dataKey]; exists {
-				contact = setContactField(contact, contactField, value)
-				break
-			}
-		}
-	}
-
-	return contact
-}
-
-// setContactField sets a field on the contact by name
-func setContactField(contact models.Contact, fieldName string, value interface{}) models.Contact {
-	strValue := fmt.Sprintf("%v", value)
-
-	switch fieldName {
-	case "FirstName":
-		contact.FirstName = strValue
-	case "LastName":
-		contact.LastName = strValue
-	case "DisplayName":
-		contact.DisplayName = strValue
-	case "Company":
-		contact.Company = strValue
-	case "Title":
-		contact.Title = strValue
-	case "Email":
-		contact.Email = strValue
-	case "Phone":
-		contact.Phone = strValue
-	case "PhoneAlt":
-		contact.PhoneAlt = strValue
-	case "MobilePhone":
-		contact.MobilePhone = strValue
-	case "Address1":
-		contact.Address1 = strValue
-	case "Address2":
-		contact.Address2 = strValue
-	case "City":
-		contact.City = strValue
-	case "State":
-		contact.State = strValue
-	case "PostalCode":
-		contact.PostalCode = strValue
-	case "Country":
-		contact.Country = strValue
-	case "Notes":
-		contact.Notes = strValue
-	case "PreferredChannel":
-		contact.PreferredChannel = strValue
-	case "PreferredLanguage":
-		contact.PreferredLanguage = strValue
-	case "Timezone":
-		contact.Timezone = strValue
-	case "Status":
-		contact.Status = strValue
-	}
-
-	return contact
-}
-
 func (h *Handler) GetContactByPhone(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	phone := c.Query("phone")
@@ -451,11 +350,26 @@ func (h *Handler) CreateChatThread(c *fiber.Ctx) error {
 	}
 
 	thread.TenantID = tenantID
+	thread.AssignedTo, thread.QueuedAt, thread.AssignedAt = nil, nil, nil
+	if thread.QueueID != nil {
+		var count int64
+		h.DB.Model(&models.ChatQueue{}).Where("id = ? AND tenant_id = ?", *thread.QueueID, tenantID).Count(&count)
+		if count == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Queue not found"})
+		}
+	}
 
 	if err := h.DB.Create(&thread).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Web chats started in a queue wait there for an agent
+	if thread.QueueID != nil && h.MsgManager != nil {
+		if err := h.MsgManager.ChatRouter.Enqueue(&thread); err != nil {
+			h.logError("MESSAGING", "CreateChatThread: Failed to queue thread", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		}
+	}
+
 	return c.Status(http.StatusCreated).JSON(thread)
 }
 
@@ -477,6 +391,19 @@ func (h *Handler) GetChatThread(c *fiber.Ctx) error {
 	return c.JSON(thread)
 }
 
+// SMSThreadGate runs gate (a plan feature check) before messages are posted
+// to SMS and MMS threads, leaving internal, web and room chat ungated
+func (h *Handler) SMSThreadGate(gate fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var thread models.ChatThread
+		if err := h.DB.Select("channel").Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+			First(&thread).Error; err == nil && (thread.Channel == models.ChannelSMS || thread.Channel == models.ChannelMMS) {
+			return gate(c)
+		}
+		return c.Next()
+	}
+}
+
 func (h *Handler) SendChatMessage(c *fiber.Ctx) error {
 	tenantID := middleware.GetTenantID(c)
 	threadIDu64, _ := strconv.ParseUint(c.Params("id"), 10, 64)
@@ -504,6 +431,11 @@ func (h *Handler) SendChatMessage(c *fiber.Ctx) error {
 	// Update thread's last message time
 	h.DB.Model(&thread).Update("last_message_at", msg.CreatedAt)
 
+	// An agent's first reply stops the queue's response clock
+	if msg.SenderType == "extension" && h.MsgManager != nil {
+		h.MsgManager.ChatRouter.RecordResponse(&thread, msg.SenderID)
+	}
+
 	return c.Status(http.StatusCreated).JSON(msg)
 }
 
@@ -583,6 +515,9 @@ func (h *Handler) CreateChatQueue(c *fiber.Ctx) error {
 	}
 
 	queue.TenantID = tenantID
+	if msg := h.validateChatQueue(&queue); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
 
 	if err := h.DB.Create(&queue).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -178,42 +179,55 @@ func (h *Handler) ServeProvisioningConfig(c *fiber.Ctx) error {
 	mac := c.Params("mac")
 	filename := c.Params("filename")
 
-	// Normalize MAC address
-	mac = strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(mac, ":", ""), "-", ""))
+	// Normalize MAC address (stored lowercase without separators)
+	mac = strings.ToLower(models.NormalizeMAC(mac))
 
-	// Find device by MAC
-	var device struct {
-		ID          uint
-		TenantID    uint
-		Vendor      string
-		Model       string
-		ExtensionID *uint
-		Extension   string
-		Password    string
-		Domain      string
+	var device models.Device
+	if err := h.DB.Where("mac = ?", mac).
+		Preload("Profile").
+		Preload("Lines", "enabled = ?", true).
+		Preload("Lines.Extension").
+		First(&device).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return c.SendString("Device not found")
 	}
 
-	err := h.DB.Table("devices").
-		Select("devices.id, devices.tenant_id, devices.vendor, devices.model, devices.extension_id, "+
-			"extensions.extension, extensions.password, tenants.domain").
-		Joins("LEFT JOIN extensions ON devices.extension_id = extensions.id").
-		Joins("JOIN tenants ON devices.tenant_id = tenants.id").
-		Where("UPPER(REPLACE(REPLACE(devices.mac_address, ':', ''), '-', '')) = ?", mac).
-		First(&device).Error
-
-	if err != nil {
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, device.TenantID).Error; err != nil {
 		c.Status(http.StatusNotFound)
 		return c.SendString("Device not found")
 	}
 
+	if !device.Enabled || !tenant.ProvisioningEnabled {
+		h.recordProvision(c, &tenant, &device, mac, http.StatusForbidden, "device_disabled")
+		c.Status(http.StatusForbidden)
+		return c.SendString("Device is disabled")
+	}
+
+	// Enforce the access rules of the device's template chain
+	chain, err := h.deviceTemplateChain(&device)
+	if err != nil {
+		h.recordProvision(c, &tenant, &device, mac, http.StatusInternalServerError, "template_chain")
+		c.Status(http.StatusInternalServerError)
+		return c.SendString("Template inheritance error")
+	}
+	if chain != nil {
+		if reason, msg := h.provisionDenied(c, chain, mac); reason != "" {
+			h.recordProvision(c, &tenant, &device, mac, http.StatusForbidden, reason)
+			c.Status(http.StatusForbidden)
+			return c.SendString(msg)
+		}
+	}
+
 	// Find matching template
 	var tmpl models.ProvisioningTemplate
-	err = h.DB.Where("(tenant_id IS NULL OR tenant_id = ?) AND vendor = ? AND enabled = true",
-		device.TenantID, device.Vendor).
+	err = h.DB.Where("(tenant_id IS NULL OR tenant_id = ?) AND LOWER(vendor) = ? AND enabled = true",
+		device.TenantID, strings.ToLower(device.Manufacturer)).
 		Order("priority ASC").
 		First(&tmpl).Error
 
 	if err != nil {
+		h.recordProvision(c, &tenant, &device, mac, http.StatusNotFound, "no_template")
 		c.Status(http.StatusNotFound)
 		return c.SendString("No template found for this device")
 	}
@@ -221,12 +235,26 @@ func (h *Handler) ServeProvisioningConfig(c *fiber.Ctx) error {
 	// Get provisioning variables
 	vars := map[string]string{
 		"mac_address": mac,
-		"extension":   device.Extension,
-		"password":    device.Password,
-		"domain":      device.Domain,
-		"server":      device.Domain,
+		"domain":      tenant.Domain,
+		"server":      tenant.Domain,
 		"filename":    filename,
 	}
+	var primary *models.DeviceLine
+	for i := range device.Lines {
+		if primary == nil || device.Lines[i].LineNumber < primary.LineNumber {
+			primary = &device.Lines[i]
+		}
+	}
+	if primary != nil {
+		userID, _, password := primary.GetEffectiveCredentials()
+		vars["extension"] = userID
+		vars["password"] = password
+	}
+	if fw := h.deviceFirmware(&device, chain); fw != nil {
+		vars["firmware_url"] = firmwareURL(c, &tenant, &device, fw)
+		vars["firmware_version"] = fw.Version
+		vars["firmware_checksum"] = fw.Checksum
+	}
 
 	// Load tenant/device variables
 	var provVars []models.ProvisioningVariable
@@ -246,10 +274,18 @@ func (h *Handler) ServeProvisioningConfig(c *fiber.Ctx) error {
 
 	var output strings.Builder
 	if err := t.Execute(&output, vars); err != nil {
+		h.recordProvision(c, &tenant, &device, mac, http.StatusInternalServerError, "render_error")
 		c.Status(http.StatusInternalServerError)
 		return c.SendString("Template execution error: " + err.Error())
 	}
 
+	h.DB.Model(&device).Updates(map[string]interface{}{
+		"last_provision":    time.Now(),
+		"last_provision_ip": c.IP(),
+		"provision_count":   device.ProvisionCount + 1,
+	})
+	h.recordProvision(c, &tenant, &device, mac, http.StatusOK, "")
+
 	// Set content type based on file type
 	switch tmpl.FileType {
 	case "xml":
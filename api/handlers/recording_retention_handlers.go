@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/retention"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =====================
+// Recording Retention & Storage
+// =====================
+
+// UpdateRecordingConfig creates or updates the tenant's recording configuration
+func (h *Handler) UpdateRecordingConfig(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var config models.RecordingConfig
+	exists := h.DB.Where("tenant_id = ?", tenantID).First(&config).Error == nil
+	configID := config.ID
+
+	if err := c.BodyParser(&config); err != nil {
+		h.logWarn("API", "UpdateRecordingConfig: Invalid request body", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	config.ID = configID
+	config.TenantID = tenantID
+
+	if config.QuotaAction == "" {
+		config.QuotaAction = models.RecordingQuotaRefuse
+	}
+	if config.QuotaAction != models.RecordingQuotaRefuse && config.QuotaAction != models.RecordingQuotaRotate {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "quota_action must be 'refuse' or 'rotate'"})
+	}
+	if config.RetentionDays < 0 || config.ArchiveRetentionDays < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "retention_days and archive_retention_days cannot be negative"})
+	}
+
+	var err error
+	if exists {
+		err = h.DB.Save(&config).Error
+	} else {
+		err = h.DB.Create(&config).Error
+	}
+	if err != nil {
+		h.logError("API", "UpdateRecordingConfig: Failed to save config", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save recording config"})
+	}
+
+	return c.JSON(fiber.Map{"data": config, "message": "Recording config updated"})
+}
+
+// GetRecordingUsage returns the tenant's recording storage usage and effective policy
+func (h *Handler) GetRecordingUsage(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+	return c.JSON(fiber.Map{"data": retention.TenantUsage(h.DB, tenantID)})
+}
+
+// ListRecordingUsage returns recording usage for every tenant (system admin)
+func (h *Handler) ListRecordingUsage(c *fiber.Ctx) error {
+	var tenantIDs []uint
+	if err := h.DB.Model(&models.Tenant{}).Order("id ASC").Pluck("id", &tenantIDs).Error; err != nil {
+		h.logError("API", "ListRecordingUsage: Failed to list tenants", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list tenants"})
+	}
+
+	usage := make([]retention.Usage, 0, len(tenantIDs))
+	for _, id := range tenantIDs {
+		usage = append(usage, retention.TenantUsage(h.DB, id))
+	}
+	return c.JSON(fiber.Map{"data": usage})
+}
+
+// SetRecordingLegalHold places or releases a legal hold on a call recording.
+// Held recordings are skipped by retention and quota rotation.
+func (h *Handler) SetRecordingLegalHold(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid recording ID"})
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var rec models.CallRecording
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&rec).Error; err != nil {
+		h.logWarn("API", "SetRecordingLegalHold: Recording not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Recording not found"})
+	}
+
+	var input struct {
+		Hold   bool   `json:"hold"`
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	updates := map[string]interface{}{
+		"legal_hold":        input.Hold,
+		"legal_hold_reason": input.Reason,
+		"legal_hold_at":     nil,
+	}
+	if input.Hold {
+		updates["legal_hold_at"] = time.Now()
+	} else {
+		updates["legal_hold_reason"] = ""
+	}
+
+	if err := h.DB.Model(&rec).Updates(updates).Error; err != nil {
+		h.logError("API", "SetRecordingLegalHold: Failed to update recording", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update recording"})
+	}
+	h.DB.First(&rec, rec.ID)
+
+	message := "Legal hold released"
+	if input.Hold {
+		message = "Legal hold applied"
+	}
+	h.logInfo("API", "SetRecordingLegalHold: "+message, h.reqFields(c, map[string]interface{}{"recording_id": rec.ID}))
+	return c.JSON(fiber.Map{"data": rec, "message": message})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"callsign/middleware"
 	"callsign/models"
 	"callsign/services/encryption"
 	"callsign/services/messaging"
@@ -66,6 +67,12 @@ func (h *SMSHandler) SendMessage(c *fiber.Ctx) error {
 		msg.Type = "sms"
 	}
 
+	if h.MsgManager != nil {
+		if err := h.MsgManager.CheckConsent(tenantID, msg.From, msg.To); err != nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Recipient has opted out of messages from this number", "code": "recipient_opted_out"})
+		}
+	}
+
 	// Encrypt body before saving (fail loud if encryption fails)
 	if msg.Body != "" && h.EncMgr != nil {
 		encrypted, err := h.EncMgr.Encrypt(msg.Body)
@@ -196,17 +203,18 @@ func (h *PhraseHandler) CreatePhrase(c *fiber.Ctx) error {
 
 // ChatplanHandler handles chatplan API requests
 type ChatplanHandler struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	MsgManager *messaging.Manager
 }
 
 // NewChatplanHandler creates a new chatplan handler
-func NewChatplanHandler(db *gorm.DB) *ChatplanHandler {
-	return &ChatplanHandler{DB: db}
+func NewChatplanHandler(db *gorm.DB, msgManager *messaging.Manager) *ChatplanHandler {
+	return &ChatplanHandler{DB: db, MsgManager: msgManager}
 }
 
 // ListChatplans returns all chatplans for a tenant
 func (h *ChatplanHandler) ListChatplans(c *fiber.Ctx) error {
-	tenantID := getLocalsUint(c, "tenant_id", 0)
+	tenantID := middleware.GetTenantID(c)
 
 	var chatplans []models.Chatplan
 	h.DB.Where("tenant_id = ? OR tenant_id = 0", tenantID).
@@ -217,12 +225,15 @@ func (h *ChatplanHandler) ListChatplans(c *fiber.Ctx) error {
 
 // CreateChatplan creates a new chatplan
 func (h *ChatplanHandler) CreateChatplan(c *fiber.Ctx) error {
-	tenantID := getLocalsUint(c, "tenant_id", 0)
+	tenantID := middleware.GetTenantID(c)
 
 	var chatplan models.Chatplan
 	if err := c.BodyParser(&chatplan); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if err := messaging.ValidateChatplan(&chatplan); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	chatplan.TenantID = tenantID
 	if err := h.DB.Create(&chatplan).Error; err != nil {
@@ -234,7 +245,7 @@ func (h *ChatplanHandler) CreateChatplan(c *fiber.Ctx) error {
 
 // UpdateChatplan updates a chatplan
 func (h *ChatplanHandler) UpdateChatplan(c *fiber.Ctx) error {
-	tenantID := getLocalsUint(c, "tenant_id", 0)
+	tenantID := middleware.GetTenantID(c)
 	id, _ := strconv.ParseUint(c.Params("id"), 10, 64)
 
 	var existing models.Chatplan
@@ -245,6 +256,9 @@ func (h *ChatplanHandler) UpdateChatplan(c *fiber.Ctx) error {
 	if err := c.BodyParser(&existing); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if err := messaging.ValidateChatplan(&existing); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	existing.TenantID = tenantID
 	h.DB.Save(&existing)
@@ -253,7 +267,7 @@ func (h *ChatplanHandler) UpdateChatplan(c *fiber.Ctx) error {
 
 // DeleteChatplan deletes a chatplan
 func (h *ChatplanHandler) DeleteChatplan(c *fiber.Ctx) error {
-	tenantID := getLocalsUint(c, "tenant_id", 0)
+	tenantID := middleware.GetTenantID(c)
 	id, _ := strconv.ParseUint(c.Params("id"), 10, 64)
 
 	result := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).Delete(&models.Chatplan{})
@@ -265,6 +279,52 @@ func (h *ChatplanHandler) DeleteChatplan(c *fiber.Ctx) error {
 	return nil
 }
 
+// TestChatplan simulates a message against the tenant and global chatplans
+// and shows which rule matched and what it would do, without acting on it
+func (h *ChatplanHandler) TestChatplan(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var req struct {
+		Direction string `json:"direction"`
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Body      string `json:"body"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.Direction == "" {
+		req.Direction = messaging.ChatplanInbound
+	}
+	if req.Direction != messaging.ChatplanInbound && req.Direction != messaging.ChatplanOutbound {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "direction must be inbound or outbound"})
+	}
+	if h.MsgManager == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Messaging is not available"})
+	}
+
+	remote := req.From
+	if req.Direction == messaging.ChatplanOutbound {
+		remote = req.To
+	}
+	result, err := h.MsgManager.EvaluateChatplan(&messaging.ChatplanMessage{
+		TenantID:  tenantID,
+		Direction: req.Direction,
+		From:      req.From,
+		To:        req.To,
+		Body:      req.Body,
+		Contact:   h.MsgManager.LookupContact(tenantID, remote),
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"matched": result.Rule != nil,
+		"result":  result,
+	})
+}
+
 // DefaultOutboundRouteHandler handles system-level outbound routing
 type DefaultOutboundRouteHandler struct {
 	DB *gorm.DB
@@ -4,6 +4,8 @@ import (
 	"callsign/handlers/freeswitch"
 	"callsign/middleware"
 	"callsign/models"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -102,17 +104,25 @@ func (h *Handler) UpdateTenant(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
 	}
 
+	// The outbound block only changes through the fraud endpoints, which
+	// log it
+	blocked, blockedAt, blockReason := tenant.OutboundBlocked, tenant.OutboundBlockedAt, tenant.OutboundBlockReason
+
 	if err := c.BodyParser(&tenant); err != nil {
 		h.logWarn("TENANT", "UpdateTenant: invalid request payload", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": id}))
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
 	tenant.ID = uint(id)
+	tenant.OutboundBlocked, tenant.OutboundBlockedAt, tenant.OutboundBlockReason = blocked, blockedAt, blockReason
 	if err := h.DB.Save(&tenant).Error; err != nil {
 		h.logError("TENANT", "UpdateTenant: failed to save tenant", h.reqFields(c, map[string]interface{}{"error": err.Error(), "tenant_id": id}))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tenant"})
 	}
 
+	// Outbound routes carry the tenant's concurrent call limit
+	h.flushXMLCache()
+
 	h.logInfo("TENANT", "UpdateTenant: tenant updated successfully", h.reqFields(c, map[string]interface{}{"tenant_id": id, "name": tenant.Name}))
 	return c.JSON(tenant)
 }
@@ -248,6 +258,9 @@ func (h *Handler) UpdateTenantProfile(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
 	}
 
+	// Outbound routes carry the profile's concurrent call limit
+	h.flushXMLCache()
+
 	return c.JSON(profile)
 }
 
@@ -2036,6 +2049,11 @@ func (h *Handler) CreateSystemDeviceTemplate(c *fiber.Ctx) error {
 	// System templates have no tenant
 	tmpl.TenantID = nil
 	tmpl.IsSystem = true
+	tmpl.Pack = "" // only SyncPacks maintains pack templates
+
+	if err := h.validateDeviceTemplate(&tmpl); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Template validation failed", "details": err.Error()})
+	}
 
 	if err := h.DB.Create(&tmpl).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create template"})
@@ -2072,16 +2090,33 @@ func (h *Handler) UpdateSystemDeviceTemplate(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	if tmpl.Pack != "" && (input.ConfigTemplate != tmpl.ConfigTemplate || input.ConfigType != tmpl.ConfigType) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Built-in pack templates are maintained automatically; create a child template to customise them"})
+	}
+
 	updates := map[string]interface{}{
-		"name":            input.Name,
-		"description":     input.Description,
-		"manufacturer":    input.Manufacturer,
-		"model":           input.Model,
-		"family":          input.Family,
-		"config_template": input.ConfigTemplate,
-		"config_type":     input.ConfigType,
-		"firmware_id":     input.FirmwareID,
-		"enabled":         input.Enabled,
+		"name":               input.Name,
+		"description":        input.Description,
+		"manufacturer":       input.Manufacturer,
+		"model":              input.Model,
+		"family":             input.Family,
+		"config_template":    input.ConfigTemplate,
+		"config_type":        input.ConfigType,
+		"parent_id":          input.ParentID,
+		"firmware_id":        input.FirmwareID,
+		"user_agent_pattern": input.UserAgentPattern,
+		"mac_pattern":        input.MACPattern,
+		"require_https":      input.RequireHTTPS,
+		"ip_whitelist":       input.IPWhitelist,
+		"enabled":            input.Enabled,
+	}
+
+	candidate := tmpl
+	candidate.ConfigTemplate = input.ConfigTemplate
+	candidate.ConfigType = input.ConfigType
+	candidate.ParentID = input.ParentID
+	if err := h.validateDeviceTemplate(&candidate); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Template validation failed", "details": err.Error()})
 	}
 
 	h.DB.Model(&tmpl).Updates(updates)
@@ -2279,11 +2314,13 @@ func (h *Handler) UploadFirmware(c *fiber.Ctx) error {
 	}
 	defer dst.Close()
 
-	// Copy file content
-	written, err := io.Copy(dst, file)
+	// Copy file content, hashing it for the checksum phones verify against
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), file)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save file"})
 	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
 
 	// Relative path for storage (from firmware base)
 	relativePath := filepath.Join(safeManufacturer, safeModel, safeFilename)
@@ -2293,6 +2330,7 @@ func (h *Handler) UploadFirmware(c *fiber.Ctx) error {
 		"file_path": relativePath,
 		"file_name": safeFilename,
 		"file_size": written,
+		"checksum":  checksum,
 	})
 
 	return c.JSON(fiber.Map{
@@ -2300,6 +2338,7 @@ func (h *Handler) UploadFirmware(c *fiber.Ctx) error {
 		"path":      relativePath,
 		"full_path": fullPath,
 		"size":      written,
+		"checksum":  checksum,
 	})
 }
 
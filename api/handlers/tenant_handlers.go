@@ -3,6 +3,7 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // =====================
@@ -123,6 +125,19 @@ func (h *Handler) CreateExtension(c *fiber.Ctx) error {
 		}
 	}
 
+	// The voicemail box created with the extension counts toward the plan's
+	// box limit; past it the extension is created without voicemail
+	if profile := models.LoadTenantProfile(h.DB, tenantID); profile != nil && profile.Limit(models.LimitVoicemailBoxes) >= 0 {
+		count, err := models.CountTenantResource(h.DB, tenantID, models.LimitVoicemailBoxes)
+		if err != nil {
+			h.logError("API", "CreateExtension: Failed to check plan limits", h.reqFields(c, nil))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check plan limits"})
+		}
+		if !profile.CheckLimit(models.LimitVoicemailBoxes, int(count)) {
+			ext.VoicemailEnabled = false
+		}
+	}
+
 	if err := h.DB.Create(&ext).Error; err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create extension: " + err.Error()})
 	}
@@ -148,7 +163,11 @@ func (h *Handler) CreateExtension(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": ext, "message": "Extension created"})
+	message := "Extension created"
+	if !ext.VoicemailEnabled {
+		message = "Extension created without voicemail: plan voicemail box limit reached"
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": ext, "message": message})
 }
 
 // generateRandomPassword creates a random alphanumeric password
@@ -390,7 +409,7 @@ func (h *Handler) ListVoicemailBoxes(c *fiber.Ctx) error {
 	}
 
 	var boxes []models.VoicemailBox
-	if err := h.DB.Where("tenant_id = ?", middleware.GetTenantID(c)).Find(&boxes).Error; err != nil {
+	if err := h.DB.Where("tenant_id = ?", middleware.GetTenantID(c)).Preload("Members").Find(&boxes).Error; err != nil {
 		h.logError("API", "ListVoicemailBoxes: Failed to fetch voicemail boxes", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch voicemail boxes"})
 	}
@@ -480,6 +499,7 @@ func (h *Handler) DeleteVoicemailBox(c *fiber.Ctx) error {
 		h.logError("API", "DeleteVoicemailBox: Failed to delete voicemail box", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete voicemail box"})
 	}
+	h.DB.Where("box_id = ? AND tenant_id = ?", id, middleware.GetTenantID(c)).Delete(&models.VoicemailBoxMember{})
 
 	return c.JSON(fiber.Map{"message": "Voicemail box deleted"})
 }
@@ -502,9 +522,10 @@ func (h *Handler) ListVoicemailMessages(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Voicemail box not found"})
 	}
 
-	// Get messages
+	// Get messages, optionally filtered by transcript or caller text (?q=)
 	var messages []models.VoicemailMessage
-	if err := h.DB.Where("box_id = ?", box.ID).Order("created_at DESC").Find(&messages).Error; err != nil {
+	query := searchVoicemail(h.DB.Where("box_id = ?", box.ID), c.Query("q"))
+	if err := query.Order("created_at DESC").Find(&messages).Error; err != nil {
 		h.logError("API", "ListVoicemailMessages: Failed to fetch messages", h.reqFields(c, nil))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch messages"})
 	}
@@ -512,6 +533,72 @@ func (h *Handler) ListVoicemailMessages(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": messages, "box": box})
 }
 
+// SearchVoicemailMessages searches messages across the tenant's boxes by
+// transcript or caller text (?q=), extension, status and recorded date
+func (h *Handler) SearchVoicemailMessages(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("API", "SearchVoicemailMessages: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	tenantID := middleware.GetTenantID(c)
+
+	// Pagination
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	page, limit = max(page, 1), min(max(limit, 1), 200)
+	offset := (page - 1) * limit
+
+	query := searchVoicemail(h.DB.Model(&models.VoicemailMessage{}).Where("tenant_id = ?", tenantID), c.Query("q"))
+
+	// Filters
+	if ext := c.Query("extension"); ext != "" {
+		query = query.Where("box_id IN (?)", h.DB.Model(&models.VoicemailBox{}).
+			Select("id").Where("tenant_id = ? AND extension = ?", tenantID, ext))
+	}
+	if isNew := c.Query("is_new"); isNew != "" {
+		query = query.Where("is_new = ?", isNew == "true")
+	}
+	if status := c.Query("transcription_status"); status != "" {
+		query = query.Where("transcription_status = ?", status)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("recorded_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("recorded_at <= ?", endDate)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var messages []models.VoicemailMessage
+	if err := query.Order("recorded_at DESC").Offset(offset).Limit(limit).Find(&messages).Error; err != nil {
+		h.logError("API", "SearchVoicemailMessages: Failed to fetch messages", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch messages"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  messages,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// searchVoicemail narrows a message query to transcripts, caller names or
+// numbers containing q
+func searchVoicemail(query *gorm.DB, q string) *gorm.DB {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return query
+	}
+	like := "%" + strings.ToLower(q) + "%"
+	return query.Where("LOWER(transcription) LIKE ? OR LOWER(caller_id_name) LIKE ? OR caller_id_number LIKE ?",
+		like, like, "%"+q+"%")
+}
+
 // GetVoicemailMessage gets a single voicemail message
 func (h *Handler) GetVoicemailMessage(c *fiber.Ctx) error {
 	claims := middleware.GetClaims(c)
@@ -532,6 +619,57 @@ func (h *Handler) GetVoicemailMessage(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": message})
 }
 
+// GetVoicemailTranscription returns the transcription job for a voicemail
+// message, with its timed segments
+func (h *Handler) GetVoicemailTranscription(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("API", "GetVoicemailTranscription: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	id, _ := strconv.Atoi(c.Params("id"))
+	tenantID := middleware.GetTenantID(c)
+
+	var message models.VoicemailMessage
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&message).Error; err != nil {
+		h.logWarn("API", "GetVoicemailTranscription: Message not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+	}
+
+	var transcription models.Transcription
+	if err := h.DB.Where("voicemail_message_id = ?", message.ID).
+		Preload("Segments", func(db *gorm.DB) *gorm.DB { return db.Order("start_ms ASC") }).
+		Order("id DESC").First(&transcription).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Transcription not found", "status": message.TranscriptionStatus})
+	}
+
+	return c.JSON(fiber.Map{"data": transcription})
+}
+
+// TranscribeVoicemailMessage queues a voicemail message for transcription,
+// bypassing the tenant's auto-transcribe rules. Re-queues failed or
+// completed jobs.
+func (h *Handler) TranscribeVoicemailMessage(c *fiber.Ctx) error {
+	if h.Transcriber == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Transcription service not available"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid message ID"})
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	job, err := h.Transcriber.EnqueueVoicemail(tenantID, uint(id))
+	if err != nil {
+		h.logWarn("API", "TranscribeVoicemailMessage: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{"data": job, "message": "Transcription queued"})
+}
+
 // DeleteVoicemailMessage deletes a voicemail message
 func (h *Handler) DeleteVoicemailMessage(c *fiber.Ctx) error {
 	claims := middleware.GetClaims(c)
@@ -549,16 +687,12 @@ func (h *Handler) DeleteVoicemailMessage(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
 	}
 
-	// Delete the audio file from storage
-	if message.FilePath != "" {
-		os.Remove(message.FilePath)
-	}
-
-	// Update box message counts
-	if message.IsNew {
-		h.DB.Model(&models.VoicemailBox{}).Where("id = ?", message.BoxID).Update("new_messages", models.VoicemailBox{}.NewMessages-1)
-	} else {
-		h.DB.Model(&models.VoicemailBox{}).Where("id = ?", message.BoxID).Update("saved_messages", models.VoicemailBox{}.SavedMessages-1)
+	// Delete the audio files from storage unless forwarded or list copies
+	// still play them
+	for _, path := range []string{message.FilePath, message.IntroPath} {
+		if path != "" && !models.VoicemailFileInUse(h.DB, path, message.ID) {
+			h.Storage.Delete(context.Background(), path)
+		}
 	}
 
 	if err := h.DB.Delete(&message).Error; err != nil {
@@ -566,13 +700,12 @@ func (h *Handler) DeleteVoicemailMessage(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete message"})
 	}
 
-	// Send MWI event so phone voicemail lamp updates
+	// Update box message counts and send MWI so phone voicemail lamps
+	// (including group members') update
 	var box models.VoicemailBox
 	if err := h.DB.First(&box, message.BoxID).Error; err == nil {
-		var tenant models.Tenant
-		if err := h.DB.First(&tenant, box.TenantID).Error; err == nil && h.ESLManager != nil {
-			h.ESLManager.SendMWI(box.Extension, tenant.Domain, box.NewMessages, box.SavedMessages)
-		}
+		models.RefreshVoicemailCounts(h.DB, &box)
+		h.sendVoicemailMWI(&box)
 	}
 
 	return c.JSON(fiber.Map{"message": "Voicemail message deleted"})
@@ -601,20 +734,11 @@ func (h *Handler) MarkVoicemailRead(c *fiber.Ctx) error {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark as read"})
 		}
 
-		// Update box counts
-		h.DB.Model(&models.VoicemailBox{}).Where("id = ?", message.BoxID).Updates(map[string]interface{}{
-			"new_messages":   models.VoicemailBox{}.NewMessages - 1,
-			"saved_messages": models.VoicemailBox{}.SavedMessages + 1,
-		})
-
-		// Send MWI event so phone voicemail lamp updates
+		// Update box counts and send MWI so phone voicemail lamps update
 		var box models.VoicemailBox
 		if err := h.DB.First(&box, message.BoxID).Error; err == nil {
-			var tenant models.Tenant
-			if err := h.DB.First(&tenant, box.TenantID).Error; err == nil && h.ESLManager != nil {
-				newCount := max(0, box.NewMessages-1)
-				h.ESLManager.SendMWI(box.Extension, tenant.Domain, newCount, box.SavedMessages+1)
-			}
+			models.RefreshVoicemailCounts(h.DB, &box)
+			h.sendVoicemailMWI(&box)
 		}
 	}
 
@@ -644,7 +768,7 @@ func (h *Handler) StreamVoicemailMessage(c *fiber.Ctx) error {
 	}
 
 	// Serve the file
-	return c.SendFile(message.FilePath)
+	return h.sendStoredFile(c, message.FilePath, "")
 }
 
 // =====================
@@ -720,7 +844,7 @@ func (h *Handler) StreamRecording(c *fiber.Ctx) error {
 			h.logWarn("API", "StreamRecording: Recording file not found", h.reqFields(c, nil))
 			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Recording file not found"})
 		}
-		return c.SendFile(callRec.FilePath)
+		return h.sendStoredFile(c, callRec.FilePath, "")
 	}
 
 	var rec models.Recording
@@ -734,7 +858,7 @@ func (h *Handler) StreamRecording(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Recording file not found"})
 	}
 
-	return c.SendFile(rec.FilePath)
+	return h.sendStoredFile(c, rec.FilePath, "")
 }
 
 // DownloadRecording downloads recording as attachment
@@ -759,7 +883,7 @@ func (h *Handler) DownloadRecording(c *fiber.Ctx) error {
 			filename = "recording.wav"
 		}
 		c.Set("Content-Disposition", "attachment; filename="+filename)
-		return c.SendFile(callRec.FilePath)
+		return h.sendStoredFile(c, callRec.FilePath, "")
 	}
 
 	var rec models.Recording
@@ -778,7 +902,7 @@ func (h *Handler) DownloadRecording(c *fiber.Ctx) error {
 		filename = "recording.wav"
 	}
 	c.Set("Content-Disposition", "attachment; filename="+filename)
-	return c.SendFile(rec.FilePath)
+	return h.sendStoredFile(c, rec.FilePath, "")
 }
 
 // UpdateRecordingNotes updates notes/tags on a call recording
@@ -835,13 +959,37 @@ func (h *Handler) GetRecordingTranscription(c *fiber.Ctx) error {
 	}
 
 	var transcription models.Transcription
-	if err := h.DB.Where("recording_id = ?", rec.ID).Preload("Segments").First(&transcription).Error; err != nil {
+	if err := h.DB.Where("call_recording_id = ?", rec.ID).
+		Preload("Segments", func(db *gorm.DB) *gorm.DB { return db.Order("start_ms ASC") }).
+		Order("id DESC").First(&transcription).Error; err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Transcription not found", "status": rec.TranscriptionStatus})
 	}
 
 	return c.JSON(fiber.Map{"data": transcription})
 }
 
+// TranscribeRecording queues a call recording for transcription, bypassing
+// the tenant's auto-transcribe rules. Re-queues failed or completed jobs.
+func (h *Handler) TranscribeRecording(c *fiber.Ctx) error {
+	if h.Transcriber == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Transcription service not available"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid recording ID"})
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	job, err := h.Transcriber.EnqueueRecording(tenantID, uint(id))
+	if err != nil {
+		h.logWarn("API", "TranscribeRecording: "+err.Error(), h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{"data": job, "message": "Transcription queued"})
+}
+
 // GetRecordingConfig returns tenant-level recording configuration
 func (h *Handler) GetRecordingConfig(c *fiber.Ctx) error {
 	claims := middleware.GetClaims(c)
@@ -1292,6 +1440,87 @@ func (h *Handler) UnpauseQueueAgent(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": agent, "message": "Agent unpaused"})
 }
 
+// =====================
+// Queue Callbacks
+// =====================
+
+// ListQueueCallbacks lists callback requests for a queue, newest first.
+// Filter with ?status=pending,retry
+func (h *Handler) ListQueueCallbacks(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("API", "ListQueueCallbacks: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	id, _ := strconv.Atoi(c.Params("id"))
+	tenantID := middleware.GetTenantID(c)
+
+	var queue models.Queue
+	if err := h.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&queue).Error; err != nil {
+		h.logWarn("API", "ListQueueCallbacks: Queue not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Queue not found"})
+	}
+
+	query := h.DB.Where("queue_id = ? AND tenant_id = ?", id, tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status IN ?", strings.Split(status, ","))
+	}
+
+	var callbacks []models.QueueCallback
+	if err := query.Order("requested_at DESC").Limit(500).Find(&callbacks).Error; err != nil {
+		h.logError("API", "ListQueueCallbacks: Failed to fetch callbacks", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch callbacks"})
+	}
+
+	return c.JSON(fiber.Map{"data": callbacks})
+}
+
+// CancelQueueCallback cancels a callback that has not been placed yet
+func (h *Handler) CancelQueueCallback(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("API", "CancelQueueCallback: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	id, _ := strconv.Atoi(c.Params("id"))
+	callbackID, _ := strconv.Atoi(c.Params("callbackId"))
+	tenantID := middleware.GetTenantID(c)
+
+	var callback models.QueueCallback
+	if err := h.DB.Where("id = ? AND queue_id = ? AND tenant_id = ?", callbackID, id, tenantID).First(&callback).Error; err != nil {
+		h.logWarn("API", "CancelQueueCallback: Callback not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Callback not found"})
+	}
+
+	res := h.DB.Model(&models.QueueCallback{}).
+		Where("id = ? AND status IN ?", callback.ID, []string{models.QueueCallbackPending, models.QueueCallbackRetry}).
+		Update("status", models.QueueCallbackCancelled)
+	if res.Error != nil {
+		h.logError("API", "CancelQueueCallback: Failed to cancel callback", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel callback"})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Callback is already " + callback.Status})
+	}
+	callback.Status = models.QueueCallbackCancelled
+
+	if h.WSHub != nil {
+		h.WSHub.NotifyQueueEvent(tenantID, "callback_"+callback.Status, map[string]interface{}{
+			"callback_id":     callback.ID,
+			"queue_id":        callback.QueueID,
+			"status":          callback.Status,
+			"callback_number": callback.CallbackNumber,
+			"caller_name":     callback.CallerName,
+			"attempts":        callback.Attempts,
+			"requested_at":    callback.RequestedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{"data": callback, "message": "Callback cancelled"})
+}
+
 // =====================
 // Ring Groups
 // =====================
@@ -1671,6 +1900,8 @@ func (h *Handler) UploadAudioFile(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save recording metadata"})
 	}
 
+	h.Storage.StoreAsync(models.StorageCategoryMedia, tenantID, filePath, recording.MimeType)
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": recording, "message": "Audio file uploaded"})
 }
 
@@ -1826,6 +2057,9 @@ func (h *Handler) UpdateExtensionProfile(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update extension profile"})
 	}
 
+	// Permissions and ring strategy are rendered into directory/dialplan XML
+	h.reloadXML()
+
 	return c.JSON(fiber.Map{"data": profile, "message": "Extension profile updated"})
 }
 
@@ -1849,6 +2083,8 @@ func (h *Handler) DeleteExtensionProfile(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Extension profile not found"})
 	}
 
+	h.reloadXML()
+
 	return c.JSON(fiber.Map{"message": "Extension profile deleted"})
 }
 
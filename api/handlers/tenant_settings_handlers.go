@@ -37,7 +37,12 @@ type TenantSettings struct {
 	MessagingAuthToken  string `json:"messaging_auth_token"`
 
 	// Hospitality
-	HospitalityEnabled bool `json:"hospitality_enabled"`
+	HospitalityEnabled  bool   `json:"hospitality_enabled"`
+	WakeupRetries       *int   `json:"wakeup_retries,omitempty"`
+	WakeupRetryMinutes  int    `json:"wakeup_retry_minutes,omitempty"`
+	WakeupSnoozeMinutes int    `json:"wakeup_snooze_minutes,omitempty"`
+	WakeupAudio         string `json:"wakeup_audio,omitempty"`
+	FrontDeskExtension  string `json:"front_desk_extension,omitempty"`
 
 	// SSL/Security
 	ForceHTTPS bool `json:"force_https"`
@@ -454,9 +459,15 @@ func (h *Handler) GetTenantHospitality(c *fiber.Ctx) error {
 		json.Unmarshal([]byte(tenant.Settings), &settings)
 	}
 
+	wakeup := tenant.WakeupSettings()
 	return c.JSON(fiber.Map{
 		"data": fiber.Map{
-			"enabled": settings.HospitalityEnabled,
+			"enabled":               settings.HospitalityEnabled,
+			"wakeup_retries":        wakeup.Retries,
+			"wakeup_retry_minutes":  wakeup.RetryMinutes,
+			"wakeup_snooze_minutes": wakeup.SnoozeMinutes,
+			"wakeup_audio":          wakeup.Audio,
+			"front_desk_extension":  settings.FrontDeskExtension,
 		},
 	})
 }
@@ -481,14 +492,44 @@ func (h *Handler) UpdateTenantHospitality(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Enabled bool `json:"enabled"`
+		Enabled             bool    `json:"enabled"`
+		WakeupRetries       *int    `json:"wakeup_retries"`
+		WakeupRetryMinutes  *int    `json:"wakeup_retry_minutes"`
+		WakeupSnoozeMinutes *int    `json:"wakeup_snooze_minutes"`
+		WakeupAudio         *string `json:"wakeup_audio"`
+		FrontDeskExtension  *string `json:"front_desk_extension"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		h.logWarn("SETTINGS", "UpdateTenantHospitality: Invalid request body", h.reqFields(c, nil))
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
+	if (req.WakeupRetries != nil && *req.WakeupRetries < 0) ||
+		(req.WakeupRetryMinutes != nil && *req.WakeupRetryMinutes < 1) ||
+		(req.WakeupSnoozeMinutes != nil && *req.WakeupSnoozeMinutes < 1) {
+		h.logWarn("SETTINGS", "UpdateTenantHospitality: Invalid wake-up settings", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Wake-up retries must be 0 or more and intervals at least 1 minute"})
+	}
+	if req.WakeupAudio != nil && !models.ValidWakeupAudio(*req.WakeupAudio) {
+		h.logWarn("SETTINGS", "UpdateTenantHospitality: Invalid wake-up audio", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Wake-up audio path can't contain quotes, braces or line breaks"})
+	}
 
 	settings.HospitalityEnabled = req.Enabled
+	if req.WakeupRetries != nil {
+		settings.WakeupRetries = req.WakeupRetries
+	}
+	if req.WakeupRetryMinutes != nil {
+		settings.WakeupRetryMinutes = *req.WakeupRetryMinutes
+	}
+	if req.WakeupSnoozeMinutes != nil {
+		settings.WakeupSnoozeMinutes = *req.WakeupSnoozeMinutes
+	}
+	if req.WakeupAudio != nil {
+		settings.WakeupAudio = *req.WakeupAudio
+	}
+	if req.FrontDeskExtension != nil {
+		settings.FrontDeskExtension = *req.FrontDeskExtension
+	}
 
 	settingsJSON, _ := json.Marshal(settings)
 	tenant.Settings = string(settingsJSON)
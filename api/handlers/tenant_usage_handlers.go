@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/retention"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ResourceUsage is one resource's current count against its plan limit
+type ResourceUsage struct {
+	Resource  string `json:"resource"`
+	Current   int64  `json:"current"`
+	Limit     int    `json:"limit"` // -1 = unlimited
+	Remaining int64  `json:"remaining"`
+	AtLimit   bool   `json:"at_limit"`
+}
+
+// GetTenantUsage returns current resource counts versus the tenant profile limits
+func (h *Handler) GetTenantUsage(c *fiber.Ctx) error {
+	tenantID := middleware.GetScopedTenantID(c)
+	if tenantID == 0 {
+		h.logWarn("API", "GetTenantUsage: Tenant context required", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tenant context required"})
+	}
+
+	profile := models.LoadTenantProfile(h.DB, tenantID)
+
+	resources := make([]ResourceUsage, 0, len(models.TenantLimits))
+	for _, l := range models.TenantLimits {
+		count, err := models.CountTenantResource(h.DB, tenantID, l.Name)
+		if err != nil {
+			h.logError("API", "GetTenantUsage: Failed to count "+l.Name, h.reqFields(c, nil))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load usage"})
+		}
+
+		usage := ResourceUsage{Resource: l.Name, Current: count, Limit: -1, Remaining: -1}
+		if profile != nil {
+			usage.Limit = profile.Limit(l.Name)
+		}
+		if usage.Limit >= 0 {
+			usage.Remaining = max(0, int64(usage.Limit)-count)
+			usage.AtLimit = count >= int64(usage.Limit)
+		}
+		resources = append(resources, usage)
+	}
+
+	features := make(map[models.TenantFeature]bool, len(models.TenantFeatures))
+	for _, f := range models.TenantFeatures {
+		features[f] = profile == nil || profile.HasFeature(f)
+	}
+
+	result := fiber.Map{
+		"tenant_id":  tenantID,
+		"profile":    nil,
+		"resources":  resources,
+		"features":   features,
+		"recordings": retention.TenantUsage(h.DB, tenantID),
+	}
+	if profile != nil {
+		result["profile"] = fiber.Map{"id": profile.ID, "name": profile.Name}
+	}
+
+	return c.JSON(fiber.Map{"data": result})
+}
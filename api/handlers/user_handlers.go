@@ -3,7 +3,9 @@ package handlers
 import (
 	"callsign/middleware"
 	"callsign/models"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -99,11 +101,73 @@ func (h *Handler) GetUserVoicemail(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"data": nil, "messages": []interface{}{}})
 	}
 
+	// Group mailboxes the user's extension shares
+	var groups []models.VoicemailBox
+	h.DB.Where("tenant_id = ? AND id IN (?)", box.TenantID,
+		h.DB.Model(&models.VoicemailBoxMember{}).Select("box_id").Where("tenant_id = ? AND extension = ?", box.TenantID, user.Extension)).
+		Preload("Messages", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC")
+		}).
+		Find(&groups)
+
 	return c.JSON(fiber.Map{
 		"data":        box,
 		"messages":    box.Messages,
 		"new_count":   box.NewMessages,
 		"saved_count": box.SavedMessages,
+		"group_boxes": groups,
+	})
+}
+
+// GetUserVoicemailIMAP returns the settings for reading the user's
+// voicemail in a mail or visual voicemail client
+func (h *Handler) GetUserVoicemailIMAP(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("USER_PORTAL", "GetUserVoicemailIMAP: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil {
+		h.logWarn("USER_PORTAL", "GetUserVoicemailIMAP: User not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !h.Config.IMAPEnabled {
+		return c.JSON(fiber.Map{"enabled": false})
+	}
+
+	var tenant models.Tenant
+	h.DB.Select("id", "domain").First(&tenant, middleware.GetTenantID(c))
+
+	host := h.Config.IMAPPublicHost
+	if host == "" {
+		host = h.Config.SIPDomain
+	}
+	if host == "" {
+		host = tenant.Domain
+	}
+	port := 0
+	if _, p, err := net.SplitHostPort(h.Config.IMAPAddr); err == nil {
+		port, _ = strconv.Atoi(p)
+	}
+	security := "none"
+	switch {
+	case h.Config.IMAPImplicitTLS:
+		security = "ssl"
+	case h.Config.IMAPTLSCert != "":
+		security = "starttls"
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":  true,
+		"host":     host,
+		"port":     port,
+		"security": security,
+		// Log in with the portal username and password, or with the
+		// extension and voicemail PIN
+		"username":     user.Username,
+		"pin_username": user.Extension + "@" + tenant.Domain,
 	})
 }
 
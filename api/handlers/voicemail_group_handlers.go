@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"callsign/middleware"
+	"callsign/models"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// =====================
+// Group Voicemail Boxes
+// =====================
+
+// GetVoicemailBoxMembers lists the extensions sharing a group mailbox
+func (h *Handler) GetVoicemailBoxMembers(c *fiber.Ctx) error {
+	box, ok := h.voicemailBoxByExt(c, "GetVoicemailBoxMembers")
+	if !ok {
+		return nil
+	}
+
+	var members []models.VoicemailBoxMember
+	h.DB.Where("box_id = ?", box.ID).Order("extension ASC").Find(&members)
+	return c.JSON(fiber.Map{"data": members, "box": box})
+}
+
+// SetVoicemailBoxMembers replaces a mailbox's members, making it a group
+// mailbox (or a personal one again with an empty list). MWI lamps of added
+// and removed members are refreshed.
+func (h *Handler) SetVoicemailBoxMembers(c *fiber.Ctx) error {
+	box, ok := h.voicemailBoxByExt(c, "SetVoicemailBoxMembers")
+	if !ok {
+		return nil
+	}
+
+	var input struct {
+		Extensions []string `json:"extensions"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		h.logWarn("API", "SetVoicemailBoxMembers: Invalid request payload", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	exts := uniqueExtensions(input.Extensions)
+	for _, ext := range exts {
+		if ext == box.Extension {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A mailbox cannot be a member of itself"})
+		}
+	}
+	if missing := h.missingExtensions(box.TenantID, exts); len(missing) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown extensions: " + strings.Join(missing, ", ")})
+	}
+
+	var previous []string
+	h.DB.Model(&models.VoicemailBoxMember{}).Where("box_id = ?", box.ID).Pluck("extension", &previous)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("box_id = ?", box.ID).Delete(&models.VoicemailBoxMember{}).Error; err != nil {
+			return err
+		}
+		for _, ext := range exts {
+			member := models.VoicemailBoxMember{TenantID: box.TenantID, BoxID: box.ID, Extension: ext}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logError("API", "SetVoicemailBoxMembers: Failed to save members", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save members"})
+	}
+
+	// Removed members' lamps drop this box's messages
+	h.sendVoicemailMWI(box)
+	for _, ext := range previous {
+		if !containsString(exts, ext) {
+			h.sendVoicemailMWI(&models.VoicemailBox{TenantID: box.TenantID, Extension: ext})
+		}
+	}
+
+	h.DB.Preload("Members").First(box, box.ID)
+	return c.JSON(fiber.Map{"data": box, "message": "Mailbox members updated"})
+}
+
+// ============================
+// Voicemail Distribution Lists
+// ============================
+
+// voicemailListInput is the body for creating or updating a distribution list
+type voicemailListInput struct {
+	Name           string   `json:"name"`
+	Extension      string   `json:"extension"`
+	Enabled        *bool    `json:"enabled"`
+	GreetingPath   string   `json:"greeting_path"`
+	MaxMessageSecs int      `json:"max_message_secs"`
+	Members        []string `json:"members"`
+}
+
+// ListVoicemailLists lists the tenant's voicemail distribution lists
+func (h *Handler) ListVoicemailLists(c *fiber.Ctx) error {
+	var lists []models.VoicemailDistributionList
+	if err := h.DB.Where("tenant_id = ?", middleware.GetTenantID(c)).
+		Preload("Members").Order("extension ASC").Find(&lists).Error; err != nil {
+		h.logError("API", "ListVoicemailLists: Failed to fetch lists", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch distribution lists"})
+	}
+	return c.JSON(fiber.Map{"data": lists})
+}
+
+// GetVoicemailList returns one distribution list with its members
+func (h *Handler) GetVoicemailList(c *fiber.Ctx) error {
+	list, ok := h.voicemailList(c, "GetVoicemailList")
+	if !ok {
+		return nil
+	}
+	return c.JSON(fiber.Map{"data": list})
+}
+
+// CreateVoicemailList creates a distribution list on its own number
+func (h *Handler) CreateVoicemailList(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var input voicemailListInput
+	if err := c.BodyParser(&input); err != nil {
+		h.logWarn("API", "CreateVoicemailList: Invalid request payload", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	list := models.VoicemailDistributionList{TenantID: tenantID, Enabled: true}
+	if msg := h.applyVoicemailListInput(&list, &input); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.saveVoicemailList(&list, input.Members, true); err != nil {
+		h.logError("API", "CreateVoicemailList: Failed to create list", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create distribution list"})
+	}
+
+	h.logInfo("API", "CreateVoicemailList: Created list "+list.Extension, h.reqFields(c, nil))
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": list, "message": "Distribution list created"})
+}
+
+// UpdateVoicemailList updates a distribution list; members are replaced
+// when given
+func (h *Handler) UpdateVoicemailList(c *fiber.Ctx) error {
+	list, ok := h.voicemailList(c, "UpdateVoicemailList")
+	if !ok {
+		return nil
+	}
+
+	var input voicemailListInput
+	if err := c.BodyParser(&input); err != nil {
+		h.logWarn("API", "UpdateVoicemailList: Invalid request payload", h.reqFields(c, nil))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	if msg := h.applyVoicemailListInput(list, &input); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.saveVoicemailList(list, input.Members, input.Members != nil); err != nil {
+		h.logError("API", "UpdateVoicemailList: Failed to update list", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update distribution list"})
+	}
+
+	return c.JSON(fiber.Map{"data": list, "message": "Distribution list updated"})
+}
+
+// DeleteVoicemailList deletes a distribution list. Messages already
+// delivered to member boxes are kept.
+func (h *Handler) DeleteVoicemailList(c *fiber.Ctx) error {
+	list, ok := h.voicemailList(c, "DeleteVoicemailList")
+	if !ok {
+		return nil
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", list.ID).Delete(&models.VoicemailListMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(list).Error
+	})
+	if err != nil {
+		h.logError("API", "DeleteVoicemailList: Failed to delete list", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete distribution list"})
+	}
+
+	h.flushXMLCache()
+	return c.JSON(fiber.Map{"message": "Distribution list deleted"})
+}
+
+// applyVoicemailListInput validates the input onto the list, returning a
+// client error message on failure
+func (h *Handler) applyVoicemailListInput(list *models.VoicemailDistributionList, input *voicemailListInput) string {
+	if input.Name != "" {
+		list.Name = strings.TrimSpace(input.Name)
+	}
+	if input.Extension != "" {
+		list.Extension = strings.TrimSpace(input.Extension)
+	}
+	if input.Enabled != nil {
+		list.Enabled = *input.Enabled
+	}
+	if input.GreetingPath != "" {
+		list.GreetingPath = input.GreetingPath
+	}
+	if input.MaxMessageSecs > 0 {
+		list.MaxMessageSecs = input.MaxMessageSecs
+	}
+
+	if list.Name == "" || list.Extension == "" {
+		return "Name and extension are required"
+	}
+
+	// The list number must not shadow an extension, mailbox or other list
+	var taken int64
+	h.DB.Model(&models.Extension{}).Where("tenant_id = ? AND extension = ?", list.TenantID, list.Extension).Count(&taken)
+	if taken == 0 {
+		h.DB.Model(&models.VoicemailBox{}).Where("tenant_id = ? AND extension = ?", list.TenantID, list.Extension).Count(&taken)
+	}
+	if taken == 0 {
+		h.DB.Model(&models.VoicemailDistributionList{}).
+			Where("tenant_id = ? AND extension = ? AND id <> ?", list.TenantID, list.Extension, list.ID).Count(&taken)
+	}
+	if taken > 0 {
+		return fmt.Sprintf("Number %s is already in use", list.Extension)
+	}
+
+	if input.Members != nil {
+		members := uniqueExtensions(input.Members)
+		var boxes []string
+		h.DB.Model(&models.VoicemailBox{}).Where("tenant_id = ? AND extension IN ?", list.TenantID, members).Pluck("extension", &boxes)
+		var missing []string
+		for _, ext := range members {
+			if !containsString(boxes, ext) {
+				missing = append(missing, ext)
+			}
+		}
+		if len(missing) > 0 {
+			return "No voicemail box for: " + strings.Join(missing, ", ")
+		}
+		input.Members = members
+	}
+	return ""
+}
+
+// saveVoicemailList creates or updates the list and, when replaceMembers is
+// set, its member set
+func (h *Handler) saveVoicemailList(list *models.VoicemailDistributionList, members []string, replaceMembers bool) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if list.ID == 0 {
+			if err := tx.Omit("Members").Create(list).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Omit("Members").Save(list).Error; err != nil {
+			return err
+		}
+		if !replaceMembers {
+			return nil
+		}
+		if err := tx.Where("list_id = ?", list.ID).Delete(&models.VoicemailListMember{}).Error; err != nil {
+			return err
+		}
+		for _, ext := range members {
+			member := models.VoicemailListMember{TenantID: list.TenantID, ListID: list.ID, Extension: ext}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.flushXMLCache()
+	return h.DB.Preload("Members").First(list, list.ID).Error
+}
+
+// voicemailList loads the distribution list in :id for the tenant
+func (h *Handler) voicemailList(c *fiber.Ctx, fn string) (*models.VoicemailDistributionList, bool) {
+	var list models.VoicemailDistributionList
+	if err := h.DB.Preload("Members").
+		Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).
+		First(&list).Error; err != nil {
+		h.logWarn("API", fn+": Distribution list not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Distribution list not found"})
+		return nil, false
+	}
+	return &list, true
+}
+
+// =====================
+// Message Forwarding
+// =====================
+
+// ForwardVoicemailMessage copies a message to several extensions and
+// distribution lists. Send JSON {"targets": [...]}, or multipart with a
+// comma-separated "targets" field and an optional "intro" WAV played before
+// the message.
+func (h *Handler) ForwardVoicemailMessage(c *fiber.Ctx) error {
+	claims := middleware.GetClaims(c)
+	if claims == nil {
+		h.logWarn("API", "ForwardVoicemailMessage: Not authenticated", h.reqFields(c, nil))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Not authenticated"})
+	}
+
+	tenantID := middleware.GetTenantID(c)
+	var message models.VoicemailMessage
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), tenantID).First(&message).Error; err != nil {
+		h.logWarn("API", "ForwardVoicemailMessage: Message not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+	}
+
+	var targets []string
+	if form, err := c.MultipartForm(); err == nil {
+		for _, v := range form.Value["targets"] {
+			targets = append(targets, strings.Split(v, ",")...)
+		}
+	} else {
+		var input struct {
+			Targets []string `json:"targets"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+		}
+		targets = input.Targets
+	}
+	targets = uniqueExtensions(targets)
+	if len(targets) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "At least one target is required"})
+	}
+
+	boxes, missing := models.ResolveVoicemailTargets(h.DB, tenantID, targets)
+	if len(missing) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown mailboxes or lists: " + strings.Join(missing, ", ")})
+	}
+
+	// Optional spoken introduction, stored next to the message audio
+	introPath := ""
+	if file, err := c.FormFile("intro"); err == nil {
+		if !strings.EqualFold(filepath.Ext(file.Filename), ".wav") {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Introduction must be a WAV file"})
+		}
+		introPath = filepath.Join(filepath.Dir(message.FilePath), "intro_"+uuid.New().String()[:12]+".wav")
+		if err := c.SaveFile(file, introPath); err != nil {
+			h.logError("API", "ForwardVoicemailMessage: Failed to save intro", h.reqFields(c, map[string]interface{}{"error": err.Error()}))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save introduction"})
+		}
+	}
+
+	forwardedBy := ""
+	var user models.User
+	if err := h.DB.Select("extension").First(&user, claims.UserID).Error; err == nil {
+		forwardedBy = user.Extension
+	}
+
+	var copies []*models.VoicemailMessage
+	var names []string
+	for i := range boxes {
+		box := &boxes[i]
+		if box.ID == message.BoxID {
+			continue
+		}
+		cp, err := message.CopyTo(h.DB, box, forwardedBy, introPath)
+		if err != nil {
+			h.logError("API", "ForwardVoicemailMessage: Failed to copy message", h.reqFields(c, map[string]interface{}{"box": box.Extension, "error": err.Error()}))
+			continue
+		}
+		copies = append(copies, cp)
+		names = append(names, box.Extension)
+		h.sendVoicemailMWI(box)
+	}
+
+	if len(copies) == 0 {
+		if introPath != "" {
+			os.Remove(introPath)
+		}
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No mailbox to forward to"})
+	}
+	if introPath != "" {
+		h.Storage.StoreAsync(models.StorageCategoryVoicemail, tenantID, introPath, "audio/wav")
+	}
+	h.DB.Model(&message).Update("forwarded_to", strings.Join(names, ","))
+
+	h.logInfo("API", "ForwardVoicemailMessage: Forwarded to "+strings.Join(names, ","), h.reqFields(c, map[string]interface{}{"message_id": message.ID}))
+	return c.JSON(fiber.Map{"data": copies, "message": fmt.Sprintf("Forwarded to %d mailboxes", len(copies))})
+}
+
+// StreamVoicemailIntro streams the forwarder's introduction for a message
+func (h *Handler) StreamVoicemailIntro(c *fiber.Ctx) error {
+	var message models.VoicemailMessage
+	if err := h.DB.Where("id = ? AND tenant_id = ?", c.Params("id"), middleware.GetTenantID(c)).First(&message).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+	}
+	if message.IntroPath == "" {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Message has no introduction"})
+	}
+	return h.sendStoredFile(c, message.IntroPath, "")
+}
+
+// =====================
+// Helpers
+// =====================
+
+// voicemailBoxByExt loads the tenant's mailbox in :ext
+func (h *Handler) voicemailBoxByExt(c *fiber.Ctx, fn string) (*models.VoicemailBox, bool) {
+	var box models.VoicemailBox
+	if err := h.DB.Where("extension = ? AND tenant_id = ?", c.Params("ext"), middleware.GetTenantID(c)).First(&box).Error; err != nil {
+		h.logWarn("API", fn+": Voicemail box not found", h.reqFields(c, nil))
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Voicemail box not found"})
+		return nil, false
+	}
+	return &box, true
+}
+
+// sendVoicemailMWI refreshes the MWI lamps a mailbox affects
+func (h *Handler) sendVoicemailMWI(box *models.VoicemailBox) {
+	if h.ESLManager != nil {
+		h.ESLManager.SendVoicemailMWI(box)
+	}
+}
+
+// missingExtensions returns the numbers that aren't extensions of the tenant
+func (h *Handler) missingExtensions(tenantID uint, exts []string) []string {
+	if len(exts) == 0 {
+		return nil
+	}
+	var found []string
+	h.DB.Model(&models.Extension{}).Where("tenant_id = ? AND extension IN ?", tenantID, exts).Pluck("extension", &found)
+	var missing []string
+	for _, ext := range exts {
+		if !containsString(found, ext) {
+			missing = append(missing, ext)
+		}
+	}
+	return missing
+}
+
+// uniqueExtensions trims, drops empties and de-duplicates in order
+func uniqueExtensions(exts []string) []string {
+	var out []string
+	for _, ext := range exts {
+		if ext = strings.TrimSpace(ext); ext != "" && !containsString(out, ext) {
+			out = append(out, ext)
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"callsign/middleware"
+	"callsign/models"
+	"callsign/services/callcenter"
+
+	"github.com/gofiber/fiber/v2"
+	fiberws "github.com/gofiber/websocket/v2"
+)
+
+// =====================
+// Contact-Center Wallboard
+// =====================
+
+// GetQueueWallboard returns the live wallboard: waiting callers, longest
+// wait, SLA, ASA, abandon rate and agent counts per queue.
+func (h *Handler) GetQueueWallboard(c *fiber.Ctx) error {
+	if h.CallCenter == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Contact-center monitor not running"})
+	}
+	return c.JSON(fiber.Map{"data": h.CallCenter.Snapshot(middleware.GetTenantID(c))})
+}
+
+// GetQueueIntervalReport returns queue statistics in 15, 30 or 60 minute
+// intervals (?interval=30&start=2026-06-01&end=2026-06-01&queue_id=3).
+// Dates are inclusive days in the tenant timezone.
+func (h *Handler) GetQueueIntervalReport(c *fiber.Ctx) error {
+	tenantID := middleware.GetTenantID(c)
+
+	var tenant models.Tenant
+	if err := h.DB.First(&tenant, tenantID).Error; err != nil {
+		h.logWarn("REPORTS", "GetQueueIntervalReport: Tenant not found", h.reqFields(c, nil))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Tenant not found"})
+	}
+	loc := tenant.Location()
+
+	today := time.Now().In(loc).Format("2006-01-02")
+	from, err := time.ParseInLocation("2006-01-02", c.Query("start", today), loc)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start date, expected YYYY-MM-DD"})
+	}
+	to, err := time.ParseInLocation("2006-01-02", c.Query("end", c.Query("start", today)), loc)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end date, expected YYYY-MM-DD"})
+	}
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) || to.Sub(from) > 31*24*time.Hour {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Date range must be between 1 and 31 days"})
+	}
+
+	minutes, _ := strconv.Atoi(c.Query("interval", "30"))
+	queueID, _ := strconv.Atoi(c.Query("queue_id"))
+
+	report, err := callcenter.IntervalReport(h.DB, tenantID, uint(queueID), from, to, minutes, loc)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":     report,
+		"interval": minutes,
+		"start":    from,
+		"end":      to,
+	})
+}
+
+// ListQueueEvents returns the contact-center event log, newest first.
+// Filter with ?queue_id=, ?agent=, ?event=, ?member_uuid=, ?start=/?end= (RFC3339)
+func (h *Handler) ListQueueEvents(c *fiber.Ctx) error {
+	query := h.DB.Where("tenant_id = ?", middleware.GetTenantID(c))
+	if v := c.Query("queue_id"); v != "" {
+		query = query.Where("queue_id = ?", v)
+	}
+	if v := c.Query("agent"); v != "" {
+		query = query.Where("agent_name = ?", v)
+	}
+	if v := c.Query("event"); v != "" {
+		query = query.Where("event = ?", v)
+	}
+	if v := c.Query("member_uuid"); v != "" {
+		query = query.Where("member_uuid = ?", v)
+	}
+	if v, err := time.Parse(time.RFC3339, c.Query("start")); err == nil {
+		query = query.Where("created_at >= ?", v)
+	}
+	if v, err := time.Parse(time.RFC3339, c.Query("end")); err == nil {
+		query = query.Where("created_at < ?", v)
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "200"))
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+
+	var events []models.CallCenterEvent
+	if err := query.Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+		h.logError("REPORTS", "ListQueueEvents: Failed to fetch events", h.reqFields(c, nil))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch events"})
+	}
+
+	return c.JSON(fiber.Map{"data": events})
+}
+
+// WallboardWebSocket streams the tenant's wallboard. The full board is sent
+// on connect and again whenever a queue or agent changes.
+func (h *Handler) WallboardWebSocket(c *fiber.Ctx) error {
+	return fiberws.New(func(conn *fiberws.Conn) {
+		defer conn.Close()
+
+		claims, err := h.Auth.VerifyToken(conn.Query("token"))
+		if err != nil || claims.TenantID == nil {
+			conn.WriteJSON(fiber.Map{"error": "invalid token"})
+			return
+		}
+		if h.CallCenter == nil {
+			conn.WriteJSON(fiber.Map{"error": "Contact-center monitor not running"})
+			return
+		}
+
+		boards, unsubscribe := h.CallCenter.Subscribe(*claims.TenantID)
+		defer unsubscribe()
+
+		// Reader detects the client going away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(30 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case board := <-boards:
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteJSON(fiber.Map{"type": "wallboard", "data": board}); err != nil {
+					return
+				}
+			case <-ping.C:
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteMessage(fiberws.PingMessage, nil); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})(c)
+}
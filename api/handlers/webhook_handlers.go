@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"callsign/services/messaging"
+	"errors"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -21,9 +22,10 @@ func NewWebhookHandler(mgr *messaging.Manager) *WebhookHandler {
 
 // fiberToHTTPRequest converts a Fiber context into a standard *http.Request.
 // This is needed because provider webhook methods expect *http.Request
-// but Fiber uses fasthttp under the hood.
+// but Fiber uses fasthttp under the hood. The URL is absolute, as some
+// carriers sign the full URL they called.
 func fiberToHTTPRequest(c *fiber.Ctx) (*http.Request, error) {
-	req, err := http.NewRequest(c.Method(), c.OriginalURL(), bytes.NewReader(c.Body()))
+	req, err := http.NewRequest(c.Method(), c.BaseURL()+c.OriginalURL(), bytes.NewReader(c.Body()))
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +133,103 @@ func (h *WebhookHandler) TelnyxStatus(c *fiber.Ctx) error {
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
 
+// ProviderInbound handles inbound SMS/MMS webhooks for any carrier,
+// addressed by MessagingProvider ID. Carriers that post delivery events to
+// the same URL have them handled as status updates.
+func (h *WebhookHandler) ProviderInbound(c *fiber.Ctx) error {
+	providerID, provider, httpReq, ok := h.providerRequest(c)
+	if !ok {
+		return nil
+	}
+
+	inbound, err := provider.ParseInboundWebhook(httpReq)
+	if errors.Is(err, messaging.ErrStatusCallback) {
+		return h.handleStatus(c, providerID, provider, httpReq)
+	}
+	if err != nil {
+		log.WithError(err).WithField("provider_id", providerID).Error("Failed to parse inbound webhook")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to parse webhook"})
+	}
+
+	if err := h.MsgManager.RouteInboundSMS(inbound.To, inbound.From, inbound.Body, inbound.MediaURLs); err != nil {
+		log.WithError(err).Error("Failed to route inbound SMS")
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process inbound message"})
+	}
+
+	log.WithFields(log.Fields{
+		"provider_id": providerID,
+		"from":        inbound.From,
+		"to":          inbound.To,
+		"message_id":  inbound.MessageID,
+	}).Info("Inbound SMS processed")
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+// ProviderStatus handles delivery status webhooks for any carrier,
+// addressed by MessagingProvider ID
+func (h *WebhookHandler) ProviderStatus(c *fiber.Ctx) error {
+	providerID, provider, httpReq, ok := h.providerRequest(c)
+	if !ok {
+		return nil
+	}
+	return h.handleStatus(c, providerID, provider, httpReq)
+}
+
+// handleStatus parses and applies a delivery status webhook
+func (h *WebhookHandler) handleStatus(c *fiber.Ctx, providerID uint, provider messaging.SMSProvider, httpReq *http.Request) error {
+	status, err := provider.ParseStatusWebhook(httpReq)
+	if err != nil {
+		log.WithError(err).WithField("provider_id", providerID).Error("Failed to parse status webhook")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to parse webhook"})
+	}
+
+	if err := h.MsgManager.HandleStatusUpdate(status); err != nil {
+		log.WithError(err).Error("Failed to handle status update")
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+// providerRequest resolves the :id provider of a webhook, converts the
+// request and verifies its signature, writing an error response and
+// returning false on failure
+func (h *WebhookHandler) providerRequest(c *fiber.Ctx) (uint, messaging.SMSProvider, *http.Request, bool) {
+	if h.MsgManager == nil {
+		c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Messaging not configured"})
+		return 0, nil, nil, false
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid provider ID"})
+		return 0, nil, nil, false
+	}
+	providerID := uint(id)
+	provider, ok := h.MsgManager.GetProvider(providerID)
+	if !ok {
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Messaging provider not configured"})
+		return 0, nil, nil, false
+	}
+
+	httpReq, err := fiberToHTTPRequest(c)
+	if err != nil {
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to convert request"})
+		return 0, nil, nil, false
+	}
+
+	if err := h.MsgManager.VerifyWebhook(providerID, httpReq); err != nil {
+		if errors.Is(err, messaging.ErrNoWebhooks) {
+			c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Messaging provider does not use webhooks"})
+			return 0, nil, nil, false
+		}
+		log.WithError(err).WithField("provider_id", providerID).Warn("Webhook verification failed")
+		c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid webhook signature"})
+		return 0, nil, nil, false
+	}
+	return providerID, provider, httpReq, true
+}
+
 // getProviders returns all configured providers from the manager
 func (h *WebhookHandler) getProviders() []messaging.SMSProvider {
 	// Iterate through known provider IDs
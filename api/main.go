@@ -6,18 +6,30 @@ import (
 	"callsign/models"
 	"callsign/router"
 	"callsign/services/broadcast"
+	"callsign/services/callcenter"
 	"callsign/services/cdr"
+	"callsign/services/contactsync"
 	emailsvc "callsign/services/email"
 	"callsign/services/esl"
 	"callsign/services/esl/modules/blf"
+	broadcastmod "callsign/services/esl/modules/broadcast"
 	"callsign/services/esl/modules/callcontrol"
 	conferencemod "callsign/services/esl/modules/conference"
 	"callsign/services/esl/modules/featurecodes"
 	"callsign/services/esl/modules/ivr"
 	"callsign/services/esl/modules/queue"
 	"callsign/services/esl/modules/voicemail"
+	"callsign/services/esl/modules/wakeup"
 	"callsign/services/fax"
+	"callsign/services/hospitality"
+	"callsign/services/imap"
 	"callsign/services/logging"
+	"callsign/services/meeting"
+	"callsign/services/pms"
+	"callsign/services/provisioning"
+	"callsign/services/retention"
+	"callsign/services/storage"
+	"callsign/services/transcription"
 	"callsign/services/tts"
 	"os"
 	"os/signal"
@@ -84,6 +96,12 @@ func main() {
 		log.Warnf("Failed to seed default SIP profiles: %v", err)
 	}
 
+	// Install or refresh the built-in vendor provisioning template packs
+	if err := provisioning.SyncPacks(db); err != nil {
+		logManager.Warn("STARTUP", "Failed to sync provisioning template packs: "+err.Error(), nil)
+		log.Warnf("Failed to sync provisioning template packs: %v", err)
+	}
+
 	// Sync DB profiles to disk (sofia.conf loads profiles via X-PRE-PROCESS from sip_profiles/*.xml)
 	profileSyncer := freeswitch.NewProfileSyncer(cfg.SIPProfilesPath, db)
 	if err := profileSyncer.SyncProfilesToFiles(); err != nil {
@@ -91,20 +109,35 @@ func main() {
 		log.Warnf("Failed to sync SIP profiles to disk: %v", err)
 	}
 
+	// Initialize object storage for recordings, voicemail, fax and media.
+	// A misconfigured backend falls back to plain local disk.
+	storageManager, err := storage.NewManager(db, cfg)
+	if err != nil {
+		logManager.Error("STARTUP", "Storage backend init failed (files stay on local disk): "+err.Error(), nil)
+		log.Errorf("Storage backend init failed: %v", err)
+		storageManager = nil
+	} else {
+		logManager.Info("STARTUP", "Storage backend: "+storageManager.BackendName(), nil)
+	}
+
 	// Initialize ESL Manager
 	eslManager := esl.NewManager(cfg, db)
+	eslManager.SetStorage(storageManager)
 
 	// Register ESL modules — these handle incoming calls from FreeSWITCH
 	// via outbound ESL sockets. Each module listens on its own loopback address.
 	eslManager.RegisterModule(callcontrol.New())
 	eslManager.RegisterModule(voicemail.New())
-	eslManager.RegisterModule(queue.New())
+	queueService := queue.New()
+	eslManager.RegisterModule(queueService)
 	eslManager.RegisterModule(ivr.New())
 
 	// Conference & feature codes modules need DB access for live-control APIs
 	confService := conferencemod.New(db)
 	eslManager.RegisterModule(confService)
 	eslManager.RegisterModule(featurecodes.New(db))
+	eslManager.RegisterModule(broadcastmod.New(db))
+	eslManager.RegisterModule(wakeup.New())
 
 	// Initialize BLF/Presence service — handles PRESENCE_PROBE events from FreeSWITCH
 	// to update BLF lamp states (DND, forward, voicemail, call flow, agent, extension presence)
@@ -154,6 +187,7 @@ func main() {
 		logManager.Warn("STARTUP", "Failed to init TTS cache (inline TTS will be used): "+err.Error(), nil)
 		log.Warnf("TTS cache init failed: %v", err)
 	} else {
+		ttsService.Storage = storageManager
 		eslManager.TTS = ttsService
 		// Warm the cache with system phrases in background
 		go ttsService.Init()
@@ -173,6 +207,7 @@ func main() {
 
 	// Initialize fax manager (routing, queue processing, retry strategy)
 	faxManager := fax.NewManager(db, cfg, logManager)
+	faxManager.Storage = storageManager
 	go func() {
 		if err := faxManager.Start(); err != nil {
 			logManager.Error("FAX", "Failed to start fax manager: "+err.Error(), nil)
@@ -214,10 +249,82 @@ func main() {
 	r.Handler.SetLogManager(logManager)
 	r.Handler.SetClickHouse(chClient)
 	r.Handler.SetEmailService(emailService)
+	r.Handler.Fraud.SetEmailService(emailService)
+	r.Handler.SetStorage(storageManager)
 
 	// Initialize broadcast campaign worker
 	broadcastWorker := broadcast.NewBroadcastWorker(db, eslManager)
 	r.Handler.SetBroadcastWorker(broadcastWorker)
+	broadcastWorker.Start(30 * time.Second)
+
+	// Place accepted queue callbacks as agents free up
+	queueService.StartCallbacks(15 * time.Second)
+
+	// Record contact-center events and feed the live queue wallboard
+	callCenterMonitor := callcenter.NewMonitor(db)
+	r.Handler.SetCallCenterMonitor(callCenterMonitor)
+	callCenterMonitor.Start(eslManager, time.Second)
+
+	// Initialize hotel PMS connector and wake-up call scheduler; wake-up
+	// results are reported back to the PMS
+	stays := hospitality.NewStayService(db, storageManager, eslManager, r.Handler.XMLCache)
+	pmsConnector := pms.NewConnector(db, stays)
+	r.Handler.SetPMSConnector(pmsConnector)
+	pmsConnector.Start(30 * time.Second)
+
+	wakeupScheduler := hospitality.NewWakeupScheduler(db, eslManager)
+	wakeupScheduler.OnEvent(pmsConnector.WakeupResult)
+	wakeupScheduler.Start(15 * time.Second)
+
+	// Send scheduled conference invites and reminders and dial attendees in
+	meetingScheduler := meeting.NewScheduler(db, eslManager, emailService)
+	meetingScheduler.Start(30 * time.Second)
+
+	// Pull contact lists from CRM sources on their sync interval
+	contactSyncer := contactsync.NewSyncer(db, cfg)
+	r.Handler.SetContactSyncer(contactSyncer)
+	contactSyncer.Start(time.Minute)
+
+	// Initialize speech-to-text worker for recordings and voicemail
+	var transcriber *transcription.Worker
+	if cfg.TranscriptionEnabled {
+		transcriber = transcription.NewWorker(db, cfg)
+		transcriber.SetWSHub(r.WSHub)
+		transcriber.SetStorage(storageManager)
+		transcriber.OnVoicemailDone(func(messageID uint) {
+			voicemail.NotifyTranscribed(db, emailService, storageManager, messageID)
+		})
+		transcriber.Start()
+		eslManager.SetTranscriber(transcriber)
+		r.Handler.SetTranscriptionWorker(transcriber)
+		logManager.Info("STARTUP", "Transcription worker started (default endpoint: "+cfg.WhisperURL+")", nil)
+	}
+
+	// Serve voicemail boxes over IMAP for mail and visual voicemail clients
+	var imapServer *imap.Server
+	if cfg.IMAPEnabled {
+		if imapServer, err = imap.NewServer(db, cfg); err == nil {
+			imapServer.SetStorage(storageManager)
+			imapServer.SetMWI(eslManager)
+			err = imapServer.Start()
+		}
+		if err != nil {
+			logManager.Error("STARTUP", "IMAP server not started: "+err.Error(), nil)
+			imapServer = nil
+		}
+	}
+
+	// Start recording retention (expiry, archival, quota rotation)
+	retentionJob := retention.NewJob(db, cfg)
+	retentionJob.SetStorage(storageManager)
+	r.Handler.SetRetentionJob(retentionJob)
+	retentionJob.StartPeriodic(time.Duration(cfg.RecordingRetentionMinutes) * time.Minute)
+
+	// Upload files written before the backend was configured and re-verify checksums
+	if storageManager.Remote() {
+		storage.NewMigrator(storageManager, db, cfg.MediaBasePath).
+			Start(time.Duration(cfg.StorageMigrateMinutes) * time.Minute)
+	}
 
 	// Wire fax manager and conference service into their handlers
 	r.SetFaxManager(faxManager)
@@ -235,6 +342,14 @@ func main() {
 		<-quit
 		logManager.Info("SHUTDOWN", "Server shutting down...", nil)
 		eslManager.Stop()
+		pmsConnector.Stop()
+		contactSyncer.Stop()
+		if transcriber != nil {
+			transcriber.Stop()
+		}
+		if imapServer != nil {
+			imapServer.Stop()
+		}
 		chClient.Close()
 		logManager.Close() // Ensure logs are flushed to Loki
 		os.Exit(0)
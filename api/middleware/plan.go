@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"callsign/models"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PlanMiddleware enforces TenantProfile resource limits and feature flags.
+// Tenants without a profile are unrestricted.
+type PlanMiddleware struct {
+	DB *gorm.DB
+}
+
+// NewPlanMiddleware creates a new plan enforcement middleware instance
+func NewPlanMiddleware(db *gorm.DB) *PlanMiddleware {
+	return &PlanMiddleware{DB: db}
+}
+
+// RequireFeature rejects requests for tenants whose profile disables the feature
+func (p *PlanMiddleware) RequireFeature(feature models.TenantFeature) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenantID := GetScopedTenantID(c)
+		if tenantID == 0 {
+			return c.Next()
+		}
+
+		profile := models.LoadTenantProfile(p.DB, tenantID)
+		if profile != nil && !profile.HasFeature(feature) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error":   "Feature not included in your plan",
+				"code":    "feature_disabled",
+				"feature": feature,
+				"profile": profile.Name,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// EnforceLimit rejects create requests once the tenant has reached the
+// profile limit for the resource. It is attached to each resource's create
+// route; requests other than POST pass through.
+func (p *PlanMiddleware) EnforceLimit(limitName string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+		tenantID := GetScopedTenantID(c)
+		if tenantID == 0 {
+			return c.Next()
+		}
+
+		profile := models.LoadTenantProfile(p.DB, tenantID)
+		if profile == nil || profile.Limit(limitName) < 0 {
+			return c.Next()
+		}
+
+		count, err := models.CountTenantResource(p.DB, tenantID, limitName)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check plan limits"})
+		}
+		if !profile.CheckLimit(limitName, int(count)) {
+			return c.Status(http.StatusPaymentRequired).JSON(fiber.Map{
+				"error":    "Plan limit reached",
+				"code":     "limit_exceeded",
+				"resource": limitName,
+				"limit":    profile.Limit(limitName),
+				"current":  count,
+				"profile":  profile.Name,
+			})
+		}
+		return c.Next()
+	}
+}
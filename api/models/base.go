@@ -71,16 +71,23 @@ func AutoMigrate(db *gorm.DB) error {
 		// Voicemail models
 		&VoicemailBox{},
 		&VoicemailMessage{},
+		&VoicemailBoxMember{},
+		&VoicemailDistributionList{},
+		&VoicemailListMember{},
 
 		// Queue models
 		&Queue{},
 		&QueueAgent{},
+		&QueueCallback{},
+		&CallCenterEvent{},
 
 		// Conference models
 		&Conference{},
 		&ConferenceMember{},
 		&ConferenceSession{},
 		&ConferenceParticipant{},
+		&ConferenceMeeting{},
+		&ConferenceMeetingAttendee{},
 
 		// Ring group models
 		&RingGroup{},
@@ -105,7 +112,10 @@ func AutoMigrate(db *gorm.DB) error {
 		&Message{},
 		&MessageMedia{},
 		&MessagingProvider{},
+		&MessagingBrand{},
+		&MessagingCampaign{},
 		&MessagingNumber{},
+		&MessagingConsent{},
 		&Chatplan{},
 		&Phrase{},
 		&Sound{},
@@ -120,11 +130,16 @@ func AutoMigrate(db *gorm.DB) error {
 		&ChatMessage{},
 		&ChatAttachment{},
 		&ContactWebhook{},
+		&ContactSyncRun{},
 		&ChatReadReceipt{},
 
 		// Audit & CDR
 		&AuditLog{},
 		&CallRecord{},
+		&RateDeck{},
+		&RateDeckEntry{},
+		&FraudPolicy{},
+		&FraudEvent{},
 		&BannedIP{},
 		&PageGroup{},
 		&PageGroupDestination{},
@@ -140,6 +155,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&DeviceManufacturer{},
 		&DeviceProfile{},
 		&Firmware{},
+		&DeviceProvisionLog{},
 		&ClientRegistration{},
 
 		// Call Recording & Transcription
@@ -152,6 +168,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&TranscriptionConfig{},
 		&RecordingConfig{},
 		&MediaFile{},
+		&StorageObject{},
 
 		// AI Greeting Scripts
 		&GreetingScript{},
@@ -179,6 +196,14 @@ func AutoMigrate(db *gorm.DB) error {
 
 		// Call Broadcast
 		&BroadcastCampaign{},
+		&BroadcastRecipient{},
+		&BroadcastResult{},
+
+		// Hospitality
+		&HotelRoom{},
+		&HotelRoomEvent{},
+		&PMSInterface{},
+		&PMSPosting{},
 
 		// Bridges
 		&Bridge{},
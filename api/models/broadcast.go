@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -19,24 +20,47 @@ const (
 	BroadcastStatusCancelled BroadcastStatus = "cancelled"
 )
 
+// BroadcastType selects what happens when a broadcast call is answered
+type BroadcastType string
+
+const (
+	BroadcastTypeMessage  BroadcastType = "message"  // Play the recording
+	BroadcastTypeSurvey   BroadcastType = "survey"   // Play the recording and collect a DTMF answer
+	BroadcastTypeTransfer BroadcastType = "transfer" // "Press 1 to connect" transfer to an extension/queue
+)
+
 // BroadcastCampaign represents a call broadcast campaign
 type BroadcastCampaign struct {
-	ID              uint            `json:"id" gorm:"primaryKey"`
-	TenantID        uint            `json:"tenant_id" gorm:"index"`
-	Name            string          `json:"name"`
-	Description     string          `json:"description,omitempty"`
-	Status          BroadcastStatus `json:"status" gorm:"default:draft"`
-	RecordingID     *uint           `json:"recording_id,omitempty"`   // Link to audio library
-	RecordingPath   string          `json:"recording_path,omitempty"` // Direct file path
-	CallerID        string          `json:"caller_id"`
-	ConcurrentLimit int             `json:"concurrent_limit" gorm:"default:5"`
-	Timeout         int             `json:"timeout" gorm:"default:30"`       // Ring timeout per call in seconds
-	RetryAttempts   int             `json:"retry_attempts" gorm:"default:0"` // Number of retries on failure
-	RetryDelay      int             `json:"retry_delay" gorm:"default:300"`  // Delay between retries in seconds
-	Recipients      pq.StringArray  `json:"recipients" gorm:"type:text[]"`   // List of phone numbers
-	ScheduledAt     *time.Time      `json:"scheduled_at,omitempty"`
-	StartedAt       *time.Time      `json:"started_at,omitempty"`
-	CompletedAt     *time.Time      `json:"completed_at,omitempty"`
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	TenantID      uint            `json:"tenant_id" gorm:"index"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description,omitempty"`
+	Status        BroadcastStatus `json:"status" gorm:"default:draft"`
+	RecordingID   *uint           `json:"recording_id,omitempty"`   // Link to audio library
+	RecordingPath string          `json:"recording_path,omitempty"` // Direct file path
+	Type          BroadcastType   `json:"type" gorm:"default:message"`
+
+	// Interactive options
+	SurveyMaxDigits     int    `json:"survey_max_digits" gorm:"default:1"`
+	TransferDigit       string `json:"transfer_digit" gorm:"default:1"`
+	TransferDestination string `json:"transfer_destination,omitempty"` // Extension, queue or ring group number
+
+	// Answering machine detection
+	DetectMachine     bool   `json:"detect_machine" gorm:"default:false"`
+	VoicemailDropPath string `json:"voicemail_drop_path,omitempty"` // Played to machines after the beep (empty = hang up)
+
+	CallerID        string         `json:"caller_id"`
+	ConcurrentLimit int            `json:"concurrent_limit" gorm:"default:5"`
+	Timeout         int            `json:"timeout" gorm:"default:30"`       // Ring timeout per call in seconds
+	RetryAttempts   int            `json:"retry_attempts" gorm:"default:0"` // Number of retries on failure
+	RetryDelay      int            `json:"retry_delay" gorm:"default:300"`  // Delay between retries in seconds
+	Recipients      pq.StringArray `json:"recipients" gorm:"type:text[]"`   // List of phone numbers
+	ScheduledAt     *time.Time     `json:"scheduled_at,omitempty"`          // Auto-start time (status "scheduled")
+	Timezone        string         `json:"timezone,omitempty"`              // Default recipient timezone (empty = tenant timezone)
+	CallWindowStart string         `json:"call_window_start,omitempty"`     // Local calling hours "HH:MM" (empty = any time)
+	CallWindowEnd   string         `json:"call_window_end,omitempty"`
+	StartedAt       *time.Time     `json:"started_at,omitempty"`
+	CompletedAt     *time.Time     `json:"completed_at,omitempty"`
 
 	// Statistics (updated as campaign runs)
 	TotalCalls    int `json:"total_calls" gorm:"default:0"`
@@ -45,6 +69,9 @@ type BroadcastCampaign struct {
 	BusyCalls     int `json:"busy_calls" gorm:"default:0"`
 	NoAnswerCalls int `json:"no_answer_calls" gorm:"default:0"`
 
+	// Recipients that reached a final state (no further attempts)
+	CompletedRecipients int `json:"completed_recipients" gorm:"default:0"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -52,8 +79,113 @@ type BroadcastCampaign struct {
 
 // Progress returns the campaign completion percentage
 func (c *BroadcastCampaign) Progress() int {
-	if c.TotalCalls == 0 || len(c.Recipients) == 0 {
+	if c.CompletedRecipients == 0 || len(c.Recipients) == 0 {
 		return 0
 	}
-	return int(float64(c.TotalCalls) / float64(len(c.Recipients)) * 100)
+	return min(100, int(float64(c.CompletedRecipients)/float64(len(c.Recipients))*100))
+}
+
+// RecipientsAppended reports whether next keeps every entry of prev at its
+// position and only adds numbers at the end. Dialing state is tracked by
+// position, so a started campaign's recipients may only grow this way.
+func RecipientsAppended(prev, next []string) bool {
+	if len(next) < len(prev) {
+		return false
+	}
+	for i := range prev {
+		if strings.TrimSpace(prev[i]) != strings.TrimSpace(next[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// BroadcastRecipientStatus is the dialing state of a single campaign recipient
+type BroadcastRecipientStatus string
+
+const (
+	BroadcastRecipientPending  BroadcastRecipientStatus = "pending"
+	BroadcastRecipientCalling  BroadcastRecipientStatus = "calling"
+	BroadcastRecipientRetry    BroadcastRecipientStatus = "retry" // Waiting for NextAttemptAt
+	BroadcastRecipientAnswered BroadcastRecipientStatus = "answered"
+	BroadcastRecipientBusy     BroadcastRecipientStatus = "busy"
+	BroadcastRecipientNoAnswer BroadcastRecipientStatus = "no_answer"
+	BroadcastRecipientFailed   BroadcastRecipientStatus = "failed"
+)
+
+// BroadcastRecipient persists per-recipient dialing state so a campaign can
+// be paused, retried and resumed after a restart without starting over
+type BroadcastRecipient struct {
+	ID            uint                     `json:"id" gorm:"primaryKey"`
+	CampaignID    uint                     `json:"campaign_id" gorm:"index;not null"`
+	TenantID      uint                     `json:"tenant_id" gorm:"index"`
+	Position      int                      `json:"position"` // Index in the campaign's recipient list
+	PhoneNumber   string                   `json:"phone_number"`
+	Timezone      string                   `json:"timezone,omitempty"` // Overrides the campaign timezone
+	Status        BroadcastRecipientStatus `json:"status" gorm:"index;default:pending"`
+	Attempts      int                      `json:"attempts" gorm:"default:0"`
+	NextAttemptAt *time.Time               `json:"next_attempt_at,omitempty" gorm:"index"`
+	LastAttemptAt *time.Time               `json:"last_attempt_at,omitempty"`
+	CallUUID      string                   `json:"call_uuid,omitempty"`
+	HangupCause   string                   `json:"hangup_cause,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Active reports whether the recipient may still be dialed
+func (r *BroadcastRecipient) Active() bool {
+	switch r.Status {
+	case BroadcastRecipientPending, BroadcastRecipientCalling, BroadcastRecipientRetry:
+		return true
+	}
+	return false
+}
+
+// BroadcastOutcome is the result of a single broadcast call attempt
+type BroadcastOutcome string
+
+const (
+	BroadcastOutcomeHuman    BroadcastOutcome = "human"
+	BroadcastOutcomeMachine  BroadcastOutcome = "machine"
+	BroadcastOutcomeBusy     BroadcastOutcome = "busy"
+	BroadcastOutcomeNoAnswer BroadcastOutcome = "no_answer"
+	BroadcastOutcomeFailed   BroadcastOutcome = "failed"
+)
+
+// BroadcastResult records the outcome of one call attempt to a recipient:
+// who answered, digits pressed and whether the call was transferred
+type BroadcastResult struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	CampaignID  uint   `json:"campaign_id" gorm:"index;not null"`
+	RecipientID uint   `json:"recipient_id" gorm:"index"`
+	TenantID    uint   `json:"tenant_id" gorm:"index"`
+	CallUUID    string `json:"call_uuid" gorm:"uniqueIndex"`
+	PhoneNumber string `json:"phone_number"`
+	Attempt     int    `json:"attempt"`
+
+	Outcome          BroadcastOutcome `json:"outcome" gorm:"index"`
+	Digits           string           `json:"digits,omitempty"`
+	Transferred      bool             `json:"transferred" gorm:"default:false"`
+	VoicemailDropped bool             `json:"voicemail_dropped" gorm:"default:false"`
+	HangupCause      string           `json:"hangup_cause,omitempty"`
+	AnsweredAt       *time.Time       `json:"answered_at,omitempty"`
+	Duration         int              `json:"duration"` // Billed seconds
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecordBroadcastResult creates the result row for base.CallUUID if needed
+// and applies updates. Both the call handler and the hangup tracker write to
+// the same row.
+func RecordBroadcastResult(db *gorm.DB, base BroadcastResult, updates map[string]interface{}) error {
+	row := base
+	if err := db.Where("call_uuid = ?", base.CallUUID).Attrs(base).FirstOrCreate(&row).Error; err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return db.Model(&row).Updates(updates).Error
 }
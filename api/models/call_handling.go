@@ -44,6 +44,15 @@ type CallHandlingRule struct {
 	ActionParams CallHandlingActionParams `json:"action_params" gorm:"type:jsonb;default:'{}'"` // Additional settings
 }
 
+// Call handling action types
+const (
+	CallActionForward     = "forward"
+	CallActionVoicemail   = "voicemail"
+	CallActionFindMe      = "find_me"
+	CallActionReject      = "reject"
+	CallActionRingDevices = "ring_devices"
+)
+
 // CallHandlingEvents defines when a rule should be evaluated
 type CallHandlingEvents struct {
 	OnPhone     bool `json:"on_phone"`    // User is currently on another call (busy)
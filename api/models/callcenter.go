@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// CallCenterEventType is a contact-center transition derived from
+// mod_callcenter callcenter::info events
+type CallCenterEventType string
+
+const (
+	CallCenterJoin        CallCenterEventType = "join"         // caller entered the queue
+	CallCenterOffer       CallCenterEventType = "offer"        // caller offered to an agent
+	CallCenterOfferFailed CallCenterEventType = "offer_failed" // agent did not take the call
+	CallCenterAnswer      CallCenterEventType = "answer"       // caller bridged to an agent
+	CallCenterComplete    CallCenterEventType = "complete"     // agent bridge ended
+	CallCenterLeave       CallCenterEventType = "leave"        // caller left the queue (see Outcome)
+	CallCenterAgentStatus CallCenterEventType = "agent_status" // agent status changed (Available, On Break, ...)
+	CallCenterAgentState  CallCenterEventType = "agent_state"  // agent state changed (Waiting, In a queue call, ...)
+)
+
+// Outcomes of a CallCenterLeave event
+const (
+	CallCenterOutcomeAnswered  = "answered"  // served by an agent
+	CallCenterOutcomeAbandoned = "abandoned" // caller hung up while waiting
+	CallCenterOutcomeTimeout   = "timeout"   // max wait time (or no agents) reached
+	CallCenterOutcomeExited    = "exited"    // caller left via an exit key or break-out
+)
+
+// CallCenterEvent is one persisted contact-center transition. Leave events
+// carry the whole caller journey (wait, talk, outcome) so interval reports
+// only need those rows.
+type CallCenterEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+
+	TenantID uint                `json:"tenant_id" gorm:"index;not null"`
+	QueueID  uint                `json:"queue_id" gorm:"index"`
+	Queue    string              `json:"queue"` // mod_callcenter queue name (name@domain)
+	Event    CallCenterEventType `json:"event" gorm:"index"`
+
+	// Caller
+	MemberUUID   string `json:"member_uuid,omitempty" gorm:"index"`
+	CallerNumber string `json:"caller_number,omitempty"`
+	CallerName   string `json:"caller_name,omitempty"`
+
+	// Agent
+	AgentName   string `json:"agent_name,omitempty" gorm:"index"`
+	AgentStatus string `json:"agent_status,omitempty"`
+	AgentState  string `json:"agent_state,omitempty"`
+
+	// Journey
+	Outcome     string     `json:"outcome,omitempty"`
+	Cause       string     `json:"cause,omitempty"`
+	JoinedAt    *time.Time `json:"joined_at,omitempty"`
+	WaitSeconds int        `json:"wait_seconds"`
+	TalkSeconds int        `json:"talk_seconds"`
+}
@@ -75,6 +75,21 @@ type CallRecord struct {
 	Cost     float64 `json:"cost" gorm:"type:decimal(10,4)"`
 	Currency string  `json:"currency" gorm:"default:'USD'"`
 
+	// Rating details, filled by the rating engine for calls that reached a
+	// carrier gateway. Cost/Rate are what the tenant is billed; the carrier
+	// columns are what the gateway's deck says the call cost us.
+	RateDeckID      *uint      `json:"rate_deck_id,omitempty" gorm:"index"`
+	RatePrefix      string     `json:"rate_prefix,omitempty"`
+	BilledSec       int        `json:"billed_sec"` // BillableSec rounded up to the deck's increments
+	CarrierDeckID   *uint      `json:"carrier_deck_id,omitempty" gorm:"index"`
+	CarrierRate     float64    `json:"carrier_rate" gorm:"type:decimal(10,6)"`
+	CarrierCost     float64    `json:"carrier_cost" gorm:"type:decimal(10,4)"`
+	CarrierCurrency string     `json:"carrier_currency,omitempty"`
+	RatedAt         *time.Time `json:"rated_at,omitempty"`
+	// RerateSyncPending marks records re-rated after they were copied to
+	// ClickHouse; the sync job pushes their new rating columns
+	RerateSyncPending bool `json:"-" gorm:"default:false;index"`
+
 	// Extension info
 	ExtensionID uint   `json:"extension_id,omitempty"`
 	Extension   string `json:"extension"`
@@ -88,8 +88,11 @@ type ChatQueue struct {
 	Strategy string `json:"strategy" gorm:"default:'round-robin'"` // round-robin, least-busy, broadcast
 
 	// SLA settings
-	MaxWaitSeconds   int `json:"max_wait_seconds" gorm:"default:300"`
-	TargetResponseMs int `json:"target_response_ms" gorm:"default:60000"`
+	MaxWaitSeconds   int `json:"max_wait_seconds" gorm:"default:300"`     // Waiting longer than this sends the away message
+	TargetResponseMs int `json:"target_response_ms" gorm:"default:60000"` // First-response target, from entering the queue
+
+	// An assigned agent who hasn't replied within this loses the thread to the queue
+	AgentTimeoutSeconds int `json:"agent_timeout_seconds" gorm:"default:120"`
 
 	// Agents
 	Agents []ChatQueueAgent `json:"agents,omitempty" gorm:"foreignKey:QueueID"`
@@ -99,11 +102,26 @@ type ChatQueue struct {
 	AwayMessage    string `json:"away_message"`
 
 	// Hours
-	BusinessHoursID *uint `json:"business_hours_id" gorm:"index"`
+	BusinessHoursID *uint `json:"business_hours_id" gorm:"index"` // TimeCondition; threads are only assigned while it matches
 
 	Enabled bool `json:"enabled" gorm:"default:true"`
 }
 
+// Chat queue routing strategies
+const (
+	ChatStrategyRoundRobin = "round-robin"
+	ChatStrategyLeastBusy  = "least-busy"
+	ChatStrategyBroadcast  = "broadcast"
+)
+
+// Chat queue agent statuses
+const (
+	ChatAgentAvailable = "available"
+	ChatAgentBusy      = "busy"
+	ChatAgentAway      = "away"
+	ChatAgentOffline   = "offline"
+)
+
 func (q *ChatQueue) BeforeCreate(tx *gorm.DB) error {
 	q.UUID = uuid.New()
 	return nil
@@ -153,8 +171,15 @@ type ChatThread struct {
 	GroupSMSNumber string `json:"group_sms_number,omitempty"`
 
 	// For queue-based threads
-	QueueID    *uint `json:"queue_id,omitempty" gorm:"index"`
-	AssignedTo *uint `json:"assigned_to,omitempty" gorm:"index"` // Extension ID
+	QueueID         *uint      `json:"queue_id,omitempty" gorm:"index"`
+	AssignedTo      *uint      `json:"assigned_to,omitempty" gorm:"index"` // Extension ID
+	QueuedAt        *time.Time `json:"queued_at,omitempty"`
+	AssignedAt      *time.Time `json:"assigned_at,omitempty"`
+	LastAgentID     *uint      `json:"last_agent_id,omitempty"` // Agent who last timed out on the thread, passed over while others are free
+	AwaySentAt      *time.Time `json:"away_sent_at,omitempty"`
+	FirstResponseAt *time.Time `json:"first_response_at,omitempty"`
+	FirstResponseMs int64      `json:"first_response_ms,omitempty"`
+	SLABreached     bool       `json:"sla_breached" gorm:"default:false"`
 
 	// Contact link (for external conversations)
 	ContactID *uint `json:"contact_id,omitempty" gorm:"index"`
@@ -287,6 +312,9 @@ type Contact struct {
 	ExternalSource string `json:"external_source"`                // patient-portal, crm, etc.
 	ExternalData   string `json:"external_data" gorm:"type:text"` // JSON blob
 
+	// ContactWebhook whose pulls created or last updated the contact
+	ContactWebhookID *uint `json:"contact_webhook_id,omitempty" gorm:"index"`
+
 	// Webhook population
 	LastSyncAt  *time.Time `json:"last_sync_at"`
 	SyncEnabled bool       `json:"sync_enabled" gorm:"default:true"`
@@ -357,10 +385,27 @@ type ContactWebhook struct {
 	// Field mapping (JSON)
 	FieldMapping string `json:"field_mapping" gorm:"type:text"`
 
+	// Full-list sync: ListURL returns every contact, a page at a time
+	ListURL         string `json:"list_url"`
+	ListPath        string `json:"list_path"`                             // Dotted path to the contact array; empty tries data, results, contacts, items, records
+	ExternalIDField string `json:"external_id_field" gorm:"default:'id'"` // Dotted path to each record's ID
+	Pagination      string `json:"pagination" gorm:"default:'none'"`      // none, page, offset, cursor, link
+	PageParam       string `json:"page_param"`                            // Query parameter carrying the page, offset or cursor
+	PageSizeParam   string `json:"page_size_param"`
+	PageSize        int    `json:"page_size" gorm:"default:100"`
+	NextPath        string `json:"next_path"` // Dotted path to the next cursor (cursor) or page URL (link; default Link header)
+
+	// Contacts edited locally since their last sync keep their edits (local)
+	// or take the source's values (remote). Contacts the source stops
+	// returning are archived, deleted or left alone.
+	ConflictPolicy string `json:"conflict_policy" gorm:"default:'remote'"` // remote, local
+	DeletePolicy   string `json:"delete_policy" gorm:"default:'archive'"`  // archive, delete, ignore
+
 	// Sync settings
-	SyncInterval   int        `json:"sync_interval" gorm:"default:3600"` // seconds
+	SyncInterval   int        `json:"sync_interval" gorm:"default:3600"` // seconds; 0 syncs on demand only
 	LastSyncAt     *time.Time `json:"last_sync_at"`
-	LastSyncStatus string     `json:"last_sync_status"`
+	LastSyncStatus string     `json:"last_sync_status"` // running, success, partial, failed
+	LastSyncError  string     `json:"last_sync_error"`
 
 	Enabled bool `json:"enabled" gorm:"default:true"`
 }
@@ -370,6 +415,52 @@ func (w *ContactWebhook) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Contact sync run statuses
+const (
+	ContactSyncRunning = "running"
+	ContactSyncSuccess = "success"
+	ContactSyncPartial = "partial" // Finished, but some records failed
+	ContactSyncFailed  = "failed"
+)
+
+// Contact sync conflict and delete policies
+const (
+	ContactConflictRemote = "remote"
+	ContactConflictLocal  = "local"
+
+	ContactDeleteArchive = "archive"
+	ContactDeleteDelete  = "delete"
+	ContactDeleteIgnore  = "ignore"
+)
+
+// ContactSyncRun records one full pull of a ContactWebhook source
+type ContactSyncRun struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID  uint   `json:"tenant_id" gorm:"index;not null"`
+	WebhookID uint   `json:"webhook_id" gorm:"index;not null"`
+	Trigger   string `json:"trigger"` // schedule, manual
+	Status    string `json:"status"`  // running, success, partial, failed
+
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+
+	// Counts
+	Pages     int `json:"pages"`
+	Fetched   int `json:"fetched"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Conflicts int `json:"conflicts"` // Records changed both locally and at the source
+	Skipped   int `json:"skipped"`   // Sync disabled on the contact, or no external ID
+	Deleted   int `json:"deleted"`   // Archived or deleted as the source no longer returns them
+	Errors    int `json:"errors"`
+
+	Error        string `json:"error"`                          // Why the run failed
+	ErrorDetails string `json:"error_details" gorm:"type:text"` // JSON array of per-record errors (capped)
+}
+
 // ChatReadReceipt tracks who has read messages
 type ChatReadReceipt struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
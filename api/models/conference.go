@@ -136,6 +136,7 @@ type ConferenceSession struct {
 	ConferenceID   uint   `json:"conference_id" gorm:"index;not null"`
 	ConferenceName string `json:"conference_name"` // FS conference name
 	TenantID       uint   `json:"tenant_id" gorm:"index;not null"`
+	MeetingID      *uint  `json:"meeting_id,omitempty" gorm:"index"` // Scheduled meeting the session ran for
 
 	// Session times
 	StartTime time.Time  `json:"start_time" gorm:"index"`
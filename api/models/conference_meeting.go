@@ -0,0 +1,161 @@
+package models
+
+import (
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConferenceMeetingStatus is the lifecycle state of a scheduled meeting
+type ConferenceMeetingStatus string
+
+const (
+	MeetingScheduled  ConferenceMeetingStatus = "scheduled"
+	MeetingInProgress ConferenceMeetingStatus = "in_progress"
+	MeetingCompleted  ConferenceMeetingStatus = "completed"
+	MeetingCancelled  ConferenceMeetingStatus = "cancelled"
+)
+
+// Attendee invite states. Attendees without an email address have none.
+const (
+	MeetingInvitePending       = "pending"        // Invite (or update) to send
+	MeetingInviteSent          = "sent"           // Latest invite delivered
+	MeetingInviteCancelPending = "cancel_pending" // Cancellation to send
+	MeetingInviteCancelled     = "cancelled"      // Cancellation delivered
+	MeetingInviteFailed        = "failed"         // Last send failed
+)
+
+// Attendee dial-out states
+const (
+	MeetingDialPending  = "pending"  // Waiting for NextDialAt
+	MeetingDialDialing  = "dialing"  // Call in progress
+	MeetingDialAnswered = "answered" // Joined the room
+	MeetingDialRetry    = "retry"    // Unanswered, will be dialed again
+	MeetingDialFailed   = "failed"   // Attempts exhausted
+)
+
+// MeetingEarlyJoin is how long before its start a meeting's PINs open the room
+const MeetingEarlyJoin = 10 * time.Minute
+
+// ConferenceMeeting is a scheduled booking of a conference room. Each
+// meeting gets its own one-time PINs, valid only in its window, which
+// replace the room's static PINs while it runs.
+type ConferenceMeeting struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UUID      uuid.UUID      `json:"uuid" gorm:"type:uuid;uniqueIndex;not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Ownership
+	TenantID     uint `json:"tenant_id" gorm:"index;not null"`
+	ConferenceID uint `json:"conference_id" gorm:"index;not null"`
+
+	// Details
+	Title          string `json:"title" gorm:"not null"`
+	Description    string `json:"description"`
+	OrganizerName  string `json:"organizer_name"`
+	OrganizerEmail string `json:"organizer_email"`
+	DialInNumber   string `json:"dial_in_number"` // Public number shown in invites; defaults to the room extension
+
+	// Window
+	StartAt time.Time `json:"start_at" gorm:"index;not null"`
+	EndAt   time.Time `json:"end_at" gorm:"index;not null"`
+
+	// One-time PINs
+	PIN          string `json:"pin"`
+	ModeratorPIN string `json:"moderator_pin"`
+
+	// Reminders (0 = none)
+	ReminderMinutes int        `json:"reminder_minutes"`
+	ReminderSentAt  *time.Time `json:"reminder_sent_at,omitempty"`
+
+	// State
+	Status    ConferenceMeetingStatus `json:"status" gorm:"index;default:'scheduled'"`
+	Sequence  int                     `json:"sequence" gorm:"default:0"` // iCalendar SEQUENCE, bumped on every change
+	StartedAt *time.Time              `json:"started_at,omitempty"`
+
+	// Relations
+	Conference *Conference                 `json:"conference,omitempty" gorm:"foreignKey:ConferenceID"`
+	Attendees  []ConferenceMeetingAttendee `json:"attendees,omitempty" gorm:"foreignKey:MeetingID"`
+}
+
+// BeforeCreate generates UUID
+func (m *ConferenceMeeting) BeforeCreate(tx *gorm.DB) error {
+	m.UUID = uuid.New()
+	return nil
+}
+
+// GeneratePINs assigns fresh one-time PINs. Moderator PINs are longer so
+// the two can never collide.
+func (m *ConferenceMeeting) GeneratePINs() {
+	m.PIN = randomDigits(6)
+	m.ModeratorPIN = randomDigits(8)
+}
+
+// IsOpen reports whether the meeting's PINs admit callers at t
+func (m *ConferenceMeeting) IsOpen(t time.Time) bool {
+	if m.Status != MeetingScheduled && m.Status != MeetingInProgress {
+		return false
+	}
+	return !t.Before(m.StartAt.Add(-MeetingEarlyJoin)) && t.Before(m.EndAt)
+}
+
+// ConferenceMeetingAttendee is a person invited to a meeting by email,
+// dialed into it at start time, or both
+type ConferenceMeetingAttendee struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Meeting reference
+	MeetingID uint `json:"meeting_id" gorm:"index;not null"`
+	TenantID  uint `json:"tenant_id" gorm:"index;not null"`
+
+	// Identity
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"` // Extension or external number to dial
+	Moderator bool   `json:"moderator" gorm:"default:false"`
+	Removed   bool   `json:"-" gorm:"default:false"` // Dropped from the meeting; kept until its cancellation is sent
+
+	// Invitation
+	InviteStatus string     `json:"invite_status,omitempty" gorm:"index"`
+	InviteError  string     `json:"invite_error,omitempty"`
+	InvitedAt    *time.Time `json:"invited_at,omitempty"`
+
+	// Dial-out
+	DialOut      bool       `json:"dial_out" gorm:"default:false"`
+	DialStatus   string     `json:"dial_status,omitempty"`
+	DialAttempts int        `json:"dial_attempts" gorm:"default:0"`
+	NextDialAt   *time.Time `json:"next_dial_at,omitempty" gorm:"index"`
+	LastDialAt   *time.Time `json:"last_dial_at,omitempty"`
+	CallUUID     string     `json:"call_uuid,omitempty"`
+	HangupCause  string     `json:"hangup_cause,omitempty"`
+}
+
+// ActiveConferenceMeeting returns the meeting a room hosts at t, if any
+func ActiveConferenceMeeting(db *gorm.DB, conferenceID uint, t time.Time) (*ConferenceMeeting, error) {
+	var meeting ConferenceMeeting
+	err := db.Where("conference_id = ? AND status IN ? AND start_at <= ? AND end_at > ?",
+		conferenceID, []ConferenceMeetingStatus{MeetingScheduled, MeetingInProgress},
+		t.Add(MeetingEarlyJoin), t).
+		Order("start_at ASC").First(&meeting).Error
+	if err != nil {
+		return nil, err
+	}
+	return &meeting, nil
+}
+
+// randomDigits returns n cryptographically random decimal digits
+func randomDigits(n int) string {
+	digits := make([]byte, n)
+	for i := range digits {
+		d, _ := rand.Int(rand.Reader, big.NewInt(10)) // crypto/rand never fails
+		digits[i] = byte('0' + d.Int64())
+	}
+	return string(digits)
+}
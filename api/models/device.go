@@ -107,10 +107,14 @@ type Device struct {
 	EncryptionEnabled bool   `json:"encryption_enabled" gorm:"default:false"` // Require SRTP/TLS
 
 	// Provisioning
-	ProvisionURL   string    `json:"provision_url"`   // Auto-generated provisioning URL
-	ProvisionToken string    `json:"-"`               // Secret token for provisioning auth
-	LastProvision  time.Time `json:"last_provision"`  // Last successful provision
-	ProvisionCount int       `json:"provision_count"` // Number of times provisioned
+	ProvisionURL    string    `json:"provision_url"`     // Auto-generated provisioning URL
+	ProvisionToken  string    `json:"-"`                 // Secret token for provisioning auth
+	LastProvision   time.Time `json:"last_provision"`    // Last successful provision
+	LastProvisionIP string    `json:"last_provision_ip"` // Address of the last successful fetch
+	ProvisionCount  int       `json:"provision_count"`   // Number of times provisioned
+
+	// Config served on the last successful fetch, for reprovision diffs
+	LastConfig string `json:"-" gorm:"type:text"`
 
 	// Status (updated via FreeSWITCH events)
 	Status         string    `json:"status" gorm:"default:'offline'"` // online, offline, ringing, busy
@@ -268,6 +272,10 @@ type DeviceTemplate struct {
 	// Usage count
 	DeviceCount int64 `json:"device_count" gorm:"-"` // Computed field
 
+	// Built-in template pack this template is maintained from (content is
+	// refreshed on startup; customise through a child template)
+	Pack string `json:"pack,omitempty" gorm:"index"`
+
 	// Status
 	IsSystem bool `json:"is_system" gorm:"default:false"` // System template (read-only for tenants)
 	Enabled  bool `json:"enabled" gorm:"default:true"`
@@ -334,9 +342,30 @@ type ProvisioningVariables struct {
 	// Lines (indexed by line number)
 	Lines map[int]LineVariables
 
+	// Programmable keys (BLF, speed dial, park) in display order
+	Keys []KeyVariables
+
+	// Codecs in preference order
+	Codecs []CodecVariables
+
+	// Time (offsets are those in effect when the config is rendered)
+	Timezone        string // IANA name
+	TZOffsetSeconds int    // e.g. -18000
+	TZOffsetHours   string // e.g. -5, +5:30
+	TZOffsetGMT     string // e.g. GMT-05:00
+	TZPosix         string // e.g. UTC5 (POSIX sign is inverted)
+	NTPServer       string
+
+	// Remote phonebook served for this device
+	DirectoryURL string
+
+	// Tenant/device provisioning variables (ProvisioningVariable rows)
+	Custom map[string]string
+
 	// Firmware
-	FirmwareURL     string
-	FirmwareVersion string
+	FirmwareURL      string
+	FirmwareVersion  string
+	FirmwareChecksum string // SHA256, hex
 
 	// Tenant info
 	TenantName   string
@@ -360,6 +389,31 @@ type LineVariables struct {
 	Enabled     bool
 }
 
+// Key types for KeyVariables
+const (
+	KeyTypeBLF       = "blf"        // busy lamp field on an extension
+	KeyTypeSpeedDial = "speed_dial" // one-touch dial
+	KeyTypePark      = "park"       // park slot BLF (subscribes to park+<slot>)
+)
+
+// KeyVariables holds one programmable key. Index is 1-based among keys;
+// vendors that share line keys between lines and keys add len .Lines.
+type KeyVariables struct {
+	Index int
+	Type  string
+	Label string
+	Value string // extension or number to dial
+	BLF   string // presence subscription user (e.g. 1001, park+*5701)
+}
+
+// CodecVariables holds one codec in preference order
+type CodecVariables struct {
+	Priority int    // 1 = most preferred
+	Name     string // PCMU, PCMA, G722, G729, OPUS
+	Key      string // lowercase name as used by Yealink, Fanvil and Snom
+	Payload  int    // static RTP payload type (dynamic codecs use common defaults)
+}
+
 // DeviceProfile represents a tenant-level device configuration profile
 // Allows grouping devices with shared settings and overrides
 type DeviceProfile struct {
@@ -0,0 +1,338 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxTemplateDepth bounds ParentID walks so a misconfigured cycle can't hang
+// a provisioning request
+const maxTemplateDepth = 8
+
+// TemplateChain is a device template together with its ancestors, root
+// first: typically the vendor base template, then model overrides, then
+// the tenant's own template.
+type TemplateChain []DeviceTemplate
+
+// LoadTemplateChain walks ParentID up from leaf. Disabled ancestors are
+// still included since children depend on their blocks.
+func LoadTemplateChain(db *gorm.DB, leaf DeviceTemplate) (TemplateChain, error) {
+	chain := TemplateChain{leaf}
+	seen := map[uint]bool{leaf.ID: true}
+	for parentID := leaf.ParentID; parentID != nil; parentID = chain[0].ParentID {
+		if seen[*parentID] {
+			return nil, fmt.Errorf("template %d: parent cycle at %d", leaf.ID, *parentID)
+		}
+		if len(chain) >= maxTemplateDepth {
+			return nil, fmt.Errorf("template %d: inheritance deeper than %d", leaf.ID, maxTemplateDepth)
+		}
+		var parent DeviceTemplate
+		if err := db.First(&parent, *parentID).Error; err != nil {
+			return nil, fmt.Errorf("template %d: parent %d: %w", leaf.ID, *parentID, err)
+		}
+		seen[parent.ID] = true
+		chain = append(TemplateChain{parent}, chain...)
+	}
+	return chain, nil
+}
+
+// Leaf returns the template the device was assigned
+func (tc TemplateChain) Leaf() *DeviceTemplate {
+	return &tc[len(tc)-1]
+}
+
+// Render executes the chain into w. Templates are parsed root first into one
+// set, so a child overrides its parent's {{block}}s with {{define}}. A child
+// whose own body is not empty replaces the parent's body entirely (it can
+// still {{template}} the parent's blocks).
+func (tc TemplateChain) Render(w io.Writer, vars ProvisioningVariables) error {
+	var t *template.Template
+	for _, tmpl := range tc {
+		if tmpl.ConfigTemplate == "" {
+			continue
+		}
+		if t == nil {
+			t = template.New("config").Funcs(templateFuncs)
+		}
+		if _, err := t.Parse(tmpl.ConfigTemplate); err != nil {
+			return fmt.Errorf("template %q: %w", tmpl.Name, err)
+		}
+	}
+	if t == nil {
+		return fmt.Errorf("template chain has no content")
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			scalarActions(tmpl.Tree.Root)
+		}
+	}
+	return t.Execute(w, vars)
+}
+
+// scalarActions pipes every value a template prints through scalar, so a
+// map, slice or struct printed by mistake (e.g. {{.Lines}}) renders as
+// nothing rather than as Go syntax like map[] that phones can't parse
+func scalarActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			scalarActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier("scalar").SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		scalarActions(n.List)
+		scalarActions(n.ElseList)
+	case *parse.RangeNode:
+		scalarActions(n.List)
+		scalarActions(n.ElseList)
+	case *parse.WithNode:
+		scalarActions(n.List)
+		scalarActions(n.ElseList)
+	}
+}
+
+// scalar returns v when it prints as a single value and "" otherwise
+func scalar(v interface{}) interface{} {
+	switch v.(type) {
+	case nil:
+		return ""
+	case fmt.Stringer, error:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return rv.Interface()
+	}
+	return ""
+}
+
+// templateFuncs are available to every device template, mostly for vendors
+// that number settings per line or key (Grandstream P-values, Snom's 0-based
+// fkeys). Use the builtin html to escape values inside XML.
+var templateFuncs = template.FuncMap{
+	"add":    func(a, b int) int { return a + b },
+	"sub":    func(a, b int) int { return a - b },
+	"mul":    func(a, b int) int { return a * b },
+	"list":   func(v ...int) []int { return v },
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"scalar": scalar,
+}
+
+// nearest returns the first non-empty value of field, starting at the leaf
+func (tc TemplateChain) nearest(field func(*DeviceTemplate) string) string {
+	for i := len(tc) - 1; i >= 0; i-- {
+		if v := field(&tc[i]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ConfigType returns the output format, which belongs to the root (vendor)
+// template; overrides always carry the column default and can't change it.
+func (tc TemplateChain) ConfigType() string {
+	return tc[0].ConfigType
+}
+
+// UserAgentPattern returns the closest User-Agent restriction
+func (tc TemplateChain) UserAgentPattern() string {
+	return tc.nearest(func(t *DeviceTemplate) string { return t.UserAgentPattern })
+}
+
+// MACPattern returns the closest MAC restriction
+func (tc TemplateChain) MACPattern() string {
+	return tc.nearest(func(t *DeviceTemplate) string { return t.MACPattern })
+}
+
+// IPWhitelist returns the closest IP/CIDR whitelist
+func (tc TemplateChain) IPWhitelist() string {
+	return tc.nearest(func(t *DeviceTemplate) string { return t.IPWhitelist })
+}
+
+// RequireHTTPS reports whether any template in the chain requires HTTPS;
+// an override can't relax its vendor template's transport requirement.
+func (tc TemplateChain) RequireHTTPS() bool {
+	for _, t := range tc {
+		if t.RequireHTTPS {
+			return true
+		}
+	}
+	return false
+}
+
+// FirmwareID returns the closest firmware pinned in the chain
+func (tc TemplateChain) FirmwareID() *uint {
+	for i := len(tc) - 1; i >= 0; i-- {
+		if tc[i].FirmwareID != nil {
+			return tc[i].FirmwareID
+		}
+	}
+	return nil
+}
+
+// IPAllowed reports whether ip matches a comma-separated list of IPs and
+// CIDRs. An empty whitelist allows everyone; malformed entries match nothing.
+func IPAllowed(whitelist, ip string) bool {
+	if strings.TrimSpace(whitelist) == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(whitelist, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultFirmware returns the enabled default firmware for a manufacturer
+// and model (or model family)
+func DefaultFirmware(db *gorm.DB, manufacturer, model string) (*Firmware, error) {
+	var fw Firmware
+	err := db.Where("manufacturer = ? AND (model = ? OR family = ?) AND is_default = ? AND enabled = ?",
+		manufacturer, model, model, true, true).
+		Order("model DESC").
+		First(&fw).Error
+	if err != nil {
+		return nil, err
+	}
+	return &fw, nil
+}
+
+// DefaultCodecs is the codec order used when a device doesn't set one
+const DefaultCodecs = "G722,PCMU,PCMA,OPUS"
+
+// codecPayloads maps codec names to their RTP payload types
+var codecPayloads = map[string]int{
+	"PCMU": 0,
+	"PCMA": 8,
+	"G722": 9,
+	"G729": 18,
+	"OPUS": 96,
+}
+
+// ParseCodecs turns a comma-separated codec list (Device.SupportedCodecs)
+// into preference-ordered codec variables. Unknown and repeated codecs are
+// dropped.
+func ParseCodecs(list string) []CodecVariables {
+	if strings.TrimSpace(list) == "" {
+		list = DefaultCodecs
+	}
+	var codecs []CodecVariables
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		// Accept the FreeSWITCH spellings too
+		switch name {
+		case "G711U", "G711_MU", "ULAW":
+			name = "PCMU"
+		case "G711A", "G711_A", "ALAW":
+			name = "PCMA"
+		}
+		payload, ok := codecPayloads[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		codecs = append(codecs, CodecVariables{
+			Priority: len(codecs) + 1,
+			Name:     name,
+			Key:      strings.ToLower(name),
+			Payload:  payload,
+		})
+	}
+	return codecs
+}
+
+// SetTimezone fills the time zone variables for loc as of now
+func (v *ProvisioningVariables) SetTimezone(loc *time.Location, now time.Time) {
+	_, offset := now.In(loc).Zone()
+	v.Timezone = loc.String()
+	v.TZOffsetSeconds = offset
+
+	sign := "+"
+	abs := offset
+	if offset < 0 {
+		sign = "-"
+		abs = -offset
+	}
+	hours, minutes := abs/3600, abs%3600/60
+
+	v.TZOffsetHours = sign + strconv.Itoa(hours)
+	if minutes != 0 {
+		v.TZOffsetHours += fmt.Sprintf(":%02d", minutes)
+	}
+	if offset == 0 {
+		v.TZOffsetHours = "0"
+	}
+	v.TZOffsetGMT = fmt.Sprintf("GMT%s%02d:%02d", sign, hours, minutes)
+
+	posixSign := "-"
+	if offset <= 0 {
+		posixSign = ""
+	}
+	v.TZPosix = "UTC" + posixSign + strconv.Itoa(hours)
+	if minutes != 0 {
+		v.TZPosix += fmt.Sprintf(":%02d", minutes)
+	}
+}
+
+// DeviceProvisionLog records every config or firmware fetch by a phone,
+// allowed or denied, for the per-device access log.
+type DeviceProvisionLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+
+	TenantID uint  `json:"tenant_id" gorm:"index;not null"`
+	DeviceID *uint `json:"device_id" gorm:"index"` // nil when the MAC is unknown
+
+	MAC       string `json:"mac" gorm:"index"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Protocol  string `json:"protocol"` // http, https
+	Path      string `json:"path"`     // request path with the tenant secret masked
+
+	Status int    `json:"status"`           // HTTP status returned to the phone
+	Reason string `json:"reason,omitempty"` // denial reason (https_required, ip_not_allowed, ...)
+}
@@ -59,6 +59,46 @@ type CallHandlingOverride struct {
 	} `json:"devices"`
 }
 
+// UnrestrictedPermissions applies to extensions without a profile
+var UnrestrictedPermissions = ExtensionPermissions{
+	Outbound:      true,
+	International: true,
+	Recording:     true,
+	Portal:        true,
+	Voicemail:     true,
+}
+
+// LoadExtensionProfile returns the profile assigned to an extension, or nil
+// when the extension has none
+func LoadExtensionProfile(db *gorm.DB, ext *Extension) *ExtensionProfile {
+	if ext == nil || ext.ProfileID == nil {
+		return nil
+	}
+	var profile ExtensionProfile
+	if err := db.Where("id = ? AND tenant_id = ?", *ext.ProfileID, ext.TenantID).First(&profile).Error; err != nil {
+		return nil
+	}
+	return &profile
+}
+
+// ExtensionPermissionsFor returns the effective permissions of an extension.
+// Extensions without a profile are unrestricted.
+func ExtensionPermissionsFor(db *gorm.DB, ext *Extension) ExtensionPermissions {
+	if profile := LoadExtensionProfile(db, ext); profile != nil {
+		return profile.Permissions
+	}
+	return UnrestrictedPermissions
+}
+
+// RingStrategy returns the profile's ring strategy override, or fallback when
+// the profile doesn't override it. Safe to call on a nil profile.
+func (ep *ExtensionProfile) RingStrategy(fallback string) string {
+	if ep == nil || !ep.CallHandling.OverrideStrategy || ep.CallHandling.Strategy == "" {
+		return fallback
+	}
+	return ep.CallHandling.Strategy
+}
+
 // GORM Value/Scan for ExtensionPermissions
 func (p ExtensionPermissions) Value() (driver.Value, error) {
 	return json.Marshal(p)
@@ -66,16 +106,33 @@ func (p ExtensionPermissions) Value() (driver.Value, error) {
 
 func (p *ExtensionPermissions) Scan(value interface{}) error {
 	if value == nil {
-		*p = ExtensionPermissions{}
+		*p = UnrestrictedPermissions
 		return nil
 	}
-	b, ok := value.([]byte)
-	if !ok {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
 		return errors.New("type assertion to []byte failed")
 	}
 	return json.Unmarshal(b, p)
 }
 
+// UnmarshalJSON leaves permissions missing from the JSON allowed, so
+// profiles saved before they were enforced (stored as '{}') keep working
+func (p *ExtensionPermissions) UnmarshalJSON(data []byte) error {
+	type plain ExtensionPermissions
+	perms := plain(UnrestrictedPermissions)
+	if err := json.Unmarshal(data, &perms); err != nil {
+		return err
+	}
+	*p = ExtensionPermissions(perms)
+	return nil
+}
+
 // GORM Value/Scan for CallHandlingOverride
 func (c CallHandlingOverride) Value() (driver.Value, error) {
 	return json.Marshal(c)
@@ -86,8 +143,13 @@ func (c *CallHandlingOverride) Scan(value interface{}) error {
 		*c = CallHandlingOverride{}
 		return nil
 	}
-	b, ok := value.([]byte)
-	if !ok {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
 		return errors.New("type assertion to []byte failed")
 	}
 	return json.Unmarshal(b, c)
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// mod_limit hash realms for outbound call counters. The XML dialplan and
+// the callcontrol ESL module use the same realms so both paths count
+// against one limit. Extension counters use the tenant domain as realm and
+// "outbound_<extension>" as resource.
+const (
+	LimitRealmTenant  = "outbound_tenant"
+	LimitRealmGateway = "outbound_gateway"
+)
+
+// ExtensionLimitResource is the mod_limit resource counting an extension's
+// outbound calls within its domain realm
+func ExtensionLimitResource(extension string) string {
+	return "outbound_" + extension
+}
+
+// FraudPolicy sets the rolling international spend and minute thresholds
+// for a tenant. The policy with a nil TenantID is the system default for
+// tenants without their own; with neither, no thresholds apply.
+type FraudPolicy struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	TenantID *uint `json:"tenant_id" gorm:"uniqueIndex"`
+	Enabled  bool  `json:"enabled" gorm:"default:true"`
+
+	// Thresholds over the trailing window; 0 disables a threshold. Spend is
+	// the rated retail cost, so it needs a rate deck on the tenant.
+	WindowMinutes int     `json:"window_minutes" gorm:"default:60"`
+	MaxSpend      float64 `json:"max_spend" gorm:"type:decimal(10,4);default:0"`
+	MaxMinutes    int     `json:"max_minutes" gorm:"default:0"`
+
+	// Numbers dialed in international format count unless they are in the
+	// home country (E.164 country code, "1" for NANP)
+	HomeCountryCode string `json:"home_country_code" gorm:"default:'1'"`
+
+	// AutoBlock blocks outbound calling on breach; otherwise admins are
+	// only alerted, at most once per window
+	AutoBlock bool `json:"auto_block" gorm:"default:true"`
+
+	// Extra alert recipients, comma-separated; tenant admins always get one
+	AlertEmails string `json:"alert_emails"`
+}
+
+// AlertRecipients returns the configured extra alert addresses
+func (p *FraudPolicy) AlertRecipients() []string {
+	var out []string
+	for _, addr := range strings.Split(p.AlertEmails, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// Fraud event types
+const (
+	FraudEventThreshold = "threshold_exceeded"
+	FraudEventBlocked   = "blocked"
+	FraudEventUnblocked = "unblocked"
+)
+
+// FraudEvent records a threshold breach or an outbound block change
+type FraudEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	TenantID  uint      `json:"tenant_id" gorm:"index;not null"`
+	Type      string    `json:"type" gorm:"not null"`
+
+	// Usage in the window at the time of a breach
+	WindowMinutes int     `json:"window_minutes,omitempty"`
+	Calls         int     `json:"calls,omitempty"`
+	Minutes       float64 `json:"minutes,omitempty"`
+	Spend         float64 `json:"spend,omitempty"`
+	MaxMinutes    int     `json:"max_minutes,omitempty"`
+	MaxSpend      float64 `json:"max_spend,omitempty"`
+
+	Reason string `json:"reason"`
+	UserID *uint  `json:"user_id,omitempty"` // admin who blocked or unblocked
+}
@@ -78,6 +78,9 @@ type Gateway struct {
 	Weight   int    `json:"weight" gorm:"default:100"` // Weight for load balancing
 	RouteTag string `json:"route_tag"`                 // Tag for dial plan routing
 
+	// Carrier rate deck used to cost calls sent through this gateway
+	RateDeckID *uint `json:"rate_deck_id"`
+
 	// Status (read-only, updated by FreeSWITCH events)
 	Status     string     `json:"status" gorm:"-"`
 	LastStatus *time.Time `json:"last_status"`
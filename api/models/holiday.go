@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -42,3 +43,25 @@ type HolidayDate struct {
 	Date string `json:"date"` // YYYY-MM-DD
 	Name string `json:"name"` // e.g., "Christmas Day"
 }
+
+// ParsedDates decodes the JSONB Dates column into HolidayDate entries
+func (h *HolidayList) ParsedDates() []HolidayDate {
+	var dates []HolidayDate
+	if len(h.Dates) == 0 {
+		return dates
+	}
+	json.Unmarshal(h.Dates, &dates)
+	return dates
+}
+
+// HolidayOn returns the holiday falling on the given calendar day, if any.
+// The comparison uses the date as seen in t's own location.
+func (h *HolidayList) HolidayOn(t time.Time) (HolidayDate, bool) {
+	day := t.Format("2006-01-02")
+	for _, d := range h.ParsedDates() {
+		if d.Date == day {
+			return d, true
+		}
+	}
+	return HolidayDate{}, false
+}
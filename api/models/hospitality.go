@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -26,4 +28,106 @@ type HotelRoom struct {
 	CIDNumber     string     `json:"cid_number"` // outbound caller ID number
 	Notes         string     `json:"notes"`
 	Enabled       bool       `json:"enabled" gorm:"default:true"`
+
+	// Wake-up scheduler state. WakeupNextAttemptAt is when the scheduler next
+	// dials the room (the wake-up time, a retry or a snooze); it is cleared
+	// and WakeupClaimedAt set while a call is in progress.
+	WakeupAttempts      int        `json:"wakeup_attempts"`
+	WakeupNextAttemptAt *time.Time `json:"wakeup_next_attempt_at" gorm:"index"`
+	WakeupClaimedAt     *time.Time `json:"wakeup_claimed_at"`
+	WakeupAudio         string     `json:"wakeup_audio"` // overrides the tenant's wake-up message
+}
+
+// SetWakeup schedules a wake-up call at t, or clears it when t is nil
+func (r *HotelRoom) SetWakeup(t *time.Time) {
+	if t == nil {
+		r.WakeupAudio = ""
+	}
+	r.WakeupEnabled = t != nil
+	r.WakeupTime = t
+	r.WakeupNextAttemptAt = t
+	r.WakeupClaimedAt = nil
+	r.WakeupAttempts = 0
+}
+
+// HotelRoomEventType identifies an entry in a room's history
+type HotelRoomEventType string
+
+const (
+	RoomEventCheckIn         HotelRoomEventType = "check_in"
+	RoomEventCheckOut        HotelRoomEventType = "check_out"
+	RoomEventWakeupScheduled HotelRoomEventType = "wakeup_scheduled"
+	RoomEventWakeupCancelled HotelRoomEventType = "wakeup_cancelled"
+	RoomEventWakeupAnswered  HotelRoomEventType = "wakeup_answered"
+	RoomEventWakeupSnoozed   HotelRoomEventType = "wakeup_snoozed"
+	RoomEventWakeupNoAnswer  HotelRoomEventType = "wakeup_no_answer"
+	RoomEventWakeupEscalated HotelRoomEventType = "wakeup_escalated"
+	RoomEventWakeupFailed    HotelRoomEventType = "wakeup_failed"
+)
+
+// HotelRoomEvent is an entry in a room's history: guest stays and every
+// wake-up call attempt
+type HotelRoomEvent struct {
+	ID          uint               `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time          `json:"created_at" gorm:"index"`
+	TenantID    uint               `json:"tenant_id" gorm:"index"`
+	RoomID      uint               `json:"room_id" gorm:"index"`
+	Event       HotelRoomEventType `json:"event"`
+	GuestName   string             `json:"guest_name"`
+	Attempt     int                `json:"attempt,omitempty"`
+	CallUUID    string             `json:"call_uuid,omitempty"`
+	HangupCause string             `json:"hangup_cause,omitempty"`
+	Detail      string             `json:"detail,omitempty"`
+}
+
+// LogRoomEvent appends an event to the room's history
+func LogRoomEvent(db *gorm.DB, room *HotelRoom, event HotelRoomEvent) error {
+	event.TenantID = room.TenantID
+	event.RoomID = room.ID
+	if event.GuestName == "" {
+		event.GuestName = room.GuestName
+	}
+	return db.Create(&event).Error
+}
+
+// WakeupSettings are the tenant's wake-up call options, stored in the tenant
+// Settings JSONB alongside hospitality_enabled
+type WakeupSettings struct {
+	Retries            int    `json:"wakeup_retries"`        // redials after the first unanswered call
+	RetryMinutes       int    `json:"wakeup_retry_minutes"`  // delay between unanswered attempts
+	SnoozeMinutes      int    `json:"wakeup_snooze_minutes"` // delay when the guest presses 1
+	Audio              string `json:"wakeup_audio"`
+	FrontDeskExtension string `json:"front_desk_extension"`
+	OperatorExt        string `json:"operator_ext"`
+}
+
+// ValidWakeupAudio reports whether a wake-up message path can be placed in
+// the quoted wakeup_audio channel variable of the originate command
+func ValidWakeupAudio(path string) bool {
+	return !strings.ContainsAny(path, "'{}\r\n")
+}
+
+// WakeupSettings returns the tenant's wake-up options with defaults applied.
+// Escalations go to the operator extension when no front desk is set.
+func (t *Tenant) WakeupSettings() WakeupSettings {
+	settings := WakeupSettings{Retries: -1}
+	if t.Settings != "" {
+		json.Unmarshal([]byte(t.Settings), &settings)
+	}
+	if settings.Retries < 0 {
+		settings.Retries = 2
+	}
+	if settings.RetryMinutes <= 0 {
+		settings.RetryMinutes = 5
+	}
+	if settings.SnoozeMinutes <= 0 {
+		settings.SnoozeMinutes = 10
+	}
+	if settings.Audio == "" || !ValidWakeupAudio(settings.Audio) {
+		settings.Audio = "voicemail/vm-wakeup_call.wav"
+	}
+	if settings.FrontDeskExtension == "" {
+		settings.FrontDeskExtension = settings.OperatorExt
+	}
+	return settings
 }
@@ -187,6 +187,59 @@ func (t *TimeCondition) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// OpenAt reports whether the condition matches at now: on one of its
+// weekdays, inside its start/end time and not on a holiday. Empty weekdays or
+// times match any day or time.
+func (t *TimeCondition) OpenAt(db *gorm.DB, now time.Time) bool {
+	loc := time.UTC
+	if t.Timezone != "" {
+		if l, err := time.LoadLocation(t.Timezone); err == nil {
+			loc = l
+		}
+	}
+	local := now.In(loc)
+
+	if len(t.Weekdays) > 0 {
+		match := false
+		for _, d := range t.Weekdays {
+			if int(d) == int(local.Weekday()) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	if t.StartTime != "" && t.EndTime != "" {
+		clock := local.Format("15:04")
+		if t.StartTime <= t.EndTime {
+			if clock < t.StartTime || clock >= t.EndTime {
+				return false
+			}
+		} else if clock < t.StartTime && clock >= t.EndTime {
+			return false // window spans midnight
+		}
+	}
+
+	day := local.Format("2006-01-02")
+	for _, h := range t.Holidays {
+		if h == day {
+			return false
+		}
+	}
+	if t.HolidayListID != nil && db != nil {
+		var list HolidayList
+		if err := db.Where("id = ? AND enabled = ?", *t.HolidayListID, true).First(&list).Error; err == nil {
+			if _, ok := list.HolidayOn(local); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // CallFlow represents a multi-state toggle switch (day/night, or N custom states)
 type CallFlow struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
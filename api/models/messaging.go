@@ -57,6 +57,9 @@ type MessageQueueItem struct {
 	Body       string `json:"body" gorm:"type:text"`
 	HasMedia   bool   `json:"has_media" gorm:"default:false"`
 
+	// Keyword responses (STOP, HELP, ...) are sent to opted-out recipients
+	KeywordResponse bool `json:"keyword_response" gorm:"default:false"`
+
 	// Delivery status
 	Status      string `json:"status" gorm:"default:'pending'"` // pending, processing, sent, delivered, failed, retry
 	Attempts    int    `json:"attempts" gorm:"default:0"`
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Consent ledger statuses
+const (
+	ConsentOptIn  = "opt_in"
+	ConsentOptOut = "opt_out"
+)
+
+// Consent ledger sources
+const (
+	ConsentSourceKeyword = "keyword" // The recipient texted STOP, START, ...
+	ConsentSourceAPI     = "api"     // Recorded by a user, e.g. from a web form opt-in
+)
+
+// Campaign types
+const (
+	CampaignType10DLC     = "10dlc"
+	CampaignTypeTollFree  = "toll_free"
+	CampaignTypeShortCode = "short_code"
+)
+
+// MessagingBrand is a business registered for US A2P messaging (with The
+// Campaign Registry for 10DLC, or on a toll-free verification)
+type MessagingBrand struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UUID      uuid.UUID      `json:"uuid" gorm:"type:uuid;uniqueIndex;not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	TenantID uint `json:"tenant_id" gorm:"index;not null"`
+
+	// Business identity
+	Name        string `json:"name" gorm:"not null"` // Legal company name
+	DisplayName string `json:"display_name"`         // Brand name, used in keyword responses
+	EntityType  string `json:"entity_type"`          // private_profit, public_profit, non_profit, government, sole_proprietor
+	TaxID       string `json:"tax_id"`               // EIN or local equivalent
+	Country     string `json:"country" gorm:"default:'US'"`
+	Website     string `json:"website"`
+	Vertical    string `json:"vertical"`
+
+	// Support contact, quoted in HELP responses
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+
+	// Registration
+	RegistryID   string `json:"registry_id"`                   // Brand ID assigned by the registry
+	Status       string `json:"status" gorm:"default:'draft'"` // draft, pending, verified, unverified, rejected
+	StatusReason string `json:"status_reason"`
+}
+
+// BeforeCreate generates UUID
+func (b *MessagingBrand) BeforeCreate(tx *gorm.DB) error {
+	b.UUID = uuid.New()
+	return nil
+}
+
+// ResponseName returns the name keyword responses start with
+func (b *MessagingBrand) ResponseName() string {
+	if b.DisplayName != "" {
+		return b.DisplayName
+	}
+	return b.Name
+}
+
+// MessagingCampaign is a registered messaging use case of a brand.
+// MessagingNumbers attached to it send under its throughput limits and
+// answer keywords with its messages.
+type MessagingCampaign struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UUID      uuid.UUID      `json:"uuid" gorm:"type:uuid;uniqueIndex;not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	TenantID uint            `json:"tenant_id" gorm:"index;not null"`
+	BrandID  uint            `json:"brand_id" gorm:"index;not null"`
+	Brand    *MessagingBrand `json:"brand,omitempty" gorm:"foreignKey:BrandID"`
+
+	// Use case, as registered
+	Name             string         `json:"name" gorm:"not null"`
+	Type             string         `json:"type" gorm:"default:'10dlc'"` // 10dlc, toll_free, short_code
+	UseCase          string         `json:"use_case"`                    // customer_care, account_notification, marketing, 2fa, mixed, ...
+	Description      string         `json:"description" gorm:"type:text"`
+	OptInDescription string         `json:"opt_in_description" gorm:"type:text"` // How recipients give consent
+	SampleMessages   pq.StringArray `json:"sample_messages" gorm:"type:text[]"`
+
+	// Keyword responses; empty uses the defaults
+	HelpMessage   string `json:"help_message"`
+	OptOutMessage string `json:"opt_out_message"`
+	OptInMessage  string `json:"opt_in_message"`
+
+	// Throughput assigned by the carriers (0 = unlimited)
+	RateLimitPerSecond int `json:"rate_limit_per_second"`
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+
+	// Registration
+	RegistryID   string `json:"registry_id"`                   // Campaign ID assigned by the registry
+	Status       string `json:"status" gorm:"default:'draft'"` // draft, pending, active, rejected, suspended
+	StatusReason string `json:"status_reason"`
+
+	Numbers []MessagingNumber `json:"numbers,omitempty" gorm:"foreignKey:CampaignID"`
+}
+
+// BeforeCreate generates UUID
+func (c *MessagingCampaign) BeforeCreate(tx *gorm.DB) error {
+	c.UUID = uuid.New()
+	return nil
+}
+
+// MessagingConsent is one entry of the consent ledger: a recipient opting
+// in to or out of messages from one of a tenant's numbers. Entries are
+// never changed; the latest for a number and recipient is in force.
+type MessagingConsent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TenantID  uint   `json:"tenant_id" gorm:"index;not null"`
+	Number    string `json:"number" gorm:"index:idx_consent_pair;not null"`    // The tenant's number
+	Recipient string `json:"recipient" gorm:"index:idx_consent_pair;not null"` // The subscriber's number
+
+	Status  string `json:"status" gorm:"not null"` // opt_in, opt_out
+	Source  string `json:"source" gorm:"not null"` // keyword, api
+	Keyword string `json:"keyword,omitempty"`      // The keyword texted
+	Note    string `json:"note,omitempty" gorm:"type:text"`
+	UserID  *uint  `json:"user_id,omitempty"` // Who recorded an API entry
+}
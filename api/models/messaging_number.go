@@ -26,6 +26,14 @@ type MessagingNumber struct {
 	ProviderID uint               `json:"provider_id" gorm:"index;not null"`
 	Provider   *MessagingProvider `json:"provider,omitempty" gorm:"foreignKey:ProviderID"`
 
+	// Registered campaign the number sends under (US 10DLC / toll-free)
+	CampaignID *uint              `json:"campaign_id" gorm:"index"`
+	Campaign   *MessagingCampaign `json:"campaign,omitempty" gorm:"foreignKey:CampaignID"`
+
+	// Throughput of this number alone (0 = unlimited)
+	RateLimitPerSecond int `json:"rate_limit_per_second"`
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+
 	// Inbound routing target (carrier-agnostic)
 	TenantID    *uint `json:"tenant_id" gorm:"index"`
 	ExtensionID *uint `json:"extension_id" gorm:"index"`
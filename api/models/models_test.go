@@ -2,6 +2,7 @@ package models_test
 
 import (
 	"callsign/models"
+	"strings"
 	"testing"
 	"time"
 
@@ -241,3 +242,278 @@ func TestConferenceCRUD(t *testing.T) {
 	assert.NotZero(t, conf.ID)
 	assert.NotEmpty(t, conf.UUID)
 }
+
+func TestRecordingRetentionPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.CallRecording{}, &models.RecordingConfig{}))
+
+	profile := &models.TenantProfile{Name: "basic", RecordingRetention: 30, RecordingStorage: 2}
+	require.NoError(t, db.Create(profile).Error)
+	tenant := &models.Tenant{Name: "Acme", Domain: "acme.test", ProfileID: &profile.ID}
+	require.NoError(t, db.Create(tenant).Error)
+
+	// No tenant config: default retention is capped by the profile
+	p := models.LoadRecordingPolicy(db, tenant.ID)
+	assert.Equal(t, 30, p.RetentionDays)
+	assert.Equal(t, int64(2)<<30, p.QuotaBytes)
+	assert.Equal(t, models.RecordingQuotaRefuse, p.QuotaAction)
+
+	// Shorter tenant retention wins over the profile cap
+	require.NoError(t, db.Create(&models.RecordingConfig{TenantID: tenant.ID, RetentionDays: 7, AutoDeleteExpired: true, QuotaAction: models.RecordingQuotaRotate}).Error)
+	p = models.LoadRecordingPolicy(db, tenant.ID)
+	assert.Equal(t, 7, p.RetentionDays)
+	assert.Equal(t, models.RecordingQuotaRotate, p.QuotaAction)
+
+	// Expiry is stamped on create from the start time
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec := &models.CallRecording{TenantID: tenant.ID, StartTime: start}
+	require.NoError(t, db.Create(rec).Error)
+	assert.Equal(t, 7, rec.RetentionDays)
+	assert.True(t, rec.ExpiresAt.Equal(start.AddDate(0, 0, 7)))
+
+	// An explicit retention on the recording is kept
+	rec = &models.CallRecording{TenantID: tenant.ID, StartTime: start, RetentionDays: 365}
+	require.NoError(t, db.Create(rec).Error)
+	assert.True(t, rec.ExpiresAt.Equal(start.AddDate(1, 0, 0)))
+}
+
+func TestTenantProfileLimitsAndFeatures(t *testing.T) {
+	db := setupTestDB(t)
+
+	profile := &models.TenantProfile{Name: "starter", MaxExtensions: 2}
+	require.NoError(t, db.Create(profile).Error)
+	require.NoError(t, db.Model(profile).Update("fax_enabled", false).Error)
+	tenant := &models.Tenant{Name: "Acme", Domain: "acme.test", ProfileID: &profile.ID}
+	require.NoError(t, db.Create(tenant).Error)
+
+	for _, n := range []string{"1001", "1002"} {
+		require.NoError(t, db.Create(&models.Extension{TenantID: tenant.ID, Extension: n, Password: "secret"}).Error)
+	}
+
+	loaded := models.LoadTenantProfile(db, tenant.ID)
+	require.NotNil(t, loaded)
+
+	count, err := models.CountTenantResource(db, tenant.ID, models.LimitExtensions)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.False(t, loaded.CheckLimit(models.LimitExtensions, int(count)))
+
+	// Unset limits default to unlimited
+	assert.Equal(t, -1, loaded.Limit(models.LimitQueues))
+	assert.True(t, loaded.CheckLimit(models.LimitQueues, 1000))
+
+	assert.False(t, loaded.HasFeature(models.FeatureFax))
+	assert.True(t, loaded.HasFeature(models.FeatureWebRTC))
+
+	// Tenants without a profile are unrestricted
+	assert.Nil(t, models.LoadTenantProfile(db, tenant.ID+1))
+}
+
+func TestExtensionProfilePermissions(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.ExtensionProfile{}))
+
+	tenant := &models.Tenant{Name: "Acme", Domain: "acme.test"}
+	require.NoError(t, db.Create(tenant).Error)
+
+	profile := &models.ExtensionProfile{
+		TenantID:    tenant.ID,
+		Name:        "Lobby",
+		Permissions: models.ExtensionPermissions{Outbound: true},
+	}
+	profile.CallHandling.OverrideStrategy = true
+	profile.CallHandling.Strategy = "sequential"
+	require.NoError(t, db.Create(profile).Error)
+
+	// Extensions without a profile are unrestricted
+	plain := &models.Extension{TenantID: tenant.ID, Extension: "1001", Password: "secret"}
+	require.NoError(t, db.Create(plain).Error)
+	assert.Nil(t, models.LoadExtensionProfile(db, plain))
+	assert.Equal(t, models.UnrestrictedPermissions, models.ExtensionPermissionsFor(db, plain))
+
+	lobby := &models.Extension{TenantID: tenant.ID, Extension: "1002", Password: "secret", ProfileID: &profile.ID}
+	require.NoError(t, db.Create(lobby).Error)
+	perms := models.ExtensionPermissionsFor(db, lobby)
+	assert.True(t, perms.Outbound)
+	assert.False(t, perms.International)
+	assert.False(t, perms.Recording)
+	assert.False(t, perms.Portal)
+
+	loaded := models.LoadExtensionProfile(db, lobby)
+	require.NotNil(t, loaded)
+	assert.Equal(t, "sequential", loaded.RingStrategy("simultaneous"))
+
+	var none *models.ExtensionProfile
+	assert.Equal(t, "simultaneous", none.RingStrategy("simultaneous"))
+
+	// Profiles saved before permissions were enforced hold '{}'
+	require.NoError(t, db.Exec(`INSERT INTO extension_profiles (uuid, tenant_id, name, permissions, call_handling)
+		VALUES ('6f1c2d3e-4a5b-4c6d-8e7f-9a0b1c2d3e4f', ?, 'Legacy', '{}', '{}')`, tenant.ID).Error)
+	var legacy models.ExtensionProfile
+	require.NoError(t, db.Where("name = ?", "Legacy").First(&legacy).Error)
+	old := &models.Extension{TenantID: tenant.ID, Extension: "1003", Password: "secret", ProfileID: &legacy.ID}
+	require.NoError(t, db.Create(old).Error)
+	assert.Equal(t, models.UnrestrictedPermissions, models.ExtensionPermissionsFor(db, old))
+
+	intl := &models.DefaultOutboundRoute{DigitPrefix: "011"}
+	assert.True(t, intl.IsInternational())
+	assert.False(t, (&models.DefaultOutboundRoute{TollAllow: "domestic"}).IsInternational())
+}
+
+func TestRecordBroadcastResult(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.BroadcastResult{}))
+
+	base := models.BroadcastResult{CampaignID: 1, RecipientID: 7, CallUUID: "call-1", PhoneNumber: "15551234567", Attempt: 2}
+
+	// The call module records the interactive outcome while the call is up
+	require.NoError(t, models.RecordBroadcastResult(db, base, map[string]interface{}{"outcome": models.BroadcastOutcomeHuman}))
+	require.NoError(t, models.RecordBroadcastResult(db, base, map[string]interface{}{"digits": "1", "transferred": true}))
+
+	// The hangup tracker fills in the cause on the same row
+	require.NoError(t, models.RecordBroadcastResult(db, base, map[string]interface{}{"hangup_cause": "NORMAL_CLEARING", "duration": 42}))
+
+	var results []models.BroadcastResult
+	require.NoError(t, db.Find(&results).Error)
+	require.Len(t, results, 1)
+	assert.Equal(t, models.BroadcastOutcomeHuman, results[0].Outcome)
+	assert.Equal(t, "1", results[0].Digits)
+	assert.True(t, results[0].Transferred)
+	assert.Equal(t, "NORMAL_CLEARING", results[0].HangupCause)
+	assert.Equal(t, 42, results[0].Duration)
+	assert.Equal(t, 2, results[0].Attempt)
+}
+
+func TestTimeConditionOpenAt(t *testing.T) {
+	hours := models.TimeCondition{
+		Timezone:  "America/New_York",
+		Weekdays:  []int32{1, 2, 3, 4, 5},
+		StartTime: "09:00",
+		EndTime:   "17:00",
+		Holidays:  []string{"2026-12-25"},
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+
+	assert.True(t, hours.OpenAt(nil, time.Date(2026, 6, 1, 9, 0, 0, 0, ny)))         // Monday opening
+	assert.False(t, hours.OpenAt(nil, time.Date(2026, 6, 1, 17, 0, 0, 0, ny)))       // closing time
+	assert.False(t, hours.OpenAt(nil, time.Date(2026, 6, 6, 12, 0, 0, 0, ny)))       // Saturday
+	assert.False(t, hours.OpenAt(nil, time.Date(2026, 12, 25, 12, 0, 0, 0, ny)))     // holiday
+	assert.True(t, hours.OpenAt(nil, time.Date(2026, 6, 1, 14, 30, 0, 0, time.UTC))) // 10:30 in New York
+
+	overnight := models.TimeCondition{StartTime: "22:00", EndTime: "06:00"}
+	assert.True(t, overnight.OpenAt(nil, time.Date(2026, 6, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, overnight.OpenAt(nil, time.Date(2026, 6, 2, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, overnight.OpenAt(nil, time.Date(2026, 6, 2, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestDeviceTemplateChain(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Firmware{}, &models.DeviceTemplate{}))
+
+	base := models.DeviceTemplate{Name: "Yealink base", Manufacturer: "Yealink", ConfigType: "cfg",
+		ConfigTemplate: "account.1.user_name = {{with index .Lines 1}}{{.UserID}}{{end}}\n" +
+			"account.1.codecs = {{.Codecs}}\n" +
+			`{{block "network" .}}static.network.vlan = 0{{end}}` + "\n" +
+			`{{block "firmware" .}}{{end}}` + "\n"}
+	require.NoError(t, db.Create(&base).Error)
+	model := models.DeviceTemplate{Name: "T54W", Manufacturer: "Yealink", Model: "T54W", ParentID: &base.ID,
+		RequireHTTPS: true, IPWhitelist: "10.0.0.0/8",
+		ConfigTemplate: `{{define "firmware"}}static.firmware.url = {{.FirmwareURL}}{{end}}`}
+	require.NoError(t, db.Create(&model).Error)
+	tenant := models.DeviceTemplate{Name: "Acme T54W", Manufacturer: "Yealink", ParentID: &model.ID,
+		IPWhitelist:    "192.0.2.10, 198.51.100.0/24",
+		ConfigTemplate: `{{define "network"}}static.network.vlan = 42{{end}}`}
+	require.NoError(t, db.Create(&tenant).Error)
+
+	chain, err := models.LoadTemplateChain(db, tenant)
+	require.NoError(t, err)
+	require.Len(t, chain, 3)
+	assert.Equal(t, "Yealink base", chain[0].Name)
+	assert.Equal(t, "Acme T54W", chain.Leaf().Name)
+	assert.Equal(t, "cfg", chain.ConfigType())
+	assert.True(t, chain.RequireHTTPS())
+	assert.Equal(t, "192.0.2.10, 198.51.100.0/24", chain.IPWhitelist())
+
+	var out strings.Builder
+	require.NoError(t, chain.Render(&out, models.ProvisioningVariables{
+		FirmwareURL: "https://pbx/fw.rom",
+		Lines:       map[int]models.LineVariables{1: {UserID: "1001"}},
+		Codecs:      models.ParseCodecs(""),
+	}))
+	// Lists and maps printed as a value render empty, not as Go syntax
+	assert.Equal(t, "account.1.user_name = 1001\n"+
+		"account.1.codecs = \n"+
+		"static.network.vlan = 42\n"+
+		"static.firmware.url = https://pbx/fw.rom\n", out.String())
+
+	// Cycles are rejected rather than walked forever
+	require.NoError(t, db.Model(&base).Update("parent_id", tenant.ID).Error)
+	_, err = models.LoadTemplateChain(db, tenant)
+	assert.Error(t, err)
+
+	assert.True(t, models.IPAllowed("", "203.0.113.5"))
+	assert.True(t, models.IPAllowed("192.0.2.10, 198.51.100.0/24", "198.51.100.77"))
+	assert.True(t, models.IPAllowed("192.0.2.10, 198.51.100.0/24", "192.0.2.10"))
+	assert.False(t, models.IPAllowed("192.0.2.10, 198.51.100.0/24", "192.0.2.11"))
+	assert.False(t, models.IPAllowed("not-a-cidr/99", "192.0.2.11"))
+}
+
+func TestVoicemailGroupsAndLists(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.VoicemailBox{}, &models.VoicemailMessage{},
+		&models.VoicemailBoxMember{}, &models.VoicemailDistributionList{}, &models.VoicemailListMember{}))
+
+	box := func(ext string) *models.VoicemailBox {
+		b := &models.VoicemailBox{TenantID: 1, Extension: ext}
+		require.NoError(t, db.Create(b).Error)
+		return b
+	}
+	alice, bob, sales := box("1001"), box("1002"), box("2000")
+	require.NoError(t, db.Create(&models.VoicemailBoxMember{TenantID: 1, BoxID: sales.ID, Extension: "1001"}).Error)
+
+	list := models.VoicemailDistributionList{TenantID: 1, Name: "All staff", Extension: "8000",
+		Members: []models.VoicemailListMember{{TenantID: 1, Extension: "1001"}, {TenantID: 1, Extension: "1002"}}}
+	require.NoError(t, db.Create(&list).Error)
+
+	// Lists expand to member boxes without duplicates
+	boxes, missing := models.ResolveVoicemailTargets(db, 1, []string{"8000", "1002", "2000", "9999"})
+	assert.Equal(t, []string{"9999"}, missing)
+	var exts []string
+	for _, b := range boxes {
+		exts = append(exts, b.Extension)
+	}
+	assert.Equal(t, []string{"1001", "1002", "2000"}, exts)
+
+	// A group box lights its members' lamps alongside their own box
+	original := models.VoicemailMessage{BoxID: bob.ID, TenantID: 1, FilePath: "/vm/1.wav", IsNew: true}
+	require.NoError(t, db.Create(&original).Error)
+	cp, err := original.CopyTo(db, sales, "1002", "/vm/1_intro.wav")
+	require.NoError(t, err)
+	assert.Equal(t, original.ID, *cp.ForwardedFromID)
+	assert.Equal(t, 1, sales.NewMessages)
+
+	assert.Equal(t, []string{"2000", "1001"}, models.VoicemailMWIAccounts(db, sales))
+	newMsgs, saved := models.VoicemailWaiting(db, 1, "1001")
+	assert.Equal(t, 1, newMsgs)
+	assert.Equal(t, 0, saved)
+	newMsgs, _ = models.VoicemailWaiting(db, 1, "1002")
+	assert.Equal(t, 1, newMsgs)
+	newMsgs, _ = models.VoicemailWaiting(db, 1, alice.Extension)
+	assert.Equal(t, 1, newMsgs)
+
+	// Copies share the audio, so deleting one keeps the file
+	assert.True(t, models.VoicemailFileInUse(db, "/vm/1.wav", original.ID))
+	require.NoError(t, db.Delete(cp).Error)
+	assert.False(t, models.VoicemailFileInUse(db, "/vm/1.wav", original.ID))
+	assert.False(t, models.VoicemailFileInUse(db, "/vm/1_intro.wav", 0))
+}
+
+func TestRecipientsAppended(t *testing.T) {
+	prev := []string{"15551230001", "15551230002,America/Chicago"}
+	assert.True(t, models.RecipientsAppended(prev, prev))
+	assert.True(t, models.RecipientsAppended(prev, append([]string{"15551230001", "15551230002,America/Chicago"}, "15551230003")))
+	assert.False(t, models.RecipientsAppended(prev, []string{"15551230001"}), "removed")
+	assert.False(t, models.RecipientsAppended(prev, []string{"15551230002,America/Chicago", "15551230001"}), "reordered")
+	assert.False(t, models.RecipientsAppended(prev, []string{"15551230001", "15551239999"}), "edited")
+}
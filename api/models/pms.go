@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PMSLinkStatus is the state of the connection to a property management system
+type PMSLinkStatus string
+
+const (
+	PMSLinkDisabled     PMSLinkStatus = "disabled"
+	PMSLinkConnecting   PMSLinkStatus = "connecting"
+	PMSLinkUp           PMSLinkStatus = "up"
+	PMSLinkDown         PMSLinkStatus = "down"
+	PMSLinkDisconnected PMSLinkStatus = "disconnected"
+)
+
+// PMSInterface is a tenant's link to its hotel property management system.
+// The PBX connects to the PMS interface server (e.g. Oracle OPERA IFC) and
+// exchanges FIAS records over TCP.
+type PMSInterface struct {
+	gorm.Model
+	TenantID uint   `json:"tenant_id" gorm:"uniqueIndex"`
+	Enabled  bool   `json:"enabled" gorm:"default:false"`
+	Protocol string `json:"protocol" gorm:"default:'fias'"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+
+	// Behaviour
+	PostCharges         bool `json:"post_charges" gorm:"default:true"`          // post outbound call charges to the guest folio
+	PostFreeCalls       bool `json:"post_free_calls" gorm:"default:false"`      // also post calls rated at zero
+	PurgeVoicemail      bool `json:"purge_voicemail" gorm:"default:true"`       // delete room voicemail on check-out
+	UpdateCallerID      bool `json:"update_caller_id" gorm:"default:true"`      // show the guest name as the room's caller ID
+	ReportWakeupResults bool `json:"report_wakeup_results" gorm:"default:true"` // send wake-up answers back to the PMS
+
+	// Link state (maintained by the connector)
+	LinkStatus    PMSLinkStatus `json:"link_status" gorm:"default:'disabled'"`
+	LinkError     string        `json:"link_error,omitempty"`
+	LastRecordAt  *time.Time    `json:"last_record_at,omitempty"`
+	LastConnectAt *time.Time    `json:"last_connect_at,omitempty"`
+}
+
+// PMSPostingStatus is the state of a call charge posted to the PMS
+type PMSPostingStatus string
+
+const (
+	PMSPostingPending  PMSPostingStatus = "pending"  // sent, waiting for the posting answer
+	PMSPostingPosted   PMSPostingStatus = "posted"   // accepted by the PMS
+	PMSPostingRejected PMSPostingStatus = "rejected" // refused by the PMS (e.g. guest checked out)
+)
+
+// PMSPosting is an outbound call charged to a guest folio. One row per CDR;
+// the ID doubles as the FIAS posting sequence number (P#).
+type PMSPosting struct {
+	ID           uint             `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time        `json:"created_at" gorm:"index"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	TenantID     uint             `json:"tenant_id" gorm:"index"`
+	RoomID       uint             `json:"room_id" gorm:"index"`
+	RoomNumber   string           `json:"room_number"`
+	GuestName    string           `json:"guest_name"`
+	CallRecordID uint             `json:"call_record_id" gorm:"uniqueIndex"`
+	CallUUID     string           `json:"call_uuid"`
+	DialedNumber string           `json:"dialed_number"`
+	StartTime    time.Time        `json:"start_time"`
+	Duration     int              `json:"duration"` // billable seconds
+	Amount       int64            `json:"amount"`   // minor currency units (cents)
+	Currency     string           `json:"currency"`
+	Status       PMSPostingStatus `json:"status" gorm:"index"`
+	AnswerStatus string           `json:"answer_status,omitempty"` // FIAS AS field from the posting answer
+	Attempts     int              `json:"attempts"`
+	PostedAt     *time.Time       `json:"posted_at,omitempty"`
+}
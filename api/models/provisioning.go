@@ -147,12 +147,17 @@ func DeprovisionTenant(db *gorm.DB, tenantID uint) error {
 			{"destinations", &Destination{}},
 			{"call_blocks", &CallBlock{}},
 			// --- Voicemail ---
+			{"voicemail_list_members", &VoicemailListMember{}},
+			{"voicemail_distribution_lists", &VoicemailDistributionList{}},
+			{"voicemail_box_members", &VoicemailBoxMember{}},
 			{"voicemail_messages", &VoicemailMessage{}},
 			{"voicemail_boxes", &VoicemailBox{}},
 			// --- Ring groups ---
 			{"ring_group_destinations", &RingGroupDestination{}},
 			{"ring_groups", &RingGroup{}},
 			// --- Queues ---
+			{"call_center_events", &CallCenterEvent{}},
+			{"queue_callbacks", &QueueCallback{}},
 			{"queue_agents", &QueueAgent{}},
 			{"queues", &Queue{}},
 			// --- IVR ---
@@ -164,6 +169,8 @@ func DeprovisionTenant(db *gorm.DB, tenantID uint) error {
 			{"call_flows", &CallFlow{}},
 			{"holiday_lists", &HolidayList{}},
 			// --- Conferences ---
+			{"conference_meeting_attendees", &ConferenceMeetingAttendee{}},
+			{"conference_meetings", &ConferenceMeeting{}},
 			{"conference_participants", &ConferenceParticipant{}},
 			{"conference_sessions", &ConferenceSession{}},
 			{"conference_members", &ConferenceMember{}},
@@ -174,17 +181,23 @@ func DeprovisionTenant(db *gorm.DB, tenantID uint) error {
 			{"call_recordings", &CallRecording{}},
 			{"recordings", &Recording{}},
 			// --- Devices ---
+			{"device_provision_logs", &DeviceProvisionLog{}},
 			{"device_lines", &DeviceLine{}},
 			{"devices", &Device{}},
 			{"device_profiles", &DeviceProfile{}},
 			{"client_registrations", &ClientRegistration{}},
 			// --- Contact & messaging ---
+			{"contact_sync_runs", &ContactSyncRun{}},
+			{"contact_webhooks", &ContactWebhook{}},
 			{"contacts", &Contact{}},
 			{"message_media", &MessageMedia{}},
 			{"messages", &Message{}},
 			{"conversations", &Conversation{}},
 			{"sms_number_assignments", &SMSNumberAssignment{}},
 			{"message_queue_items", &MessageQueueItem{}},
+			{"messaging_consents", &MessagingConsent{}},
+			{"messaging_campaigns", &MessagingCampaign{}},
+			{"messaging_brands", &MessagingBrand{}},
 			// --- Chat ---
 			{"chat_messages", &ChatMessage{}},
 			{"chat_room_members", &ChatRoomMember{}},
@@ -202,14 +215,22 @@ func DeprovisionTenant(db *gorm.DB, tenantID uint) error {
 			{"fax_endpoints", &FaxEndpoint{}},
 			{"fax_boxes", &FaxBox{}},
 			// --- Hospitality ---
+			{"pms_postings", &PMSPosting{}},
+			{"pms_interfaces", &PMSInterface{}},
+			{"hotel_room_events", &HotelRoomEvent{}},
 			{"hotel_rooms", &HotelRoom{}},
 			// --- Broadcasts ---
+			{"broadcast_results", &BroadcastResult{}},
+			{"broadcast_recipients", &BroadcastRecipient{}},
 			{"broadcasts", &BroadcastCampaign{}},
 			// --- CDR / Audit ---
 			{"cdr_records", &CallRecord{}},
+			{"fraud_events", &FraudEvent{}},
+			{"fraud_policies", &FraudPolicy{}},
 			{"audit_logs", &AuditLog{}},
 			// --- Media ---
 			{"media_files", &MediaFile{}},
+			{"storage_objects", &StorageObject{}},
 			// --- Provisioning ---
 			{"provisioning_variables", &ProvisioningVariable{}},
 			{"provisioning_templates", &ProvisioningTemplate{}},
@@ -70,6 +70,9 @@ type Queue struct {
 	BusyDelayTime     int `json:"busy_delay_time" gorm:"default:60"`   // After busy
 	NoAnswerDelayTime int `json:"no_answer_delay_time" gorm:"default:60"`
 
+	// Service level: share of callers answered within this many seconds
+	ServiceLevelSeconds int `json:"service_level_seconds" gorm:"default:20"`
+
 	// Announcements
 	AnnounceSound     string `json:"announce_sound"`     // Periodic announcement
 	AnnounceFrequency int    `json:"announce_frequency"` // Seconds between
@@ -77,8 +80,11 @@ type Queue struct {
 	AnnounceWaitTime  bool   `json:"announce_wait_time" gorm:"default:false"`
 
 	// Callback
-	CallbackEnabled   bool `json:"callback_enabled" gorm:"default:false"`
-	CallbackThreshold int  `json:"callback_threshold" gorm:"default:5"` // Position threshold to offer callback
+	CallbackEnabled    bool  `json:"callback_enabled" gorm:"default:false"`
+	CallbackThreshold  int   `json:"callback_threshold" gorm:"default:5"`     // Position threshold to offer callback
+	CallbackRetryDelay int   `json:"callback_retry_delay" gorm:"default:120"` // Seconds between attempts to reach the caller
+	CallbackExpiry     int   `json:"callback_expiry" gorm:"default:240"`      // Minutes before an unserved request expires
+	BusinessHoursID    *uint `json:"business_hours_id" gorm:"index"`          // TimeCondition; callbacks are only placed while it matches
 
 	// Exit destinations
 	ExitAction      string `json:"exit_action"`      // hangup, transfer
@@ -154,6 +160,17 @@ type QueueStatistics struct {
 	LastUpdated     time.Time `json:"last_updated"`
 }
 
+// Queue callback states
+const (
+	QueueCallbackPending   = "pending"   // waiting for its turn and a free agent
+	QueueCallbackCalling   = "calling"   // agent or caller leg in progress
+	QueueCallbackRetry     = "retry"     // caller not reached, waiting for NextAttemptAt
+	QueueCallbackCompleted = "completed" // caller bridged to an agent
+	QueueCallbackFailed    = "failed"    // MaxAttempts reached
+	QueueCallbackExpired   = "expired"   // not served within the queue's CallbackExpiry
+	QueueCallbackCancelled = "cancelled" // cancelled through the API
+)
+
 // QueueCallback represents a callback request from a caller in queue
 type QueueCallback struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
@@ -170,11 +187,18 @@ type QueueCallback struct {
 	CallerName     string `json:"caller_name"`
 	CallbackNumber string `json:"callback_number" gorm:"not null"` // May differ from caller
 
-	// Status: pending, calling, completed, failed, expired
-	Status      string     `json:"status" gorm:"default:'pending'"`
-	RequestedAt time.Time  `json:"requested_at"`
-	CalledAt    *time.Time `json:"called_at,omitempty"`
-	CompletedAt *time.Time `json:"completed_at,omitempty"`
-	Attempts    int        `json:"attempts" gorm:"default:0"`
-	MaxAttempts int        `json:"max_attempts" gorm:"default:3"`
+	// Status: pending, calling, retry, completed, failed, expired, cancelled
+	Status        string     `json:"status" gorm:"default:'pending';index"`
+	RequestedAt   time.Time  `json:"requested_at" gorm:"index"` // the caller's virtual place in line
+	Position      int        `json:"position"`                  // position in queue when the callback was accepted
+	CalledAt      *time.Time `json:"called_at,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	MaxAttempts   int        `json:"max_attempts" gorm:"default:3"`
+
+	// Last attempt
+	AgentName   string `json:"agent_name,omitempty"`
+	CallUUID    string `json:"call_uuid,omitempty"`
+	HangupCause string `json:"hangup_cause,omitempty"`
 }
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RateDeck is a priced list of dialing prefixes. The same deck type serves
+// as a retail deck (assigned to tenants or tenant profiles, fills
+// CallRecord.Cost) and as a carrier deck (assigned to gateways, fills
+// CallRecord.CarrierCost).
+type RateDeck struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UUID      uuid.UUID      `json:"uuid" gorm:"type:uuid;uniqueIndex;not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Name        string `json:"name" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+	Currency    string `json:"currency" gorm:"default:'USD'"`
+	Enabled     bool   `json:"enabled" gorm:"default:true"`
+
+	// Billing increments in seconds: the first InitialIncrement seconds are
+	// charged as a block, then every started Increment. 60/60 bills whole
+	// minutes, 6/6 bills tenths of a minute, 30/6 has a 30s minimum.
+	InitialIncrement int `json:"initial_increment" gorm:"default:60"`
+	Increment        int `json:"increment" gorm:"default:60"`
+
+	// Populated by list endpoints
+	EntryCount int64 `json:"entry_count" gorm:"-"`
+}
+
+// BeforeCreate generates UUID
+func (d *RateDeck) BeforeCreate(tx *gorm.DB) error {
+	d.UUID = uuid.New()
+	return nil
+}
+
+// RateDeckEntry prices one destination prefix. Numbers are matched on the
+// longest prefix in the deck.
+type RateDeckEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	RateDeckID uint      `json:"rate_deck_id" gorm:"uniqueIndex:idx_rate_deck_prefix;not null"`
+
+	Prefix      string `json:"prefix" gorm:"uniqueIndex:idx_rate_deck_prefix;not null"` // digits only, e.g. "1", "44", "4420"
+	Description string `json:"description"`                                             // destination name, e.g. "UK - London"
+
+	Rate          float64 `json:"rate" gorm:"type:decimal(10,6)"`           // per minute
+	ConnectionFee float64 `json:"connection_fee" gorm:"type:decimal(10,4)"` // charged once per answered call
+
+	// Per-destination increments; 0 uses the deck's
+	InitialIncrement int `json:"initial_increment"`
+	Increment        int `json:"increment"`
+}
+
+// ParseIncrements reads billing increments written as "initial/increment"
+// ("6/6", "60/60", "30/6") or a single number used for both
+func ParseIncrements(s string) (initial, increment int, err error) {
+	first, rest, found := strings.Cut(strings.TrimSpace(s), "/")
+	if initial, err = strconv.Atoi(strings.TrimSpace(first)); err != nil {
+		return 0, 0, fmt.Errorf("invalid increments %q", s)
+	}
+	increment = initial
+	if found {
+		if increment, err = strconv.Atoi(strings.TrimSpace(rest)); err != nil {
+			return 0, 0, fmt.Errorf("invalid increments %q", s)
+		}
+	}
+	if initial < 1 || increment < 1 {
+		return 0, 0, fmt.Errorf("invalid increments %q: must be at least 1 second", s)
+	}
+	return initial, increment, nil
+}
+
+// Increments returns the entry's effective increments within deck
+func (e *RateDeckEntry) Increments(deck *RateDeck) (initial, increment int) {
+	initial, increment = deck.InitialIncrement, deck.Increment
+	if e.InitialIncrement > 0 {
+		initial = e.InitialIncrement
+	}
+	if e.Increment > 0 {
+		increment = e.Increment
+	}
+	return max(initial, 1), max(increment, 1)
+}
+
+// BilledSeconds rounds an answered call's duration up to the increments.
+// Unanswered calls bill nothing.
+func BilledSeconds(billable, initial, increment int) int {
+	if billable <= 0 {
+		return 0
+	}
+	if billable <= initial {
+		return initial
+	}
+	blocks := (billable - initial + increment - 1) / increment
+	return initial + blocks*increment
+}
+
+// Charge prices billable seconds with the entry: the connection fee plus
+// the per-minute rate over the billed seconds, rounded to 4 decimals to
+// match the cost columns
+func (e *RateDeckEntry) Charge(deck *RateDeck, billable int) (cost float64, billed int) {
+	initial, increment := e.Increments(deck)
+	billed = BilledSeconds(billable, initial, increment)
+	if billed == 0 {
+		return 0, 0
+	}
+	cost = e.ConnectionFee + e.Rate*float64(billed)/60
+	return math.Round(cost*10000) / 10000, billed
+}
@@ -15,6 +15,7 @@ const (
 	TranscriptionProcessing TranscriptionStatus = "processing"
 	TranscriptionCompleted  TranscriptionStatus = "completed"
 	TranscriptionFailed     TranscriptionStatus = "failed"
+	TranscriptionSkipped    TranscriptionStatus = "skipped" // Did not match tenant transcription rules
 )
 
 // TranscriptionProvider represents supported transcription providers
@@ -69,9 +70,15 @@ type CallRecording struct {
 	StorageURL  string `json:"storage_url,omitempty"` // URL if cloud storage
 
 	// Retention
-	RetentionDays int       `json:"retention_days"`       // Days to keep
-	ExpiresAt     time.Time `json:"expires_at,omitempty"` // Auto-delete date
-	Archived      bool      `json:"archived" gorm:"default:false"`
+	RetentionDays int        `json:"retention_days"`                    // Days to keep
+	ExpiresAt     time.Time  `json:"expires_at,omitempty" gorm:"index"` // Auto-delete date (zero = keep)
+	Archived      bool       `json:"archived" gorm:"default:false"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+
+	// Legal hold exempts the recording from retention and quota rotation
+	LegalHold       bool       `json:"legal_hold" gorm:"default:false;index"`
+	LegalHoldReason string     `json:"legal_hold_reason,omitempty"`
+	LegalHoldAt     *time.Time `json:"legal_hold_at,omitempty"`
 
 	// Access Control
 	IsConfidential bool `json:"is_confidential" gorm:"default:false"`
@@ -84,12 +91,86 @@ type CallRecording struct {
 	Notes string `json:"notes,omitempty"`
 }
 
-// BeforeCreate generates UUID
+// BeforeCreate generates UUID and stamps the expiry from the tenant's
+// retention policy when the caller hasn't set one
 func (c *CallRecording) BeforeCreate(tx *gorm.DB) error {
 	c.UUID = uuid.New()
+	if c.ExpiresAt.IsZero() && c.TenantID != 0 {
+		c.ApplyRetention(LoadRecordingPolicy(tx.Session(&gorm.Session{NewDB: true}), c.TenantID))
+	}
 	return nil
 }
 
+// ApplyRetention sets RetentionDays and ExpiresAt from a policy. An explicit
+// RetentionDays on the recording wins over the policy default.
+func (c *CallRecording) ApplyRetention(p RecordingPolicy) {
+	if c.RetentionDays == 0 {
+		c.RetentionDays = p.RetentionDays
+	}
+	if c.RetentionDays <= 0 {
+		c.ExpiresAt = time.Time{}
+		return
+	}
+
+	start := c.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	c.ExpiresAt = start.AddDate(0, 0, c.RetentionDays)
+}
+
+// Recording quota actions
+const (
+	RecordingQuotaRefuse = "refuse" // Block new recordings while over quota
+	RecordingQuotaRotate = "rotate" // Delete the oldest recordings to make room
+)
+
+// RecordingPolicy is a tenant's effective recording retention and storage
+// policy, combining its RecordingConfig with its TenantProfile limits
+type RecordingPolicy struct {
+	RetentionDays        int    `json:"retention_days"` // 0 = keep forever
+	QuotaBytes           int64  `json:"quota_bytes"`    // 0 = unlimited
+	AutoDeleteExpired    bool   `json:"auto_delete_expired"`
+	ArchiveBeforeDelete  bool   `json:"archive_before_delete"`
+	ArchiveRetentionDays int    `json:"archive_retention_days"` // 0 = keep archives forever
+	QuotaAction          string `json:"quota_action"`
+}
+
+// LoadRecordingPolicy resolves the policy for a tenant. The tenant's own
+// retention setting applies but can't exceed the profile's retention cap.
+func LoadRecordingPolicy(db *gorm.DB, tenantID uint) RecordingPolicy {
+	p := RecordingPolicy{
+		RetentionDays:        90,
+		AutoDeleteExpired:    true,
+		ArchiveRetentionDays: 365,
+		QuotaAction:          RecordingQuotaRefuse,
+	}
+
+	var cfg RecordingConfig
+	if err := db.Where("tenant_id = ?", tenantID).First(&cfg).Error; err == nil {
+		p.RetentionDays = cfg.RetentionDays
+		p.AutoDeleteExpired = cfg.AutoDeleteExpired
+		p.ArchiveBeforeDelete = cfg.ArchiveBeforeDelete
+		p.ArchiveRetentionDays = cfg.ArchiveRetentionDays
+		if cfg.QuotaAction == RecordingQuotaRotate {
+			p.QuotaAction = RecordingQuotaRotate
+		}
+	}
+
+	var tenant Tenant
+	if err := db.Preload("Profile").First(&tenant, tenantID).Error; err == nil && tenant.Profile != nil {
+		profile := tenant.Profile
+		if profile.RecordingRetention > 0 && (p.RetentionDays <= 0 || p.RetentionDays > profile.RecordingRetention) {
+			p.RetentionDays = profile.RecordingRetention
+		}
+		if profile.RecordingStorage > 0 {
+			p.QuotaBytes = int64(profile.RecordingStorage) << 30
+		}
+	}
+
+	return p
+}
+
 // Transcription represents a transcription of a call recording
 type Transcription struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
@@ -101,11 +182,14 @@ type Transcription struct {
 	// Ownership
 	TenantID uint `json:"tenant_id" gorm:"index;not null"`
 
-	// Recording Reference
-	CallRecordingID uint `json:"call_recording_id" gorm:"index;not null"`
+	// Source Reference (one of recording or voicemail message)
+	CallRecordingID    uint  `json:"call_recording_id" gorm:"index"`
+	VoicemailMessageID *uint `json:"voicemail_message_id,omitempty" gorm:"index"`
 
 	// Status
-	Status           TranscriptionStatus   `json:"status" gorm:"default:'pending'"`
+	Status           TranscriptionStatus   `json:"status" gorm:"default:'pending';index"`
+	Attempts         int                   `json:"attempts" gorm:"default:0"`
+	NextAttemptAt    *time.Time            `json:"next_attempt_at,omitempty"` // Retry backoff
 	Provider         TranscriptionProvider `json:"provider"`
 	ProviderJobID    string                `json:"provider_job_id,omitempty"` // External job ID
 	ErrorMessage     string                `json:"error_message,omitempty"`
@@ -225,9 +309,11 @@ type RecordingConfig struct {
 	StorageKeyEncrypt string `json:"-"`                                   // Encrypted access key
 
 	// Retention
-	RetentionDays       int  `json:"retention_days" gorm:"default:90"`
-	AutoDeleteExpired   bool `json:"auto_delete_expired" gorm:"default:true"`
-	ArchiveBeforeDelete bool `json:"archive_before_delete" gorm:"default:false"`
+	RetentionDays        int    `json:"retention_days" gorm:"default:90"`
+	AutoDeleteExpired    bool   `json:"auto_delete_expired" gorm:"default:true"`
+	ArchiveBeforeDelete  bool   `json:"archive_before_delete" gorm:"default:false"`
+	ArchiveRetentionDays int    `json:"archive_retention_days" gorm:"default:365"` // 0 = keep archives forever
+	QuotaAction          string `json:"quota_action" gorm:"default:'refuse'"`      // refuse, rotate
 
 	// Legal/Compliance
 	AnnouncementEnabled bool   `json:"announcement_enabled" gorm:"default:false"` // "This call may be recorded"
@@ -133,7 +133,7 @@ type MessagingProvider struct {
 
 	// Provider info
 	Name     string `json:"name" gorm:"not null"`      // Display name
-	Type     string `json:"type" gorm:"not null"`      // twilio, signalwire, bandwidth, telnyx, plivo, nexmo, custom
+	Type     string `json:"type" gorm:"not null"`      // twilio, signalwire, bandwidth, telnyx, plivo, nexmo, smpp, custom
 	Priority int    `json:"priority" gorm:"default:0"` // Lower = higher priority
 
 	// API Credentials (encrypted)
@@ -147,6 +147,16 @@ type MessagingProvider struct {
 	SendEndpoint   string `json:"send_endpoint,omitempty"`   // Send message endpoint
 	StatusEndpoint string `json:"status_endpoint,omitempty"` // Status callback
 
+	// Carrier-specific settings
+	Username      string `json:"username,omitempty"`       // Bandwidth API user, SMPP system_id
+	ApplicationID string `json:"application_id,omitempty"` // Bandwidth messaging application
+
+	// SMPP bind (type smpp); the password is AuthToken
+	SMPPHost       string `json:"smpp_host,omitempty"`
+	SMPPPort       int    `json:"smpp_port,omitempty"` // Default 2775
+	SMPPSystemType string `json:"smpp_system_type,omitempty"`
+	SMPPTLS        bool   `json:"smpp_tls"`
+
 	// Webhook verification
 	WebhookSecret   string `json:"-" gorm:"column:webhook_secret"` // For verifying inbound webhooks
 	VerifySignature bool   `json:"verify_signature" gorm:"default:true"`
@@ -183,6 +193,7 @@ const (
 	ProviderNexmo      = "nexmo"
 	ProviderVonage     = "vonage"
 	ProviderCustom     = "custom"
+	ProviderSMPP       = "smpp"
 )
 
 // Chatplan represents a chatplan routing rule (SMS dialplan)
@@ -323,3 +334,16 @@ func (r *DefaultOutboundRoute) BeforeCreate(tx *gorm.DB) error {
 	r.UUID = uuid.New()
 	return nil
 }
+
+// IsInternational reports whether the route carries international calls,
+// either by its call class or by an international dialing prefix
+func (r *DefaultOutboundRoute) IsInternational() bool {
+	if r.TollAllow == "international" {
+		return true
+	}
+	switch r.DigitPrefix {
+	case "011", "00", "+":
+		return true
+	}
+	return false
+}
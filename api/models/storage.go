@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StorageCategory identifies which subsystem wrote a stored file
+type StorageCategory string
+
+const (
+	StorageCategoryRecording StorageCategory = "recording"
+	StorageCategoryVoicemail StorageCategory = "voicemail"
+	StorageCategoryFax       StorageCategory = "fax"
+	StorageCategoryMedia     StorageCategory = "media"
+	StorageCategoryTTS       StorageCategory = "tts"
+)
+
+// Evictable reports whether the local copy may be dropped once the object is
+// safely in remote storage. Media and TTS files are played directly by
+// FreeSWITCH and must stay on local disk.
+func (c StorageCategory) Evictable() bool {
+	switch c {
+	case StorageCategoryRecording, StorageCategoryVoicemail, StorageCategoryFax:
+		return true
+	}
+	return false
+}
+
+// StorageObject tracks where a file written by the platform lives. Existing
+// rows (recordings, voicemail, fax jobs, media) keep referencing the local
+// path; this table maps that path to its object in the storage backend.
+type StorageObject struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Ownership
+	TenantID uint            `json:"tenant_id" gorm:"index"`
+	Category StorageCategory `json:"category" gorm:"size:32;index"`
+
+	// Location
+	LocalPath string `json:"local_path" gorm:"size:1024;uniqueIndex"` // Canonical path used by the owning row
+	Backend   string `json:"backend" gorm:"size:16"`                  // local, s3
+	Bucket    string `json:"bucket,omitempty"`
+	Key       string `json:"key"`
+	LocalCopy bool   `json:"local_copy" gorm:"default:true"` // File still present on local disk
+
+	// Content
+	Size           int64  `json:"size"`
+	ContentType    string `json:"content_type"`
+	ChecksumSHA256 string `json:"checksum_sha256" gorm:"size:64"`
+
+	// Integrity
+	VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+	VerifyError string     `json:"verify_error,omitempty"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,6 +28,17 @@ type Tenant struct {
 	ProfileID *uint          `json:"profile_id"`
 	Profile   *TenantProfile `json:"profile,omitempty" gorm:"foreignKey:ProfileID"`
 
+	// Retail rate deck for billing; falls back to the profile's deck
+	RateDeckID *uint `json:"rate_deck_id"`
+
+	// Concurrent outbound carrier calls; nil falls back to the profile's limit
+	MaxConcurrentCalls *int `json:"max_concurrent_calls"`
+
+	// Outbound calling block, set by the fraud guard or a system admin
+	OutboundBlocked     bool       `json:"outbound_blocked" gorm:"default:false"`
+	OutboundBlockedAt   *time.Time `json:"outbound_blocked_at"`
+	OutboundBlockReason string     `json:"outbound_block_reason"`
+
 	// Whitelabel settings
 	WhitelabelEnabled bool   `json:"whitelabel_enabled" gorm:"default:false"`
 	WhitelabelLogo    string `json:"whitelabel_logo"`
@@ -59,6 +71,36 @@ func (t *Tenant) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Location returns the tenant's configured timezone from the Settings JSONB
+// ("timezone" key). Falls back to UTC when unset or unknown.
+func (t *Tenant) Location() *time.Location {
+	var settings struct {
+		Timezone string `json:"timezone"`
+	}
+	if t.Settings != "" {
+		json.Unmarshal([]byte(t.Settings), &settings)
+	}
+	if settings.Timezone != "" {
+		if loc, err := time.LoadLocation(settings.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// ConcurrentCallLimit returns the tenant's limit on simultaneous outbound
+// carrier calls (-1 = unlimited): its own override, else its profile's.
+// Profile must be preloaded for the fallback.
+func (t *Tenant) ConcurrentCallLimit() int {
+	if t.MaxConcurrentCalls != nil {
+		return *t.MaxConcurrentCalls
+	}
+	if t.Profile != nil {
+		return t.Profile.MaxConcurrentCalls
+	}
+	return -1
+}
+
 // TenantProfile defines service plan limits for a tenant
 type TenantProfile struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
@@ -94,6 +136,12 @@ type TenantProfile struct {
 	ConferencingEnabled  bool `json:"conferencing_enabled" gorm:"default:true"`
 	CallBroadcastEnabled bool `json:"call_broadcast_enabled" gorm:"default:false"`
 
+	// Default retail rate deck for tenants on this plan
+	RateDeckID *uint `json:"rate_deck_id"`
+
+	// Concurrent outbound carrier calls per tenant (-1 = unlimited)
+	MaxConcurrentCalls int `json:"max_concurrent_calls" gorm:"default:-1"`
+
 	// Associated tenants
 	Tenants []Tenant `json:"-" gorm:"foreignKey:ProfileID"`
 }
@@ -104,32 +152,82 @@ func (tp *TenantProfile) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// CheckLimit verifies if a tenant is within their profile limit
-// Returns true if within limit, false if exceeded
-func (tp *TenantProfile) CheckLimit(limitName string, currentCount int) bool {
-	var limit int
+// Tenant profile limit names
+const (
+	LimitExtensions     = "extensions"
+	LimitDevices        = "devices"
+	LimitQueues         = "queues"
+	LimitConferences    = "conferences"
+	LimitRingGroups     = "ring_groups"
+	LimitIVRMenus       = "ivr_menus"
+	LimitVoicemailBoxes = "voicemail_boxes"
+	LimitFaxServers     = "fax_servers"
+	LimitUsers          = "users"
+)
+
+// TenantLimits lists every limit with the table its usage is counted from
+var TenantLimits = []struct {
+	Name  string
+	Table string
+}{
+	{LimitExtensions, "extensions"},
+	{LimitDevices, "devices"},
+	{LimitQueues, "queues"},
+	{LimitConferences, "conferences"},
+	{LimitRingGroups, "ring_groups"},
+	{LimitIVRMenus, "ivr_menus"},
+	{LimitVoicemailBoxes, "voicemail_boxes"},
+	{LimitFaxServers, "fax_boxes"},
+	{LimitUsers, "users"},
+}
+
+// TenantFeature names a feature flag on the tenant profile
+type TenantFeature string
+
+const (
+	FeatureFax           TenantFeature = "fax"
+	FeatureSMS           TenantFeature = "sms"
+	FeatureWebRTC        TenantFeature = "webrtc"
+	FeatureConferencing  TenantFeature = "conferencing"
+	FeatureCallBroadcast TenantFeature = "call_broadcast"
+	FeatureRecording     TenantFeature = "recording"
+)
+
+// TenantFeatures lists every feature flag in display order
+var TenantFeatures = []TenantFeature{
+	FeatureFax, FeatureSMS, FeatureWebRTC, FeatureConferencing, FeatureCallBroadcast, FeatureRecording,
+}
+
+// Limit returns the configured limit for a resource (-1 = unlimited)
+func (tp *TenantProfile) Limit(limitName string) int {
 	switch limitName {
-	case "extensions":
-		limit = tp.MaxExtensions
-	case "devices":
-		limit = tp.MaxDevices
-	case "queues":
-		limit = tp.MaxQueues
-	case "conferences":
-		limit = tp.MaxConferences
-	case "ring_groups":
-		limit = tp.MaxRingGroups
-	case "ivr_menus":
-		limit = tp.MaxIVRMenus
-	case "voicemail_boxes":
-		limit = tp.MaxVoicemailBoxes
-	case "fax_servers":
-		limit = tp.MaxFaxServers
-	case "users":
-		limit = tp.MaxUsers
+	case LimitExtensions:
+		return tp.MaxExtensions
+	case LimitDevices:
+		return tp.MaxDevices
+	case LimitQueues:
+		return tp.MaxQueues
+	case LimitConferences:
+		return tp.MaxConferences
+	case LimitRingGroups:
+		return tp.MaxRingGroups
+	case LimitIVRMenus:
+		return tp.MaxIVRMenus
+	case LimitVoicemailBoxes:
+		return tp.MaxVoicemailBoxes
+	case LimitFaxServers:
+		return tp.MaxFaxServers
+	case LimitUsers:
+		return tp.MaxUsers
 	default:
-		return true // Unknown limits default to allowed
+		return -1 // Unknown limits default to allowed
 	}
+}
+
+// CheckLimit verifies if a tenant is within their profile limit
+// Returns true if within limit, false if exceeded
+func (tp *TenantProfile) CheckLimit(limitName string, currentCount int) bool {
+	limit := tp.Limit(limitName)
 
 	// -1 means unlimited
 	if limit < 0 {
@@ -138,3 +236,45 @@ func (tp *TenantProfile) CheckLimit(limitName string, currentCount int) bool {
 
 	return currentCount < limit
 }
+
+// HasFeature reports whether a feature flag is enabled on the profile
+func (tp *TenantProfile) HasFeature(feature TenantFeature) bool {
+	switch feature {
+	case FeatureFax:
+		return tp.FaxEnabled
+	case FeatureSMS:
+		return tp.SMSEnabled
+	case FeatureWebRTC:
+		return tp.WebRTCEnabled
+	case FeatureConferencing:
+		return tp.ConferencingEnabled
+	case FeatureCallBroadcast:
+		return tp.CallBroadcastEnabled
+	case FeatureRecording:
+		return tp.RecordingEnabled
+	default:
+		return true
+	}
+}
+
+// LoadTenantProfile returns the profile assigned to a tenant, or nil when the
+// tenant has none (no limits apply)
+func LoadTenantProfile(db *gorm.DB, tenantID uint) *TenantProfile {
+	var tenant Tenant
+	if err := db.Preload("Profile").Select("id", "profile_id").First(&tenant, tenantID).Error; err != nil {
+		return nil
+	}
+	return tenant.Profile
+}
+
+// CountTenantResource counts a tenant's live rows for a limit name
+func CountTenantResource(db *gorm.DB, tenantID uint, limitName string) (int64, error) {
+	for _, l := range TenantLimits {
+		if l.Name == limitName {
+			var count int64
+			err := db.Table(l.Table).Where("tenant_id = ? AND deleted_at IS NULL", tenantID).Count(&count).Error
+			return count, err
+		}
+	}
+	return 0, nil
+}
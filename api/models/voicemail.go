@@ -42,6 +42,10 @@ type VoicemailBox struct {
 
 	// Relations
 	Messages []VoicemailMessage `json:"messages,omitempty" gorm:"foreignKey:BoxID"`
+
+	// Group (shared) mailbox: members can check it from their own phones
+	// and their MWI lamps count its messages
+	Members []VoicemailBoxMember `json:"members,omitempty" gorm:"foreignKey:BoxID"`
 }
 
 // BeforeCreate generates UUID
@@ -73,12 +77,24 @@ type VoicemailMessage struct {
 	Transcription string    `json:"transcription,omitempty"`
 	RecordedAt    time.Time `json:"recorded_at"`
 
+	// Speech-to-text state (see services/transcription)
+	TranscriptionStatus TranscriptionStatus `json:"transcription_status" gorm:"default:'pending';index"`
+
+	// The notification email waits for the transcript (box TranscriptionEmail)
+	NotifyPending bool `json:"-" gorm:"default:false"`
+
 	// Status
 	IsNew       bool       `json:"is_new" gorm:"default:true;index"`
 	IsUrgent    bool       `json:"is_urgent" gorm:"default:false"`
 	ReadAt      *time.Time `json:"read_at,omitempty"`
 	ForwardedTo string     `json:"forwarded_to,omitempty"`
 
+	// Forwarded copies share the original's audio and may carry a spoken
+	// introduction from the forwarder, played before the message
+	ForwardedFromID *uint  `json:"forwarded_from_id,omitempty"`
+	ForwardedBy     string `json:"forwarded_by,omitempty"`
+	IntroPath       string `json:"intro_path,omitempty"`
+
 	// FreeSWITCH reference
 	ChannelUUID string `json:"channel_uuid"` // For correlation
 }
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VoicemailBoxMember gives an extension access to a group (shared) mailbox.
+// Members check it from their own phone and their MWI lamp counts its
+// messages alongside their personal box.
+type VoicemailBoxMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	TenantID  uint      `json:"tenant_id" gorm:"index;not null"`
+	BoxID     uint      `json:"box_id" gorm:"uniqueIndex:idx_vm_box_member;not null"`
+	Extension string    `json:"extension" gorm:"uniqueIndex:idx_vm_box_member;index;not null"`
+}
+
+// VoicemailDistributionList is a voicemail-only number: a message left on
+// it is copied to the mailbox of every member extension
+type VoicemailDistributionList struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UUID      uuid.UUID      `json:"uuid" gorm:"type:uuid;uniqueIndex;not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	TenantID  uint   `json:"tenant_id" gorm:"index;not null"`
+	Name      string `json:"name" gorm:"not null"`
+	Extension string `json:"extension" gorm:"index;not null"` // List number callers dial
+	Enabled   bool   `json:"enabled" gorm:"default:true"`
+
+	// Recording settings; without a greeting callers hear the record prompt
+	GreetingPath   string `json:"greeting_path"`
+	MaxMessageSecs int    `json:"max_message_secs" gorm:"default:180"`
+
+	Members []VoicemailListMember `json:"members,omitempty" gorm:"foreignKey:ListID"`
+}
+
+// BeforeCreate generates UUID
+func (l *VoicemailDistributionList) BeforeCreate(tx *gorm.DB) error {
+	l.UUID = uuid.New()
+	return nil
+}
+
+// VoicemailListMember is an extension whose mailbox receives a list's messages
+type VoicemailListMember struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	TenantID  uint   `json:"tenant_id" gorm:"index;not null"`
+	ListID    uint   `json:"list_id" gorm:"uniqueIndex:idx_vm_list_member;not null"`
+	Extension string `json:"extension" gorm:"uniqueIndex:idx_vm_list_member;not null"`
+}
+
+// VoicemailMWIAccounts returns the extensions whose MWI lamps reflect a
+// box: its own extension plus the members of a group box
+func VoicemailMWIAccounts(db *gorm.DB, box *VoicemailBox) []string {
+	accounts := []string{box.Extension}
+	var members []string
+	db.Model(&VoicemailBoxMember{}).Where("box_id = ?", box.ID).Pluck("extension", &members)
+	for _, ext := range members {
+		if ext != box.Extension {
+			accounts = append(accounts, ext)
+		}
+	}
+	return accounts
+}
+
+// VoicemailWaiting counts the new and saved messages an extension's MWI lamp
+// shows: its own mailbox plus every group mailbox it belongs to
+func VoicemailWaiting(db *gorm.DB, tenantID uint, extension string) (newMsgs, savedMsgs int) {
+	boxIDs := db.Model(&VoicemailBox{}).Select("id").
+		Where("tenant_id = ? AND enabled = ?", tenantID, true).
+		Where("extension = ? OR id IN (?)", extension,
+			db.Model(&VoicemailBoxMember{}).Select("box_id").Where("tenant_id = ? AND extension = ?", tenantID, extension))
+
+	var counts []struct {
+		IsNew bool
+		Count int
+	}
+	db.Model(&VoicemailMessage{}).Select("is_new, COUNT(*) AS count").
+		Where("box_id IN (?)", boxIDs).Group("is_new").Scan(&counts)
+	for _, c := range counts {
+		if c.IsNew {
+			newMsgs = c.Count
+		} else {
+			savedMsgs = c.Count
+		}
+	}
+	return newMsgs, savedMsgs
+}
+
+// RefreshVoicemailCounts recounts a box's new and saved message stats
+func RefreshVoicemailCounts(db *gorm.DB, box *VoicemailBox) {
+	var newCount, savedCount int64
+	db.Model(&VoicemailMessage{}).Where("box_id = ? AND is_new = ?", box.ID, true).Count(&newCount)
+	db.Model(&VoicemailMessage{}).Where("box_id = ? AND is_new = ?", box.ID, false).Count(&savedCount)
+	box.NewMessages, box.SavedMessages = int(newCount), int(savedCount)
+	db.Model(box).Updates(map[string]interface{}{"new_messages": box.NewMessages, "saved_messages": box.SavedMessages})
+}
+
+// ResolveVoicemailTargets turns extension and distribution-list numbers
+// into the enabled mailboxes they deliver to, without duplicates. Numbers
+// matching neither are returned as missing.
+func ResolveVoicemailTargets(db *gorm.DB, tenantID uint, targets []string) (boxes []VoicemailBox, missing []string) {
+	seen := make(map[uint]bool)
+	add := func(extension string) bool {
+		var box VoicemailBox
+		if err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", tenantID, extension, true).
+			First(&box).Error; err != nil {
+			return false
+		}
+		if !seen[box.ID] {
+			seen[box.ID] = true
+			boxes = append(boxes, box)
+		}
+		return true
+	}
+
+	for _, target := range targets {
+		if target == "" || add(target) {
+			continue
+		}
+		var list VoicemailDistributionList
+		if err := db.Preload("Members").
+			Where("tenant_id = ? AND extension = ? AND enabled = ?", tenantID, target, true).
+			First(&list).Error; err != nil {
+			missing = append(missing, target)
+			continue
+		}
+		for _, m := range list.Members {
+			add(m.Extension)
+		}
+	}
+	return boxes, missing
+}
+
+// CopyTo delivers a copy of the message to another box. The copy shares
+// the original's audio file; introPath optionally adds a spoken intro.
+func (v *VoicemailMessage) CopyTo(db *gorm.DB, box *VoicemailBox, forwardedBy, introPath string) (*VoicemailMessage, error) {
+	cp := &VoicemailMessage{
+		BoxID:          box.ID,
+		TenantID:       box.TenantID,
+		CallerIDName:   v.CallerIDName,
+		CallerIDNumber: v.CallerIDNumber,
+		Duration:       v.Duration,
+		FilePath:       v.FilePath, // Shared file reference
+		FileSize:       v.FileSize,
+		RecordedAt:     v.RecordedAt,
+		IsNew:          true,
+		IsUrgent:       v.IsUrgent,
+		ForwardedBy:    forwardedBy,
+		IntroPath:      introPath,
+		ChannelUUID:    v.ChannelUUID,
+	}
+	// A finished transcript carries over; otherwise the copy is left pending
+	// for the tenant's auto-transcription rules
+	if v.TranscriptionStatus == TranscriptionCompleted {
+		cp.Transcription = v.Transcription
+		cp.TranscriptionStatus = TranscriptionCompleted
+	}
+	if v.ID != 0 {
+		cp.ForwardedFromID = &v.ID
+	}
+	if err := db.Create(cp).Error; err != nil {
+		return nil, err
+	}
+	RefreshVoicemailCounts(db, box)
+	return cp, nil
+}
+
+// VoicemailFileInUse reports whether any message other than exceptID still
+// plays the file, as audio or intro, so deleting one copy keeps it
+func VoicemailFileInUse(db *gorm.DB, path string, exceptID uint) bool {
+	if path == "" {
+		return false
+	}
+	var count int64
+	db.Model(&VoicemailMessage{}).
+		Where("(file_path = ? OR intro_path = ?) AND id <> ?", path, path, exceptID).
+		Count(&count)
+	return count > 0
+}
@@ -5,8 +5,10 @@ import (
 	"callsign/handlers"
 	"callsign/handlers/freeswitch"
 	"callsign/middleware"
+	"callsign/models"
 	"callsign/services/esl/modules/conference"
 	"callsign/services/fax"
+	"callsign/services/fraud"
 	"callsign/services/messaging"
 	"callsign/services/websocket"
 
@@ -22,11 +24,13 @@ type Router struct {
 	Config            *config.Config
 	Auth              *middleware.AuthMiddleware
 	Tenant            *middleware.TenantMiddleware
+	Plan              *middleware.PlanMiddleware
 	Handler           *handlers.Handler
 	FSHandler         *freeswitch.FSHandler
 	ConferenceHandler *handlers.ConferenceHandler
 	FaxHandler        *handlers.FaxHandler
 	SMSNumberHandler  *handlers.SMSNumberHandler
+	ChatplanHandler   *handlers.ChatplanHandler
 	WebhookHandler    *handlers.WebhookHandler
 	MsgManager        *messaging.Manager
 	WSHub             *websocket.Hub
@@ -55,17 +59,25 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 	fsHandler := freeswitch.NewFSHandler(db, cfg)
 	h.SetXMLCache(fsHandler.Cache)
 
+	// Toll-fraud guard: checks carrier CDRs as FreeSWITCH posts them and
+	// drops a tenant's cached dialplan when its outbound block changes
+	fraudGuard := fraud.NewGuard(db, fsHandler.Cache, wsHub)
+	fsHandler.Fraud = fraudGuard
+	h.SetFraudGuard(fraudGuard)
+
 	return &Router{
 		App:               fiber.New(),
 		DB:                db,
 		Config:            cfg,
 		Auth:              middleware.NewAuthMiddleware(cfg, db),
 		Tenant:            middleware.NewTenantMiddleware(db),
+		Plan:              middleware.NewPlanMiddleware(db),
 		Handler:           h,
 		FSHandler:         fsHandler,
 		ConferenceHandler: handlers.NewConferenceHandler(db, nil),
 		FaxHandler:        handlers.NewFaxHandler(h, nil),
 		SMSNumberHandler:  handlers.NewSMSNumberHandler(db),
+		ChatplanHandler:   handlers.NewChatplanHandler(db, msgManager),
 		WebhookHandler:    handlers.NewWebhookHandler(msgManager),
 		MsgManager:        msgManager,
 		WSHub:             wsHub,
@@ -125,11 +137,14 @@ func (r *Router) Init() {
 	// Public WebSocket routes (auth handled inside handler via first message)
 	api.Get("/system/console", r.Handler.FreeSwitchConsole)
 	api.Get("/ws/notifications", r.Handler.NotificationWebSocket)
+	api.Get("/ws/wallboard", r.Handler.WallboardWebSocket)
 
 	// Device provisioning (public, authenticated via tenant secret in URL)
 	// URL format: /provision/{tenant_uuid}/{secret}/{mac}.cfg
 	provision := api.Group("/provision")
 	provision.Get("/:tenant/:secret/:mac", r.Handler.GetDeviceConfigSecure)
+	provision.Get("/:tenant/:secret/:mac/firmware/:filename", r.Handler.DownloadDeviceFirmware)
+	provision.Get("/:tenant/:secret/:mac/directory", r.Handler.DeviceDirectory)
 
 	// Internal routes (authenticated via X-Internal-Key header)
 	// These are for internal services like fail2ban
@@ -187,6 +202,7 @@ func (r *Router) Init() {
 	tenant.Put("/messaging", r.Handler.UpdateTenantMessaging)
 	tenant.Get("/hospitality", r.Handler.GetTenantHospitality)
 	tenant.Put("/hospitality", r.Handler.UpdateTenantHospitality)
+	tenant.Get("/usage", r.Handler.GetTenantUsage)
 
 	// E911 Locations
 	tenant.Get("/locations", r.Handler.ListLocations)
@@ -198,7 +214,7 @@ func (r *Router) Init() {
 	// Extensions
 	extensions := tenantScoped.Group("/extensions")
 	extensions.Get("/", r.Handler.ListExtensions)
-	extensions.Post("/", r.Handler.CreateExtension)
+	extensions.Post("/", r.Plan.EnforceLimit(models.LimitExtensions), r.Handler.CreateExtension)
 	extensions.Get("/:ext", r.Handler.GetExtension)
 	extensions.Put("/:ext", r.Handler.UpdateExtension)
 	extensions.Delete("/:ext", r.Handler.DeleteExtension)
@@ -210,6 +226,7 @@ func (r *Router) Init() {
 	extensions.Put("/:ext/call-rules/:ruleId", r.Handler.UpdateCallHandlingRule)
 	extensions.Delete("/:ext/call-rules/:ruleId", r.Handler.DeleteCallHandlingRule)
 	extensions.Post("/:ext/call-rules/reorder", r.Handler.ReorderCallHandlingRules)
+	extensions.Post("/:ext/call-rules/evaluate", r.Handler.EvaluateCallHandlingRules)
 
 	// Extension Profiles
 	extProfiles := tenantScoped.Group("/extension-profiles")
@@ -229,13 +246,16 @@ func (r *Router) Init() {
 	// Devices
 	devices := tenantScoped.Group("/devices")
 	devices.Get("/", r.Handler.ListDevices)
-	devices.Post("/", r.Handler.CreateDevice)
+	devices.Get("/preview/:mac", r.Handler.PreviewDeviceConfig)
+	devices.Post("/", r.Plan.EnforceLimit(models.LimitDevices), r.Handler.CreateDevice)
 	devices.Get("/:id", r.Handler.GetDevice)
 	devices.Put("/:id", r.Handler.UpdateDevice)
 	devices.Delete("/:id", r.Handler.DeleteDevice)
 	devices.Post("/:id/assign-user", r.Handler.AssignDeviceToUser)
 	devices.Post("/:id/assign-profile", r.Handler.AssignDeviceToProfile)
 	devices.Post("/:id/reprovision", r.Handler.ReprovisionDevice)
+	devices.Get("/:id/provision-log", r.Handler.ListDeviceProvisionLog)
+	devices.Get("/:id/config-diff", r.Handler.GetDeviceConfigDiff)
 	devices.Post("/:id/reboot", r.Handler.RebootDevice)
 	devices.Put("/:id/lines", r.Handler.UpdateDeviceLines)
 
@@ -264,32 +284,49 @@ func (r *Router) Init() {
 	// Voicemail
 	voicemail := tenantScoped.Group("/voicemail")
 	voicemail.Get("/boxes", r.Handler.ListVoicemailBoxes)
-	voicemail.Post("/boxes", r.Handler.CreateVoicemailBox)
+	voicemail.Post("/boxes", r.Plan.EnforceLimit(models.LimitVoicemailBoxes), r.Handler.CreateVoicemailBox)
 	voicemail.Get("/boxes/:ext", r.Handler.GetVoicemailBox)
 	voicemail.Put("/boxes/:ext", r.Handler.UpdateVoicemailBox)
 	voicemail.Delete("/boxes/:ext", r.Handler.DeleteVoicemailBox)
+	voicemail.Get("/boxes/:ext/members", r.Handler.GetVoicemailBoxMembers)
+	voicemail.Put("/boxes/:ext/members", r.Handler.SetVoicemailBoxMembers)
+	// Distribution lists
+	voicemail.Get("/lists", r.Handler.ListVoicemailLists)
+	voicemail.Post("/lists", r.Handler.CreateVoicemailList)
+	voicemail.Get("/lists/:id", r.Handler.GetVoicemailList)
+	voicemail.Put("/lists/:id", r.Handler.UpdateVoicemailList)
+	voicemail.Delete("/lists/:id", r.Handler.DeleteVoicemailList)
 	// Voicemail messages
 	voicemail.Get("/boxes/:ext/messages", r.Handler.ListVoicemailMessages)
+	voicemail.Get("/messages", r.Handler.SearchVoicemailMessages)
 	voicemail.Get("/messages/:id", r.Handler.GetVoicemailMessage)
 	voicemail.Delete("/messages/:id", r.Handler.DeleteVoicemailMessage)
 	voicemail.Post("/messages/:id/read", r.Handler.MarkVoicemailRead)
 	voicemail.Get("/messages/:id/stream", r.Handler.StreamVoicemailMessage)
+	voicemail.Get("/messages/:id/transcription", r.Handler.GetVoicemailTranscription)
+	voicemail.Post("/messages/:id/transcribe", r.Handler.TranscribeVoicemailMessage)
+	voicemail.Post("/messages/:id/forward", r.Handler.ForwardVoicemailMessage)
+	voicemail.Get("/messages/:id/intro", r.Handler.StreamVoicemailIntro)
 
 	// Recordings
 	recordings := tenantScoped.Group("/recordings")
 	recordings.Get("/", r.Handler.ListRecordings)
 	recordings.Get("/config", r.Handler.GetRecordingConfig)
+	recordings.Put("/config", r.Handler.UpdateRecordingConfig)
+	recordings.Get("/usage", r.Handler.GetRecordingUsage)
 	recordings.Get("/:id", r.Handler.GetRecording)
 	recordings.Delete("/:id", r.Handler.DeleteRecording)
 	recordings.Get("/:id/stream", r.Handler.StreamRecording)
 	recordings.Get("/:id/download", r.Handler.DownloadRecording)
 	recordings.Put("/:id/notes", r.Handler.UpdateRecordingNotes)
 	recordings.Get("/:id/transcription", r.Handler.GetRecordingTranscription)
+	recordings.Post("/:id/transcribe", r.Handler.TranscribeRecording)
+	recordings.Put("/:id/legal-hold", r.Handler.SetRecordingLegalHold)
 
 	// IVR Menus
 	ivr := tenantScoped.Group("/ivr")
 	ivr.Get("/menus", r.Handler.ListIVRMenus)
-	ivr.Post("/menus", r.Handler.CreateIVRMenu)
+	ivr.Post("/menus", r.Plan.EnforceLimit(models.LimitIVRMenus), r.Handler.CreateIVRMenu)
 	ivr.Get("/menus/:id", r.Handler.GetIVRMenu)
 	ivr.Put("/menus/:id", r.Handler.UpdateIVRMenu)
 	ivr.Delete("/menus/:id", r.Handler.DeleteIVRMenu)
@@ -298,7 +335,7 @@ func (r *Router) Init() {
 	// Queues
 	queues := tenantScoped.Group("/queues")
 	queues.Get("/", r.Handler.ListQueues)
-	queues.Post("/", r.Handler.CreateQueue)
+	queues.Post("/", r.Plan.EnforceLimit(models.LimitQueues), r.Handler.CreateQueue)
 	queues.Get("/:id", r.Handler.GetQueue)
 	queues.Put("/:id", r.Handler.UpdateQueue)
 	queues.Delete("/:id", r.Handler.DeleteQueue)
@@ -308,11 +345,13 @@ func (r *Router) Init() {
 	queues.Delete("/:id/agents/:agentId", r.Handler.RemoveQueueAgent)
 	queues.Post("/:id/agents/:agentId/pause", r.Handler.PauseQueueAgent)
 	queues.Post("/:id/agents/:agentId/unpause", r.Handler.UnpauseQueueAgent)
+	queues.Get("/:id/callbacks", r.Handler.ListQueueCallbacks)
+	queues.Delete("/:id/callbacks/:callbackId", r.Handler.CancelQueueCallback)
 
 	// Ring Groups
 	ringGroups := tenantScoped.Group("/ring-groups")
 	ringGroups.Get("/", r.Handler.ListRingGroups)
-	ringGroups.Post("/", r.Handler.CreateRingGroup)
+	ringGroups.Post("/", r.Plan.EnforceLimit(models.LimitRingGroups), r.Handler.CreateRingGroup)
 	ringGroups.Get("/:id", r.Handler.GetRingGroup)
 	ringGroups.Put("/:id", r.Handler.UpdateRingGroup)
 	ringGroups.Delete("/:id", r.Handler.DeleteRingGroup)
@@ -327,8 +366,20 @@ func (r *Router) Init() {
 
 	// Conferences
 	conferences := tenantScoped.Group("/conferences")
+	conferences.Use(r.Plan.RequireFeature(models.FeatureConferencing))
 	conferences.Get("/", r.Handler.ListConferences)
-	conferences.Post("/", r.Handler.CreateConference)
+	conferences.Post("/", r.Plan.EnforceLimit(models.LimitConferences), r.Handler.CreateConference)
+	// Scheduled Meetings (registered before /:id so "meetings" isn't taken as an ID)
+	meetings := conferences.Group("/meetings")
+	meetings.Get("/", r.Handler.ListConferenceMeetings)
+	meetings.Post("/", r.Handler.CreateConferenceMeeting)
+	meetings.Get("/:id", r.Handler.GetConferenceMeeting)
+	meetings.Put("/:id", r.Handler.UpdateConferenceMeeting)
+	meetings.Delete("/:id", r.Handler.CancelConferenceMeeting)
+	meetings.Post("/:id/invites", r.Handler.ResendConferenceMeetingInvites)
+	meetings.Post("/:id/dial", r.Handler.DialConferenceMeetingAttendees)
+	meetings.Get("/:id/invite.ics", r.Handler.GetConferenceMeetingICS)
+	meetings.Get("/:id/sessions", r.Handler.GetConferenceMeetingSessions)
 	conferences.Get("/:id", r.Handler.GetConference)
 	conferences.Put("/:id", r.Handler.UpdateConference)
 	conferences.Delete("/:id", r.Handler.DeleteConference)
@@ -466,6 +517,7 @@ func (r *Router) Init() {
 
 	// Messaging (SMS/MMS)
 	msgRoutes := tenantScoped.Group("/messaging")
+	msgRoutes.Use(r.Plan.RequireFeature(models.FeatureSMS))
 	msgRoutes.Get("/conversations", r.Handler.ListConversations)
 	msgRoutes.Get("/conversations/:id", r.Handler.GetConversation)
 	msgRoutes.Post("/send", r.Handler.SendMessage)
@@ -477,6 +529,29 @@ func (r *Router) Init() {
 	msgRoutes.Post("/numbers/:id/assignments", r.SMSNumberHandler.AssignNumber)
 	msgRoutes.Delete("/numbers/:id/assignments/:assignId", r.SMSNumberHandler.UnassignNumber)
 
+	// Chatplans (SMS routing rules)
+	msgRoutes.Get("/chatplans", r.ChatplanHandler.ListChatplans)
+	msgRoutes.Post("/chatplans", r.ChatplanHandler.CreateChatplan)
+	msgRoutes.Post("/chatplans/test", r.ChatplanHandler.TestChatplan)
+	msgRoutes.Put("/chatplans/:id", r.ChatplanHandler.UpdateChatplan)
+	msgRoutes.Delete("/chatplans/:id", r.ChatplanHandler.DeleteChatplan)
+
+	// Carrier compliance: brand and campaign registrations, consent ledger
+	msgRoutes.Get("/brands", r.Handler.ListMessagingBrands)
+	msgRoutes.Post("/brands", r.Handler.CreateMessagingBrand)
+	msgRoutes.Get("/brands/:id", r.Handler.GetMessagingBrand)
+	msgRoutes.Put("/brands/:id", r.Handler.UpdateMessagingBrand)
+	msgRoutes.Delete("/brands/:id", r.Handler.DeleteMessagingBrand)
+	msgRoutes.Get("/campaigns", r.Handler.ListMessagingCampaigns)
+	msgRoutes.Post("/campaigns", r.Handler.CreateMessagingCampaign)
+	msgRoutes.Get("/campaigns/:id", r.Handler.GetMessagingCampaign)
+	msgRoutes.Put("/campaigns/:id", r.Handler.UpdateMessagingCampaign)
+	msgRoutes.Delete("/campaigns/:id", r.Handler.DeleteMessagingCampaign)
+	msgRoutes.Put("/campaigns/:id/numbers", r.Handler.SetMessagingCampaignNumbers)
+	msgRoutes.Get("/consent", r.Handler.ListMessagingConsent)
+	msgRoutes.Post("/consent", r.Handler.RecordMessagingConsent)
+	msgRoutes.Get("/opt-outs", r.Handler.ListMessagingOptOuts)
+
 	// Contacts
 	contacts := tenantScoped.Group("/contacts")
 	contacts.Get("/", r.Handler.ListContacts)
@@ -487,12 +562,24 @@ func (r *Router) Init() {
 	contacts.Post("/:id/sync", r.Handler.SyncContact)
 	contacts.Get("/lookup", r.Handler.GetContactByPhone)
 
+	// Contact sources (CRM webhooks) and their scheduled sync
+	contactSources := tenantScoped.Group("/contact-webhooks")
+	contactSources.Get("/", r.Handler.ListContactWebhooks)
+	contactSources.Post("/", r.Handler.CreateContactWebhook)
+	contactSources.Get("/:id", r.Handler.GetContactWebhook)
+	contactSources.Put("/:id", r.Handler.UpdateContactWebhook)
+	contactSources.Delete("/:id", r.Handler.DeleteContactWebhook)
+	contactSources.Post("/:id/sync", r.Handler.SyncContactWebhook)
+	contactSources.Get("/:id/runs", r.Handler.ListContactSyncRuns)
+
 	// Chat System
 	chat := tenantScoped.Group("/chat")
 	chat.Get("/threads", r.Handler.ListChatThreads)
 	chat.Post("/threads", r.Handler.CreateChatThread)
 	chat.Get("/threads/:id", r.Handler.GetChatThread)
-	chat.Post("/threads/:id/messages", r.Handler.SendChatMessage)
+	chat.Post("/threads/:id/messages", r.Handler.SMSThreadGate(r.Plan.RequireFeature(models.FeatureSMS)), r.Handler.SendChatMessage)
+	chat.Post("/threads/:id/accept", r.Handler.AcceptChatThread)
+	chat.Post("/threads/:id/resolve", r.Handler.ResolveChatThread)
 
 	chat.Get("/rooms", r.Handler.ListChatRooms)
 	chat.Post("/rooms", r.Handler.CreateChatRoom)
@@ -500,6 +587,13 @@ func (r *Router) Init() {
 
 	chat.Get("/queues", r.Handler.ListChatQueues)
 	chat.Post("/queues", r.Handler.CreateChatQueue)
+	chat.Get("/queues/:id", r.Handler.GetChatQueue)
+	chat.Put("/queues/:id", r.Handler.UpdateChatQueue)
+	chat.Delete("/queues/:id", r.Handler.DeleteChatQueue)
+	chat.Post("/queues/:id/agents", r.Handler.AddChatQueueAgent)
+	chat.Put("/queues/:id/agents/:agentId", r.Handler.UpdateChatQueueAgent)
+	chat.Delete("/queues/:id/agents/:agentId", r.Handler.RemoveChatQueueAgent)
+	chat.Put("/agent-status", r.Handler.SetChatAgentStatus)
 
 	// Paging Groups
 	paging := tenantScoped.Group("/page-groups")
@@ -548,9 +642,10 @@ func (r *Router) Init() {
 
 	// Fax
 	faxRoutes := tenantScoped.Group("/fax")
+	faxRoutes.Use(r.Plan.RequireFeature(models.FeatureFax))
 	// Fax Boxes
 	faxRoutes.Get("/boxes", r.FaxHandler.ListFaxBoxes)
-	faxRoutes.Post("/boxes", r.FaxHandler.CreateFaxBox)
+	faxRoutes.Post("/boxes", r.Plan.EnforceLimit(models.LimitFaxServers), r.FaxHandler.CreateFaxBox)
 	faxRoutes.Get("/boxes/:boxId", r.FaxHandler.GetFaxBox)
 	faxRoutes.Put("/boxes/:boxId", r.FaxHandler.UpdateFaxBox)
 	faxRoutes.Delete("/boxes/:boxId", r.FaxHandler.DeleteFaxBox)
@@ -578,6 +673,8 @@ func (r *Router) Init() {
 	reports.Get("/call-volume", r.Handler.GetCallVolumeReport)
 	reports.Get("/agent-performance", r.Handler.GetAgentPerformanceReport)
 	reports.Get("/queue-stats", r.Handler.GetQueueStatsReport)
+	reports.Get("/queue-intervals", r.Handler.GetQueueIntervalReport)
+	reports.Get("/queue-events", r.Handler.ListQueueEvents)
 	reports.Get("/extension-usage", r.Handler.GetExtensionUsageReport)
 	reports.Get("/kpi", r.Handler.GetKPIReport)
 	reports.Get("/number-usage", r.Handler.GetNumberUsageReport)
@@ -593,9 +690,15 @@ func (r *Router) Init() {
 	hospitality.Post("/rooms/:id/checkin", r.Handler.CheckInGuest)
 	hospitality.Post("/rooms/:id/checkout", r.Handler.CheckOutGuest)
 	hospitality.Post("/rooms/:id/wakeup", r.Handler.ScheduleWakeupCall)
+	hospitality.Get("/rooms/:id/history", r.Handler.GetRoomHistory)
+	hospitality.Get("/pms", r.Handler.GetPMSInterface)
+	hospitality.Put("/pms", r.Handler.UpdatePMSInterface)
+	hospitality.Post("/pms/resync", r.Handler.ResyncPMS)
+	hospitality.Get("/pms/postings", r.Handler.ListPMSPostings)
 
 	// Call Broadcast Campaigns
 	broadcast := tenantScoped.Group("/broadcast")
+	broadcast.Use(r.Plan.RequireFeature(models.FeatureCallBroadcast))
 	broadcast.Get("/", r.Handler.ListBroadcasts)
 	broadcast.Post("/", r.Handler.CreateBroadcast)
 	broadcast.Get("/:id", r.Handler.GetBroadcast)
@@ -603,19 +706,24 @@ func (r *Router) Init() {
 	broadcast.Delete("/:id", r.Handler.DeleteBroadcast)
 	broadcast.Post("/:id/start", r.Handler.StartBroadcast)
 	broadcast.Post("/:id/stop", r.Handler.StopBroadcast)
+	broadcast.Post("/:id/pause", r.Handler.StopBroadcast)
+	broadcast.Post("/:id/resume", r.Handler.ResumeBroadcast)
+	broadcast.Post("/:id/cancel", r.Handler.CancelBroadcast)
 	broadcast.Get("/:id/stats", r.Handler.GetBroadcastStats)
+	broadcast.Get("/:id/results/export", r.Handler.ExportBroadcastResults)
 
 	// Operator Panel
 	tenantScoped.Get("/operator-panel", r.Handler.GetOperatorPanelData)
 
 	// Live Operations
 	liveOps := tenantScoped.Group("/live")
-	liveOps.Post("/recording/start", r.Handler.StartCallRecording)
+	liveOps.Post("/recording/start", r.Plan.RequireFeature(models.FeatureRecording), r.Handler.StartCallRecording)
 	liveOps.Post("/recording/stop", r.Handler.StopCallRecording)
 	liveOps.Get("/calls", r.Handler.GetActiveCallsData)
 	liveOps.Post("/calls/:uuid/hangup", r.Handler.HangupCallByUUID)
 	liveOps.Post("/originate", r.Handler.OriginateCall)
 	liveOps.Get("/queue-stats", r.Handler.GetLiveQueueStats)
+	liveOps.Get("/wallboard", r.Handler.GetQueueWallboard)
 	liveOps.Post("/wakeup/schedule", r.Handler.ScheduleWakeupESL)
 	liveOps.Get("/registrations", r.Handler.GetDeviceRegistrations)
 
@@ -627,11 +735,17 @@ func (r *Router) Init() {
 	// Tenant users management
 	users := tenantAdmin.Group("/users")
 	users.Get("/", r.Handler.ListUsers)
-	users.Post("/", r.Handler.CreateUser)
+	users.Post("/", r.Plan.EnforceLimit(models.LimitUsers), r.Handler.CreateUser)
 	users.Get("/:id", r.Handler.GetUser)
 	users.Put("/:id", r.Handler.UpdateUser)
 	users.Delete("/:id", r.Handler.DeleteUser)
 
+	// Tenant's own monthly invoice
+	tenantAdmin.Get("/billing/invoice", r.Handler.GetInvoice)
+
+	// Tenant's toll-fraud status (outbound block, policy, usage)
+	tenantAdmin.Get("/fraud/status", r.Handler.GetFraudStatus)
+
 	// System admin routes
 	system := protected.Group("/system")
 	system.Use(r.Auth.RequireSystemAdmin())
@@ -688,6 +802,32 @@ func (r *Router) Init() {
 	gateways.Put("/:id", r.Handler.UpdateGateway)
 	gateways.Delete("/:id", r.Handler.DeleteGateway)
 
+	// Rate Decks & Billing
+	rateDecks := system.Group("/rate-decks")
+	rateDecks.Get("/", r.Handler.ListRateDecks)
+	rateDecks.Post("/", r.Handler.CreateRateDeck)
+	rateDecks.Get("/:id", r.Handler.GetRateDeck)
+	rateDecks.Put("/:id", r.Handler.UpdateRateDeck)
+	rateDecks.Delete("/:id", r.Handler.DeleteRateDeck)
+	rateDecks.Get("/:id/entries", r.Handler.ListRateDeckEntries)
+	rateDecks.Post("/:id/import", r.Handler.ImportRateDeck)
+	rateDecks.Get("/:id/lookup", r.Handler.LookupRate)
+
+	billing := system.Group("/billing")
+	billing.Post("/rerate", r.Handler.RerateCalls)
+	billing.Get("/invoices", r.Handler.ListInvoices)
+	billing.Get("/invoices/:tenant_id", r.Handler.GetTenantInvoice)
+
+	// Toll fraud: spend/minute policies and outbound blocks
+	fraudAdmin := system.Group("/fraud")
+	fraudAdmin.Get("/policies", r.Handler.ListFraudPolicies)
+	fraudAdmin.Put("/policies/:tenant_id", r.Handler.UpsertFraudPolicy) // "default" for the system policy
+	fraudAdmin.Delete("/policies/:tenant_id", r.Handler.DeleteFraudPolicy)
+	fraudAdmin.Get("/events", r.Handler.ListFraudEvents)
+	fraudAdmin.Get("/tenants/:tenant_id", r.Handler.GetTenantFraudStatus)
+	fraudAdmin.Post("/tenants/:tenant_id/block", r.Handler.BlockTenantOutbound)
+	fraudAdmin.Post("/tenants/:tenant_id/unblock", r.Handler.UnblockTenantOutbound)
+
 	// Bridges
 	bridges := system.Group("/bridges")
 	bridges.Get("/", r.Handler.ListBridges)
@@ -772,6 +912,8 @@ func (r *Router) Init() {
 	// System status
 	system.Get("/status", r.Handler.GetSystemStatus)
 	system.Get("/stats", r.Handler.GetSystemStats)
+	system.Get("/recordings/usage", r.Handler.ListRecordingUsage)
+	system.Get("/storage", r.Handler.GetStorageStatus)
 
 	// Security - Banned IPs
 	security := system.Group("/security")
@@ -814,6 +956,7 @@ func (r *Router) Init() {
 	user.Get("/devices", r.Handler.GetUserDevices)
 	user.Get("/call-history", r.Handler.GetUserCallHistory)
 	user.Get("/voicemail", r.Handler.GetUserVoicemail)
+	user.Get("/voicemail/imap", r.Handler.GetUserVoicemailIMAP)
 	user.Get("/settings", r.Handler.GetUserSettings)
 	user.Put("/settings", r.Handler.UpdateUserSettings)
 	user.Get("/contacts", r.Handler.GetUserContacts)
@@ -838,7 +981,7 @@ func (r *Router) Init() {
 	extPortal.Put("/password", r.Handler.ChangeExtensionPassword)
 	extPortal.Get("/contacts", r.Handler.GetExtensionContacts)
 	extPortal.Post("/contacts", r.Handler.CreateExtensionContact)
-	extPortal.Get("/webrtc-config", r.Handler.GetWebRTCConfig)
+	extPortal.Get("/webrtc-config", r.Plan.RequireFeature(models.FeatureWebRTC), r.Handler.GetWebRTCConfig)
 
 	// WebSocket endpoint for real-time events
 	r.App.Get("/api/ws", r.Handler.HandleWebSocket)
@@ -847,6 +990,8 @@ func (r *Router) Init() {
 	webhooks := r.App.Group("/api/webhooks")
 	webhooks.Post("/telnyx/inbound", r.WebhookHandler.TelnyxInbound)
 	webhooks.Post("/telnyx/status", r.WebhookHandler.TelnyxStatus)
+	webhooks.Post("/messaging/:id/inbound", r.WebhookHandler.ProviderInbound)
+	webhooks.Post("/messaging/:id/status", r.WebhookHandler.ProviderStatus)
 
 	// Device Provisioning endpoint (public - devices authenticate via MAC)
 	provisioningPub := r.App.Group("/provisioning")
@@ -0,0 +1,78 @@
+package broadcast
+
+import (
+	"callsign/models"
+	"fmt"
+	"time"
+)
+
+// CallWindow is a daily local-time range during which recipients may be
+// called. A window whose start is after its end spans midnight.
+type CallWindow struct {
+	Start int // Minutes after midnight
+	End   int
+}
+
+// ParseCallWindow parses "HH:MM" bounds. ok is false when both bounds are
+// empty, meaning calls may be placed at any time.
+func ParseCallWindow(start, end string) (w CallWindow, ok bool, err error) {
+	if start == "" && end == "" {
+		return CallWindow{}, false, nil
+	}
+	if w.Start, err = parseClock(start); err != nil {
+		return CallWindow{}, false, fmt.Errorf("invalid call window start: %w", err)
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return CallWindow{}, false, fmt.Errorf("invalid call window end: %w", err)
+	}
+	if w.Start == w.End {
+		return CallWindow{}, false, fmt.Errorf("call window start and end must differ")
+	}
+	return w, true, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Open reports whether t falls inside the window in loc
+func (w CallWindow) Open(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+	m := local.Hour()*60 + local.Minute()
+	if w.Start < w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+// NextOpen returns now when the window is open, otherwise the next time it
+// opens in loc
+func (w CallWindow) NextOpen(now time.Time, loc *time.Location) time.Time {
+	if w.Open(now, loc) {
+		return now
+	}
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), w.Start/60, w.Start%60, 0, 0, loc)
+	if !next.After(now) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, w.Start/60, w.Start%60, 0, 0, loc)
+	}
+	return next
+}
+
+// ClassifyHangup maps a call's hangup cause to a recipient outcome
+func ClassifyHangup(cause string, answered bool) models.BroadcastRecipientStatus {
+	if answered {
+		return models.BroadcastRecipientAnswered
+	}
+	switch cause {
+	case "USER_BUSY":
+		return models.BroadcastRecipientBusy
+	case "NO_ANSWER", "NO_USER_RESPONSE", "ALLOTTED_TIMEOUT", "RECOVERY_ON_TIMER_EXPIRE", "ORIGINATOR_CANCEL":
+		return models.BroadcastRecipientNoAnswer
+	}
+	return models.BroadcastRecipientFailed
+}
@@ -0,0 +1,52 @@
+package broadcast_test
+
+import (
+	"callsign/models"
+	"callsign/services/broadcast"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallWindow(t *testing.T) {
+	_, ok, err := broadcast.ParseCallWindow("", "")
+	require.NoError(t, err)
+	assert.False(t, ok, "empty bounds mean no window")
+
+	_, _, err = broadcast.ParseCallWindow("9am", "17:00")
+	assert.Error(t, err)
+
+	w, ok, err := broadcast.ParseCallWindow("09:00", "21:00")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	chicago, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	// 13:00 UTC is 08:00 in Chicago (CDT): closed until 09:00 local
+	now := time.Date(2026, 6, 1, 13, 0, 0, 0, time.UTC)
+	assert.True(t, w.Open(now, time.UTC))
+	assert.False(t, w.Open(now, chicago))
+	assert.True(t, w.NextOpen(now, chicago).Equal(time.Date(2026, 6, 1, 9, 0, 0, 0, chicago)))
+	assert.Equal(t, now, w.NextOpen(now, time.UTC))
+
+	// After hours rolls over to the next morning
+	late := time.Date(2026, 6, 1, 22, 30, 0, 0, time.UTC)
+	assert.True(t, w.NextOpen(late, time.UTC).Equal(time.Date(2026, 6, 2, 9, 0, 0, 0, time.UTC)))
+
+	// Windows spanning midnight
+	night, _, err := broadcast.ParseCallWindow("22:00", "02:00")
+	require.NoError(t, err)
+	assert.True(t, night.Open(late, time.UTC))
+	assert.True(t, night.Open(time.Date(2026, 6, 2, 1, 0, 0, 0, time.UTC), time.UTC))
+	assert.False(t, night.Open(time.Date(2026, 6, 2, 3, 0, 0, 0, time.UTC), time.UTC))
+}
+
+func TestClassifyHangup(t *testing.T) {
+	assert.Equal(t, models.BroadcastRecipientAnswered, broadcast.ClassifyHangup("NORMAL_CLEARING", true))
+	assert.Equal(t, models.BroadcastRecipientBusy, broadcast.ClassifyHangup("USER_BUSY", false))
+	assert.Equal(t, models.BroadcastRecipientNoAnswer, broadcast.ClassifyHangup("NO_ANSWER", false))
+	assert.Equal(t, models.BroadcastRecipientFailed, broadcast.ClassifyHangup("UNALLOCATED_NUMBER", false))
+}
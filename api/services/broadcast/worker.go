@@ -4,19 +4,31 @@ package broadcast
 import (
 	"callsign/models"
 	"callsign/services/esl"
+	broadcastmod "callsign/services/esl/modules/broadcast"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-// recipientInfo holds information about a recipient for the broadcast.
-type recipientInfo struct {
-	ID          uint
-	PhoneNumber string
-	Status      string
+const (
+	// pollInterval is how often a running campaign checks for due recipients
+	pollInterval = 5 * time.Second
+	// maxCallDuration bounds how long to wait for a hangup event after answer
+	maxCallDuration = 15 * time.Minute
+)
+
+// callResult is the outcome of one originated call, delivered by the hangup event
+type callResult struct {
+	cause    string
+	answered bool
+	billsec  int
 }
 
 // campaignContext provides cancellation support for campaign runs.
@@ -35,6 +47,10 @@ func (c *campaignContext) Err() error {
 }
 
 // BroadcastWorker handles async origination of broadcast campaign calls.
+// Recipient state is persisted in broadcast_recipients, so campaigns can be
+// paused, retried and resumed after a restart without redialing anyone.
+// Answered calls are run by the broadcast ESL module, and each attempt's
+// outcome is kept in broadcast_results.
 type BroadcastWorker struct {
 	db  *gorm.DB
 	esl *esl.Manager
@@ -42,6 +58,10 @@ type BroadcastWorker struct {
 	// Track running campaigns for stopping
 	runningCampaigns map[uint]cancelFunc
 	workerMutex      sync.Mutex
+
+	// Calls waiting for their CHANNEL_HANGUP_COMPLETE, keyed by channel UUID
+	pending   map[string]chan callResult
+	pendingMu sync.Mutex
 }
 
 // cancelFunc is a function that cancels a campaign run.
@@ -53,10 +73,57 @@ func NewBroadcastWorker(db *gorm.DB, eslManager *esl.Manager) *BroadcastWorker {
 		db:               db,
 		esl:              eslManager,
 		runningCampaigns: make(map[uint]cancelFunc),
+		pending:          make(map[string]chan callResult),
+	}
+}
+
+// Start registers for call results and runs the scheduler, which starts
+// campaigns once their ScheduledAt passes and resumes campaigns that were
+// running when the server stopped.
+func (w *BroadcastWorker) Start(interval time.Duration) {
+	if w.esl != nil {
+		w.esl.On("CHANNEL_HANGUP_COMPLETE", w.handleHangup)
+	}
+
+	go func() {
+		w.schedule()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			w.schedule()
+		}
+	}()
+	log.Infof("Broadcast scheduler started (interval: %s)", interval)
+}
+
+// schedule starts due scheduled campaigns and resumes orphaned running ones
+func (w *BroadcastWorker) schedule() {
+	var campaigns []models.BroadcastCampaign
+	if err := w.db.Where("(status = ? AND (scheduled_at IS NULL OR scheduled_at <= ?)) OR status = ?",
+		models.BroadcastStatusScheduled, time.Now(), models.BroadcastStatusRunning).
+		Find(&campaigns).Error; err != nil {
+		log.Warnf("Broadcast scheduler: failed to load campaigns: %v", err)
+		return
+	}
+
+	for _, c := range campaigns {
+		if w.IsCampaignRunning(c.ID) {
+			continue
+		}
+		if c.Status == models.BroadcastStatusRunning {
+			log.Infof("Broadcast campaign %d: resuming after restart", c.ID)
+		} else {
+			log.Infof("Broadcast campaign %d: starting at scheduled time", c.ID)
+		}
+		if err := w.StartCampaign(c.ID); err != nil {
+			log.Warnf("Broadcast campaign %d: failed to start: %v", c.ID, err)
+		}
 	}
 }
 
-// StartCampaign loads a campaign and starts originating calls to all recipients.
+// StartCampaign starts or resumes a campaign. Recipients already dialed keep
+// their state; only pending and retry recipients are called.
 // It runs asynchronously - the HTTP handler returns immediately.
 func (w *BroadcastWorker) StartCampaign(campaignID uint) error {
 	// Load campaign from DB
@@ -65,8 +132,8 @@ func (w *BroadcastWorker) StartCampaign(campaignID uint) error {
 		return fmt.Errorf("failed to load campaign: %w", err)
 	}
 
-	// Guard: early exit if already running
-	if campaign.Status == models.BroadcastStatusRunning {
+	// Guard: early exit if already running (or still draining after a pause)
+	if w.IsCampaignRunning(campaignID) {
 		return fmt.Errorf("campaign %d is already running", campaignID)
 	}
 
@@ -74,24 +141,29 @@ func (w *BroadcastWorker) StartCampaign(campaignID uint) error {
 	if len(campaign.Recipients) == 0 {
 		return fmt.Errorf("campaign has no recipients")
 	}
+	if campaign.RecordingPath == "" {
+		return fmt.Errorf("campaign has no recording path configured")
+	}
+	if _, _, err := ParseCallWindow(campaign.CallWindowStart, campaign.CallWindowEnd); err != nil {
+		return err
+	}
 
-	// Update status to running
-	now := time.Now()
-	if err := w.db.Model(&campaign).Updates(map[string]interface{}{
-		"status":     models.BroadcastStatusRunning,
-		"started_at": now,
-	}).Error; err != nil {
-		return fmt.Errorf("failed to update campaign status: %w", err)
+	if err := w.syncRecipients(&campaign); err != nil {
+		return fmt.Errorf("failed to prepare recipients: %w", err)
 	}
 
-	// Prepare recipients as a slice of structs for the run loop
-	recipients := make([]recipientInfo, len(campaign.Recipients))
-	for i, phone := range campaign.Recipients {
-		recipients[i] = recipientInfo{
-			ID:          uint(i + 1),
-			PhoneNumber: phone,
-			Status:      "pending",
-		}
+	// Calls in flight when the server stopped never reported back; redial them
+	w.db.Model(&models.BroadcastRecipient{}).
+		Where("campaign_id = ? AND status = ?", campaignID, models.BroadcastRecipientCalling).
+		Update("status", models.BroadcastRecipientPending)
+
+	// Update status to running (keep the original start time on resume)
+	updates := map[string]interface{}{"status": models.BroadcastStatusRunning}
+	if campaign.StartedAt == nil {
+		updates["started_at"] = time.Now()
+	}
+	if err := w.db.Model(&campaign).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update campaign status: %w", err)
 	}
 
 	// Create cancellable context for this campaign
@@ -103,149 +175,362 @@ func (w *BroadcastWorker) StartCampaign(campaignID uint) error {
 	w.workerMutex.Unlock()
 
 	// Run the campaign loop asynchronously
-	go w.runLoop(campaignID, recipients, ctx)
+	go w.runLoop(campaignID, ctx)
 
 	return nil
 }
 
-// StopCampaign signals the worker to stop originating new calls for a campaign.
-func (w *BroadcastWorker) StopCampaign(campaignID uint) error {
-	w.workerMutex.Lock()
-	cancel, exists := w.runningCampaigns[campaignID]
-	w.workerMutex.Unlock()
+// syncRecipients creates recipient rows for numbers not yet tracked. Entries
+// may carry a timezone as "number,Area/City". Numbers appended to the campaign
+// while paused are picked up on resume; tracked rows must still match the
+// list at their position, otherwise results would belong to other numbers.
+func (w *BroadcastWorker) syncRecipients(campaign *models.BroadcastCampaign) error {
+	var tracked []models.BroadcastRecipient
+	if err := w.db.Select("position", "phone_number", "timezone").
+		Where("campaign_id = ?", campaign.ID).Order("position").Find(&tracked).Error; err != nil {
+		return err
+	}
+	for i, r := range tracked {
+		if r.Position != i || i >= len(campaign.Recipients) {
+			return fmt.Errorf("recipient list no longer matches the dialed numbers")
+		}
+		number, tz := parseRecipient(campaign.Recipients[i])
+		if number != r.PhoneNumber || tz != r.Timezone {
+			return fmt.Errorf("recipient %d changed from %s to %s after the campaign started", i+1, r.PhoneNumber, number)
+		}
+	}
 
-	if !exists {
-		return fmt.Errorf("campaign %d is not running", campaignID)
+	var rows []models.BroadcastRecipient
+	for i := len(tracked); i < len(campaign.Recipients); i++ {
+		number, tz := parseRecipient(campaign.Recipients[i])
+		rows = append(rows, models.BroadcastRecipient{
+			CampaignID:  campaign.ID,
+			TenantID:    campaign.TenantID,
+			Position:    i,
+			PhoneNumber: number,
+			Timezone:    tz,
+			Status:      models.BroadcastRecipientPending,
+		})
 	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return w.db.CreateInBatches(rows, 500).Error
+}
 
-	// Signal cancellation
-	cancel()
+// parseRecipient splits a "number,Area/City" recipient entry
+func parseRecipient(entry string) (number, tz string) {
+	number, tz, _ = strings.Cut(entry, ",")
+	return strings.TrimSpace(number), strings.TrimSpace(tz)
+}
+
+// PauseCampaign stops originating new calls. Calls already in progress finish
+// and record their results; the campaign resumes from the same position.
+func (w *BroadcastWorker) PauseCampaign(campaignID uint) error {
+	return w.halt(campaignID, models.BroadcastStatusPaused)
+}
 
-	// Remove from tracking
+// CancelCampaign stops a campaign for good. Undialed recipients stay pending.
+func (w *BroadcastWorker) CancelCampaign(campaignID uint) error {
+	return w.halt(campaignID, models.BroadcastStatusCancelled)
+}
+
+// halt signals the run loop to stop and records the new campaign status
+func (w *BroadcastWorker) halt(campaignID uint, status models.BroadcastStatus) error {
 	w.workerMutex.Lock()
-	delete(w.runningCampaigns, campaignID)
+	cancel, exists := w.runningCampaigns[campaignID]
 	w.workerMutex.Unlock()
 
-	// Update status to paused
-	w.db.Model(&models.BroadcastCampaign{}).Where("id = ?", campaignID).
-		Update("status", models.BroadcastStatusPaused)
+	// Update status first so the scheduler doesn't resume the campaign
+	result := w.db.Model(&models.BroadcastCampaign{}).
+		Where("id = ? AND status IN ?", campaignID, []models.BroadcastStatus{
+			models.BroadcastStatusRunning, models.BroadcastStatusScheduled, models.BroadcastStatusPaused,
+		}).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 && !exists {
+		return fmt.Errorf("campaign %d is not running", campaignID)
+	}
+
+	// Signal cancellation; the loop removes itself once in-flight calls end
+	if exists {
+		cancel()
+	}
 
-	log.Infof("Broadcast campaign %d stop signaled", campaignID)
+	log.Infof("Broadcast campaign %d %s", campaignID, status)
 	return nil
 }
 
-// runLoop iterates through recipients and originates calls via ESL.
-func (w *BroadcastWorker) runLoop(campaignID uint, recipients []recipientInfo, ctx *campaignContext) {
+// runLoop dials due recipients within their calling windows until none remain.
+func (w *BroadcastWorker) runLoop(campaignID uint, ctx *campaignContext) {
+	var inflight sync.WaitGroup
 	defer func() {
-		// Cleanup: remove from running campaigns and update status if not already stopped
+		// Don't release the campaign until in-flight calls have reported back,
+		// otherwise a quick resume could redial them
+		inflight.Wait()
 		w.workerMutex.Lock()
 		delete(w.runningCampaigns, campaignID)
 		w.workerMutex.Unlock()
-
-		// Check if campaign was fully completed
-		var campaign models.BroadcastCampaign
-		if err := w.db.First(&campaign, campaignID).Error; err == nil {
-			if campaign.Status == models.BroadcastStatusRunning {
-				now := time.Now()
-				w.db.Model(&campaign).Updates(map[string]interface{}{
-					"status":       models.BroadcastStatusCompleted,
-					"completed_at": now,
-				})
-				log.Infof("Broadcast campaign %d completed", campaignID)
-			}
-		}
 	}()
 
-	// Load campaign for recording path and config
 	var campaign models.BroadcastCampaign
 	if err := w.db.First(&campaign, campaignID).Error; err != nil {
 		log.Errorf("Broadcast campaign %d: failed to load: %v", campaignID, err)
 		return
 	}
 
-	// Validate recording path exists
-	if campaign.RecordingPath == "" {
-		log.Errorf("Broadcast campaign %d: no recording path configured", campaignID)
-		return
+	var tenant models.Tenant
+	w.db.First(&tenant, campaign.TenantID)
+	defaultLoc := tenant.Location()
+	if campaign.Timezone != "" {
+		if loc, err := time.LoadLocation(campaign.Timezone); err == nil {
+			defaultLoc = loc
+		}
 	}
-
-	log.Infof("Broadcast campaign %d: starting loop for %d recipients", campaignID, len(recipients))
+	window, windowed, _ := ParseCallWindow(campaign.CallWindowStart, campaign.CallWindowEnd)
 
 	// Semaphore for concurrent call limiting
-	sem := make(chan struct{}, campaign.ConcurrentLimit)
-	if campaign.ConcurrentLimit <= 0 {
-		sem = make(chan struct{}, 5) // Default limit of 5
+	limit := campaign.ConcurrentLimit
+	if limit <= 0 {
+		limit = 5 // Default limit of 5
 	}
+	sem := make(chan struct{}, limit)
+
+	log.Infof("Broadcast campaign %d: running (%d recipients, %d concurrent)", campaignID, len(campaign.Recipients), limit)
 
-	for i, recipient := range recipients {
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			log.Infof("Broadcast campaign %d: cancelled by user", campaignID)
+	active := []models.BroadcastRecipientStatus{
+		models.BroadcastRecipientPending, models.BroadcastRecipientRetry,
+	}
+
+	for {
+		if ctx.Err() != nil {
+			log.Infof("Broadcast campaign %d: stopped", campaignID)
 			return
-		default:
+		}
+		if w.esl == nil || !w.esl.IsConnected() {
+			if !sleepCtx(ctx, pollInterval) {
+				return
+			}
+			continue
+		}
+
+		now := time.Now()
+		var due []models.BroadcastRecipient
+		w.db.Where("campaign_id = ? AND status IN ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)",
+			campaignID, active, now).
+			Order("position ASC").Limit(limit).Find(&due)
+
+		if len(due) == 0 {
+			var remaining int64
+			w.db.Model(&models.BroadcastRecipient{}).
+				Where("campaign_id = ? AND status IN ?", campaignID, append(active, models.BroadcastRecipientCalling)).
+				Count(&remaining)
+			if remaining == 0 {
+				w.complete(campaignID)
+				return
+			}
+			if !sleepCtx(ctx, pollInterval) {
+				return
+			}
+			continue
 		}
 
-		// Update progress
-		w.db.Model(&models.BroadcastCampaign{}).Where("id = ?", campaignID).
-			Update("total_calls", i+1)
+		for _, r := range due {
+			// Defer recipients outside their local calling hours
+			if windowed {
+				loc := defaultLoc
+				if r.Timezone != "" {
+					if l, err := time.LoadLocation(r.Timezone); err == nil {
+						loc = l
+					}
+				}
+				if open := window.NextOpen(now, loc); open.After(now) {
+					w.db.Model(&r).Update("next_attempt_at", open)
+					continue
+				}
+			}
 
-		// Acquire semaphore slot
-		sem <- struct{}{}
+			// Acquire semaphore slot
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 
-		// Originate call asynchronously
-		go func(recipient recipientInfo) {
-			defer func() { <-sem }() // Release slot
-			w.originateCall(&campaign, recipient)
-		}(recipient)
+			attemptAt := time.Now()
+			r.Status = models.BroadcastRecipientCalling
+			r.Attempts++
+			r.LastAttemptAt = &attemptAt
+			r.NextAttemptAt = nil
+			r.CallUUID = uuid.New().String()
+			w.db.Model(&r).Select("status", "attempts", "last_attempt_at", "next_attempt_at", "call_uuid").Updates(&r)
+			w.db.Model(&models.BroadcastCampaign{}).Where("id = ?", campaignID).
+				Update("total_calls", gorm.Expr("total_calls + 1"))
+
+			// Originate call asynchronously
+			inflight.Add(1)
+			go func(r models.BroadcastRecipient) {
+				defer inflight.Done()
+				defer func() { <-sem }() // Release slot
+				w.originateCall(&campaign, tenant.Domain, r)
+			}(r)
+		}
 	}
+}
 
-	// Wait for all calls to complete
-	for i := 0; i < cap(sem); i++ {
-		sem <- struct{}{}
+// complete marks a campaign finished once every recipient reached a final state
+func (w *BroadcastWorker) complete(campaignID uint) {
+	now := time.Now()
+	result := w.db.Model(&models.BroadcastCampaign{}).
+		Where("id = ? AND status = ?", campaignID, models.BroadcastStatusRunning).
+		Updates(map[string]interface{}{
+			"status":       models.BroadcastStatusCompleted,
+			"completed_at": now,
+		})
+	if result.RowsAffected > 0 {
+		log.Infof("Broadcast campaign %d completed", campaignID)
 	}
-
-	log.Infof("Broadcast campaign %d: all calls originated, waiting for completion", campaignID)
 }
 
-// originateCall originates a single call and handles the result.
-func (w *BroadcastWorker) originateCall(campaign *models.BroadcastCampaign, recipient recipientInfo) {
-	// Build the originate command with campaign and recipient metadata
-	// Format: bgapi originate {campaign_id=X,recipient_id=Y,ignore_early_media=true}endpoint &playback(path)
+// originateCall originates a single call and waits for its hangup to record
+// the outcome.
+func (w *BroadcastWorker) originateCall(campaign *models.BroadcastCampaign, domain string, recipient models.BroadcastRecipient) {
+	result := make(chan callResult, 1)
+	w.pendingMu.Lock()
+	w.pending[recipient.CallUUID] = result
+	w.pendingMu.Unlock()
+	defer func() {
+		w.pendingMu.Lock()
+		delete(w.pending, recipient.CallUUID)
+		w.pendingMu.Unlock()
+	}()
+
+	timeout := campaign.Timeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+
+	// Dial through the tenant's dialplan so outbound routes and caller ID
+	// apply; the answered call is handed to the broadcast ESL module
 	cmd := fmt.Sprintf(
-		"bgapi originate {campaign_id=%d,recipient_id=%d,ignore_early_media=true,campaign_name=%s}%s %s &playback(%s)",
+		"originate {origination_uuid=%s,broadcast_campaign_id=%d,broadcast_recipient_id=%d,origination_caller_id_number=%s,originate_timeout=%d,ignore_early_media=true}loopback/%s/%s &socket(%s async full)",
+		recipient.CallUUID,
 		campaign.ID,
 		recipient.ID,
-		campaign.Name,
+		campaign.CallerID,
+		timeout,
 		recipient.PhoneNumber,
-		campaign.CallerID, // Using caller ID as the destination/extension to bridge to
-		campaign.RecordingPath,
+		domain,
+		broadcastmod.ServiceAddress,
 	)
 
 	log.WithFields(log.Fields{
 		"campaign_id":  campaign.ID,
 		"recipient_id": recipient.ID,
 		"phone_number": recipient.PhoneNumber,
+		"attempt":      recipient.Attempts,
 	}).Debug("Originating broadcast call")
 
-	result, err := w.esl.BgAPI(cmd)
-	if err != nil {
+	if _, err := w.esl.BgAPI(cmd); err != nil {
 		log.Errorf("Broadcast call failed to originate: %v", err)
-		w.updateRecipientStats(campaign.ID, "failed")
+		w.recordResult(campaign, recipient, callResult{cause: "ORIGINATE_FAILED"})
 		return
 	}
 
+	select {
+	case res := <-result:
+		w.recordResult(campaign, recipient, res)
+	case <-time.After(time.Duration(timeout)*time.Second + maxCallDuration):
+		log.WithField("call_uuid", recipient.CallUUID).Warn("Broadcast call result not received")
+		w.recordResult(campaign, recipient, callResult{cause: "RESULT_TIMEOUT"})
+	}
+}
+
+// handleHangup delivers hangup events for broadcast calls to their waiters
+func (w *BroadcastWorker) handleHangup(ev *eventsocket.Event, _ *esl.CallSession) {
+	callUUID := ev.Get("Unique-ID")
+	w.pendingMu.Lock()
+	result, ok := w.pending[callUUID]
+	w.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	answered := ev.Get("Caller-Channel-Answered-Time")
+	billsec, _ := strconv.Atoi(ev.Get("variable_billsec"))
+	select {
+	case result <- callResult{
+		cause:    ev.Get("Hangup-Cause"),
+		answered: answered != "" && answered != "0",
+		billsec:  billsec,
+	}:
+	default:
+	}
+}
+
+// recordResult stores a call outcome and schedules a retry for busy and
+// no-answer results while attempts remain.
+func (w *BroadcastWorker) recordResult(campaign *models.BroadcastCampaign, recipient models.BroadcastRecipient, res callResult) {
+	outcome := ClassifyHangup(res.cause, res.answered)
+	w.updateRecipientStats(campaign.ID, string(outcome))
+
+	updates := map[string]interface{}{"hangup_cause": res.cause}
+	retry := (outcome == models.BroadcastRecipientBusy || outcome == models.BroadcastRecipientNoAnswer) &&
+		recipient.Attempts <= campaign.RetryAttempts
+	if retry {
+		updates["status"] = models.BroadcastRecipientRetry
+		updates["next_attempt_at"] = time.Now().Add(time.Duration(campaign.RetryDelay) * time.Second)
+	} else {
+		updates["status"] = outcome
+		w.db.Model(&models.BroadcastCampaign{}).Where("id = ?", campaign.ID).
+			Update("completed_recipients", gorm.Expr("completed_recipients + 1"))
+	}
+	w.db.Model(&models.BroadcastRecipient{}).Where("id = ?", recipient.ID).Updates(updates)
+
+	// The call module records human/machine, digits and transfers while the
+	// call is up; fill in the outcome for calls that never reached it
+	var existing models.BroadcastResult
+	w.db.Where("call_uuid = ?", recipient.CallUUID).Limit(1).Find(&existing)
+	resultUpdates := map[string]interface{}{
+		"hangup_cause": res.cause,
+		"duration":     res.billsec,
+	}
+	if existing.Outcome == "" {
+		resultUpdates["outcome"] = resultOutcome(outcome)
+	}
+	if err := models.RecordBroadcastResult(w.db, models.BroadcastResult{
+		CampaignID:  campaign.ID,
+		RecipientID: recipient.ID,
+		TenantID:    campaign.TenantID,
+		CallUUID:    recipient.CallUUID,
+		PhoneNumber: recipient.PhoneNumber,
+		Attempt:     recipient.Attempts,
+	}, resultUpdates); err != nil {
+		log.WithField("call_uuid", recipient.CallUUID).Warnf("Failed to record broadcast result: %v", err)
+	}
+
 	log.WithFields(log.Fields{
-		"campaign_id": campaign.ID,
-		"job_uuid":    result,
-		"phone":       recipient.PhoneNumber,
-	}).Debug("Broadcast call originated")
-
-	// Note: In a full implementation, we would track call state events
-	// (CHANNEL_ANSWER, CHANNEL_HANGUP_COMPLETE) to update actual answer stats.
-	// For now, we mark as answered since the originate was successful.
-	// A more robust implementation would subscribe to ESL events and track UUIDs.
-	w.updateRecipientStats(campaign.ID, "answered")
+		"campaign_id":  campaign.ID,
+		"recipient_id": recipient.ID,
+		"cause":        res.cause,
+		"outcome":      outcome,
+		"retry":        retry,
+	}).Debug("Broadcast call finished")
+}
+
+// resultOutcome maps a recipient status to the outcome recorded for the attempt
+func resultOutcome(status models.BroadcastRecipientStatus) models.BroadcastOutcome {
+	switch status {
+	case models.BroadcastRecipientAnswered:
+		return models.BroadcastOutcomeHuman
+	case models.BroadcastRecipientBusy:
+		return models.BroadcastOutcomeBusy
+	case models.BroadcastRecipientNoAnswer:
+		return models.BroadcastOutcomeNoAnswer
+	}
+	return models.BroadcastOutcomeFailed
 }
 
 // updateRecipientStats updates the campaign's call statistics in the database.
@@ -267,11 +552,22 @@ func (w *BroadcastWorker) updateRecipientStats(campaignID uint, result string) {
 	}
 }
 
+// sleepCtx waits for d or until the campaign is cancelled. Returns false on cancel.
+func sleepCtx(ctx *campaignContext, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
 // contextWithCancel creates a basic context with cancel support.
 func contextWithCancel() (*campaignContext, cancelFunc) {
 	ctx := &campaignContext{done: make(chan struct{})}
+	var once sync.Once
 	cancel := cancelFunc(func() {
-		close(ctx.done)
+		once.Do(func() { close(ctx.done) })
 	})
 	return ctx, cancel
 }
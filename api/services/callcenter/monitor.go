@@ -0,0 +1,575 @@
+// Package callcenter records mod_callcenter activity and keeps live
+// contact-center metrics for wallboards and interval reports.
+package callcenter
+
+import (
+	"callsign/models"
+	"callsign/services/esl"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// EventSubclass is the mod_callcenter CUSTOM event subclass
+	EventSubclass = "callcenter::info"
+	// DefaultWindow is how far back the rolling wallboard metrics look
+	DefaultWindow = time.Hour
+	// maxOpenWait drops callers from the live board whose leave event was lost
+	maxOpenWait = 4 * time.Hour
+	// refreshEvery is how often a board with waiting callers is re-sent so
+	// the longest wait keeps counting up
+	refreshEvery = 5 * time.Second
+	// reloadEvery is how often queue settings and agent tiers are re-read
+	reloadEvery = time.Minute
+)
+
+// QueueMetrics is the live wallboard view of one queue. Counters cover
+// callers who left the queue within the rolling window.
+type QueueMetrics struct {
+	QueueID       uint   `json:"queue_id"`
+	Queue         string `json:"queue"`
+	WindowMinutes int    `json:"window_minutes"`
+
+	Waiting     int `json:"waiting"`
+	LongestWait int `json:"longest_wait_seconds"`
+
+	Offered       int     `json:"offered"`
+	Answered      int     `json:"answered"`
+	Abandoned     int     `json:"abandoned"`
+	TimedOut      int     `json:"timed_out"`
+	AnsweredInSLA int     `json:"answered_in_sla"`
+	ServiceLevel  float64 `json:"service_level_percent"`
+	ASA           float64 `json:"asa_seconds"`
+	AbandonRate   float64 `json:"abandon_rate_percent"`
+
+	AgentsLoggedIn  int `json:"agents_logged_in"`
+	AgentsAvailable int `json:"agents_available"`
+	AgentsOnCall    int `json:"agents_on_call"`
+	AgentsOnBreak   int `json:"agents_on_break"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// queueRef maps a mod_callcenter queue name to its tenant and queue row
+type queueRef struct {
+	tenantID   uint
+	queueID    uint
+	name       string
+	slaSeconds int
+}
+
+// outcome is one finished caller journey kept for the rolling window
+type outcome struct {
+	at      time.Time
+	outcome string
+	wait    int
+}
+
+type queueState struct {
+	ref      queueRef
+	waiting  map[string]time.Time // member UUID -> joined
+	outcomes []outcome
+}
+
+type agentInfo struct {
+	tenantID uint
+	status   string
+	state    string
+}
+
+// Monitor subscribes to mod_callcenter events, persists every transition
+// as a CallCenterEvent and keeps rolling per-queue metrics in memory. The
+// in-memory state is rebuilt from the event log on start, so a restart only
+// loses what happened while the API was down.
+type Monitor struct {
+	db     *gorm.DB
+	window time.Duration
+
+	mu          sync.Mutex
+	refs        map[string]*queueRef // by mod_callcenter queue name
+	queues      map[uint]*queueState // by queue ID
+	agents      map[string]*agentInfo
+	agentQueues map[string][]uint
+	dirty       map[uint]bool // tenants with unsent changes
+	subscribers map[uint]map[chan []QueueMetrics]struct{}
+	refreshedAt time.Time
+	reloadedAt  time.Time
+}
+
+// NewMonitor creates a contact-center monitor
+func NewMonitor(db *gorm.DB) *Monitor {
+	return &Monitor{
+		db:          db,
+		window:      DefaultWindow,
+		refs:        make(map[string]*queueRef),
+		queues:      make(map[uint]*queueState),
+		agents:      make(map[string]*agentInfo),
+		agentQueues: make(map[string][]uint),
+		dirty:       make(map[uint]bool),
+		subscribers: make(map[uint]map[chan []QueueMetrics]struct{}),
+	}
+}
+
+// Start registers for callcenter events, restores state from the event log
+// and pushes wallboard updates to subscribers every interval.
+func (m *Monitor) Start(manager *esl.Manager, interval time.Duration) {
+	if manager != nil {
+		manager.On("CUSTOM", func(ev *eventsocket.Event, _ *esl.CallSession) {
+			if ev.Get("Event-Subclass") == EventSubclass {
+				m.HandleEvent(ev)
+			}
+		})
+	}
+	m.restore(time.Now())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.flush(time.Now())
+		}
+	}()
+	log.Infof("Contact-center monitor started (window: %s)", m.window)
+}
+
+// HandleEvent records one callcenter::info event
+func (m *Monitor) HandleEvent(ev *eventsocket.Event) {
+	now := time.Now()
+	action := ev.Get("CC-Action")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch action {
+	case "agent-status-change", "agent-state-change":
+		m.agentChanged(ev, action)
+		return
+	case "member-queue-start", "agent-offering", "bridge-agent-fail",
+		"bridge-agent-start", "bridge-agent-end", "member-queue-end":
+	default:
+		return
+	}
+
+	ref := m.resolveQueue(ev.Get("CC-Queue"))
+	if ref == nil {
+		return
+	}
+	q := m.queueState(ref)
+
+	rec := models.CallCenterEvent{
+		TenantID:     ref.tenantID,
+		QueueID:      ref.queueID,
+		Queue:        ev.Get("CC-Queue"),
+		MemberUUID:   ev.Get("CC-Member-UUID"),
+		CallerNumber: ev.Get("CC-Member-CID-Number"),
+		CallerName:   ev.Get("CC-Member-CID-Name"),
+		AgentName:    ev.Get("CC-Agent"),
+	}
+	joined := epoch(ev.Get("CC-Member-Joined-Time"))
+	if !joined.IsZero() {
+		rec.JoinedAt = &joined
+	}
+
+	switch action {
+	case "member-queue-start":
+		rec.Event = models.CallCenterJoin
+		if joined.IsZero() {
+			joined = now
+			rec.JoinedAt = &joined
+		}
+		q.waiting[rec.MemberUUID] = joined
+
+	case "agent-offering":
+		rec.Event = models.CallCenterOffer
+
+	case "bridge-agent-fail":
+		rec.Event = models.CallCenterOfferFailed
+		rec.Cause = ev.Get("CC-Hangup-Cause")
+
+	case "bridge-agent-start":
+		rec.Event = models.CallCenterAnswer
+		if answered := epoch(ev.Get("CC-Agent-Answered-Time")); !answered.IsZero() && !joined.IsZero() {
+			rec.WaitSeconds = int(answered.Sub(joined).Seconds())
+		}
+		delete(q.waiting, rec.MemberUUID)
+
+	case "bridge-agent-end":
+		rec.Event = models.CallCenterComplete
+		rec.Cause = ev.Get("CC-Hangup-Cause")
+		answered := epoch(ev.Get("CC-Agent-Answered-Time"))
+		if ended := epoch(ev.Get("CC-Bridge-Terminated-Time")); !answered.IsZero() && !ended.IsZero() {
+			rec.TalkSeconds = int(ended.Sub(answered).Seconds())
+		}
+
+	case "member-queue-end":
+		rec.Event = models.CallCenterLeave
+		rec.Outcome, rec.Cause = leaveOutcome(ev)
+		left := epoch(ev.Get("CC-Member-Leaving-Time"))
+		if left.IsZero() {
+			left = now
+		}
+		if answered := epoch(ev.Get("CC-Agent-Answered-Time")); rec.Outcome == models.CallCenterOutcomeAnswered && !answered.IsZero() {
+			rec.TalkSeconds = int(left.Sub(answered).Seconds())
+			left = answered
+		}
+		if !joined.IsZero() {
+			rec.WaitSeconds = int(left.Sub(joined).Seconds())
+		} else if at, ok := q.waiting[rec.MemberUUID]; ok {
+			rec.WaitSeconds = int(left.Sub(at).Seconds())
+			rec.JoinedAt = &at
+		} else {
+			rec.JoinedAt = &left // reports bucket by join time
+		}
+		delete(q.waiting, rec.MemberUUID)
+		q.outcomes = append(q.outcomes, outcome{at: now, outcome: rec.Outcome, wait: rec.WaitSeconds})
+	}
+
+	if err := m.db.Create(&rec).Error; err != nil {
+		log.Warnf("Contact-center monitor: failed to record %s: %v", rec.Event, err)
+	}
+	m.dirty[ref.tenantID] = true
+}
+
+// agentChanged tracks agent status/state; agents are not tied to one queue
+func (m *Monitor) agentChanged(ev *eventsocket.Event, action string) {
+	name := ev.Get("CC-Agent")
+	if name == "" {
+		return
+	}
+	agent, ok := m.agents[name]
+	if !ok {
+		var qa models.QueueAgent
+		if err := m.db.Where("agent_name = ?", name).First(&qa).Error; err != nil {
+			return // not one of ours
+		}
+		agent = &agentInfo{tenantID: qa.TenantID, status: string(qa.Status), state: string(qa.State)}
+		m.agents[name] = agent
+		m.loadAgentQueues()
+	}
+
+	rec := models.CallCenterEvent{TenantID: agent.tenantID, AgentName: name}
+	if action == "agent-status-change" {
+		agent.status = ev.Get("CC-Agent-Status")
+		rec.Event = models.CallCenterAgentStatus
+	} else {
+		agent.state = ev.Get("CC-Agent-State")
+		rec.Event = models.CallCenterAgentState
+	}
+	rec.AgentStatus = agent.status
+	rec.AgentState = agent.state
+
+	if err := m.db.Create(&rec).Error; err != nil {
+		log.Warnf("Contact-center monitor: failed to record %s: %v", rec.Event, err)
+	}
+	m.dirty[agent.tenantID] = true
+}
+
+// leaveOutcome classifies member-queue-end from CC-Cause / CC-Cancel-Reason
+func leaveOutcome(ev *eventsocket.Event) (string, string) {
+	if ev.Get("CC-Cause") == "Terminated" {
+		return models.CallCenterOutcomeAnswered, ""
+	}
+	reason := ev.Get("CC-Cancel-Reason")
+	switch reason {
+	case "TIMEOUT", "NO_AGENT_TIMEOUT":
+		return models.CallCenterOutcomeTimeout, reason
+	case "BREAK_OUT", "EXIT_WITH_KEY":
+		return models.CallCenterOutcomeExited, reason
+	default:
+		return models.CallCenterOutcomeAbandoned, reason
+	}
+}
+
+// Snapshot returns the current wallboard for a tenant, one entry per queue
+func (m *Monitor) Snapshot(tenantID uint) []QueueMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loadTenantQueues(tenantID)
+	return m.snapshot(tenantID, time.Now())
+}
+
+// Subscribe delivers a tenant's wallboard whenever it changes. Slow readers
+// only ever see the latest board. Call the returned func to unsubscribe.
+func (m *Monitor) Subscribe(tenantID uint) (<-chan []QueueMetrics, func()) {
+	ch := make(chan []QueueMetrics, 1)
+
+	m.mu.Lock()
+	if m.subscribers[tenantID] == nil {
+		m.subscribers[tenantID] = make(map[chan []QueueMetrics]struct{})
+	}
+	m.subscribers[tenantID][ch] = struct{}{}
+	m.loadTenantQueues(tenantID)
+	ch <- m.snapshot(tenantID, time.Now())
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subscribers[tenantID], ch)
+		m.mu.Unlock()
+	}
+}
+
+// flush prunes the rolling window and pushes changed boards
+func (m *Monitor) flush(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refresh := now.Sub(m.refreshedAt) >= refreshEvery
+	if refresh {
+		m.refreshedAt = now
+	}
+	if now.Sub(m.reloadedAt) >= reloadEvery {
+		m.reloadedAt = now
+		m.refs = make(map[string]*queueRef)
+		m.loadAgentQueues()
+	}
+
+	cutoff := now.Add(-m.window)
+	for _, q := range m.queues {
+		i := sort.Search(len(q.outcomes), func(i int) bool { return !q.outcomes[i].at.Before(cutoff) })
+		if i > 0 {
+			q.outcomes = append(q.outcomes[:0], q.outcomes[i:]...)
+			m.dirty[q.ref.tenantID] = true
+		}
+		for member, joined := range q.waiting {
+			if now.Sub(joined) > maxOpenWait {
+				delete(q.waiting, member)
+			}
+		}
+		if refresh && len(q.waiting) > 0 {
+			m.dirty[q.ref.tenantID] = true
+		}
+	}
+
+	for tenantID := range m.dirty {
+		delete(m.dirty, tenantID)
+		subs := m.subscribers[tenantID]
+		if len(subs) == 0 {
+			continue
+		}
+		board := m.snapshot(tenantID, now)
+		for ch := range subs {
+			select {
+			case <-ch: // replace an unread board
+			default:
+			}
+			ch <- board
+		}
+	}
+}
+
+// snapshot computes the metrics of every known queue of a tenant
+func (m *Monitor) snapshot(tenantID uint, now time.Time) []QueueMetrics {
+	board := []QueueMetrics{}
+	for _, q := range m.queues {
+		if q.ref.tenantID != tenantID {
+			continue
+		}
+		qm := QueueMetrics{
+			QueueID:       q.ref.queueID,
+			Queue:         q.ref.name,
+			WindowMinutes: int(m.window.Minutes()),
+			Waiting:       len(q.waiting),
+			UpdatedAt:     now,
+		}
+		for _, joined := range q.waiting {
+			if wait := int(now.Sub(joined).Seconds()); wait > qm.LongestWait {
+				qm.LongestWait = wait
+			}
+		}
+
+		answerWait := 0
+		for _, o := range q.outcomes {
+			qm.Offered++
+			switch o.outcome {
+			case models.CallCenterOutcomeAnswered:
+				qm.Answered++
+				answerWait += o.wait
+				if o.wait <= q.ref.slaSeconds {
+					qm.AnsweredInSLA++
+				}
+			case models.CallCenterOutcomeAbandoned:
+				qm.Abandoned++
+			case models.CallCenterOutcomeTimeout:
+				qm.TimedOut++
+			}
+		}
+		if qm.Offered > 0 {
+			qm.ServiceLevel = percent(qm.AnsweredInSLA, qm.Offered)
+			qm.AbandonRate = percent(qm.Abandoned, qm.Offered)
+		}
+		if qm.Answered > 0 {
+			qm.ASA = float64(answerWait) / float64(qm.Answered)
+		}
+
+		for name, agent := range m.agents {
+			if agent.tenantID != tenantID || !containsQueue(m.agentQueues[name], q.ref.queueID) {
+				continue
+			}
+			if agent.status == "" || agent.status == string(models.AgentStatusLoggedOut) {
+				continue
+			}
+			qm.AgentsLoggedIn++
+			switch {
+			case agent.status == string(models.AgentStatusOnBreak):
+				qm.AgentsOnBreak++
+			case agent.state == string(models.AgentStateInCall) || agent.state == string(models.AgentStateReceiving):
+				qm.AgentsOnCall++
+			case agent.state == string(models.AgentStateWaiting):
+				qm.AgentsAvailable++
+			}
+		}
+		board = append(board, qm)
+	}
+	sort.Slice(board, func(i, j int) bool { return board[i].Queue < board[j].Queue })
+	return board
+}
+
+// restore rebuilds the rolling window, waiting callers and agents from the
+// database after a restart
+func (m *Monitor) restore(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var agents []models.QueueAgent
+	m.db.Find(&agents)
+	for _, a := range agents {
+		m.agents[a.AgentName] = &agentInfo{tenantID: a.TenantID, status: string(a.Status), state: string(a.State)}
+	}
+	m.loadAgentQueues()
+
+	var events []models.CallCenterEvent
+	m.db.Where("event IN ? AND created_at >= ?",
+		[]models.CallCenterEventType{models.CallCenterJoin, models.CallCenterAnswer, models.CallCenterLeave},
+		now.Add(-maxOpenWait)).
+		Order("id").Find(&events)
+
+	for _, ev := range events {
+		ref := m.resolveQueueID(ev.QueueID)
+		if ref == nil {
+			continue
+		}
+		q := m.queueState(ref)
+		switch ev.Event {
+		case models.CallCenterJoin:
+			joined := ev.CreatedAt
+			if ev.JoinedAt != nil {
+				joined = *ev.JoinedAt
+			}
+			q.waiting[ev.MemberUUID] = joined
+		case models.CallCenterAnswer:
+			delete(q.waiting, ev.MemberUUID)
+		case models.CallCenterLeave:
+			delete(q.waiting, ev.MemberUUID)
+			if ev.CreatedAt.After(now.Add(-m.window)) {
+				q.outcomes = append(q.outcomes, outcome{at: ev.CreatedAt, outcome: ev.Outcome, wait: ev.WaitSeconds})
+			}
+		}
+	}
+}
+
+// resolveQueue looks up a mod_callcenter queue name (name@domain)
+func (m *Monitor) resolveQueue(ccQueue string) *queueRef {
+	if ccQueue == "" {
+		return nil
+	}
+	if ref, ok := m.refs[ccQueue]; ok {
+		return ref
+	}
+
+	name, domain := ccQueue, ""
+	if i := strings.LastIndex(ccQueue, "@"); i >= 0 {
+		name, domain = ccQueue[:i], ccQueue[i+1:]
+	}
+	query := m.db.Model(&models.Queue{}).Where("queues.name = ?", name)
+	if domain != "" {
+		query = query.Joins("JOIN tenants ON tenants.id = queues.tenant_id").Where("tenants.domain = ?", domain)
+	}
+	var queue models.Queue
+	if err := query.First(&queue).Error; err != nil {
+		return nil
+	}
+	ref := newRef(&queue)
+	m.refs[ccQueue] = ref
+	return ref
+}
+
+// resolveQueueID looks up a queue by ID for events restored from the log
+func (m *Monitor) resolveQueueID(queueID uint) *queueRef {
+	if q, ok := m.queues[queueID]; ok {
+		return &q.ref
+	}
+	var queue models.Queue
+	if err := m.db.First(&queue, queueID).Error; err != nil {
+		return nil
+	}
+	return newRef(&queue)
+}
+
+// loadTenantQueues makes sure every queue of a tenant has a board entry
+func (m *Monitor) loadTenantQueues(tenantID uint) {
+	var queues []models.Queue
+	m.db.Where("tenant_id = ?", tenantID).Find(&queues)
+	for i := range queues {
+		if _, ok := m.queues[queues[i].ID]; !ok {
+			m.queueState(newRef(&queues[i]))
+		}
+	}
+}
+
+func newRef(queue *models.Queue) *queueRef {
+	sla := queue.ServiceLevelSeconds
+	if sla <= 0 {
+		sla = 20
+	}
+	return &queueRef{tenantID: queue.TenantID, queueID: queue.ID, name: queue.Name, slaSeconds: sla}
+}
+
+// queueState returns the live state of a queue, picking up changed settings
+func (m *Monitor) queueState(ref *queueRef) *queueState {
+	q, ok := m.queues[ref.queueID]
+	if !ok {
+		q = &queueState{waiting: make(map[string]time.Time)}
+		m.queues[ref.queueID] = q
+	}
+	q.ref = *ref
+	return q
+}
+
+func (m *Monitor) loadAgentQueues() {
+	var tiers []models.QueueAgent
+	m.db.Select("agent_name", "queue_id").Find(&tiers)
+	m.agentQueues = make(map[string][]uint)
+	for _, t := range tiers {
+		m.agentQueues[t.AgentName] = append(m.agentQueues[t.AgentName], t.QueueID)
+	}
+}
+
+func containsQueue(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// epoch parses a mod_callcenter epoch-seconds header
+func epoch(v string) time.Time {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0)
+}
+
+func percent(n, total int) float64 {
+	return float64(n) * 100 / float64(total)
+}
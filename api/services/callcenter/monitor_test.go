@@ -0,0 +1,116 @@
+package callcenter_test
+
+import (
+	"callsign/models"
+	"callsign/services/callcenter"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func ccEvent(action string, headers map[string]string) *eventsocket.Event {
+	ev := &eventsocket.Event{Header: eventsocket.EventHeader{
+		"Event-Name":     "CUSTOM",
+		"Event-Subclass": callcenter.EventSubclass,
+		"CC-Action":      action,
+	}}
+	for k, v := range headers {
+		ev.Header[k] = v
+	}
+	return ev
+}
+
+func ts(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestMonitorMetricsAndIntervals(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Tenant{}, &models.Queue{}, &models.QueueAgent{}, &models.CallCenterEvent{}))
+
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.example.com"}
+	require.NoError(t, db.Create(&tenant).Error)
+	queue := models.Queue{TenantID: tenant.ID, Name: "support", ServiceLevelSeconds: 20}
+	require.NoError(t, db.Create(&queue).Error)
+	require.NoError(t, db.Create(&models.QueueAgent{
+		TenantID: tenant.ID, QueueID: queue.ID, AgentName: "1001@acme.example.com",
+		Status: models.AgentStatusLoggedOut, State: models.AgentStateIdle,
+	}).Error)
+
+	monitor := callcenter.NewMonitor(db)
+	cc := "support@acme.example.com"
+	start := time.Now().Add(-2 * time.Minute)
+
+	monitor.HandleEvent(ccEvent("agent-status-change", map[string]string{
+		"CC-Agent": "1001@acme.example.com", "CC-Agent-Status": "Available"}))
+	monitor.HandleEvent(ccEvent("agent-state-change", map[string]string{
+		"CC-Agent": "1001@acme.example.com", "CC-Agent-State": "Waiting"}))
+
+	// Caller A answered after 10s and talked for 60s
+	monitor.HandleEvent(ccEvent("member-queue-start", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "a", "CC-Member-Joined-Time": ts(start)}))
+	monitor.HandleEvent(ccEvent("bridge-agent-start", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "a", "CC-Agent": "1001@acme.example.com",
+		"CC-Member-Joined-Time": ts(start), "CC-Agent-Answered-Time": ts(start.Add(10 * time.Second))}))
+	monitor.HandleEvent(ccEvent("member-queue-end", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "a", "CC-Cause": "Terminated",
+		"CC-Member-Joined-Time": ts(start), "CC-Agent-Answered-Time": ts(start.Add(10 * time.Second)),
+		"CC-Member-Leaving-Time": ts(start.Add(70 * time.Second))}))
+
+	// Caller B hung up after 45s
+	monitor.HandleEvent(ccEvent("member-queue-start", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "b", "CC-Member-Joined-Time": ts(start)}))
+	monitor.HandleEvent(ccEvent("member-queue-end", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "b", "CC-Cause": "Cancel", "CC-Cancel-Reason": "NONE",
+		"CC-Member-Joined-Time": ts(start), "CC-Member-Leaving-Time": ts(start.Add(45 * time.Second))}))
+
+	// Caller C is still waiting
+	monitor.HandleEvent(ccEvent("member-queue-start", map[string]string{
+		"CC-Queue": cc, "CC-Member-UUID": "c", "CC-Member-Joined-Time": ts(start)}))
+
+	// Events for unknown queues are ignored
+	monitor.HandleEvent(ccEvent("member-queue-start", map[string]string{
+		"CC-Queue": "sales@other.example.com", "CC-Member-UUID": "x"}))
+
+	board := monitor.Snapshot(tenant.ID)
+	require.Len(t, board, 1)
+	m := board[0]
+	assert.Equal(t, 1, m.Waiting)
+	assert.GreaterOrEqual(t, m.LongestWait, 119)
+	assert.Equal(t, 2, m.Offered)
+	assert.Equal(t, 1, m.Answered)
+	assert.Equal(t, 1, m.Abandoned)
+	assert.Equal(t, 50.0, m.ServiceLevel)
+	assert.Equal(t, 50.0, m.AbandonRate)
+	assert.Equal(t, 10.0, m.ASA)
+	assert.Equal(t, 1, m.AgentsAvailable)
+
+	var count int64
+	db.Model(&models.CallCenterEvent{}).Count(&count)
+	assert.Equal(t, int64(8), count)
+
+	// A restarted monitor rebuilds the board from the event log
+	restored := callcenter.NewMonitor(db)
+	restored.Start(nil, time.Hour)
+	rm := restored.Snapshot(tenant.ID)[0]
+	assert.Equal(t, 1, rm.Waiting)
+	assert.Equal(t, 2, rm.Offered)
+
+	report, err := callcenter.IntervalReport(db, tenant.ID, 0, start.Add(-time.Hour), start.Add(time.Hour), 15, time.UTC)
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal(t, 2, report[0].Offered)
+	assert.Equal(t, 60.0, report[0].AvgTalk)
+	assert.Equal(t, 45, report[0].MaxWait)
+	assert.Equal(t, 0, report[0].Start.Minute()%15)
+
+	_, err = callcenter.IntervalReport(db, tenant.ID, 0, start, start, 20, time.UTC)
+	assert.Error(t, err)
+}
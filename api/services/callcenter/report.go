@@ -0,0 +1,128 @@
+package callcenter
+
+import (
+	"callsign/models"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IntervalStats summarises the callers of one queue who entered it during
+// one report interval.
+type IntervalStats struct {
+	Start     time.Time `json:"start"`
+	QueueID   uint      `json:"queue_id"`
+	QueueName string    `json:"queue_name"`
+
+	Offered       int     `json:"offered"`
+	Answered      int     `json:"answered"`
+	Abandoned     int     `json:"abandoned"`
+	TimedOut      int     `json:"timed_out"`
+	Exited        int     `json:"exited"`
+	AnsweredInSLA int     `json:"answered_in_sla"`
+	ServiceLevel  float64 `json:"service_level_percent"`
+	ASA           float64 `json:"asa_seconds"`
+	AbandonRate   float64 `json:"abandon_rate_percent"`
+	AvgTalk       float64 `json:"avg_talk_seconds"`
+	MaxWait       int     `json:"max_wait_seconds"`
+
+	answerWait int
+	talk       int
+}
+
+// IntervalReport buckets the caller journeys of a tenant's queues (or one
+// queue when queueID is set) into 15, 30 or 60 minute intervals, aligned to
+// the wall clock in loc.
+func IntervalReport(db *gorm.DB, tenantID, queueID uint, from, to time.Time, minutes int, loc *time.Location) ([]IntervalStats, error) {
+	switch minutes {
+	case 15, 30, 60:
+	default:
+		return nil, fmt.Errorf("interval must be 15, 30 or 60 minutes")
+	}
+
+	queues := make(map[uint]models.Queue)
+	var rows []models.Queue
+	db.Unscoped().Where("tenant_id = ?", tenantID).Find(&rows)
+	for _, q := range rows {
+		queues[q.ID] = q
+	}
+
+	query := db.Where("tenant_id = ? AND event = ? AND joined_at >= ? AND joined_at < ?",
+		tenantID, models.CallCenterLeave, from, to)
+	if queueID != 0 {
+		query = query.Where("queue_id = ?", queueID)
+	}
+	var events []models.CallCenterEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		start int64
+		queue uint
+	}
+	buckets := make(map[key]*IntervalStats)
+	for _, ev := range events {
+		if ev.JoinedAt == nil {
+			continue
+		}
+		start := intervalStart(ev.JoinedAt.In(loc), minutes)
+		k := key{start.Unix(), ev.QueueID}
+		b, ok := buckets[k]
+		if !ok {
+			b = &IntervalStats{Start: start, QueueID: ev.QueueID, QueueName: queues[ev.QueueID].Name}
+			buckets[k] = b
+		}
+
+		b.Offered++
+		if ev.WaitSeconds > b.MaxWait {
+			b.MaxWait = ev.WaitSeconds
+		}
+		switch ev.Outcome {
+		case models.CallCenterOutcomeAnswered:
+			b.Answered++
+			b.answerWait += ev.WaitSeconds
+			b.talk += ev.TalkSeconds
+			sla := queues[ev.QueueID].ServiceLevelSeconds
+			if sla <= 0 {
+				sla = 20
+			}
+			if ev.WaitSeconds <= sla {
+				b.AnsweredInSLA++
+			}
+		case models.CallCenterOutcomeAbandoned:
+			b.Abandoned++
+		case models.CallCenterOutcomeTimeout:
+			b.TimedOut++
+		case models.CallCenterOutcomeExited:
+			b.Exited++
+		}
+	}
+
+	report := make([]IntervalStats, 0, len(buckets))
+	for _, b := range buckets {
+		b.ServiceLevel = percent(b.AnsweredInSLA, b.Offered)
+		b.AbandonRate = percent(b.Abandoned, b.Offered)
+		if b.Answered > 0 {
+			b.ASA = float64(b.answerWait) / float64(b.Answered)
+			b.AvgTalk = float64(b.talk) / float64(b.Answered)
+		}
+		report = append(report, *b)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if !report[i].Start.Equal(report[j].Start) {
+			return report[i].Start.Before(report[j].Start)
+		}
+		return report[i].QueueName < report[j].QueueName
+	})
+	return report, nil
+}
+
+// intervalStart floors t to the start of its interval on the local clock
+func intervalStart(t time.Time, minutes int) time.Time {
+	y, m, d := t.Date()
+	minute := (t.Hour()*60 + t.Minute()) / minutes * minutes
+	return time.Date(y, m, d, minute/60, minute%60, 0, 0, t.Location())
+}
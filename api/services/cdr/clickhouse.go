@@ -95,6 +95,11 @@ func (c *ClickHouseClient) initSchema() error {
 		queue_name String,
 		rate Decimal(10, 6),
 		cost Decimal(10, 4),
+		currency LowCardinality(String) DEFAULT 'USD',
+		rate_prefix String,
+		billed_sec UInt32,
+		carrier_rate Decimal(10, 6),
+		carrier_cost Decimal(10, 4),
 		extension String,
 		extension_id UInt32,
 		user_id UInt32,
@@ -109,6 +114,19 @@ func (c *ClickHouseClient) initSchema() error {
 		return fmt.Errorf("failed to create cdr table: %w", err)
 	}
 
+	// Rating columns added after the table was first released
+	for _, column := range []string{
+		"currency LowCardinality(String) DEFAULT 'USD' AFTER cost",
+		"rate_prefix String AFTER currency",
+		"billed_sec UInt32 AFTER rate_prefix",
+		"carrier_rate Decimal(10, 6) AFTER billed_sec",
+		"carrier_cost Decimal(10, 4) AFTER carrier_rate",
+	} {
+		if err := c.conn.Exec(ctx, "ALTER TABLE cdr ADD COLUMN IF NOT EXISTS "+column); err != nil {
+			return fmt.Errorf("failed to add cdr column: %w", err)
+		}
+	}
+
 	// Hourly stats materialized view
 	statsView := `
 	CREATE MATERIALIZED VIEW IF NOT EXISTS cdr_hourly_stats
@@ -149,8 +167,9 @@ func (c *ClickHouseClient) InsertCDR(record *models.CallRecord) error {
 		start_time, answer_time, end_time,
 		duration, billable_sec, direction, context, hangup_cause, sip_code,
 		gateway_name, recorded, recording_path, voicemail, conference,
-		queue, queue_name, rate, cost, extension, extension_id, user_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		queue, queue_name, rate, cost, currency, rate_prefix, billed_sec,
+		carrier_rate, carrier_cost, extension, extension_id, user_id
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	return c.conn.Exec(ctx, query,
@@ -161,6 +180,8 @@ func (c *ClickHouseClient) InsertCDR(record *models.CallRecord) error {
 		record.HangupCause, record.SIPCode, record.GatewayName,
 		record.Recorded, record.RecordingPath, record.Voicemail, record.Conference,
 		record.Queue, record.QueueName, record.Rate, record.Cost,
+		record.Currency, record.RatePrefix, record.BilledSec,
+		record.CarrierRate, record.CarrierCost,
 		record.Extension, record.ExtensionID, record.UserID,
 	)
 }
@@ -179,7 +200,8 @@ func (c *ClickHouseClient) BatchInsert(records []*models.CallRecord) error {
 			start_time, answer_time, end_time,
 			duration, billable_sec, direction, context, hangup_cause, sip_code,
 			gateway_name, recorded, recording_path, voicemail, conference,
-			queue, queue_name, rate, cost, extension, extension_id, user_id
+			queue, queue_name, rate, cost, currency, rate_prefix, billed_sec,
+			carrier_rate, carrier_cost, extension, extension_id, user_id
 		)
 	`)
 	if err != nil {
@@ -195,6 +217,8 @@ func (c *ClickHouseClient) BatchInsert(records []*models.CallRecord) error {
 			r.HangupCause, r.SIPCode, r.GatewayName,
 			r.Recorded, r.RecordingPath, r.Voicemail, r.Conference,
 			r.Queue, r.QueueName, r.Rate, r.Cost,
+			r.Currency, r.RatePrefix, r.BilledSec,
+			r.CarrierRate, r.CarrierCost,
 			r.Extension, r.ExtensionID, r.UserID,
 		)
 		if err != nil {
@@ -205,6 +229,47 @@ func (c *ClickHouseClient) BatchInsert(records []*models.CallRecord) error {
 	return batch.Send()
 }
 
+// UpdateRating rewrites the rating columns of records that were re-rated
+// after being inserted. One mutation covers the whole batch.
+func (c *ClickHouseClient) UpdateRating(records []*models.CallRecord) error {
+	if !c.enabled || c.conn == nil || len(records) == 0 {
+		return nil
+	}
+
+	uuids := make([]string, len(records))
+	rates := make([]float64, len(records))
+	costs := make([]float64, len(records))
+	currencies := make([]string, len(records))
+	prefixes := make([]string, len(records))
+	billed := make([]uint32, len(records))
+	carrierRates := make([]float64, len(records))
+	carrierCosts := make([]float64, len(records))
+	for i, r := range records {
+		uuids[i] = r.UUID.String()
+		rates[i], costs[i] = r.Rate, r.Cost
+		currencies[i], prefixes[i] = r.Currency, r.RatePrefix
+		billed[i] = uint32(r.BilledSec)
+		carrierRates[i], carrierCosts[i] = r.CarrierRate, r.CarrierCost
+	}
+
+	// transform() maps each uuid to its new value; the cast back to the
+	// column type happens in the mutation
+	return c.conn.Exec(context.Background(), `
+		ALTER TABLE cdr UPDATE
+			rate = transform(toString(uuid), ?, ?, toFloat64(rate)),
+			cost = transform(toString(uuid), ?, ?, toFloat64(cost)),
+			currency = transform(toString(uuid), ?, ?, toString(currency)),
+			rate_prefix = transform(toString(uuid), ?, ?, rate_prefix),
+			billed_sec = transform(toString(uuid), ?, ?, billed_sec),
+			carrier_rate = transform(toString(uuid), ?, ?, toFloat64(carrier_rate)),
+			carrier_cost = transform(toString(uuid), ?, ?, toFloat64(carrier_cost))
+		WHERE toString(uuid) IN ?
+	`,
+		uuids, rates, uuids, costs, uuids, currencies, uuids, prefixes,
+		uuids, billed, uuids, carrierRates, uuids, carrierCosts, uuids,
+	)
+}
+
 // Close closes the ClickHouse connection
 func (c *ClickHouseClient) Close() error {
 	if c.conn != nil {
@@ -279,6 +344,34 @@ func (s *SyncJob) Run() error {
 		log.Infof("Synced %d CDR records to ClickHouse", len(records))
 	}
 
+	// Push re-rated costs of records ClickHouse already has
+	for {
+		var records []*models.CallRecord
+		result := s.db.Where("synced_to_click_house = ? AND rerate_sync_pending = ?", true, true).
+			Limit(s.batch).
+			Find(&records)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if len(records) == 0 {
+			break
+		}
+
+		if err := s.ch.UpdateRating(records); err != nil {
+			log.Errorf("ClickHouse rating update failed: %v", err)
+			return err
+		}
+
+		ids := make([]uint, len(records))
+		for i, r := range records {
+			ids[i] = r.ID
+		}
+		s.db.Model(&models.CallRecord{}).Where("id IN ?", ids).Update("rerate_sync_pending", false)
+		log.Infof("Updated rating of %d CDR records in ClickHouse", len(records))
+	}
+
 	log.Infof("CDR sync completed: %d records in %v", total, time.Since(start))
 	return nil
 }
@@ -300,7 +393,7 @@ func (s *SyncJob) StartPeriodicSync(interval time.Duration) {
 // CleanupOldRecords removes PostgreSQL records older than retention period
 func (s *SyncJob) CleanupOldRecords(retentionDays int) error {
 	cutoff := time.Now().AddDate(0, 0, -retentionDays)
-	result := s.db.Where("synced_to_click_house = ? AND created_at < ?", true, cutoff).
+	result := s.db.Where("synced_to_click_house = ? AND rerate_sync_pending = ? AND created_at < ?", true, false, cutoff).
 		Delete(&models.CallRecord{})
 
 	if result.Error != nil {
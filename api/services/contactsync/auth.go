@@ -0,0 +1,241 @@
+package contactsync
+
+import (
+	"callsign/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenLeeway renews OAuth2 access tokens this long before they expire
+const tokenLeeway = time.Minute
+
+// ErrNoEncryption is returned when a source needs credentials but no
+// encryption key is configured to protect them
+var ErrNoEncryption = errors.New("encryption is not configured")
+
+// AuthConfig holds a source's credentials; it is stored encrypted on the
+// ContactWebhook. Which fields apply depends on the webhook's AuthType.
+type AuthConfig struct {
+	// basic
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// bearer
+	Token string `json:"token,omitempty"`
+
+	// oauth2
+	TokenURL     string `json:"token_url,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	Audience     string `json:"audience,omitempty"`
+	GrantType    string `json:"grant_type,omitempty"`    // client_credentials (default), refresh_token
+	RefreshToken string `json:"refresh_token,omitempty"` // Replaced when the server rotates it
+	AuthStyle    string `json:"auth_style,omitempty"`    // body (default) or header: how client credentials are sent
+}
+
+// Validate checks the credentials needed for an auth type are present
+func (a *AuthConfig) Validate(authType string) error {
+	switch authType {
+	case "", "none":
+	case "basic":
+		if a.Username == "" {
+			return errors.New("basic auth needs a username")
+		}
+	case "bearer":
+		if a.Token == "" {
+			return errors.New("bearer auth needs a token")
+		}
+	case "oauth2":
+		if a.TokenURL == "" || a.ClientID == "" {
+			return errors.New("oauth2 needs token_url and client_id")
+		}
+		switch a.GrantType {
+		case "", "client_credentials":
+		case "refresh_token":
+			if a.RefreshToken == "" {
+				return errors.New("the refresh_token grant needs a refresh_token")
+			}
+		default:
+			return fmt.Errorf("unsupported oauth2 grant_type %q", a.GrantType)
+		}
+	default:
+		return fmt.Errorf("unsupported auth_type %q", authType)
+	}
+	return nil
+}
+
+// accessToken is a cached OAuth2 access token
+type accessToken struct {
+	value   string
+	expires time.Time // Zero when the server gave no lifetime
+}
+
+// EncryptAuthConfig encrypts credentials for storing on a ContactWebhook
+func (s *Syncer) EncryptAuthConfig(auth *AuthConfig) (string, error) {
+	raw, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	if string(raw) == "{}" {
+		return "", nil
+	}
+	if s.enc == nil {
+		return "", ErrNoEncryption
+	}
+	return s.enc.Encrypt(string(raw))
+}
+
+// authConfig decrypts a source's credentials
+func (s *Syncer) authConfig(webhook *models.ContactWebhook) (*AuthConfig, error) {
+	auth := &AuthConfig{}
+	if webhook.AuthConfig == "" {
+		return auth, nil
+	}
+	if s.enc == nil {
+		return nil, ErrNoEncryption
+	}
+	plain, err := s.enc.Decrypt(webhook.AuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt auth config: %w", err)
+	}
+	if err := json.Unmarshal([]byte(plain), auth); err != nil {
+		return nil, fmt.Errorf("parse auth config: %w", err)
+	}
+	return auth, nil
+}
+
+// Authorize adds a source's custom headers and credentials to a request,
+// fetching an OAuth2 access token when none is cached
+func (s *Syncer) Authorize(req *http.Request, webhook *models.ContactWebhook) error {
+	ApplyHeaders(req, webhook.FetchHeaders)
+
+	switch webhook.AuthType {
+	case "", "none":
+		return nil
+	}
+	auth, err := s.authConfig(webhook)
+	if err != nil {
+		return err
+	}
+	switch webhook.AuthType {
+	case "basic":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case "oauth2":
+		token, err := s.token(webhook, auth)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return fmt.Errorf("unsupported auth_type %q", webhook.AuthType)
+	}
+	return nil
+}
+
+// forgetToken drops a cached access token the source has rejected
+func (s *Syncer) forgetToken(webhookID uint) {
+	s.mu.Lock()
+	delete(s.tokens, webhookID)
+	s.mu.Unlock()
+}
+
+// token returns a live OAuth2 access token for a source
+func (s *Syncer) token(webhook *models.ContactWebhook, auth *AuthConfig) (string, error) {
+	s.mu.Lock()
+	cached := s.tokens[webhook.ID]
+	s.mu.Unlock()
+	if cached != nil && (cached.expires.IsZero() || time.Now().Add(tokenLeeway).Before(cached.expires)) {
+		return cached.value, nil
+	}
+
+	form := url.Values{}
+	if auth.GrantType == "refresh_token" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", auth.RefreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if auth.Scope != "" {
+		form.Set("scope", auth.Scope)
+	}
+	if auth.Audience != "" {
+		form.Set("audience", auth.Audience)
+	}
+	if auth.AuthStyle != "header" {
+		form.Set("client_id", auth.ClientID)
+		if auth.ClientSecret != "" {
+			form.Set("client_secret", auth.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, auth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if auth.AuthStyle == "header" {
+		req.SetBasicAuth(url.QueryEscape(auth.ClientID), url.QueryEscape(auth.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+
+	var result struct {
+		AccessToken  string      `json:"access_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+		RefreshToken string      `json:"refresh_token"`
+		Error        string      `json:"error"`
+		Description  string      `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &result)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || result.AccessToken == "" {
+		reason := result.Error
+		if result.Description != "" {
+			reason += ": " + result.Description
+		}
+		if reason == "" {
+			reason = "no access token returned"
+		}
+		return "", fmt.Errorf("token endpoint returned %d (%s)", resp.StatusCode, reason)
+	}
+
+	token := &accessToken{value: result.AccessToken}
+	if secs, err := result.ExpiresIn.Int64(); err == nil && secs > 0 {
+		token.expires = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	s.mu.Lock()
+	s.tokens[webhook.ID] = token
+	s.mu.Unlock()
+
+	// Servers that rotate refresh tokens invalidate the old one, so keep the new one
+	if auth.GrantType == "refresh_token" && result.RefreshToken != "" && result.RefreshToken != auth.RefreshToken {
+		auth.RefreshToken = result.RefreshToken
+		sealed, err := s.EncryptAuthConfig(auth)
+		if err != nil {
+			log.Warnf("Contact sync: failed to store rotated refresh token for source %d: %v", webhook.ID, err)
+		} else {
+			webhook.AuthConfig = sealed
+			s.db.Model(&models.ContactWebhook{}).Where("id = ?", webhook.ID).Update("auth_config", sealed)
+		}
+	}
+	return token.value, nil
+}
@@ -0,0 +1,176 @@
+package contactsync
+
+import (
+	"callsign/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// autoFieldKeys are the record keys tried, in order, for each contact field
+// when a source has no field mapping. They cover common CRM and webhook names.
+var autoFieldKeys = map[string][]string{
+	"FirstName":   {"first_name", "firstName", "given_name", "givenName", "name"},
+	"LastName":    {"last_name", "lastName", "family_name", "familyName", "surname"},
+	"DisplayName": {"display_name", "displayName", "full_name", "fullName", "name"},
+	"Company":     {"company", "company_name", "companyName", "organization", "org"},
+	"Title":       {"title", "job_title", "jobTitle", "position"},
+	"Email":       {"email", "email_address", "emailAddress"},
+	"Phone":       {"phone", "phone_number", "phoneNumber", "telephone"},
+	"MobilePhone": {"mobile_phone", "mobilePhone", "cell_phone", "cellPhone", "mobile"},
+	"Address1":    {"address1", "address_1", "street_address", "streetAddress", "address"},
+	"City":        {"city", "town"},
+	"State":       {"state", "province", "region"},
+	"PostalCode":  {"postal_code", "postalCode", "zip", "zip_code", "zipCode"},
+	"Country":     {"country"},
+}
+
+// MapFields returns the contact field values a record provides, keyed by
+// Contact field name. fieldMappingJSON maps field names to dotted record
+// paths (e.g. {"FirstName": "properties.firstname"}); when it is empty or
+// invalid, common key names are matched instead.
+func MapFields(data map[string]interface{}, fieldMappingJSON string) map[string]string {
+	values := make(map[string]string)
+
+	var fieldMapping map[string]string
+	if fieldMappingJSON == "" || json.Unmarshal([]byte(fieldMappingJSON), &fieldMapping) != nil {
+		for field, keys := range autoFieldKeys {
+			for _, key := range keys {
+				if value, exists := data[key]; exists {
+					values[field] = stringValue(value)
+					break
+				}
+			}
+		}
+		return values
+	}
+
+	for field, path := range fieldMapping {
+		if contactField(&models.Contact{}, field) == nil {
+			continue
+		}
+		if value, exists := Lookup(data, path); exists {
+			values[field] = stringValue(value)
+		}
+	}
+	return values
+}
+
+// ApplyFieldMapping maps a record onto a contact, see MapFields
+func ApplyFieldMapping(contact models.Contact, data map[string]interface{}, fieldMappingJSON string) models.Contact {
+	for field, value := range MapFields(data, fieldMappingJSON) {
+		SetContactField(&contact, field, value)
+	}
+	return contact
+}
+
+// SetContactField sets a mappable contact field by name; unknown names are ignored
+func SetContactField(contact *models.Contact, field, value string) {
+	if p := contactField(contact, field); p != nil {
+		*p = value
+	}
+}
+
+// ContactField reads a mappable contact field by name
+func ContactField(contact *models.Contact, field string) string {
+	if p := contactField(contact, field); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// contactField points at the contact field a mapping may write, or nil
+func contactField(contact *models.Contact, field string) *string {
+	switch field {
+	case "FirstName":
+		return &contact.FirstName
+	case "LastName":
+		return &contact.LastName
+	case "DisplayName":
+		return &contact.DisplayName
+	case "Company":
+		return &contact.Company
+	case "Title":
+		return &contact.Title
+	case "Email":
+		return &contact.Email
+	case "Phone":
+		return &contact.Phone
+	case "PhoneAlt":
+		return &contact.PhoneAlt
+	case "MobilePhone":
+		return &contact.MobilePhone
+	case "Address1":
+		return &contact.Address1
+	case "Address2":
+		return &contact.Address2
+	case "City":
+		return &contact.City
+	case "State":
+		return &contact.State
+	case "PostalCode":
+		return &contact.PostalCode
+	case "Country":
+		return &contact.Country
+	case "Notes":
+		return &contact.Notes
+	case "PreferredChannel":
+		return &contact.PreferredChannel
+	case "PreferredLanguage":
+		return &contact.PreferredLanguage
+	case "Timezone":
+		return &contact.Timezone
+	case "Status":
+		return &contact.Status
+	}
+	return nil
+}
+
+// Lookup reads a dotted path ("properties.email") from a decoded JSON object.
+// A key containing the whole path is tried first, so flat keys with dots work.
+func Lookup(data map[string]interface{}, path string) (interface{}, bool) {
+	if value, exists := data[path]; exists {
+		return value, true
+	}
+	var current interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stringValue renders a JSON value as a contact field
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		// Large IDs and phone numbers decoded without UseNumber
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", v), "0"), ".")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// ApplyHeaders sets a source's custom headers (a JSON object) on a request
+func ApplyHeaders(req *http.Request, headersJSON string) {
+	if headersJSON == "" {
+		return
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(headersJSON), &headers); err != nil {
+		return
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+}
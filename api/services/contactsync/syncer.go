@@ -0,0 +1,688 @@
+// Package contactsync keeps contacts in step with external CRM sources.
+// Each enabled ContactWebhook with a list URL is pulled in full on its sync
+// interval: pages are followed, records are mapped onto contacts and
+// upserted by external ID, and contacts the source stops returning are
+// archived or deleted. Every pull is recorded as a ContactSyncRun.
+package contactsync
+
+import (
+	"bytes"
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/encryption"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Sync triggers recorded on runs
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+const (
+	// maxPages bounds a single pull, in case a source never stops paging
+	maxPages = 1000
+	// maxResponseBytes bounds one page of a source's response
+	maxResponseBytes = 20 << 20
+	// maxErrorDetails bounds the per-record errors kept on a run
+	maxErrorDetails = 50
+	// deleteBatch bounds the IDs per archive or delete statement
+	deleteBatch = 500
+)
+
+// listKeys are tried, in order, for the contact array when a source sets no list path
+var listKeys = []string{"data", "results", "contacts", "items", "records"}
+
+var (
+	// ErrSyncRunning is returned when a source is already being pulled
+	ErrSyncRunning = errors.New("a sync is already running for this source")
+	// ErrNoListURL is returned for sources without a list URL
+	ErrNoListURL = errors.New("source has no list URL")
+)
+
+// Syncer pulls contact lists from ContactWebhook sources on their sync
+// interval, or on demand. A source is claimed through its last sync status,
+// so a scheduled and a manual pull never overlap.
+type Syncer struct {
+	db     *gorm.DB
+	enc    *encryption.Manager
+	client *http.Client
+
+	// OAuth2 access tokens, keyed by webhook ID
+	tokens map[uint]*accessToken
+	mu     sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSyncer creates a contact syncer. Credentials are decrypted with the
+// configured encryption key; without one, only sources needing no
+// credentials can be pulled.
+func NewSyncer(db *gorm.DB, cfg *config.Config) *Syncer {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Syncer{
+		db:     db,
+		client: &http.Client{Timeout: 30 * time.Second},
+		tokens: make(map[uint]*accessToken),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if mgr, err := encryption.NewManagerFromConfig(cfg.EncryptionKey, cfg.EncryptionSalt); err == nil {
+		s.enc = mgr
+	}
+	return s
+}
+
+// Start polls for sources due a sync
+func (s *Syncer) Start(interval time.Duration) {
+	// Pulls running when the server stopped never finished
+	s.db.Model(&models.ContactSyncRun{}).Where("status = ?", models.ContactSyncRunning).
+		Updates(map[string]interface{}{"status": models.ContactSyncFailed, "error": "interrupted by restart", "finished_at": time.Now()})
+	s.db.Model(&models.ContactWebhook{}).Where("last_sync_status = ?", models.ContactSyncRunning).
+		Updates(map[string]interface{}{"last_sync_status": models.ContactSyncFailed, "last_sync_error": "interrupted by restart"})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.poll()
+			}
+		}
+	}()
+	log.Infof("Contact sync scheduler started (interval: %s)", interval)
+}
+
+// Stop cancels pulls in progress and waits for them to finish
+func (s *Syncer) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// poll pulls every source whose sync interval has elapsed
+func (s *Syncer) poll() {
+	var webhooks []models.ContactWebhook
+	if err := s.db.Where("enabled = ? AND list_url <> '' AND sync_interval > 0", true).
+		Where("last_sync_status IS NULL OR last_sync_status <> ?", models.ContactSyncRunning).
+		Find(&webhooks).Error; err != nil {
+		log.Warnf("Contact sync: failed to load sources: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range webhooks {
+		w := &webhooks[i]
+		if w.LastSyncAt != nil && now.Before(w.LastSyncAt.Add(time.Duration(w.SyncInterval)*time.Second)) {
+			continue
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		if _, err := s.Sync(w, TriggerSchedule); err != nil && !errors.Is(err, ErrSyncRunning) {
+			log.Warnf("Contact sync: source %d: %v", w.ID, err)
+		}
+	}
+}
+
+// Trigger starts pulling a source in the background and returns its run
+func (s *Syncer) Trigger(webhook *models.ContactWebhook, trigger string) (*models.ContactSyncRun, error) {
+	run, err := s.claim(webhook, trigger)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, w := *run, *webhook
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.pull(&w, run)
+	}()
+	return &snapshot, nil
+}
+
+// Sync pulls a source and returns the finished run
+func (s *Syncer) Sync(webhook *models.ContactWebhook, trigger string) (*models.ContactSyncRun, error) {
+	run, err := s.claim(webhook, trigger)
+	if err != nil {
+		return nil, err
+	}
+	s.pull(webhook, run)
+	return run, nil
+}
+
+// claim marks a source as running and opens its run record
+func (s *Syncer) claim(webhook *models.ContactWebhook, trigger string) (*models.ContactSyncRun, error) {
+	if webhook.ListURL == "" {
+		return nil, ErrNoListURL
+	}
+	result := s.db.Model(&models.ContactWebhook{}).
+		Where("id = ? AND (last_sync_status IS NULL OR last_sync_status <> ?)", webhook.ID, models.ContactSyncRunning).
+		Updates(map[string]interface{}{"last_sync_status": models.ContactSyncRunning, "last_sync_error": ""})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSyncRunning
+	}
+
+	run := &models.ContactSyncRun{
+		TenantID:  webhook.TenantID,
+		WebhookID: webhook.ID,
+		Trigger:   trigger,
+		Status:    models.ContactSyncRunning,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		s.db.Model(&models.ContactWebhook{}).Where("id = ?", webhook.ID).
+			Updates(map[string]interface{}{"last_sync_status": models.ContactSyncFailed, "last_sync_error": err.Error()})
+		return nil, err
+	}
+	return run, nil
+}
+
+// syncState is what one pull tracks between pages
+type syncState struct {
+	webhook *models.ContactWebhook
+	run     *models.ContactSyncRun
+	seen    map[string]bool // External IDs the source returned
+	details []string
+	now     time.Time
+}
+
+// fail records a per-record error on the run
+func (st *syncState) fail(format string, args ...interface{}) {
+	st.run.Errors++
+	if len(st.details) < maxErrorDetails {
+		st.details = append(st.details, fmt.Sprintf(format, args...))
+	}
+}
+
+// pull fetches every page of a source, upserts the records and detects
+// deletions, then closes the run
+func (s *Syncer) pull(webhook *models.ContactWebhook, run *models.ContactSyncRun) {
+	st := &syncState{webhook: webhook, run: run, seen: make(map[string]bool), now: run.StartedAt}
+
+	err := s.fetchAll(st)
+	if err == nil && webhook.DeletePolicy != models.ContactDeleteIgnore && len(st.seen) > 0 {
+		// Only a complete, non-empty pull says what the source no longer has
+		err = s.removeMissing(st)
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	switch {
+	case err != nil:
+		run.Status = models.ContactSyncFailed
+		run.Error = err.Error()
+	case run.Errors > 0:
+		run.Status = models.ContactSyncPartial
+		run.Error = fmt.Sprintf("%d records failed", run.Errors)
+	default:
+		run.Status = models.ContactSyncSuccess
+	}
+	if len(st.details) > 0 {
+		raw, _ := json.Marshal(st.details)
+		run.ErrorDetails = string(raw)
+	}
+	if dbErr := s.db.Save(run).Error; dbErr != nil {
+		log.Warnf("Contact sync: failed to save run %d: %v", run.ID, dbErr)
+	}
+
+	webhook.LastSyncAt = &run.StartedAt
+	webhook.LastSyncStatus = run.Status
+	webhook.LastSyncError = run.Error
+	s.db.Model(&models.ContactWebhook{}).Where("id = ?", webhook.ID).Updates(map[string]interface{}{
+		"last_sync_at":     run.StartedAt,
+		"last_sync_status": run.Status,
+		"last_sync_error":  run.Error,
+	})
+
+	log.WithFields(log.Fields{
+		"webhook_id": webhook.ID,
+		"tenant_id":  webhook.TenantID,
+		"status":     run.Status,
+		"fetched":    run.Fetched,
+		"created":    run.Created,
+		"updated":    run.Updated,
+		"deleted":    run.Deleted,
+		"errors":     run.Errors,
+	}).Info("Contact sync finished")
+}
+
+// fetchAll walks the source's pages, upserting each record
+func (s *Syncer) fetchAll(st *syncState) error {
+	w := st.webhook
+	pageSize := w.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	page, offset, cursor := 1, 0, ""
+	next := ""
+	visited := make(map[string]bool)
+	for st.run.Pages < maxPages {
+		pageURL, err := s.pageURL(w, next, pageSize, page, offset, cursor)
+		if err != nil {
+			return err
+		}
+		if visited[pageURL] {
+			return fmt.Errorf("source repeated page %s", pageURL)
+		}
+		visited[pageURL] = true
+
+		doc, header, err := s.fetch(w, pageURL)
+		if err != nil {
+			return err
+		}
+		records, err := extractRecords(doc, w.ListPath)
+		if err != nil {
+			return err
+		}
+		st.run.Pages++
+		st.run.Fetched += len(records)
+		for _, record := range records {
+			s.upsert(st, record)
+		}
+
+		switch w.Pagination {
+		case "page":
+			if len(records) < pageSize {
+				return nil
+			}
+			page++
+		case "offset":
+			if len(records) < pageSize {
+				return nil
+			}
+			offset += len(records)
+		case "cursor":
+			if cursor = nextValue(doc, w.NextPath, "next_cursor"); cursor == "" {
+				return nil
+			}
+		case "link":
+			link := nextValue(doc, w.NextPath, "")
+			if w.NextPath == "" {
+				link = nextLink(header.Get("Link"))
+			}
+			if link == "" {
+				return nil
+			}
+			resolved, err := url.Parse(pageURL)
+			if err != nil {
+				return err
+			}
+			ref, err := url.Parse(link)
+			if err != nil {
+				return fmt.Errorf("invalid next link %q", link)
+			}
+			next = resolved.ResolveReference(ref).String()
+		default:
+			return nil
+		}
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+	}
+	return fmt.Errorf("stopped after %d pages", maxPages)
+}
+
+// pageURL builds the request for the next page. Link pagination follows
+// the source's own URLs after the first page.
+func (s *Syncer) pageURL(w *models.ContactWebhook, next string, pageSize, page, offset int, cursor string) (string, error) {
+	if next != "" {
+		return next, nil
+	}
+	u, err := url.Parse(w.ListURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid list URL: %w", err)
+	}
+	q := u.Query()
+	if w.PageSizeParam != "" && w.Pagination != "" && w.Pagination != "none" {
+		q.Set(w.PageSizeParam, strconv.Itoa(pageSize))
+	}
+	param := w.PageParam
+	switch w.Pagination {
+	case "page":
+		if param == "" {
+			param = "page"
+		}
+		q.Set(param, strconv.Itoa(page))
+	case "offset":
+		if param == "" {
+			param = "offset"
+		}
+		q.Set(param, strconv.Itoa(offset))
+	case "cursor":
+		if param == "" {
+			param = "cursor"
+		}
+		if cursor != "" {
+			q.Set(param, cursor)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// fetch requests one page, renewing the OAuth2 token once if the source
+// rejects it
+func (s *Syncer) fetch(w *models.ContactWebhook, pageURL string) (interface{}, http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		if err := s.Authorize(req, w); err != nil {
+			return nil, nil, fmt.Errorf("authorize: %w", err)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("request: %w", err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && w.AuthType == "oauth2" && attempt == 0 {
+			s.forgetToken(w.ID)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, nil, fmt.Errorf("source returned status %d", resp.StatusCode)
+		}
+
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON response: %w", err)
+		}
+		return doc, resp.Header, nil
+	}
+}
+
+// extractRecords finds the contact array in a page
+func extractRecords(doc interface{}, listPath string) ([]map[string]interface{}, error) {
+	list, isList := doc.([]interface{})
+	if !isList {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("response is neither a list nor an object")
+		}
+		if listPath != "" {
+			value, _ := Lookup(obj, listPath)
+			if list, isList = value.([]interface{}); !isList {
+				return nil, fmt.Errorf("no contact list at %q", listPath)
+			}
+		} else {
+			for _, key := range listKeys {
+				if list, isList = obj[key].([]interface{}); isList {
+					break
+				}
+			}
+			if !isList {
+				return nil, errors.New("no contact list in response; set list_path")
+			}
+		}
+	}
+
+	records := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if record, ok := item.(map[string]interface{}); ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// nextValue reads the next cursor or link from a page body
+func nextValue(doc interface{}, path, fallback string) string {
+	if path == "" {
+		path = fallback
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok || path == "" {
+		return ""
+	}
+	value, _ := Lookup(obj, path)
+	return stringValue(value)
+}
+
+// nextLink returns the rel="next" target of an RFC 8288 Link header
+func nextLink(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		segments := strings.Split(part, ";")
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == `rel="next"` || param == "rel=next" {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// upsert maps one record onto its contact. Contacts are matched by
+// external ID, then adopted by email or phone if not yet linked to a
+// source. Fields changed locally since the last sync keep their local
+// value under the local conflict policy.
+func (s *Syncer) upsert(st *syncState, record map[string]interface{}) {
+	w := st.webhook
+	idField := w.ExternalIDField
+	if idField == "" {
+		idField = "id"
+	}
+	rawID, _ := Lookup(record, idField)
+	externalID := stringValue(rawID)
+	if externalID == "" {
+		st.run.Skipped++
+		return
+	}
+	if st.seen[externalID] {
+		return
+	}
+	st.seen[externalID] = true
+
+	raw, _ := json.Marshal(record)
+	remote := MapFields(record, w.FieldMapping)
+
+	var contact models.Contact
+	// Contacts linked before pulls recorded their webhook are claimed by the
+	// first webhook of their source to return them
+	err := s.db.Where("tenant_id = ? AND external_source = ? AND external_id = ? AND (contact_webhook_id = ? OR contact_webhook_id IS NULL)",
+		w.TenantID, w.Source, externalID, w.ID).
+		Order("contact_webhook_id IS NULL, id").First(&contact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = s.adopt(w, remote, &contact)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		contact = models.Contact{
+			TenantID:         w.TenantID,
+			ExternalID:       externalID,
+			ExternalSource:   w.Source,
+			ExternalData:     string(raw),
+			ContactWebhookID: &w.ID,
+			LastSyncAt:       &st.now,
+			SyncEnabled:      true,
+		}
+		for field, value := range remote {
+			SetContactField(&contact, field, value)
+		}
+		if contact.Status == "" {
+			contact.Status = "active"
+		}
+		if err := s.db.Create(&contact).Error; err != nil {
+			st.fail("%s: create: %v", externalID, err)
+			return
+		}
+		st.run.Created++
+		return
+	}
+	if err != nil {
+		st.fail("%s: lookup: %v", externalID, err)
+		return
+	}
+
+	if !contact.SyncEnabled {
+		st.run.Skipped++
+		return
+	}
+	if contact.ExternalID == externalID && contact.ExternalData == string(raw) && contact.Status != "archived" {
+		s.db.Model(&contact).UpdateColumn("last_sync_at", st.now)
+		st.run.Unchanged++
+		return
+	}
+
+	// What the previous sync wrote is the base for spotting local edits
+	var base map[string]string
+	if contact.ExternalID == externalID && contact.ExternalData != "" {
+		var previous map[string]interface{}
+		if json.Unmarshal([]byte(contact.ExternalData), &previous) == nil {
+			base = MapFields(previous, w.FieldMapping)
+		}
+	}
+	conflict := false
+	for field, value := range remote {
+		local := ContactField(&contact, field)
+		if local == value {
+			continue
+		}
+		edited := local != ""
+		if base != nil {
+			edited = local != base[field]
+		}
+		if edited && (base == nil || value != base[field]) {
+			conflict = true
+		}
+		if edited && w.ConflictPolicy == models.ContactConflictLocal {
+			continue
+		}
+		SetContactField(&contact, field, value)
+	}
+	if conflict {
+		st.run.Conflicts++
+	}
+
+	// Back in the source, so no longer deleted there
+	if contact.Status == "archived" && w.DeletePolicy == models.ContactDeleteArchive {
+		if _, mapped := remote["Status"]; !mapped {
+			contact.Status = "active"
+		}
+	}
+	contact.ExternalID = externalID
+	contact.ExternalSource = w.Source
+	contact.ContactWebhookID = &w.ID
+	contact.ExternalData = string(raw)
+	contact.LastSyncAt = &st.now
+	if err := s.db.Save(&contact).Error; err != nil {
+		st.fail("%s: update: %v", externalID, err)
+		return
+	}
+	st.run.Updated++
+}
+
+// adopt finds a contact not yet linked to any source with the record's
+// email or phone number
+func (s *Syncer) adopt(w *models.ContactWebhook, remote map[string]string, contact *models.Contact) error {
+	var conds []string
+	var args []interface{}
+	if email := remote["Email"]; email != "" {
+		conds = append(conds, "email = ?")
+		args = append(args, email)
+	}
+	for _, field := range []string{"Phone", "MobilePhone"} {
+		if phone := remote[field]; phone != "" {
+			conds = append(conds, "phone = ? OR mobile_phone = ?")
+			args = append(args, phone, phone)
+		}
+	}
+	if len(conds) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.db.Where("tenant_id = ? AND (external_id = '' OR external_id IS NULL)", w.TenantID).
+		Where(strings.Join(conds, " OR "), args...).
+		Order("id").First(contact).Error
+}
+
+// removeMissing archives or deletes contacts from this webhook that the
+// pull did not return. Contacts linked before pulls recorded their webhook
+// are included only while no other webhook of the tenant shares the source.
+func (s *Syncer) removeMissing(st *syncState) error {
+	w := st.webhook
+	var shared int64
+	if err := s.db.Model(&models.ContactWebhook{}).
+		Where("tenant_id = ? AND source = ? AND id <> ?", w.TenantID, w.Source, w.ID).Count(&shared).Error; err != nil {
+		return fmt.Errorf("load webhooks: %w", err)
+	}
+	query := s.db.Model(&models.Contact{}).
+		Where("tenant_id = ? AND external_id <> '' AND sync_enabled = ?", w.TenantID, true)
+	if shared == 0 {
+		query = query.Where("contact_webhook_id = ? OR (contact_webhook_id IS NULL AND external_source = ?)", w.ID, w.Source)
+	} else {
+		query = query.Where("contact_webhook_id = ?", w.ID)
+	}
+	if w.DeletePolicy == models.ContactDeleteArchive {
+		query = query.Where("status <> ?", "archived")
+	}
+	var linked []struct {
+		ID         uint
+		ExternalID string
+	}
+	if err := query.Select("id, external_id").Find(&linked).Error; err != nil {
+		return fmt.Errorf("load linked contacts: %w", err)
+	}
+
+	var missing []uint
+	for _, c := range linked {
+		if !st.seen[c.ExternalID] {
+			missing = append(missing, c.ID)
+		}
+	}
+	for start := 0; start < len(missing); start += deleteBatch {
+		end := start + deleteBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		ids := missing[start:end]
+
+		var result *gorm.DB
+		if w.DeletePolicy == models.ContactDeleteDelete {
+			result = s.db.Where("id IN ?", ids).Delete(&models.Contact{})
+		} else {
+			result = s.db.Model(&models.Contact{}).Where("id IN ?", ids).Update("status", "archived")
+		}
+		if result.Error != nil {
+			return fmt.Errorf("remove missing contacts: %w", result.Error)
+		}
+		st.run.Deleted += int(result.RowsAffected)
+	}
+	return nil
+}
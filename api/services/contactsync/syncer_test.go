@@ -0,0 +1,206 @@
+package contactsync_test
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/contactsync"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// crmServer serves an OAuth2 token endpoint and a cursor-paged contact list
+type crmServer struct {
+	mu       sync.Mutex
+	pages    [][]map[string]interface{}
+	tokens   int
+	reject   bool // Reject the next list request's token
+	lastAuth string
+}
+
+func (s *crmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/oauth/token":
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_id") != "callsign" || r.FormValue("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.tokens++
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-" + string(rune('0'+s.tokens)), "expires_in": 3600})
+	case "/contacts":
+		s.lastAuth = r.Header.Get("Authorization")
+		if s.reject || s.lastAuth != "Bearer token-"+string(rune('0'+s.tokens)) {
+			s.reject = false
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := 0
+		if r.URL.Query().Get("after") == "p2" {
+			page = 1
+		}
+		body := map[string]interface{}{"results": s.pages[page]}
+		if page == 0 && len(s.pages) > 1 {
+			body["paging"] = map[string]interface{}{"next": map[string]interface{}{"after": "p2"}}
+		}
+		json.NewEncoder(w).Encode(body)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func record(id, first, last, email string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "properties": map[string]interface{}{"firstname": first, "lastname": last, "email": email}}
+}
+
+func TestSyncPullsPagesWithOAuth2(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Contact{}, &models.ContactWebhook{}, &models.ContactSyncRun{}))
+	syncer := contactsync.NewSyncer(db, &config.Config{EncryptionKey: "test-key", EncryptionSalt: "test-salt"})
+
+	crm := &crmServer{pages: [][]map[string]interface{}{
+		{record("101", "Ada", "Byron", "ada@example.com"), record("102", "Alan", "Turing", "alan@example.com")},
+		{record("103", "Grace", "Hopper", "grace@example.com")},
+	}}
+	server := httptest.NewServer(crm)
+	defer server.Close()
+
+	sealed, err := syncer.EncryptAuthConfig(&contactsync.AuthConfig{TokenURL: server.URL + "/oauth/token", ClientID: "callsign", ClientSecret: "s3cret"})
+	require.NoError(t, err)
+	webhook := models.ContactWebhook{
+		TenantID: 1, Name: "CRM", Source: "hubspot", ListURL: server.URL + "/contacts",
+		AuthType: "oauth2", AuthConfig: sealed, Pagination: "cursor", PageParam: "after", NextPath: "paging.next.after",
+		FieldMapping:   `{"FirstName": "properties.firstname", "LastName": "properties.lastname", "Email": "properties.email"}`,
+		ConflictPolicy: models.ContactConflictLocal, DeletePolicy: models.ContactDeleteArchive, Enabled: true,
+	}
+	require.NoError(t, db.Create(&webhook).Error)
+
+	// An unlinked contact is adopted by email; a linked one the CRM dropped is archived
+	require.NoError(t, db.Create(&models.Contact{TenantID: 1, FirstName: "Grace", Email: "grace@example.com", Status: "active"}).Error)
+	require.NoError(t, db.Create(&models.Contact{TenantID: 1, FirstName: "Gone", ExternalSource: "hubspot", ExternalID: "99", Status: "active", SyncEnabled: true}).Error)
+
+	run, err := syncer.Sync(&webhook, contactsync.TriggerManual)
+	require.NoError(t, err)
+	assert.Equal(t, models.ContactSyncSuccess, run.Status, run.Error)
+	assert.Equal(t, 2, run.Pages)
+	assert.Equal(t, 3, run.Fetched)
+	assert.Equal(t, 2, run.Created)
+	assert.Equal(t, 1, run.Updated)
+	assert.Equal(t, 1, run.Deleted)
+	assert.Equal(t, 1, crm.tokens)
+
+	var grace models.Contact
+	require.NoError(t, db.Where("email = ?", "grace@example.com").First(&grace).Error)
+	assert.Equal(t, "103", grace.ExternalID)
+	assert.Equal(t, "Hopper", grace.LastName)
+	var gone models.Contact
+	require.NoError(t, db.Where("external_id = ?", "99").First(&gone).Error)
+	assert.Equal(t, "archived", gone.Status)
+
+	require.NoError(t, db.First(&webhook, webhook.ID).Error)
+	assert.Equal(t, models.ContactSyncSuccess, webhook.LastSyncStatus)
+	require.NotNil(t, webhook.LastSyncAt)
+
+	// A local edit survives a remote change to the same field under the
+	// local policy, while the source's other changes still land
+	require.NoError(t, db.Model(&models.Contact{}).Where("external_id = ?", "101").Update("first_name", "Augusta").Error)
+	crm.pages[0][0] = record("101", "Ada Lovelace", "King", "ada@example.com")
+	crm.reject = true
+
+	run, err = syncer.Sync(&webhook, contactsync.TriggerSchedule)
+	require.NoError(t, err)
+	assert.Equal(t, models.ContactSyncSuccess, run.Status, run.Error)
+	assert.Equal(t, 1, run.Updated)
+	assert.Equal(t, 2, run.Unchanged)
+	assert.Equal(t, 1, run.Conflicts)
+	assert.Equal(t, 2, crm.tokens, "a rejected token is renewed once")
+
+	var ada models.Contact
+	require.NoError(t, db.Where("external_id = ?", "101").First(&ada).Error)
+	assert.Equal(t, "Augusta", ada.FirstName)
+	assert.Equal(t, "King", ada.LastName)
+
+	var runs int64
+	db.Model(&models.ContactSyncRun{}).Where("webhook_id = ?", webhook.ID).Count(&runs)
+	assert.Equal(t, int64(2), runs)
+}
+
+func TestSyncKeepsContactsWhenPullFails(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Contact{}, &models.ContactWebhook{}, &models.ContactSyncRun{}))
+	syncer := contactsync.NewSyncer(db, &config.Config{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhook := models.ContactWebhook{TenantID: 1, Name: "CRM", Source: "crm", ListURL: server.URL, DeletePolicy: models.ContactDeleteDelete, Enabled: true}
+	require.NoError(t, db.Create(&webhook).Error)
+	require.NoError(t, db.Create(&models.Contact{TenantID: 1, ExternalSource: "crm", ExternalID: "1", SyncEnabled: true}).Error)
+
+	run, err := syncer.Sync(&webhook, contactsync.TriggerManual)
+	require.NoError(t, err)
+	assert.Equal(t, models.ContactSyncFailed, run.Status)
+	assert.Contains(t, run.Error, "status 500")
+
+	var count int64
+	db.Model(&models.Contact{}).Count(&count)
+	assert.Equal(t, int64(1), count, "a failed pull deletes nothing")
+
+	// Credentials cannot be stored without an encryption key
+	_, err = syncer.EncryptAuthConfig(&contactsync.AuthConfig{Token: "x"})
+	assert.ErrorIs(t, err, contactsync.ErrNoEncryption)
+}
+
+func TestSyncRemovesOnlyItsOwnWebhooksContacts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Contact{}, &models.ContactWebhook{}, &models.ContactSyncRun{}))
+	syncer := contactsync.NewSyncer(db, &config.Config{})
+
+	// Two lists from the same kind of source, e.g. two CRM accounts
+	serve := func(records ...map[string]interface{}) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": records})
+		}))
+	}
+	sales := serve(record("1", "Ada", "Byron", "ada@example.com"))
+	defer sales.Close()
+	support := serve(record("2", "Alan", "Turing", "alan@example.com"))
+	defer support.Close()
+
+	mapping := `{"FirstName": "properties.firstname", "Email": "properties.email"}`
+	salesHook := models.ContactWebhook{TenantID: 1, Name: "Sales", Source: "crm", ListURL: sales.URL, FieldMapping: mapping, DeletePolicy: models.ContactDeleteDelete, Enabled: true}
+	supportHook := models.ContactWebhook{TenantID: 1, Name: "Support", Source: "crm", ListURL: support.URL, FieldMapping: mapping, DeletePolicy: models.ContactDeleteDelete, Enabled: true}
+	require.NoError(t, db.Create(&salesHook).Error)
+	require.NoError(t, db.Create(&supportHook).Error)
+
+	for i := 0; i < 2; i++ {
+		for _, hook := range []*models.ContactWebhook{&salesHook, &supportHook} {
+			run, err := syncer.Sync(hook, contactsync.TriggerManual)
+			require.NoError(t, err)
+			assert.Equal(t, models.ContactSyncSuccess, run.Status, run.Error)
+			assert.Zero(t, run.Deleted, "%s removed another webhook's contacts", hook.Name)
+		}
+	}
+
+	var contacts []models.Contact
+	require.NoError(t, db.Order("external_id").Find(&contacts).Error)
+	require.Len(t, contacts, 2)
+	require.NotNil(t, contacts[0].ContactWebhookID)
+	assert.Equal(t, salesHook.ID, *contacts[0].ContactWebhookID)
+	require.NotNil(t, contacts[1].ContactWebhookID)
+	assert.Equal(t, supportHook.ID, *contacts[1].ContactWebhookID)
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SendCalendarInvite sends an iCalendar invitation: a plain-text summary
+// with the .ics as a text/calendar alternative, which mail clients show as
+// an invite with accept/decline buttons. method is the calendar's METHOD,
+// REQUEST for new and updated meetings or CANCEL.
+func (s *Service) SendCalendarInvite(to, subject, body string, ics []byte, method string) error {
+	if !s.IsEnabled() {
+		return nil
+	}
+	cfg := s.config
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", mime.QEncoding.Encode("utf-8", cfg.FromName)+" <"+cfg.FromAddress+">")
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return fmt.Errorf("create text part: %w", err)
+	}
+	textPart.Write([]byte(body))
+
+	calPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("text/calendar; charset=utf-8; method=%s", method)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="invite.ics"`},
+	})
+	if err != nil {
+		return fmt.Errorf("create calendar part: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(ics)
+	for i := 0; i < len(encoded); i += 76 {
+		calPart.Write([]byte(encoded[i:min(i+76, len(encoded))] + "\r\n"))
+	}
+	writer.Close()
+
+	addr := net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort)
+	var auth smtp.Auth
+	if cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPHost)
+	}
+
+	if err := smtp.SendMail(addr, auth, cfg.FromAddress, []string{to}, buf.Bytes()); err != nil {
+		log.WithError(err).Errorf("Failed to send calendar invite to %s", to)
+		return err
+	}
+
+	log.WithFields(log.Fields{"to": to, "subject": subject, "method": method}).Info("Calendar invite sent")
+	return nil
+}
+
+// SendMeetingReminder sends a plain-text reminder of an upcoming meeting
+func (s *Service) SendMeetingReminder(to, subject, body string) error {
+	if !s.IsEnabled() {
+		return nil
+	}
+	return s.send(to, subject, body)
+}
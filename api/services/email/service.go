@@ -62,8 +62,10 @@ func (s *Service) IsEnabled() bool {
 	return s.config != nil && s.config.Enabled
 }
 
-// SendVoicemailNotification sends a voicemail notification email with .wav attachment
-func (s *Service) SendVoicemailNotification(to, extension, callerID, callerName string, duration int, wavFilePath string) error {
+// SendVoicemailNotification sends a voicemail notification email. The
+// transcript is included in the body when there is one; the .wav is
+// attached unless wavFilePath is empty.
+func (s *Service) SendVoicemailNotification(to, extension, callerID, callerName string, duration int, transcript, wavFilePath string) error {
 	if !s.IsEnabled() {
 		return nil
 	}
@@ -73,11 +75,17 @@ func (s *Service) SendVoicemailNotification(to, extension, callerID, callerName
 	body := fmt.Sprintf(
 		"You have a new voicemail on extension %s.\n\n"+
 			"From: %s (%s)\n"+
-			"Duration: %d seconds\n\n"+
-			"The voicemail recording is attached to this email.\n",
+			"Duration: %d seconds\n\n",
 		extension, callerName, callerID, duration,
 	)
+	if transcript != "" {
+		body += fmt.Sprintf("Transcription:\n%s\n\n", transcript)
+	}
 
+	if wavFilePath == "" {
+		return s.send(to, subject, body)
+	}
+	body += "The voicemail recording is attached to this email.\n"
 	return s.sendWithAttachment(to, subject, body, wavFilePath)
 }
 
@@ -99,6 +107,31 @@ func (s *Service) SendMissedCallNotification(to, ringGroupName, ringGroupExt, ca
 	return s.send(to, subject, body)
 }
 
+// SendFraudAlert warns a tenant admin that international calling crossed a
+// fraud threshold, and whether outbound calling was blocked
+func (s *Service) SendFraudAlert(to, tenantName, reason string, blocked bool) error {
+	if !s.IsEnabled() {
+		return nil
+	}
+
+	subject := fmt.Sprintf("Toll Fraud Alert - %s", tenantName)
+	action := "Outbound calling is still enabled; please review recent international calls."
+	if blocked {
+		subject = fmt.Sprintf("Outbound Calling Blocked - %s", tenantName)
+		action = "Outbound calling has been blocked. Contact your provider to re-enable it once the cause is resolved."
+	}
+
+	body := fmt.Sprintf(
+		"International calling for %s exceeded its fraud threshold.\n\n"+
+			"%s\n\n"+
+			"%s\n"+
+			"If these calls were unexpected, change the SIP passwords of the extensions involved.\n",
+		tenantName, reason, action,
+	)
+
+	return s.send(to, subject, body)
+}
+
 // SendPasswordResetEmail sends a password reset email
 func (s *Service) SendPasswordResetEmail(to, resetToken string) error {
 	if !s.IsEnabled() {
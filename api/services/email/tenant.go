@@ -0,0 +1,39 @@
+package email
+
+import "encoding/json"
+
+// ForTenant returns a service that sends through the tenant's own SMTP
+// server when its settings JSON configures one (the smtp_* keys of the
+// tenant settings page), else the system service, which may be nil.
+func ForTenant(settings string, system *Service) *Service {
+	var smtp struct {
+		SMTPHost      string `json:"smtp_host"`
+		SMTPPort      string `json:"smtp_port"`
+		SMTPUsername  string `json:"smtp_username"`
+		SMTPPassword  string `json:"smtp_password"`
+		SMTPFromEmail string `json:"smtp_from_email"`
+	}
+	if settings == "" || json.Unmarshal([]byte(settings), &smtp) != nil {
+		return system
+	}
+	if smtp.SMTPHost == "" || smtp.SMTPFromEmail == "" {
+		return system
+	}
+
+	cfg := &Config{
+		SMTPHost:    smtp.SMTPHost,
+		SMTPPort:    smtp.SMTPPort,
+		SMTPUser:    smtp.SMTPUsername,
+		SMTPPass:    smtp.SMTPPassword,
+		FromAddress: smtp.SMTPFromEmail,
+		FromName:    "CallSign PBX",
+		Enabled:     true,
+	}
+	if cfg.SMTPPort == "" {
+		cfg.SMTPPort = "587"
+	}
+	if system != nil && system.config != nil && system.config.FromName != "" {
+		cfg.FromName = system.config.FromName
+	}
+	return New(cfg)
+}
@@ -2,7 +2,10 @@ package esl
 
 import (
 	"callsign/config"
+	"callsign/models"
 	"callsign/services/email"
+	"callsign/services/storage"
+	"callsign/services/transcription"
 	"callsign/services/tts"
 	"callsign/services/websocket"
 	"fmt"
@@ -26,6 +29,13 @@ type Manager struct {
 	WSHub     *websocket.Hub
 	TTS       *tts.Service
 	Email     *email.Service
+	Storage   *storage.Manager
+
+	// Speech-to-text worker for voicemail; nil when transcription is off
+	Transcriber *transcription.Worker
+
+	// Event handlers registered by services before the processor exists
+	hooks map[string][]EventHandler
 
 	running bool
 	mu      sync.RWMutex
@@ -52,6 +62,16 @@ func (m *Manager) SetEmailService(svc *email.Service) {
 	m.Email = svc
 }
 
+// SetStorage sets the object storage manager used for recordings and voicemail
+func (m *Manager) SetStorage(sm *storage.Manager) {
+	m.Storage = sm
+}
+
+// SetTranscriber sets the speech-to-text worker used for voicemail transcripts
+func (m *Manager) SetTranscriber(w *transcription.Worker) {
+	m.Transcriber = w
+}
+
 // Start starts the ESL manager
 func (m *Manager) Start() error {
 	m.mu.Lock()
@@ -85,10 +105,12 @@ func (m *Manager) Start() error {
 		"RECORD_STOP",
 		"PLAYBACK_START",
 		"PLAYBACK_STOP",
-		"CUSTOM",
 		"PRESENCE_PROBE",
 		"PRESENCE_IN",
 		"MESSAGE_WAITING",
+		// Everything after CUSTOM is read by FreeSWITCH as a subclass
+		"CUSTOM",
+		"callcenter::info",
 	}
 
 	if err := m.Client.Subscribe(events...); err != nil {
@@ -103,6 +125,11 @@ func (m *Manager) Start() error {
 	for eventName, handler := range handlers {
 		m.Processor.On(eventName, handler)
 	}
+	for eventName, hooks := range m.hooks {
+		for _, handler := range hooks {
+			m.Processor.On(eventName, handler)
+		}
+	}
 
 	// Start processing events
 	m.Client.StartEventLoop()
@@ -124,6 +151,22 @@ func (m *Manager) Start() error {
 	return nil
 }
 
+// On registers an event handler. Handlers registered before Start() are
+// attached once the event processor is created.
+func (m *Manager) On(eventName string, handler EventHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Processor != nil {
+		m.Processor.On(eventName, handler)
+		return
+	}
+	if m.hooks == nil {
+		m.hooks = make(map[string][]EventHandler)
+	}
+	m.hooks[eventName] = append(m.hooks[eventName], handler)
+}
+
 // RegisterModule registers an ESL service module. Call before Start().
 func (m *Manager) RegisterModule(service Service) error {
 	return m.Modules.Register(service)
@@ -373,6 +416,23 @@ func (m *Manager) SendExtensionPresence(extension, domain string, busy bool) {
 	m.SendPresenceEvent(user, "sip", busy)
 }
 
+// SendVoicemailMWI refreshes the MWI lamps a mailbox affects: its own
+// extension and, for a group mailbox, every member. Each lamp counts the
+// extension's own box plus the group boxes it belongs to.
+func (m *Manager) SendVoicemailMWI(box *models.VoicemailBox) {
+	if m.DB == nil {
+		return
+	}
+	var tenant models.Tenant
+	if err := m.DB.Select("id", "domain").First(&tenant, box.TenantID).Error; err != nil {
+		return
+	}
+	for _, ext := range models.VoicemailMWIAccounts(m.DB, box) {
+		newMsgs, savedMsgs := models.VoicemailWaiting(m.DB, box.TenantID, ext)
+		m.SendMWI(ext, tenant.Domain, newMsgs, savedMsgs)
+	}
+}
+
 // SendMWI sends a Message Waiting Indicator event to FreeSWITCH.
 // This causes phones to light their voicemail lamp / show envelope icon.
 func (m *Manager) SendMWI(extension, domain string, newMsgs, savedMsgs int) {
@@ -0,0 +1,161 @@
+// Package broadcast implements the ESL module that runs answered broadcast
+// campaign calls: answering machine detection, message playback, DTMF survey
+// capture and press-to-transfer.
+package broadcast
+
+import (
+	"callsign/models"
+	"callsign/services/esl"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	ServiceName    = "broadcast"
+	ServiceAddress = "127.0.0.8:9001"
+)
+
+// Service implements the broadcast call ESL module
+type Service struct {
+	*esl.BaseService
+	db *gorm.DB
+}
+
+// New creates a new broadcast call service
+func New(db *gorm.DB) *Service {
+	return &Service{
+		BaseService: esl.NewBaseService(ServiceName, ServiceAddress),
+		db:          db,
+	}
+}
+
+// Init initializes the broadcast call service
+func (s *Service) Init(manager *esl.Manager) error {
+	if err := s.BaseService.Init(manager); err != nil {
+		return err
+	}
+	log.Info("Broadcast call service initialized")
+	return nil
+}
+
+// Handle runs an answered broadcast call. The originate sets
+// broadcast_campaign_id and broadcast_recipient_id on the channel.
+func (s *Service) Handle(conn *eventsocket.Connection) {
+	defer conn.Close()
+
+	ev, err := conn.Send("connect")
+	if err != nil {
+		log.Errorf("Broadcast: connect failed: %v", err)
+		return
+	}
+
+	uuid := ev.Get("Unique-ID")
+	campaignID, _ := strconv.ParseUint(ev.Get("variable_broadcast_campaign_id"), 10, 64)
+	recipientID, _ := strconv.ParseUint(ev.Get("variable_broadcast_recipient_id"), 10, 64)
+
+	logger := log.WithFields(log.Fields{
+		"uuid":         uuid,
+		"campaign_id":  campaignID,
+		"recipient_id": recipientID,
+	})
+
+	conn.Send("linger")
+	conn.Send("myevents")
+
+	var campaign models.BroadcastCampaign
+	if err := s.db.First(&campaign, campaignID).Error; err != nil {
+		logger.Warn("Broadcast: campaign not found")
+		conn.Execute("hangup", "NORMAL_CLEARING", false)
+		return
+	}
+	var recipient models.BroadcastRecipient
+	s.db.First(&recipient, recipientID)
+
+	now := time.Now()
+	base := models.BroadcastResult{
+		CampaignID:  campaign.ID,
+		RecipientID: recipient.ID,
+		TenantID:    campaign.TenantID,
+		CallUUID:    uuid,
+		PhoneNumber: recipient.PhoneNumber,
+		Attempt:     recipient.Attempts,
+		AnsweredAt:  &now,
+	}
+	record := func(updates map[string]interface{}) {
+		if err := models.RecordBroadcastResult(s.db, base, updates); err != nil {
+			logger.WithError(err).Warn("Broadcast: failed to record result")
+		}
+	}
+
+	// --- Answering machine detection (mod_amd) ---
+	if campaign.DetectMachine && s.isMachine(conn, logger) {
+		updates := map[string]interface{}{"outcome": models.BroadcastOutcomeMachine}
+		if campaign.VoicemailDropPath != "" {
+			// Wait for the greeting to finish before leaving the message
+			conn.Execute("wait_for_silence", "200 25 3 15000", true)
+			conn.Execute("playback", campaign.VoicemailDropPath, true)
+			updates["voicemail_dropped"] = true
+		}
+		record(updates)
+		conn.Execute("hangup", "NORMAL_CLEARING", false)
+		return
+	}
+	record(map[string]interface{}{"outcome": models.BroadcastOutcomeHuman})
+
+	switch campaign.Type {
+	case models.BroadcastTypeSurvey:
+		maxDigits := max(campaign.SurveyMaxDigits, 1)
+		digits := collectDigits(conn, campaign.RecordingPath, maxDigits)
+		record(map[string]interface{}{"digits": digits})
+		if digits != "" {
+			conn.Execute("playback", "ivr/ivr-thank_you.wav", true)
+		}
+
+	case models.BroadcastTypeTransfer:
+		digits := collectDigits(conn, campaign.RecordingPath, 1)
+		record(map[string]interface{}{"digits": digits})
+		if digits != "" && digits == campaign.TransferDigit && campaign.TransferDestination != "" {
+			var tenant models.Tenant
+			s.db.First(&tenant, campaign.TenantID)
+			record(map[string]interface{}{"transferred": true})
+			logger.Infof("Broadcast: transferring to %s", campaign.TransferDestination)
+			conn.Execute("transfer", fmt.Sprintf("%s XML %s", campaign.TransferDestination, tenant.Domain), true)
+			return
+		}
+
+	default:
+		conn.Execute("playback", campaign.RecordingPath, true)
+	}
+
+	conn.Execute("hangup", "NORMAL_CLEARING", false)
+}
+
+// isMachine runs mod_amd's voice_amd and reports a MACHINE verdict. Detection
+// failures (module not loaded, NOTSURE) are treated as a human.
+func (s *Service) isMachine(conn *eventsocket.Connection, logger *log.Entry) bool {
+	ev, err := conn.Execute("voice_amd", "", true)
+	if err != nil {
+		logger.WithError(err).Warn("Broadcast: answering machine detection failed")
+		return false
+	}
+	result := ev.Get("variable_amd_result")
+	logger.Debugf("Broadcast: AMD result %q", result)
+	return result == "MACHINE"
+}
+
+// collectDigits plays the prompt and returns up to maxDigits keypresses
+func collectDigits(conn *eventsocket.Connection, prompt string, maxDigits int) string {
+	ev, err := conn.Execute("play_and_get_digits", fmt.Sprintf(
+		"1 %d 3 5000 # %s ivr/ivr-that_was_an_invalid_entry.wav broadcast_digits \\d+ 3000",
+		maxDigits, prompt,
+	), true)
+	if err != nil {
+		return ""
+	}
+	return ev.Get("variable_broadcast_digits")
+}
@@ -0,0 +1,257 @@
+package callcontrol
+
+import (
+	"callsign/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ========== Call Handling Rules ==========
+
+// loadCallHandling loads the extension's call handling rules and prepares an
+// evaluator in the tenant's timezone. Failures leave the rule set empty so the
+// call falls back to the extension's default forwarding settings.
+func (s *Service) loadCallHandling(ctx *callContext, ext *models.Extension) {
+	loc := time.UTC
+	var tenant models.Tenant
+	if err := ctx.db.First(&tenant, ext.TenantID).Error; err == nil {
+		loc = tenant.Location()
+	}
+	ctx.evaluator = NewRuleEvaluator(ctx.db, loc)
+
+	rules, err := LoadCallHandlingRules(ctx.db, ext)
+	if err != nil {
+		ctx.logger.WithError(err).Warn("Failed to load call handling rules")
+		return
+	}
+	ctx.rules = rules
+}
+
+// matchCallHandlingRule returns the first rule that fires for the event, if any
+func (s *Service) matchCallHandlingRule(ctx *callContext, event string) *models.CallHandlingRule {
+	if len(ctx.rules) == 0 || ctx.evaluator == nil {
+		return nil
+	}
+
+	decision := ctx.evaluator.Evaluate(ctx.rules, event, CallInfo{
+		CallerID:   ctx.callerID,
+		CallerName: ctx.callerName,
+		Time:       time.Now(),
+	})
+	if decision.Rule != nil {
+		ctx.logger.WithField("rule", decision.Rule.Name).Infof("Call handling rule matched on %s", event)
+	}
+	return decision.Rule
+}
+
+// applyCallHandlingRule evaluates the rules for an event and executes the
+// matched action. Returns true when a rule took over the call.
+func (s *Service) applyCallHandlingRule(ctx *callContext, ext *models.Extension, event string) bool {
+	rule := s.matchCallHandlingRule(ctx, event)
+	if rule == nil {
+		return false
+	}
+	s.executeCallHandlingAction(ctx, ext, rule)
+	return true
+}
+
+// executeCallHandlingAction performs a rule's action on the call
+func (s *Service) executeCallHandlingAction(ctx *callContext, ext *models.Extension, rule *models.CallHandlingRule) {
+	params := rule.ActionParams
+
+	switch rule.ActionType {
+	case models.CallActionForward:
+		if rule.ActionTarget == "" {
+			ctx.logger.Warnf("Rule %q: forward has no target", rule.Name)
+			s.sendToVoicemail(ctx, ext, ext.Extension)
+			return
+		}
+		ctx.logger.Infof("Rule %q: forward to %s", rule.Name, rule.ActionTarget)
+		s.forwardTo(ctx, rule.ActionTarget, params.RingTimeout)
+
+	case models.CallActionVoicemail:
+		box := rule.ActionTarget
+		if box == "" {
+			box = ext.Extension
+		}
+		if params.GreetingID != "" {
+			ctx.conn.Execute("set", fmt.Sprintf("voicemail_greeting_number=%s", params.GreetingID), true)
+		}
+		ctx.logger.Infof("Rule %q: voicemail %s", rule.Name, box)
+		ctx.conn.Execute("answer", "", true)
+		ctx.conn.Execute("voicemail", fmt.Sprintf("default %s %s", ctx.domain, box), true)
+
+	case models.CallActionFindMe:
+		ctx.logger.Infof("Rule %q: find-me (%s)", rule.Name, params.FindMeMode)
+		if !s.ringFindMe(ctx, rule) {
+			s.sendToVoicemail(ctx, ext, ext.Extension)
+		}
+
+	case models.CallActionReject:
+		ctx.logger.Infof("Rule %q: reject (%s)", rule.Name, params.RejectReason)
+		ctx.conn.Execute("respond", rejectResponse(params.RejectReason), false)
+
+	case models.CallActionRingDevices:
+		devices := params.RingDevices
+		dialString := s.deviceDialString(ctx, ext, devices.Softphone, devices.DeskPhone, devices.Mobile)
+		if dialString == "" {
+			ctx.logger.Warnf("Rule %q: no matching devices registered", rule.Name)
+			s.sendToVoicemail(ctx, ext, ext.Extension)
+			return
+		}
+		timeout := params.RingTimeout
+		if timeout <= 0 {
+			timeout = ext.CallTimeout
+		}
+		ctx.conn.Execute("set", fmt.Sprintf("call_timeout=%d", timeout), true)
+		ctx.conn.Execute("set", "continue_on_fail=true", true)
+		ctx.conn.Execute("bridge", dialString, true)
+		if cause := s.getBridgeResult(ctx); cause != "" && cause != "SUCCESS" {
+			s.sendToVoicemail(ctx, ext, ext.Extension)
+		}
+
+	default:
+		ctx.logger.Warnf("Rule %q: unknown action %q", rule.Name, rule.ActionType)
+		ctx.conn.Execute("respond", "480 Temporarily Unavailable", false)
+	}
+}
+
+// forwardTo bridges to an internal extension (following its forward chain) or
+// to an external number via loopback.
+func (s *Service) forwardTo(ctx *callContext, dest string, timeout int) {
+	var count int64
+	ctx.db.Table("extensions").
+		Joins("JOIN tenants ON tenants.id = extensions.tenant_id").
+		Where("tenants.domain = ? AND extensions.extension = ? AND extensions.deleted_at IS NULL", ctx.domain, dest).
+		Count(&count)
+
+	if count > 0 {
+		s.resolveAndBridge(ctx, dest, 1)
+		return
+	}
+
+	if timeout <= 0 {
+		timeout = 30
+	}
+	ctx.conn.Execute("set", fmt.Sprintf("call_timeout=%d", timeout), true)
+	ctx.conn.Execute("bridge", fmt.Sprintf("loopback/%s/%s", dest, ctx.domain), true)
+}
+
+// ringFindMe rings the rule's find-me numbers simultaneously or in sequence
+func (s *Service) ringFindMe(ctx *callContext, rule *models.CallHandlingRule) bool {
+	params := rule.ActionParams
+	numbers := params.FindMeNumbers
+	if rule.ActionTarget != "" {
+		numbers = append([]string{rule.ActionTarget}, numbers...)
+	}
+
+	var dests []models.RingGroupDestination
+	for i, n := range numbers {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		d := models.RingGroupDestination{
+			DestinationType: "external",
+			Destination:     n,
+			Timeout:         params.RingTimeout,
+			Priority:        i,
+		}
+		if i > 0 && params.FindMeMode == "sequential" {
+			d.Delay = params.FindMeDelay
+		}
+		var count int64
+		ctx.db.Table("extensions").
+			Joins("JOIN tenants ON tenants.id = extensions.tenant_id").
+			Where("tenants.domain = ? AND extensions.extension = ? AND extensions.deleted_at IS NULL", ctx.domain, n).
+			Count(&count)
+		if count > 0 {
+			d.DestinationType = "extension"
+		}
+		dests = append(dests, d)
+	}
+	if len(dests) == 0 {
+		return false
+	}
+
+	ctx.conn.Execute("set", "hangup_after_bridge=true", true)
+	ctx.conn.Execute("set", "continue_on_fail=true", true)
+	if params.FindMeMode == "sequential" {
+		return s.ringSequence(ctx, dests, params.RingTimeout)
+	}
+	return s.ringSimultaneous(ctx, dests, params.RingTimeout)
+}
+
+// deviceDialString builds a dial string for the extension's registered
+// endpoints of the selected device classes. Returns "" when none are selected
+// or none are provisioned, so callers can fall back to user/<ext>@<domain>.
+func (s *Service) deviceDialString(ctx *callContext, ext *models.Extension, softphone, deskPhone, mobile bool) string {
+	var types []models.EndpointType
+	if softphone {
+		types = append(types, models.EndpointTypeWebClient, models.EndpointTypeDesktopApp)
+	}
+	if deskPhone {
+		types = append(types, models.EndpointTypeDevice)
+	}
+	if mobile {
+		types = append(types, models.EndpointTypeMobileApp)
+	}
+	if len(types) == 0 {
+		return ""
+	}
+
+	var regs []models.ClientRegistration
+	ctx.db.Where("extension_id = ? AND enabled = ? AND endpoint_type IN ?", ext.ID, true, types).
+		Order("id ASC").
+		Find(&regs)
+
+	var legs []string
+	for _, reg := range regs {
+		legs = append(legs, fmt.Sprintf("user/%s@%s", reg.RegistrationUser, ctx.domain))
+	}
+	return strings.Join(legs, ",")
+}
+
+// sequentialDialString converts a simultaneous dial string into one that rings
+// each endpoint in turn. The bare user/<ext>@<domain> target is expanded to
+// the extension's registrations first; it is kept when none are provisioned.
+func (s *Service) sequentialDialString(ctx *callContext, ext *models.Extension, dialString string) string {
+	if dialString == fmt.Sprintf("user/%s@%s", ext.Extension, ctx.domain) {
+		if ds := s.deviceDialString(ctx, ext, true, true, true); ds != "" {
+			dialString = ds
+		}
+	}
+	return strings.ReplaceAll(dialString, ",", "|")
+}
+
+// routePermitted reports whether an extension's profile permissions allow
+// dialing out over the route
+func routePermitted(perms models.ExtensionPermissions, route *models.DefaultOutboundRoute) bool {
+	if !perms.Outbound {
+		return false
+	}
+	return perms.International || !route.IsInternational()
+}
+
+// sendToVoicemail answers and drops the caller into voicemail when enabled
+func (s *Service) sendToVoicemail(ctx *callContext, ext *models.Extension, box string) {
+	if !ext.VoicemailEnabled {
+		ctx.conn.Execute("respond", "480 Temporarily Unavailable", false)
+		return
+	}
+	ctx.conn.Execute("answer", "", true)
+	ctx.conn.Execute("voicemail", fmt.Sprintf("default %s %s", ctx.domain, box), true)
+}
+
+// rejectResponse maps a rule's reject reason to a SIP response
+func rejectResponse(reason string) string {
+	switch reason {
+	case "busy":
+		return "486 Busy Here"
+	case "declined":
+		return "603 Decline"
+	default:
+		return "480 Temporarily Unavailable"
+	}
+}
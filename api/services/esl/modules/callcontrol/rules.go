@@ -0,0 +1,465 @@
+package callcontrol
+
+import (
+	"callsign/models"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Call handling trigger events, matching the CallHandlingEvents flags
+const (
+	EventAnyCall     = "any_call"
+	EventOnPhone     = "on_phone"
+	EventNoAnswer    = "no_answer"
+	EventUnavailable = "unavailable"
+)
+
+// AllCallHandlingEvents lists every trigger in the order they are reached
+// during a call: before ringing, then after the bridge attempt fails.
+var AllCallHandlingEvents = []string{EventAnyCall, EventUnavailable, EventOnPhone, EventNoAnswer}
+
+// CallInfo describes the call a rule set is evaluated against
+type CallInfo struct {
+	CallerID   string    `json:"caller_id"`
+	CallerName string    `json:"caller_name"`
+	Time       time.Time `json:"time"`
+}
+
+// RuleTrace records why a single rule did or did not match
+type RuleTrace struct {
+	RuleID   uint   `json:"rule_id"`
+	Name     string `json:"name"`
+	Source   string `json:"source"` // extension, profile
+	Priority int    `json:"priority"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason"`
+}
+
+// RuleDecision is the outcome of evaluating a rule set for one trigger event.
+// Rule is nil when nothing matched and default extension handling applies.
+type RuleDecision struct {
+	Event string                   `json:"event"`
+	Rule  *models.CallHandlingRule `json:"rule"`
+	Trace []RuleTrace              `json:"trace"`
+}
+
+// RuleEvaluator decides which CallHandlingRule applies to a call. It is shared
+// by the live call path and the API dry-run endpoint so both give the same answer.
+type RuleEvaluator struct {
+	DB       *gorm.DB
+	Location *time.Location
+
+	holidays map[uint]*models.HolidayList
+}
+
+// NewRuleEvaluator creates an evaluator that interprets time-based conditions
+// in the given location (normally the tenant's timezone).
+func NewRuleEvaluator(db *gorm.DB, loc *time.Location) *RuleEvaluator {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &RuleEvaluator{
+		DB:       db,
+		Location: loc,
+		holidays: make(map[uint]*models.HolidayList),
+	}
+}
+
+// LoadCallHandlingRules returns the extension's own rules merged with the rules
+// of its extension profile, ordered by priority. On equal priority the
+// extension's rule wins over the profile default.
+func LoadCallHandlingRules(db *gorm.DB, ext *models.Extension) ([]models.CallHandlingRule, error) {
+	query := db.Where("tenant_id = ?", ext.TenantID)
+	if ext.ProfileID != nil {
+		query = query.Where("extension_id = ? OR profile_id = ?", ext.ID, *ext.ProfileID)
+	} else {
+		query = query.Where("extension_id = ?", ext.ID)
+	}
+
+	var rules []models.CallHandlingRule
+	if err := query.Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].ExtensionID != nil && rules[j].ExtensionID == nil
+	})
+	return rules, nil
+}
+
+// Evaluate walks the rules in order and returns the first one whose trigger
+// matches the event and whose conditions all hold for the call.
+func (e *RuleEvaluator) Evaluate(rules []models.CallHandlingRule, event string, call CallInfo) RuleDecision {
+	decision := RuleDecision{Event: event, Trace: []RuleTrace{}}
+	now := call.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	call.Time = now.In(e.Location)
+
+	for i := range rules {
+		rule := &rules[i]
+		trace := RuleTrace{
+			RuleID:   rule.ID,
+			Name:     rule.Name,
+			Source:   "profile",
+			Priority: rule.Priority,
+		}
+		if rule.ExtensionID != nil {
+			trace.Source = "extension"
+		}
+
+		switch {
+		case decision.Rule != nil:
+			trace.Reason = "not evaluated: an earlier rule matched"
+		case !rule.Enabled:
+			trace.Reason = "rule disabled"
+		case rule.ActionType == "":
+			trace.Reason = "rule has no action"
+		case !ruleHandlesEvent(rule, event):
+			trace.Reason = fmt.Sprintf("not triggered by %s", event)
+		default:
+			ok, reason := e.matchConditions(rule, call)
+			trace.Matched = ok
+			trace.Reason = reason
+			if ok {
+				decision.Rule = rule
+			}
+		}
+
+		decision.Trace = append(decision.Trace, trace)
+	}
+
+	return decision
+}
+
+// ruleHandlesEvent reports whether the rule's trigger flags include the event
+func ruleHandlesEvent(rule *models.CallHandlingRule, event string) bool {
+	switch event {
+	case EventAnyCall:
+		return rule.Events.AnyCall
+	case EventOnPhone:
+		return rule.Events.OnPhone
+	case EventNoAnswer:
+		return rule.Events.NoAnswer
+	case EventUnavailable:
+		return rule.Events.Unavailable
+	}
+	return false
+}
+
+// matchConditions checks every condition on the rule (logical AND)
+func (e *RuleEvaluator) matchConditions(rule *models.CallHandlingRule, call CallInfo) (bool, string) {
+	if len(rule.Conditions) == 0 {
+		return true, "matched (no conditions)"
+	}
+	for _, cond := range rule.Conditions {
+		ok, err := e.matchCondition(rule.TenantID, cond, call)
+		if err != nil {
+			return false, fmt.Sprintf("condition %s: %v", cond.Type, err)
+		}
+		if !ok {
+			return false, fmt.Sprintf("condition %s %s %v did not match", cond.Type, cond.Op, cond.Value)
+		}
+	}
+	return true, "matched all conditions"
+}
+
+// matchCondition evaluates a single condition. Negated operators (not_equals,
+// not_in, not_between, not_contains) invert the result of their positive form.
+func (e *RuleEvaluator) matchCondition(tenantID uint, cond models.CallHandlingCondition, call CallInfo) (bool, error) {
+	op, negate := positiveOp(cond.Op)
+	values := conditionValues(cond.Value, op != "regex")
+	if len(values) == 0 {
+		return false, fmt.Errorf("no value")
+	}
+
+	var ok bool
+	var err error
+	switch cond.Type {
+	case "caller_id":
+		ok, err = matchString(op, normalizeNumber(call.CallerID), values, normalizeNumber)
+	case "caller_name":
+		ok, err = matchString(op, strings.ToLower(call.CallerName), values, strings.ToLower)
+	case "time_of_day":
+		ok, err = matchTimeOfDay(call.Time, values)
+	case "day_of_week":
+		ok, err = matchDayOfWeek(call.Time, values)
+	case "date_range":
+		ok, err = matchDateRange(call.Time, values)
+	case "holiday_list":
+		ok, err = e.matchHolidayList(tenantID, call.Time, values)
+	default:
+		return false, fmt.Errorf("unsupported condition type %q", cond.Type)
+	}
+	if err != nil {
+		return false, err
+	}
+	return ok != negate, nil
+}
+
+// positiveOp maps a negated operator onto its positive form
+func positiveOp(op string) (string, bool) {
+	switch op {
+	case "not_equals":
+		return "equals", true
+	case "not_in":
+		return "in", true
+	case "not_between":
+		return "between", true
+	case "not_contains":
+		return "contains", true
+	case "":
+		return "equals", false
+	}
+	return op, false
+}
+
+// conditionValues flattens a JSON condition value (string, number, array or
+// {start, end} object) into a list of strings. Comma-separated strings are
+// split unless split is false (regex patterns may contain commas).
+func conditionValues(v any, split bool) []string {
+	var out []string
+	switch val := v.(type) {
+	case nil:
+	case string:
+		if split {
+			for _, part := range strings.Split(val, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					out = append(out, part)
+				}
+			}
+		} else if val != "" {
+			out = append(out, val)
+		}
+	case float64:
+		out = append(out, strconv.FormatFloat(val, 'f', -1, 64))
+	case int:
+		out = append(out, strconv.Itoa(val))
+	case uint:
+		out = append(out, strconv.FormatUint(uint64(val), 10))
+	case []string:
+		for _, item := range val {
+			out = append(out, conditionValues(item, split)...)
+		}
+	case []any:
+		for _, item := range val {
+			out = append(out, conditionValues(item, split)...)
+		}
+	case map[string]any:
+		out = append(out, conditionValues(val["start"], split)...)
+		out = append(out, conditionValues(val["end"], split)...)
+	default:
+		out = append(out, fmt.Sprint(val))
+	}
+	return out
+}
+
+// matchString applies a string operator against any of the values
+func matchString(op, actual string, values []string, normalize func(string) string) (bool, error) {
+	for _, raw := range values {
+		v := normalize(raw)
+		switch op {
+		case "equals", "in":
+			if actual == v {
+				return true, nil
+			}
+		case "contains":
+			if strings.Contains(actual, v) {
+				return true, nil
+			}
+		case "starts_with":
+			if strings.HasPrefix(actual, v) {
+				return true, nil
+			}
+		case "ends_with":
+			if strings.HasSuffix(actual, v) {
+				return true, nil
+			}
+		case "regex":
+			re, err := regexp.Compile(raw)
+			if err != nil {
+				return false, fmt.Errorf("invalid regex: %w", err)
+			}
+			if re.MatchString(actual) {
+				return true, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported operator %q", op)
+		}
+	}
+	return false, nil
+}
+
+// normalizeNumber strips formatting characters from a phone number
+func normalizeNumber(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return strings.TrimSpace(s)
+	}
+	return b.String()
+}
+
+// matchTimeOfDay checks whether t falls within any HH:MM-HH:MM window.
+// Windows whose end is before their start wrap past midnight.
+func matchTimeOfDay(t time.Time, values []string) (bool, error) {
+	var windows []string
+	for _, v := range values {
+		windows = append(windows, strings.Split(v, "-")...)
+	}
+	if len(windows)%2 != 0 {
+		return false, fmt.Errorf("time_of_day expects start/end pairs")
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for i := 0; i < len(windows); i += 2 {
+		start, err := parseClock(windows[i])
+		if err != nil {
+			return false, err
+		}
+		end, err := parseClock(windows[i+1])
+		if err != nil {
+			return false, err
+		}
+		if start <= end {
+			if minute >= start && minute < end {
+				return true, nil
+			}
+		} else if minute >= start || minute < end {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWeekday accepts 0-6 (0=Sunday, as in TimeCondition) or day names
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 6 {
+		return time.Weekday(n), nil
+	}
+	if len(s) >= 3 {
+		if d, ok := weekdayNames[s[:3]]; ok {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", s)
+}
+
+// matchDayOfWeek checks whether t falls on any listed day. Ranges such as
+// "mon-fri" or "1-5" are expanded and may wrap past Saturday.
+func matchDayOfWeek(t time.Time, values []string) (bool, error) {
+	for _, v := range values {
+		if from, to, isRange := strings.Cut(v, "-"); isRange {
+			start, err := parseWeekday(from)
+			if err != nil {
+				return false, err
+			}
+			end, err := parseWeekday(to)
+			if err != nil {
+				return false, err
+			}
+			for d := start; ; d = (d + 1) % 7 {
+				if d == t.Weekday() {
+					return true, nil
+				}
+				if d == end {
+					break
+				}
+			}
+			continue
+		}
+		d, err := parseWeekday(v)
+		if err != nil {
+			return false, err
+		}
+		if d == t.Weekday() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchDateRange checks whether t's calendar date is within an inclusive
+// YYYY-MM-DD start/end pair, or equal to a single listed date.
+func matchDateRange(t time.Time, values []string) (bool, error) {
+	day := t.Format("2006-01-02")
+	for _, v := range values {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return false, fmt.Errorf("invalid date %q", v)
+		}
+	}
+	if len(values) == 1 {
+		return day == values[0], nil
+	}
+	if len(values) != 2 {
+		return false, fmt.Errorf("date_range expects a start and end date")
+	}
+	// ISO dates compare correctly as strings
+	return day >= values[0] && day <= values[1], nil
+}
+
+// matchHolidayList checks whether t falls on a date in any listed holiday list
+func (e *RuleEvaluator) matchHolidayList(tenantID uint, t time.Time, values []string) (bool, error) {
+	for _, v := range values {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid holiday list id %q", v)
+		}
+		list, err := e.holidayList(tenantID, uint(id))
+		if err != nil {
+			return false, err
+		}
+		if !list.Enabled {
+			continue
+		}
+		if _, ok := list.HolidayOn(t); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// holidayList loads and caches a tenant's holiday list for the evaluation
+func (e *RuleEvaluator) holidayList(tenantID, id uint) (*models.HolidayList, error) {
+	if list, ok := e.holidays[id]; ok {
+		return list, nil
+	}
+	if e.DB == nil {
+		return nil, fmt.Errorf("holiday list %d unavailable", id)
+	}
+	var list models.HolidayList
+	if err := e.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&list).Error; err != nil {
+		return nil, fmt.Errorf("holiday list %d not found", id)
+	}
+	e.holidays[id] = &list
+	return &list, nil
+}
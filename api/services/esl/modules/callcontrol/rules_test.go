@@ -0,0 +1,117 @@
+package callcontrol_test
+
+import (
+	"callsign/models"
+	"callsign/services/esl/modules/callcontrol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rule(id uint, priority int, events models.CallHandlingEvents, conds ...models.CallHandlingCondition) models.CallHandlingRule {
+	extID := uint(1)
+	return models.CallHandlingRule{
+		ID:          id,
+		Name:        "rule",
+		ExtensionID: &extID,
+		Priority:    priority,
+		Enabled:     true,
+		Events:      events,
+		Conditions:  conds,
+		ActionType:  models.CallActionForward,
+	}
+}
+
+func TestEvaluateFirstMatchWins(t *testing.T) {
+	ev := callcontrol.NewRuleEvaluator(nil, time.UTC)
+	rules := []models.CallHandlingRule{
+		rule(1, 10, models.CallHandlingEvents{NoAnswer: true}),
+		rule(2, 20, models.CallHandlingEvents{AnyCall: true}),
+		rule(3, 30, models.CallHandlingEvents{AnyCall: true}),
+	}
+
+	d := ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{CallerID: "1001"})
+	assert.NotNil(t, d.Rule)
+	assert.Equal(t, uint(2), d.Rule.ID)
+	assert.Len(t, d.Trace, 3)
+	assert.False(t, d.Trace[0].Matched)
+	assert.True(t, d.Trace[1].Matched)
+
+	d = ev.Evaluate(rules, callcontrol.EventOnPhone, callcontrol.CallInfo{})
+	assert.Nil(t, d.Rule)
+}
+
+func TestEvaluateCallerIDConditions(t *testing.T) {
+	ev := callcontrol.NewRuleEvaluator(nil, time.UTC)
+	rules := []models.CallHandlingRule{
+		rule(1, 10, models.CallHandlingEvents{AnyCall: true},
+			models.CallHandlingCondition{Type: "caller_id", Op: "in", Value: []any{"+1 (555) 123-4567", "1002"}}),
+	}
+
+	d := ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{CallerID: "+15551234567"})
+	assert.NotNil(t, d.Rule)
+
+	d = ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{CallerID: "1003"})
+	assert.Nil(t, d.Rule)
+
+	rules[0].Conditions[0].Op = "not_in"
+	d = ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{CallerID: "1003"})
+	assert.NotNil(t, d.Rule)
+}
+
+func TestEvaluateTimeConditions(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	ev := callcontrol.NewRuleEvaluator(nil, loc)
+	afterHours := rule(1, 10, models.CallHandlingEvents{AnyCall: true},
+		models.CallHandlingCondition{Type: "time_of_day", Op: "between", Value: "18:00-08:00"},
+		models.CallHandlingCondition{Type: "day_of_week", Op: "in", Value: "mon-fri"},
+	)
+	rules := []models.CallHandlingRule{afterHours}
+
+	// Tuesday 23:30 UTC is 19:30 in New York (EDT)
+	evening := time.Date(2026, 10, 13, 23, 30, 0, 0, time.UTC)
+	assert.NotNil(t, ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: evening}).Rule)
+
+	// Tuesday 14:00 New York is business hours
+	midday := time.Date(2026, 10, 13, 18, 0, 0, 0, time.UTC)
+	assert.Nil(t, ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: midday}).Rule)
+
+	// Saturday evening is excluded by the weekday condition
+	saturday := time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)
+	assert.Nil(t, ev.Evaluate(rules, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: saturday}).Rule)
+
+	// Split shifts list several windows
+	shifts := []models.CallHandlingRule{rule(3, 10, models.CallHandlingEvents{AnyCall: true},
+		models.CallHandlingCondition{Type: "time_of_day", Op: "between", Value: "09:00-12:00,13:00-17:00"},
+	)}
+	morning := time.Date(2026, 10, 13, 10, 0, 0, 0, loc)
+	assert.NotNil(t, ev.Evaluate(shifts, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: morning}).Rule)
+	afternoon := time.Date(2026, 10, 13, 16, 30, 0, 0, loc)
+	assert.NotNil(t, ev.Evaluate(shifts, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: afternoon}).Rule)
+	lunch := time.Date(2026, 10, 13, 12, 30, 0, 0, loc)
+	assert.Nil(t, ev.Evaluate(shifts, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: lunch}).Rule)
+
+	vacation := []models.CallHandlingRule{rule(2, 10, models.CallHandlingEvents{AnyCall: true},
+		models.CallHandlingCondition{Type: "date_range", Op: "between", Value: map[string]any{"start": "2026-12-20", "end": "2027-01-02"}},
+	)}
+	newYear := time.Date(2027, 1, 2, 12, 0, 0, 0, loc)
+	assert.NotNil(t, ev.Evaluate(vacation, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: newYear}).Rule)
+	assert.Nil(t, ev.Evaluate(vacation, callcontrol.EventAnyCall, callcontrol.CallInfo{Time: newYear.AddDate(0, 0, 1)}).Rule)
+}
+
+func TestEvaluateSkipsDisabledAndInvalid(t *testing.T) {
+	ev := callcontrol.NewRuleEvaluator(nil, time.UTC)
+	disabled := rule(1, 10, models.CallHandlingEvents{AnyCall: true})
+	disabled.Enabled = false
+	badRegex := rule(2, 20, models.CallHandlingEvents{AnyCall: true},
+		models.CallHandlingCondition{Type: "caller_id", Op: "regex", Value: "("})
+
+	d := ev.Evaluate([]models.CallHandlingRule{disabled, badRegex}, callcontrol.EventAnyCall, callcontrol.CallInfo{CallerID: "1001"})
+	assert.Nil(t, d.Rule)
+	assert.Equal(t, "rule disabled", d.Trace[0].Reason)
+	assert.Contains(t, d.Trace[1].Reason, "invalid regex")
+}
@@ -5,6 +5,7 @@ import (
 	"callsign/services/esl"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 
 	"github.com/fiorix/go-eventsocket/eventsocket"
@@ -51,6 +52,10 @@ type callContext struct {
 	domain     string
 	tenantID   uint
 	logger     *log.Entry
+
+	// Call handling rules for the dialed extension (loaded per call)
+	rules     []models.CallHandlingRule
+	evaluator *RuleEvaluator
 }
 
 // Handle processes incoming call control connections
@@ -122,7 +127,10 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 // ========== Extension Call Routing ==========
 
 // handleExtensionCall routes a call to an internal extension with DND,
-// forwarding, and voicemail fallback.
+// forwarding, and voicemail fallback. Call handling rules are evaluated
+// before ringing (any_call, unavailable) and after the bridge fails
+// (on_phone, no_answer, unavailable); a matching rule overrides the
+// extension's built-in forwarding for that event.
 func (s *Service) handleExtensionCall(ctx *callContext) {
 	var ext models.Extension
 	err := ctx.db.
@@ -137,8 +145,13 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 		return
 	}
 
+	s.loadCallHandling(ctx, &ext)
+
 	// --- DND ---
 	if ext.DoNotDisturb {
+		if s.applyCallHandlingRule(ctx, &ext, EventUnavailable) {
+			return
+		}
 		ctx.logger.Info("DND active, routing to voicemail")
 		if ext.VoicemailEnabled {
 			ctx.conn.Execute("answer", "", true)
@@ -149,6 +162,35 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 		return
 	}
 
+	// --- Extension profile overrides ---
+	// The profile may restrict ringing to device classes and override the
+	// ring strategy; ring_devices rules below take precedence.
+	dialString := fmt.Sprintf("user/%s@%s", ctx.dest, ctx.domain)
+	profile := models.LoadExtensionProfile(ctx.db, &ext)
+	if profile != nil && profile.CallHandling.OverrideDevices {
+		devices := profile.CallHandling.Devices
+		if ds := s.deviceDialString(ctx, &ext, devices.Softphone, devices.DeskPhone, devices.Mobile); ds != "" {
+			dialString = ds
+		}
+	}
+
+	// --- Rules evaluated on every call ---
+	// ring_devices narrows which endpoints ring; any other action takes over.
+	callTimeout := ext.CallTimeout
+	if rule := s.matchCallHandlingRule(ctx, EventAnyCall); rule != nil {
+		if rule.ActionType != models.CallActionRingDevices {
+			s.executeCallHandlingAction(ctx, &ext, rule)
+			return
+		}
+		devices := rule.ActionParams.RingDevices
+		if ds := s.deviceDialString(ctx, &ext, devices.Softphone, devices.DeskPhone, devices.Mobile); ds != "" {
+			dialString = ds
+		}
+		if rule.ActionParams.RingTimeout > 0 {
+			callTimeout = rule.ActionParams.RingTimeout
+		}
+	}
+
 	// --- Unconditional forwarding ---
 	if ext.ForwardAllEnabled && ext.ForwardAllDestination != "" {
 		ctx.logger.Infof("Forward all to %s", ext.ForwardAllDestination)
@@ -164,7 +206,10 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 	}
 
 	// --- Ring extension with fallback ---
-	ctx.conn.Execute("set", fmt.Sprintf("call_timeout=%d", ext.CallTimeout), true)
+	if profile.RingStrategy(ext.RingStrategy) == "sequential" {
+		dialString = s.sequentialDialString(ctx, &ext, dialString)
+	}
+	ctx.conn.Execute("set", fmt.Sprintf("call_timeout=%d", callTimeout), true)
 	ctx.conn.Execute("set", "hangup_after_bridge=true", true)
 	ctx.conn.Execute("set", "continue_on_fail=true", true)
 	ctx.conn.Execute("set", "ringback=${us-ring}", true)
@@ -172,7 +217,6 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 	// Set diversion header for call routing visibility
 	ctx.conn.Execute("set", fmt.Sprintf("sip_h_Diversion=<sip:%s@%s>", ctx.dest, ctx.domain), true)
 
-	dialString := fmt.Sprintf("user/%s@%s", ctx.dest, ctx.domain)
 	ctx.conn.Execute("bridge", dialString, true)
 
 	// Check bridge result
@@ -180,6 +224,9 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 
 	switch cause {
 	case "USER_BUSY":
+		if s.applyCallHandlingRule(ctx, &ext, EventOnPhone) {
+			return
+		}
 		if ext.ForwardBusyEnabled && ext.ForwardBusyDestination != "" {
 			ctx.logger.Infof("Busy forward to %s", ext.ForwardBusyDestination)
 			s.resolveAndBridge(ctx, ext.ForwardBusyDestination, 1)
@@ -191,6 +238,9 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 		}
 
 	case "NO_ANSWER", "ALLOTTED_TIMEOUT", "NO_USER_RESPONSE":
+		if s.applyCallHandlingRule(ctx, &ext, EventNoAnswer) {
+			return
+		}
 		if ext.ForwardNoAnswerEnabled && ext.ForwardNoAnswerDestination != "" {
 			ctx.logger.Infof("No-answer forward to %s", ext.ForwardNoAnswerDestination)
 			s.resolveAndBridge(ctx, ext.ForwardNoAnswerDestination, 1)
@@ -202,6 +252,9 @@ func (s *Service) handleExtensionCall(ctx *callContext) {
 		}
 
 	case "USER_NOT_REGISTERED":
+		if s.applyCallHandlingRule(ctx, &ext, EventUnavailable) {
+			return
+		}
 		if ext.ForwardUserNotRegisteredEnabled && ext.ForwardUserNotRegisteredDestination != "" {
 			ctx.logger.Infof("Not registered forward to %s", ext.ForwardUserNotRegisteredDestination)
 			s.resolveAndBridge(ctx, ext.ForwardUserNotRegisteredDestination, 1)
@@ -616,6 +669,16 @@ func (s *Service) handleOutboundCall(ctx *callContext) {
 		Where("tenants.domain = ? AND extensions.extension = ?", ctx.domain, ctx.callerID).
 		First(&callerExt).Error == nil
 
+	perms := models.UnrestrictedPermissions
+	if callerFound {
+		perms = models.ExtensionPermissionsFor(ctx.db, &callerExt)
+	}
+
+	// --- Toll-fraud block and concurrent call limits ---
+	if !s.admitOutboundCall(ctx, &callerExt, callerFound) {
+		return
+	}
+
 	var routes []models.DefaultOutboundRoute
 	ctx.db.Where("enabled = ?", true).Order("\"order\" ASC").Find(&routes)
 
@@ -627,6 +690,14 @@ func (s *Service) handleOutboundCall(ctx *callContext) {
 			continue
 		}
 
+		// Extension profile class of service
+		if !routePermitted(perms, &route) {
+			ctx.logger.Infof("Outbound denied by extension profile: caller %s route %s",
+				ctx.callerID, route.Name)
+			ctx.conn.Execute("respond", "403 Forbidden", false)
+			return
+		}
+
 		// Check toll-allow: if the caller has toll restrictions,
 		// verify their allowed classes include this route's class
 		if callerFound && callerExt.TollAllow != "" && route.TollAllow != "" {
@@ -659,19 +730,25 @@ func (s *Service) handleOutboundCall(ctx *callContext) {
 		}).Info("Outbound route matched")
 
 		ctx.conn.Execute("set", "hangup_after_bridge=true", true)
-		bridgeStr := fmt.Sprintf("sofia/gateway/%s/%s", gw.GatewayName, dialDest)
-		ctx.conn.Execute("bridge", bridgeStr, true)
+		bridged := s.bridgeGateway(ctx, &gw, dialDest)
 
 		// Failover gateway
 		if route.Gateway2ID != nil {
-			cause := s.getBridgeResult(ctx)
+			cause := "NORMAL_CIRCUIT_CONGESTION"
+			if bridged {
+				cause = s.getBridgeResult(ctx)
+			}
 			if cause != "" && cause != "SUCCESS" {
 				var gw2 models.Gateway
 				if err := ctx.db.Where("id = ? AND enabled = ?", *route.Gateway2ID, true).First(&gw2).Error; err == nil {
-					ctx.conn.Execute("bridge", fmt.Sprintf("sofia/gateway/%s/%s", gw2.GatewayName, dialDest), true)
+					bridged = s.bridgeGateway(ctx, &gw2, dialDest) || bridged
 				}
 			}
 		}
+		if !bridged {
+			ctx.logger.Warnf("Outbound gateways at channel limit for route %s", route.Name)
+			ctx.conn.Execute("respond", "503 Service Unavailable", false)
+		}
 
 		return
 	}
@@ -680,6 +757,97 @@ func (s *Service) handleOutboundCall(ctx *callContext) {
 	ctx.conn.Execute("respond", "404 Not Found", false)
 }
 
+// admitOutboundCall rejects the call when the tenant's outbound calling is
+// blocked or the tenant or calling extension is at its concurrent call
+// limit, and otherwise counts the call against those limits. The counters
+// are the mod_limit hash realms the XML dialplan uses.
+func (s *Service) admitOutboundCall(ctx *callContext, callerExt *models.Extension, callerFound bool) bool {
+	var tenant models.Tenant
+	ctx.db.Preload("Profile").Where("domain = ?", ctx.domain).Limit(1).Find(&tenant)
+
+	if tenant.OutboundBlocked {
+		ctx.logger.Warnf("Outbound denied: tenant %d blocked (%s)", tenant.ID, tenant.OutboundBlockReason)
+		ctx.conn.Execute("respond", "403 Forbidden", false)
+		ctx.conn.Execute("hangup", "OUTGOING_CALL_BARRED", false)
+		return false
+	}
+
+	if limit := tenant.ConcurrentCallLimit(); tenant.ID != 0 && limit >= 0 {
+		resource := fmt.Sprintf("%d", tenant.ID)
+		if !s.takeLimit(ctx, models.LimitRealmTenant, resource, limit, "!NORMAL_CIRCUIT_CONGESTION") {
+			ctx.logger.Warnf("Outbound denied: tenant %d at %d concurrent calls", tenant.ID, limit)
+			return false
+		}
+	}
+
+	if callerFound && callerExt.LimitMax > 0 {
+		// Past the limit mod_limit hangs up with the cause after "!" or
+		// transfers to the destination
+		onExceed := "!USER_BUSY"
+		if dest := callerExt.LimitDestination; strings.HasPrefix(dest, "!") {
+			onExceed = dest
+		} else if dest != "" {
+			onExceed = fmt.Sprintf("%s XML %s", dest, ctx.domain)
+		}
+		resource := models.ExtensionLimitResource(callerExt.Extension)
+		if !s.takeLimit(ctx, ctx.domain, resource, callerExt.LimitMax, onExceed) {
+			ctx.logger.Warnf("Outbound denied: caller %s at %d concurrent calls", ctx.callerID, callerExt.LimitMax)
+			return false
+		}
+	}
+	return true
+}
+
+// takeLimit counts the call against a mod_limit hash counter, checking and
+// incrementing in one step so simultaneous calls can't both slip under the
+// limit. Past the limit mod_limit itself carries out onExceed and takeLimit
+// reports false. mod_limit sets limit_usage_<realm>_<resource> only on
+// calls it admits.
+func (s *Service) takeLimit(ctx *callContext, realm, resource string, limit int, onExceed string) bool {
+	ctx.conn.Execute("limit", fmt.Sprintf("hash %s %s %d %s", realm, resource, limit, onExceed), true)
+	ev, err := ctx.conn.Send(fmt.Sprintf("api uuid_getvar %s limit_usage_%s_%s", ctx.uuid, realm, resource))
+	if err != nil {
+		// Can't tell; mod_limit has already enforced the limit either way
+		ctx.logger.WithError(err).Warn("Failed to read limit usage")
+		return true
+	}
+	// A rejected call is unset, or already gone when mod_limit hung it up
+	usage := strings.TrimSpace(ev.Body)
+	return usage != "" && usage != "_undef_" && !strings.HasPrefix(usage, "-ERR")
+}
+
+// bridgeGateway bridges to the gateway, or reports false without dialing
+// when the gateway is at its channel limit
+func (s *Service) bridgeGateway(ctx *callContext, gw *models.Gateway, dialDest string) bool {
+	bridgeStr := fmt.Sprintf("sofia/gateway/%s/%s", gw.GatewayName, dialDest)
+	if gw.Channels <= 0 {
+		ctx.conn.Execute("bridge", bridgeStr, true)
+		return true
+	}
+	if s.limitReached(ctx, models.LimitRealmGateway, gw.GatewayName, gw.Channels) {
+		ctx.logger.Infof("Gateway %s at %d channels, skipping", gw.GatewayName, gw.Channels)
+		return false
+	}
+	ctx.conn.Execute("limit_execute",
+		fmt.Sprintf("hash %s %s %d bridge %s", models.LimitRealmGateway, gw.GatewayName, gw.Channels, bridgeStr), true)
+	return true
+}
+
+// limitReached reports whether a mod_limit hash counter is at limit. A failed
+// usage query never blocks the call.
+func (s *Service) limitReached(ctx *callContext, realm, resource string, limit int) bool {
+	if ctx.manager == nil {
+		return false
+	}
+	out, err := ctx.manager.API(fmt.Sprintf("limit_usage hash %s %s", realm, resource))
+	if err != nil {
+		ctx.logger.WithError(err).Warn("limit_usage failed")
+		return false
+	}
+	usage, err := strconv.Atoi(strings.TrimSpace(out))
+	return err == nil && usage >= limit
+}
+
 // ========== Helpers ==========
 
 // handleRingGroupTimeout executes the timeout destination for a ring group
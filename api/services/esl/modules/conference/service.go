@@ -64,6 +64,9 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 	callerID := ev.Get("Caller-Caller-ID-Number")
 	callerName := ev.Get("Caller-Caller-ID-Name")
 	conferenceNum := ev.Get("Caller-Destination-Number")
+	if num := ev.Get("variable_conference_number"); num != "" {
+		conferenceNum = num // Meeting dial-outs name the room they join
+	}
 	domain := ev.Get("variable_domain_name")
 	tenantIDStr := ev.Get("variable_tenant_id")
 
@@ -103,9 +106,21 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 		}
 	}
 
+	// ---------- Scheduled Meeting ----------
+	// A meeting's one-time PINs replace the room's while it is open, and
+	// attendees it dialed out to join without one
+	pin, moderatorPIN := conf.PIN, conf.ModeratorPIN
+	meeting, _ := models.ActiveConferenceMeeting(db, conf.ID, time.Now())
+	if meeting != nil {
+		pin, moderatorPIN = meeting.PIN, meeting.ModeratorPIN
+	}
+
 	// ---------- PIN Authentication ----------
 	isModerator := false
-	if conf.PIN != "" || conf.ModeratorPIN != "" {
+	if attendee := dialedAttendee(db, ev, meeting); attendee != nil {
+		isModerator = attendee.Moderator
+		logger.Infof("Conference: dialed-out attendee %d joined meeting %d", attendee.ID, meeting.ID)
+	} else if pin != "" || moderatorPIN != "" {
 		authenticated := false
 		for attempt := 0; attempt < 3; attempt++ {
 			// Collect PIN
@@ -123,7 +138,7 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 			}
 
 			// Check moderator PIN first
-			if conf.ModeratorPIN != "" && enteredPIN == conf.ModeratorPIN {
+			if moderatorPIN != "" && enteredPIN == moderatorPIN {
 				isModerator = true
 				authenticated = true
 				logger.Info("Conference: authenticated as moderator")
@@ -131,7 +146,7 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 			}
 
 			// Check participant PIN
-			if conf.PIN != "" && enteredPIN == conf.PIN {
+			if pin != "" && enteredPIN == pin {
 				authenticated = true
 				logger.Info("Conference: authenticated as participant")
 				break
@@ -148,7 +163,7 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 
 	// Get or create session
 	tenantID, _ := strconv.ParseUint(tenantIDStr, 10, 32)
-	session := s.getOrCreateSession(confName, uint(tenantID))
+	session := s.getOrCreateSession(confName, uint(tenantID), conf.ID, meeting)
 
 	// ---------- Build Conference Flags ----------
 	var flags []string
@@ -233,17 +248,46 @@ func (s *Service) getConferenceMemberCount(confName string) int {
 	return count
 }
 
-// getOrCreateSession gets or creates a conference session
-func (s *Service) getOrCreateSession(confName string, tenantID uint) *models.ConferenceSession {
+// dialedAttendee returns the meeting attendee a call was placed to by the
+// meeting scheduler, or nil for callers who dialed in
+func dialedAttendee(db *gorm.DB, ev *eventsocket.Event, meeting *models.ConferenceMeeting) *models.ConferenceMeetingAttendee {
+	if meeting == nil || ev.Get("variable_conference_meeting_id") != strconv.FormatUint(uint64(meeting.ID), 10) {
+		return nil
+	}
+	attendeeID, err := strconv.ParseUint(ev.Get("variable_conference_attendee_id"), 10, 32)
+	if err != nil {
+		return nil
+	}
+	var attendee models.ConferenceMeetingAttendee
+	if err := db.Where("id = ? AND meeting_id = ? AND call_uuid = ? AND removed = ?",
+		attendeeID, meeting.ID, ev.Get("Unique-ID"), false).First(&attendee).Error; err != nil {
+		return nil
+	}
+	return &attendee
+}
+
+// getOrCreateSession gets or creates a conference session, linking it to
+// the scheduled meeting it runs for
+func (s *Service) getOrCreateSession(confName string, tenantID, conferenceID uint, meeting *models.ConferenceMeeting) *models.ConferenceSession {
 	if val, ok := s.sessions.Load(confName); ok {
-		return val.(*models.ConferenceSession)
+		session := val.(*models.ConferenceSession)
+		if meeting != nil && session.MeetingID == nil && s.db != nil {
+			// The room was already in use when the meeting opened
+			session.MeetingID = &meeting.ID
+			s.db.Model(session).Update("meeting_id", meeting.ID)
+		}
+		return session
 	}
 
 	session := &models.ConferenceSession{
+		ConferenceID:   conferenceID,
 		ConferenceName: confName,
 		TenantID:       tenantID,
 		StartTime:      time.Now(),
 	}
+	if meeting != nil {
+		session.MeetingID = &meeting.ID
+	}
 
 	if s.db != nil {
 		s.db.Create(session)
@@ -136,6 +136,12 @@ func (s *Service) executeFeatureCode(ctx *ExecutionContext) {
 	})
 	logger.Info("Executing feature code")
 
+	if !s.permitted(ctx) {
+		logger.WithField("caller", ctx.CallerID).Info("Feature code denied by extension profile")
+		ctx.Conn.Execute("playback", "ivr/ivr-not_have_permission.wav", true)
+		return
+	}
+
 	switch ctx.FeatureCode.Action {
 	case models.FCActionVoicemail:
 		handleVoicemail(ctx)
@@ -228,3 +234,26 @@ func (s *Service) sendPresenceNotify(domain, user, state string) {
 		))
 	}
 }
+
+// permitted checks the caller's extension profile for actions gated by a
+// permission (recording and voicemail). Callers without an extension or
+// profile are not restricted.
+func (s *Service) permitted(ctx *ExecutionContext) bool {
+	switch ctx.FeatureCode.Action {
+	case models.FCActionRecord, models.FCActionVoicemail:
+	default:
+		return true
+	}
+
+	var ext models.Extension
+	if err := ctx.DB.Where("extension = ? AND tenant_id = ?", ctx.CallerID, ctx.TenantID).
+		First(&ext).Error; err != nil {
+		return true
+	}
+
+	perms := models.ExtensionPermissionsFor(ctx.DB, &ext)
+	if ctx.FeatureCode.Action == models.FCActionRecord {
+		return perms.Recording
+	}
+	return perms.Voicemail
+}
@@ -0,0 +1,472 @@
+package queue
+
+import (
+	"callsign/models"
+	"callsign/services/esl"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// agentRingTimeout is how long the agent's phone rings for a callback
+	agentRingTimeout = 30
+	// customerRingTimeout is how long the caller's phone rings once an agent is on the line
+	customerRingTimeout = 45
+	// staleCallAfter is when a callback still marked calling is checked for a live channel
+	staleCallAfter = 2 * time.Minute
+)
+
+// StartCallbacks polls for callbacks that are due. Callback state lives on
+// the QueueCallback row so accepted callbacks survive restarts; a callback
+// is only placed once no live caller who joined before it is still waiting,
+// and only while the queue's business hours are open.
+func (s *Service) StartCallbacks(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.ProcessCallbacks()
+		}
+	}()
+	log.Infof("Queue callback scheduler started (interval: %s)", interval)
+}
+
+// ProcessCallbacks expires stale requests, recovers calls that vanished and
+// dials an agent for each callback whose turn has come. The caller is only
+// dialled once the agent answers (see handleCallback).
+func (s *Service) ProcessCallbacks() {
+	manager := s.Manager()
+	if manager == nil || !manager.IsConnected() {
+		return
+	}
+	db := manager.DB
+	now := time.Now()
+
+	s.recoverStaleCallbacks(now)
+
+	var callbacks []models.QueueCallback
+	if err := db.Where("status IN ?", []string{models.QueueCallbackPending, models.QueueCallbackRetry}).
+		Order("requested_at ASC").Find(&callbacks).Error; err != nil {
+		log.Warnf("Queue callbacks: failed to load callbacks: %v", err)
+		return
+	}
+
+	byQueue := make(map[uint][]models.QueueCallback)
+	var order []uint
+	for _, cb := range callbacks {
+		if _, ok := byQueue[cb.QueueID]; !ok {
+			order = append(order, cb.QueueID)
+		}
+		byQueue[cb.QueueID] = append(byQueue[cb.QueueID], cb)
+	}
+
+	for _, queueID := range order {
+		var queue models.Queue
+		if err := db.First(&queue, queueID).Error; err != nil {
+			// Queue deleted; nobody is left to call back
+			for _, cb := range byQueue[queueID] {
+				s.expireCallback(&cb, "queue deleted")
+			}
+			continue
+		}
+		s.processQueueCallbacks(&queue, byQueue[queueID], now)
+	}
+}
+
+// processQueueCallbacks places the due callbacks of one queue, oldest first
+func (s *Service) processQueueCallbacks(queue *models.Queue, callbacks []models.QueueCallback, now time.Time) {
+	manager := s.Manager()
+	db := manager.DB
+
+	expiry := time.Duration(queue.CallbackExpiry) * time.Minute
+	due := callbacks[:0]
+	for _, cb := range callbacks {
+		if expiry > 0 && now.Sub(cb.RequestedAt) > expiry {
+			s.expireCallback(&cb, "not served in time")
+			continue
+		}
+		due = append(due, cb)
+	}
+	if len(due) == 0 || !queue.Enabled {
+		return
+	}
+
+	if queue.BusinessHoursID != nil {
+		var hours models.TimeCondition
+		if err := db.First(&hours, *queue.BusinessHoursID).Error; err == nil && !hours.OpenAt(db, now) {
+			return
+		}
+	}
+
+	var tenant models.Tenant
+	if err := db.First(&tenant, queue.TenantID).Error; err != nil {
+		return
+	}
+	ccQueue := queue.Name
+	if tenant.Domain != "" {
+		ccQueue = fmt.Sprintf("%s@%s", queue.Name, tenant.Domain)
+	}
+
+	// The callback keeps the caller's place in line: anyone still waiting
+	// who joined before the request is served first
+	oldestWaiting := s.oldestWaitingMember(ccQueue)
+	agents := s.idleAgents(ccQueue)
+
+	for _, cb := range due {
+		if cb.Status == models.QueueCallbackRetry && cb.NextAttemptAt != nil && cb.NextAttemptAt.After(now) {
+			continue
+		}
+		if !oldestWaiting.IsZero() && oldestWaiting.Before(cb.RequestedAt) {
+			return
+		}
+		if len(agents) == 0 {
+			return
+		}
+		agent := agents[0]
+		agents = agents[1:]
+		s.dialAgent(&tenant, queue, cb, agent)
+	}
+}
+
+// ccAgent is an agent row from callcenter_config
+type ccAgent struct {
+	Name    string
+	Contact string
+	IdleFor int64
+}
+
+// idleAgents returns the queue's agents that could take a call right now,
+// longest idle first
+func (s *Service) idleAgents(ccQueue string) []ccAgent {
+	result, err := s.Manager().API(fmt.Sprintf("callcenter_config queue list agents %s", ccQueue))
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	var agents []ccAgent
+	for _, row := range parseCallcenterTable(result) {
+		status := row["status"]
+		if status != string(models.AgentStatusAvailable) && status != string(models.AgentStatusAvailableOnDemand) {
+			continue
+		}
+		if row["state"] != string(models.AgentStateWaiting) || row["contact"] == "" {
+			continue
+		}
+		// Still in wrap-up
+		if ready, _ := strconv.ParseInt(row["ready_time"], 10, 64); ready > now {
+			continue
+		}
+		lastEnd, _ := strconv.ParseInt(row["last_bridge_end"], 10, 64)
+		agents = append(agents, ccAgent{Name: row["name"], Contact: row["contact"], IdleFor: now - lastEnd})
+	}
+	sort.SliceStable(agents, func(i, j int) bool { return agents[i].IdleFor > agents[j].IdleFor })
+	return agents
+}
+
+// oldestWaitingMember returns when the longest-waiting live caller joined,
+// or the zero time when nobody is waiting
+func (s *Service) oldestWaitingMember(ccQueue string) time.Time {
+	result, err := s.Manager().API(fmt.Sprintf("callcenter_config queue list members %s", ccQueue))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var oldest time.Time
+	for _, row := range parseCallcenterTable(result) {
+		if row["state"] != "Waiting" && row["state"] != "Trying" {
+			continue
+		}
+		epoch, err := strconv.ParseInt(row["joined_epoch"], 10, 64)
+		if err != nil || epoch == 0 {
+			continue
+		}
+		joined := time.Unix(epoch, 0)
+		if oldest.IsZero() || joined.Before(oldest) {
+			oldest = joined
+		}
+	}
+	return oldest
+}
+
+// dialAgent claims the callback, reserves the agent and rings them. The
+// answered agent leg is handed back to this module, which then dials the
+// caller.
+func (s *Service) dialAgent(tenant *models.Tenant, queue *models.Queue, cb models.QueueCallback, agent ccAgent) {
+	manager := s.Manager()
+	callUUID := uuid.New().String()
+	now := time.Now()
+
+	claimed := manager.DB.Model(&models.QueueCallback{}).
+		Where("id = ? AND status = ?", cb.ID, cb.Status).
+		Updates(map[string]interface{}{
+			"status":          models.QueueCallbackCalling,
+			"called_at":       now,
+			"next_attempt_at": nil,
+			"agent_name":      agent.Name,
+			"call_uuid":       callUUID,
+			"hangup_cause":    "",
+		})
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return
+	}
+	cb.Status = models.QueueCallbackCalling
+	cb.CalledAt = &now
+	cb.AgentName = agent.Name
+	cb.CallUUID = callUUID
+	s.notifyCallback(&cb)
+
+	// Keep mod_callcenter from offering the agent a queue call meanwhile
+	s.setAgentState(agent.Name, models.AgentStateReceiving)
+
+	callerName := cb.CallerName
+	if callerName == "" {
+		callerName = cb.CallbackNumber
+	}
+	vars := fmt.Sprintf(
+		"origination_uuid=%s,queue_callback_id=%d,domain_name=%s,origination_caller_id_name='Callback %s',origination_caller_id_number=%s,originate_timeout=%d,ignore_early_media=true",
+		callUUID,
+		cb.ID,
+		tenant.Domain,
+		strings.ReplaceAll(callerName, "'", ""),
+		cb.CallbackNumber,
+		agentRingTimeout,
+	)
+	cmd := fmt.Sprintf("originate %s &socket(%s async full)", withChannelVars(agent.Contact, vars), ServiceAddress)
+
+	log.WithFields(log.Fields{
+		"callback_id": cb.ID,
+		"queue":       queue.Name,
+		"agent":       agent.Name,
+		"number":      cb.CallbackNumber,
+	}).Info("Queue: dialling agent for callback")
+
+	if _, err := manager.BgAPI(cmd); err != nil {
+		log.Errorf("Queue callback failed to originate agent leg: %v", err)
+		s.releaseCallback(&cb)
+	}
+}
+
+// handleCallback runs on the answered agent leg: it dials the caller and
+// bridges them to the agent, then records the attempt.
+func (s *Service) handleCallback(conn *eventsocket.Connection, ev *eventsocket.Event, callbackID string) {
+	manager := s.Manager()
+	db := manager.DB
+
+	conn.Send("linger")
+	conn.Send("myevents")
+
+	callUUID := ev.Get("Unique-ID")
+	var cb models.QueueCallback
+	if err := db.Where("id = ? AND call_uuid = ? AND status = ?", callbackID, callUUID, models.QueueCallbackCalling).
+		First(&cb).Error; err != nil {
+		// Cancelled or expired while the agent was ringing
+		conn.Execute("playback", "ivr/ivr-call_cannot_be_completed_as_dialed.wav", true)
+		conn.Execute("hangup", "NORMAL_CLEARING", false)
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		"callback_id": cb.ID,
+		"agent":       cb.AgentName,
+		"number":      cb.CallbackNumber,
+	})
+	logger.Info("Queue: agent answered callback, dialling caller")
+	s.setAgentState(cb.AgentName, models.AgentStateInCall)
+
+	domain := ev.Get("variable_domain_name")
+	var queue models.Queue
+	db.First(&queue, cb.QueueID)
+
+	// Present the agent's outbound caller ID (from the directory) to the
+	// customer; the tenant's outbound routes take it from here
+	conn.Execute("set", "hangup_after_bridge=false", true)
+	conn.Execute("set", "continue_on_fail=true", true)
+	conn.Execute("set", fmt.Sprintf("effective_caller_id_name=%s", queue.Name), true)
+	if number := ev.Get("variable_outbound_caller_id_number"); number != "" {
+		conn.Execute("set", fmt.Sprintf("effective_caller_id_number=%s", number), true)
+	}
+	conn.Execute("playback", "ivr/ivr-hold_connect_call.wav", true)
+	conn.Execute("bridge", fmt.Sprintf("{originate_timeout=%d,ignore_early_media=true}loopback/%s/%s",
+		customerRingTimeout, cb.CallbackNumber, domain), true)
+
+	disposition := ""
+	if res, err := conn.Send("api uuid_getvar " + callUUID + " originate_disposition"); err == nil {
+		disposition = strings.TrimSpace(res.Body)
+	}
+
+	cb.Attempts++
+	cb.HangupCause = disposition
+	updates := map[string]interface{}{
+		"attempts":     cb.Attempts,
+		"hangup_cause": disposition,
+	}
+	switch {
+	case disposition == "SUCCESS" || disposition == "ANSWER":
+		now := time.Now()
+		cb.Status = models.QueueCallbackCompleted
+		cb.CompletedAt = &now
+		updates["completed_at"] = now
+		logger.Info("Queue: callback completed")
+	case cb.Attempts >= cb.MaxAttempts:
+		cb.Status = models.QueueCallbackFailed
+		logger.WithField("cause", disposition).Warn("Queue: callback failed, attempts exhausted")
+	default:
+		next := time.Now().Add(time.Duration(queue.CallbackRetryDelay) * time.Second)
+		cb.Status = models.QueueCallbackRetry
+		cb.NextAttemptAt = &next
+		updates["next_attempt_at"] = next
+		logger.WithField("cause", disposition).Info("Queue: caller not reached, will retry")
+	}
+	updates["status"] = cb.Status
+	db.Model(&models.QueueCallback{}).Where("id = ? AND status = ?", cb.ID, models.QueueCallbackCalling).Updates(updates)
+	s.notifyCallback(&cb)
+
+	if cb.Status != models.QueueCallbackCompleted {
+		conn.Execute("playback", "ivr/ivr-call_cannot_be_completed_as_dialed.wav", true)
+	}
+	conn.Execute("hangup", "NORMAL_CLEARING", false)
+}
+
+// handleCallbackHangup frees the agent once a callback's agent leg ends.
+// When the agent never answered, the callback goes back in line without
+// counting an attempt against the caller.
+func (s *Service) handleCallbackHangup(ev *eventsocket.Event, _ *esl.CallSession) {
+	if ev.Get("variable_queue_callback_id") == "" {
+		return
+	}
+	manager := s.Manager()
+	if manager == nil {
+		return
+	}
+
+	var cb models.QueueCallback
+	if err := manager.DB.Where("call_uuid = ?", ev.Get("Unique-ID")).First(&cb).Error; err != nil {
+		return
+	}
+	s.setAgentState(cb.AgentName, models.AgentStateWaiting)
+
+	answered := ev.Get("Caller-Channel-Answered-Time")
+	if cb.Status == models.QueueCallbackCalling && (answered == "" || answered == "0") {
+		cb.HangupCause = ev.Get("Hangup-Cause")
+		s.releaseCallback(&cb)
+	}
+}
+
+// recoverStaleCallbacks puts callbacks whose call disappeared (e.g. the
+// agent leg never came up, or a restart lost its hangup) back in line
+func (s *Service) recoverStaleCallbacks(now time.Time) {
+	manager := s.Manager()
+	var stale []models.QueueCallback
+	manager.DB.Where("status = ? AND called_at < ?", models.QueueCallbackCalling, now.Add(-staleCallAfter)).Find(&stale)
+
+	for _, cb := range stale {
+		if cb.CallUUID != "" {
+			if res, err := manager.API("uuid_exists " + cb.CallUUID); err == nil && strings.TrimSpace(res) == "true" {
+				continue
+			}
+		}
+		s.setAgentState(cb.AgentName, models.AgentStateWaiting)
+		s.releaseCallback(&cb)
+	}
+}
+
+// releaseCallback returns a callback to the pending state without counting
+// an attempt, keeping its original place in line
+func (s *Service) releaseCallback(cb *models.QueueCallback) {
+	status := models.QueueCallbackPending
+	if cb.Attempts > 0 {
+		status = models.QueueCallbackRetry
+	}
+	res := s.Manager().DB.Model(&models.QueueCallback{}).
+		Where("id = ? AND status = ?", cb.ID, models.QueueCallbackCalling).
+		Updates(map[string]interface{}{"status": status, "hangup_cause": cb.HangupCause})
+	if res.RowsAffected == 0 {
+		return
+	}
+	cb.Status = status
+	s.notifyCallback(cb)
+}
+
+// expireCallback gives up on a callback that was never served
+func (s *Service) expireCallback(cb *models.QueueCallback, reason string) {
+	res := s.Manager().DB.Model(&models.QueueCallback{}).
+		Where("id = ? AND status IN ?", cb.ID, []string{models.QueueCallbackPending, models.QueueCallbackRetry}).
+		Update("status", models.QueueCallbackExpired)
+	if res.RowsAffected == 0 {
+		return
+	}
+	cb.Status = models.QueueCallbackExpired
+	log.WithField("callback_id", cb.ID).Infof("Queue: callback expired (%s)", reason)
+	s.notifyCallback(cb)
+}
+
+// setAgentState updates an agent's call state in FreeSWITCH and the DB
+func (s *Service) setAgentState(agentName string, state models.AgentState) {
+	if agentName == "" {
+		return
+	}
+	manager := s.Manager()
+	manager.API(fmt.Sprintf("callcenter_config agent set state %s '%s'", agentName, state))
+	manager.DB.Model(&models.QueueAgent{}).Where("agent_name = ?", agentName).Update("state", state)
+}
+
+// notifyCallback pushes a callback state change to the tenant's dashboards
+func (s *Service) notifyCallback(cb *models.QueueCallback) {
+	manager := s.Manager()
+	if manager == nil || manager.WSHub == nil {
+		return
+	}
+	manager.WSHub.NotifyQueueEvent(cb.TenantID, "callback_"+cb.Status, map[string]interface{}{
+		"callback_id":     cb.ID,
+		"queue_id":        cb.QueueID,
+		"status":          cb.Status,
+		"callback_number": cb.CallbackNumber,
+		"caller_name":     cb.CallerName,
+		"attempts":        cb.Attempts,
+		"agent_name":      cb.AgentName,
+		"requested_at":    cb.RequestedAt,
+	})
+}
+
+// withChannelVars adds originate variables to a dial string that may
+// already carry its own {...} block
+func withChannelVars(dialString, vars string) string {
+	if strings.HasPrefix(dialString, "{") {
+		return "{" + vars + "," + dialString[1:]
+	}
+	return "{" + vars + "}" + dialString
+}
+
+// parseCallcenterTable parses the pipe-separated output of callcenter_config
+// list commands into rows keyed by the header line
+func parseCallcenterTable(result string) []map[string]string {
+	var header []string
+	var rows []map[string]string
+	for _, line := range strings.Split(result, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "+OK") || strings.HasPrefix(line, "-ERR") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if header == nil {
+			header = fields
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(fields) {
+				row[name] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
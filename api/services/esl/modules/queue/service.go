@@ -37,6 +37,9 @@ func (s *Service) Init(manager *esl.Manager) error {
 	// Sync agents to FreeSWITCH on startup
 	go s.syncAgentsToFreeSWITCH()
 
+	// Free agents and requeue callbacks when a callback's agent leg ends
+	manager.On("CHANNEL_HANGUP_COMPLETE", s.handleCallbackHangup)
+
 	log.Info("Queue service initialized")
 	return nil
 }
@@ -88,6 +91,12 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 		return
 	}
 
+	// Agent leg of a scheduled callback
+	if callbackID := ev.Get("variable_queue_callback_id"); callbackID != "" {
+		s.handleCallback(conn, ev, callbackID)
+		return
+	}
+
 	uuid := ev.Get("Unique-ID")
 	callerID := ev.Get("Caller-Caller-ID-Number")
 	callerName := ev.Get("Caller-Caller-ID-Name")
@@ -165,7 +174,7 @@ func (s *Service) Handle(conn *eventsocket.Connection) {
 	// ---------- Callback Offer ----------
 	if queue.CallbackEnabled && positionCount >= queue.CallbackThreshold {
 		logger.Info("Queue: offering callback to caller")
-		offered := s.offerCallback(conn, uuid, callerID, callerName, &queue, domain, logger)
+		offered := s.offerCallback(conn, uuid, callerID, callerName, &queue, positionCount+1, logger)
 		if offered {
 			// Caller accepted callback — hang up, they'll be called back
 			return
@@ -215,7 +224,7 @@ func (s *Service) offerCallback(
 	conn *eventsocket.Connection,
 	uuid, callerID, callerName string,
 	queue *models.Queue,
-	domain string,
+	position int,
 	logger *log.Entry,
 ) bool {
 	// Play: "Press 1 to receive a callback when an agent is available. Press 2 to continue waiting."
@@ -234,7 +243,7 @@ func (s *Service) offerCallback(
 
 	logger.Info("Queue: caller accepted callback")
 
-	// Schedule callback in DB
+	// Schedule callback in DB; the caller keeps their place in line from now
 	manager := s.Manager()
 	if manager != nil {
 		callback := &models.QueueCallback{
@@ -243,10 +252,15 @@ func (s *Service) offerCallback(
 			CallerNumber:   callerID,
 			CallerName:     callerName,
 			CallbackNumber: callerID,
-			Status:         "pending",
+			Status:         models.QueueCallbackPending,
 			RequestedAt:    time.Now(),
+			Position:       position,
+		}
+		if err := manager.DB.Create(callback).Error; err != nil {
+			logger.Errorf("Queue: failed to schedule callback: %v", err)
+			return false
 		}
-		manager.DB.Create(callback)
+		s.notifyCallback(callback)
 	}
 
 	// Confirm to caller
@@ -420,56 +434,6 @@ func (s *Service) SetAgentStatus(agentID uint, status models.AgentStatus) error
 	return nil
 }
 
-// ProcessCallbacks checks for pending callbacks and originates calls
-func (s *Service) ProcessCallbacks() {
-	manager := s.Manager()
-	if manager == nil || manager.Client == nil {
-		return
-	}
-
-	db := manager.DB
-	var callbacks []models.QueueCallback
-	db.Where("status = 'pending'").Order("requested_at ASC").Limit(5).Find(&callbacks)
-
-	for _, cb := range callbacks {
-		// Check if agents are available for this queue
-		var queue models.Queue
-		if err := db.First(&queue, cb.QueueID).Error; err != nil {
-			continue
-		}
-
-		// Get available agent count
-		ccQueue := queue.Name
-		result, err := manager.Client.API(fmt.Sprintf("callcenter_config queue %s count agents Available", ccQueue))
-		if err != nil {
-			continue
-		}
-
-		var available int
-		fmt.Sscanf(strings.TrimSpace(result), "%d", &available)
-		if available == 0 {
-			continue
-		}
-
-		// Originate callback
-		log.WithFields(log.Fields{
-			"callback_id": cb.ID,
-			"number":      cb.CallbackNumber,
-			"queue":       queue.Name,
-		}).Info("Queue: originating callback")
-
-		// Mark as in-progress
-		db.Model(&cb).Update("status", "calling")
-
-		// Originate: call the customer and bridge to queue
-		originateCmd := fmt.Sprintf(
-			"originate {origination_caller_id_name='%s',origination_caller_id_number='%s'}sofia/gateway/default/%s &callcenter(%s)",
-			queue.Name, "callback", cb.CallbackNumber, ccQueue,
-		)
-		manager.Client.API(originateCmd)
-	}
-}
-
 // GetQueueStats retrieves real-time queue statistics from FreeSWITCH
 func (s *Service) GetQueueStats(queueName string) (*models.QueueStatistics, error) {
 	manager := s.Manager()
@@ -0,0 +1,81 @@
+package voicemail
+
+import (
+	"callsign/models"
+	"callsign/services/email"
+	"callsign/services/storage"
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// notifyAddress returns where a box's notifications go: the box's own
+// address, else the email of the user owning the extension
+func notifyAddress(db *gorm.DB, box *models.VoicemailBox) string {
+	if box.Email != "" {
+		return box.Email
+	}
+	var ext models.Extension
+	if err := db.Where("extension = ? AND tenant_id = ?", box.Extension, box.TenantID).First(&ext).Error; err != nil || ext.UserID == nil {
+		return ""
+	}
+	var user models.User
+	if err := db.First(&user, *ext.UserID).Error; err != nil {
+		return ""
+	}
+	return user.Email
+}
+
+// SendNotification emails a voicemail message to its box's address, with
+// the transcript when there is one and the recording when the box attaches
+// files
+func SendNotification(db *gorm.DB, mailer *email.Service, store *storage.Manager, msg *models.VoicemailMessage) error {
+	if mailer == nil || !mailer.IsEnabled() {
+		return nil
+	}
+
+	var box models.VoicemailBox
+	if err := db.First(&box, msg.BoxID).Error; err != nil {
+		return fmt.Errorf("voicemail box %d not found", msg.BoxID)
+	}
+	to := notifyAddress(db, &box)
+	if to == "" {
+		return nil
+	}
+
+	attachment := ""
+	if box.AttachFile {
+		path, err := store.Localize(context.Background(), msg.FilePath)
+		if err != nil {
+			log.Warnf("Voicemail: recording %s unavailable for email: %v", msg.FilePath, err)
+		} else {
+			attachment = path
+		}
+	}
+
+	return mailer.SendVoicemailNotification(to, box.Extension, msg.CallerIDNumber, msg.CallerIDName,
+		msg.Duration, msg.Transcription, attachment)
+}
+
+// NotifyTranscribed sends the notification a deposit deferred until its
+// transcript was ready. The transcription worker calls it once the job
+// completes or fails; a failed job sends without the transcript.
+func NotifyTranscribed(db *gorm.DB, mailer *email.Service, store *storage.Manager, messageID uint) {
+	// Claim the pending notification so a re-transcription never re-sends it
+	res := db.Model(&models.VoicemailMessage{}).
+		Where("id = ? AND notify_pending = ?", messageID, true).
+		Update("notify_pending", false)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+
+	var msg models.VoicemailMessage
+	if err := db.First(&msg, messageID).Error; err != nil {
+		return
+	}
+	if err := SendNotification(db, mailer, store, &msg); err != nil {
+		log.WithError(err).WithField("message_id", messageID).Warn("Voicemail: notification email failed")
+	}
+}
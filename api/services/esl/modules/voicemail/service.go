@@ -3,6 +3,7 @@ package voicemail
 import (
 	"callsign/models"
 	"callsign/services/esl"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,6 +20,9 @@ const (
 	ServiceAddress = "127.0.0.2:9001"
 
 	maxPINAttempts = 3
+
+	// Most targets a message can be forwarded to in one go
+	maxForwardTargets = 10
 )
 
 // Service implements the voicemail ESL module with full IVR
@@ -105,9 +109,16 @@ func (s *Service) handleDeposit(conn *eventsocket.Connection, manager *esl.Manag
 
 	db := manager.DB
 
-	// Find the voicemail box
+	// Find the voicemail box in the caller's tenant; a distribution list
+	// number records once and copies to every member box
+	tenantID := tenantForDomain(db, domain)
 	var box models.VoicemailBox
-	if err := db.Where("extension = ? AND enabled = ?", extension, true).First(&box).Error; err != nil {
+	if err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", tenantID, extension, true).First(&box).Error; err != nil {
+		var list models.VoicemailDistributionList
+		if err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", tenantID, extension, true).First(&list).Error; err == nil {
+			s.handleListDeposit(conn, manager, uuid, callerID, callerName, &list, logger)
+			return
+		}
 		logger.Warnf("Voicemail box not found for extension %s", extension)
 		conn.Execute("playback", "voicemail/vm-not_available.wav", true)
 		conn.Execute("hangup", "", false)
@@ -139,31 +150,8 @@ func (s *Service) handleDeposit(conn *eventsocket.Connection, manager *esl.Manag
 	// Record message
 	recordPath := s.getRecordingPath(box.TenantID, box.Extension, uuid)
 	recordStart := time.Now()
-
-	// Ensure directory exists
-	os.MkdirAll(filepath.Dir(recordPath), 0755)
-
-	// Record with max length, silence detection
-	maxSecs := box.MaxMessageSecs
-	if maxSecs == 0 {
-		maxSecs = 180
-	}
-	conn.Execute("record", fmt.Sprintf("%s %d 100 5", recordPath, maxSecs), true)
-
-	recordEnd := time.Now()
-	duration := int(recordEnd.Sub(recordStart).Seconds())
-
-	// Get file size
-	var fileSize int64
-	if info, err := os.Stat(recordPath); err == nil {
-		fileSize = info.Size()
-	}
-
-	// Minimum duration check (ignore short recordings)
-	if duration < 3 {
-		logger.Info("Recording too short, discarding")
-		os.Remove(recordPath)
-		conn.Execute("hangup", "", false)
+	duration, fileSize, ok := s.recordMessage(conn, recordPath, box.MaxMessageSecs, logger)
+	if !ok {
 		return
 	}
 
@@ -185,51 +173,170 @@ func (s *Service) handleDeposit(conn *eventsocket.Connection, manager *esl.Manag
 		logger.Errorf("Failed to save voicemail message: %v", err)
 	} else {
 		// Update box message count
-		db.Model(&box).Update("new_messages", box.NewMessages+1)
+		models.RefreshVoicemailCounts(db, &box)
 		logger.Infof("Voicemail saved: %d seconds", duration)
 	}
 
-	// Send MWI notification
-	s.sendMWI(manager, box.Extension, domain, box.NewMessages+1, box.SavedMessages)
+	// Send MWI notification (lights group members too)
+	s.sendMWI(manager, &box)
+
+	// Boxes that email transcripts queue the message for speech-to-text and
+	// hold the email until the worker finishes (see NotifyTranscribed)
+	deferEmail := false
+	if box.TranscriptionEmail && manager.Transcriber != nil && message.ID != 0 {
+		db.Model(message).Update("notify_pending", true)
+		if _, err := manager.Transcriber.EnqueueVoicemail(box.TenantID, message.ID); err != nil {
+			logger.Warnf("Failed to queue voicemail transcription: %v", err)
+			db.Model(message).Update("notify_pending", false)
+		} else {
+			deferEmail = true
+		}
+	}
 
 	// Notify via WebSocket
 	if manager.WSHub != nil {
 		manager.NotifyCallEvent(box.TenantID, "voicemail_new", map[string]interface{}{
-			"extension": box.Extension,
-			"caller":    callerID,
-			"duration":  duration,
+			"message_id": message.ID,
+			"extension":  box.Extension,
+			"caller":     callerID,
+			"duration":   duration,
 		})
 	}
 
-	// Send email notification with .wav attachment (async)
-	if manager.Email != nil && manager.Email.IsEnabled() {
-		go func() {
-			// Find the extension's email address
-			var ext models.Extension
-			if err := db.Where("extension = ? AND tenant_id = ?", box.Extension, box.TenantID).First(&ext).Error; err == nil {
-				emailAddr := ""
-				// Try extension's user email
-				if ext.UserID != nil {
-					var user models.User
-					if err := db.First(&user, *ext.UserID).Error; err == nil {
-						emailAddr = user.Email
-					}
-				}
-				if emailAddr != "" {
-					manager.Email.SendVoicemailNotification(
-						emailAddr, box.Extension, callerID, callerName,
-						duration, recordPath,
-					)
-				}
+	// Send the email notification, then hand the file to object storage
+	// (async). Upload runs after the email so the attachment is still on
+	// disk if the local copy gets evicted.
+	go func() {
+		if !deferEmail && message.ID != 0 {
+			if err := SendNotification(db, manager.Email, manager.Storage, message); err != nil {
+				logger.Warnf("Failed to send voicemail email: %v", err)
 			}
-		}()
-	}
+		}
+
+		if _, err := manager.Storage.Store(context.Background(), models.StorageCategoryVoicemail, box.TenantID, recordPath, "audio/wav"); err != nil {
+			logger.Warnf("Failed to store voicemail (will retry in migration): %v", err)
+		}
+	}()
 
 	// Thank the caller
 	conn.Execute("playback", "voicemail/vm-goodbye.wav", true)
 	conn.Execute("hangup", "", false)
 }
 
+// handleListDeposit records one message on a distribution list number and
+// copies it to every member's mailbox
+func (s *Service) handleListDeposit(conn *eventsocket.Connection, manager *esl.Manager,
+	uuid, callerID, callerName string, list *models.VoicemailDistributionList, logger *log.Entry) {
+
+	db := manager.DB
+	logger = logger.WithField("list", list.Extension)
+
+	boxes, _ := models.ResolveVoicemailTargets(db, list.TenantID, []string{list.Extension})
+	if len(boxes) == 0 {
+		logger.Warn("Voicemail list has no member mailboxes")
+		conn.Execute("playback", "voicemail/vm-not_available.wav", true)
+		conn.Execute("hangup", "", false)
+		return
+	}
+
+	if list.GreetingPath != "" && s.localize(manager, list.GreetingPath) {
+		conn.Execute("playback", list.GreetingPath, true)
+	} else {
+		conn.Execute("playback", "voicemail/vm-record_message.wav", true)
+	}
+
+	recordPath := s.getRecordingPath(list.TenantID, list.Extension, uuid)
+	recordStart := time.Now()
+	duration, fileSize, ok := s.recordMessage(conn, recordPath, list.MaxMessageSecs, logger)
+	if !ok {
+		return
+	}
+
+	original := &models.VoicemailMessage{
+		TenantID:       list.TenantID,
+		CallerIDName:   callerName,
+		CallerIDNumber: callerID,
+		Duration:       duration,
+		FilePath:       recordPath,
+		FileSize:       fileSize,
+		RecordedAt:     recordStart,
+		ChannelUUID:    uuid,
+	}
+
+	var delivered []*models.VoicemailMessage
+	for i := range boxes {
+		box := &boxes[i]
+		if box.MaxMessages > 0 && box.NewMessages+box.SavedMessages >= box.MaxMessages {
+			logger.Infof("Voicemail box %s is full, skipping list copy", box.Extension)
+			continue
+		}
+		msg, err := original.CopyTo(db, box, list.Extension, "")
+		if err != nil {
+			logger.Errorf("Failed to deliver list message to %s: %v", box.Extension, err)
+			continue
+		}
+		delivered = append(delivered, msg)
+		s.sendMWI(manager, box)
+		if manager.WSHub != nil {
+			manager.NotifyCallEvent(box.TenantID, "voicemail_new", map[string]interface{}{
+				"message_id": msg.ID,
+				"extension":  box.Extension,
+				"list":       list.Extension,
+				"caller":     callerID,
+				"duration":   duration,
+			})
+		}
+	}
+	logger.Infof("Voicemail list message delivered to %d of %d boxes", len(delivered), len(boxes))
+
+	go func() {
+		for _, msg := range delivered {
+			if err := SendNotification(db, manager.Email, manager.Storage, msg); err != nil {
+				logger.Warnf("Failed to send voicemail email: %v", err)
+			}
+		}
+		if len(delivered) == 0 {
+			os.Remove(recordPath)
+			return
+		}
+		if _, err := manager.Storage.Store(context.Background(), models.StorageCategoryVoicemail, list.TenantID, recordPath, "audio/wav"); err != nil {
+			logger.Warnf("Failed to store voicemail (will retry in migration): %v", err)
+		}
+	}()
+
+	conn.Execute("playback", "voicemail/vm-goodbye.wav", true)
+	conn.Execute("hangup", "", false)
+}
+
+// recordMessage records the caller to path with silence detection. Short
+// recordings are discarded and the call hung up; ok reports a usable message.
+func (s *Service) recordMessage(conn *eventsocket.Connection, path string, maxSecs int, logger *log.Entry) (duration int, size int64, ok bool) {
+	// Ensure directory exists
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	// Record with max length, silence detection
+	if maxSecs == 0 {
+		maxSecs = 180
+	}
+	recordStart := time.Now()
+	conn.Execute("record", fmt.Sprintf("%s %d 100 5", path, maxSecs), true)
+	duration = int(time.Since(recordStart).Seconds())
+
+	// Get file size
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	// Minimum duration check (ignore short recordings)
+	if duration < 3 {
+		logger.Info("Recording too short, discarding")
+		os.Remove(path)
+		conn.Execute("hangup", "", false)
+		return 0, 0, false
+	}
+	return duration, size, true
+}
+
 // ========== Voicemail Check (Full IVR) ==========
 
 // handleCheck handles checking voicemail messages with full IVR
@@ -238,9 +345,17 @@ func (s *Service) handleCheck(conn *eventsocket.Connection, manager *esl.Manager
 
 	db := manager.DB
 
-	// Find the voicemail box for this caller
+	// Find the voicemail box for this caller, else the first group box the
+	// caller is a member of
+	tenantID := tenantForDomain(db, domain)
 	var box models.VoicemailBox
-	if err := db.Where("extension = ? AND enabled = ?", callerID, true).First(&box).Error; err != nil {
+	err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", tenantID, callerID, true).First(&box).Error
+	if err != nil {
+		if groups := groupBoxes(db, tenantID, callerID); len(groups) > 0 {
+			box, err = groups[0], nil
+		}
+	}
+	if err != nil {
 		logger.Warnf("No voicemail box for caller %s", callerID)
 		conn.Execute("playback", "voicemail/vm-not_available.wav", true)
 		conn.Execute("hangup", "", false)
@@ -267,12 +382,13 @@ func (s *Service) handleCheck(conn *eventsocket.Connection, manager *esl.Manager
 	}
 
 	// --- Main Menu IVR ---
-	s.mainMenu(conn, manager, uuid, &box, domain, logger)
+	s.mainMenu(conn, manager, uuid, &box, callerID, domain, logger)
 }
 
-// mainMenu presents the main voicemail menu
+// mainMenu presents the main voicemail menu. caller is the authenticated
+// extension, which may differ from the box when it is a group mailbox.
 func (s *Service) mainMenu(conn *eventsocket.Connection, manager *esl.Manager,
-	uuid string, box *models.VoicemailBox, domain string, logger *log.Entry) {
+	uuid string, box *models.VoicemailBox, caller, domain string, logger *log.Entry) {
 
 	db := manager.DB
 
@@ -306,17 +422,23 @@ func (s *Service) mainMenu(conn *eventsocket.Connection, manager *esl.Manager,
 		// 1 = listen to new messages
 		// 2 = listen to saved messages
 		// 5 = greeting management
+		// 6 = switch to a group mailbox the caller belongs to
 		// * = exit
 		conn.Execute("playback", "voicemail/vm-main_menu.wav", true)
 		digit := s.collectDigits(conn, uuid, "silence_stream://2000", 1, 1, 5000)
 
 		switch digit {
 		case "1":
-			s.listenMessages(conn, manager, uuid, box, domain, true, logger)
+			s.listenMessages(conn, manager, uuid, box, caller, domain, true, logger)
 		case "2":
-			s.listenMessages(conn, manager, uuid, box, domain, false, logger)
+			s.listenMessages(conn, manager, uuid, box, caller, domain, false, logger)
 		case "5":
 			s.greetingMenu(conn, manager, uuid, box, domain, logger)
+		case "6":
+			if group := s.selectGroupBox(conn, manager, uuid, box, caller); group != nil {
+				logger.WithField("group", group.Extension).Info("Voicemail: switched to group mailbox")
+				box = group
+			}
 		case "*":
 			conn.Execute("playback", "voicemail/vm-goodbye.wav", true)
 			conn.Execute("hangup", "", false)
@@ -327,9 +449,39 @@ func (s *Service) mainMenu(conn *eventsocket.Connection, manager *esl.Manager,
 	}
 }
 
+// selectGroupBox prompts for a group mailbox number and returns it when the
+// caller is a member. A caller in one group (other than the current box)
+// switches to it without a prompt.
+func (s *Service) selectGroupBox(conn *eventsocket.Connection, manager *esl.Manager,
+	uuid string, current *models.VoicemailBox, caller string) *models.VoicemailBox {
+
+	var groups []models.VoicemailBox
+	for _, g := range groupBoxes(manager.DB, current.TenantID, caller) {
+		if g.ID != current.ID {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		conn.Execute("playback", "voicemail/vm-invalid_value.wav", true)
+		return nil
+	}
+	if len(groups) == 1 {
+		return &groups[0]
+	}
+
+	ext := s.collectDigits(conn, uuid, "voicemail/vm-enter_id.wav", 2, 8, 5000)
+	for i := range groups {
+		if groups[i].Extension == ext {
+			return &groups[i]
+		}
+	}
+	conn.Execute("playback", "voicemail/vm-invalid_value.wav", true)
+	return nil
+}
+
 // listenMessages plays messages and provides per-message DTMF controls
 func (s *Service) listenMessages(conn *eventsocket.Connection, manager *esl.Manager,
-	uuid string, box *models.VoicemailBox, domain string, isNew bool, logger *log.Entry) {
+	uuid string, box *models.VoicemailBox, caller, domain string, isNew bool, logger *log.Entry) {
 
 	db := manager.DB
 
@@ -361,10 +513,8 @@ func (s *Service) listenMessages(conn *eventsocket.Connection, manager *esl.Mana
 		conn.Execute("say", fmt.Sprintf("en current_date_time pronounced %d",
 			msg.RecordedAt.Unix()), true)
 
-		// Play message
-		if fileExists(msg.FilePath) {
-			conn.Execute("playback", msg.FilePath, true)
-		}
+		// Play message, after the forwarder's introduction if any
+		s.playMessage(conn, manager, &msg)
 
 		// Per-message DTMF menu
 		// 1 = replay, 2 = save, 7 = delete, 8 = forward, 9 = return call, # = next
@@ -375,46 +525,34 @@ func (s *Service) listenMessages(conn *eventsocket.Connection, manager *esl.Mana
 
 			switch digit {
 			case "1": // Replay
-				if fileExists(msg.FilePath) {
-					conn.Execute("playback", msg.FilePath, true)
-				}
+				s.playMessage(conn, manager, &msg)
 				continue msgMenu
 
 			case "2": // Save
 				msg.MarkAsRead(db)
-				db.Model(&models.VoicemailBox{}).Where("id = ?", box.ID).
-					Updates(map[string]interface{}{
-						"new_messages":   max(0, box.NewMessages-1),
-						"saved_messages": box.SavedMessages + 1,
-					})
+				models.RefreshVoicemailCounts(db, box)
 				conn.Execute("playback", "voicemail/vm-saved.wav", true)
 				// Update MWI
-				s.sendMWI(manager, box.Extension, domain, max(0, box.NewMessages-1), box.SavedMessages+1)
+				s.sendMWI(manager, box)
 				break msgMenu
 
 			case "7": // Delete
 				db.Delete(&msg)
-				if msg.IsNew {
-					db.Model(&models.VoicemailBox{}).Where("id = ?", box.ID).
-						Update("new_messages", max(0, box.NewMessages-1))
-				} else {
-					db.Model(&models.VoicemailBox{}).Where("id = ?", box.ID).
-						Update("saved_messages", max(0, box.SavedMessages-1))
+				models.RefreshVoicemailCounts(db, box)
+				// Remove files (local copy and stored object) unless forwarded
+				// or list copies still play them
+				for _, path := range []string{msg.FilePath, msg.IntroPath} {
+					if path != "" && !models.VoicemailFileInUse(db, path, msg.ID) {
+						manager.Storage.Delete(context.Background(), path)
+					}
 				}
-				// Remove file
-				os.Remove(msg.FilePath)
 				conn.Execute("playback", "voicemail/vm-deleted.wav", true)
 				// Update MWI
-				s.sendMWI(manager, box.Extension, domain, max(0, box.NewMessages-1), box.SavedMessages)
+				s.sendMWI(manager, box)
 				break msgMenu
 
-			case "8": // Forward to another extension
-				conn.Execute("playback", "voicemail/vm-forward_enter_ext.wav", true)
-				fwdExt := s.collectDigits(conn, uuid, "silence_stream://500", 2, 8, 5000)
-				if fwdExt != "" {
-					s.forwardMessage(db, &msg, fwdExt, box.TenantID)
-					conn.Execute("playback", "voicemail/vm-forwarded.wav", true)
-				}
+			case "8": // Forward to one or more extensions or lists
+				s.forwardMenu(conn, manager, uuid, &msg, caller, logger)
 				break msgMenu
 
 			case "9": // Return call
@@ -429,12 +567,8 @@ func (s *Service) listenMessages(conn *eventsocket.Connection, manager *esl.Mana
 			case "#": // Next message
 				if msg.IsNew {
 					msg.MarkAsRead(db)
-					db.Model(&models.VoicemailBox{}).Where("id = ?", box.ID).
-						Updates(map[string]interface{}{
-							"new_messages":   max(0, box.NewMessages-1),
-							"saved_messages": box.SavedMessages + 1,
-						})
-					s.sendMWI(manager, box.Extension, domain, max(0, box.NewMessages-1), box.SavedMessages+1)
+					models.RefreshVoicemailCounts(db, box)
+					s.sendMWI(manager, box)
 				}
 				break msgMenu
 
@@ -509,61 +643,97 @@ func (s *Service) greetingMenu(conn *eventsocket.Connection, manager *esl.Manage
 
 // ========== MWI / BLF ==========
 
-// sendMWI sends a Message Waiting Indicator event to FreeSWITCH
-func (s *Service) sendMWI(manager *esl.Manager, extension, domain string, newMsgs, savedMsgs int) {
-	if manager.Client == nil {
-		return
-	}
+// sendMWI refreshes the MWI lamps for a box: its own extension and, for a
+// group mailbox, every member's
+func (s *Service) sendMWI(manager *esl.Manager, box *models.VoicemailBox) {
+	manager.SendVoicemailMWI(box)
+}
 
-	// FreeSWITCH MWI event format
-	event := fmt.Sprintf(`sendevent MESSAGE_WAITING
-MWI-Messages-Waiting: %s
-MWI-Message-Account: sip:%s@%s
-MWI-Voice-Message: %d/%d (0/0)
+// ========== Message Forwarding ==========
 
-`, boolToYesNo(newMsgs > 0), extension, domain, newMsgs, savedMsgs)
+// forwardMenu collects forward targets (extensions or distribution lists,
+// one per prompt until the caller enters nothing), offers to record an
+// introduction and forwards the message to all of them
+func (s *Service) forwardMenu(conn *eventsocket.Connection, manager *esl.Manager,
+	uuid string, msg *models.VoicemailMessage, caller string, logger *log.Entry) {
+
+	var targets []string
+	for len(targets) < maxForwardTargets {
+		conn.Execute("playback", "voicemail/vm-forward_enter_ext.wav", true)
+		ext := s.collectDigits(conn, uuid, "silence_stream://500", 2, 8, 5000)
+		if ext == "" {
+			break
+		}
+		targets = append(targets, ext)
+	}
+	if len(targets) == 0 {
+		return
+	}
 
-	manager.Client.Send(event)
+	// 1 = record an introduction, anything else forwards the message as is
+	introPath := ""
+	if s.collectDigits(conn, uuid, "voicemail/vm-forward_add_intro.wav", 1, 1, 5000) == "1" {
+		introPath = strings.TrimSuffix(msg.FilePath, filepath.Ext(msg.FilePath)) +
+			fmt.Sprintf("_intro_%d.wav", time.Now().UnixNano())
+		conn.Execute("playback", "voicemail/vm-record_message.wav", true)
+		conn.Execute("playback", "tone_stream://%(200,0,800)", true)
+		conn.Execute("record", fmt.Sprintf("%s 60 100 3", introPath), true)
+		if !fileExists(introPath) {
+			introPath = ""
+		}
+	}
 
-	log.WithFields(log.Fields{
-		"extension": extension,
-		"new":       newMsgs,
-		"saved":     savedMsgs,
-	}).Debug("MWI sent")
+	if n := s.forwardMessage(manager, msg, targets, caller, introPath); n > 0 {
+		logger.Infof("Voicemail forwarded to %d mailboxes", n)
+		conn.Execute("playback", "voicemail/vm-forwarded.wav", true)
+	} else {
+		conn.Execute("playback", "voicemail/vm-invalid_value.wav", true)
+	}
 }
 
-// ========== Message Forwarding ==========
+// forwardMessage copies a voicemail message into the mailboxes of the
+// target extensions and lists, with an optional introduction, and returns
+// the number of copies delivered
+func (s *Service) forwardMessage(manager *esl.Manager, msg *models.VoicemailMessage,
+	targets []string, forwardedBy, introPath string) int {
 
-// forwardMessage copies a voicemail message to another extension's box
-func (s *Service) forwardMessage(gdb *gorm.DB, msg *models.VoicemailMessage, targetExt string, tenantID uint) {
+	db := manager.DB
+	boxes, _ := models.ResolveVoicemailTargets(db, msg.TenantID, targets)
 
-	var targetBox models.VoicemailBox
-	if err := gdb.Where("extension = ? AND tenant_id = ? AND enabled = true",
-		targetExt, tenantID).First(&targetBox).Error; err != nil {
-		return
+	var names []string
+	for i := range boxes {
+		box := &boxes[i]
+		if box.ID == msg.BoxID {
+			continue
+		}
+		if _, err := msg.CopyTo(db, box, forwardedBy, introPath); err != nil {
+			log.WithError(err).Warnf("Voicemail: forward to %s failed", box.Extension)
+			continue
+		}
+		names = append(names, box.Extension)
+		s.sendMWI(manager, box)
 	}
 
-	// Copy message record pointing to same file
-	fwd := &models.VoicemailMessage{
-		BoxID:          targetBox.ID,
-		TenantID:       tenantID,
-		CallerIDName:   msg.CallerIDName,
-		CallerIDNumber: msg.CallerIDNumber,
-		Duration:       msg.Duration,
-		FilePath:       msg.FilePath, // Shared file reference
-		FileSize:       msg.FileSize,
-		RecordedAt:     msg.RecordedAt,
-		IsNew:          true,
-		ForwardedTo:    targetExt,
-		ChannelUUID:    msg.ChannelUUID,
+	if len(names) > 0 {
+		// Update original message
+		db.Model(msg).Update("forwarded_to", strings.Join(names, ","))
+		if introPath != "" {
+			manager.Storage.StoreAsync(models.StorageCategoryVoicemail, msg.TenantID, introPath, "audio/wav")
+		}
+	} else if introPath != "" {
+		os.Remove(introPath)
 	}
-	gdb.Create(fwd)
-
-	// Update target box count
-	gdb.Model(&targetBox).Update("new_messages", targetBox.NewMessages+1)
+	return len(names)
+}
 
-	// Update original message
-	gdb.Model(msg).Update("forwarded_to", targetExt)
+// playMessage plays a message's introduction, if any, then the message
+func (s *Service) playMessage(conn *eventsocket.Connection, manager *esl.Manager, msg *models.VoicemailMessage) {
+	if msg.IntroPath != "" && s.localize(manager, msg.IntroPath) {
+		conn.Execute("playback", msg.IntroPath, true)
+	}
+	if s.localize(manager, msg.FilePath) {
+		conn.Execute("playback", msg.FilePath, true)
+	}
 }
 
 // ========== DTMF Helpers ==========
@@ -601,22 +771,36 @@ func (s *Service) getGreetingPath(tenantID uint, extension string) string {
 	return filepath.Join(s.recordingDir, fmt.Sprintf("%d", tenantID), extension, "greeting.wav")
 }
 
+// localize makes sure a message file is on local disk for playback,
+// fetching it back from object storage if it was evicted
+func (s *Service) localize(manager *esl.Manager, path string) bool {
+	if _, err := manager.Storage.Localize(context.Background(), path); err != nil {
+		log.WithField("path", path).Warnf("Voicemail file unavailable: %v", err)
+		return false
+	}
+	return true
+}
+
 // fileExists checks if a file exists
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-func boolToYesNo(b bool) string {
-	if b {
-		return "yes"
+// tenantForDomain resolves the tenant a call belongs to from its domain
+func tenantForDomain(db *gorm.DB, domain string) uint {
+	var tenant models.Tenant
+	if err := db.Select("id").Where("domain = ?", domain).First(&tenant).Error; err != nil {
+		return 0
 	}
-	return "no"
+	return tenant.ID
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
+// groupBoxes returns the enabled group mailboxes an extension belongs to
+func groupBoxes(db *gorm.DB, tenantID uint, extension string) []models.VoicemailBox {
+	var boxes []models.VoicemailBox
+	db.Where("tenant_id = ? AND enabled = ? AND id IN (?)", tenantID, true,
+		db.Model(&models.VoicemailBoxMember{}).Select("box_id").Where("tenant_id = ? AND extension = ?", tenantID, extension)).
+		Order("extension ASC").Find(&boxes)
+	return boxes
 }
@@ -0,0 +1,90 @@
+// Package wakeup implements the ESL module that runs answered hospitality
+// wake-up calls: the wake-up message with press-1-to-snooze, and the front
+// desk notice when a room never answered.
+package wakeup
+
+import (
+	"callsign/services/esl"
+	"fmt"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ServiceName    = "wakeup"
+	ServiceAddress = "127.0.0.9:9001"
+
+	// SnoozeDigit is the key a guest presses to snooze the wake-up call
+	SnoozeDigit = "1"
+	// ResultVariable is set to ResultSnoozed on the channel when the guest
+	// snoozes; the scheduler reads it from the hangup event
+	ResultVariable = "wakeup_result"
+	ResultSnoozed  = "snoozed"
+)
+
+// Service implements the wake-up call ESL module
+type Service struct {
+	*esl.BaseService
+}
+
+// New creates a new wake-up call service
+func New() *Service {
+	return &Service{
+		BaseService: esl.NewBaseService(ServiceName, ServiceAddress),
+	}
+}
+
+// Init initializes the wake-up call service
+func (s *Service) Init(manager *esl.Manager) error {
+	if err := s.BaseService.Init(manager); err != nil {
+		return err
+	}
+	log.Info("Wake-up call service initialized")
+	return nil
+}
+
+// Handle runs an answered wake-up call. The originate sets wakeup_audio for
+// guest calls, or wakeup_escalation_room for front desk notices.
+func (s *Service) Handle(conn *eventsocket.Connection) {
+	defer conn.Close()
+
+	ev, err := conn.Send("connect")
+	if err != nil {
+		log.Errorf("Wakeup: connect failed: %v", err)
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		"uuid":    ev.Get("Unique-ID"),
+		"room_id": ev.Get("variable_hotel_room_id"),
+	})
+
+	conn.Send("linger")
+	conn.Send("myevents")
+
+	if room := ev.Get("variable_wakeup_escalation_room"); room != "" {
+		// Front desk notice: read the room number out a few times
+		logger.Infof("Wakeup: notifying front desk about room %s", room)
+		conn.Execute("sleep", "500", true)
+		for i := 0; i < 3; i++ {
+			conn.Execute("say", fmt.Sprintf("en name_spelled iterated %s", room), true)
+			conn.Execute("sleep", "1000", true)
+		}
+		conn.Execute("hangup", "NORMAL_CLEARING", false)
+		return
+	}
+
+	audio := ev.Get("variable_wakeup_audio")
+	result, err := conn.Execute("play_and_get_digits", fmt.Sprintf(
+		"1 1 2 5000 # %s silence_stream://250 wakeup_digit \\d 3000",
+		audio,
+	), true)
+	if err == nil && result.Get("variable_wakeup_digit") == SnoozeDigit {
+		logger.Info("Wakeup: guest snoozed")
+		conn.Execute("set", ResultVariable+"="+ResultSnoozed, true)
+		conn.Execute("playback", "ivr/ivr-thank_you.wav", true)
+	}
+
+	conn.Execute("hangup", "NORMAL_CLEARING", false)
+}
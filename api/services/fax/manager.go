@@ -28,6 +28,7 @@ import (
 	"callsign/models"
 	"callsign/services/fax/gofaxlib"
 	"callsign/services/logging"
+	"callsign/services/storage"
 	"context"
 
 	"github.com/fiorix/go-eventsocket/eventsocket"
@@ -110,6 +111,9 @@ type Manager struct {
 
 	// Upstream gateways
 	UpstreamGateways []string
+
+	// Object storage for fax documents (nil = local disk only)
+	Storage *storage.Manager
 }
 
 // NewManager creates a new fax Manager
@@ -477,8 +481,13 @@ func (m *Manager) processFaxJob(job *FaxJobInternal) {
 		}
 	}
 
-	// Trigger notifications for completed fax
-	go m.sendNotifications(job)
+	// Send notifications for the completed fax, then hand the documents to
+	// object storage; storing after notifying keeps the local files around
+	// while they are still being attached
+	go func() {
+		m.sendNotifications(job)
+		m.storeDocuments(job)
+	}()
 
 	m.QueueResults <- job
 }
@@ -635,6 +644,7 @@ func (m *Manager) sendFaxToWebhook(webhookURL, faxFilePath string, job *FaxJobIn
 	var faxData []byte
 	var readErr error
 	if faxFilePath != "" {
+		m.Storage.Localize(context.Background(), faxFilePath)
 		faxData, readErr = os.ReadFile(faxFilePath)
 		if readErr != nil {
 			return fmt.Errorf("failed to read fax file %s: %w", faxFilePath, readErr)
@@ -857,6 +867,7 @@ func (m *Manager) sendFaxEmail(cfg *tenantSMTPConfig, to, subject, body, attachm
 	var attachData []byte
 	var attachErr error
 	if attachmentPath != "" {
+		m.Storage.Localize(context.Background(), attachmentPath)
 		attachData, attachErr = os.ReadFile(attachmentPath)
 		if attachErr != nil {
 			m.LogManager.Warn("FAX.QUEUE", fmt.Sprintf("Could not read fax attachment: %s", attachmentPath), nil)
@@ -1023,6 +1034,28 @@ func (m *Manager) retryWithBackoff(ctx context.Context, maxAttempts int, base, m
 
 // --- Persistence helpers ---
 
+// storeDocuments uploads the job's TIFF and PDF to object storage
+func (m *Manager) storeDocuments(job *FaxJobInternal) {
+	var dbJob models.FaxJob
+	if err := m.DB.First(&dbJob, job.DBJobID).Error; err != nil {
+		return
+	}
+
+	for path, contentType := range map[string]string{
+		dbJob.FileName:    "image/tiff",
+		dbJob.PDFFileName: "application/pdf",
+	} {
+		if path == "" {
+			continue
+		}
+		if _, err := m.Storage.Store(context.Background(), models.StorageCategoryFax, dbJob.TenantID, path, contentType); err != nil {
+			m.LogManager.Warn("FAX.STORAGE", fmt.Sprintf("Failed to store fax document %s: %v", path, err), map[string]interface{}{
+				"uuid": job.UUID.String(),
+			})
+		}
+	}
+}
+
 func (m *Manager) persistJobStatus(job *FaxJobInternal) {
 	updates := map[string]interface{}{
 		"status":   job.Status,
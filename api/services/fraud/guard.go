@@ -0,0 +1,316 @@
+// Package fraud guards tenants against toll fraud on compromised SIP
+// credentials. After each carrier call it totals the tenant's international
+// spend and minutes over its policy window; a breach blocks outbound calling
+// (or only alerts, per policy) and notifies the tenant admins by email and
+// WebSocket.
+package fraud
+
+import (
+	"callsign/models"
+	"callsign/services/email"
+	"callsign/services/websocket"
+	"callsign/services/xmlcache"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Usage totals a tenant's international carrier calls in a policy window
+type Usage struct {
+	WindowMinutes int       `json:"window_minutes"`
+	Since         time.Time `json:"since"`
+	Calls         int       `json:"calls"`
+	Minutes       float64   `json:"minutes"`
+	Spend         float64   `json:"spend"`
+}
+
+// Guard evaluates fraud policies and applies outbound blocks
+type Guard struct {
+	db    *gorm.DB
+	cache *xmlcache.XMLCache
+	hub   *websocket.Hub
+	email *email.Service
+
+	// Serialises checks so concurrent CDRs breach, block and alert once
+	mu sync.Mutex
+}
+
+// NewGuard creates a guard. The cache is the dialplan cache that must drop
+// a tenant's outbound routes when its block state changes.
+func NewGuard(db *gorm.DB, cache *xmlcache.XMLCache, hub *websocket.Hub) *Guard {
+	return &Guard{db: db, cache: cache, hub: hub}
+}
+
+// SetEmailService sets the service used for alert emails
+func (g *Guard) SetEmailService(svc *email.Service) {
+	g.email = svc
+}
+
+// PolicyFor returns the tenant's policy, else the system default, else nil
+func PolicyFor(db *gorm.DB, tenantID uint) (*models.FraudPolicy, error) {
+	var policies []models.FraudPolicy
+	if err := db.Where("tenant_id = ? OR tenant_id IS NULL", tenantID).Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("fraud: policy for tenant %d: %w", tenantID, err)
+	}
+	var policy *models.FraudPolicy
+	for i := range policies {
+		if policy == nil || policies[i].TenantID != nil {
+			policy = &policies[i]
+		}
+	}
+	return policy, nil
+}
+
+// WindowUsage totals the tenant's international carrier calls that started
+// in the policy window ending at now
+func WindowUsage(db *gorm.DB, tenantID uint, policy *models.FraudPolicy, now time.Time) (*Usage, error) {
+	window := max(policy.WindowMinutes, 1)
+	usage := &Usage{WindowMinutes: window, Since: now.Add(-time.Duration(window) * time.Minute)}
+
+	var calls []struct {
+		DestinationNumber string
+		BillableSec       int
+		Cost              float64
+	}
+	err := db.Model(&models.CallRecord{}).
+		Select("destination_number, billable_sec, cost").
+		Where("tenant_id = ? AND gateway_name <> '' AND start_time >= ?", tenantID, usage.Since).
+		Scan(&calls).Error
+	if err != nil {
+		return nil, fmt.Errorf("fraud: usage for tenant %d: %w", tenantID, err)
+	}
+
+	seconds := 0
+	for _, call := range calls {
+		if !IsInternational(call.DestinationNumber, policy.HomeCountryCode) {
+			continue
+		}
+		usage.Calls++
+		seconds += call.BillableSec
+		usage.Spend += call.Cost
+	}
+	usage.Minutes = math.Round(float64(seconds)/60*100) / 100
+	usage.Spend = math.Round(usage.Spend*10000) / 10000
+	return usage, nil
+}
+
+// IsInternational reports whether a dialed number is in international
+// format (+, 011 or 00) for a country other than homeCountryCode
+func IsInternational(number, homeCountryCode string) bool {
+	number = strings.TrimSpace(number)
+	plus := strings.HasPrefix(number, "+")
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	switch {
+	case plus:
+	case strings.HasPrefix(digits, "011"):
+		digits = digits[3:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	default:
+		return false
+	}
+	return digits != "" && (homeCountryCode == "" || !strings.HasPrefix(digits, homeCountryCode))
+}
+
+// Breach describes the thresholds usage exceeds, or returns "" when within
+// policy
+func Breach(policy *models.FraudPolicy, usage *Usage) string {
+	var reasons []string
+	if policy.MaxSpend > 0 && usage.Spend > policy.MaxSpend {
+		reasons = append(reasons, fmt.Sprintf("international spend %.2f exceeds %.2f", usage.Spend, policy.MaxSpend))
+	}
+	if policy.MaxMinutes > 0 && usage.Minutes > float64(policy.MaxMinutes) {
+		reasons = append(reasons, fmt.Sprintf("international minutes %.1f exceed %d", usage.Minutes, policy.MaxMinutes))
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s in the last %d minutes (%d calls)",
+		strings.Join(reasons, " and "), usage.WindowMinutes, usage.Calls)
+}
+
+// Check evaluates the tenant's policy after one of its carrier calls and
+// acts on a breach. Tenants already blocked are skipped.
+func (g *Guard) Check(tenantID uint) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var tenant models.Tenant
+	if err := g.db.Limit(1).Find(&tenant, tenantID).Error; err != nil {
+		return fmt.Errorf("fraud: tenant %d: %w", tenantID, err)
+	}
+	if tenant.ID == 0 || tenant.OutboundBlocked {
+		return nil
+	}
+	policy, err := PolicyFor(g.db, tenantID)
+	if err != nil || policy == nil || !policy.Enabled {
+		return err
+	}
+	usage, err := WindowUsage(g.db, tenantID, policy, time.Now())
+	if err != nil {
+		return err
+	}
+	reason := Breach(policy, usage)
+	if reason == "" {
+		return nil
+	}
+
+	if policy.AutoBlock {
+		return g.block(&tenant, reason, policy, usage, nil)
+	}
+
+	// Alert-only policies alert once per window
+	var recent int64
+	g.db.Model(&models.FraudEvent{}).
+		Where("tenant_id = ? AND type = ? AND created_at >= ?", tenantID, models.FraudEventThreshold, usage.Since).
+		Count(&recent)
+	if recent > 0 {
+		return nil
+	}
+	event := newEvent(tenantID, models.FraudEventThreshold, reason, policy, usage, nil)
+	if err := g.db.Create(event).Error; err != nil {
+		return fmt.Errorf("fraud: record event: %w", err)
+	}
+	log.WithField("tenant_id", tenantID).Warnf("Fraud: threshold exceeded: %s", reason)
+	g.alert(&tenant, event, policy, false)
+	return nil
+}
+
+// Block stops the tenant's outbound calling by hand. userID is the admin
+// applying it.
+func (g *Guard) Block(tenant *models.Tenant, reason string, userID *uint) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	policy, err := PolicyFor(g.db, tenant.ID)
+	if err != nil {
+		return err
+	}
+	return g.block(tenant, reason, policy, nil, userID)
+}
+
+func (g *Guard) block(tenant *models.Tenant, reason string, policy *models.FraudPolicy, usage *Usage, userID *uint) error {
+	now := time.Now()
+	event := newEvent(tenant.ID, models.FraudEventBlocked, reason, policy, usage, userID)
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(tenant).Updates(map[string]interface{}{
+			"outbound_blocked":      true,
+			"outbound_blocked_at":   now,
+			"outbound_block_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return fmt.Errorf("fraud: block tenant %d: %w", tenant.ID, err)
+	}
+	tenant.OutboundBlocked, tenant.OutboundBlockedAt, tenant.OutboundBlockReason = true, &now, reason
+	g.invalidate(tenant.Domain)
+
+	log.WithField("tenant_id", tenant.ID).Warnf("Fraud: outbound calling blocked: %s", reason)
+	g.alert(tenant, event, policy, true)
+	return nil
+}
+
+// Unblock re-enables the tenant's outbound calling
+func (g *Guard) Unblock(tenant *models.Tenant, note string, userID *uint) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	event := &models.FraudEvent{TenantID: tenant.ID, Type: models.FraudEventUnblocked, Reason: note, UserID: userID}
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(tenant).Updates(map[string]interface{}{
+			"outbound_blocked":      false,
+			"outbound_blocked_at":   nil,
+			"outbound_block_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return fmt.Errorf("fraud: unblock tenant %d: %w", tenant.ID, err)
+	}
+	tenant.OutboundBlocked, tenant.OutboundBlockedAt, tenant.OutboundBlockReason = false, nil, ""
+	g.invalidate(tenant.Domain)
+
+	if g.hub != nil {
+		g.hub.BroadcastToTenant(tenant.ID, websocket.EventNotification, "outbound_unblocked", map[string]interface{}{
+			"event_id": event.ID,
+		})
+	}
+	log.WithField("tenant_id", tenant.ID).Info("Fraud: outbound calling unblocked")
+	return nil
+}
+
+// invalidate drops the cached dialplans that carry the tenant's outbound
+// routes, so the next call picks up the block state
+func (g *Guard) invalidate(domain string) {
+	if g.cache == nil {
+		return
+	}
+	g.cache.DeleteByPrefix(xmlcache.DialplanKey(domain))
+	g.cache.Delete(xmlcache.DialplanKey("default"))
+}
+
+// alert notifies the tenant's admins and the policy's extra recipients
+func (g *Guard) alert(tenant *models.Tenant, event *models.FraudEvent, policy *models.FraudPolicy, blocked bool) {
+	if g.hub != nil {
+		g.hub.BroadcastToTenant(tenant.ID, websocket.EventNotification, "fraud_alert", map[string]interface{}{
+			"event_id": event.ID,
+			"type":     event.Type,
+			"reason":   event.Reason,
+			"blocked":  blocked,
+			"calls":    event.Calls,
+			"minutes":  event.Minutes,
+			"spend":    event.Spend,
+		})
+	}
+
+	if g.email == nil || !g.email.IsEnabled() {
+		return
+	}
+	var recipients []string
+	g.db.Model(&models.User{}).
+		Where("tenant_id = ? AND role = ? AND email <> ''", tenant.ID, models.RoleTenantAdmin).
+		Pluck("email", &recipients)
+	if policy != nil {
+		recipients = append(recipients, policy.AlertRecipients()...)
+	}
+	seen := make(map[string]bool)
+	for _, to := range recipients {
+		if seen[strings.ToLower(to)] {
+			continue
+		}
+		seen[strings.ToLower(to)] = true
+		if err := g.email.SendFraudAlert(to, tenant.Name, event.Reason, blocked); err != nil {
+			log.WithError(err).WithField("tenant_id", tenant.ID).Warn("Fraud: alert email failed")
+		}
+	}
+}
+
+func newEvent(tenantID uint, eventType, reason string, policy *models.FraudPolicy, usage *Usage, userID *uint) *models.FraudEvent {
+	event := &models.FraudEvent{TenantID: tenantID, Type: eventType, Reason: reason, UserID: userID}
+	if usage != nil {
+		event.WindowMinutes = usage.WindowMinutes
+		event.Calls = usage.Calls
+		event.Minutes = usage.Minutes
+		event.Spend = usage.Spend
+	}
+	if policy != nil && usage != nil {
+		event.MaxMinutes = policy.MaxMinutes
+		event.MaxSpend = policy.MaxSpend
+	}
+	return event
+}
@@ -0,0 +1,106 @@
+package fraud_test
+
+import (
+	"callsign/models"
+	"callsign/services/fraud"
+	"callsign/services/xmlcache"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Tenant{}, &models.TenantProfile{}, &models.User{},
+		&models.CallRecord{}, &models.FraudPolicy{}, &models.FraudEvent{}))
+	return db
+}
+
+func TestIsInternational(t *testing.T) {
+	assert.True(t, fraud.IsInternational("+44 20 7946 0000", "1"))
+	assert.True(t, fraud.IsInternational("011441619460000", "1"))
+	assert.True(t, fraud.IsInternational("0033123456789", "44"))
+	assert.False(t, fraud.IsInternational("+1 415 555 0100", "1"))
+	assert.False(t, fraud.IsInternational("4155550100", "1"))
+	assert.False(t, fraud.IsInternational("1002", "1"))
+}
+
+func TestCheckBlocksOnBreach(t *testing.T) {
+	db := setupDB(t)
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.example.com"}
+	require.NoError(t, db.Create(&tenant).Error)
+	require.NoError(t, db.Create(&models.FraudPolicy{Enabled: true, WindowMinutes: 60,
+		MaxMinutes: 10, HomeCountryCode: "1", AutoBlock: true}).Error)
+
+	cache := xmlcache.New()
+	cache.Set(xmlcache.DialplanKey(tenant.Domain), "<cached/>", time.Hour)
+	guard := fraud.NewGuard(db, cache, nil)
+
+	now := time.Now()
+	call := func(dest string, sec int) {
+		require.NoError(t, db.Create(&models.CallRecord{TenantID: tenant.ID, GatewayName: "carrier1",
+			DestinationNumber: dest, BillableSec: sec, StartTime: now.Add(-time.Minute)}).Error)
+	}
+
+	// Domestic minutes don't count toward the international cap
+	call("+14155550100", 3600)
+	call("+442079460000", 300)
+	require.NoError(t, guard.Check(tenant.ID))
+	require.NoError(t, db.First(&tenant, tenant.ID).Error)
+	assert.False(t, tenant.OutboundBlocked)
+
+	call("+8821612345", 400)
+	require.NoError(t, guard.Check(tenant.ID))
+	require.NoError(t, db.First(&tenant, tenant.ID).Error)
+	assert.True(t, tenant.OutboundBlocked)
+	assert.Contains(t, tenant.OutboundBlockReason, "international minutes 11.7 exceed 10")
+	_, cached := cache.Get(xmlcache.DialplanKey(tenant.Domain))
+	assert.False(t, cached)
+
+	var events []models.FraudEvent
+	require.NoError(t, db.Where("tenant_id = ?", tenant.ID).Find(&events).Error)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.FraudEventBlocked, events[0].Type)
+	assert.Equal(t, 2, events[0].Calls)
+
+	// A blocked tenant isn't re-evaluated; unblocking restores calling
+	require.NoError(t, guard.Check(tenant.ID))
+	require.NoError(t, guard.Unblock(&tenant, "credentials rotated", nil))
+	require.NoError(t, db.First(&tenant, tenant.ID).Error)
+	assert.False(t, tenant.OutboundBlocked)
+	db.Model(&models.FraudEvent{}).Where("tenant_id = ?", tenant.ID).Find(&events)
+	assert.Len(t, events, 2)
+}
+
+func TestCheckAlertOnlyPolicy(t *testing.T) {
+	db := setupDB(t)
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.example.com"}
+	require.NoError(t, db.Create(&tenant).Error)
+
+	// The tenant's own policy overrides the system default
+	require.NoError(t, db.Create(&models.FraudPolicy{Enabled: true, WindowMinutes: 60, MaxSpend: 100}).Error)
+	policy := models.FraudPolicy{TenantID: &tenant.ID, Enabled: true, WindowMinutes: 30, MaxSpend: 5, HomeCountryCode: "1"}
+	require.NoError(t, db.Create(&policy).Error)
+	require.NoError(t, db.Model(&policy).Update("auto_block", false).Error)
+
+	require.NoError(t, db.Create(&models.CallRecord{TenantID: tenant.ID, GatewayName: "carrier1",
+		DestinationNumber: "0114420794600", BillableSec: 600, Cost: 6.5, StartTime: time.Now()}).Error)
+
+	guard := fraud.NewGuard(db, nil, nil)
+	require.NoError(t, guard.Check(tenant.ID))
+	require.NoError(t, guard.Check(tenant.ID)) // alerts once per window
+
+	require.NoError(t, db.First(&tenant, tenant.ID).Error)
+	assert.False(t, tenant.OutboundBlocked)
+	var events []models.FraudEvent
+	require.NoError(t, db.Where("tenant_id = ?", tenant.ID).Find(&events).Error)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.FraudEventThreshold, events[0].Type)
+	assert.InDelta(t, 6.5, events[0].Spend, 0.0001)
+	assert.InDelta(t, 5, events[0].MaxSpend, 0.0001)
+}
@@ -0,0 +1,294 @@
+package hospitality
+
+import (
+	"callsign/models"
+	"callsign/services/esl"
+	"callsign/services/storage"
+	"callsign/services/xmlcache"
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Guest is the occupant details supplied at check-in
+type Guest struct {
+	Name      string
+	CIDName   string // caller ID name override, defaults to Name
+	CIDNumber string
+}
+
+// StayOptions control the side effects of check-in and check-out
+type StayOptions struct {
+	UpdateCallerID bool // show the guest name as the room extension's caller ID
+	PurgeVoicemail bool // delete the room's voicemail on check-out
+}
+
+// DefaultStayOptions are used for check-ins and check-outs made in the portal
+var DefaultStayOptions = StayOptions{UpdateCallerID: true, PurgeVoicemail: true}
+
+// StayService applies guest check-in, check-out and room moves to a room and
+// its phone: caller ID name, voicemail and the room history. It is shared by
+// the REST handlers and the PMS connector.
+type StayService struct {
+	db      *gorm.DB
+	storage *storage.Manager
+	esl     *esl.Manager
+	cache   *xmlcache.XMLCache
+}
+
+// NewStayService creates a stay service. storage, eslManager and cache may be nil.
+func NewStayService(db *gorm.DB, store *storage.Manager, eslManager *esl.Manager, cache *xmlcache.XMLCache) *StayService {
+	return &StayService{db: db, storage: store, esl: eslManager, cache: cache}
+}
+
+// CheckIn marks the room occupied by the guest
+func (s *StayService) CheckIn(room *models.HotelRoom, guest Guest, opts StayOptions) error {
+	now := time.Now()
+	room.Status = "occupied"
+	room.GuestName = guest.Name
+	room.CheckInTime = &now
+	room.CheckOutTime = nil
+	room.CIDName = guest.CIDName
+	room.CIDNumber = guest.CIDNumber
+	room.DNDEnabled = false
+	room.SetWakeup(nil)
+
+	if err := s.db.Save(room).Error; err != nil {
+		return err
+	}
+	if opts.UpdateCallerID {
+		name := guest.CIDName
+		if name == "" {
+			name = guest.Name
+		}
+		s.setCallerIDName(room, name)
+	}
+	s.logEvent(room, models.HotelRoomEvent{Event: models.RoomEventCheckIn})
+	return nil
+}
+
+// CheckOut marks the room vacant and clears the guest's state
+func (s *StayService) CheckOut(room *models.HotelRoom, opts StayOptions) error {
+	return s.checkOut(room, opts, "")
+}
+
+func (s *StayService) checkOut(room *models.HotelRoom, opts StayOptions, detail string) error {
+	guestName := room.GuestName
+	now := time.Now()
+	room.Status = "vacant"
+	room.GuestName = ""
+	room.CheckOutTime = &now
+	room.CIDName = ""
+	room.CIDNumber = ""
+	room.DNDEnabled = false
+	room.SetWakeup(nil)
+
+	if err := s.db.Save(room).Error; err != nil {
+		return err
+	}
+	if opts.UpdateCallerID {
+		s.setCallerIDName(room, "Room "+room.RoomNumber)
+	}
+	if opts.PurgeVoicemail {
+		if n := s.purgeVoicemail(room); n > 0 {
+			detail = joinDetail(detail, fmt.Sprintf("%d voicemail messages purged", n))
+		}
+	}
+	s.logEvent(room, models.HotelRoomEvent{Event: models.RoomEventCheckOut, GuestName: guestName, Detail: detail})
+	return nil
+}
+
+// Move transfers the guest in from to the vacant room to, carrying over the
+// wake-up call, DND and voicemail.
+func (s *StayService) Move(from, to *models.HotelRoom, opts StayOptions) error {
+	if to.Status == "occupied" && to.ID != from.ID {
+		return fmt.Errorf("room %s is occupied", to.RoomNumber)
+	}
+
+	moved := *from
+	now := time.Now()
+	to.Status = "occupied"
+	to.GuestName = moved.GuestName
+	to.CheckInTime = moved.CheckInTime
+	if to.CheckInTime == nil {
+		to.CheckInTime = &now
+	}
+	to.CheckOutTime = nil
+	to.CIDName = moved.CIDName
+	to.CIDNumber = moved.CIDNumber
+	to.DNDEnabled = moved.DNDEnabled
+	to.WakeupEnabled = moved.WakeupEnabled
+	to.WakeupTime = moved.WakeupTime
+	to.WakeupNextAttemptAt = moved.WakeupNextAttemptAt
+	if moved.WakeupClaimedAt != nil {
+		// The call in progress went to the old room; ring the new one instead
+		to.WakeupNextAttemptAt = &now
+	}
+	to.WakeupClaimedAt = nil
+	to.WakeupAttempts = moved.WakeupAttempts
+	to.WakeupAudio = moved.WakeupAudio
+	if err := s.db.Save(to).Error; err != nil {
+		return err
+	}
+
+	// Voicemail follows the guest; the old room is then checked out normally
+	s.moveVoicemail(from, to)
+	if err := s.checkOut(from, StayOptions{UpdateCallerID: opts.UpdateCallerID}, "moved to room "+to.RoomNumber); err != nil {
+		return err
+	}
+
+	if opts.UpdateCallerID {
+		name := moved.CIDName
+		if name == "" {
+			name = moved.GuestName
+		}
+		s.setCallerIDName(to, name)
+	}
+	s.logEvent(to, models.HotelRoomEvent{Event: models.RoomEventCheckIn, Detail: "moved from room " + from.RoomNumber})
+	return nil
+}
+
+// Rename changes the name of the guest staying in the room
+func (s *StayService) Rename(room *models.HotelRoom, name string, opts StayOptions) error {
+	room.GuestName = name
+	if err := s.db.Model(room).Update("guest_name", name).Error; err != nil {
+		return err
+	}
+	if opts.UpdateCallerID && room.CIDName == "" {
+		s.setCallerIDName(room, name)
+	}
+	return nil
+}
+
+// SetDND turns do-not-disturb on or off for the room and its extension
+func (s *StayService) SetDND(room *models.HotelRoom, enabled bool) error {
+	room.DNDEnabled = enabled
+	if err := s.db.Model(room).Update("dnd_enabled", enabled).Error; err != nil {
+		return err
+	}
+	if ext, ok := s.roomExtension(room); ok && ext.DoNotDisturb != enabled {
+		s.db.Model(ext).Update("do_not_disturb", enabled)
+		if s.cache != nil {
+			s.cache.Flush()
+		}
+	}
+	return nil
+}
+
+// roomExtension returns the phone extension serving the room
+func (s *StayService) roomExtension(room *models.HotelRoom) (*models.Extension, bool) {
+	var ext models.Extension
+	query := s.db.Where("tenant_id = ?", room.TenantID)
+	if room.ExtensionID != nil {
+		query = query.Where("id = ?", *room.ExtensionID)
+	} else if room.Extension != "" {
+		query = query.Where("extension = ?", room.Extension)
+	} else {
+		return nil, false
+	}
+	if err := query.First(&ext).Error; err != nil {
+		return nil, false
+	}
+	return &ext, true
+}
+
+// setCallerIDName updates the room extension's internal caller ID name
+func (s *StayService) setCallerIDName(room *models.HotelRoom, name string) {
+	ext, ok := s.roomExtension(room)
+	if !ok || ext.EffectiveCallerIDName == name {
+		return
+	}
+	if err := s.db.Model(ext).Update("effective_caller_id_name", name).Error; err != nil {
+		log.WithField("room_id", room.ID).Warnf("Failed to update room caller ID: %v", err)
+		return
+	}
+	if s.cache != nil {
+		s.cache.Flush()
+	}
+}
+
+// roomMailboxes returns the voicemail boxes of the room extension
+func (s *StayService) roomMailboxes(room *models.HotelRoom) []models.VoicemailBox {
+	ext, ok := s.roomExtension(room)
+	if !ok {
+		return nil
+	}
+	var boxes []models.VoicemailBox
+	s.db.Where("tenant_id = ? AND (extension_id = ? OR extension = ?)", room.TenantID, ext.ID, ext.Extension).
+		Find(&boxes)
+	return boxes
+}
+
+// purgeVoicemail deletes every message left for the room and returns the count
+func (s *StayService) purgeVoicemail(room *models.HotelRoom) int {
+	purged := 0
+	for _, box := range s.roomMailboxes(room) {
+		var messages []models.VoicemailMessage
+		s.db.Where("box_id = ?", box.ID).Find(&messages)
+		for _, msg := range messages {
+			if err := s.db.Delete(&msg).Error; err != nil {
+				log.WithField("room_id", room.ID).Warnf("Failed to delete voicemail message: %v", err)
+				continue
+			}
+			purged++
+			// Group members and list copies may still play the audio
+			for _, path := range []string{msg.FilePath, msg.IntroPath} {
+				if path != "" && !models.VoicemailFileInUse(s.db, path, msg.ID) {
+					if err := s.storage.Delete(context.Background(), path); err != nil {
+						log.WithField("room_id", room.ID).Warnf("Failed to delete voicemail file: %v", err)
+					}
+				}
+			}
+		}
+		s.db.Model(&box).Updates(map[string]interface{}{"new_messages": 0, "saved_messages": 0})
+		s.sendMWI(&box, 0, 0)
+	}
+	return purged
+}
+
+// moveVoicemail re-homes the messages of the old room's mailbox to the new room
+func (s *StayService) moveVoicemail(from, to *models.HotelRoom) {
+	fromBoxes := s.roomMailboxes(from)
+	toBoxes := s.roomMailboxes(to)
+	if len(fromBoxes) == 0 || len(toBoxes) == 0 {
+		return
+	}
+	dest := toBoxes[0]
+	for _, box := range fromBoxes {
+		s.db.Model(&models.VoicemailMessage{}).Where("box_id = ?", box.ID).Update("box_id", dest.ID)
+		s.db.Model(&box).Updates(map[string]interface{}{"new_messages": 0, "saved_messages": 0})
+		s.sendMWI(&box, 0, 0)
+	}
+
+	var newCount, savedCount int64
+	s.db.Model(&models.VoicemailMessage{}).Where("box_id = ? AND is_new = ?", dest.ID, true).Count(&newCount)
+	s.db.Model(&models.VoicemailMessage{}).Where("box_id = ? AND is_new = ?", dest.ID, false).Count(&savedCount)
+	s.db.Model(&dest).Updates(map[string]interface{}{"new_messages": newCount, "saved_messages": savedCount})
+	s.sendMWI(&dest, int(newCount), int(savedCount))
+}
+
+func (s *StayService) sendMWI(box *models.VoicemailBox, newMsgs, savedMsgs int) {
+	if s.esl == nil {
+		return
+	}
+	var tenant models.Tenant
+	if err := s.db.First(&tenant, box.TenantID).Error; err == nil {
+		s.esl.SendMWI(box.Extension, tenant.Domain, newMsgs, savedMsgs)
+	}
+}
+
+func (s *StayService) logEvent(room *models.HotelRoom, event models.HotelRoomEvent) {
+	if err := models.LogRoomEvent(s.db, room, event); err != nil {
+		log.WithField("room_id", room.ID).Warnf("Failed to log room event: %v", err)
+	}
+}
+
+func joinDetail(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "; " + b
+}
@@ -0,0 +1,346 @@
+// Package hospitality provides the hotel wake-up call scheduler.
+package hospitality
+
+import (
+	"callsign/models"
+	"callsign/services/esl"
+	wakeupmod "callsign/services/esl/modules/wakeup"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// ringTimeout is how long a room phone rings before the attempt counts as unanswered
+	ringTimeout = 45
+	// maxLateness skips wake-up calls that fell due too long ago (e.g. while
+	// the server was down) and escalates them instead of waking the guest late
+	maxLateness = time.Hour
+	// maxCallDuration bounds how long to wait for a hangup event after answer
+	maxCallDuration = 5 * time.Minute
+)
+
+// callResult is the outcome of one wake-up call, delivered by the hangup event
+type callResult struct {
+	cause    string
+	answered bool
+	snoozed  bool
+}
+
+// WakeupScheduler dials hotel rooms whose wake-up time has passed. All state
+// lives on the HotelRoom row, so scheduled calls survive restarts of both the
+// API and FreeSWITCH. Unanswered calls are retried, guests can snooze by
+// pressing 1, and rooms that never answer are escalated to the front desk.
+// Every attempt is written to the room history.
+type WakeupScheduler struct {
+	db  *gorm.DB
+	esl *esl.Manager
+
+	// Calls waiting for their CHANNEL_HANGUP_COMPLETE, keyed by channel UUID
+	pending   map[string]chan callResult
+	pendingMu sync.Mutex
+
+	listeners []EventListener
+}
+
+// EventListener is notified of every wake-up event the scheduler logs
+type EventListener func(room *models.HotelRoom, event models.HotelRoomEvent)
+
+// NewWakeupScheduler creates a new wake-up call scheduler.
+func NewWakeupScheduler(db *gorm.DB, eslManager *esl.Manager) *WakeupScheduler {
+	return &WakeupScheduler{
+		db:      db,
+		esl:     eslManager,
+		pending: make(map[string]chan callResult),
+	}
+}
+
+// OnEvent registers a listener for wake-up outcomes (e.g. to report them to
+// a PMS). Listeners must be registered before Start.
+func (s *WakeupScheduler) OnEvent(fn EventListener) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// Start registers for call results and polls for due wake-up calls.
+func (s *WakeupScheduler) Start(interval time.Duration) {
+	if s.esl != nil {
+		s.esl.On("CHANNEL_HANGUP_COMPLETE", s.handleHangup)
+	}
+
+	s.recoverSchedule()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.poll()
+		}
+	}()
+	log.Infof("Wake-up call scheduler started (interval: %s)", interval)
+}
+
+// recoverSchedule restores the next attempt of rooms the scheduler isn't
+// tracking: calls in flight when the server stopped never reported back and
+// are redialed as of when they were claimed, and wake-ups set before the
+// scheduler existed start at their wake-up time. Either way poll's lateness
+// check still escalates ones that are long overdue.
+func (s *WakeupScheduler) recoverSchedule() {
+	s.db.Model(&models.HotelRoom{}).
+		Where("wakeup_enabled = ? AND wakeup_claimed_at IS NOT NULL", true).
+		Updates(map[string]interface{}{
+			"wakeup_next_attempt_at": gorm.Expr("wakeup_claimed_at"),
+			"wakeup_claimed_at":      nil,
+		})
+	s.db.Model(&models.HotelRoom{}).
+		Where("wakeup_enabled = ? AND wakeup_next_attempt_at IS NULL AND wakeup_time IS NOT NULL", true).
+		Update("wakeup_next_attempt_at", gorm.Expr("wakeup_time"))
+}
+
+// poll claims due rooms and dials them
+func (s *WakeupScheduler) poll() {
+	if s.esl == nil || !s.esl.IsConnected() {
+		return
+	}
+
+	now := time.Now()
+	var rooms []models.HotelRoom
+	if err := s.db.Where("wakeup_enabled = ? AND wakeup_next_attempt_at <= ?", true, now).
+		Find(&rooms).Error; err != nil {
+		log.Warnf("Wake-up scheduler: failed to load rooms: %v", err)
+		return
+	}
+
+	for _, room := range rooms {
+		// Claim the room so the next poll doesn't dial it again
+		claimed := s.db.Model(&models.HotelRoom{}).
+			Where("id = ? AND wakeup_next_attempt_at = ?", room.ID, room.WakeupNextAttemptAt).
+			Updates(map[string]interface{}{
+				"wakeup_next_attempt_at": nil,
+				"wakeup_claimed_at":      now,
+				"wakeup_attempts":        gorm.Expr("wakeup_attempts + 1"),
+			})
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+		room.WakeupAttempts++
+
+		var tenant models.Tenant
+		if err := s.db.First(&tenant, room.TenantID).Error; err != nil {
+			continue
+		}
+		settings := tenant.WakeupSettings()
+
+		if room.Extension == "" || now.Sub(*room.WakeupNextAttemptAt) > maxLateness {
+			detail := "wake-up time missed"
+			if room.Extension == "" {
+				detail = "room has no extension"
+			}
+			s.escalate(&tenant, &room, settings, detail)
+			continue
+		}
+
+		go s.call(&tenant, room, settings)
+	}
+}
+
+// call dials the room and waits for its hangup to record the attempt
+func (s *WakeupScheduler) call(tenant *models.Tenant, room models.HotelRoom, settings models.WakeupSettings) {
+	callUUID := uuid.New().String()
+	result := make(chan callResult, 1)
+	s.pendingMu.Lock()
+	s.pending[callUUID] = result
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, callUUID)
+		s.pendingMu.Unlock()
+	}()
+
+	audio := settings.Audio
+	if room.WakeupAudio != "" && models.ValidWakeupAudio(room.WakeupAudio) {
+		audio = room.WakeupAudio
+	}
+	callerID := settings.FrontDeskExtension
+	if callerID == "" {
+		callerID = "0000000000"
+	}
+
+	// Dial the room phone directly, bypassing DND and forwarding; the
+	// answered call is handed to the wake-up ESL module
+	cmd := fmt.Sprintf(
+		"originate {origination_uuid=%s,hotel_room_id=%d,wakeup_audio='%s',origination_caller_id_name='Wake-up Call',origination_caller_id_number=%s,originate_timeout=%d,ignore_early_media=true}user/%s@%s &socket(%s async full)",
+		callUUID,
+		room.ID,
+		audio,
+		callerID,
+		ringTimeout,
+		room.Extension,
+		tenant.Domain,
+		wakeupmod.ServiceAddress,
+	)
+
+	log.WithFields(log.Fields{
+		"room_id": room.ID,
+		"room":    room.RoomNumber,
+		"attempt": room.WakeupAttempts,
+	}).Info("Originating wake-up call")
+
+	var res callResult
+	if _, err := s.esl.BgAPI(cmd); err != nil {
+		log.Errorf("Wake-up call failed to originate: %v", err)
+		res = callResult{cause: "ORIGINATE_FAILED"}
+	} else {
+		select {
+		case res = <-result:
+		case <-time.After(ringTimeout*time.Second + maxCallDuration):
+			log.WithField("call_uuid", callUUID).Warn("Wake-up call result not received")
+			res = callResult{cause: "RESULT_TIMEOUT"}
+		}
+	}
+	s.recordResult(tenant, &room, settings, callUUID, res)
+}
+
+// handleHangup delivers hangup events for wake-up calls to their waiters
+func (s *WakeupScheduler) handleHangup(ev *eventsocket.Event, _ *esl.CallSession) {
+	callUUID := ev.Get("Unique-ID")
+	s.pendingMu.Lock()
+	result, ok := s.pending[callUUID]
+	s.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	answered := ev.Get("Caller-Channel-Answered-Time")
+	select {
+	case result <- callResult{
+		cause:    ev.Get("Hangup-Cause"),
+		answered: answered != "" && answered != "0",
+		snoozed:  ev.Get("variable_"+wakeupmod.ResultVariable) == wakeupmod.ResultSnoozed,
+	}:
+	default:
+	}
+}
+
+// recordResult logs the attempt and decides what happens next: done when
+// answered, a snooze or retry, or escalation once retries run out.
+func (s *WakeupScheduler) recordResult(tenant *models.Tenant, room *models.HotelRoom, settings models.WakeupSettings, callUUID string, res callResult) {
+	event := models.HotelRoomEvent{
+		Attempt:     room.WakeupAttempts,
+		CallUUID:    callUUID,
+		HangupCause: res.cause,
+	}
+	now := time.Now()
+
+	// A guest who cancelled or was checked out mid-call keeps that state
+	scope := s.db.Model(&models.HotelRoom{}).Where("id = ? AND wakeup_enabled = ?", room.ID, true)
+
+	switch {
+	case res.snoozed:
+		next := now.Add(time.Duration(settings.SnoozeMinutes) * time.Minute)
+		scope.Updates(map[string]interface{}{"wakeup_attempts": 0, "wakeup_next_attempt_at": next, "wakeup_claimed_at": nil})
+		event.Event = models.RoomEventWakeupSnoozed
+		event.Detail = fmt.Sprintf("snoozed until %s", next.In(tenant.Location()).Format("15:04"))
+
+	case res.answered:
+		scope.Updates(map[string]interface{}{"wakeup_enabled": false, "wakeup_next_attempt_at": nil, "wakeup_claimed_at": nil})
+		event.Event = models.RoomEventWakeupAnswered
+
+	case room.WakeupAttempts <= settings.Retries:
+		next := now.Add(time.Duration(settings.RetryMinutes) * time.Minute)
+		scope.Updates(map[string]interface{}{"wakeup_next_attempt_at": next, "wakeup_claimed_at": nil})
+		event.Event = models.RoomEventWakeupNoAnswer
+		event.Detail = fmt.Sprintf("retry at %s", next.In(tenant.Location()).Format("15:04"))
+
+	default:
+		event.Event = models.RoomEventWakeupNoAnswer
+		s.logEvent(room, event)
+		s.escalate(tenant, room, settings, fmt.Sprintf("no answer after %d attempts", room.WakeupAttempts))
+		return
+	}
+	s.logEvent(room, event)
+}
+
+// escalate gives up on the room and rings the front desk so staff can check
+// on the guest in person.
+func (s *WakeupScheduler) escalate(tenant *models.Tenant, room *models.HotelRoom, settings models.WakeupSettings, reason string) {
+	s.db.Model(&models.HotelRoom{}).Where("id = ?", room.ID).
+		Updates(map[string]interface{}{"wakeup_enabled": false, "wakeup_next_attempt_at": nil, "wakeup_claimed_at": nil})
+
+	if settings.FrontDeskExtension == "" {
+		s.logEvent(room, models.HotelRoomEvent{
+			Event:  models.RoomEventWakeupFailed,
+			Detail: reason + "; no front desk extension configured",
+		})
+		return
+	}
+
+	cmd := fmt.Sprintf(
+		"originate {hotel_room_id=%d,wakeup_escalation_room=%s,origination_caller_id_name='Wakeup Fail %s',origination_caller_id_number=%s,originate_timeout=%d,ignore_early_media=true}user/%s@%s &socket(%s async full)",
+		room.ID,
+		room.RoomNumber,
+		room.RoomNumber,
+		room.RoomNumber,
+		ringTimeout,
+		settings.FrontDeskExtension,
+		tenant.Domain,
+		wakeupmod.ServiceAddress,
+	)
+	if _, err := s.esl.BgAPI(cmd); err != nil {
+		log.Errorf("Wake-up escalation failed to originate: %v", err)
+		s.logEvent(room, models.HotelRoomEvent{
+			Event:  models.RoomEventWakeupFailed,
+			Detail: reason + "; front desk call failed",
+		})
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"room_id":    room.ID,
+		"room":       room.RoomNumber,
+		"front_desk": settings.FrontDeskExtension,
+	}).Warn("Wake-up call escalated to front desk")
+	s.logEvent(room, models.HotelRoomEvent{
+		Event:  models.RoomEventWakeupEscalated,
+		Detail: fmt.Sprintf("%s; front desk %s notified", reason, settings.FrontDeskExtension),
+	})
+}
+
+func (s *WakeupScheduler) logEvent(room *models.HotelRoom, event models.HotelRoomEvent) {
+	if err := models.LogRoomEvent(s.db, room, event); err != nil {
+		log.WithField("room_id", room.ID).Warnf("Failed to log room event: %v", err)
+	}
+	for _, fn := range s.listeners {
+		fn(room, event)
+	}
+}
+
+// ResolveWakeupTime converts a wall-clock "HH:MM" (and optional "YYYY-MM-DD")
+// in the tenant's timezone to an instant. Without a date the next occurrence
+// of the time is used.
+func ResolveWakeupTime(clock, date string, loc *time.Location, now time.Time) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid wake-up time %q, expected HH:MM", clock)
+	}
+
+	local := now.In(loc)
+	y, m, d := local.Date()
+	if date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid wake-up date %q, expected YYYY-MM-DD", date)
+		}
+		y, m, d = day.Date()
+	}
+
+	at := time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	if date == "" && !at.After(now) {
+		at = time.Date(y, m, d+1, t.Hour(), t.Minute(), 0, 0, loc)
+	}
+	return at, nil
+}
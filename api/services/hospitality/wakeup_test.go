@@ -0,0 +1,88 @@
+package hospitality_test
+
+import (
+	"callsign/models"
+	"callsign/services/hospitality"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestResolveWakeupTime(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	// 13:00 UTC is 08:00 in Chicago (CDT)
+	now := time.Date(2026, 6, 1, 13, 0, 0, 0, time.UTC)
+
+	at, err := hospitality.ResolveWakeupTime("07:30", "", chicago, now)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2026, 6, 2, 7, 30, 0, 0, chicago)), "past times roll to tomorrow")
+
+	at, err = hospitality.ResolveWakeupTime("09:15", "", chicago, now)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2026, 6, 1, 9, 15, 0, 0, chicago)))
+
+	at, err = hospitality.ResolveWakeupTime("06:00", "2026-06-05", chicago, now)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2026, 6, 5, 6, 0, 0, 0, chicago)))
+
+	_, err = hospitality.ResolveWakeupTime("7am", "", chicago, now)
+	assert.Error(t, err)
+	_, err = hospitality.ResolveWakeupTime("07:00", "06/05/2026", chicago, now)
+	assert.Error(t, err)
+}
+
+func TestWakeupSettings(t *testing.T) {
+	defaults := (&models.Tenant{}).WakeupSettings()
+	assert.Equal(t, 2, defaults.Retries)
+	assert.Equal(t, 5, defaults.RetryMinutes)
+	assert.Equal(t, 10, defaults.SnoozeMinutes)
+	assert.NotEmpty(t, defaults.Audio)
+
+	tenant := models.Tenant{Settings: `{"wakeup_retries":0,"wakeup_snooze_minutes":7,"operator_ext":"100"}`}
+	s := tenant.WakeupSettings()
+	assert.Equal(t, 0, s.Retries, "zero retries is honored")
+	assert.Equal(t, 7, s.SnoozeMinutes)
+	assert.Equal(t, "100", s.FrontDeskExtension, "falls back to the operator extension")
+
+	assert.True(t, models.ValidWakeupAudio("/recordings/Wake up, room 12.wav"))
+	assert.False(t, models.ValidWakeupAudio("x.wav',hotel_room_id=1"))
+	quoted := models.Tenant{Settings: `{"wakeup_audio":"a.wav}user/9999"}`}
+	assert.Equal(t, defaults.Audio, quoted.WakeupSettings().Audio, "unsafe paths fall back to the default")
+}
+
+func TestWakeupSchedulerRecoversSchedule(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.HotelRoom{}))
+
+	now := time.Now()
+	tomorrow := now.Add(24 * time.Hour)
+	claimed := now.Add(-2 * time.Minute)
+
+	// Scheduled before the scheduler tracked attempts
+	legacy := models.HotelRoom{RoomNumber: "101", WakeupEnabled: true, WakeupTime: &tomorrow}
+	// Ringing when the server stopped
+	inFlight := models.HotelRoom{RoomNumber: "102", WakeupEnabled: true, WakeupTime: &claimed, WakeupClaimedAt: &claimed, WakeupAttempts: 1}
+	for _, room := range []*models.HotelRoom{&legacy, &inFlight} {
+		require.NoError(t, db.Create(room).Error)
+	}
+
+	hospitality.NewWakeupScheduler(db, nil).Start(time.Hour)
+
+	var room models.HotelRoom
+	require.NoError(t, db.First(&room, legacy.ID).Error)
+	require.NotNil(t, room.WakeupNextAttemptAt)
+	assert.WithinDuration(t, tomorrow, *room.WakeupNextAttemptAt, time.Second, "not dialed before its wake-up time")
+
+	room = models.HotelRoom{}
+	require.NoError(t, db.First(&room, inFlight.ID).Error)
+	require.NotNil(t, room.WakeupNextAttemptAt)
+	assert.WithinDuration(t, claimed, *room.WakeupNextAttemptAt, time.Second, "redialed, still subject to the lateness check")
+	assert.Nil(t, room.WakeupClaimedAt)
+}
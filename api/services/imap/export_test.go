@@ -0,0 +1,8 @@
+package imap
+
+import "time"
+
+// SetLoginFailureDelay shortens the pause after a failed login for tests
+func SetLoginFailureDelay(d time.Duration) {
+	loginFailureDelay = d
+}
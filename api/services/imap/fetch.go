@@ -0,0 +1,245 @@
+package imap
+
+import (
+	"callsign/models"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// internalDateLayout is the IMAP date-time format
+const internalDateLayout = "02-Jan-2006 15:04:05 -0700"
+
+// bodySection names BODY[section] and BODY.PEEK[section] items, which
+// differ from the bare BODY structure item
+const bodySection = "BODY[]"
+
+// selected returns the sequence numbers and entries a set addresses, as
+// sequence numbers or, for UID commands, message IDs
+func (s *session) selected(set seqSet, uid bool) (seqs []int, entries []*entry) {
+	msgs := s.sel.msgs
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	maxSeq, maxUID := uint32(len(msgs)), uint32(msgs[len(msgs)-1].id)
+	for i, e := range msgs {
+		if uid && set.contains(uint32(e.id), maxUID) || !uid && set.contains(uint32(i+1), maxSeq) {
+			seqs = append(seqs, i+1)
+			entries = append(entries, e)
+		}
+	}
+	return seqs, entries
+}
+
+// loadMessage reads a message of the selected box
+func (s *session) loadMessage(id uint) (*models.VoicemailMessage, bool) {
+	var msg models.VoicemailMessage
+	if err := s.srv.db.Where("id = ? AND box_id = ?", id, s.sel.box.ID).First(&msg).Error; err != nil {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// fetchItem is a parsed FETCH data item
+type fetchItem struct {
+	name    string // Upper-cased item, e.g. FLAGS, or bodySection
+	section string // Section of BODY[section]
+	peek    bool
+	partial bool
+	origin  int
+	length  int
+}
+
+// parseFetchItems expands macros and parses BODY[...] sections
+func parseFetchItems(arg interface{}) ([]fetchItem, error) {
+	var raw []interface{}
+	switch v := arg.(type) {
+	case string:
+		switch strings.ToUpper(v) {
+		case "ALL":
+			raw = []interface{}{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"}
+		case "FAST":
+			raw = []interface{}{"FLAGS", "INTERNALDATE", "RFC822.SIZE"}
+		case "FULL":
+			raw = []interface{}{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"}
+		default:
+			raw = []interface{}{v}
+		}
+	case []interface{}:
+		raw = v
+	}
+
+	var items []fetchItem
+	for _, r := range raw {
+		str, ok := asString(r)
+		if !ok {
+			return nil, fmt.Errorf("invalid fetch item")
+		}
+		upper := strings.ToUpper(str)
+		switch upper {
+		case "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODYSTRUCTURE", "BODY",
+			"RFC822", "RFC822.HEADER", "RFC822.TEXT":
+			items = append(items, fetchItem{name: upper})
+			continue
+		}
+
+		open, end := strings.IndexByte(upper, '['), strings.LastIndexByte(upper, ']')
+		prefix := ""
+		if open > 0 {
+			prefix = upper[:open]
+		}
+		if (prefix != "BODY" && prefix != "BODY.PEEK") || end < open {
+			return nil, fmt.Errorf("unknown fetch item %s", str)
+		}
+		item := fetchItem{name: bodySection, section: upper[open+1 : end], peek: prefix == "BODY.PEEK"}
+		if rest := upper[end+1:]; rest != "" {
+			o, n, ok := strings.Cut(strings.Trim(rest, "<>"), ".")
+			origin, err1 := strconv.Atoi(o)
+			length, err2 := strconv.Atoi(n)
+			if !ok || err1 != nil || err2 != nil || origin < 0 || length < 0 {
+				return nil, fmt.Errorf("invalid partial %s", rest)
+			}
+			item.partial, item.origin, item.length = true, origin, length
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// setsSeen reports whether fetching the item implicitly sets \Seen
+func (it fetchItem) setsSeen() bool {
+	return it.name == "RFC822" || it.name == "RFC822.TEXT" || it.name == bodySection && !it.peek
+}
+
+func (s *session) fetch(tag string, args []interface{}, uid bool) {
+	if len(args) != 2 {
+		s.bad(tag, "FETCH needs a sequence set and data items")
+		return
+	}
+	setStr, _ := asString(args[0])
+	set, err := parseSeqSet(setStr)
+	if err != nil {
+		s.bad(tag, err.Error())
+		return
+	}
+	items, err := parseFetchItems(args[1])
+	if err != nil {
+		s.bad(tag, err.Error())
+		return
+	}
+
+	needsMessage, marksSeen, wantsFlags := false, false, false
+	for _, it := range items {
+		switch it.name {
+		case "UID":
+		case "FLAGS":
+			wantsFlags = true
+		default:
+			needsMessage = true
+		}
+		marksSeen = marksSeen || it.setsSeen()
+	}
+	marksSeen = marksSeen && !s.sel.readOnly
+
+	seqs, entries := s.selected(set, uid)
+	changed := false
+	for i, e := range entries {
+		if e.gone {
+			continue
+		}
+		var msg *models.VoicemailMessage
+		var m *message
+		if needsMessage || marksSeen && !e.seen {
+			var ok bool
+			if msg, ok = s.loadMessage(e.id); !ok {
+				continue
+			}
+			m = buildMessage(msg, &s.sel.box, s.domain, s.srv.store)
+		}
+
+		if marksSeen && !e.seen {
+			if err := msg.MarkAsRead(s.srv.db); err == nil {
+				e.seen, changed = true, true
+				if !wantsFlags {
+					items = append(items, fetchItem{name: "FLAGS"})
+					wantsFlags = true
+				}
+			}
+		}
+
+		out := make([]string, 0, len(items)+1)
+		if uid && !hasItem(items, "UID") {
+			out = append(out, fmt.Sprintf("UID %d", e.id))
+		}
+		for _, it := range items {
+			if value, err := fetchValue(it, e, msg, m); err == nil {
+				out = append(out, value)
+			}
+		}
+		s.writeLine(fmt.Sprintf("* %d FETCH (%s)", seqs[i], strings.Join(out, " ")))
+	}
+
+	if changed {
+		s.srv.notifyMWI(&s.sel.box)
+	}
+	s.sync(false)
+	s.ok(tag, "FETCH completed")
+}
+
+func hasItem(items []fetchItem, name string) bool {
+	for _, it := range items {
+		if it.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchValue renders one FETCH data item. An error leaves the item out,
+// as when a recording can no longer be read.
+func fetchValue(it fetchItem, e *entry, msg *models.VoicemailMessage, m *message) (string, error) {
+	switch it.name {
+	case "UID":
+		return fmt.Sprintf("UID %d", e.id), nil
+	case "FLAGS":
+		return "FLAGS " + e.flags(), nil
+	case "INTERNALDATE":
+		date := msg.RecordedAt
+		if date.IsZero() {
+			date = msg.CreatedAt
+		}
+		return "INTERNALDATE " + quote(date.Format(internalDateLayout)), nil
+	case "RFC822.SIZE":
+		return fmt.Sprintf("RFC822.SIZE %d", m.size()), nil
+	case "ENVELOPE":
+		return "ENVELOPE " + m.envelope, nil
+	case "BODYSTRUCTURE":
+		return "BODYSTRUCTURE " + m.bodyStructure(true), nil
+	case "RFC822":
+		data, err := m.section("")
+		return "RFC822 " + literal(data), err
+	case "RFC822.HEADER":
+		return "RFC822.HEADER " + literal(m.header), nil
+	case "RFC822.TEXT":
+		data, err := m.section("TEXT")
+		return "RFC822.TEXT " + literal(data), err
+	case "BODY":
+		return "BODY " + m.bodyStructure(false), nil
+	}
+
+	// BODY[section]<partial>
+	data, err := m.section(it.section)
+	if err != nil {
+		return "", err
+	}
+	name := "BODY[" + it.section + "]"
+	if it.partial {
+		name += fmt.Sprintf("<%d>", it.origin)
+		if it.origin >= len(data) {
+			data = ""
+		} else {
+			data = data[it.origin:min(it.origin+it.length, len(data))]
+		}
+	}
+	return name + " " + literal(data), nil
+}
@@ -0,0 +1,374 @@
+package imap
+
+import (
+	"callsign/models"
+	"callsign/services/storage"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// base64LineLen is the encoded line length of audio attachments
+const base64LineLen = 76
+
+// mimePart is one body part of a voicemail email: the text summary or an
+// audio attachment. Audio is read and encoded only when a client fetches
+// it; its encoded size is derived from the file size.
+type mimePart struct {
+	mediaType string
+	subType   string
+	params    [][2]string
+	encoding  string
+	filename  string // Attachment filename, empty for inline text
+	header    string // Part MIME header including the blank line
+	size      int    // Encoded body size
+	lines     int    // Line count (text parts)
+
+	text string // Body of text parts
+	path string // Audio file of attachment parts
+}
+
+// message renders a VoicemailMessage as a multipart/mixed email
+type message struct {
+	header   string
+	envelope string
+	boundary string
+	parts    []*mimePart
+	store    *storage.Manager
+}
+
+// buildMessage lays out the email for a voicemail message in box. Audio
+// files that cannot be found are left out.
+func buildMessage(msg *models.VoicemailMessage, box *models.VoicemailBox, domain string, store *storage.Manager) *message {
+	m := &message{
+		boundary: "vm-" + strings.ReplaceAll(msg.UUID.String(), "-", ""),
+		store:    store,
+	}
+
+	m.parts = append(m.parts, textPart(msg, box))
+	if msg.IntroPath != "" {
+		if p := audioPart(msg.IntroPath, fmt.Sprintf("introduction-%d", msg.ID), 0, store); p != nil {
+			m.parts = append(m.parts, p)
+		}
+	}
+	if p := audioPart(msg.FilePath, fmt.Sprintf("voicemail-%d", msg.ID), msg.FileSize, store); p != nil {
+		m.parts = append(m.parts, p)
+	}
+
+	caller := msg.CallerIDName
+	if caller == "" {
+		caller = msg.CallerIDNumber
+	}
+	if caller == "" {
+		caller = "Unknown caller"
+	}
+	subject := fmt.Sprintf("Voicemail from %s", caller)
+	if msg.CallerIDNumber != "" && msg.CallerIDNumber != caller {
+		subject += fmt.Sprintf(" (%s)", msg.CallerIDNumber)
+	}
+	subject += fmt.Sprintf(" - %d seconds", msg.Duration)
+	if msg.IsUrgent {
+		subject = "Urgent: " + subject
+	}
+
+	date := msg.RecordedAt
+	if date.IsZero() {
+		date = msg.CreatedAt
+	}
+	fromName := mime.QEncoding.Encode("utf-8", caller)
+	fromBox := callerMailbox(msg.CallerIDNumber)
+	messageID := fmt.Sprintf("<%s@%s>", msg.UUID, domain)
+	encSubject := mime.QEncoding.Encode("utf-8", subject)
+
+	var h strings.Builder
+	fmt.Fprintf(&h, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	if fromName == caller {
+		fmt.Fprintf(&h, "From: %q <%s@%s>\r\n", fromName, fromBox, domain)
+	} else {
+		// Encoded words must not be quoted
+		fmt.Fprintf(&h, "From: %s <%s@%s>\r\n", fromName, fromBox, domain)
+	}
+	fmt.Fprintf(&h, "To: <%s@%s>\r\n", box.Extension, domain)
+	fmt.Fprintf(&h, "Subject: %s\r\n", encSubject)
+	fmt.Fprintf(&h, "Message-ID: %s\r\n", messageID)
+	if msg.IsUrgent {
+		h.WriteString("Importance: high\r\nX-Priority: 1\r\n")
+	}
+	fmt.Fprintf(&h, "X-Voicemail-Duration: %d\r\n", msg.Duration)
+	h.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&h, "Content-Type: multipart/mixed; boundary=\"%s\"\r\n", m.boundary)
+	h.WriteString("\r\n")
+	m.header = h.String()
+
+	from := fmt.Sprintf("((%s NIL %s %s))", nstring(fromName), quote(fromBox), quote(domain))
+	to := fmt.Sprintf("((NIL NIL %s %s))", quote(box.Extension), quote(domain))
+	m.envelope = fmt.Sprintf("(%s %s %s %s %s %s NIL NIL NIL %s)",
+		quote(date.Format(time.RFC1123Z)), quote(encSubject), from, from, from, to, quote(messageID))
+	return m
+}
+
+// callerMailbox turns a caller ID number into an address local part
+func callerMailbox(number string) string {
+	if number == "" {
+		return "unknown"
+	}
+	for _, c := range number {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune("+-._", c)) {
+			return "unknown"
+		}
+	}
+	return number
+}
+
+// textPart summarizes the message, with its transcript when there is one
+func textPart(msg *models.VoicemailMessage, box *models.VoicemailBox) *mimePart {
+	var b strings.Builder
+	caller := msg.CallerIDName
+	switch {
+	case caller == "":
+		caller = msg.CallerIDNumber
+	case msg.CallerIDNumber != "":
+		caller += fmt.Sprintf(" (%s)", msg.CallerIDNumber)
+	}
+	if caller == "" {
+		caller = "Unknown caller"
+	}
+	fmt.Fprintf(&b, "Voicemail from %s\r\n", caller)
+	fmt.Fprintf(&b, "Mailbox: %s\r\n", box.Extension)
+	fmt.Fprintf(&b, "Duration: %d seconds\r\n", msg.Duration)
+	if msg.ForwardedBy != "" {
+		fmt.Fprintf(&b, "Forwarded by: %s\r\n", msg.ForwardedBy)
+	}
+	if msg.IsUrgent {
+		b.WriteString("Marked urgent by the caller\r\n")
+	}
+
+	switch {
+	case msg.Transcription != "":
+		transcript := strings.ReplaceAll(strings.ReplaceAll(msg.Transcription, "\r\n", "\n"), "\n", "\r\n")
+		fmt.Fprintf(&b, "\r\nTranscription:\r\n%s\r\n", transcript)
+	case msg.TranscriptionStatus == models.TranscriptionPending || msg.TranscriptionStatus == models.TranscriptionProcessing:
+		b.WriteString("\r\nThe transcription is not ready yet.\r\n")
+	}
+
+	text := b.String()
+	return &mimePart{
+		mediaType: "text",
+		subType:   "plain",
+		params:    [][2]string{{"charset", "utf-8"}},
+		encoding:  "8bit",
+		header:    "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n",
+		size:      len(text),
+		lines:     strings.Count(text, "\r\n"),
+		text:      text,
+	}
+}
+
+// audioPart describes an audio attachment. size is the file size when
+// known; otherwise the file is looked up, and nil is returned if missing.
+func audioPart(path, name string, size int64, store *storage.Manager) *mimePart {
+	if path == "" {
+		return nil
+	}
+	if size <= 0 {
+		rc, n, err := store.Open(context.Background(), path)
+		if err != nil {
+			return nil
+		}
+		rc.Close()
+		size = n
+	}
+
+	subType, ext := "wav", filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		subType = "mpeg"
+	case ".ogg", ".opus":
+		subType = "ogg"
+	case ".wav", "":
+		ext = ".wav"
+	}
+	filename := name + strings.ToLower(ext)
+
+	return &mimePart{
+		mediaType: "audio",
+		subType:   subType,
+		params:    [][2]string{{"name", filename}},
+		encoding:  "base64",
+		filename:  filename,
+		header: fmt.Sprintf("Content-Type: audio/%s; name=\"%s\"\r\nContent-Transfer-Encoding: base64\r\n"+
+			"Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", subType, filename, filename),
+		size: base64Size(size),
+		path: path,
+	}
+}
+
+// base64Size is the length of n bytes encoded in CRLF-terminated lines
+func base64Size(n int64) int {
+	encoded := int(4 * ((n + 2) / 3))
+	lines := (encoded + base64LineLen - 1) / base64LineLen
+	return encoded + 2*lines
+}
+
+// content returns a part's encoded body
+func (p *mimePart) content(store *storage.Manager) (string, error) {
+	if p.path == "" {
+		return p.text, nil
+	}
+	rc, _, err := store.Open(context.Background(), p.path)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	b.Grow(base64Size(int64(len(data))))
+	for i := 0; i < len(encoded); i += base64LineLen {
+		b.WriteString(encoded[i:min(i+base64LineLen, len(encoded))])
+		b.WriteString("\r\n")
+	}
+	return b.String(), nil
+}
+
+// delimiter precedes part i of the body
+func (m *message) delimiter(i int) string {
+	if i == 0 {
+		return "--" + m.boundary + "\r\n"
+	}
+	return "\r\n--" + m.boundary + "\r\n"
+}
+
+func (m *message) closeDelimiter() string {
+	return "\r\n--" + m.boundary + "--\r\n"
+}
+
+// bodySize is the size of everything after the header
+func (m *message) bodySize() int {
+	n := len(m.closeDelimiter())
+	for i, p := range m.parts {
+		n += len(m.delimiter(i)) + len(p.header) + p.size
+	}
+	return n
+}
+
+// size is the RFC822.SIZE of the message
+func (m *message) size() int {
+	return len(m.header) + m.bodySize()
+}
+
+// body renders everything after the header, loading the audio
+func (m *message) body() (string, error) {
+	var b strings.Builder
+	for i, p := range m.parts {
+		content, err := p.content(m.store)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(m.delimiter(i))
+		b.WriteString(p.header)
+		b.WriteString(content)
+	}
+	b.WriteString(m.closeDelimiter())
+	return b.String(), nil
+}
+
+// section returns a BODY[...] section: "", HEADER, TEXT, HEADER.FIELDS,
+// HEADER.FIELDS.NOT, a part number or a part's MIME header
+func (m *message) section(spec string) (string, error) {
+	upper := strings.ToUpper(spec)
+	switch {
+	case upper == "":
+		body, err := m.body()
+		return m.header + body, err
+	case upper == "HEADER":
+		return m.header, nil
+	case upper == "TEXT":
+		return m.body()
+	case strings.HasPrefix(upper, "HEADER.FIELDS"):
+		not := strings.HasPrefix(upper, "HEADER.FIELDS.NOT")
+		start, end := strings.IndexByte(upper, '('), strings.LastIndexByte(upper, ')')
+		if start < 0 || end < start {
+			return "", fmt.Errorf("invalid header field list")
+		}
+		return filterHeader(m.header, strings.Fields(upper[start+1:end]), not), nil
+	}
+
+	num, rest, _ := strings.Cut(upper, ".")
+	i, err := strconv.Atoi(num)
+	if err != nil || i < 1 || i > len(m.parts) {
+		return "", fmt.Errorf("no such body part %s", spec)
+	}
+	part := m.parts[i-1]
+	switch rest {
+	case "":
+		return part.content(m.store)
+	case "MIME":
+		return part.header, nil
+	}
+	return "", fmt.Errorf("unsupported section %s", spec)
+}
+
+// filterHeader keeps (or with not, drops) the named header fields
+func filterHeader(header string, names []string, not bool) string {
+	want := make(map[string]bool, len(names))
+	for _, n := range names {
+		want[strings.Trim(n, `"`)] = true
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(header, "\r\n\r\n"), "\r\n") {
+		name, _, _ := strings.Cut(line, ":")
+		if want[strings.ToUpper(name)] != not {
+			b.WriteString(line)
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// bodyStructure renders BODYSTRUCTURE, or BODY without extension data
+func (m *message) bodyStructure(extended bool) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for _, p := range m.parts {
+		b.WriteString(p.structure(extended))
+	}
+	b.WriteString(` "MIXED"`)
+	if extended {
+		fmt.Fprintf(&b, ` ("BOUNDARY" %s) NIL NIL`, quote(m.boundary))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (p *mimePart) structure(extended bool) string {
+	params := make([]string, 0, len(p.params))
+	for _, kv := range p.params {
+		params = append(params, quote(strings.ToUpper(kv[0]))+" "+quote(kv[1]))
+	}
+	s := fmt.Sprintf("(%s %s (%s) NIL NIL %s %d",
+		quote(strings.ToUpper(p.mediaType)), quote(strings.ToUpper(p.subType)),
+		strings.Join(params, " "), quote(strings.ToUpper(p.encoding)), p.size)
+	if p.mediaType == "text" {
+		s += fmt.Sprintf(" %d", p.lines)
+	}
+	if extended {
+		if p.filename != "" {
+			s += fmt.Sprintf(` NIL ("ATTACHMENT" ("FILENAME" %s)) NIL`, quote(p.filename))
+		} else {
+			s += " NIL NIL NIL"
+		}
+	}
+	return s + ")"
+}
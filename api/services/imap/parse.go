@@ -0,0 +1,291 @@
+package imap
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxLiteral bounds a client literal. Commands only carry names, passwords
+// and search strings, so anything larger is refused.
+const maxLiteral = 64 * 1024
+
+// maxLine bounds a command line including its literals
+const maxLine = 256 * 1024
+
+// readCommand reads one command line, answering synchronizing literals with
+// a continuation request. Literal data is folded back into the line as a
+// quoted string so the rest of the parser deals with a single line.
+func (s *session) readCommand() (string, error) {
+	var line strings.Builder
+	for {
+		part, err := s.readLine()
+		if err != nil {
+			return "", err
+		}
+		size, sync, ok := trailingLiteral(part)
+		if !ok {
+			line.WriteString(part)
+			break
+		}
+		if size > maxLiteral || line.Len()+len(part)+size > maxLine {
+			return "", errLineTooLong
+		}
+		line.WriteString(part[:strings.LastIndexByte(part, '{')])
+		if sync {
+			s.writeLine("+ Ready for literal data")
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return "", err
+		}
+		line.WriteString(quoteRaw(string(data)))
+	}
+	return line.String(), nil
+}
+
+// readLine reads up to CRLF (or a bare LF) and strips the terminator
+func (s *session) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := s.reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLine {
+			return "", errLineTooLong
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// trailingLiteral reports whether a line ends in a literal announcement
+// {n} or the non-synchronizing {n+}
+func trailingLiteral(line string) (size int, sync bool, ok bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false, false
+	}
+	spec := line[open+1 : len(line)-1]
+	sync = true
+	if strings.HasSuffix(spec, "+") {
+		spec, sync = spec[:len(spec)-1], false
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return 0, false, false
+	}
+	return n, sync, true
+}
+
+var errLineTooLong = fmt.Errorf("command line too long")
+
+// parser tokenizes the arguments of a command. Values are strings (atoms
+// and quoted strings) or []interface{} for parenthesized lists.
+type parser struct {
+	s   string
+	pos int
+}
+
+// args parses every remaining value on the line
+func (p *parser) args() ([]interface{}, error) {
+	var out []interface{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return out, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) value() (interface{}, error) {
+	switch p.s[p.pos] {
+	case '"':
+		return p.quoted()
+	case '(':
+		p.pos++
+		var list []interface{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.s) {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			if p.s[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case ')':
+		return nil, fmt.Errorf("unexpected )")
+	default:
+		return p.atom(), nil
+	}
+}
+
+func (p *parser) quoted() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case '\\':
+			if p.pos >= len(p.s) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		case '"':
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// atom reads up to a space or parenthesis. A bracketed section such as
+// BODY[HEADER.FIELDS (FROM DATE)] is kept whole, spaces included.
+func (p *parser) atom() string {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if depth == 0 && (c == ' ' || c == '(' || c == ')') {
+			break
+		}
+		if c == '[' {
+			depth++
+		} else if c == ']' && depth > 0 {
+			depth--
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// splitCommand separates the tag and command name from the arguments
+func splitCommand(line string) (tag, name, rest string) {
+	tag, line, _ = strings.Cut(line, " ")
+	name, rest, _ = strings.Cut(line, " ")
+	return tag, strings.ToUpper(name), rest
+}
+
+// seqRange is one element of a sequence set; 0 stands for "*"
+type seqRange struct {
+	from, to uint32
+}
+
+// seqSet is a parsed IMAP sequence set such as 1:4,7,9:*
+type seqSet []seqRange
+
+func parseSeqSet(s string) (seqSet, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty sequence set")
+	}
+	var set seqSet
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, ":")
+		a, err := parseSeqNum(from)
+		if err != nil {
+			return nil, err
+		}
+		b := a
+		if isRange {
+			if b, err = parseSeqNum(to); err != nil {
+				return nil, err
+			}
+		}
+		set = append(set, seqRange{a, b})
+	}
+	return set, nil
+}
+
+func parseSeqNum(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid sequence number %q", s)
+	}
+	return uint32(n), nil
+}
+
+// contains reports whether n is in the set, with "*" meaning max
+func (set seqSet) contains(n, max uint32) bool {
+	for _, r := range set {
+		from, to := r.from, r.to
+		if from == 0 {
+			from = max
+		}
+		if to == 0 {
+			to = max
+		}
+		if from > to {
+			from, to = to, from
+		}
+		if n >= from && n <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// quote renders a string as an IMAP quoted string, or as a literal when it
+// holds characters a quoted string cannot
+func quote(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\r' || c == '\n' || c >= 0x80 || c == 0 {
+			return literal(s)
+		}
+	}
+	return quoteRaw(s)
+}
+
+// quoteRaw escapes a string in quoted form whatever it holds. On its own it
+// is only safe for folding literals into a command line for the parser.
+func quoteRaw(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// nstring renders a string, or NIL when it is empty
+func nstring(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return quote(s)
+}
+
+func literal(s string) string {
+	return "{" + strconv.Itoa(len(s)) + "}\r\n" + s
+}
+
+// asString returns a parsed value as a string, failing on lists
+func asString(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
@@ -0,0 +1,252 @@
+package imap
+
+import (
+	"callsign/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchDateLayout is the IMAP date format of SINCE, BEFORE and ON
+const searchDateLayout = "2-Jan-2006"
+
+// matcher tests one message against a search key
+type matcher func(seq int, e *entry) bool
+
+// searcher parses search keys over the selected mailbox, loading message
+// details only for keys that need them
+type searcher struct {
+	s    *session
+	args []interface{}
+	pos  int
+	msgs map[uint]*models.VoicemailMessage
+}
+
+func (s *session) search(tag string, args []interface{}, uid bool) {
+	if len(args) >= 2 {
+		if first, _ := asString(args[0]); strings.EqualFold(first, "CHARSET") {
+			args = args[2:] // Strings are matched as UTF-8 whatever the charset
+		}
+	}
+	if len(args) == 0 {
+		s.bad(tag, "SEARCH needs criteria")
+		return
+	}
+
+	sr := &searcher{s: s, args: args}
+	var keys []matcher
+	for sr.pos < len(sr.args) {
+		m, err := sr.key()
+		if err != nil {
+			s.bad(tag, err.Error())
+			return
+		}
+		keys = append(keys, m)
+	}
+
+	var hits []string
+	for i, e := range s.sel.msgs {
+		if e.gone || !all(keys, i+1, e) {
+			continue
+		}
+		if uid {
+			hits = append(hits, strconv.Itoa(int(e.id)))
+		} else {
+			hits = append(hits, strconv.Itoa(i+1))
+		}
+	}
+	s.writeLine(strings.TrimSpace("* SEARCH " + strings.Join(hits, " ")))
+	s.sync(false)
+	s.ok(tag, "SEARCH completed")
+}
+
+func all(keys []matcher, seq int, e *entry) bool {
+	for _, k := range keys {
+		if !k(seq, e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (sr *searcher) next() (interface{}, error) {
+	if sr.pos >= len(sr.args) {
+		return nil, fmt.Errorf("incomplete search criteria")
+	}
+	v := sr.args[sr.pos]
+	sr.pos++
+	return v, nil
+}
+
+func (sr *searcher) nextString() (string, error) {
+	v, err := sr.next()
+	if err != nil {
+		return "", err
+	}
+	s, ok := asString(v)
+	if !ok {
+		return "", fmt.Errorf("expected a string")
+	}
+	return s, nil
+}
+
+// message loads a message's details once per search
+func (sr *searcher) message(id uint) *models.VoicemailMessage {
+	if sr.msgs == nil {
+		sr.msgs = make(map[uint]*models.VoicemailMessage)
+		var msgs []models.VoicemailMessage
+		sr.s.srv.db.Where("box_id = ?", sr.s.sel.box.ID).Find(&msgs)
+		for i := range msgs {
+			sr.msgs[msgs[i].ID] = &msgs[i]
+		}
+	}
+	if msg, ok := sr.msgs[id]; ok {
+		return msg
+	}
+	return &models.VoicemailMessage{}
+}
+
+// key parses one search key
+func (sr *searcher) key() (matcher, error) {
+	v, err := sr.next()
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := v.([]interface{}); ok {
+		sub := &searcher{s: sr.s, args: list, msgs: sr.msgs}
+		var keys []matcher
+		for sub.pos < len(sub.args) {
+			m, err := sub.key()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, m)
+		}
+		return func(seq int, e *entry) bool { return all(keys, seq, e) }, nil
+	}
+
+	atom, _ := asString(v)
+	switch strings.ToUpper(atom) {
+	case "ALL", "OLD", "UNANSWERED", "UNDRAFT":
+		return func(int, *entry) bool { return true }, nil
+	case "ANSWERED", "DRAFT", "RECENT":
+		return func(int, *entry) bool { return false }, nil
+	case "SEEN":
+		return func(_ int, e *entry) bool { return e.seen }, nil
+	case "UNSEEN", "NEW":
+		return func(_ int, e *entry) bool { return !e.seen }, nil
+	case "DELETED":
+		return func(_ int, e *entry) bool { return e.deleted }, nil
+	case "UNDELETED":
+		return func(_ int, e *entry) bool { return !e.deleted }, nil
+	case "FLAGGED":
+		return func(_ int, e *entry) bool { return e.flagged }, nil
+	case "UNFLAGGED":
+		return func(_ int, e *entry) bool { return !e.flagged }, nil
+	case "NOT":
+		m, err := sr.key()
+		if err != nil {
+			return nil, err
+		}
+		return func(seq int, e *entry) bool { return !m(seq, e) }, nil
+	case "OR":
+		a, err := sr.key()
+		if err != nil {
+			return nil, err
+		}
+		b, err := sr.key()
+		if err != nil {
+			return nil, err
+		}
+		return func(seq int, e *entry) bool { return a(seq, e) || b(seq, e) }, nil
+	case "UID":
+		str, err := sr.nextString()
+		if err != nil {
+			return nil, err
+		}
+		set, err := parseSeqSet(str)
+		if err != nil {
+			return nil, err
+		}
+		msgs := sr.s.sel.msgs
+		maxUID := uint32(0)
+		if len(msgs) > 0 {
+			maxUID = uint32(msgs[len(msgs)-1].id)
+		}
+		return func(_ int, e *entry) bool { return set.contains(uint32(e.id), maxUID) }, nil
+	case "FROM", "SUBJECT", "TEXT", "BODY", "TO":
+		field := strings.ToUpper(atom)
+		str, err := sr.nextString()
+		if err != nil {
+			return nil, err
+		}
+		needle := strings.ToLower(str)
+		return func(_ int, e *entry) bool {
+			msg := sr.message(e.id)
+			var hay string
+			switch field {
+			case "FROM", "SUBJECT":
+				hay = msg.CallerIDName + " " + msg.CallerIDNumber
+			case "TO":
+				hay = sr.s.sel.box.Extension
+			case "BODY":
+				hay = msg.Transcription
+			default:
+				hay = msg.CallerIDName + " " + msg.CallerIDNumber + " " + msg.Transcription
+			}
+			return strings.Contains(strings.ToLower(hay), needle)
+		}, nil
+	case "SINCE", "BEFORE", "ON", "SENTSINCE", "SENTBEFORE", "SENTON":
+		op := strings.TrimPrefix(strings.ToUpper(atom), "SENT")
+		str, err := sr.nextString()
+		if err != nil {
+			return nil, err
+		}
+		day, err := time.ParseInLocation(searchDateLayout, str, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %s", str)
+		}
+		return func(_ int, e *entry) bool {
+			msg := sr.message(e.id)
+			t := msg.RecordedAt
+			if t.IsZero() {
+				t = msg.CreatedAt
+			}
+			t = t.In(time.Local)
+			d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+			switch op {
+			case "SINCE":
+				return !d.Before(day)
+			case "BEFORE":
+				return d.Before(day)
+			}
+			return d.Equal(day)
+		}, nil
+	case "LARGER", "SMALLER":
+		larger := strings.EqualFold(atom, "LARGER")
+		str, err := sr.nextString()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %s", str)
+		}
+		return func(_ int, e *entry) bool {
+			size := buildMessage(sr.message(e.id), &sr.s.sel.box, sr.s.domain, sr.s.srv.store).size()
+			if larger {
+				return size > n
+			}
+			return size < n
+		}, nil
+	}
+
+	// A sequence set
+	set, err := parseSeqSet(atom)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported search key %s", atom)
+	}
+	maxSeq := uint32(len(sr.s.sel.msgs))
+	return func(seq int, _ *entry) bool { return set.contains(uint32(seq), maxSeq) }, nil
+}
@@ -0,0 +1,209 @@
+// Package imap serves voicemail boxes over IMAP4rev1. Each box a user can
+// check appears as a mailbox whose messages are emails carrying the
+// recording and transcript, so any mail client or desk-phone visual
+// voicemail client can list, play, mark and delete voicemail.
+package imap
+
+import (
+	"bufio"
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/storage"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// idleTimeout logs out a client that sends nothing (RFC 3501: at least 30 minutes)
+	idleTimeout = 30 * time.Minute
+	// pollInterval is how often an idling client is told about mailbox changes
+	pollInterval = 15 * time.Second
+	// maxLoginFailures closes the connection after this many bad logins
+	maxLoginFailures = 3
+)
+
+// loginFailureDelay slows down password guessing
+var loginFailureDelay = 2 * time.Second
+
+// MWINotifier refreshes the message-waiting lamps a mailbox affects. The
+// ESL manager implements it.
+type MWINotifier interface {
+	SendVoicemailMWI(box *models.VoicemailBox)
+}
+
+// Server accepts IMAP connections for voicemail access
+type Server struct {
+	db             *gorm.DB
+	addr           string
+	tlsConfig      *tls.Config
+	implicitTLS    bool
+	allowPlaintext bool
+	store          *storage.Manager
+	mwi            MWINotifier
+	throttle       *loginThrottle
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// NewServer creates an IMAP server from config. Logins require TLS:
+// STARTTLS, or TLS from the first byte with IMAPImplicitTLS. Without a
+// certificate logins are refused unless IMAPAllowPlaintext is set.
+func NewServer(db *gorm.DB, cfg *config.Config) (*Server, error) {
+	s := &Server{
+		db:             db,
+		addr:           cfg.IMAPAddr,
+		implicitTLS:    cfg.IMAPImplicitTLS,
+		allowPlaintext: cfg.IMAPAllowPlaintext,
+		throttle:       newLoginThrottle(),
+		conns:          make(map[net.Conn]struct{}),
+	}
+	if cfg.IMAPTLSCert != "" && cfg.IMAPTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.IMAPTLSCert, cfg.IMAPTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("load IMAP certificate: %w", err)
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	} else if s.implicitTLS {
+		return nil, fmt.Errorf("IMAP implicit TLS needs IMAP_TLS_CERT and IMAP_TLS_KEY")
+	}
+	return s, nil
+}
+
+// SetStorage sets the storage manager used to read recordings that were
+// evicted to the storage backend
+func (s *Server) SetStorage(store *storage.Manager) {
+	s.store = store
+}
+
+// SetMWI sets the notifier told when a client reads or deletes messages
+func (s *Server) SetMWI(mwi MWINotifier) {
+	s.mwi = mwi
+}
+
+// Start listens on the configured address and serves clients in the background
+func (s *Server) Start() error {
+	var (
+		l   net.Listener
+		err error
+	)
+	if s.implicitTLS {
+		l, err = tls.Listen("tcp", s.addr, s.tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	switch {
+	case s.tlsConfig == nil && s.allowPlaintext:
+		log.Warnf("IMAP: listening on %s without TLS; voicemail PINs and passwords are sent in clear text", l.Addr())
+	case s.tlsConfig == nil:
+		log.Warnf("IMAP: listening on %s without TLS; logins are refused until IMAP_TLS_CERT and IMAP_TLS_KEY are set", l.Addr())
+	default:
+		log.Infof("IMAP: listening on %s", l.Addr())
+	}
+
+	s.wg.Add(1)
+	go s.accept(l)
+	return nil
+}
+
+// Addr returns the address the server listens on, nil before Start
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop closes the listener and every client connection
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) accept(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Warnf("IMAP: accept failed: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// serve runs one client session until it logs out or disconnects
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	sess := &session{
+		srv:    s,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+		tls:    s.implicitTLS,
+		logger: log.WithField("remote", conn.RemoteAddr().String()),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			sess.logger.Errorf("IMAP: session panic: %v", r)
+		}
+	}()
+	sess.run()
+}
+
+// notifyMWI refreshes the counts of a box and its MWI lamps
+func (s *Server) notifyMWI(box *models.VoicemailBox) {
+	models.RefreshVoicemailCounts(s.db, box)
+	if s.mwi != nil {
+		s.mwi.SendVoicemailMWI(box)
+	}
+}
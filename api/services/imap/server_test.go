@@ -0,0 +1,236 @@
+package imap_test
+
+import (
+	"bufio"
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/imap"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeMWI records the boxes the server asked to refresh
+type fakeMWI struct {
+	mu    sync.Mutex
+	boxes []uint
+}
+
+func (f *fakeMWI) SendVoicemailMWI(box *models.VoicemailBox) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.boxes = append(f.boxes, box.ID)
+}
+
+func (f *fakeMWI) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.boxes)
+}
+
+// client speaks just enough IMAP to drive the server
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	n      int
+}
+
+// cmd sends a command and returns everything up to its tagged response,
+// with literals inlined
+func (c *client) cmd(format string, args ...interface{}) (string, string) {
+	c.n++
+	tag := fmt.Sprintf("a%d", c.n)
+	_, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...))
+	require.NoError(c.t, err)
+
+	var out strings.Builder
+	for {
+		line := c.line()
+		if strings.HasPrefix(line, tag+" ") {
+			return out.String(), strings.TrimPrefix(line, tag+" ")
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+}
+
+// line reads a response line, following any literal it announces
+func (c *client) line() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	require.NoError(c.t, err)
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasSuffix(line, "}") {
+		open := strings.LastIndexByte(line, '{')
+		n, err := strconv.Atoi(line[open+1 : len(line)-1])
+		require.NoError(c.t, err)
+		data := make([]byte, n)
+		_, err = io.ReadFull(c.reader, data)
+		require.NoError(c.t, err)
+		return line[:open] + string(data) + c.line()
+	}
+	return line
+}
+
+func setupServer(t *testing.T) (*gorm.DB, *fakeMWI, *client, models.VoicemailMessage) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // sessions must see the same in-memory DB
+	require.NoError(t, db.AutoMigrate(&models.Tenant{}, &models.User{}, &models.VoicemailBox{},
+		&models.VoicemailMessage{}, &models.VoicemailBoxMember{}))
+
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.test", Enabled: true}
+	require.NoError(t, db.Create(&tenant).Error)
+	box := models.VoicemailBox{TenantID: tenant.ID, Extension: "1001", Password: "4321", Enabled: true}
+	require.NoError(t, db.Create(&box).Error)
+
+	audio := filepath.Join(t.TempDir(), "msg.wav")
+	require.NoError(t, os.WriteFile(audio, []byte("RIFF....WAVEfmt voicemail audio"), 0644))
+	msg := models.VoicemailMessage{
+		TenantID: tenant.ID, BoxID: box.ID, CallerIDName: "Jane Doe", CallerIDNumber: "5551234",
+		Duration: 12, FilePath: audio, RecordedAt: time.Now(), IsNew: true,
+		Transcription: "Please call me back.", TranscriptionStatus: models.TranscriptionCompleted,
+	}
+	require.NoError(t, db.Create(&msg).Error)
+
+	srv, err := imap.NewServer(db, &config.Config{IMAPAddr: "127.0.0.1:0", IMAPAllowPlaintext: true})
+	require.NoError(t, err)
+	mwi := &fakeMWI{}
+	srv.SetMWI(mwi)
+	require.NoError(t, srv.Start())
+	t.Cleanup(srv.Stop)
+	return db, mwi, dial(t, srv), msg
+}
+
+// dial opens a client connection and reads the greeting
+func dial(t *testing.T, srv *imap.Server) *client {
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	assert.Contains(t, c.line(), "* OK")
+	return c
+}
+
+func TestIMAPReadAndDeleteVoicemail(t *testing.T) {
+	db, mwi, c, msg := setupServer(t)
+
+	_, status := c.cmd("LOGIN 1001@acme.test 4321")
+	require.True(t, strings.HasPrefix(status, "OK"), status)
+
+	out, _ := c.cmd(`LIST "" *`)
+	assert.Contains(t, out, `"INBOX"`)
+
+	out, status = c.cmd("SELECT INBOX")
+	require.True(t, strings.HasPrefix(status, "OK [READ-WRITE]"), status)
+	assert.Contains(t, out, "* 1 EXISTS")
+	assert.Contains(t, out, "[UNSEEN 1]")
+
+	// Peeking at the header leaves the message new
+	out, _ = c.cmd("FETCH 1 (FLAGS BODY.PEEK[HEADER.FIELDS (SUBJECT)])")
+	assert.Contains(t, out, "FLAGS ()")
+	assert.Contains(t, out, "Subject: Voicemail from Jane Doe (5551234) - 12 seconds")
+	assert.Equal(t, 0, mwi.count())
+
+	// Downloading the message marks it read and refreshes MWI
+	out, _ = c.cmd("UID FETCH %d (BODY[] BODYSTRUCTURE)", msg.ID)
+	assert.Contains(t, out, "Please call me back.")
+	assert.Contains(t, out, `"AUDIO" "WAV"`)
+	assert.Contains(t, out, `FLAGS (\Seen)`)
+	require.NoError(t, db.First(&msg, msg.ID).Error)
+	assert.False(t, msg.IsNew)
+	assert.NotNil(t, msg.ReadAt)
+	assert.Equal(t, 1, mwi.count())
+
+	var box models.VoicemailBox
+	require.NoError(t, db.First(&box, msg.BoxID).Error)
+	assert.Equal(t, 0, box.NewMessages)
+	assert.Equal(t, 1, box.SavedMessages)
+
+	// Clearing \Seen makes it new again
+	out, _ = c.cmd(`STORE 1 -FLAGS (\Seen)`)
+	assert.Contains(t, out, "FLAGS ()")
+	require.NoError(t, db.First(&msg, msg.ID).Error)
+	assert.True(t, msg.IsNew)
+
+	// \Deleted plus EXPUNGE deletes the message and its recording
+	_, status = c.cmd(`STORE 1 +FLAGS.SILENT (\Deleted)`)
+	require.True(t, strings.HasPrefix(status, "OK"), status)
+	out, _ = c.cmd("EXPUNGE")
+	assert.Contains(t, out, "* 1 EXPUNGE")
+	assert.Error(t, db.First(&models.VoicemailMessage{}, msg.ID).Error)
+	assert.NoFileExists(t, msg.FilePath)
+	assert.Equal(t, 3, mwi.count())
+
+	_, status = c.cmd("LOGOUT")
+	assert.True(t, strings.HasPrefix(status, "OK"), status)
+}
+
+func TestIMAPRejectsWrongPIN(t *testing.T) {
+	_, _, c, _ := setupServer(t)
+
+	_, status := c.cmd("LOGIN 1001@acme.test 0000")
+	assert.True(t, strings.HasPrefix(status, "NO [AUTHENTICATIONFAILED]"), status)
+
+	_, status = c.cmd("SELECT INBOX")
+	assert.True(t, strings.HasPrefix(status, "BAD"), status)
+}
+
+func TestIMAPThrottlesLoginsAcrossConnections(t *testing.T) {
+	imap.SetLoginFailureDelay(0)
+	t.Cleanup(func() { imap.SetLoginFailureDelay(2 * time.Second) })
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Tenant{}, &models.User{}, &models.VoicemailBox{}))
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.test", Enabled: true}
+	require.NoError(t, db.Create(&tenant).Error)
+	require.NoError(t, db.Create(&models.VoicemailBox{TenantID: tenant.ID, Extension: "1001", Password: "4321", Enabled: true}).Error)
+
+	srv, err := imap.NewServer(db, &config.Config{IMAPAddr: "127.0.0.1:0", IMAPAllowPlaintext: true})
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	t.Cleanup(srv.Stop)
+
+	// Five guesses spread over connections lock the account
+	for _, pins := range [][]string{{"0000", "0001", "0002"}, {"0003", "0004"}} {
+		c := dial(t, srv)
+		for _, pin := range pins {
+			_, status := c.cmd("LOGIN 1001@acme.test %s", pin)
+			assert.True(t, strings.HasPrefix(status, "NO [AUTHENTICATIONFAILED]"), status)
+		}
+	}
+
+	_, status := dial(t, srv).cmd("LOGIN 1001@ACME.test 4321")
+	assert.True(t, strings.HasPrefix(status, "NO [UNAVAILABLE]"), "the right PIN is refused while locked: %s", status)
+}
+
+func TestIMAPRefusesLoginWithoutTLS(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	srv, err := imap.NewServer(db, &config.Config{IMAPAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	t.Cleanup(srv.Stop)
+
+	c := dial(t, srv)
+	out, _ := c.cmd("CAPABILITY")
+	assert.Contains(t, out, "LOGINDISABLED")
+	_, status := c.cmd("LOGIN 1001@acme.test 4321")
+	assert.True(t, strings.HasPrefix(status, "NO [PRIVACYREQUIRED]"), status)
+}
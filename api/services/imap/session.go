@@ -0,0 +1,637 @@
+package imap
+
+import (
+	"bufio"
+	"callsign/models"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// groupFolder is the parent folder of group mailboxes ("Groups/2000")
+const groupFolder = "Groups"
+
+// session is one client connection
+type session struct {
+	srv    *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	tls    bool
+	logger *log.Entry
+
+	// Set by LOGIN: the extension whose mailboxes the client sees
+	authenticated bool
+	tenantID      uint
+	domain        string
+	extension     string
+	failures      int
+
+	sel *mailbox
+}
+
+// mailbox is the selected voicemail box and the messages the client knows.
+// Sequence numbers are positions in msgs; UIDs are message IDs.
+type mailbox struct {
+	name     string
+	box      models.VoicemailBox
+	readOnly bool
+	msgs     []*entry
+}
+
+// entry is a message as last reported to the client
+type entry struct {
+	id      uint
+	seen    bool
+	flagged bool
+	deleted bool // \Deleted lives in the session until EXPUNGE
+	gone    bool // Deleted elsewhere; reported at the next EXPUNGE point
+}
+
+// flags renders the entry's IMAP flags
+func (e *entry) flags() string {
+	var f []string
+	if e.seen {
+		f = append(f, `\Seen`)
+	}
+	if e.flagged {
+		f = append(f, `\Flagged`)
+	}
+	if e.deleted {
+		f = append(f, `\Deleted`)
+	}
+	return "(" + strings.Join(f, " ") + ")"
+}
+
+// namedBox is a mailbox the logged-in extension can open
+type namedBox struct {
+	name string
+	box  models.VoicemailBox
+}
+
+func (s *session) run() {
+	s.writeLine("* OK [CAPABILITY " + s.capabilities() + "] CallSign voicemail IMAP ready")
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, err := s.readCommand()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				s.writeLine("* BYE Command line too long")
+			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				s.writeLine("* BYE Autologout; idle for too long")
+			}
+			return
+		}
+		tag, name, rest := splitCommand(line)
+		if tag == "" || name == "" {
+			s.writeLine("* BAD Missing command")
+			continue
+		}
+		if !s.dispatch(tag, name, rest) {
+			return
+		}
+	}
+}
+
+// dispatch runs one command. It returns false when the connection must close.
+func (s *session) dispatch(tag, name, rest string) bool {
+	args, err := (&parser{s: rest}).args()
+	if err != nil {
+		s.bad(tag, "Invalid arguments: "+err.Error())
+		return true
+	}
+
+	uid := false
+	if name == "UID" {
+		if len(args) == 0 {
+			s.bad(tag, "UID needs a command")
+			return true
+		}
+		sub, _ := asString(args[0])
+		name, args, uid = "UID "+strings.ToUpper(sub), args[1:], true
+	}
+
+	switch name {
+	case "CAPABILITY":
+		s.writeLine("* CAPABILITY " + s.capabilities())
+		s.ok(tag, "CAPABILITY completed")
+		return true
+	case "NOOP":
+		s.sync(true)
+		s.ok(tag, "NOOP completed")
+		return true
+	case "LOGOUT":
+		s.writeLine("* BYE Logging out")
+		s.ok(tag, "LOGOUT completed")
+		return false
+	case "STARTTLS":
+		return s.startTLS(tag)
+	case "LOGIN":
+		return s.login(tag, args)
+	case "AUTHENTICATE":
+		s.no(tag, "Unsupported authentication mechanism; use LOGIN")
+		return true
+	}
+
+	if !s.authenticated {
+		s.bad(tag, "Log in first")
+		return true
+	}
+	switch name {
+	case "SELECT", "EXAMINE":
+		s.selectBox(tag, name, args)
+		return true
+	case "LIST", "LSUB":
+		s.list(tag, name, args)
+		return true
+	case "STATUS":
+		s.status(tag, args)
+		return true
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		s.ok(tag, name+" completed")
+		return true
+	case "CREATE", "DELETE", "RENAME", "APPEND":
+		s.no(tag, "[CANNOT] Voicemail mailboxes are managed by the PBX")
+		return true
+	case "IDLE":
+		return s.idle(tag)
+	}
+
+	if s.sel == nil {
+		s.bad(tag, "No mailbox selected")
+		return true
+	}
+	switch name {
+	case "CHECK":
+		s.sync(true)
+		s.ok(tag, "CHECK completed")
+	case "CLOSE":
+		if !s.sel.readOnly {
+			s.expunge(false)
+		}
+		s.sel = nil
+		s.ok(tag, "CLOSE completed")
+	case "UNSELECT":
+		s.sel = nil
+		s.ok(tag, "UNSELECT completed")
+	case "EXPUNGE":
+		if s.sel.readOnly {
+			s.no(tag, "[READ-ONLY] Mailbox is read-only")
+			return true
+		}
+		s.expunge(true)
+		s.sync(true)
+		s.ok(tag, "EXPUNGE completed")
+	case "FETCH", "UID FETCH":
+		s.fetch(tag, args, uid)
+	case "STORE", "UID STORE":
+		s.store(tag, args, uid)
+	case "SEARCH", "UID SEARCH":
+		s.search(tag, args, uid)
+	case "COPY", "UID COPY":
+		s.copy(tag, args, uid)
+	default:
+		s.bad(tag, "Unknown command "+name)
+	}
+	return true
+}
+
+func (s *session) capabilities() string {
+	caps := "IMAP4rev1 LITERAL+ IDLE UNSELECT CHILDREN"
+	switch {
+	case s.srv.tlsConfig != nil && !s.tls:
+		caps += " STARTTLS LOGINDISABLED"
+	case s.srv.tlsConfig == nil && !s.srv.allowPlaintext:
+		caps += " LOGINDISABLED"
+	}
+	return caps
+}
+
+// remoteHost returns the client's IP address
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+func (s *session) startTLS(tag string) bool {
+	if s.tls || s.srv.tlsConfig == nil {
+		s.bad(tag, "TLS is not available")
+		return true
+	}
+	s.ok(tag, "Begin TLS negotiation now")
+
+	conn := tls.Server(s.conn, s.srv.tlsConfig)
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if err := conn.Handshake(); err != nil {
+		s.logger.Warnf("IMAP: TLS handshake failed: %v", err)
+		return false
+	}
+	conn.SetDeadline(time.Time{})
+	// Anything the client pipelined before the handshake is discarded
+	s.conn, s.tls = conn, true
+	s.reader, s.writer = bufio.NewReader(conn), bufio.NewWriter(conn)
+	return true
+}
+
+func (s *session) login(tag string, args []interface{}) bool {
+	if s.authenticated {
+		s.bad(tag, "Already logged in")
+		return true
+	}
+	if s.srv.tlsConfig == nil && !s.srv.allowPlaintext {
+		s.no(tag, "[PRIVACYREQUIRED] Logins are disabled until the server has a TLS certificate")
+		return true
+	}
+	if s.srv.tlsConfig != nil && !s.tls {
+		s.no(tag, "[PRIVACYREQUIRED] Use STARTTLS before logging in")
+		return true
+	}
+	if len(args) != 2 {
+		s.bad(tag, "LOGIN needs a username and password")
+		return true
+	}
+	username, _ := asString(args[0])
+	password, _ := asString(args[1])
+	account := strings.ToLower(username)
+	addr := remoteHost(s.conn)
+
+	// Failures count per account and address across connections, so
+	// reconnecting doesn't buy more guesses
+	if s.srv.throttle.locked(account, addr, time.Now()) {
+		s.logger.WithField("username", username).Warn("IMAP: login refused, too many failures")
+		time.Sleep(loginFailureDelay)
+		s.no(tag, "[UNAVAILABLE] Too many failed logins, try again later")
+		s.writeLine("* BYE Too many failed logins")
+		return false
+	}
+
+	if !s.authenticate(username, password) {
+		s.failures++
+		s.srv.throttle.fail(account, addr, time.Now())
+		s.logger.WithField("username", username).Warn("IMAP: login failed")
+		time.Sleep(loginFailureDelay)
+		s.no(tag, "[AUTHENTICATIONFAILED] Invalid credentials")
+		if s.failures >= maxLoginFailures {
+			s.writeLine("* BYE Too many failed logins")
+			return false
+		}
+		return true
+	}
+	s.srv.throttle.succeed(account)
+
+	s.authenticated = true
+	s.logger = s.logger.WithFields(log.Fields{"tenant_id": s.tenantID, "extension": s.extension})
+	s.logger.Info("IMAP: logged in")
+	s.ok(tag, "[CAPABILITY "+s.capabilities()+"] LOGIN completed")
+	return true
+}
+
+// authenticate accepts either extension@domain with the voicemail PIN, or
+// a portal username/email and password for a user with an extension
+func (s *session) authenticate(username, password string) bool {
+	if username == "" || password == "" {
+		return false
+	}
+	db := s.srv.db
+
+	if ext, domain, ok := strings.Cut(username, "@"); ok {
+		var tenant models.Tenant
+		if err := db.Where("domain = ? AND enabled = ?", domain, true).First(&tenant).Error; err == nil {
+			var box models.VoicemailBox
+			if err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", tenant.ID, ext, true).
+				First(&box).Error; err == nil && box.Password != "" &&
+				subtle.ConstantTimeCompare([]byte(box.Password), []byte(password)) == 1 {
+				s.tenantID, s.domain, s.extension = tenant.ID, tenant.Domain, ext
+				return true
+			}
+		}
+	}
+
+	var user models.User
+	if err := db.Where("username = ? OR email = ?", username, username).First(&user).Error; err != nil {
+		return false
+	}
+	if user.TenantID == nil || user.Extension == "" || !user.CheckPassword(password) {
+		return false
+	}
+	var tenant models.Tenant
+	if err := db.Where("id = ? AND enabled = ?", *user.TenantID, true).First(&tenant).Error; err != nil {
+		return false
+	}
+	s.tenantID, s.domain, s.extension = tenant.ID, tenant.Domain, user.Extension
+	return true
+}
+
+// mailboxes lists the boxes the extension can open: its own as INBOX and
+// each group box it belongs to under Groups/
+func (s *session) mailboxes() []namedBox {
+	db := s.srv.db
+	var out []namedBox
+
+	var own models.VoicemailBox
+	if err := db.Where("tenant_id = ? AND extension = ? AND enabled = ?", s.tenantID, s.extension, true).
+		First(&own).Error; err == nil {
+		out = append(out, namedBox{"INBOX", own})
+	}
+
+	var groups []models.VoicemailBox
+	db.Where("tenant_id = ? AND enabled = ? AND id IN (?)", s.tenantID, true,
+		db.Model(&models.VoicemailBoxMember{}).Select("box_id").Where("tenant_id = ? AND extension = ?", s.tenantID, s.extension)).
+		Order("extension ASC").Find(&groups)
+	for _, g := range groups {
+		if g.ID != own.ID {
+			out = append(out, namedBox{groupFolder + "/" + g.Extension, g})
+		}
+	}
+	return out
+}
+
+// findMailbox resolves a mailbox name; INBOX is case-insensitive
+func (s *session) findMailbox(name string) (*namedBox, bool) {
+	if strings.EqualFold(name, "INBOX") {
+		name = "INBOX"
+	}
+	for _, nb := range s.mailboxes() {
+		if nb.name == name {
+			return &nb, true
+		}
+	}
+	return nil, false
+}
+
+func (s *session) selectBox(tag, command string, args []interface{}) {
+	s.sel = nil
+	readOnly := command == "EXAMINE"
+	if len(args) != 1 {
+		s.bad(tag, command+" needs a mailbox name")
+		return
+	}
+	name, _ := asString(args[0])
+	nb, ok := s.findMailbox(name)
+	if !ok {
+		s.no(tag, "[NONEXISTENT] No such mailbox")
+		return
+	}
+
+	mb := &mailbox{name: nb.name, box: nb.box, readOnly: readOnly, msgs: s.loadEntries(nb.box.ID)}
+	s.sel = mb
+
+	s.writeLine(`* FLAGS (\Seen \Deleted \Flagged)`)
+	s.writeLine(fmt.Sprintf("* %d EXISTS", len(mb.msgs)))
+	s.writeLine("* 0 RECENT")
+	for i, e := range mb.msgs {
+		if !e.seen {
+			s.writeLine(fmt.Sprintf("* OK [UNSEEN %d] First unseen message", i+1))
+			break
+		}
+	}
+	if readOnly {
+		s.writeLine("* OK [PERMANENTFLAGS ()] Read-only mailbox")
+	} else {
+		s.writeLine(`* OK [PERMANENTFLAGS (\Seen \Deleted)] Limited flags`)
+	}
+	s.writeLine(fmt.Sprintf("* OK [UIDVALIDITY %d] UIDs valid", nb.box.ID))
+	s.writeLine(fmt.Sprintf("* OK [UIDNEXT %d] Predicted next UID", s.uidNext()))
+
+	mode := "[READ-WRITE]"
+	if readOnly {
+		mode = "[READ-ONLY]"
+	}
+	s.ok(tag, mode+" "+command+" completed")
+}
+
+// loadEntries reads the flags of a box's messages in UID order
+func (s *session) loadEntries(boxID uint) []*entry {
+	var rows []struct {
+		ID       uint
+		IsNew    bool
+		IsUrgent bool
+	}
+	s.srv.db.Model(&models.VoicemailMessage{}).Select("id, is_new, is_urgent").
+		Where("box_id = ?", boxID).Order("id ASC").Scan(&rows)
+
+	entries := make([]*entry, 0, len(rows))
+	for _, r := range rows {
+		entries = append(entries, &entry{id: r.ID, seen: !r.IsNew, flagged: r.IsUrgent})
+	}
+	return entries
+}
+
+// uidNext predicts the next UID: message IDs are shared by every box, so
+// the next one is past the highest ID in the table
+func (s *session) uidNext() uint {
+	var maxID uint
+	s.srv.db.Unscoped().Model(&models.VoicemailMessage{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID)
+	return maxID + 1
+}
+
+func (s *session) list(tag, name string, args []interface{}) {
+	if len(args) != 2 {
+		s.bad(tag, name+" needs a reference and a mailbox pattern")
+		return
+	}
+	ref, _ := asString(args[0])
+	pattern, _ := asString(args[1])
+	if pattern == "" {
+		// Asks for the hierarchy delimiter
+		s.writeLine(fmt.Sprintf(`* %s (\Noselect) "/" ""`, name))
+		s.ok(tag, name+" completed")
+		return
+	}
+	pattern = ref + pattern
+
+	boxes := s.mailboxes()
+	type item struct{ attrs, name string }
+	var items []item
+	hasGroups := false
+	for _, nb := range boxes {
+		if strings.HasPrefix(nb.name, groupFolder+"/") && !hasGroups {
+			hasGroups = true
+			items = append(items, item{`\Noselect \HasChildren`, groupFolder})
+		}
+		items = append(items, item{`\HasNoChildren`, nb.name})
+	}
+	for _, it := range items {
+		if matchPattern(pattern, it.name) {
+			s.writeLine(fmt.Sprintf(`* %s (%s) "/" %s`, name, it.attrs, quote(it.name)))
+		}
+	}
+	s.ok(tag, name+" completed")
+}
+
+// matchPattern matches a LIST pattern: * matches anything, % anything but
+// the hierarchy delimiter. INBOX matches case-insensitively.
+func matchPattern(pattern, name string) bool {
+	if strings.EqualFold(pattern, "INBOX") && name == "INBOX" {
+		return true
+	}
+	if pattern == "" {
+		return name == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(name); i++ {
+			if matchPattern(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case '%':
+		for i := 0; i <= len(name); i++ {
+			if matchPattern(pattern[1:], name[i:]) {
+				return true
+			}
+			if i < len(name) && name[i] == '/' {
+				return false
+			}
+		}
+		return false
+	}
+	return name != "" && pattern[0] == name[0] && matchPattern(pattern[1:], name[1:])
+}
+
+func (s *session) status(tag string, args []interface{}) {
+	if len(args) != 2 {
+		s.bad(tag, "STATUS needs a mailbox and item list")
+		return
+	}
+	name, _ := asString(args[0])
+	items, ok := args[1].([]interface{})
+	if !ok {
+		s.bad(tag, "STATUS items must be a list")
+		return
+	}
+	nb, found := s.findMailbox(name)
+	if !found {
+		s.no(tag, "[NONEXISTENT] No such mailbox")
+		return
+	}
+
+	entries := s.loadEntries(nb.box.ID)
+	unseen := 0
+	for _, e := range entries {
+		if !e.seen {
+			unseen++
+		}
+	}
+	var out []string
+	for _, it := range items {
+		item, _ := asString(it)
+		switch strings.ToUpper(item) {
+		case "MESSAGES":
+			out = append(out, fmt.Sprintf("MESSAGES %d", len(entries)))
+		case "RECENT":
+			out = append(out, "RECENT 0")
+		case "UIDNEXT":
+			out = append(out, fmt.Sprintf("UIDNEXT %d", s.uidNext()))
+		case "UIDVALIDITY":
+			out = append(out, fmt.Sprintf("UIDVALIDITY %d", nb.box.ID))
+		case "UNSEEN":
+			out = append(out, fmt.Sprintf("UNSEEN %d", unseen))
+		default:
+			s.bad(tag, "Unknown STATUS item "+item)
+			return
+		}
+	}
+	s.writeLine(fmt.Sprintf("* STATUS %s (%s)", quote(nb.name), strings.Join(out, " ")))
+	s.ok(tag, "STATUS completed")
+}
+
+// idle reports mailbox changes until the client sends DONE
+func (s *session) idle(tag string) bool {
+	s.writeLine("+ idling")
+	started := time.Now()
+	var line string
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(pollInterval))
+		part, err := s.reader.ReadString('\n')
+		line += part
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && time.Since(started) < idleTimeout {
+				s.sync(true)
+				continue
+			}
+			return false
+		}
+		if strings.EqualFold(strings.TrimSpace(line), "DONE") {
+			s.ok(tag, "IDLE terminated")
+		} else {
+			s.bad(tag, "Expected DONE")
+		}
+		return true
+	}
+}
+
+// sync tells the client about changes made by phones, the API or other
+// clients: new messages, flag changes and, where allowed, removals
+func (s *session) sync(allowExpunge bool) {
+	mb := s.sel
+	if mb == nil {
+		return
+	}
+	current := make(map[uint]*entry)
+	rows := s.loadEntries(mb.box.ID)
+	for _, e := range rows {
+		current[e.id] = e
+	}
+
+	for i := len(mb.msgs) - 1; i >= 0; i-- {
+		e := mb.msgs[i]
+		if _, ok := current[e.id]; ok {
+			continue
+		}
+		if allowExpunge {
+			s.writeLine(fmt.Sprintf("* %d EXPUNGE", i+1))
+			mb.msgs = append(mb.msgs[:i], mb.msgs[i+1:]...)
+		} else {
+			e.gone = true
+		}
+	}
+
+	known := make(map[uint]bool, len(mb.msgs))
+	for i, e := range mb.msgs {
+		known[e.id] = true
+		if c, ok := current[e.id]; ok && (c.seen != e.seen || c.flagged != e.flagged) {
+			e.seen, e.flagged = c.seen, c.flagged
+			s.writeLine(fmt.Sprintf("* %d FETCH (FLAGS %s)", i+1, e.flags()))
+		}
+	}
+
+	added := false
+	for _, e := range rows {
+		if !known[e.id] {
+			mb.msgs = append(mb.msgs, e)
+			added = true
+		}
+	}
+	if added {
+		s.writeLine(fmt.Sprintf("* %d EXISTS", len(mb.msgs)))
+	}
+}
+
+func (s *session) writeLine(line string) {
+	s.writer.WriteString(line)
+	s.writer.WriteString("\r\n")
+	s.writer.Flush()
+}
+
+func (s *session) ok(tag, text string) {
+	s.writeLine(tag + " OK " + text)
+}
+
+func (s *session) no(tag, text string) {
+	s.writeLine(tag + " NO " + text)
+}
+
+func (s *session) bad(tag, text string) {
+	s.writeLine(tag + " BAD " + text)
+}
@@ -0,0 +1,76 @@
+package imap
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// loginWindow is how long failed logins count against an account or
+	// address, and how long one stays locked once over its limit
+	loginWindow = 15 * time.Minute
+	// maxAccountFailures locks a username after this many bad logins, from
+	// any number of connections, so short PINs can't be brute-forced
+	maxAccountFailures = 5
+	// maxAddrFailures locks a client address trying many usernames
+	maxAddrFailures = 20
+)
+
+// loginThrottle counts failed logins per username and per client address
+// across connections
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count int
+	since time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{failures: make(map[string]*loginFailures)}
+}
+
+// locked reports whether the username or address is over its limit
+func (t *loginThrottle) locked(username, addr string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count("user:"+username, now) >= maxAccountFailures ||
+		t.count("addr:"+addr, now) >= maxAddrFailures
+}
+
+// fail records a failed login
+func (t *loginThrottle) fail(username, addr string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, f := range t.failures {
+		if now.Sub(f.since) > loginWindow {
+			delete(t.failures, key)
+		}
+	}
+	for _, key := range []string{"user:" + username, "addr:" + addr} {
+		f := t.failures[key]
+		if f == nil {
+			f = &loginFailures{since: now}
+			t.failures[key] = f
+		}
+		f.count++
+	}
+}
+
+// succeed clears the failures of a username that logged in
+func (t *loginThrottle) succeed(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, "user:"+username)
+}
+
+// count returns the failures of key within the window; call with mu held
+func (t *loginThrottle) count(key string, now time.Time) int {
+	f := t.failures[key]
+	if f == nil || now.Sub(f.since) > loginWindow {
+		return 0
+	}
+	return f.count
+}
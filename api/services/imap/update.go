@@ -0,0 +1,181 @@
+package imap
+
+import (
+	"callsign/models"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// store applies STORE: \Seen maps to the message's read state and \Deleted
+// marks it for EXPUNGE. Other flags are not kept.
+func (s *session) store(tag string, args []interface{}, uid bool) {
+	if len(args) < 3 {
+		s.bad(tag, "STORE needs a sequence set, an item and flags")
+		return
+	}
+	if s.sel.readOnly {
+		s.no(tag, "[READ-ONLY] Mailbox is read-only")
+		return
+	}
+	setStr, _ := asString(args[0])
+	set, err := parseSeqSet(setStr)
+	if err != nil {
+		s.bad(tag, err.Error())
+		return
+	}
+	item, _ := asString(args[1])
+	item = strings.ToUpper(item)
+	silent := strings.HasSuffix(item, ".SILENT")
+	mode := strings.TrimSuffix(item, ".SILENT")
+	if mode != "FLAGS" && mode != "+FLAGS" && mode != "-FLAGS" {
+		s.bad(tag, "Unknown STORE item "+item)
+		return
+	}
+
+	var seen, deleted bool
+	for _, f := range flattenFlags(args[2:]) {
+		switch strings.ToUpper(f) {
+		case `\SEEN`:
+			seen = true
+		case `\DELETED`:
+			deleted = true
+		}
+	}
+
+	seqs, entries := s.selected(set, uid)
+	changed := false
+	for i, e := range entries {
+		if e.gone {
+			continue
+		}
+		wantSeen, wantDeleted := e.seen, e.deleted
+		switch mode {
+		case "FLAGS":
+			wantSeen, wantDeleted = seen, deleted
+		case "+FLAGS":
+			wantSeen, wantDeleted = e.seen || seen, e.deleted || deleted
+		case "-FLAGS":
+			wantSeen, wantDeleted = e.seen && !seen, e.deleted && !deleted
+		}
+
+		if wantSeen != e.seen && s.setSeen(e.id, wantSeen) {
+			e.seen, changed = wantSeen, true
+		}
+		e.deleted = wantDeleted
+
+		if !silent {
+			if uid {
+				s.writeLine(fmt.Sprintf("* %d FETCH (FLAGS %s UID %d)", seqs[i], e.flags(), e.id))
+			} else {
+				s.writeLine(fmt.Sprintf("* %d FETCH (FLAGS %s)", seqs[i], e.flags()))
+			}
+		}
+	}
+
+	if changed {
+		s.srv.notifyMWI(&s.sel.box)
+	}
+	s.sync(false)
+	s.ok(tag, "STORE completed")
+}
+
+// flattenFlags collects flags given as a list or as bare atoms
+func flattenFlags(args []interface{}) []string {
+	var flags []string
+	for _, a := range args {
+		switch v := a.(type) {
+		case string:
+			flags = append(flags, v)
+		case []interface{}:
+			flags = append(flags, flattenFlags(v)...)
+		}
+	}
+	return flags
+}
+
+// setSeen marks a message read, as playing it on the phone does, or new again
+func (s *session) setSeen(id uint, seen bool) bool {
+	msg, ok := s.loadMessage(id)
+	if !ok {
+		return false
+	}
+	if seen {
+		return msg.MarkAsRead(s.srv.db) == nil
+	}
+	return s.srv.db.Model(msg).Updates(map[string]interface{}{"is_new": true, "read_at": nil}).Error == nil
+}
+
+// expunge deletes the messages flagged \Deleted, keeping recordings that
+// forwarded copies still play. With report the client is told of each.
+func (s *session) expunge(report bool) {
+	mb := s.sel
+	deleted := false
+	for i := len(mb.msgs) - 1; i >= 0; i-- {
+		e := mb.msgs[i]
+		if !e.deleted {
+			continue
+		}
+		if msg, ok := s.loadMessage(e.id); ok {
+			if err := s.srv.db.Delete(msg).Error; err != nil {
+				s.logger.WithError(err).Warn("IMAP: failed to delete voicemail message")
+				continue
+			}
+			for _, path := range []string{msg.FilePath, msg.IntroPath} {
+				if path != "" && !models.VoicemailFileInUse(s.srv.db, path, msg.ID) {
+					s.srv.store.Delete(context.Background(), path)
+				}
+			}
+			deleted = true
+		}
+		if report {
+			s.writeLine(fmt.Sprintf("* %d EXPUNGE", i+1))
+		}
+		mb.msgs = append(mb.msgs[:i], mb.msgs[i+1:]...)
+	}
+
+	if deleted {
+		s.logger.WithField("box", mb.box.Extension).Info("IMAP: expunged voicemail messages")
+		s.srv.notifyMWI(&mb.box)
+	}
+}
+
+// copy delivers copies of messages to another mailbox the extension can
+// open, like forwarding from the phone
+func (s *session) copy(tag string, args []interface{}, uid bool) {
+	if len(args) != 2 {
+		s.bad(tag, "COPY needs a sequence set and a mailbox")
+		return
+	}
+	setStr, _ := asString(args[0])
+	set, err := parseSeqSet(setStr)
+	if err != nil {
+		s.bad(tag, err.Error())
+		return
+	}
+	name, _ := asString(args[1])
+	target, ok := s.findMailbox(name)
+	if !ok {
+		s.no(tag, "[TRYCREATE] No such mailbox")
+		return
+	}
+
+	_, entries := s.selected(set, uid)
+	copied := 0
+	for _, e := range entries {
+		msg, ok := s.loadMessage(e.id)
+		if !ok {
+			continue
+		}
+		if _, err := msg.CopyTo(s.srv.db, &target.box, s.extension, msg.IntroPath); err != nil {
+			s.logger.WithError(err).Warn("IMAP: failed to copy voicemail message")
+			s.no(tag, "COPY failed")
+			return
+		}
+		copied++
+	}
+	if copied > 0 && s.srv.mwi != nil {
+		s.srv.mwi.SendVoicemailMWI(&target.box)
+	}
+	s.ok(tag, "COPY completed")
+}
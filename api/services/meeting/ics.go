@@ -0,0 +1,149 @@
+package meeting
+
+import (
+	"callsign/models"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar methods of the invites sent to attendees
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+// icsTimeLayout is the iCalendar UTC date-time format
+const icsTimeLayout = "20060102T150405Z"
+
+// BuildICS renders a meeting as an iCalendar object for one recipient,
+// whose copy carries their PIN. A nil recipient (e.g. the organizer's
+// download) gets the moderator PIN. Removed attendees and cancelled
+// meetings get a CANCEL.
+func BuildICS(meeting *models.ConferenceMeeting, room *models.Conference, domain string, recipient *models.ConferenceMeetingAttendee, method string) []byte {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("PRODID:-//CallSign PBX//Conference Scheduling//EN")
+	line("VERSION:2.0")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:" + method)
+	line("BEGIN:VEVENT")
+	line(fmt.Sprintf("UID:%s@%s", meeting.UUID, domain))
+	line(fmt.Sprintf("SEQUENCE:%d", meeting.Sequence))
+	line("DTSTAMP:" + time.Now().UTC().Format(icsTimeLayout))
+	line("DTSTART:" + meeting.StartAt.UTC().Format(icsTimeLayout))
+	line("DTEND:" + meeting.EndAt.UTC().Format(icsTimeLayout))
+	line("SUMMARY:" + escapeText(meeting.Title))
+	line("LOCATION:" + escapeText("Conference "+dialInNumber(meeting, room)))
+	line("DESCRIPTION:" + escapeText(Describe(meeting, room, recipient, time.UTC)))
+
+	if meeting.OrganizerEmail != "" {
+		line("ORGANIZER" + cnParam(meeting.OrganizerName) + ":mailto:" + meeting.OrganizerEmail)
+	}
+	for _, a := range meeting.Attendees {
+		if a.Email == "" || a.Removed && (recipient == nil || a.ID != recipient.ID) {
+			continue
+		}
+		role := "REQ-PARTICIPANT"
+		if a.Moderator {
+			role = "CHAIR"
+		}
+		line(fmt.Sprintf("ATTENDEE%s;ROLE=%s;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:%s", cnParam(a.Name), role, a.Email))
+	}
+
+	if method == MethodCancel {
+		line("STATUS:CANCELLED")
+	} else {
+		line("STATUS:CONFIRMED")
+		if meeting.ReminderMinutes > 0 {
+			line("BEGIN:VALARM")
+			line(fmt.Sprintf("TRIGGER:-PT%dM", meeting.ReminderMinutes))
+			line("ACTION:DISPLAY")
+			line("DESCRIPTION:" + escapeText(meeting.Title))
+			line("END:VALARM")
+		}
+	}
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// Describe is the plain-text summary of how to join, used as the invite's
+// email body and calendar description. Times are shown in loc.
+func Describe(meeting *models.ConferenceMeeting, room *models.Conference, recipient *models.ConferenceMeetingAttendee, loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", meeting.Title)
+	fmt.Fprintf(&b, "When: %s - %s (%s)\n",
+		meeting.StartAt.In(loc).Format("Mon Jan 2, 2006 15:04"),
+		meeting.EndAt.In(loc).Format("15:04"), loc)
+	if meeting.OrganizerName != "" {
+		fmt.Fprintf(&b, "Organizer: %s\n", meeting.OrganizerName)
+	}
+	fmt.Fprintf(&b, "\nDial in: %s\n", dialInNumber(meeting, room))
+
+	if recipient == nil || recipient.Moderator {
+		fmt.Fprintf(&b, "Moderator PIN: %s\n", meeting.ModeratorPIN)
+	} else {
+		fmt.Fprintf(&b, "PIN: %s\n", meeting.PIN)
+	}
+	if recipient != nil && recipient.DialOut && recipient.Phone != "" {
+		fmt.Fprintf(&b, "You will be called at %s when the meeting starts.\n", recipient.Phone)
+	}
+	fmt.Fprintf(&b, "The PIN works from %d minutes before the start until the meeting ends.\n",
+		int(models.MeetingEarlyJoin/time.Minute))
+
+	if meeting.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", meeting.Description)
+	}
+	return b.String()
+}
+
+// dialInNumber is the number attendees call to reach the room
+func dialInNumber(meeting *models.ConferenceMeeting, room *models.Conference) string {
+	if meeting.DialInNumber != "" {
+		return meeting.DialInNumber
+	}
+	return room.Extension
+}
+
+// cnParam renders a CN parameter, quoted as names may contain separators
+func cnParam(name string) string {
+	name = strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(name)
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + name + `"`
+}
+
+// escapeText escapes an iCalendar TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// fold splits a content line into 75-octet pieces without breaking UTF-8
+// sequences, continuing each with a leading space
+func fold(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // Continuation lines spend one octet on the space
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package meeting_test
+
+import (
+	"callsign/models"
+	"callsign/services/meeting"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unfold joins folded iCalendar lines back together
+func unfold(ics string) string {
+	return strings.ReplaceAll(ics, "\r\n ", "")
+}
+
+func testMeeting() (*models.ConferenceMeeting, *models.Conference) {
+	start := time.Date(2026, 11, 3, 15, 0, 0, 0, time.UTC)
+	m := &models.ConferenceMeeting{
+		ID:              7,
+		UUID:            uuid.MustParse("7f1d3a52-8c4e-4a55-9a53-1b2c3d4e5f60"),
+		Title:           "Quarterly review; budget, hiring",
+		Description:     "Agenda:\n1. Numbers\n2. Plans for the next quarter with a very long line that needs folding in the calendar",
+		OrganizerName:   "Ann Lee",
+		OrganizerEmail:  "ann@acme.test",
+		StartAt:         start,
+		EndAt:           start.Add(time.Hour),
+		PIN:             "123456",
+		ModeratorPIN:    "87654321",
+		ReminderMinutes: 15,
+		Sequence:        2,
+		Status:          models.MeetingScheduled,
+		Attendees: []models.ConferenceMeetingAttendee{
+			{ID: 1, Name: "Bob", Email: "bob@acme.test"},
+			{ID: 2, Name: "Cy", Email: "cy@acme.test", Moderator: true, Phone: "1002", DialOut: true},
+			{ID: 3, Name: "Dee", Email: "dee@acme.test", Removed: true},
+		},
+	}
+	return m, &models.Conference{Extension: "3000"}
+}
+
+func TestBuildICSRequest(t *testing.T) {
+	m, room := testMeeting()
+	raw := string(meeting.BuildICS(m, room, "acme.test", &m.Attendees[0], meeting.MethodRequest))
+
+	for _, line := range strings.Split(strings.TrimSuffix(raw, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, "line not folded: %q", line)
+	}
+
+	ics := unfold(raw)
+	assert.Contains(t, ics, "METHOD:REQUEST\r\n")
+	assert.Contains(t, ics, "UID:7f1d3a52-8c4e-4a55-9a53-1b2c3d4e5f60@acme.test\r\n")
+	assert.Contains(t, ics, "SEQUENCE:2\r\n")
+	assert.Contains(t, ics, "DTSTART:20261103T150000Z\r\n")
+	assert.Contains(t, ics, "DTEND:20261103T160000Z\r\n")
+	assert.Contains(t, ics, `SUMMARY:Quarterly review\; budget\, hiring`)
+	assert.Contains(t, ics, `ORGANIZER;CN="Ann Lee":mailto:ann@acme.test`)
+	assert.Contains(t, ics, `ROLE=CHAIR;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:cy@acme.test`)
+	assert.NotContains(t, ics, "dee@acme.test", "removed attendees are left off")
+	assert.Contains(t, ics, "TRIGGER:-PT15M")
+	assert.Contains(t, ics, "STATUS:CONFIRMED")
+
+	// Participants get the participant PIN only
+	assert.Contains(t, ics, `Dial in: 3000\nPIN: 123456\n`)
+	assert.NotContains(t, ics, "87654321")
+}
+
+func TestBuildICSModeratorAndCancel(t *testing.T) {
+	m, room := testMeeting()
+
+	ics := unfold(string(meeting.BuildICS(m, room, "acme.test", &m.Attendees[1], meeting.MethodRequest)))
+	assert.Contains(t, ics, `Moderator PIN: 87654321`)
+	assert.Contains(t, ics, `You will be called at 1002 when the meeting starts.`)
+
+	ics = unfold(string(meeting.BuildICS(m, room, "acme.test", &m.Attendees[2], meeting.MethodCancel)))
+	assert.Contains(t, ics, "METHOD:CANCEL\r\n")
+	assert.Contains(t, ics, "STATUS:CANCELLED\r\n")
+	assert.Contains(t, ics, "mailto:dee@acme.test", "a removed recipient is named in their own cancellation")
+	assert.NotContains(t, ics, "VALARM")
+}
+
+func TestMeetingIsOpen(t *testing.T) {
+	m, _ := testMeeting()
+	require.Equal(t, 10*time.Minute, models.MeetingEarlyJoin)
+
+	assert.False(t, m.IsOpen(m.StartAt.Add(-11*time.Minute)))
+	assert.True(t, m.IsOpen(m.StartAt.Add(-10*time.Minute)), "PINs open early")
+	assert.True(t, m.IsOpen(m.EndAt.Add(-time.Second)))
+	assert.False(t, m.IsOpen(m.EndAt))
+
+	m.Status = models.MeetingCancelled
+	assert.False(t, m.IsOpen(m.StartAt))
+}
+
+func TestValidPhone(t *testing.T) {
+	for _, phone := range []string{"1001", "+15551234567", "0044207946000"} {
+		assert.True(t, meeting.ValidPhone(phone), phone)
+	}
+	for _, phone := range []string{"", "+", "555 1234", "1001&bridge", "1001,foo=bar", "1001}", "+1-555-1234"} {
+		assert.False(t, meeting.ValidPhone(phone), phone)
+	}
+}
@@ -0,0 +1,456 @@
+// Package meeting runs scheduled conference meetings: it emails calendar
+// invites and reminders and dials attendees into the room at start time.
+package meeting
+
+import (
+	"callsign/models"
+	"callsign/services/email"
+	"callsign/services/esl"
+	confmod "callsign/services/esl/modules/conference"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fiorix/go-eventsocket/eventsocket"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// ringTimeout is how long an attendee's phone rings per attempt
+	ringTimeout = 45
+	// maxDialAttempts bounds how often an unanswered attendee is dialed
+	maxDialAttempts = 3
+	// retryDelay is the wait before dialing an unanswered attendee again
+	retryDelay = 2 * time.Minute
+	// batchSize bounds the invites and calls handled per poll
+	batchSize = 100
+)
+
+// callResult is the outcome of one dial-out, delivered by the answer or
+// hangup event, whichever comes first
+type callResult struct {
+	cause    string
+	answered bool
+}
+
+// Scheduler drives meetings through their lifecycle. All state lives on
+// the meeting and attendee rows, so nothing is lost across restarts: invites
+// and cancellations go out while attendees are pending, reminders fire once,
+// and at start time attendees marked for dial-out are called into the room
+// through the conference ESL module, retrying unanswered calls.
+type Scheduler struct {
+	db    *gorm.DB
+	esl   *esl.Manager
+	email *email.Service
+
+	// Dial-outs waiting for their answer or hangup, keyed by channel UUID
+	pending   map[string]chan callResult
+	pendingMu sync.Mutex
+}
+
+// NewScheduler creates a meeting scheduler. Mail goes through each tenant's
+// own SMTP server when configured, else emailService (which may be nil).
+func NewScheduler(db *gorm.DB, eslManager *esl.Manager, emailService *email.Service) *Scheduler {
+	return &Scheduler{
+		db:      db,
+		esl:     eslManager,
+		email:   emailService,
+		pending: make(map[string]chan callResult),
+	}
+}
+
+// Start registers for call results and polls for due work.
+func (s *Scheduler) Start(interval time.Duration) {
+	if s.esl != nil {
+		s.esl.On("CHANNEL_ANSWER", s.handleCallEvent)
+		s.esl.On("CHANNEL_HANGUP_COMPLETE", s.handleCallEvent)
+	}
+
+	// Calls in flight when the server stopped never reported back; redial them
+	s.db.Model(&models.ConferenceMeetingAttendee{}).
+		Where("dial_status = ?", models.MeetingDialDialing).
+		Updates(map[string]interface{}{"dial_status": models.MeetingDialRetry, "next_dial_at": time.Now()})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.poll()
+		}
+	}()
+	log.Infof("Conference meeting scheduler started (interval: %s)", interval)
+}
+
+func (s *Scheduler) poll() {
+	now := time.Now()
+	s.sendInvites()
+	s.sendReminders(now)
+	s.startMeetings(now)
+	s.dialAttendees(now)
+	s.finishMeetings(now)
+}
+
+// meetingContext is a meeting with what its mail and calls need
+type meetingContext struct {
+	meeting models.ConferenceMeeting
+	room    models.Conference
+	tenant  models.Tenant
+}
+
+// load reads a meeting with its room, tenant and current attendees
+func (s *Scheduler) load(meetingID uint) (*meetingContext, error) {
+	mc := &meetingContext{}
+	if err := s.db.Preload("Attendees").First(&mc.meeting, meetingID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Unscoped().First(&mc.room, mc.meeting.ConferenceID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.First(&mc.tenant, mc.meeting.TenantID).Error; err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+// mailer returns the service that sends the tenant's mail, or nil
+func (s *Scheduler) mailer(tenant *models.Tenant) *email.Service {
+	mailer := email.ForTenant(tenant.Settings, s.email)
+	if mailer == nil || !mailer.IsEnabled() {
+		return nil
+	}
+	return mailer
+}
+
+// sendInvites emails pending invitations, updates and cancellations
+func (s *Scheduler) sendInvites() {
+	var attendees []models.ConferenceMeetingAttendee
+	if err := s.db.Where("invite_status IN ?",
+		[]string{models.MeetingInvitePending, models.MeetingInviteCancelPending}).
+		Order("meeting_id, id").Limit(batchSize).Find(&attendees).Error; err != nil {
+		log.Warnf("Meeting scheduler: failed to load invites: %v", err)
+		return
+	}
+
+	var mc *meetingContext
+	for _, a := range attendees {
+		if mc == nil || mc.meeting.ID != a.MeetingID {
+			var err error
+			if mc, err = s.load(a.MeetingID); err != nil {
+				s.db.Model(&a).Updates(map[string]interface{}{
+					"invite_status": models.MeetingInviteFailed,
+					"invite_error":  "meeting not found",
+				})
+				mc = nil
+				continue
+			}
+		}
+		s.sendInvite(mc, a)
+	}
+}
+
+// sendInvite sends one attendee their copy of the meeting
+func (s *Scheduler) sendInvite(mc *meetingContext, a models.ConferenceMeetingAttendee) {
+	m := &mc.meeting
+	cancel := a.Removed || a.InviteStatus == models.MeetingInviteCancelPending || m.Status == models.MeetingCancelled
+
+	method, subject, done := MethodRequest, "Invitation: "+m.Title, models.MeetingInviteSent
+	body := Describe(m, &mc.room, &a, mc.tenant.Location())
+	switch {
+	case cancel:
+		method, subject, done = MethodCancel, "Cancelled: "+m.Title, models.MeetingInviteCancelled
+		body = "This meeting has been cancelled.\n\n" + body
+	case m.Sequence > 0:
+		subject = "Updated invitation: " + m.Title
+	}
+
+	// Only the status this pass read is replaced, so an attendee re-queued
+	// by an edit meanwhile gets the newer invite on the next poll
+	scope := s.db.Model(&models.ConferenceMeetingAttendee{}).
+		Where("id = ? AND invite_status = ?", a.ID, a.InviteStatus)
+
+	mailer := s.mailer(&mc.tenant)
+	if mailer == nil {
+		scope.Updates(map[string]interface{}{
+			"invite_status": models.MeetingInviteFailed,
+			"invite_error":  "email is not configured",
+		})
+		return
+	}
+
+	ics := BuildICS(m, &mc.room, mc.tenant.Domain, &a, method)
+	if err := mailer.SendCalendarInvite(a.Email, subject, body, ics, method); err != nil {
+		scope.Updates(map[string]interface{}{
+			"invite_status": models.MeetingInviteFailed,
+			"invite_error":  err.Error(),
+		})
+		return
+	}
+
+	if a.Removed {
+		s.db.Delete(&models.ConferenceMeetingAttendee{}, a.ID)
+		return
+	}
+	scope.Updates(map[string]interface{}{
+		"invite_status": done,
+		"invite_error":  "",
+		"invited_at":    time.Now(),
+	})
+}
+
+// sendReminders emails attendees once a meeting's reminder time arrives
+func (s *Scheduler) sendReminders(now time.Time) {
+	var meetings []models.ConferenceMeeting
+	if err := s.db.Where("status = ? AND reminder_minutes > 0 AND reminder_sent_at IS NULL AND start_at > ?",
+		models.MeetingScheduled, now).Find(&meetings).Error; err != nil {
+		log.Warnf("Meeting scheduler: failed to load reminders: %v", err)
+		return
+	}
+
+	for _, m := range meetings {
+		remindAt := m.StartAt.Add(-time.Duration(m.ReminderMinutes) * time.Minute)
+		if now.Before(remindAt) {
+			continue
+		}
+		claimed := s.db.Model(&models.ConferenceMeeting{}).
+			Where("id = ? AND reminder_sent_at IS NULL", m.ID).
+			Update("reminder_sent_at", now)
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+		// Meetings booked inside their reminder window only get the invite
+		if m.CreatedAt.After(remindAt) {
+			continue
+		}
+
+		mc, err := s.load(m.ID)
+		if err != nil {
+			continue
+		}
+		mailer := s.mailer(&mc.tenant)
+		if mailer == nil {
+			continue
+		}
+		loc := mc.tenant.Location()
+		subject := fmt.Sprintf("Reminder: %s at %s", m.Title, m.StartAt.In(loc).Format("15:04"))
+		for _, a := range mc.meeting.Attendees {
+			if a.Email == "" || a.Removed {
+				continue
+			}
+			mailer.SendMeetingReminder(a.Email, subject, Describe(&mc.meeting, &mc.room, &a, loc))
+		}
+		log.WithField("meeting_id", m.ID).Info("Meeting reminders sent")
+	}
+}
+
+// startMeetings marks meetings whose start time has come as in progress
+// and queues their dial-out attendees
+func (s *Scheduler) startMeetings(now time.Time) {
+	var meetings []models.ConferenceMeeting
+	if err := s.db.Where("status = ? AND start_at <= ? AND end_at > ?", models.MeetingScheduled, now, now).
+		Find(&meetings).Error; err != nil {
+		log.Warnf("Meeting scheduler: failed to load meetings: %v", err)
+		return
+	}
+
+	for _, m := range meetings {
+		claimed := s.db.Model(&models.ConferenceMeeting{}).
+			Where("id = ? AND status = ?", m.ID, models.MeetingScheduled).
+			Updates(map[string]interface{}{"status": models.MeetingInProgress, "started_at": now})
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+
+		queued := s.db.Model(&models.ConferenceMeetingAttendee{}).
+			Where("meeting_id = ? AND dial_out = ? AND removed = ? AND phone <> ''", m.ID, true, false).
+			Updates(map[string]interface{}{
+				"dial_status":   models.MeetingDialPending,
+				"dial_attempts": 0,
+				"next_dial_at":  now,
+			})
+		log.WithFields(log.Fields{
+			"meeting_id": m.ID,
+			"dial_outs":  queued.RowsAffected,
+		}).Info("Conference meeting started")
+	}
+}
+
+// dialAttendees places due dial-out calls while their meeting is open
+func (s *Scheduler) dialAttendees(now time.Time) {
+	if s.esl == nil || !s.esl.IsConnected() {
+		return
+	}
+
+	var attendees []models.ConferenceMeetingAttendee
+	if err := s.db.Where("next_dial_at <= ?", now).Limit(batchSize).Find(&attendees).Error; err != nil {
+		log.Warnf("Meeting scheduler: failed to load dial-outs: %v", err)
+		return
+	}
+
+	for _, a := range attendees {
+		mc, err := s.load(a.MeetingID)
+		if err != nil || !mc.meeting.IsOpen(now) || a.Removed || !ValidPhone(a.Phone) {
+			s.db.Model(&models.ConferenceMeetingAttendee{}).Where("id = ?", a.ID).
+				Updates(map[string]interface{}{"next_dial_at": nil, "dial_status": models.MeetingDialFailed})
+			continue
+		}
+
+		// Claim the attendee so the next poll doesn't dial them again
+		a.CallUUID = uuid.New().String()
+		claimed := s.db.Model(&models.ConferenceMeetingAttendee{}).
+			Where("id = ? AND next_dial_at = ?", a.ID, a.NextDialAt).
+			Updates(map[string]interface{}{
+				"next_dial_at":  nil,
+				"dial_attempts": gorm.Expr("dial_attempts + 1"),
+				"dial_status":   models.MeetingDialDialing,
+				"last_dial_at":  now,
+				"call_uuid":     a.CallUUID,
+			})
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+		a.DialAttempts++
+
+		go s.dial(mc, a)
+	}
+}
+
+// dial calls an attendee and hands the answered call to the conference
+// module, which admits it without a PIN
+func (s *Scheduler) dial(mc *meetingContext, a models.ConferenceMeetingAttendee) {
+	result := make(chan callResult, 1)
+	s.pendingMu.Lock()
+	s.pending[a.CallUUID] = result
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, a.CallUUID)
+		s.pendingMu.Unlock()
+	}()
+
+	// Dial through the tenant's dialplan so extensions and outbound routes
+	// both work
+	cmd := fmt.Sprintf(
+		"originate {origination_uuid=%s,conference_number=%s,conference_meeting_id=%d,conference_attendee_id=%d,domain_name=%s,tenant_id=%d,origination_caller_id_name='%s',origination_caller_id_number=%s,originate_timeout=%d,ignore_early_media=true}loopback/%s/%s &socket(%s async full)",
+		a.CallUUID,
+		mc.room.Extension,
+		mc.meeting.ID,
+		a.ID,
+		mc.tenant.Domain,
+		mc.tenant.ID,
+		callerIDName(mc.meeting.Title),
+		mc.room.Extension,
+		ringTimeout,
+		a.Phone,
+		mc.tenant.Domain,
+		confmod.ServiceAddress,
+	)
+
+	log.WithFields(log.Fields{
+		"meeting_id":  mc.meeting.ID,
+		"attendee_id": a.ID,
+		"phone":       a.Phone,
+		"attempt":     a.DialAttempts,
+	}).Info("Dialing meeting attendee")
+
+	var res callResult
+	if _, err := s.esl.BgAPI(cmd); err != nil {
+		log.Errorf("Meeting dial-out failed to originate: %v", err)
+		res = callResult{cause: "ORIGINATE_FAILED"}
+	} else {
+		select {
+		case res = <-result:
+		case <-time.After(ringTimeout*time.Second + time.Minute):
+			log.WithField("call_uuid", a.CallUUID).Warn("Meeting dial-out result not received")
+			res = callResult{cause: "RESULT_TIMEOUT"}
+		}
+	}
+	s.recordResult(&mc.meeting, a, res)
+}
+
+// handleCallEvent delivers the first answer or hangup of a dial-out to its
+// waiter
+func (s *Scheduler) handleCallEvent(ev *eventsocket.Event, _ *esl.CallSession) {
+	callUUID := ev.Get("Unique-ID")
+	s.pendingMu.Lock()
+	result, ok := s.pending[callUUID]
+	s.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	res := callResult{cause: ev.Get("Hangup-Cause")}
+	if ev.Get("Event-Name") == "CHANNEL_ANSWER" {
+		res.answered = true
+	} else {
+		answered := ev.Get("Caller-Channel-Answered-Time")
+		res.answered = answered != "" && answered != "0"
+	}
+	select {
+	case result <- res:
+	default:
+	}
+}
+
+// recordResult stores a dial-out outcome, retrying unanswered calls while
+// attempts remain and the meeting is still open
+func (s *Scheduler) recordResult(meeting *models.ConferenceMeeting, a models.ConferenceMeetingAttendee, res callResult) {
+	updates := map[string]interface{}{"hangup_cause": res.cause}
+	next := time.Now().Add(retryDelay)
+	switch {
+	case res.answered:
+		updates["dial_status"] = models.MeetingDialAnswered
+	case a.DialAttempts < maxDialAttempts && meeting.IsOpen(next):
+		updates["dial_status"] = models.MeetingDialRetry
+		updates["next_dial_at"] = next
+	default:
+		updates["dial_status"] = models.MeetingDialFailed
+	}
+
+	// A redial requested meanwhile owns the attendee now
+	s.db.Model(&models.ConferenceMeetingAttendee{}).
+		Where("id = ? AND call_uuid = ?", a.ID, a.CallUUID).
+		Updates(updates)
+
+	log.WithFields(log.Fields{
+		"meeting_id":   meeting.ID,
+		"attendee_id":  a.ID,
+		"hangup_cause": res.cause,
+		"status":       updates["dial_status"],
+	}).Info("Meeting dial-out finished")
+}
+
+// finishMeetings completes meetings whose end time has passed
+func (s *Scheduler) finishMeetings(now time.Time) {
+	s.db.Model(&models.ConferenceMeeting{}).
+		Where("status IN ? AND end_at <= ?",
+			[]models.ConferenceMeetingStatus{models.MeetingScheduled, models.MeetingInProgress}, now).
+		Update("status", models.MeetingCompleted)
+}
+
+// callerIDName makes a meeting title safe for an originate variable
+func callerIDName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '\'', '"', ',', '{', '}', '[', ']', '\\':
+			return -1
+		}
+		return r
+	}, title)
+	if runes := []rune(name); len(runes) > 40 {
+		name = string(runes[:40])
+	}
+	return strings.TrimSpace(name)
+}
+
+// phonePattern is a dialable number: digits with an optional leading +
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{1,20}$`)
+
+// ValidPhone reports whether phone can be dialed. Anything else could
+// change the originate command it is placed in.
+func ValidPhone(phone string) bool {
+	return phonePattern.MatchString(phone)
+}
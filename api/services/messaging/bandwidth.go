@@ -0,0 +1,272 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bandwidthAPIBase = "https://messaging.bandwidth.com/api/v2"
+)
+
+// BandwidthProvider implements SMSProvider for the Bandwidth Messaging v2 API
+type BandwidthProvider struct {
+	accountID     string
+	username      string
+	password      string
+	applicationID string
+	baseURL       string
+	httpClient    *http.Client
+}
+
+// NewBandwidthProvider creates a new Bandwidth provider. baseURL overrides
+// the API base and may be empty.
+func NewBandwidthProvider(accountID, username, password, applicationID, baseURL string) *BandwidthProvider {
+	if baseURL == "" {
+		baseURL = bandwidthAPIBase
+	}
+	return &BandwidthProvider{
+		accountID:     accountID,
+		username:      username,
+		password:      password,
+		applicationID: applicationID,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (b *BandwidthProvider) Name() string {
+	return "bandwidth"
+}
+
+// bandwidthSendRequest is the Bandwidth message send payload
+type bandwidthSendRequest struct {
+	ApplicationID string   `json:"applicationId"`
+	To            []string `json:"to"`
+	From          string   `json:"from"`
+	Text          string   `json:"text,omitempty"`
+	Media         []string `json:"media,omitempty"`
+}
+
+// bandwidthMessage is a Bandwidth message, as returned by a send and
+// carried in callbacks
+type bandwidthMessage struct {
+	ID           string   `json:"id"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+	Text         string   `json:"text"`
+	Media        []string `json:"media"`
+	Direction    string   `json:"direction"`
+	SegmentCount int      `json:"segmentCount"`
+	Time         string   `json:"time"`
+
+	// Error responses
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// bandwidthCallback is one event of a Bandwidth message callback
+type bandwidthCallback struct {
+	Type        string           `json:"type"` // message-received, message-sending, message-delivered, message-failed
+	Time        string           `json:"time"`
+	Description string           `json:"description"`
+	To          string           `json:"to"`
+	ErrorCode   int              `json:"errorCode"`
+	Message     bandwidthMessage `json:"message"`
+}
+
+// SendSMS sends a text-only message via Bandwidth
+func (b *BandwidthProvider) SendSMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	return b.send(ctx, bandwidthSendRequest{
+		ApplicationID: b.applicationID,
+		To:            []string{req.To},
+		From:          req.From,
+		Text:          req.Body,
+	})
+}
+
+// SendMMS sends a message with media via Bandwidth
+func (b *BandwidthProvider) SendMMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	return b.send(ctx, bandwidthSendRequest{
+		ApplicationID: b.applicationID,
+		To:            []string{req.To},
+		From:          req.From,
+		Text:          req.Body,
+		Media:         req.MediaURLs,
+	})
+}
+
+// send makes the actual API call to Bandwidth
+func (b *BandwidthProvider) send(ctx context.Context, body bandwidthSendRequest) (*SendResponse, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/users/%s/messages", b.baseURL, url.PathEscape(b.accountID))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.SetBasicAuth(b.username, b.password)
+
+	resp, err := b.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("bandwidth API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var bwResp bandwidthMessage
+	if err := json.Unmarshal(respBody, &bwResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("bandwidth API error (status %d): %s - %s", resp.StatusCode, bwResp.Type, bwResp.Description)
+	}
+
+	log.WithFields(log.Fields{
+		"message_id": bwResp.ID,
+		"from":       body.From,
+		"to":         body.To,
+		"media":      len(body.Media),
+		"segments":   bwResp.SegmentCount,
+	}).Info("Bandwidth message sent")
+
+	return &SendResponse{
+		MessageID:   bwResp.ID,
+		Status:      "queued",
+		Segments:    bwResp.SegmentCount,
+		SubmittedAt: time.Now(),
+	}, nil
+}
+
+// readCallbacks reads a Bandwidth callback body, an array of events
+func readCallbacks(r *http.Request) ([]bandwidthCallback, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var events []bandwidthCallback
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("empty webhook")
+	}
+	return events, nil
+}
+
+// ParseInboundWebhook parses a Bandwidth message-received callback.
+// Bandwidth posts delivery events to the same URL; those return
+// ErrStatusCallback.
+func (b *BandwidthProvider) ParseInboundWebhook(r *http.Request) (*InboundMessage, error) {
+	events, err := readCallbacks(r)
+	if err != nil {
+		return nil, err
+	}
+	event := events[0]
+	if event.Type != "message-received" {
+		return nil, ErrStatusCallback
+	}
+
+	msg := event.Message
+	to := event.To
+	if to == "" && len(msg.To) > 0 {
+		to = msg.To[0]
+	}
+	receivedAt := time.Now()
+	if parsed, err := time.Parse(time.RFC3339, msg.Time); err == nil {
+		receivedAt = parsed
+	}
+
+	return &InboundMessage{
+		MessageID:  msg.ID,
+		From:       msg.From,
+		To:         to,
+		Body:       msg.Text,
+		MediaURLs:  msg.Media,
+		ReceivedAt: receivedAt,
+		Segments:   msg.SegmentCount,
+		Direction:  "inbound",
+	}, nil
+}
+
+// ParseStatusWebhook parses a Bandwidth delivery callback
+func (b *BandwidthProvider) ParseStatusWebhook(r *http.Request) (*StatusUpdate, error) {
+	events, err := readCallbacks(r)
+	if err != nil {
+		return nil, err
+	}
+	event := events[0]
+
+	update := &StatusUpdate{
+		MessageID: event.Message.ID,
+		Status:    mapBandwidthEventToStatus(event.Type),
+		UpdatedAt: time.Now(),
+	}
+	if event.Type == "message-failed" {
+		update.ErrorCode = strconv.Itoa(event.ErrorCode)
+		update.ErrorMsg = event.Description
+	}
+	return update, nil
+}
+
+// VerifyWebhook checks the HTTP Basic credentials Bandwidth sends with
+// callbacks, configured on the messaging application. secret is
+// "username:password".
+func (b *BandwidthProvider) VerifyWebhook(r *http.Request, secret string) error {
+	if secret == "" {
+		return nil // Skip verification if no secret configured
+	}
+
+	wantUser, wantPass, ok := strings.Cut(secret, ":")
+	if !ok {
+		return fmt.Errorf("bandwidth webhook secret must be username:password")
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return fmt.Errorf("missing bandwidth callback credentials")
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(wantPass)) == 1
+	if !userOK || !passOK {
+		return fmt.Errorf("invalid webhook credentials")
+	}
+	return nil
+}
+
+// mapBandwidthEventToStatus maps Bandwidth callback types to normalized statuses
+func mapBandwidthEventToStatus(eventType string) string {
+	switch eventType {
+	case "message-sending":
+		return "sent"
+	case "message-delivered":
+		return "delivered"
+	case "message-failed":
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,443 @@
+package messaging
+
+import (
+	"bytes"
+	"callsign/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Chatplan directions
+const (
+	ChatplanInbound  = "inbound"
+	ChatplanOutbound = "outbound"
+)
+
+// ChatplanThreadPrefix marks a forward target as a chat thread ID
+// (e.g. "thread:42") rather than a phone number
+const ChatplanThreadPrefix = "thread:"
+
+// chatplanWebhookDelays are the waits before each webhook retry
+var chatplanWebhookDelays = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+// chatplanVarPattern matches ${name} template variables
+var chatplanVarPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// ChatplanMessage is a message being run through the chatplan
+type ChatplanMessage struct {
+	TenantID  uint
+	Direction string // inbound, outbound
+	From      string
+	To        string
+	Body      string
+	MediaURLs []string
+	Contact   *models.Contact // The remote party, if known
+}
+
+// ChatplanStep records how one rule fared against a message
+type ChatplanStep struct {
+	RuleID  uint   `json:"rule_id"`
+	Name    string `json:"name"`
+	Global  bool   `json:"global"`
+	Order   int    `json:"order"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason,omitempty"` // Why the rule didn't match
+}
+
+// ChatplanResult is the outcome of evaluating the chatplan for a message.
+// Rule is nil when nothing matched and the message routes normally.
+type ChatplanResult struct {
+	Rule      *models.Chatplan  `json:"rule"`
+	Action    string            `json:"action,omitempty"`
+	Reply     string            `json:"reply,omitempty"`  // Rendered auto-reply
+	Target    string            `json:"target,omitempty"` // Forward target, webhook URL or queue ID
+	Replaces  bool              `json:"replaces_routing"` // The action delivers the message instead of normal routing
+	Variables map[string]string `json:"variables"`
+	Steps     []ChatplanStep    `json:"steps"`
+}
+
+// LookupContact finds the tenant contact with the given phone number
+func (m *Manager) LookupContact(tenantID uint, number string) *models.Contact {
+	var contact models.Contact
+	if err := m.DB.Where("tenant_id = ? AND (phone = ? OR mobile_phone = ? OR phone_alt = ?)",
+		tenantID, number, number, number).First(&contact).Error; err != nil {
+		return nil
+	}
+	return &contact
+}
+
+// EvaluateChatplan finds the chatplan rule for a message without acting
+// on it. The tenant's rules are tried before the global ones, each in
+// Order, and the first rule whose patterns all match wins.
+func (m *Manager) EvaluateChatplan(msg *ChatplanMessage) (*ChatplanResult, error) {
+	direction := msg.Direction
+	if direction == "" {
+		direction = ChatplanInbound
+	}
+
+	var tenantRules, globalRules []models.Chatplan
+	if msg.TenantID != 0 {
+		if err := m.DB.Where("tenant_id = ? AND enabled = ?", msg.TenantID, true).
+			Order("\"order\" ASC, id ASC").Find(&tenantRules).Error; err != nil {
+			return nil, fmt.Errorf("failed to load chatplans: %w", err)
+		}
+	}
+	if err := m.DB.Where("(tenant_id = 0 OR tenant_id IS NULL) AND enabled = ?", true).
+		Order("\"order\" ASC, id ASC").Find(&globalRules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load global chatplans: %w", err)
+	}
+
+	result := &ChatplanResult{Variables: m.chatplanVariables(msg, direction), Steps: []ChatplanStep{}}
+	for _, rule := range append(tenantRules, globalRules...) {
+		ruleDirection := rule.Direction
+		if ruleDirection == "" {
+			ruleDirection = ChatplanInbound
+		}
+		if ruleDirection != direction {
+			continue
+		}
+
+		step := ChatplanStep{RuleID: rule.ID, Name: rule.Name, Global: rule.TenantID == 0, Order: rule.Order}
+		step.Reason = matchChatplan(&rule, msg)
+		step.Matched = step.Reason == ""
+		result.Steps = append(result.Steps, step)
+		if !step.Matched {
+			continue
+		}
+
+		matched := rule
+		result.Rule = &matched
+		result.Action = rule.Action
+		switch rule.Action {
+		case models.ChatplanActionReply:
+			result.Reply = RenderChatplanTemplate(rule.ReplyTemplate, result.Variables)
+		case models.ChatplanActionForward:
+			result.Target = strings.TrimSpace(RenderChatplanTemplate(chatplanForwardTarget(&rule), result.Variables))
+			result.Replaces = strings.HasPrefix(result.Target, ChatplanThreadPrefix)
+		case models.ChatplanActionWebhook:
+			result.Target = rule.WebhookURL
+			if result.Target == "" {
+				result.Target = rule.ActionParam
+			}
+		case models.ChatplanActionQueue:
+			result.Target = strings.TrimSpace(rule.ActionParam)
+			result.Replaces = direction == ChatplanInbound
+		}
+		break
+	}
+	return result, nil
+}
+
+// ValidateChatplan checks a rule's direction, action and patterns
+func ValidateChatplan(rule *models.Chatplan) error {
+	switch rule.Direction {
+	case "", ChatplanInbound, ChatplanOutbound:
+	default:
+		return fmt.Errorf("direction must be inbound or outbound")
+	}
+
+	for name, pattern := range map[string]string{
+		"from_pattern":  rule.FromPattern,
+		"to_pattern":    rule.ToPattern,
+		"message_match": rule.MessageMatch,
+	} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+
+	switch rule.Action {
+	case models.ChatplanActionReply:
+		if rule.ReplyTemplate == "" {
+			return fmt.Errorf("reply_template is required for reply rules")
+		}
+	case models.ChatplanActionForward:
+		if chatplanForwardTarget(rule) == "" {
+			return fmt.Errorf("forward_to is required for forward rules")
+		}
+	case models.ChatplanActionWebhook:
+		if rule.WebhookURL == "" && rule.ActionParam == "" {
+			return fmt.Errorf("webhook_url is required for webhook rules")
+		}
+		if rule.WebhookHeaders != "" {
+			var headers map[string]string
+			if err := json.Unmarshal([]byte(rule.WebhookHeaders), &headers); err != nil {
+				return fmt.Errorf("webhook_headers must be a JSON object of strings")
+			}
+		}
+	case models.ChatplanActionQueue:
+		if _, err := strconv.ParseUint(strings.TrimSpace(rule.ActionParam), 10, 64); err != nil {
+			return fmt.Errorf("action_param must be a chat queue ID for queue rules")
+		}
+	case models.ChatplanActionLua:
+	default:
+		return fmt.Errorf("action must be one of forward, reply, webhook, lua or queue")
+	}
+	return nil
+}
+
+// RenderChatplanTemplate substitutes ${name} variables. Unknown variables
+// render empty.
+func RenderChatplanTemplate(tmpl string, vars map[string]string) string {
+	return chatplanVarPattern.ReplaceAllStringFunc(tmpl, func(v string) string {
+		return vars[v[2:len(v)-1]]
+	})
+}
+
+// runChatplan evaluates and executes the chatplan for a message. It returns
+// true when the matched action delivered the message itself, in which case
+// normal routing is skipped.
+func (m *Manager) runChatplan(msg *ChatplanMessage) bool {
+	result, err := m.EvaluateChatplan(msg)
+	if err != nil {
+		log.WithError(err).Error("Chatplan evaluation failed")
+		return false
+	}
+	if result.Rule == nil {
+		return false
+	}
+	rule := result.Rule
+
+	fields := log.Fields{
+		"chatplan_id": rule.ID,
+		"chatplan":    rule.Name,
+		"action":      rule.Action,
+		"direction":   msg.Direction,
+		"tenant_id":   msg.TenantID,
+	}
+	log.WithFields(fields).Info("Chatplan rule matched")
+
+	switch rule.Action {
+	case models.ChatplanActionReply:
+		if msg.Direction != ChatplanInbound {
+			log.WithFields(fields).Warn("Chatplan reply rules only apply to inbound messages")
+			return false
+		}
+		if result.Reply == "" {
+			return false
+		}
+		if err := m.enqueue(msg.TenantID, msg.To, msg.From, result.Reply, nil, 0); err != nil {
+			log.WithFields(fields).WithError(err).Error("Failed to queue chatplan auto-reply")
+		}
+		return false
+
+	case models.ChatplanActionForward:
+		return m.chatplanForward(msg, result, fields)
+
+	case models.ChatplanActionWebhook:
+		go m.chatplanWebhook(msg, rule, result.Target, fields)
+		return false
+
+	case models.ChatplanActionQueue:
+		if msg.Direction != ChatplanInbound {
+			log.WithFields(fields).Warn("Chatplan queue rules only apply to inbound messages")
+			return false
+		}
+		queueID, _ := strconv.ParseUint(result.Target, 10, 64)
+		var queue models.ChatQueue
+		if err := m.DB.Where("id = ? AND tenant_id = ?", queueID, msg.TenantID).First(&queue).Error; err != nil {
+			log.WithFields(fields).Warnf("Chatplan queue %s not found, routing normally", result.Target)
+			return false
+		}
+		if err := m.routeQueuedSMS(msg, &queue); err != nil {
+			log.WithFields(fields).WithError(err).Error("Failed to hand SMS to chat queue, routing normally")
+			return false
+		}
+		return true
+
+	default:
+		log.WithFields(fields).Warnf("Chatplan action %q is not supported for SMS, routing normally", rule.Action)
+		return false
+	}
+}
+
+// chatplanForward copies a message to another number, or delivers it into
+// a chat thread. Forwarding to the number's own extension is normal routing.
+func (m *Manager) chatplanForward(msg *ChatplanMessage, result *ChatplanResult, fields log.Fields) bool {
+	target := result.Target
+	if target == "" || target == result.Variables["extension"] {
+		return false
+	}
+
+	if strings.HasPrefix(target, ChatplanThreadPrefix) {
+		threadID, _ := strconv.ParseUint(strings.TrimPrefix(target, ChatplanThreadPrefix), 10, 64)
+		var thread models.ChatThread
+		if err := m.DB.Where("id = ? AND tenant_id = ?", threadID, msg.TenantID).First(&thread).Error; err != nil {
+			log.WithFields(fields).Warnf("Chatplan forward thread %s not found, routing normally", target)
+			return false
+		}
+		senderType, senderName := "contact", result.Variables["sender_name"]
+		var contactID *uint
+		if msg.Direction == ChatplanOutbound {
+			senderType, senderName = "system", msg.From
+		} else if msg.Contact != nil {
+			contactID = &msg.Contact.ID
+		}
+		if err := m.deliverToThread(&thread, senderType, senderName, contactID, msg.From, msg.To, msg.Body, msg.MediaURLs); err != nil {
+			log.WithFields(fields).WithError(err).Error("Failed to forward SMS to chat thread, routing normally")
+			return false
+		}
+		// Outbound messages are still sent; the thread gets a copy
+		return msg.Direction == ChatplanInbound
+	}
+
+	// A copy to another number, sent from the number the message used
+	from, body := msg.To, fmt.Sprintf("Fwd from %s: %s", msg.From, msg.Body)
+	if msg.Direction == ChatplanOutbound {
+		from, body = msg.From, fmt.Sprintf("Fwd to %s: %s", msg.To, msg.Body)
+	}
+	if err := m.enqueue(msg.TenantID, from, target, body, nil, 0); err != nil {
+		log.WithFields(fields).WithError(err).Error("Failed to queue chatplan forward")
+	}
+	return false
+}
+
+// chatplanWebhook posts a message to a rule's webhook, retrying network
+// errors, 429s and 5xxs
+func (m *Manager) chatplanWebhook(msg *ChatplanMessage, rule *models.Chatplan, url string, fields log.Fields) {
+	payload := map[string]interface{}{
+		"event":       "sms." + msg.Direction,
+		"chatplan_id": rule.ID,
+		"chatplan":    rule.Name,
+		"tenant_id":   msg.TenantID,
+		"direction":   msg.Direction,
+		"from":        msg.From,
+		"to":          msg.To,
+		"body":        msg.Body,
+		"media_urls":  msg.MediaURLs,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}
+	if msg.Contact != nil {
+		payload["contact"] = map[string]interface{}{
+			"id":      msg.Contact.ID,
+			"name":    msg.Contact.FullName(),
+			"company": msg.Contact.Company,
+		}
+	}
+	data, _ := json.Marshal(payload)
+
+	method := strings.ToUpper(rule.WebhookMethod)
+	if method == "" {
+		method = http.MethodPost
+	}
+	var headers map[string]string
+	if rule.WebhookHeaders != "" {
+		json.Unmarshal([]byte(rule.WebhookHeaders), &headers)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for attempt := 0; ; attempt++ {
+		err := sendChatplanWebhook(client, method, url, headers, data)
+		if err == nil {
+			return
+		}
+		if attempt >= len(chatplanWebhookDelays) {
+			log.WithFields(fields).WithError(err).Errorf("Chatplan webhook failed after %d attempts", attempt+1)
+			return
+		}
+		log.WithFields(fields).WithError(err).Warnf("Chatplan webhook failed, retrying in %s", chatplanWebhookDelays[attempt])
+		time.Sleep(chatplanWebhookDelays[attempt])
+	}
+}
+
+// sendChatplanWebhook makes one webhook request. Client errors other than
+// 429 are not retried, as resending won't change the answer.
+func sendChatplanWebhook(client *http.Client, method, url string, headers map[string]string, data []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		log.WithError(err).WithField("url", url).Error("Invalid chatplan webhook request")
+		return nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		log.WithField("url", url).Warnf("Chatplan webhook rejected with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// chatplanVariables are the template variables for a message
+func (m *Manager) chatplanVariables(msg *ChatplanMessage, direction string) map[string]string {
+	vars := map[string]string{
+		"direction":   direction,
+		"from":        msg.From,
+		"to":          msg.To,
+		"body":        msg.Body,
+		"tenant_id":   strconv.FormatUint(uint64(msg.TenantID), 10),
+		"sender_name": msg.From,
+	}
+	if msg.Contact != nil {
+		vars["contact_name"] = msg.Contact.FullName()
+		vars["contact_first_name"] = msg.Contact.FirstName
+		vars["contact_last_name"] = msg.Contact.LastName
+		vars["contact_company"] = msg.Contact.Company
+		vars["contact_email"] = msg.Contact.Email
+		if name := msg.Contact.FullName(); name != "" && direction == ChatplanInbound {
+			vars["sender_name"] = name
+		}
+	}
+
+	// The extension a dedicated number belongs to
+	local := msg.To
+	if direction == ChatplanOutbound {
+		local = msg.From
+	}
+	var extensions []string
+	m.DB.Model(&models.Extension{}).
+		Joins("JOIN sms_number_assignments ON sms_number_assignments.extension_id = extensions.id AND sms_number_assignments.deleted_at IS NULL AND sms_number_assignments.enabled = ?", true).
+		Joins("JOIN destinations ON destinations.id = sms_number_assignments.destination_id AND destinations.deleted_at IS NULL").
+		Where("destinations.destination_number = ? AND sms_number_assignments.tenant_id = ?", local, msg.TenantID).
+		Limit(1).Pluck("extensions.extension", &extensions)
+	if len(extensions) > 0 {
+		vars["extension"] = extensions[0]
+	}
+	return vars
+}
+
+// matchChatplan returns why a rule doesn't match a message, or "" if it does
+func matchChatplan(rule *models.Chatplan, msg *ChatplanMessage) string {
+	for _, p := range []struct{ name, pattern, value string }{
+		{"from", rule.FromPattern, msg.From},
+		{"to", rule.ToPattern, msg.To},
+		{"body", rule.MessageMatch, msg.Body},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			return fmt.Sprintf("invalid %s pattern: %v", p.name, err)
+		}
+		if !re.MatchString(p.value) {
+			return p.name + " does not match " + p.pattern
+		}
+	}
+	return ""
+}
+
+// chatplanForwardTarget is where a forward rule sends messages
+func chatplanForwardTarget(rule *models.Chatplan) string {
+	if rule.ForwardTo != "" {
+		return rule.ForwardTo
+	}
+	return rule.ActionParam
+}
@@ -0,0 +1,102 @@
+package messaging_test
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/messaging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupManager(t *testing.T) (*messaging.Manager, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.MessagingProvider{}, &models.MessageQueueItem{},
+		&models.Chatplan{}, &models.Contact{}, &models.Destination{}, &models.Extension{},
+		&models.SMSNumberAssignment{}, &models.ChatQueue{}, &models.ChatQueueAgent{}, &models.ChatThread{},
+		&models.ChatMessage{}, &models.ChatAttachment{}))
+	return messaging.NewManager(db, &config.Config{}, nil), db
+}
+
+func TestEvaluateChatplanOrder(t *testing.T) {
+	m, db := setupManager(t)
+	require.NoError(t, db.Create(&[]models.Chatplan{
+		{Name: "Global catch-all", Direction: "inbound", ToPattern: ".*", Action: models.ChatplanActionForward, ForwardTo: "${extension}", Order: 1, Enabled: true},
+		{Name: "Tenant help", TenantID: 1, Direction: "inbound", MessageMatch: "(?i)help", Action: models.ChatplanActionReply,
+			ReplyTemplate: "Hi ${contact_first_name}, we got \"${body}\" at ${to}${unknown}", Order: 20, Enabled: true},
+		{Name: "Tenant sales", TenantID: 1, Direction: "inbound", FromPattern: `^\+44`, Action: models.ChatplanActionReply, ReplyTemplate: "x", Order: 10, Enabled: true},
+		{Name: "Other tenant", TenantID: 2, Direction: "inbound", Action: models.ChatplanActionReply, ReplyTemplate: "x", Order: 0, Enabled: true},
+		{Name: "Outbound", TenantID: 1, Direction: "outbound", Action: models.ChatplanActionReply, ReplyTemplate: "x", Order: 0, Enabled: true},
+	}).Error)
+	contact := models.Contact{TenantID: 1, FirstName: "Ada", LastName: "Byron", Phone: "+15550001"}
+	require.NoError(t, db.Create(&contact).Error)
+
+	msg := &messaging.ChatplanMessage{TenantID: 1, Direction: messaging.ChatplanInbound,
+		From: "+15550001", To: "+15559999", Body: "Need HELP please", Contact: m.LookupContact(1, "+15550001")}
+	result, err := m.EvaluateChatplan(msg)
+	require.NoError(t, err)
+	require.NotNil(t, result.Rule)
+
+	// Tenant rules run in order before global ones, and stop at the first match
+	assert.Equal(t, "Tenant help", result.Rule.Name)
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "Tenant sales", result.Steps[0].Name)
+	assert.False(t, result.Steps[0].Matched)
+	assert.Contains(t, result.Steps[0].Reason, "from does not match")
+	assert.True(t, result.Steps[1].Matched)
+	assert.Equal(t, `Hi Ada, we got "Need HELP please" at +15559999`, result.Reply)
+	assert.Equal(t, "Ada Byron", result.Variables["sender_name"])
+
+	// Unmatched tenant rules fall through to the global ones
+	msg.Body = "hello"
+	result, err = m.EvaluateChatplan(msg)
+	require.NoError(t, err)
+	require.NotNil(t, result.Rule)
+	assert.Equal(t, "Global catch-all", result.Rule.Name)
+	assert.True(t, result.Steps[len(result.Steps)-1].Global)
+	assert.False(t, result.Replaces, "forwarding to the number's extension is normal routing")
+}
+
+func TestRouteInboundSMSChatplanActions(t *testing.T) {
+	m, db := setupManager(t)
+	// Written directly as sqlite hands the JSONB default back as text
+	require.NoError(t, db.Exec(`INSERT INTO destinations (uuid, tenant_id, destination_number, sms_enabled, sms_mode, gateway_associations)
+		VALUES ('1b0c5d3e-9f1a-4c2b-8d7e-6f5a4b3c2d1e', 1, '+15559999', true, 'shared', CAST('[]' AS BLOB))`).Error)
+	queue := models.ChatQueue{TenantID: 1, Name: "Support"}
+	require.NoError(t, db.Create(&queue).Error)
+	require.NoError(t, db.Create(&[]models.Chatplan{
+		{Name: "Hours", TenantID: 1, Direction: "inbound", MessageMatch: "(?i)hours", Action: models.ChatplanActionReply,
+			ReplyTemplate: "We're open 9-5, ${sender_name}", Order: 1, Enabled: true},
+		{Name: "Support", TenantID: 1, Direction: "inbound", MessageMatch: "(?i)support", Action: models.ChatplanActionQueue,
+			ActionParam: "1", Order: 2, Enabled: true},
+	}).Error)
+
+	// An auto-reply is queued and the message still reaches the shared thread
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550001", "What are your hours?", nil))
+	var reply models.MessageQueueItem
+	require.NoError(t, db.First(&reply).Error)
+	assert.Equal(t, "+15559999", reply.FromNumber)
+	assert.Equal(t, "+15550001", reply.ToNumber)
+	assert.Equal(t, "We're open 9-5, +15550001", reply.Body)
+
+	var shared models.ChatThread
+	require.NoError(t, db.Where("is_group_sms = ?", true).First(&shared).Error)
+	assert.Nil(t, shared.QueueID)
+
+	// A queue rule takes over delivery; follow-ups continue the same thread
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550002", "I need support", nil))
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550002", "Support, anyone?", nil))
+	var queued []models.ChatThread
+	require.NoError(t, db.Where("queue_id = ?", queue.ID).Find(&queued).Error)
+	require.Len(t, queued, 1)
+	assert.Equal(t, "+15550002", queued[0].RemoteNumber)
+	assert.False(t, queued[0].IsGroupSMS)
+
+	var count int64
+	db.Model(&models.ChatMessage{}).Where("thread_id = ?", queued[0].ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
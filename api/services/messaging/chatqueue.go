@@ -0,0 +1,478 @@
+package messaging
+
+import (
+	"callsign/models"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Errors returned when an agent accepts a queued thread
+var (
+	ErrChatNotQueued       = errors.New("thread is not waiting in a queue")
+	ErrChatAlreadyAssigned = errors.New("thread is already assigned")
+	ErrChatNotAgent        = errors.New("extension is not an agent of this queue")
+	ErrChatAgentFull       = errors.New("agent is at their concurrent chat limit")
+)
+
+// ChatRouter assigns queued chat threads, SMS conversations handed over by
+// the chatplan and web chats, to the queue's agents by its strategy. All
+// state lives on the thread and agent rows, so routing survives restarts.
+type ChatRouter struct {
+	m *Manager
+
+	// Serialises routing passes so agent capacity isn't double-booked
+	mu sync.Mutex
+	// Broadcast threads already offered to the agents, to offer them once
+	offered map[uint]bool
+
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// newChatRouter creates the chat queue router for a messaging manager
+func newChatRouter(m *Manager) *ChatRouter {
+	return &ChatRouter{
+		m:       m,
+		offered: make(map[uint]bool),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start runs a routing pass over every queue each interval, which assigns
+// threads as agents free up, re-queues threads whose agent never replied
+// and flags missed response targets
+func (r *ChatRouter) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.poll()
+			}
+		}
+	}()
+	log.Info("Chat queue router started")
+}
+
+// Stop stops the routing passes
+func (r *ChatRouter) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+		<-r.stopped
+	}
+}
+
+// Enqueue puts a new thread into its queue: the customer is greeted with
+// the welcome message, or the away message outside business hours, and the
+// thread is assigned straight away if an agent is free
+func (r *ChatRouter) Enqueue(thread *models.ChatThread) error {
+	if thread.QueueID == nil {
+		return ErrChatNotQueued
+	}
+	var queue models.ChatQueue
+	if err := r.m.DB.Where("id = ? AND tenant_id = ?", *thread.QueueID, thread.TenantID).First(&queue).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	thread.QueuedAt = &now
+	if err := r.m.DB.Model(thread).Update("queued_at", &now).Error; err != nil {
+		return err
+	}
+
+	if r.isOpen(&queue, now) {
+		if queue.WelcomeMessage != "" {
+			r.notifyCustomer(thread, &queue, queue.WelcomeMessage)
+		}
+	} else if queue.AwayMessage != "" {
+		r.notifyCustomer(thread, &queue, queue.AwayMessage)
+		r.m.DB.Model(thread).Update("away_sent_at", &now)
+	}
+
+	r.publish(thread, &queue, "queue_waiting", nil)
+	r.Dispatch(queue.ID)
+	return nil
+}
+
+// Dispatch runs a routing pass for one queue, e.g. after an agent frees up
+func (r *ChatRouter) Dispatch(queueID uint) {
+	var queue models.ChatQueue
+	if err := r.m.DB.First(&queue, queueID).Error; err != nil || !queue.Enabled {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.route(&queue, time.Now())
+}
+
+// Accept assigns a waiting thread to the agent who claimed it, as agents
+// do for broadcast queues
+func (r *ChatRouter) Accept(thread *models.ChatThread, extensionID uint) error {
+	if thread.QueueID == nil || (thread.Status != "open" && thread.Status != "pending") {
+		return ErrChatNotQueued
+	}
+	if thread.AssignedTo != nil {
+		return ErrChatAlreadyAssigned
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var queue models.ChatQueue
+	if err := r.m.DB.First(&queue, *thread.QueueID).Error; err != nil {
+		return ErrChatNotQueued
+	}
+	r.refreshActiveChats(&queue)
+
+	var agent models.ChatQueueAgent
+	if err := r.m.DB.Where("queue_id = ? AND extension_id = ? AND enabled = ?", queue.ID, extensionID, true).
+		First(&agent).Error; err != nil {
+		return ErrChatNotAgent
+	}
+	if agent.MaxConcurrentChats > 0 && agent.ActiveChats >= agent.MaxConcurrentChats {
+		return ErrChatAgentFull
+	}
+	if !r.assign(thread, &queue, &agent, time.Now()) {
+		return ErrChatAlreadyAssigned
+	}
+	return nil
+}
+
+// Release resolves a queued thread and hands the agent's freed slot to the
+// next waiting thread
+func (r *ChatRouter) Release(thread *models.ChatThread) error {
+	now := time.Now()
+	if err := r.m.DB.Model(thread).Updates(map[string]interface{}{
+		"status":      "resolved",
+		"resolved_at": &now,
+	}).Error; err != nil {
+		return err
+	}
+	thread.Status = "resolved"
+	thread.ResolvedAt = &now
+
+	if thread.QueueID != nil {
+		r.mu.Lock()
+		delete(r.offered, thread.ID)
+		r.mu.Unlock()
+		r.Dispatch(*thread.QueueID)
+	}
+	return nil
+}
+
+// RecordResponse notes an agent's reply to a queued thread. The first one
+// stops the SLA clock, measured from when the thread entered the queue.
+func (r *ChatRouter) RecordResponse(thread *models.ChatThread, extensionID uint) {
+	if thread.QueueID == nil || thread.FirstResponseAt != nil || thread.QueuedAt == nil {
+		return
+	}
+	var queue models.ChatQueue
+	if err := r.m.DB.First(&queue, *thread.QueueID).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(*thread.QueuedAt).Milliseconds()
+	breached := queue.TargetResponseMs > 0 && elapsed > int64(queue.TargetResponseMs)
+	result := r.m.DB.Model(&models.ChatThread{}).
+		Where("id = ? AND first_response_at IS NULL", thread.ID).
+		Updates(map[string]interface{}{
+			"first_response_at": &now,
+			"first_response_ms": elapsed,
+			"sla_breached":      breached || thread.SLABreached,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	thread.FirstResponseAt = &now
+	thread.FirstResponseMs = elapsed
+	thread.SLABreached = breached || thread.SLABreached
+
+	r.publish(thread, &queue, "queue_first_response", map[string]interface{}{
+		"extension_id":       extensionID,
+		"first_response_ms":  elapsed,
+		"target_response_ms": queue.TargetResponseMs,
+		"sla_met":            !thread.SLABreached,
+	})
+}
+
+// poll runs a routing pass over every enabled queue
+func (r *ChatRouter) poll() {
+	var queues []models.ChatQueue
+	if err := r.m.DB.Where("enabled = ?", true).Find(&queues).Error; err != nil {
+		log.WithError(err).Error("Chat queue router: failed to load queues")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for i := range queues {
+		r.route(&queues[i], now)
+	}
+}
+
+// route re-queues timed-out threads, flags missed response targets, sends
+// away messages to threads left waiting too long and assigns waiting threads
+// to free agents. The caller holds r.mu.
+func (r *ChatRouter) route(queue *models.ChatQueue, now time.Time) {
+	db := r.m.DB
+	active := []string{"open", "pending"}
+
+	// Agents who never replied lose the thread back to the queue
+	if queue.AgentTimeoutSeconds > 0 {
+		var stale []models.ChatThread
+		db.Where("queue_id = ? AND assigned_to IS NOT NULL AND first_response_at IS NULL AND assigned_at < ? AND status IN ?",
+			queue.ID, now.Add(-time.Duration(queue.AgentTimeoutSeconds)*time.Second), active).Find(&stale)
+		for i := range stale {
+			r.requeue(&stale[i], queue)
+		}
+	}
+
+	// Threads still unanswered past the response target
+	if queue.TargetResponseMs > 0 {
+		var late []models.ChatThread
+		db.Where("queue_id = ? AND first_response_at IS NULL AND sla_breached = ? AND queued_at < ? AND status IN ?",
+			queue.ID, false, now.Add(-time.Duration(queue.TargetResponseMs)*time.Millisecond), active).Find(&late)
+		for i := range late {
+			db.Model(&late[i]).Update("sla_breached", true)
+			r.publish(&late[i], queue, "queue_sla_breached", map[string]interface{}{
+				"target_response_ms": queue.TargetResponseMs,
+				"waited_ms":          now.Sub(*late[i].QueuedAt).Milliseconds(),
+			})
+		}
+	}
+
+	var waiting []models.ChatThread
+	db.Where("queue_id = ? AND assigned_to IS NULL AND queued_at IS NOT NULL AND status IN ?", queue.ID, active).
+		Order("queued_at ASC").Find(&waiting)
+	if len(waiting) == 0 {
+		return
+	}
+
+	// Customers waiting longer than the queue promises hear the away message once
+	if queue.MaxWaitSeconds > 0 && queue.AwayMessage != "" {
+		cutoff := now.Add(-time.Duration(queue.MaxWaitSeconds) * time.Second)
+		for i := range waiting {
+			t := &waiting[i]
+			if t.AwaySentAt == nil && t.QueuedAt.Before(cutoff) {
+				r.notifyCustomer(t, queue, queue.AwayMessage)
+				db.Model(t).Update("away_sent_at", &now)
+				t.AwaySentAt = &now
+			}
+		}
+	}
+
+	if !r.isOpen(queue, now) {
+		return
+	}
+
+	r.refreshActiveChats(queue)
+	var agents []models.ChatQueueAgent
+	db.Where("queue_id = ? AND enabled = ? AND status = ?", queue.ID, true, models.ChatAgentAvailable).Find(&agents)
+
+	for i := range waiting {
+		t := &waiting[i]
+		free := freeAgents(agents)
+		if len(free) == 0 {
+			return
+		}
+
+		if queue.Strategy == models.ChatStrategyBroadcast {
+			if !r.offered[t.ID] {
+				r.offered[t.ID] = true
+				ids := make([]uint, len(free))
+				for j, a := range free {
+					ids[j] = a.ExtensionID
+				}
+				r.publish(t, queue, "queue_offered", map[string]interface{}{"extension_ids": ids})
+			}
+			continue
+		}
+
+		agent := pickAgent(queue.Strategy, free, t.LastAgentID)
+		if r.assign(t, queue, agent, now) {
+			agent.ActiveChats++
+			agent.LastAssignedAt = &now
+		}
+	}
+}
+
+// assign claims a waiting thread for an agent, failing if someone else got
+// it first
+func (r *ChatRouter) assign(thread *models.ChatThread, queue *models.ChatQueue, agent *models.ChatQueueAgent, now time.Time) bool {
+	result := r.m.DB.Model(&models.ChatThread{}).
+		Where("id = ? AND assigned_to IS NULL", thread.ID).
+		Updates(map[string]interface{}{
+			"assigned_to": agent.ExtensionID,
+			"assigned_at": &now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	r.m.DB.Model(agent).Updates(map[string]interface{}{
+		"last_assigned_at": &now,
+		"active_chats":     gorm.Expr("active_chats + 1"),
+	})
+	delete(r.offered, thread.ID)
+
+	thread.AssignedTo = &agent.ExtensionID
+	thread.AssignedAt = &now
+	var waited int64
+	if thread.QueuedAt != nil {
+		waited = now.Sub(*thread.QueuedAt).Milliseconds()
+	}
+	r.publish(thread, queue, "queue_assigned", map[string]interface{}{
+		"extension_id": agent.ExtensionID,
+		"strategy":     queue.Strategy,
+		"waited_ms":    waited,
+	})
+	return true
+}
+
+// requeue takes a thread back from an agent who didn't reply in time
+func (r *ChatRouter) requeue(thread *models.ChatThread, queue *models.ChatQueue) {
+	agentID := *thread.AssignedTo
+	result := r.m.DB.Model(&models.ChatThread{}).
+		Where("id = ? AND assigned_to = ? AND first_response_at IS NULL", thread.ID, agentID).
+		Updates(map[string]interface{}{
+			"assigned_to":   nil,
+			"assigned_at":   nil,
+			"last_agent_id": agentID,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	thread.AssignedTo = nil
+	thread.AssignedAt = nil
+	thread.LastAgentID = &agentID
+
+	log.WithFields(log.Fields{
+		"thread_id":    thread.ID,
+		"queue_id":     queue.ID,
+		"extension_id": agentID,
+	}).Info("Chat agent timed out, thread re-queued")
+	r.publish(thread, queue, "queue_requeued", map[string]interface{}{
+		"extension_id": agentID,
+		"reason":       "agent_timeout",
+	})
+}
+
+// refreshActiveChats recounts each agent's open threads in the queue, so
+// resolved and re-queued threads always free their slot
+func (r *ChatRouter) refreshActiveChats(queue *models.ChatQueue) {
+	r.m.DB.Exec(`UPDATE chat_queue_agents SET active_chats = (
+		SELECT COUNT(*) FROM chat_threads
+		WHERE chat_threads.queue_id = chat_queue_agents.queue_id
+		AND chat_threads.assigned_to = chat_queue_agents.extension_id
+		AND chat_threads.status IN ('open', 'pending')
+		AND chat_threads.deleted_at IS NULL
+	) WHERE queue_id = ?`, queue.ID)
+}
+
+// isOpen reports whether the queue's business hours match now. Queues
+// without business hours are always open.
+func (r *ChatRouter) isOpen(queue *models.ChatQueue, now time.Time) bool {
+	if queue.BusinessHoursID == nil {
+		return true
+	}
+	var hours models.TimeCondition
+	if err := r.m.DB.First(&hours, *queue.BusinessHoursID).Error; err != nil {
+		return true
+	}
+	return hours.OpenAt(r.m.DB, now)
+}
+
+// notifyCustomer posts a queue message into the thread, texting it to the
+// customer on SMS threads
+func (r *ChatRouter) notifyCustomer(thread *models.ChatThread, queue *models.ChatQueue, text string) {
+	if err := r.m.deliverToThread(thread, "system", queue.Name, nil, thread.LocalNumber, thread.RemoteNumber, text, nil); err != nil {
+		log.WithError(err).WithField("thread_id", thread.ID).Error("Failed to post chat queue message")
+	}
+	if (thread.Channel == models.ChannelSMS || thread.Channel == "mms") && thread.RemoteNumber != "" {
+		if err := r.m.enqueue(thread.TenantID, thread.LocalNumber, thread.RemoteNumber, text, nil, 0); err != nil {
+			log.WithError(err).WithField("thread_id", thread.ID).Error("Failed to queue chat queue message")
+		}
+	}
+}
+
+// publish sends a chat queue event to the tenant's clients
+func (r *ChatRouter) publish(thread *models.ChatThread, queue *models.ChatQueue, action string, extra map[string]interface{}) {
+	if r.m.Hub == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"thread_id":     thread.ID,
+		"queue_id":      queue.ID,
+		"queue":         queue.Name,
+		"channel":       thread.Channel,
+		"remote_number": thread.RemoteNumber,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	r.m.Hub.NotifyChatQueueEvent(thread.TenantID, action, data)
+}
+
+// freeAgents are the agents with room for another chat
+func freeAgents(agents []models.ChatQueueAgent) []*models.ChatQueueAgent {
+	var free []*models.ChatQueueAgent
+	for i := range agents {
+		a := &agents[i]
+		if a.MaxConcurrentChats <= 0 || a.ActiveChats < a.MaxConcurrentChats {
+			free = append(free, a)
+		}
+	}
+	return free
+}
+
+// pickAgent chooses from the free agents by strategy. Lower Priority values
+// go first; round-robin then takes whoever has waited longest since their
+// last chat, least-busy whoever has the fewest open chats. The agent who
+// last timed out on the thread is passed over unless nobody else is free.
+func pickAgent(strategy string, free []*models.ChatQueueAgent, skip *uint) *models.ChatQueueAgent {
+	if skip != nil && len(free) > 1 {
+		others := free[:0:0]
+		for _, a := range free {
+			if a.ExtensionID != *skip {
+				others = append(others, a)
+			}
+		}
+		if len(others) > 0 {
+			free = others
+		}
+	}
+
+	sorted := append([]*models.ChatQueueAgent(nil), free...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if strategy == models.ChatStrategyLeastBusy && a.ActiveChats != b.ActiveChats {
+			return a.ActiveChats < b.ActiveChats
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if (a.LastAssignedAt == nil) != (b.LastAssignedAt == nil) {
+			return a.LastAssignedAt == nil
+		}
+		if a.LastAssignedAt != nil && !a.LastAssignedAt.Equal(*b.LastAssignedAt) {
+			return a.LastAssignedAt.Before(*b.LastAssignedAt)
+		}
+		return a.ID < b.ID
+	})
+	return sorted[0]
+}
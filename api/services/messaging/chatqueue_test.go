@@ -0,0 +1,103 @@
+package messaging_test
+
+import (
+	"callsign/models"
+	"callsign/services/messaging"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createQueue(t *testing.T, db *gorm.DB, queue models.ChatQueue, agents ...models.ChatQueueAgent) *models.ChatQueue {
+	queue.TenantID = 1
+	queue.Enabled = true
+	require.NoError(t, db.Create(&queue).Error)
+	for _, a := range agents {
+		a.QueueID = queue.ID
+		a.Enabled = true
+		require.NoError(t, db.Create(&a).Error)
+	}
+	return &queue
+}
+
+func queueThread(t *testing.T, m *messaging.Manager, db *gorm.DB, queueID uint, remote string) *models.ChatThread {
+	thread := models.ChatThread{TenantID: 1, Channel: "web", RemoteNumber: remote, QueueID: &queueID, Status: "open"}
+	require.NoError(t, db.Create(&thread).Error)
+	require.NoError(t, m.ChatRouter.Enqueue(&thread))
+	require.NoError(t, db.First(&thread, thread.ID).Error)
+	return &thread
+}
+
+func TestChatRouterRoundRobinAndLimits(t *testing.T) {
+	m, db := setupManager(t)
+	queue := createQueue(t, db, models.ChatQueue{Name: "Support", Strategy: models.ChatStrategyRoundRobin, WelcomeMessage: "Hi, an agent will be with you shortly"},
+		models.ChatQueueAgent{ExtensionID: 101, MaxConcurrentChats: 1, Status: models.ChatAgentAvailable},
+		models.ChatQueueAgent{ExtensionID: 102, MaxConcurrentChats: 1, Status: models.ChatAgentAvailable},
+		models.ChatQueueAgent{ExtensionID: 103, MaxConcurrentChats: 5, Status: models.ChatAgentAway})
+
+	first := queueThread(t, m, db, queue.ID, "a")
+	second := queueThread(t, m, db, queue.ID, "b")
+	third := queueThread(t, m, db, queue.ID, "c")
+
+	// Agents take turns, nobody goes past their limit and away agents get nothing
+	require.NotNil(t, first.AssignedTo)
+	require.NotNil(t, second.AssignedTo)
+	assert.Equal(t, uint(101), *first.AssignedTo)
+	assert.Equal(t, uint(102), *second.AssignedTo)
+	assert.Nil(t, third.AssignedTo, "every available agent is at their limit")
+
+	var welcome models.ChatMessage
+	require.NoError(t, db.Where("thread_id = ? AND sender_type = ?", first.ID, "system").First(&welcome).Error)
+
+	// Resolving a chat frees the agent for the next one in line
+	require.NoError(t, m.ChatRouter.Release(first))
+	require.NoError(t, db.First(third, third.ID).Error)
+	require.NotNil(t, third.AssignedTo)
+	assert.Equal(t, uint(101), *third.AssignedTo)
+}
+
+func TestChatRouterTimeoutAndFirstResponse(t *testing.T) {
+	m, db := setupManager(t)
+	queue := createQueue(t, db, models.ChatQueue{Name: "Sales", Strategy: models.ChatStrategyLeastBusy, AgentTimeoutSeconds: 60, TargetResponseMs: 1000},
+		models.ChatQueueAgent{ExtensionID: 201, MaxConcurrentChats: 3, Status: models.ChatAgentAvailable},
+		models.ChatQueueAgent{ExtensionID: 202, MaxConcurrentChats: 3, Status: models.ChatAgentAvailable, Priority: 1})
+
+	thread := queueThread(t, m, db, queue.ID, "a")
+	require.NotNil(t, thread.AssignedTo)
+	assert.Equal(t, uint(201), *thread.AssignedTo, "lower priority values go first")
+
+	// The agent never replies, so the thread moves to the other agent
+	past := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, db.Model(thread).Updates(map[string]interface{}{"assigned_at": past, "queued_at": past}).Error)
+	m.ChatRouter.Dispatch(queue.ID)
+	require.NoError(t, db.First(thread, thread.ID).Error)
+	require.NotNil(t, thread.AssignedTo)
+	assert.Equal(t, uint(202), *thread.AssignedTo)
+	assert.Equal(t, uint(201), *thread.LastAgentID)
+	assert.True(t, thread.SLABreached, "unanswered past the response target")
+
+	m.ChatRouter.RecordResponse(thread, 202)
+	require.NoError(t, db.First(thread, thread.ID).Error)
+	require.NotNil(t, thread.FirstResponseAt)
+	assert.GreaterOrEqual(t, thread.FirstResponseMs, int64(2*time.Minute/time.Millisecond))
+}
+
+func TestChatRouterBroadcastAccept(t *testing.T) {
+	m, db := setupManager(t)
+	queue := createQueue(t, db, models.ChatQueue{Name: "All hands", Strategy: models.ChatStrategyBroadcast},
+		models.ChatQueueAgent{ExtensionID: 301, MaxConcurrentChats: 1, Status: models.ChatAgentAvailable})
+
+	thread := queueThread(t, m, db, queue.ID, "a")
+	assert.Nil(t, thread.AssignedTo, "broadcast threads wait for an agent to accept")
+
+	assert.ErrorIs(t, m.ChatRouter.Accept(thread, 999), messaging.ErrChatNotAgent)
+	require.NoError(t, m.ChatRouter.Accept(thread, 301))
+	assert.Equal(t, uint(301), *thread.AssignedTo)
+	assert.ErrorIs(t, m.ChatRouter.Accept(thread, 301), messaging.ErrChatAlreadyAssigned)
+
+	other := queueThread(t, m, db, queue.ID, "b")
+	assert.ErrorIs(t, m.ChatRouter.Accept(other, 301), messaging.ErrChatAgentFull)
+}
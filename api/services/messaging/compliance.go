@@ -0,0 +1,240 @@
+package messaging
+
+import (
+	"callsign/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrRecipientOptedOut is returned when sending to a recipient whose
+// latest consent entry for the sending number is an opt-out
+var ErrRecipientOptedOut = errors.New("recipient has opted out of messages from this number")
+
+// KeywordHelp is the keyword kind of HELP requests; opt-out and opt-in
+// keywords are reported as their consent status
+const KeywordHelp = "help"
+
+// Carrier keywords (CTIA), matched against the whole message
+var (
+	optOutKeywords = map[string]bool{"STOP": true, "STOPALL": true, "UNSUBSCRIBE": true, "CANCEL": true, "END": true,
+		"QUIT": true, "OPTOUT": true, "OPT-OUT": true, "REVOKE": true}
+	optInKeywords = map[string]bool{"START": true, "UNSTOP": true, "SUBSCRIBE": true, "OPTIN": true, "OPT-IN": true}
+	helpKeywords  = map[string]bool{"HELP": true, "INFO": true}
+)
+
+// MatchKeyword returns the kind of carrier keyword a message is -
+// models.ConsentOptOut, models.ConsentOptIn or KeywordHelp - and the
+// keyword itself, or "" when it is an ordinary message
+func MatchKeyword(body string) (kind, keyword string) {
+	keyword = strings.ToUpper(strings.Trim(strings.TrimSpace(body), ".!"))
+	switch {
+	case optOutKeywords[keyword]:
+		return models.ConsentOptOut, keyword
+	case optInKeywords[keyword]:
+		return models.ConsentOptIn, keyword
+	case helpKeywords[keyword]:
+		return KeywordHelp, keyword
+	default:
+		return "", ""
+	}
+}
+
+// consentStatus returns the consent in force for a recipient of one of a
+// tenant's numbers, or "" when none was ever recorded
+func consentStatus(db *gorm.DB, tenantID uint, number, recipient string) string {
+	var entry models.MessagingConsent
+	if err := db.Where("tenant_id = ? AND number = ? AND recipient = ?", tenantID, number, recipient).
+		Order("id DESC").First(&entry).Error; err != nil {
+		return ""
+	}
+	return entry.Status
+}
+
+// CheckConsent returns ErrRecipientOptedOut when the recipient has opted
+// out of messages from the number
+func (m *Manager) CheckConsent(tenantID uint, from, to string) error {
+	if consentStatus(m.DB, tenantID, from, to) == models.ConsentOptOut {
+		return ErrRecipientOptedOut
+	}
+	return nil
+}
+
+// RecordConsent appends an entry to the consent ledger
+func (m *Manager) RecordConsent(entry *models.MessagingConsent) error {
+	entry.ID = 0
+	if err := m.DB.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record consent: %w", err)
+	}
+	log.WithFields(log.Fields{
+		"tenant_id": entry.TenantID,
+		"number":    entry.Number,
+		"recipient": entry.Recipient,
+		"status":    entry.Status,
+		"source":    entry.Source,
+	}).Info("Messaging consent recorded")
+	return nil
+}
+
+// handleKeyword records the consent change of a carrier keyword texted to
+// a tenant's number and sends the response. It reports whether the
+// message was a keyword.
+func (m *Manager) handleKeyword(tenantID uint, number, sender, body string) bool {
+	kind, keyword := MatchKeyword(body)
+	if kind == "" {
+		return false
+	}
+
+	if kind != KeywordHelp {
+		m.RecordConsent(&models.MessagingConsent{
+			TenantID:  tenantID,
+			Number:    number,
+			Recipient: sender,
+			Status:    kind,
+			Source:    models.ConsentSourceKeyword,
+			Keyword:   keyword,
+		})
+	}
+
+	reply := m.keywordResponse(tenantID, number, kind)
+	if err := m.Queue.EnqueueKeywordResponse(tenantID, m.SelectProvider(tenantID, number), number, sender, reply); err != nil {
+		log.WithError(err).WithField("keyword", keyword).Error("Failed to queue keyword response")
+	}
+	return true
+}
+
+// keywordResponse returns the reply to a keyword: the tenant number's
+// campaign's message, else a default naming its brand
+func (m *Manager) keywordResponse(tenantID uint, number, kind string) string {
+	var campaign models.MessagingCampaign
+	var brand models.MessagingBrand
+	var msgNumber models.MessagingNumber
+	if m.DB.Where("tenant_id = ? AND phone_number = ?", tenantID, number).First(&msgNumber).Error == nil && msgNumber.CampaignID != nil &&
+		m.DB.Preload("Brand").First(&campaign, *msgNumber.CampaignID).Error == nil {
+		switch {
+		case kind == models.ConsentOptOut && campaign.OptOutMessage != "":
+			return campaign.OptOutMessage
+		case kind == models.ConsentOptIn && campaign.OptInMessage != "":
+			return campaign.OptInMessage
+		case kind == KeywordHelp && campaign.HelpMessage != "":
+			return campaign.HelpMessage
+		}
+		if campaign.Brand != nil {
+			brand = *campaign.Brand
+		}
+	}
+
+	prefix := ""
+	if name := brand.ResponseName(); name != "" {
+		prefix = name + ": "
+	}
+	switch kind {
+	case models.ConsentOptOut:
+		return prefix + "You are unsubscribed and will receive no further messages. Reply START to resubscribe."
+	case models.ConsentOptIn:
+		return prefix + "You are subscribed to messages again. Reply STOP to unsubscribe, HELP for help."
+	default:
+		contact := ""
+		if brand.Email != "" || brand.Phone != "" {
+			contact = " Contact " + strings.TrimSpace(brand.Email+" "+brand.Phone) + "."
+		}
+		return prefix + "Msg & data rates may apply." + contact + " Reply STOP to unsubscribe."
+	}
+}
+
+// =====================
+// Throughput limits
+// =====================
+
+// rateLimit is a token bucket refilling at rate tokens per second up to burst
+type rateLimit struct {
+	key   string
+	rate  float64
+	burst float64
+}
+
+// perSecond and perMinute return the buckets of a limit (nil when 0)
+func perSecond(key string, n int) []rateLimit {
+	if n <= 0 {
+		return nil
+	}
+	return []rateLimit{{key: key + ":s", rate: float64(n), burst: float64(n)}}
+}
+
+func perMinute(key string, n int) []rateLimit {
+	if n <= 0 {
+		return nil
+	}
+	return []rateLimit{{key: key + ":m", rate: float64(n) / 60, burst: float64(n)}}
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// rateLimiter holds the token buckets of the sending numbers and campaigns
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// reserve takes a token from every bucket when all have one and returns 0,
+// else takes none and returns how long until they will
+func (l *rateLimiter) reserve(now time.Time, limits []rateLimit) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	for _, lim := range limits {
+		b := l.buckets[lim.key]
+		if b == nil {
+			b = &tokenBucket{tokens: lim.burst, at: now}
+			l.buckets[lim.key] = b
+		}
+		b.tokens = math.Min(lim.burst, b.tokens+now.Sub(b.at).Seconds()*lim.rate)
+		b.at = now
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / lim.rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, lim := range limits {
+		l.buckets[lim.key].tokens--
+	}
+	return 0
+}
+
+// throttle applies the throughput limits of a tenant's sending number and
+// its campaign, returning how long to defer the message or 0 to send it now
+func (w *QueueWorker) throttle(tenantID uint, from string) time.Duration {
+	var number models.MessagingNumber
+	if err := w.db.Preload("Campaign").Where("tenant_id = ? AND phone_number = ?", tenantID, from).First(&number).Error; err != nil {
+		return 0
+	}
+
+	limits := append(perSecond("number:"+from, number.RateLimitPerSecond), perMinute("number:"+from, number.RateLimitPerMinute)...)
+	if c := number.Campaign; c != nil {
+		key := fmt.Sprintf("campaign:%d", c.ID)
+		limits = append(limits, perSecond(key, c.RateLimitPerSecond)...)
+		limits = append(limits, perMinute(key, c.RateLimitPerMinute)...)
+	}
+	if len(limits) == 0 {
+		return 0
+	}
+	return w.limiter.reserve(time.Now(), limits)
+}
@@ -0,0 +1,161 @@
+package messaging_test
+
+import (
+	"callsign/models"
+	"callsign/services/messaging"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestKeywordsMaintainConsentLedger(t *testing.T) {
+	m, db := setupManager(t)
+	require.NoError(t, db.AutoMigrate(&models.MessagingNumber{}, &models.MessagingBrand{}, &models.MessagingCampaign{}, &models.MessagingConsent{}))
+	require.NoError(t, db.Exec(`INSERT INTO destinations (uuid, tenant_id, destination_number, sms_enabled, sms_mode, gateway_associations)
+		VALUES ('3d2e7f5a-1b3c-4e4d-8f9a-8b7c6d5e4f3a', 1, '+15559999', true, 'shared', CAST('[]' AS BLOB))`).Error)
+	brand := models.MessagingBrand{TenantID: 1, Name: "Acme Holdings LLC", DisplayName: "Acme"}
+	require.NoError(t, db.Create(&brand).Error)
+	campaign := models.MessagingCampaign{TenantID: 1, BrandID: brand.ID, Name: "Support", HelpMessage: "Acme Support: call 555-0100."}
+	require.NoError(t, db.Create(&campaign).Error)
+	tenant := uint(1)
+	require.NoError(t, db.Create(&models.MessagingNumber{PhoneNumber: "+15559999", ProviderID: 1, TenantID: &tenant, CampaignID: &campaign.ID}).Error)
+
+	kind, keyword := messaging.MatchKeyword(" Unsubscribe! ")
+	assert.Equal(t, models.ConsentOptOut, kind)
+	assert.Equal(t, "UNSUBSCRIBE", keyword)
+	kind, _ = messaging.MatchKeyword("stop calling me")
+	assert.Empty(t, kind)
+
+	lastReply := func() models.MessageQueueItem {
+		var item models.MessageQueueItem
+		require.NoError(t, db.Order("id DESC").First(&item).Error)
+		return item
+	}
+
+	// STOP opts the sender out of this number and is confirmed
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550001", "Stop", nil))
+	reply := lastReply()
+	assert.True(t, reply.KeywordResponse)
+	assert.Equal(t, "+15559999", reply.FromNumber)
+	assert.Equal(t, "+15550001", reply.ToNumber)
+	assert.Equal(t, "Acme: You are unsubscribed and will receive no further messages. Reply START to resubscribe.", reply.Body)
+
+	var entry models.MessagingConsent
+	require.NoError(t, db.Order("id DESC").First(&entry).Error)
+	assert.Equal(t, models.ConsentOptOut, entry.Status)
+	assert.Equal(t, models.ConsentSourceKeyword, entry.Source)
+	assert.Equal(t, "STOP", entry.Keyword)
+
+	assert.ErrorIs(t, m.SendMessage(1, "+15559999", "+15550001", "Sale today", nil, 0), messaging.ErrRecipientOptedOut)
+	assert.NoError(t, m.SendMessage(1, "+15558888", "+15550001", "From another number", nil, 0))
+
+	// HELP uses the campaign's message and leaves consent alone
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550001", "help", nil))
+	assert.Equal(t, "Acme Support: call 555-0100.", lastReply().Body)
+	assert.ErrorIs(t, m.CheckConsent(1, "+15559999", "+15550001"), messaging.ErrRecipientOptedOut)
+
+	// START opts back in
+	require.NoError(t, m.RouteInboundSMS("+15559999", "+15550001", "START", nil))
+	assert.Contains(t, lastReply().Body, "You are subscribed to messages again")
+	assert.NoError(t, m.SendMessage(1, "+15559999", "+15550001", "Welcome back", nil, 0))
+
+	var entries int64
+	db.Model(&models.MessagingConsent{}).Count(&entries)
+	assert.Equal(t, int64(2), entries)
+}
+
+// recordingProvider is an SMSProvider that records what it sends
+type recordingProvider struct {
+	mu   sync.Mutex
+	sent []messaging.SendRequest
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) SendSMS(ctx context.Context, req messaging.SendRequest) (*messaging.SendResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, req)
+	return &messaging.SendResponse{MessageID: req.To, Status: "queued"}, nil
+}
+
+func (p *recordingProvider) SendMMS(ctx context.Context, req messaging.SendRequest) (*messaging.SendResponse, error) {
+	return p.SendSMS(ctx, req)
+}
+
+func (p *recordingProvider) ParseInboundWebhook(r *http.Request) (*messaging.InboundMessage, error) {
+	return nil, messaging.ErrNoWebhooks
+}
+
+func (p *recordingProvider) ParseStatusWebhook(r *http.Request) (*messaging.StatusUpdate, error) {
+	return nil, messaging.ErrNoWebhooks
+}
+
+func (p *recordingProvider) VerifyWebhook(r *http.Request, secret string) error { return nil }
+
+func (p *recordingProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+func TestQueueWorkerThrottlesAndBlocksOptedOut(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // the worker goroutine must see the same in-memory DB
+	require.NoError(t, db.AutoMigrate(&models.MessageQueueItem{}, &models.MessagingNumber{}, &models.MessagingCampaign{}, &models.MessagingConsent{}))
+
+	campaign := models.MessagingCampaign{TenantID: 1, BrandID: 1, Name: "Alerts", RateLimitPerMinute: 2}
+	require.NoError(t, db.Create(&campaign).Error)
+	tenant := uint(1)
+	require.NoError(t, db.Create(&models.MessagingNumber{PhoneNumber: "+15551000", ProviderID: 1, TenantID: &tenant, CampaignID: &campaign.ID}).Error)
+	require.NoError(t, db.Create(&models.MessagingConsent{TenantID: 1, Number: "+15552000", Recipient: "+15550009",
+		Status: models.ConsentOptOut, Source: models.ConsentSourceKeyword}).Error)
+
+	provider := &recordingProvider{}
+	worker := messaging.NewQueueWorker(db, map[uint]messaging.SMSProvider{1: provider})
+	for _, to := range []string{"+15550001", "+15550002", "+15550003", "+15550004"} {
+		require.NoError(t, worker.Enqueue(1, 1, "+15551000", to, "alert", false, nil, nil))
+	}
+	// Queued before the opt-out took effect, and the opt-out's confirmation
+	require.NoError(t, worker.Enqueue(1, 1, "+15552000", "+15550009", "promo", false, nil, nil))
+	require.NoError(t, worker.EnqueueKeywordResponse(1, 1, "+15552000", "+15550009", "You are unsubscribed"))
+
+	worker.Start()
+	defer worker.Stop()
+	require.Eventually(t, func() bool {
+		var done int64
+		db.Model(&models.MessageQueueItem{}).Where("status IN ?", []string{"sent", "failed", "retry"}).Count(&done)
+		return done == 6
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// The campaign's two messages a minute went out; the rest wait without
+	// using up attempts
+	assert.Equal(t, 3, provider.count())
+	var deferred []models.MessageQueueItem
+	require.NoError(t, db.Where("status = ?", "retry").Find(&deferred).Error)
+	require.Len(t, deferred, 2)
+	for _, item := range deferred {
+		assert.Equal(t, 0, item.Attempts)
+		require.NotNil(t, item.NextRetryAt)
+		assert.True(t, item.NextRetryAt.After(time.Now().Add(10*time.Second)))
+	}
+
+	var blocked models.MessageQueueItem
+	require.NoError(t, db.Where("body = ?", "promo").First(&blocked).Error)
+	assert.Equal(t, "failed", blocked.Status)
+	assert.Contains(t, blocked.LastError, "opted out")
+
+	var confirmation models.MessageQueueItem
+	require.NoError(t, db.Where("keyword_response = ?", true).First(&confirmation).Error)
+	assert.Equal(t, "sent", confirmation.Status)
+}
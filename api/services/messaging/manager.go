@@ -5,6 +5,8 @@ import (
 	"callsign/models"
 	"callsign/services/websocket"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,7 +20,10 @@ type Manager struct {
 	Hub        *websocket.Hub
 	Transcoder *Transcoder
 	Queue      *QueueWorker
-	providers  map[uint]SMSProvider // providerID -> provider
+	ChatRouter *ChatRouter
+	providers  map[uint]SMSProvider              // providerID -> provider
+	configs    map[uint]models.MessagingProvider // providerID -> settings
+	order      []uint                            // Loaded provider IDs by priority
 }
 
 // NewManager creates a new messaging manager
@@ -43,6 +48,7 @@ func NewManager(db *gorm.DB, cfg *config.Config, hub *websocket.Hub) *Manager {
 		Hub:        hub,
 		Transcoder: NewTranscoder(tcConfig),
 		providers:  providers,
+		configs:    make(map[uint]models.MessagingProvider),
 	}
 
 	// Load providers from database and initialize
@@ -50,48 +56,204 @@ func NewManager(db *gorm.DB, cfg *config.Config, hub *websocket.Hub) *Manager {
 
 	// Create queue worker with loaded providers
 	m.Queue = NewQueueWorker(db, providers)
+	m.ChatRouter = newChatRouter(m)
 
 	return m
 }
 
 // Start initializes and starts background workers
 func (m *Manager) Start() {
+	for _, p := range m.providers {
+		if session, ok := p.(SessionProvider); ok {
+			session.Start()
+		}
+	}
 	m.Queue.Start()
+	m.ChatRouter.Start(5 * time.Second)
 	log.Info("Messaging manager started")
 }
 
 // Stop gracefully shuts down the messaging manager
 func (m *Manager) Stop() {
 	m.Queue.Stop()
+	m.ChatRouter.Stop()
+	for _, p := range m.providers {
+		if session, ok := p.(SessionProvider); ok {
+			session.Stop()
+		}
+	}
 	log.Info("Messaging manager stopped")
 }
 
 // loadProviders loads messaging providers from the database and initializes their API clients
 func (m *Manager) loadProviders() {
 	var dbProviders []models.MessagingProvider
-	m.DB.Where("enabled = true").Find(&dbProviders)
+	m.DB.Where("enabled = true").Order("priority ASC, id ASC").Find(&dbProviders)
 
 	for _, p := range dbProviders {
-		switch p.Type {
-		case models.ProviderTelnyx:
-			// Use DB credentials or fall back to config
-			apiKey := m.Config.TelnyxAPIKey
-			msgProfile := m.Config.TelnyxMessagingProfile
-			provider := NewTelnyxProvider(apiKey, msgProfile)
-			m.providers[p.ID] = provider
-			log.WithField("provider_id", p.ID).Info("Loaded Telnyx messaging provider")
-
-		default:
-			log.WithFields(log.Fields{
+		provider, err := m.newProvider(&p)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
 				"provider_id":   p.ID,
 				"provider_type": p.Type,
-			}).Warn("Unsupported messaging provider type")
+			}).Warn("Messaging provider not loaded")
+			continue
 		}
+
+		// Carriers on a persistent bind deliver messages and receipts themselves
+		if session, ok := provider.(SessionProvider); ok {
+			session.OnInbound(func(msg *InboundMessage) {
+				if err := m.RouteInboundSMS(msg.To, msg.From, msg.Body, msg.MediaURLs); err != nil {
+					log.WithError(err).WithField("provider_id", p.ID).Error("Failed to route inbound SMS")
+				}
+			})
+			session.OnStatus(func(status *StatusUpdate) {
+				if err := m.HandleStatusUpdate(status); err != nil {
+					log.WithError(err).WithField("provider_id", p.ID).Error("Failed to handle status update")
+				}
+			})
+		}
+
+		m.providers[p.ID] = provider
+		m.configs[p.ID] = p
+		m.order = append(m.order, p.ID)
+		log.WithFields(log.Fields{
+			"provider_id":   p.ID,
+			"provider_type": p.Type,
+		}).Info("Loaded messaging provider")
 	}
 
 	log.WithField("count", len(m.providers)).Info("Messaging providers loaded")
 }
 
+// newProvider creates the carrier client for a provider's settings
+func (m *Manager) newProvider(p *models.MessagingProvider) (SMSProvider, error) {
+	switch p.Type {
+	case models.ProviderTelnyx:
+		// Use DB credentials or fall back to config
+		apiKey, msgProfile := p.AuthToken, p.ApplicationID
+		if apiKey == "" {
+			apiKey, msgProfile = m.Config.TelnyxAPIKey, m.Config.TelnyxMessagingProfile
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("no telnyx API key")
+		}
+		return NewTelnyxProvider(apiKey, msgProfile), nil
+
+	case models.ProviderTwilio:
+		if p.AccountSID == "" || p.AuthToken == "" {
+			return nil, fmt.Errorf("twilio needs an account SID and auth token")
+		}
+		return NewTwilioProvider(p.AccountSID, p.AuthToken, p.BaseURL, m.Config.MessagingWebhookBaseURL, m.WebhookURL(p.ID, "status")), nil
+
+	case models.ProviderBandwidth:
+		if p.AccountSID == "" || p.Username == "" || p.AuthToken == "" || p.ApplicationID == "" {
+			return nil, fmt.Errorf("bandwidth needs an account ID, API username and password, and application ID")
+		}
+		return NewBandwidthProvider(p.AccountSID, p.Username, p.AuthToken, p.ApplicationID, p.BaseURL), nil
+
+	case models.ProviderSMPP:
+		if p.SMPPHost == "" || p.Username == "" {
+			return nil, fmt.Errorf("smpp needs a host and system ID")
+		}
+		return NewSMPPProvider(SMPPConfig{
+			Host:       p.SMPPHost,
+			Port:       p.SMPPPort,
+			SystemID:   p.Username,
+			Password:   p.AuthToken,
+			SystemType: p.SMPPSystemType,
+			TLS:        p.SMPPTLS,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported messaging provider type")
+	}
+}
+
+// WebhookURL returns the public URL of a provider's inbound or status
+// webhook, or "" when MESSAGING_WEBHOOK_BASE_URL is not set
+func (m *Manager) WebhookURL(providerID uint, kind string) string {
+	if m.Config.MessagingWebhookBaseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/webhooks/messaging/%d/%s", strings.TrimRight(m.Config.MessagingWebhookBaseURL, "/"), providerID, kind)
+}
+
+// VerifyWebhook checks a webhook against its provider's signature scheme.
+// The secret is the provider's webhook secret; Twilio falls back to its
+// auth token and Telnyx to TELNYX_WEBHOOK_SECRET. Providers set to verify
+// signatures reject webhooks when they have no secret.
+func (m *Manager) VerifyWebhook(providerID uint, r *http.Request) error {
+	provider, ok := m.providers[providerID]
+	if !ok {
+		return fmt.Errorf("provider %d not loaded", providerID)
+	}
+	cfg := m.configs[providerID]
+	if !cfg.VerifySignature {
+		return nil
+	}
+
+	secret := cfg.WebhookSecret
+	if secret == "" {
+		switch cfg.Type {
+		case models.ProviderTwilio:
+			secret = cfg.AuthToken
+		case models.ProviderTelnyx:
+			secret = m.Config.TelnyxWebhookSecret
+		}
+	}
+	if secret == "" {
+		return fmt.Errorf("no webhook secret configured for provider %d", providerID)
+	}
+	return provider.VerifyWebhook(r, secret)
+}
+
+// SelectProvider picks the provider to send a tenant's message from a
+// number: the provider of the tenant's MessagingNumber, else its
+// destination's SMS provider, else a provider listing the number, else
+// the tenant's or the system's first provider by priority. It returns 0
+// when no provider is loaded.
+func (m *Manager) SelectProvider(tenantID uint, from string) uint {
+	var number models.MessagingNumber
+	if err := m.DB.Where("tenant_id = ? AND phone_number = ? AND enabled = true", tenantID, from).First(&number).Error; err == nil {
+		if _, ok := m.providers[number.ProviderID]; ok {
+			return number.ProviderID
+		}
+	}
+
+	var dest models.Destination
+	if err := m.DB.Select("sms_provider_id").Where("tenant_id = ? AND destination_number = ?", tenantID, from).
+		First(&dest).Error; err == nil && dest.SMSProviderID != nil {
+		if _, ok := m.providers[*dest.SMSProviderID]; ok {
+			return *dest.SMSProviderID
+		}
+	}
+
+	usable := func(p models.MessagingProvider) bool {
+		return p.TenantID == nil || *p.TenantID == tenantID
+	}
+	for _, id := range m.order {
+		if p := m.configs[id]; usable(p) {
+			for _, n := range p.PhoneNumbers {
+				if n == from {
+					return id
+				}
+			}
+		}
+	}
+	for _, id := range m.order {
+		if p := m.configs[id]; p.TenantID != nil && *p.TenantID == tenantID {
+			return id
+		}
+	}
+	for _, id := range m.order {
+		if m.configs[id].TenantID == nil {
+			return id
+		}
+	}
+	return 0
+}
+
 // GetProvider returns a provider by ID
 func (m *Manager) GetProvider(providerID uint) (SMSProvider, bool) {
 	p, ok := m.providers[providerID]
@@ -99,8 +261,30 @@ func (m *Manager) GetProvider(providerID uint) (SMSProvider, bool) {
 }
 
 // SendMessage is the primary API for sending outbound SMS/MMS
-// It creates queue items and lets the queue worker handle delivery
+// It refuses recipients who opted out with ErrRecipientOptedOut, runs the
+// outbound chatplan, then creates queue items and lets the queue worker
+// handle delivery
 func (m *Manager) SendMessage(tenantID uint, from, to, body string, media []MediaItem, providerID uint) error {
+	if err := m.CheckConsent(tenantID, from, to); err != nil {
+		return err
+	}
+	m.runChatplan(&ChatplanMessage{
+		TenantID:  tenantID,
+		Direction: ChatplanOutbound,
+		From:      from,
+		To:        to,
+		Body:      body,
+		Contact:   m.LookupContact(tenantID, to),
+	})
+	return m.enqueue(tenantID, from, to, body, media, providerID)
+}
+
+// enqueue queues a message for delivery without consulting the chatplan,
+// as used for the chatplan's own replies and forwards
+func (m *Manager) enqueue(tenantID uint, from, to, body string, media []MediaItem, providerID uint) error {
+	if err := m.CheckConsent(tenantID, from, to); err != nil {
+		return err
+	}
 	hasMedia := len(media) > 0
 
 	// If there's media, transcode if needed before queuing
@@ -118,6 +302,10 @@ func (m *Manager) SendMessage(tenantID uint, from, to, body string, media []Medi
 		}
 	}
 
+	if providerID == 0 {
+		providerID = m.SelectProvider(tenantID, from)
+	}
+
 	// Enqueue for delivery
 	return m.Queue.Enqueue(tenantID, providerID, from, to, body, hasMedia, nil, nil)
 }
@@ -133,17 +321,30 @@ func (m *Manager) RouteInboundSMS(toNumber, fromNumber, body string, mediaURLs [
 	tenantID := dest.TenantID
 
 	// Resolve contact from phone number
-	var contact models.Contact
-	contactFound := m.DB.Where("tenant_id = ? AND (phone = ? OR mobile_phone = ? OR phone_alt = ?)",
-		tenantID, fromNumber, fromNumber, fromNumber).First(&contact).Error == nil
+	contact := m.LookupContact(tenantID, fromNumber)
 
 	senderName := fromNumber
 	var contactID *uint
-	if contactFound {
+	if contact != nil {
 		senderName = contact.FullName()
 		contactID = &contact.ID
 	}
 
+	// Carrier keywords are answered and recorded, and bypass the chatplan;
+	// otherwise the chatplan may reply, forward or notify, or take over
+	// delivery
+	if !m.handleKeyword(tenantID, toNumber, fromNumber, body) && m.runChatplan(&ChatplanMessage{
+		TenantID:  tenantID,
+		Direction: ChatplanInbound,
+		From:      fromNumber,
+		To:        toNumber,
+		Body:      body,
+		MediaURLs: mediaURLs,
+		Contact:   contact,
+	}) {
+		return nil
+	}
+
 	switch dest.SMSMode {
 	case "shared":
 		return m.routeSharedSMS(tenantID, toNumber, fromNumber, body, senderName, contactID, mediaURLs)
@@ -181,18 +382,69 @@ func (m *Manager) routeSharedSMS(tenantID uint, toNumber, fromNumber, body, send
 		return fmt.Errorf("failed to find thread: %w", err)
 	}
 
-	// Create the chat message
+	return m.deliverToThread(&thread, "contact", senderName, contactID, fromNumber, toNumber, body, mediaURLs)
+}
+
+// routeQueuedSMS hands an inbound SMS to a chat queue, continuing the
+// remote party's open conversation in that queue if there is one
+func (m *Manager) routeQueuedSMS(msg *ChatplanMessage, queue *models.ChatQueue) error {
+	var thread models.ChatThread
+	err := m.DB.Where(
+		"tenant_id = ? AND channel = 'sms' AND queue_id = ? AND local_number = ? AND remote_number = ? AND status IN ('open', 'pending')",
+		msg.TenantID, queue.ID, msg.To, msg.From,
+	).First(&thread).Error
+
+	if err == gorm.ErrRecordNotFound {
+		thread = models.ChatThread{
+			TenantID:     msg.TenantID,
+			Channel:      models.ChannelSMS,
+			LocalNumber:  msg.To,
+			RemoteNumber: msg.From,
+			QueueID:      &queue.ID,
+			Status:       "open",
+		}
+		if msg.Contact != nil {
+			thread.ContactID = &msg.Contact.ID
+		}
+		if err := m.DB.Create(&thread).Error; err != nil {
+			return fmt.Errorf("failed to create queue thread: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to find queue thread: %w", err)
+	}
+
+	senderName := msg.From
+	var contactID *uint
+	if msg.Contact != nil {
+		senderName = msg.Contact.FullName()
+		contactID = &msg.Contact.ID
+	}
+	if err := m.deliverToThread(&thread, "contact", senderName, contactID, msg.From, msg.To, msg.Body, msg.MediaURLs); err != nil {
+		return err
+	}
+
+	// A new conversation waits in the queue for an agent
+	if thread.QueuedAt == nil {
+		if err := m.ChatRouter.Enqueue(&thread); err != nil {
+			log.WithError(err).WithField("thread_id", thread.ID).Error("Failed to queue chat thread")
+		}
+	}
+	return nil
+}
+
+// deliverToThread posts an SMS into a chat thread and notifies the tenant
+func (m *Manager) deliverToThread(thread *models.ChatThread, senderType, senderName string, senderID *uint, fromNumber, toNumber, body string, mediaURLs []string) error {
 	msg := models.ChatMessage{
-		TenantID:    tenantID,
+		TenantID:    thread.TenantID,
 		ThreadID:    thread.ID,
-		SenderType:  "contact",
+		SenderType:  senderType,
 		SenderName:  senderName,
 		ContentType: "text",
 		Body:        body,
 		Status:      "delivered",
 	}
-	if contactID != nil {
-		msg.SenderID = *contactID
+	if senderID != nil {
+		msg.SenderID = *senderID
 	}
 
 	if err := m.DB.Create(&msg).Error; err != nil {
@@ -200,25 +452,26 @@ func (m *Manager) routeSharedSMS(tenantID uint, toNumber, fromNumber, body, send
 	}
 
 	// Store media attachments
-	m.storeMediaAttachments(tenantID, msg.ID, mediaURLs)
+	m.storeMediaAttachments(thread.TenantID, msg.ID, mediaURLs)
 
 	// Update thread
 	now := time.Now()
-	m.DB.Model(&thread).Updates(map[string]interface{}{
+	m.DB.Model(thread).Updates(map[string]interface{}{
 		"last_message_at": &now,
 		"status":          "open",
 	})
 
 	// Broadcast via WebSocket — visible to ALL users in tenant
 	if m.Hub != nil {
-		m.Hub.BroadcastToTenant(tenantID, websocket.EventChat, "new_message", map[string]interface{}{
+		m.Hub.BroadcastToTenant(thread.TenantID, websocket.EventChat, "new_message", map[string]interface{}{
 			"thread_id":    thread.ID,
 			"message_id":   msg.ID,
 			"sender_name":  senderName,
-			"sender_type":  "contact",
+			"sender_type":  senderType,
 			"body":         body,
 			"channel":      "sms",
-			"is_group_sms": true,
+			"is_group_sms": thread.IsGroupSMS,
+			"queue_id":     thread.QueueID,
 			"from":         fromNumber,
 			"to":           toNumber,
 		})
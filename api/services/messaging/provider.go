@@ -2,10 +2,22 @@ package messaging
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 )
 
+var (
+	// ErrStatusCallback is returned by ParseInboundWebhook when a carrier
+	// posts a delivery status to its inbound URL (Bandwidth sends every
+	// event to one callback URL)
+	ErrStatusCallback = errors.New("webhook is a delivery status callback")
+
+	// ErrNoWebhooks is returned by providers that receive messages over a
+	// connection to the carrier instead of webhooks
+	ErrNoWebhooks = errors.New("provider does not use webhooks")
+)
+
 // SendRequest represents a request to send an SMS/MMS message
 type SendRequest struct {
 	From      string      `json:"from"`       // E.164 from number
@@ -74,3 +86,23 @@ type SMSProvider interface {
 	// VerifyWebhook verifies the webhook signature (returns error if invalid)
 	VerifyWebhook(r *http.Request, secret string) error
 }
+
+// SessionProvider is implemented by providers that hold a connection to the
+// carrier (an SMPP bind) rather than calling a REST API. Inbound messages
+// and delivery receipts arrive over the connection and are passed to the
+// handlers set with OnInbound and OnStatus.
+type SessionProvider interface {
+	SMSProvider
+
+	// OnInbound sets the handler for messages received from the carrier
+	OnInbound(fn func(*InboundMessage))
+
+	// OnStatus sets the handler for delivery receipts
+	OnStatus(fn func(*StatusUpdate))
+
+	// Start connects to the carrier and keeps the connection up
+	Start()
+
+	// Stop closes the connection
+	Stop()
+}
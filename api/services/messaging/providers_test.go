@@ -0,0 +1,343 @@
+package messaging_test
+
+import (
+	"bytes"
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/messaging"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTwilioProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" || user != "AC1" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 20003, "message": "Authenticate"})
+			return
+		}
+		assert.Equal(t, "+15550001", r.FormValue("To"))
+		assert.Equal(t, []string{"https://example.com/a.jpg"}, r.Form["MediaUrl"])
+		assert.Equal(t, "https://pbx.example.com/api/webhooks/messaging/1/status", r.FormValue("StatusCallback"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM1", "status": "queued", "num_segments": "2", "price": "-0.0158"}`))
+	}))
+	defer server.Close()
+
+	twilio := messaging.NewTwilioProvider("AC1", "token", server.URL, "https://pbx.example.com",
+		"https://pbx.example.com/api/webhooks/messaging/1/status")
+	resp, err := twilio.SendMMS(context.Background(), messaging.SendRequest{From: "+15559999", To: "+15550001", Body: "hi", MediaURLs: []string{"https://example.com/a.jpg"}})
+	require.NoError(t, err)
+	assert.Equal(t, "SM1", resp.MessageID)
+	assert.Equal(t, 2, resp.Segments)
+	assert.InDelta(t, 0.0158, resp.Cost, 1e-9)
+
+	_, err = messaging.NewTwilioProvider("AC1", "wrong", server.URL, "", "").SendSMS(context.Background(), messaging.SendRequest{To: "+15550001"})
+	assert.ErrorContains(t, err, "20003")
+
+	// Twilio's documented signature example
+	assert.Equal(t, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=", messaging.TwilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", url.Values{
+		"CallSid": {"CA1234567890ABCDE"}, "Caller": {"+12349013030"}, "Digits": {"1234"}, "From": {"+12349013030"}, "To": {"+18005551212"},
+	}))
+
+	// Signatures are checked against the public URL Twilio called
+	form := url.Values{"MessageSid": {"SM9"}, "From": {"+15550001"}, "To": {"+15559999"}, "Body": {"hello"}, "NumMedia": {"1"}, "MediaUrl0": {"https://example.com/b.png"}}
+	webhook := func(signature string) *http.Request {
+		r := httptest.NewRequest("POST", "http://10.0.0.5:3000/api/webhooks/messaging/1/inbound", strings.NewReader(form.Encode()))
+		r.Header.Set("X-Twilio-Signature", signature)
+		return r
+	}
+	signature := messaging.TwilioSignature("token", "https://pbx.example.com/api/webhooks/messaging/1/inbound", form)
+	assert.Error(t, twilio.VerifyWebhook(webhook("bogus"), "token"))
+	r := webhook(signature)
+	require.NoError(t, twilio.VerifyWebhook(r, "token"))
+
+	inbound, err := twilio.ParseInboundWebhook(r)
+	require.NoError(t, err)
+	assert.Equal(t, "SM9", inbound.MessageID)
+	assert.Equal(t, "+15550001", inbound.From)
+	assert.Equal(t, []string{"https://example.com/b.png"}, inbound.MediaURLs)
+
+	// A status callback posted to the inbound URL is recognised
+	form = url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+	_, err = twilio.ParseInboundWebhook(webhook(""))
+	assert.ErrorIs(t, err, messaging.ErrStatusCallback)
+	status, err := twilio.ParseStatusWebhook(webhook(""))
+	require.NoError(t, err)
+	assert.Equal(t, "failed", status.Status)
+	assert.Equal(t, "30003", status.ErrorCode)
+}
+
+func TestBandwidthProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		require.Equal(t, "/users/9900/messages", r.URL.Path)
+		require.Equal(t, "api-user", user)
+		require.Equal(t, "api-pass", pass)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "app-1", body["applicationId"])
+		assert.Equal(t, []interface{}{"+15550001"}, body["to"])
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id": "bw-1", "segmentCount": 1, "direction": "out"}`))
+	}))
+	defer server.Close()
+
+	bandwidth := messaging.NewBandwidthProvider("9900", "api-user", "api-pass", "app-1", server.URL)
+	resp, err := bandwidth.SendSMS(context.Background(), messaging.SendRequest{From: "+15559999", To: "+15550001", Body: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "bw-1", resp.MessageID)
+	assert.Equal(t, 1, resp.Segments)
+
+	callback := func(body string, user, pass string) *http.Request {
+		r := httptest.NewRequest("POST", "http://localhost/api/webhooks/messaging/2/inbound", strings.NewReader(body))
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		return r
+	}
+	received := `[{"type": "message-received", "to": "+15559999", "message": {"id": "bw-9", "from": "+15550001", "to": ["+15559999"], "text": "hello", "media": ["https://messaging.bandwidth.com/media/x.jpg"], "segmentCount": 1}}]`
+
+	assert.Error(t, bandwidth.VerifyWebhook(callback(received, "", ""), "cb-user:cb-pass"))
+	assert.Error(t, bandwidth.VerifyWebhook(callback(received, "cb-user", "nope"), "cb-user:cb-pass"))
+	r := callback(received, "cb-user", "cb-pass")
+	require.NoError(t, bandwidth.VerifyWebhook(r, "cb-user:cb-pass"))
+
+	inbound, err := bandwidth.ParseInboundWebhook(r)
+	require.NoError(t, err)
+	assert.Equal(t, "bw-9", inbound.MessageID)
+	assert.Equal(t, "+15559999", inbound.To)
+	assert.Equal(t, "hello", inbound.Body)
+	assert.Len(t, inbound.MediaURLs, 1)
+
+	failed := `[{"type": "message-failed", "description": "destination rejected", "errorCode": 4720, "message": {"id": "bw-1"}}]`
+	_, err = bandwidth.ParseInboundWebhook(callback(failed, "", ""))
+	assert.ErrorIs(t, err, messaging.ErrStatusCallback)
+	status, err := bandwidth.ParseStatusWebhook(callback(failed, "", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "bw-1", status.MessageID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Equal(t, "4720", status.ErrorCode)
+}
+
+// fakeSMSC is an SMPP server accepting one transceiver bind
+type fakeSMSC struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conn     net.Conn
+	submits  [][]byte
+	unbound  chan struct{}
+}
+
+func newFakeSMSC(t *testing.T) *fakeSMSC {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	smsc := &fakeSMSC{listener: listener, unbound: make(chan struct{})}
+	go smsc.serve(t)
+	return smsc
+}
+
+func (s *fakeSMSC) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMSC) serve(t *testing.T) {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	for {
+		var header [16]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[0:])-16)
+		io.ReadFull(conn, body)
+		id, seq := binary.BigEndian.Uint32(header[4:]), binary.BigEndian.Uint32(header[12:])
+
+		switch id {
+		case 0x09: // bind_transceiver
+			assert.True(t, bytes.HasPrefix(body, []byte("esme\x00secret\x00")), "bind credentials")
+			s.send(0x80000009, seq, []byte("smsc\x00"))
+		case 0x04: // submit_sm
+			s.mu.Lock()
+			s.submits = append(s.submits, body)
+			n := len(s.submits)
+			s.mu.Unlock()
+			s.send(0x80000004, seq, []byte("msg-"+strconv.Itoa(n)+"\x00"))
+		case 0x15: // enquire_link
+			s.send(0x80000015, seq, nil)
+		case 0x06: // unbind
+			close(s.unbound)
+			return
+		}
+	}
+}
+
+func (s *fakeSMSC) send(id, seq uint32, body []byte) {
+	pdu := make([]byte, 16+len(body))
+	binary.BigEndian.PutUint32(pdu[0:], uint32(len(pdu)))
+	binary.BigEndian.PutUint32(pdu[4:], id)
+	binary.BigEndian.PutUint32(pdu[12:], seq)
+	copy(pdu[16:], body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.Write(pdu)
+}
+
+// deliver sends a deliver_sm from an international source number
+func (s *fakeSMSC) deliver(seq uint32, esmClass, coding byte, sm []byte) {
+	body := []byte("\x00\x01\x0115550001\x00\x01\x0115559999\x00")
+	body = append(body, esmClass, 0, 0, 0, 0, 0, 0, coding, 0, byte(len(sm)))
+	s.send(0x05, seq, append(body, sm...))
+}
+
+// submitted returns the esm_class, data_coding and short message of a submit_sm
+func (s *fakeSMSC) submitted(i int) (esmClass, coding byte, sm []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.submits[i]
+	for skip := 0; skip < 3; skip++ { // service_type, source and destination addresses
+		if skip > 0 {
+			b = b[2:]
+		}
+		b = b[bytes.IndexByte(b, 0)+1:]
+	}
+	esmClass, b = b[0], b[3:]
+	for skip := 0; skip < 2; skip++ { // schedule_delivery_time, validity_period
+		b = b[bytes.IndexByte(b, 0)+1:]
+	}
+	return esmClass, b[2], b[5 : 5+int(b[4])]
+}
+
+func TestSMPPProvider(t *testing.T) {
+	smsc := newFakeSMSC(t)
+	defer smsc.listener.Close()
+
+	smpp := messaging.NewSMPPProvider(messaging.SMPPConfig{Host: "127.0.0.1", Port: smsc.port(), SystemID: "esme", Password: "secret"})
+	inbound := make(chan *messaging.InboundMessage, 1)
+	statuses := make(chan *messaging.StatusUpdate, 1)
+	smpp.OnInbound(func(m *messaging.InboundMessage) { inbound <- m })
+	smpp.OnStatus(func(s *messaging.StatusUpdate) { statuses <- s })
+	smpp.Start()
+	require.Eventually(t, smpp.Bound, 5*time.Second, 10*time.Millisecond)
+
+	// A long GSM message is split into concatenated parts, never between
+	// an escape and its character
+	long := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 20)
+	resp, err := smpp.SendSMS(context.Background(), messaging.SendRequest{From: "+15559999", To: "+15550001", Body: long})
+	require.NoError(t, err)
+	assert.Equal(t, "msg-1", resp.MessageID)
+	assert.Equal(t, 2, resp.Segments)
+	esmClass, coding, sm := smsc.submitted(0)
+	assert.Equal(t, byte(0x40), esmClass)
+	assert.Equal(t, byte(0x00), coding)
+	assert.Equal(t, []byte{0x05, 0x00, 0x03}, sm[:3])
+	assert.Equal(t, []byte{2, 1}, sm[4:6])
+	assert.Len(t, sm, 6+152)
+	_, _, sm = smsc.submitted(1)
+	assert.Equal(t, []byte{0x1B, 0x65, 'b'}, sm[6:9])
+
+	// Text outside the GSM alphabet goes as UCS-2
+	_, err = smpp.SendSMS(context.Background(), messaging.SendRequest{From: "+15559999", To: "+15550001", Body: "hi ☃"})
+	require.NoError(t, err)
+	esmClass, coding, sm = smsc.submitted(2)
+	assert.Equal(t, byte(0), esmClass)
+	assert.Equal(t, byte(0x08), coding)
+	assert.Equal(t, []byte{0, 'h', 0, 'i', 0, ' ', 0x26, 0x03}, sm)
+
+	// Mobile-originated messages are reassembled from their parts
+	smsc.deliver(1, 0x40, 0x08, []byte{0x05, 0x00, 0x03, 7, 2, 2, 0, '!'})
+	smsc.deliver(2, 0x40, 0x08, []byte{0x05, 0x00, 0x03, 7, 2, 1, 0, 'h', 0, 'i'})
+	select {
+	case m := <-inbound:
+		assert.Equal(t, "+15550001", m.From)
+		assert.Equal(t, "+15559999", m.To)
+		assert.Equal(t, "hi!", m.Body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no inbound message")
+	}
+
+	// Delivery receipts report the first part's message ID
+	smsc.deliver(3, 0x04, 0x00, []byte("id:msg-1 sub:001 dlvrd:001 submit date:2610171200 done date:2610171201 stat:DELIVRD err:000 text:"))
+	select {
+	case s := <-statuses:
+		assert.Equal(t, "msg-1", s.MessageID)
+		assert.Equal(t, "delivered", s.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery receipt")
+	}
+
+	// Webhooks do not apply to a bind
+	_, err = smpp.ParseInboundWebhook(httptest.NewRequest("POST", "/", nil))
+	assert.ErrorIs(t, err, messaging.ErrNoWebhooks)
+
+	smpp.Stop()
+	select {
+	case <-smsc.unbound:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no unbind on stop")
+	}
+	assert.False(t, smpp.Bound())
+	_, err = smpp.SendSMS(context.Background(), messaging.SendRequest{From: "+15559999", To: "+15550001", Body: "late"})
+	assert.ErrorIs(t, err, messaging.ErrSMPPNotBound)
+}
+
+func TestSelectProvider(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.MessagingProvider{}, &models.MessagingNumber{}, &models.Destination{}, &models.MessageQueueItem{}))
+
+	tenant := uint(1)
+	providers := []models.MessagingProvider{
+		{Name: "System", Type: models.ProviderTwilio, AccountSID: "AC1", AuthToken: "t", Priority: 10},
+		{Name: "Tenant", Type: models.ProviderTwilio, AccountSID: "AC2", AuthToken: "t", Priority: 5, TenantID: &tenant, PhoneNumbers: pq.StringArray{"+15550100"}},
+		{Name: "Preferred", Type: models.ProviderTwilio, AccountSID: "AC3", AuthToken: "t", Priority: 1},
+		{Name: "Incomplete", Type: models.ProviderBandwidth, AccountSID: "99", Priority: 0},
+	}
+	require.NoError(t, db.Create(&providers).Error)
+	system, tenantOwn, preferred := providers[0].ID, providers[1].ID, providers[2].ID
+	require.NoError(t, db.Create(&models.MessagingNumber{PhoneNumber: "+15550200", ProviderID: system, TenantID: &tenant}).Error)
+	other := uint(2)
+	require.NoError(t, db.Create(&models.MessagingNumber{PhoneNumber: "+15550999", ProviderID: preferred, TenantID: &other}).Error)
+	require.NoError(t, db.Exec(`INSERT INTO destinations (uuid, tenant_id, destination_number, sms_provider_id, gateway_associations)
+		VALUES ('2c1d6e4f-0a2b-4d3c-9e8f-7a6b5c4d3e2f', 1, '+15550300', ?, CAST('[]' AS BLOB))`, preferred).Error)
+
+	m := messaging.NewManager(db, &config.Config{}, nil)
+	_, ok := m.GetProvider(providers[3].ID)
+	assert.False(t, ok, "providers missing credentials are not loaded")
+
+	assert.Equal(t, system, m.SelectProvider(1, "+15550200"), "messaging number")
+	assert.Equal(t, preferred, m.SelectProvider(1, "+15550300"), "destination provider")
+	assert.Equal(t, tenantOwn, m.SelectProvider(1, "+15550100"), "provider listing the number")
+	assert.Equal(t, tenantOwn, m.SelectProvider(1, "+15550999"), "tenant's own provider, not another tenant's number")
+	assert.Equal(t, preferred, m.SelectProvider(2, "+15550100"), "another tenant's provider is never used")
+
+	// Sends without a provider are queued on the selected one
+	require.NoError(t, m.SendMessage(1, "+15550200", "+15550001", "hi", nil, 0))
+	var item models.MessageQueueItem
+	require.NoError(t, db.First(&item).Error)
+	assert.Equal(t, system, item.ProviderID)
+}
@@ -15,6 +15,7 @@ import (
 type QueueWorker struct {
 	db        *gorm.DB
 	providers map[uint]SMSProvider // providerID -> provider instance
+	limiter   *rateLimiter
 	cancel    context.CancelFunc
 	stopped   chan struct{}
 }
@@ -24,6 +25,7 @@ func NewQueueWorker(db *gorm.DB, providers map[uint]SMSProvider) *QueueWorker {
 	return &QueueWorker{
 		db:        db,
 		providers: providers,
+		limiter:   newRateLimiter(),
 		stopped:   make(chan struct{}),
 	}
 }
@@ -96,6 +98,25 @@ func (w *QueueWorker) processItem(ctx context.Context, item models.MessageQueueI
 		"attempt":       item.Attempts + 1,
 	})
 
+	// Never send to an opted-out recipient, even if queued before they opted out
+	if !item.KeywordResponse && consentStatus(w.db, item.TenantID, item.FromNumber, item.ToNumber) == models.ConsentOptOut {
+		logger.Warn("Recipient opted out, not sending")
+		w.failItem(&item, ErrRecipientOptedOut.Error())
+		return
+	}
+
+	// Keep within the number's and campaign's throughput; a deferred item
+	// does not use up an attempt
+	if wait := w.throttle(item.TenantID, item.FromNumber); wait > 0 {
+		next := time.Now().Add(wait)
+		w.db.Model(&item).Updates(map[string]interface{}{
+			"status":        "retry",
+			"next_retry_at": &next,
+		})
+		logger.WithField("wait", wait).Debug("Throughput limit reached, deferring message")
+		return
+	}
+
 	// Mark as processing
 	w.db.Model(&item).Updates(map[string]interface{}{
 		"status":   "processing",
@@ -253,18 +274,35 @@ func (w *QueueWorker) loadMediaURLs(item *models.MessageQueueItem) ([]string, er
 
 // Enqueue adds a new message to the outbound queue
 func (w *QueueWorker) Enqueue(tenantID, providerID uint, from, to, body string, hasMedia bool, messageID, chatMessageID *uint) error {
-	item := models.MessageQueueItem{
+	return w.enqueue(models.MessageQueueItem{
 		TenantID:      tenantID,
 		ProviderID:    providerID,
 		FromNumber:    from,
 		ToNumber:      to,
 		Body:          body,
 		HasMedia:      hasMedia,
-		Status:        "pending",
-		MaxAttempts:   3,
 		MessageID:     messageID,
 		ChatMessageID: chatMessageID,
-	}
+	})
+}
+
+// EnqueueKeywordResponse queues the reply to a STOP, START or HELP
+// keyword, which is sent even though the recipient may have opted out
+func (w *QueueWorker) EnqueueKeywordResponse(tenantID, providerID uint, from, to, body string) error {
+	return w.enqueue(models.MessageQueueItem{
+		TenantID:        tenantID,
+		ProviderID:      providerID,
+		FromNumber:      from,
+		ToNumber:        to,
+		Body:            body,
+		KeywordResponse: true,
+	})
+}
+
+func (w *QueueWorker) enqueue(item models.MessageQueueItem) error {
+	item.Status = "pending"
+	item.MaxAttempts = 3
+	from, to := item.FromNumber, item.ToNumber
 
 	if err := w.db.Create(&item).Error; err != nil {
 		return fmt.Errorf("failed to enqueue message: %w", err)
@@ -0,0 +1,848 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SMPP 3.4 command IDs
+const (
+	smppGenericNack     uint32 = 0x80000000
+	smppBindTransceiver uint32 = 0x00000009
+	smppSubmitSM        uint32 = 0x00000004
+	smppDeliverSM       uint32 = 0x00000005
+	smppUnbind          uint32 = 0x00000006
+	smppEnquireLink     uint32 = 0x00000015
+	smppResponse        uint32 = 0x80000000 // Set on every response command ID
+)
+
+// SMPP optional parameter tags
+const (
+	smppTagReceiptedMessageID uint16 = 0x001E
+	smppTagMessagePayload     uint16 = 0x0424
+	smppTagMessageState       uint16 = 0x0427
+)
+
+const (
+	smppDefaultPort    = 2775
+	smppMaxPDU         = 64 * 1024
+	smppRequestTimeout = 30 * time.Second
+	smppMaxBackoff     = time.Minute
+	// smppPartsTTL bounds how long parts of a concatenated message are kept
+	smppPartsTTL = 10 * time.Minute
+)
+
+// ErrSMPPNotBound is returned when sending while the bind is down; the
+// queue worker retries later
+var ErrSMPPNotBound = errors.New("smpp: not bound to SMSC")
+
+// SMPPConfig holds an SMPP transceiver bind's settings
+type SMPPConfig struct {
+	Host       string
+	Port       int
+	SystemID   string
+	Password   string
+	SystemType string
+	TLS        bool
+
+	// EnquireLink is the keepalive interval (default 30s)
+	EnquireLink time.Duration
+}
+
+// SMPPProvider implements SMSProvider over an SMPP 3.4 transceiver bind,
+// for carriers without a REST API. Messages are sent as GSM 03.38 where
+// possible, else UCS-2, split into concatenated parts when too long.
+// Inbound messages and delivery receipts arrive as deliver_sm on the bind.
+type SMPPProvider struct {
+	cfg SMPPConfig
+
+	onInbound func(*InboundMessage)
+	onStatus  func(*StatusUpdate)
+
+	mu      sync.Mutex
+	conn    net.Conn
+	seq     uint32
+	pending map[uint32]chan *smppPDU // Requests awaiting their response, by sequence
+	ref     uint8                    // Concatenation reference of the last long message
+	parts   map[string]*smppParts    // Inbound concatenated messages being reassembled
+	writeMu sync.Mutex
+
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// smppParts collects the parts of an inbound concatenated message
+type smppParts struct {
+	text    []string
+	got     int
+	started time.Time
+}
+
+// NewSMPPProvider creates an SMPP provider; call Start to bind
+func NewSMPPProvider(cfg SMPPConfig) *SMPPProvider {
+	if cfg.Port == 0 {
+		cfg.Port = smppDefaultPort
+	}
+	if cfg.EnquireLink <= 0 {
+		cfg.EnquireLink = 30 * time.Second
+	}
+	return &SMPPProvider{
+		cfg:     cfg,
+		pending: make(map[uint32]chan *smppPDU),
+		parts:   make(map[string]*smppParts),
+	}
+}
+
+func (p *SMPPProvider) Name() string {
+	return "smpp"
+}
+
+// OnInbound sets the handler for messages received from the SMSC
+func (p *SMPPProvider) OnInbound(fn func(*InboundMessage)) {
+	p.onInbound = fn
+}
+
+// OnStatus sets the handler for delivery receipts
+func (p *SMPPProvider) OnStatus(fn func(*StatusUpdate)) {
+	p.onStatus = fn
+}
+
+// Start binds to the SMSC and rebinds with backoff whenever the
+// connection drops
+func (p *SMPPProvider) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.stopped = make(chan struct{})
+
+	go func() {
+		defer close(p.stopped)
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := p.session(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > smppMaxBackoff {
+				backoff = time.Second
+			}
+			log.WithError(err).WithField("host", p.cfg.Host).Warnf("SMPP bind lost, rebinding in %s", backoff)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > smppMaxBackoff {
+				backoff = smppMaxBackoff
+			}
+		}
+	}()
+}
+
+// Stop unbinds and closes the connection
+func (p *SMPPProvider) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.stopped
+	}
+}
+
+// Bound reports whether the bind is up
+func (p *SMPPProvider) Bound() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn != nil
+}
+
+// session dials and binds, then serves the connection until it fails
+func (p *SMPPProvider) session(ctx context.Context) error {
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if p.cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: p.cfg.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	// Bind before anything else is sent
+	var body bytes.Buffer
+	writeCString(&body, p.cfg.SystemID)
+	writeCString(&body, p.cfg.Password)
+	writeCString(&body, p.cfg.SystemType)
+	body.Write([]byte{0x34, 0, 0}) // interface_version 3.4, addr_ton, addr_npi
+	writeCString(&body, "")        // address_range
+	bind := &smppPDU{id: smppBindTransceiver, seq: 1, body: body.Bytes()}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(bind.bytes()); err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	resp, err := readPDU(conn)
+	if err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	if resp.id != smppBindTransceiver|smppResponse || resp.status != 0 {
+		return fmt.Errorf("bind rejected: command 0x%08X status 0x%08X", resp.id, resp.status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	sessCtx, endSession := context.WithCancel(ctx)
+	defer endSession()
+	p.mu.Lock()
+	p.conn = conn
+	p.seq = 1
+	p.mu.Unlock()
+	defer p.unbound()
+	log.WithFields(log.Fields{"host": p.cfg.Host, "system_id": p.cfg.SystemID}).Info("SMPP bound")
+
+	// Unbind on shutdown; a closed connection also ends the read loop
+	go func() {
+		<-sessCtx.Done()
+		if ctx.Err() != nil {
+			p.write(conn, &smppPDU{id: smppUnbind, seq: p.nextSeq()})
+		}
+		conn.Close()
+	}()
+	go p.keepalive(sessCtx, conn)
+
+	for {
+		pdu, err := readPDU(conn)
+		if err != nil {
+			return err
+		}
+		if pdu.id&smppResponse != 0 {
+			p.mu.Lock()
+			ch := p.pending[pdu.seq]
+			delete(p.pending, pdu.seq)
+			p.mu.Unlock()
+			if ch != nil {
+				ch <- pdu
+			}
+			continue
+		}
+
+		switch pdu.id {
+		case smppDeliverSM:
+			p.write(conn, &smppPDU{id: smppDeliverSM | smppResponse, seq: pdu.seq, body: []byte{0}})
+			p.handleDeliver(pdu.body)
+		case smppEnquireLink:
+			p.write(conn, &smppPDU{id: smppEnquireLink | smppResponse, seq: pdu.seq})
+		case smppUnbind:
+			p.write(conn, &smppPDU{id: smppUnbind | smppResponse, seq: pdu.seq})
+			return errors.New("unbound by SMSC")
+		default:
+			p.write(conn, &smppPDU{id: smppGenericNack, status: 0x03, seq: pdu.seq}) // ESME_RINVCMDID
+		}
+	}
+}
+
+// unbound clears the connection and fails requests awaiting a response
+func (p *SMPPProvider) unbound() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conn = nil
+	for seq, ch := range p.pending {
+		close(ch)
+		delete(p.pending, seq)
+	}
+}
+
+// keepalive sends enquire_link on an idle bind and drops the connection
+// when the SMSC stops answering
+func (p *SMPPProvider) keepalive(ctx context.Context, conn net.Conn) {
+	ticker := time.NewTicker(p.cfg.EnquireLink)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.request(ctx, smppEnquireLink, nil); err != nil {
+				log.WithError(err).Warn("SMPP enquire_link failed")
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// nextSeq returns the next request sequence number
+func (p *SMPPProvider) nextSeq() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	if p.seq > 0x7FFFFFFF {
+		p.seq = 2
+	}
+	return p.seq
+}
+
+// write sends a PDU, serialising writers
+func (p *SMPPProvider) write(conn net.Conn, pdu *smppPDU) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := conn.Write(pdu.bytes())
+	return err
+}
+
+// request sends a PDU and waits for its response
+func (p *SMPPProvider) request(ctx context.Context, id uint32, body []byte) (*smppPDU, error) {
+	seq := p.nextSeq()
+	ch := make(chan *smppPDU, 1)
+	p.mu.Lock()
+	conn := p.conn
+	if conn == nil {
+		p.mu.Unlock()
+		return nil, ErrSMPPNotBound
+	}
+	p.pending[seq] = ch
+	p.mu.Unlock()
+
+	forget := func() {
+		p.mu.Lock()
+		delete(p.pending, seq)
+		p.mu.Unlock()
+	}
+	if err := p.write(conn, &smppPDU{id: id, seq: seq, body: body}); err != nil {
+		forget()
+		return nil, fmt.Errorf("smpp write: %w", err)
+	}
+
+	timer := time.NewTimer(smppRequestTimeout)
+	defer timer.Stop()
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, errors.New("smpp: connection lost awaiting response")
+		}
+		return resp, nil
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	case <-timer.C:
+		forget()
+		return nil, errors.New("smpp: response timed out")
+	}
+}
+
+// SendSMS submits a message, in concatenated parts when it is too long
+// for one. The first part's message ID identifies the message in
+// delivery receipts.
+func (p *SMPPProvider) SendSMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	p.mu.Lock()
+	p.ref++
+	ref := p.ref
+	p.mu.Unlock()
+	parts, coding := smppEncode(req.Body, ref)
+
+	srcTON, srcNPI, src := smppAddress(req.From)
+	dstTON, dstNPI, dst := smppAddress(req.To)
+	esmClass := byte(0)
+	if len(parts) > 1 {
+		esmClass = 0x40 // UDH indicator
+	}
+
+	var messageID string
+	for i, sm := range parts {
+		var body bytes.Buffer
+		writeCString(&body, "") // service_type
+		body.Write([]byte{srcTON, srcNPI})
+		writeCString(&body, src)
+		body.Write([]byte{dstTON, dstNPI})
+		writeCString(&body, dst)
+		body.Write([]byte{esmClass, 0, 0}) // esm_class, protocol_id, priority_flag
+		writeCString(&body, "")            // schedule_delivery_time
+		writeCString(&body, "")            // validity_period
+		body.Write([]byte{1, 0, coding, 0, byte(len(sm))})
+		body.Write(sm)
+
+		resp, err := p.request(ctx, smppSubmitSM, body.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if resp.status != 0 {
+			return nil, fmt.Errorf("smpp submit_sm rejected (part %d/%d): status 0x%08X", i+1, len(parts), resp.status)
+		}
+		if i == 0 {
+			r := &pduReader{b: resp.body}
+			messageID = r.cstring()
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"message_id": messageID,
+		"from":       req.From,
+		"to":         req.To,
+		"parts":      len(parts),
+	}).Info("SMPP message sent")
+
+	return &SendResponse{
+		MessageID:   messageID,
+		Status:      "queued",
+		Segments:    len(parts),
+		SubmittedAt: time.Now(),
+	}, nil
+}
+
+// SendMMS sends the text with the media links appended, as SMPP carries
+// text only
+func (p *SMPPProvider) SendMMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	lines := append([]string{req.Body}, req.MediaURLs...)
+	req.Body = strings.TrimSpace(strings.Join(lines, "\n"))
+	req.MediaURLs = nil
+	return p.SendSMS(ctx, req)
+}
+
+// ParseInboundWebhook is not used: messages arrive over the bind
+func (p *SMPPProvider) ParseInboundWebhook(r *http.Request) (*InboundMessage, error) {
+	return nil, ErrNoWebhooks
+}
+
+// ParseStatusWebhook is not used: receipts arrive over the bind
+func (p *SMPPProvider) ParseStatusWebhook(r *http.Request) (*StatusUpdate, error) {
+	return nil, ErrNoWebhooks
+}
+
+// VerifyWebhook is not used: the bind is authenticated
+func (p *SMPPProvider) VerifyWebhook(r *http.Request, secret string) error {
+	return ErrNoWebhooks
+}
+
+var (
+	smppReceiptID     = regexp.MustCompile(`id:(\S+)`)
+	smppReceiptStat   = regexp.MustCompile(`stat:(\w+)`)
+	smppReceiptErr    = regexp.MustCompile(`err:(\w+)`)
+	smppMessageStates = map[byte]string{1: "ENROUTE", 2: "DELIVRD", 3: "EXPIRED", 4: "DELETED", 5: "UNDELIV", 6: "ACCEPTD", 7: "UNKNOWN", 8: "REJECTD"}
+)
+
+// handleDeliver handles a deliver_sm: a delivery receipt or an inbound message
+func (p *SMPPProvider) handleDeliver(body []byte) {
+	r := &pduReader{b: body}
+	r.cstring() // service_type
+	srcTON := r.byte()
+	r.byte()
+	src := r.cstring()
+	dstTON := r.byte()
+	r.byte()
+	dst := r.cstring()
+	esmClass := r.byte()
+	r.bytes(2)  // protocol_id, priority_flag
+	r.cstring() // schedule_delivery_time
+	r.cstring() // validity_period
+	r.bytes(2)  // registered_delivery, replace_if_present_flag
+	coding := r.byte()
+	r.byte() // sm_default_msg_id
+	sm := r.bytes(int(r.byte()))
+	tlvs := r.tlvs()
+	if r.err {
+		log.Warn("SMPP: malformed deliver_sm")
+		return
+	}
+	if len(sm) == 0 && tlvs[smppTagMessagePayload] != nil {
+		sm = tlvs[smppTagMessagePayload]
+	}
+
+	// SMSC delivery receipt or intermediate notification
+	if kind := esmClass & 0x3C; kind == 0x04 || kind == 0x20 {
+		p.handleReceipt(string(sm), tlvs)
+		return
+	}
+
+	from, to := smppNumber(srcTON, src), smppNumber(dstTON, dst)
+	if esmClass&0x40 != 0 && len(sm) > 0 {
+		text, complete := p.reassemble(from, to, sm, coding)
+		if !complete {
+			return
+		}
+		p.deliver(from, to, text)
+		return
+	}
+	p.deliver(from, to, smppDecode(sm, coding))
+}
+
+// deliver passes a complete inbound message to the handler
+func (p *SMPPProvider) deliver(from, to, text string) {
+	if p.onInbound == nil {
+		return
+	}
+	p.onInbound(&InboundMessage{
+		From:       from,
+		To:         to,
+		Body:       text,
+		ReceivedAt: time.Now(),
+		Segments:   1,
+		Direction:  "inbound",
+	})
+}
+
+// handleReceipt passes a delivery receipt to the handler
+func (p *SMPPProvider) handleReceipt(text string, tlvs map[uint16][]byte) {
+	id, stat, errCode := "", "", ""
+	if m := smppReceiptID.FindStringSubmatch(text); m != nil {
+		id = m[1]
+	}
+	if v := tlvs[smppTagReceiptedMessageID]; v != nil {
+		id = strings.TrimRight(string(v), "\x00")
+	}
+	if m := smppReceiptStat.FindStringSubmatch(text); m != nil {
+		stat = m[1]
+	}
+	if v := tlvs[smppTagMessageState]; len(v) == 1 && smppMessageStates[v[0]] != "" {
+		stat = smppMessageStates[v[0]]
+	}
+	if m := smppReceiptErr.FindStringSubmatch(text); m != nil {
+		errCode = m[1]
+	}
+	if id == "" || p.onStatus == nil {
+		return
+	}
+
+	update := &StatusUpdate{
+		MessageID: id,
+		Status:    mapSMPPStat(stat),
+		UpdatedAt: time.Now(),
+	}
+	if update.Status == "failed" {
+		update.ErrorCode = errCode
+		update.ErrorMsg = stat
+	}
+	p.onStatus(update)
+}
+
+// reassemble stores one part of a concatenated message and returns the
+// whole text once every part has arrived
+func (p *SMPPProvider) reassemble(from, to string, sm []byte, coding byte) (string, bool) {
+	udhl := int(sm[0])
+	if len(sm) < udhl+1 {
+		return "", false
+	}
+	header, payload := sm[1:udhl+1], sm[udhl+1:]
+
+	var ref, total, seq int
+	for i := 0; i+1 < len(header); {
+		iei, length := header[i], int(header[i+1])
+		data := header[i+2:]
+		if len(data) < length {
+			break
+		}
+		switch {
+		case iei == 0x00 && length == 3:
+			ref, total, seq = int(data[0]), int(data[1]), int(data[2])
+		case iei == 0x08 && length == 4:
+			ref, total, seq = int(data[0])<<8|int(data[1]), int(data[2]), int(data[3])
+		}
+		i += 2 + length
+	}
+	text := smppDecode(payload, coding)
+	if total < 2 || seq < 1 || seq > total {
+		return text, true // Not concatenated after all
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%d", from, to, ref, total)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, parts := range p.parts {
+		if time.Since(parts.started) > smppPartsTTL {
+			delete(p.parts, k)
+		}
+	}
+	parts := p.parts[key]
+	if parts == nil {
+		parts = &smppParts{text: make([]string, total), started: time.Now()}
+		p.parts[key] = parts
+	}
+	if parts.text[seq-1] == "" {
+		parts.got++
+	}
+	parts.text[seq-1] = text
+	if parts.got < total {
+		return "", false
+	}
+	delete(p.parts, key)
+	return strings.Join(parts.text, ""), true
+}
+
+// mapSMPPStat maps delivery receipt states to normalized statuses
+func mapSMPPStat(stat string) string {
+	switch strings.ToUpper(stat) {
+	case "DELIVRD":
+		return "delivered"
+	case "ACCEPTD", "ENROUTE":
+		return "sent"
+	case "EXPIRED", "DELETED", "UNDELIV", "REJECTD", "UNKNOWN":
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// smppAddress converts a number to SMPP TON, NPI and address: E.164 is
+// international/ISDN, other digits unknown/ISDN, anything else alphanumeric
+func smppAddress(number string) (ton, npi byte, addr string) {
+	number = strings.ReplaceAll(number, " ", "")
+	if strings.HasPrefix(number, "+") {
+		return 1, 1, number[1:]
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return 5, 0, number
+		}
+	}
+	return 0, 1, number
+}
+
+// smppNumber converts an SMPP address back to E.164 when it is international
+func smppNumber(ton byte, addr string) string {
+	if ton == 1 && !strings.HasPrefix(addr, "+") {
+		return "+" + addr
+	}
+	return addr
+}
+
+// =====================
+// Message encoding
+// =====================
+
+// gsm7Basic is the GSM 03.38 default alphabet, indexed by septet
+var gsm7Basic = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+// gsm7Extension holds the characters reached through the 0x1B escape
+var gsm7Extension = map[rune]byte{'\f': 0x0A, '^': 0x14, '{': 0x28, '}': 0x29, '\\': 0x2F, '[': 0x3C, '~': 0x3D, ']': 0x3E, '|': 0x40, '€': 0x65}
+
+var gsm7Index = func() map[rune]byte {
+	index := make(map[rune]byte, len(gsm7Basic))
+	for i, r := range gsm7Basic {
+		if r != 0x1b {
+			index[r] = byte(i)
+		}
+	}
+	return index
+}()
+
+// gsm7Encode encodes text as unpacked GSM septets, or reports that it
+// needs UCS-2
+func gsm7Encode(text string) ([]byte, bool) {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if b, ok := gsm7Index[r]; ok {
+			out = append(out, b)
+		} else if b, ok := gsm7Extension[r]; ok {
+			out = append(out, 0x1B, b)
+		} else {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// gsm7Decode decodes unpacked GSM septets
+func gsm7Decode(b []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(b); i++ {
+		c := b[i] & 0x7F
+		if c == 0x1B && i+1 < len(b) {
+			i++
+			for r, e := range gsm7Extension {
+				if e == b[i] {
+					sb.WriteRune(r)
+					break
+				}
+			}
+			continue
+		}
+		sb.WriteRune(gsm7Basic[c])
+	}
+	return sb.String()
+}
+
+// smppEncode encodes text into one or more short messages and returns
+// the data_coding. Long messages get a concatenation UDH with reference
+// ref; parts never split an escape sequence or surrogate pair.
+func smppEncode(text string, ref byte) ([][]byte, byte) {
+	data, gsm := gsm7Encode(text)
+	coding, single, per := byte(0x00), 160, 153
+	if !gsm {
+		units := utf16.Encode([]rune(text))
+		data = make([]byte, len(units)*2)
+		for i, u := range units {
+			binary.BigEndian.PutUint16(data[i*2:], u)
+		}
+		coding, single, per = 0x08, 140, 134
+	}
+	if len(data) <= single {
+		return [][]byte{data}, coding
+	}
+
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := per
+		if n >= len(data) {
+			n = len(data)
+		} else if gsm && data[n-1] == 0x1B {
+			n-- // Keep the escape with its character
+		} else if !gsm {
+			if u := binary.BigEndian.Uint16(data[n-2:]); u >= 0xD800 && u < 0xDC00 {
+				n -= 2 // Keep the surrogate pair together
+			}
+		}
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	if len(chunks) > 255 {
+		chunks = chunks[:255]
+	}
+
+	parts := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = append([]byte{0x05, 0x00, 0x03, ref, byte(len(chunks)), byte(i + 1)}, chunk...)
+	}
+	return parts, coding
+}
+
+// smppDecode decodes a short message by its data_coding
+func smppDecode(b []byte, coding byte) string {
+	switch coding {
+	case 0x08: // UCS-2
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units))
+	case 0x01, 0x02, 0x04: // IA5 (ASCII), 8-bit binary
+		return string(b)
+	case 0x03: // Latin-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	default: // SMSC default alphabet
+		return gsm7Decode(b)
+	}
+}
+
+// =====================
+// PDUs
+// =====================
+
+// smppPDU is one SMPP protocol data unit
+type smppPDU struct {
+	id     uint32
+	status uint32
+	seq    uint32
+	body   []byte
+}
+
+// bytes encodes the PDU with its header
+func (p *smppPDU) bytes() []byte {
+	out := make([]byte, 16+len(p.body))
+	binary.BigEndian.PutUint32(out[0:], uint32(len(out)))
+	binary.BigEndian.PutUint32(out[4:], p.id)
+	binary.BigEndian.PutUint32(out[8:], p.status)
+	binary.BigEndian.PutUint32(out[12:], p.seq)
+	copy(out[16:], p.body)
+	return out
+}
+
+// readPDU reads one PDU
+func readPDU(r io.Reader) (*smppPDU, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:])
+	if length < 16 || length > smppMaxPDU {
+		return nil, fmt.Errorf("smpp: invalid PDU length %d", length)
+	}
+	pdu := &smppPDU{
+		id:     binary.BigEndian.Uint32(header[4:]),
+		status: binary.BigEndian.Uint32(header[8:]),
+		seq:    binary.BigEndian.Uint32(header[12:]),
+		body:   make([]byte, length-16),
+	}
+	if _, err := io.ReadFull(r, pdu.body); err != nil {
+		return nil, err
+	}
+	return pdu, nil
+}
+
+// writeCString writes a NUL-terminated string
+func writeCString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+// pduReader reads PDU body fields; err is set once the body runs short
+type pduReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *pduReader) byte() byte {
+	if len(r.b) < 1 {
+		r.err = true
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *pduReader) bytes(n int) []byte {
+	if len(r.b) < n {
+		r.err = true
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *pduReader) cstring() string {
+	i := bytes.IndexByte(r.b, 0)
+	if i < 0 {
+		r.err = true
+		return ""
+	}
+	s := string(r.b[:i])
+	r.b = r.b[i+1:]
+	return s
+}
+
+// tlvs reads the optional parameters after the mandatory fields
+func (r *pduReader) tlvs() map[uint16][]byte {
+	tlvs := make(map[uint16][]byte)
+	for len(r.b) >= 4 {
+		tag := binary.BigEndian.Uint16(r.b[0:])
+		length := int(binary.BigEndian.Uint16(r.b[2:]))
+		if len(r.b) < 4+length {
+			break
+		}
+		tlvs[tag] = r.b[4 : 4+length]
+		r.b = r.b[4+length:]
+	}
+	return tlvs
+}
@@ -0,0 +1,290 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	twilioAPIBase = "https://api.twilio.com"
+)
+
+// TwilioProvider implements SMSProvider for the Twilio Programmable
+// Messaging API
+type TwilioProvider struct {
+	accountSID     string
+	authToken      string
+	baseURL        string
+	statusCallback string // Our status webhook URL, sent with each message
+	webhookBase    string // Public base URL Twilio signs webhooks against
+	httpClient     *http.Client
+}
+
+// NewTwilioProvider creates a new Twilio provider. baseURL overrides the
+// API host (e.g. for a regional edge); webhookBase is the public base URL
+// of this API, used for status callbacks and signature checks behind
+// proxies. Both may be empty.
+func NewTwilioProvider(accountSID, authToken, baseURL, webhookBase, statusCallback string) *TwilioProvider {
+	if baseURL == "" {
+		baseURL = twilioAPIBase
+	}
+	return &TwilioProvider{
+		accountSID:     accountSID,
+		authToken:      authToken,
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		statusCallback: statusCallback,
+		webhookBase:    strings.TrimRight(webhookBase, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (t *TwilioProvider) Name() string {
+	return "twilio"
+}
+
+// twilioResponse is a Twilio Message resource, or an error
+type twilioResponse struct {
+	SID          string `json:"sid"`
+	Status       string `json:"status"`
+	NumSegments  string `json:"num_segments"`
+	Price        string `json:"price"`
+	ErrorCode    *int   `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+
+	// Error responses
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// SendSMS sends a text-only message via Twilio
+func (t *TwilioProvider) SendSMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	return t.send(ctx, req, nil)
+}
+
+// SendMMS sends a message with media via Twilio
+func (t *TwilioProvider) SendMMS(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	return t.send(ctx, req, req.MediaURLs)
+}
+
+// send makes the actual API call to Twilio
+func (t *TwilioProvider) send(ctx context.Context, req SendRequest, mediaURLs []string) (*SendResponse, error) {
+	form := url.Values{}
+	form.Set("From", req.From)
+	form.Set("To", req.To)
+	if req.Body != "" {
+		form.Set("Body", req.Body)
+	}
+	for _, u := range mediaURLs {
+		form.Add("MediaUrl", u)
+	}
+	if t.statusCallback != "" {
+		form.Set("StatusCallback", t.statusCallback)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.baseURL, url.PathEscape(t.accountSID))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("twilio API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var twResp twilioResponse
+	if err := json.Unmarshal(respBody, &twResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("twilio API error (status %d): %d - %s", resp.StatusCode, twResp.Code, twResp.Message)
+	}
+	if twResp.ErrorCode != nil {
+		return nil, fmt.Errorf("twilio API error: %d - %s", *twResp.ErrorCode, twResp.ErrorMessage)
+	}
+
+	segments, _ := strconv.Atoi(twResp.NumSegments)
+	cost, _ := strconv.ParseFloat(twResp.Price, 64)
+
+	log.WithFields(log.Fields{
+		"message_id": twResp.SID,
+		"from":       req.From,
+		"to":         req.To,
+		"media":      len(mediaURLs),
+		"segments":   segments,
+	}).Info("Twilio message sent")
+
+	return &SendResponse{
+		MessageID:   twResp.SID,
+		Status:      "queued",
+		Segments:    segments,
+		Cost:        -cost, // Twilio reports prices as negative amounts
+		SubmittedAt: time.Now(),
+	}, nil
+}
+
+// readForm reads a form-encoded webhook body, leaving it readable again
+func readForm(r *http.Request) (url.Values, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	return form, nil
+}
+
+// ParseInboundWebhook parses a Twilio incoming message webhook
+func (t *TwilioProvider) ParseInboundWebhook(r *http.Request) (*InboundMessage, error) {
+	form, err := readForm(r)
+	if err != nil {
+		return nil, err
+	}
+	if status := form.Get("MessageStatus"); status != "" && status != "received" {
+		return nil, ErrStatusCallback
+	}
+
+	var mediaURLs []string
+	numMedia, _ := strconv.Atoi(form.Get("NumMedia"))
+	for i := 0; i < numMedia; i++ {
+		if u := form.Get(fmt.Sprintf("MediaUrl%d", i)); u != "" {
+			mediaURLs = append(mediaURLs, u)
+		}
+	}
+
+	messageID := form.Get("MessageSid")
+	if messageID == "" {
+		messageID = form.Get("SmsSid")
+	}
+	segments, _ := strconv.Atoi(form.Get("NumSegments"))
+
+	return &InboundMessage{
+		MessageID:  messageID,
+		From:       form.Get("From"),
+		To:         form.Get("To"),
+		Body:       form.Get("Body"),
+		MediaURLs:  mediaURLs,
+		ReceivedAt: time.Now(),
+		Segments:   segments,
+		Direction:  "inbound",
+	}, nil
+}
+
+// ParseStatusWebhook parses a Twilio status callback
+func (t *TwilioProvider) ParseStatusWebhook(r *http.Request) (*StatusUpdate, error) {
+	form, err := readForm(r)
+	if err != nil {
+		return nil, err
+	}
+
+	status := form.Get("MessageStatus")
+	if status == "" {
+		status = form.Get("SmsStatus")
+	}
+	return &StatusUpdate{
+		MessageID: form.Get("MessageSid"),
+		Status:    mapTwilioStatus(status),
+		ErrorCode: form.Get("ErrorCode"),
+		ErrorMsg:  form.Get("ErrorMessage"),
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+// VerifyWebhook checks the X-Twilio-Signature header: the base64
+// HMAC-SHA1, keyed with the auth token, of the full request URL followed
+// by each POST parameter's name and value, sorted by name
+func (t *TwilioProvider) VerifyWebhook(r *http.Request, secret string) error {
+	if secret == "" {
+		return nil // Skip verification if no secret configured
+	}
+
+	signature := r.Header.Get("X-Twilio-Signature")
+	if signature == "" {
+		return fmt.Errorf("missing twilio signature header")
+	}
+
+	form, err := readForm(r)
+	if err != nil {
+		return err
+	}
+
+	// Twilio signs the URL it called, which behind a proxy is the public one
+	signedURL := r.URL.String()
+	if t.webhookBase != "" {
+		signedURL = t.webhookBase + r.URL.RequestURI()
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(TwilioSignature(secret, signedURL, form))) {
+		return fmt.Errorf("invalid webhook signature")
+	}
+	return nil
+}
+
+// TwilioSignature computes the X-Twilio-Signature of a form POST to rawURL
+func TwilioSignature(authToken, rawURL string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(rawURL)
+	for _, k := range keys {
+		for _, v := range form[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// mapTwilioStatus maps Twilio message statuses to normalized statuses
+func mapTwilioStatus(status string) string {
+	switch status {
+	case "accepted", "scheduled", "queued":
+		return "queued"
+	case "sending", "sent":
+		return "sent"
+	case "delivered":
+		return "delivered"
+	case "read":
+		return "read"
+	case "failed", "undelivered", "canceled":
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,626 @@
+// Package pms connects hotel property management systems to the PBX over the
+// FIAS protocol: guest check-in/out, room moves, DND and wake-up requests flow
+// in from the PMS, and call charges and wake-up results flow back.
+package pms
+
+import (
+	"bufio"
+	"callsign/models"
+	"callsign/services/hospitality"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// dialTimeout bounds the TCP connect to the PMS
+	dialTimeout = 10 * time.Second
+	// keepalive is how often a link alive (LA) is sent to the PMS
+	keepalive = 60 * time.Second
+	// maxBackoff caps the delay between reconnect attempts
+	maxBackoff = time.Minute
+	// postingRetryAfter is how long a posting waits for its answer before resending
+	postingRetryAfter = 5 * time.Minute
+	// maxPostingAttempts bounds resends of an unanswered posting
+	maxPostingAttempts = 3
+)
+
+// linkRecords are the record types announced to the PMS in link records (LR)
+var linkRecords = []struct {
+	recType string
+	fields  string
+}{
+	{RecGuestIn, "RNG#GNGF"},
+	{RecGuestOut, "RNG#"},
+	{RecGuestChange, "RNROG#GNGF"},
+	{RecRoomEquip, "RNDN"},
+	{RecWakeupReq, "RNDATI"},
+	{RecWakeupClear, "RNDATI"},
+	{RecWakeupAns, "RNDATIAS"},
+	{RecPosting, "RNPTTADDDUDATIP#"},
+	{RecPostingAns, "RNASDATIP#"},
+}
+
+// Connector keeps a FIAS link open to every enabled PMS interface
+type Connector struct {
+	db    *gorm.DB
+	stays *hospitality.StayService
+
+	links map[uint]*link // by tenant ID
+	mu    sync.Mutex
+}
+
+// NewConnector creates a PMS connector. Room changes are applied through stays.
+func NewConnector(db *gorm.DB, stays *hospitality.StayService) *Connector {
+	return &Connector{
+		db:    db,
+		stays: stays,
+		links: make(map[uint]*link),
+	}
+}
+
+// Start runs the reconcile loop, which opens links for enabled interfaces,
+// closes links for disabled ones and posts new call charges.
+func (c *Connector) Start(interval time.Duration) {
+	go func() {
+		c.reconcile()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.reconcile()
+		}
+	}()
+	log.Infof("PMS connector started (interval: %s)", interval)
+}
+
+// Stop closes all PMS links
+func (c *Connector) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, l := range c.links {
+		l.close()
+		delete(c.links, id)
+	}
+}
+
+// reconcile matches running links to the configured interfaces
+func (c *Connector) reconcile() {
+	var ifaces []models.PMSInterface
+	if err := c.db.Where("enabled = ?", true).Find(&ifaces).Error; err != nil {
+		log.Warnf("PMS connector: failed to load interfaces: %v", err)
+		return
+	}
+
+	wanted := make(map[uint]models.PMSInterface, len(ifaces))
+	for _, iface := range ifaces {
+		wanted[iface.TenantID] = iface
+	}
+
+	c.mu.Lock()
+	for tenantID, l := range c.links {
+		iface, ok := wanted[tenantID]
+		if !ok || iface.Host != l.iface.Host || iface.Port != l.iface.Port {
+			l.close()
+			delete(c.links, tenantID)
+			continue
+		}
+		l.setConfig(iface)
+	}
+	for tenantID, iface := range wanted {
+		if _, ok := c.links[tenantID]; !ok {
+			l := newLink(c, iface)
+			c.links[tenantID] = l
+			go l.run()
+		}
+	}
+	links := make([]*link, 0, len(c.links))
+	for _, l := range c.links {
+		links = append(links, l)
+	}
+	c.mu.Unlock()
+
+	for _, l := range links {
+		l.postCharges()
+	}
+}
+
+// Reload applies a changed interface configuration immediately
+func (c *Connector) Reload(tenantID uint) {
+	c.mu.Lock()
+	if l, ok := c.links[tenantID]; ok {
+		l.close()
+		delete(c.links, tenantID)
+	}
+	c.mu.Unlock()
+
+	c.db.Model(&models.PMSInterface{}).
+		Where("tenant_id = ? AND enabled = ?", tenantID, false).
+		Updates(map[string]interface{}{"link_status": models.PMSLinkDisabled, "link_error": ""})
+	go c.reconcile()
+}
+
+// Resync asks the PMS to resend the state of every room (database resync)
+func (c *Connector) Resync(tenantID uint) error {
+	l, ok := c.link(tenantID)
+	if !ok {
+		return fmt.Errorf("PMS link is not running")
+	}
+	return l.send(l.stamped(RecResyncReq))
+}
+
+// WakeupResult reports the outcome of a wake-up call to the room's PMS.
+// Register it with WakeupScheduler.OnEvent.
+func (c *Connector) WakeupResult(room *models.HotelRoom, event models.HotelRoomEvent) {
+	var status string
+	switch event.Event {
+	case models.RoomEventWakeupAnswered:
+		status = AnswerOK
+	case models.RoomEventWakeupEscalated, models.RoomEventWakeupFailed:
+		status = AnswerNoResponse
+	default:
+		return
+	}
+
+	l, ok := c.link(room.TenantID)
+	if !ok || !l.config().ReportWakeupResults {
+		return
+	}
+	at := time.Now()
+	if room.WakeupTime != nil {
+		at = *room.WakeupTime
+	}
+	date, clock := FormatDate(at.In(l.loc))
+	if err := l.send(NewRecord(RecWakeupAns,
+		FieldRoom, room.RoomNumber, FieldDate, date, FieldTime, clock, FieldAnswer, status,
+	)); err != nil {
+		l.logger.Warnf("PMS: failed to send wake-up answer: %v", err)
+	}
+}
+
+func (c *Connector) link(tenantID uint) (*link, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.links[tenantID]
+	return l, ok
+}
+
+// link is one tenant's connection to its PMS
+type link struct {
+	c      *Connector
+	loc    *time.Location
+	logger *log.Entry
+
+	iface   models.PMSInterface
+	ifaceMu sync.Mutex
+
+	conn    net.Conn
+	writeMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newLink(c *Connector, iface models.PMSInterface) *link {
+	var tenant models.Tenant
+	c.db.First(&tenant, iface.TenantID)
+	return &link{
+		c:     c,
+		iface: iface,
+		loc:   tenant.Location(),
+		logger: log.WithFields(log.Fields{
+			"tenant_id": iface.TenantID,
+			"pms":       net.JoinHostPort(iface.Host, strconv.Itoa(iface.Port)),
+		}),
+		done: make(chan struct{}),
+	}
+}
+
+func (l *link) config() models.PMSInterface {
+	l.ifaceMu.Lock()
+	defer l.ifaceMu.Unlock()
+	return l.iface
+}
+
+func (l *link) setConfig(iface models.PMSInterface) {
+	l.ifaceMu.Lock()
+	l.iface = iface
+	l.ifaceMu.Unlock()
+}
+
+func (l *link) stayOptions() hospitality.StayOptions {
+	iface := l.config()
+	return hospitality.StayOptions{UpdateCallerID: iface.UpdateCallerID, PurgeVoicemail: iface.PurgeVoicemail}
+}
+
+// close ends the link for good; run returns after the current connection drops
+func (l *link) close() {
+	l.once.Do(func() {
+		close(l.done)
+		l.writeMu.Lock()
+		if l.conn != nil {
+			l.conn.Write(l.stamped(RecLinkEnd).Encode())
+			l.conn.Close()
+		}
+		l.writeMu.Unlock()
+	})
+}
+
+func (l *link) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run connects to the PMS and reconnects with backoff until closed
+func (l *link) run() {
+	backoff := 5 * time.Second
+	for !l.closed() {
+		iface := l.config()
+		addr := net.JoinHostPort(iface.Host, strconv.Itoa(iface.Port))
+		l.setStatus(models.PMSLinkConnecting, "")
+
+		conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+		if err != nil {
+			l.logger.Warnf("PMS: connect failed: %v", err)
+			l.setStatus(models.PMSLinkDown, err.Error())
+			select {
+			case <-l.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = 5 * time.Second
+
+		now := time.Now()
+		l.c.db.Model(&models.PMSInterface{}).Where("id = ?", iface.ID).Update("last_connect_at", now)
+		l.logger.Info("PMS: connected")
+
+		err = l.serve(conn)
+		conn.Close()
+		if l.closed() {
+			l.setStatus(models.PMSLinkDisconnected, "")
+			return
+		}
+		msg := "connection closed"
+		if err != nil {
+			msg = err.Error()
+		}
+		l.logger.Warnf("PMS: link lost: %s", msg)
+		l.setStatus(models.PMSLinkDown, msg)
+	}
+}
+
+// serve runs the link protocol on an open connection until it fails
+func (l *link) serve(conn net.Conn) error {
+	l.writeMu.Lock()
+	l.conn = conn
+	l.writeMu.Unlock()
+	defer func() {
+		l.writeMu.Lock()
+		l.conn = nil
+		l.writeMu.Unlock()
+	}()
+
+	if l.closed() {
+		return nil
+	}
+	if err := l.send(l.stamped(RecLinkStart)); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(keepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				l.send(l.stamped(RecLinkAlive))
+			}
+		}
+	}()
+
+	reader := NewReader(bufio.NewReader(conn))
+	for {
+		rec, err := reader.Read()
+		if err != nil {
+			return err
+		}
+		if rec.Type == RecLinkEnd {
+			return fmt.Errorf("link ended by PMS")
+		}
+		l.handle(rec)
+	}
+}
+
+// send writes a record to the PMS
+func (l *link) send(rec Record) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	if l.conn == nil {
+		return fmt.Errorf("PMS link is down")
+	}
+	l.logger.Debugf("PMS >> %s", rec)
+	l.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := l.conn.Write(rec.Encode())
+	return err
+}
+
+// stamped builds a record carrying the current date and time
+func (l *link) stamped(recType string, kv ...string) Record {
+	date, clock := FormatDate(time.Now().In(l.loc))
+	return NewRecord(recType, append([]string{FieldDate, date, FieldTime, clock}, kv...)...)
+}
+
+func (l *link) setStatus(status models.PMSLinkStatus, linkErr string) {
+	l.c.db.Model(&models.PMSInterface{}).Where("id = ?", l.config().ID).
+		Updates(map[string]interface{}{"link_status": status, "link_error": linkErr})
+}
+
+// handle applies a record received from the PMS
+func (l *link) handle(rec Record) {
+	l.logger.Debugf("PMS << %s", rec)
+	now := time.Now()
+	l.c.db.Model(&models.PMSInterface{}).Where("id = ?", l.config().ID).Update("last_record_at", now)
+
+	switch rec.Type {
+	case RecLinkStart:
+		// Describe this interface and the records it exchanges, then go live
+		l.send(l.stamped(RecLinkDesc, FieldVersion, "1.0", FieldIfType, "PB"))
+		for _, lr := range linkRecords {
+			l.send(NewRecord(RecLinkRecord, FieldRecordID, lr.recType, FieldFieldList, lr.fields))
+		}
+		l.send(l.stamped(RecLinkAlive))
+	case RecLinkAlive:
+		l.setStatus(models.PMSLinkUp, "")
+	case RecResyncStart, RecResyncEnd:
+		l.logger.Infof("PMS: database resync %s", map[string]string{RecResyncStart: "started", RecResyncEnd: "finished"}[rec.Type])
+	case RecGuestIn:
+		l.guestIn(rec)
+	case RecGuestOut:
+		l.guestOut(rec)
+	case RecGuestChange:
+		l.guestChange(rec)
+	case RecRoomEquip:
+		l.roomEquipment(rec)
+	case RecWakeupReq, RecWakeupClear:
+		l.wakeup(rec)
+	case RecPostingAns:
+		l.postingAnswer(rec)
+	default:
+		l.logger.Debugf("PMS: ignoring %s record", rec.Type)
+	}
+}
+
+// room looks up the tenant's room by number
+func (l *link) room(number string) (*models.HotelRoom, bool) {
+	var room models.HotelRoom
+	if number == "" {
+		return nil, false
+	}
+	if err := l.c.db.Where("tenant_id = ? AND room_number = ?", l.config().TenantID, number).
+		First(&room).Error; err != nil {
+		l.logger.Warnf("PMS: unknown room %q", number)
+		return nil, false
+	}
+	return &room, true
+}
+
+// guestName joins the FIAS first name and surname fields
+func guestName(rec Record) string {
+	name := rec.Get(FieldGuestName)
+	if first := rec.Get(FieldFirstName); first != "" {
+		name = strings.TrimSpace(first + " " + name)
+	}
+	return name
+}
+
+func (l *link) guestIn(rec Record) {
+	room, ok := l.room(rec.Get(FieldRoom))
+	if !ok {
+		return
+	}
+	if err := l.c.stays.CheckIn(room, hospitality.Guest{Name: guestName(rec)}, l.stayOptions()); err != nil {
+		l.logger.Errorf("PMS: check-in of room %s failed: %v", room.RoomNumber, err)
+		return
+	}
+	l.logger.Infof("PMS: guest checked in to room %s", room.RoomNumber)
+}
+
+func (l *link) guestOut(rec Record) {
+	room, ok := l.room(rec.Get(FieldRoom))
+	if !ok {
+		return
+	}
+	if err := l.c.stays.CheckOut(room, l.stayOptions()); err != nil {
+		l.logger.Errorf("PMS: check-out of room %s failed: %v", room.RoomNumber, err)
+		return
+	}
+	l.logger.Infof("PMS: guest checked out of room %s", room.RoomNumber)
+}
+
+// guestChange handles room moves (RO set) and guest data changes
+func (l *link) guestChange(rec Record) {
+	to, ok := l.room(rec.Get(FieldRoom))
+	if !ok {
+		return
+	}
+
+	if old := rec.Get(FieldOldRoom); old != "" && old != to.RoomNumber {
+		from, ok := l.room(old)
+		if !ok {
+			return
+		}
+		if err := l.c.stays.Move(from, to, l.stayOptions()); err != nil {
+			l.logger.Errorf("PMS: room move %s -> %s failed: %v", from.RoomNumber, to.RoomNumber, err)
+			return
+		}
+		l.logger.Infof("PMS: guest moved from room %s to %s", from.RoomNumber, to.RoomNumber)
+	}
+
+	if name := guestName(rec); name != "" && name != to.GuestName {
+		if err := l.c.stays.Rename(to, name, l.stayOptions()); err != nil {
+			l.logger.Errorf("PMS: guest change for room %s failed: %v", to.RoomNumber, err)
+		}
+	}
+}
+
+func (l *link) roomEquipment(rec Record) {
+	if !rec.Has(FieldDND) {
+		return
+	}
+	room, ok := l.room(rec.Get(FieldRoom))
+	if !ok {
+		return
+	}
+	if err := l.c.stays.SetDND(room, rec.Get(FieldDND) == "Y"); err != nil {
+		l.logger.Errorf("PMS: DND update for room %s failed: %v", room.RoomNumber, err)
+	}
+}
+
+// wakeup schedules (WR) or clears (WC) a wake-up call at the PMS-local time
+func (l *link) wakeup(rec Record) {
+	room, ok := l.room(rec.Get(FieldRoom))
+	if !ok {
+		return
+	}
+
+	event := models.HotelRoomEvent{Event: models.RoomEventWakeupCancelled, Detail: "via PMS"}
+	if rec.Type == RecWakeupReq {
+		at, err := ParseDate(rec.Get(FieldDate), rec.Get(FieldTime), l.loc)
+		if err != nil {
+			l.logger.Warnf("PMS: invalid wake-up time for room %s: %v", room.RoomNumber, err)
+			return
+		}
+		room.SetWakeup(&at)
+		event = models.HotelRoomEvent{
+			Event:  models.RoomEventWakeupScheduled,
+			Detail: at.Format("2006-01-02 15:04 MST") + " via PMS",
+		}
+	} else {
+		room.SetWakeup(nil)
+	}
+
+	if err := l.c.db.Save(room).Error; err != nil {
+		l.logger.Errorf("PMS: wake-up update for room %s failed: %v", room.RoomNumber, err)
+		return
+	}
+	models.LogRoomEvent(l.c.db, room, event)
+}
+
+func (l *link) postingAnswer(rec Record) {
+	seq, err := strconv.ParseUint(rec.Get(FieldPostingSeq), 10, 64)
+	if err != nil {
+		return
+	}
+	status := models.PMSPostingRejected
+	updates := map[string]interface{}{"answer_status": rec.Get(FieldAnswer)}
+	if rec.Get(FieldAnswer) == AnswerOK {
+		status = models.PMSPostingPosted
+		updates["posted_at"] = time.Now()
+	}
+	updates["status"] = status
+	l.c.db.Model(&models.PMSPosting{}).
+		Where("id = ? AND tenant_id = ?", seq, l.config().TenantID).
+		Updates(updates)
+	if status == models.PMSPostingRejected {
+		l.logger.Warnf("PMS: posting %d rejected (%s)", seq, rec.Get(FieldAnswer))
+	}
+}
+
+// postCharges posts new outbound calls from occupied rooms to the guest folio
+// and resends postings the PMS never answered.
+func (l *link) postCharges() {
+	iface := l.config()
+	if !iface.PostCharges {
+		return
+	}
+	l.writeMu.Lock()
+	up := l.conn != nil
+	l.writeMu.Unlock()
+	if !up {
+		return
+	}
+
+	var stale []models.PMSPosting
+	l.c.db.Where("tenant_id = ? AND status = ? AND attempts < ? AND updated_at < ?",
+		iface.TenantID, models.PMSPostingPending, maxPostingAttempts, time.Now().Add(-postingRetryAfter)).
+		Find(&stale)
+	for _, p := range stale {
+		l.post(&p)
+	}
+
+	var rooms []models.HotelRoom
+	l.c.db.Where("tenant_id = ? AND status = ? AND extension <> ''", iface.TenantID, "occupied").Find(&rooms)
+	for _, room := range rooms {
+		if room.CheckInTime == nil {
+			continue
+		}
+
+		posted := l.c.db.Model(&models.PMSPosting{}).Select("call_record_id").Where("tenant_id = ?", iface.TenantID)
+		query := l.c.db.Where("tenant_id = ? AND extension = ? AND billable_sec > 0 AND start_time >= ? AND created_at >= ?",
+			iface.TenantID, room.Extension, *room.CheckInTime, iface.CreatedAt).
+			Where("direction = ? OR gateway_name <> ''", models.CallDirectionOutbound).
+			Where("id NOT IN (?)", posted)
+		if !iface.PostFreeCalls {
+			query = query.Where("cost > 0")
+		}
+
+		var records []models.CallRecord
+		query.Order("id ASC").Limit(100).Find(&records)
+		for _, cdr := range records {
+			p := models.PMSPosting{
+				TenantID:     iface.TenantID,
+				RoomID:       room.ID,
+				RoomNumber:   room.RoomNumber,
+				GuestName:    room.GuestName,
+				CallRecordID: cdr.ID,
+				CallUUID:     cdr.UUID.String(),
+				DialedNumber: cdr.DestinationNumber,
+				StartTime:    cdr.StartTime,
+				Duration:     cdr.BillableSec,
+				Amount:       int64(math.Round(cdr.Cost * 100)),
+				Currency:     cdr.Currency,
+				Status:       models.PMSPostingPending,
+			}
+			if err := l.c.db.Create(&p).Error; err != nil {
+				continue // already posted by a concurrent pass
+			}
+			l.post(&p)
+		}
+	}
+}
+
+// post sends a posting simple (PS) record for a call charge
+func (l *link) post(p *models.PMSPosting) {
+	date, clock := FormatDate(p.StartTime.In(l.loc))
+	rec := NewRecord(RecPosting,
+		FieldRoom, p.RoomNumber,
+		FieldPostingType, "C", // direct charge
+		FieldTotal, strconv.FormatInt(p.Amount, 10),
+		FieldDialed, p.DialedNumber,
+		FieldDuration, FormatDuration(p.Duration),
+		FieldDate, date,
+		FieldTime, clock,
+		FieldPostingSeq, strconv.FormatUint(uint64(p.ID), 10),
+	)
+	l.c.db.Model(p).Update("attempts", gorm.Expr("attempts + 1"))
+	if err := l.send(rec); err != nil {
+		l.logger.Warnf("PMS: failed to post call charge %d: %v", p.ID, err)
+	}
+}
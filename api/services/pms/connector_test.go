@@ -0,0 +1,143 @@
+package pms_test
+
+import (
+	"bufio"
+	"callsign/models"
+	"callsign/services/hospitality"
+	"callsign/services/pms"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRecordCodec(t *testing.T) {
+	rec := pms.NewRecord(pms.RecGuestIn, pms.FieldRoom, "101", pms.FieldGuestName, "Smith|Jr")
+	assert.Equal(t, "\x02GI|RN101|GNSmithJr|\x03", string(rec.Encode()))
+
+	reader := pms.NewReader(bufio.NewReader(strings.NewReader("noise\x02LA|DA260601|TI083000|\x03\x02GO|RN101|G#77|\x03")))
+	la, err := reader.Read()
+	require.NoError(t, err)
+	assert.Equal(t, pms.RecLinkAlive, la.Type)
+	gout, err := reader.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "77", gout.Get(pms.FieldReservation))
+
+	at, err := pms.ParseDate("260601", "0730", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 6, 1, 7, 30, 0, 0, time.UTC), at)
+	assert.Equal(t, "000205", pms.FormatDuration(125))
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // one shared in-memory database
+
+	require.NoError(t, db.AutoMigrate(
+		&models.Tenant{}, &models.Extension{}, &models.VoicemailBox{}, &models.VoicemailMessage{},
+		&models.HotelRoom{}, &models.HotelRoomEvent{}, &models.CallRecord{},
+		&models.PMSInterface{}, &models.PMSPosting{},
+	))
+	return db
+}
+
+func TestConnectorAgainstSimulatedPMS(t *testing.T) {
+	db := setupDB(t)
+
+	sim, err := pms.NewSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer sim.Close()
+
+	tenant := models.Tenant{Name: "Hotel", Domain: "hotel.example.com", Settings: `{"timezone":"America/Chicago"}`}
+	require.NoError(t, db.Create(&tenant).Error)
+	for _, n := range []string{"101", "102"} {
+		ext := models.Extension{TenantID: tenant.ID, Extension: n, Password: "x", EffectiveCallerIDName: "Room " + n}
+		require.NoError(t, db.Create(&ext).Error)
+		require.NoError(t, db.Create(&models.HotelRoom{TenantID: tenant.ID, RoomNumber: n, Extension: n, Status: "vacant"}).Error)
+		require.NoError(t, db.Create(&models.VoicemailBox{TenantID: tenant.ID, ExtensionID: ext.ID, Extension: n}).Error)
+	}
+	iface := models.PMSInterface{TenantID: tenant.ID, Host: "127.0.0.1", Port: sim.Addr().Port}
+	require.NoError(t, db.Create(&iface).Error)
+	require.NoError(t, db.Model(&iface).Updates(map[string]interface{}{
+		"enabled": true, "post_charges": true, "purge_voicemail": true, "update_caller_id": true,
+	}).Error)
+
+	connector := pms.NewConnector(db, hospitality.NewStayService(db, nil, nil, nil))
+	connector.Start(100 * time.Millisecond)
+	defer connector.Stop()
+	require.True(t, sim.WaitLink(5*time.Second), "link handshake")
+
+	room := func(n string) models.HotelRoom {
+		var r models.HotelRoom
+		db.Where("room_number = ?", n).First(&r)
+		return r
+	}
+	callerID := func(n string) string {
+		var e models.Extension
+		db.Where("extension = ?", n).First(&e)
+		return e.EffectiveCallerIDName
+	}
+
+	// Guest in: room occupied and the phone shows the guest name
+	require.NoError(t, sim.Send(pms.NewRecord(pms.RecGuestIn,
+		pms.FieldRoom, "101", pms.FieldReservation, "5001", pms.FieldGuestName, "Smith", pms.FieldFirstName, "John")))
+	require.Eventually(t, func() bool { return room("101").Status == "occupied" }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "John Smith", room("101").GuestName)
+	assert.Equal(t, "John Smith", callerID("101"))
+
+	// Wake-up request in the hotel's local time
+	require.NoError(t, sim.Send(pms.NewRecord(pms.RecWakeupReq, pms.FieldRoom, "101", pms.FieldDate, "991231", pms.FieldTime, "0630")))
+	require.Eventually(t, func() bool { return room("101").WakeupEnabled }, 5*time.Second, 20*time.Millisecond)
+	chicago, _ := time.LoadLocation("America/Chicago")
+	assert.True(t, room("101").WakeupTime.Equal(time.Date(1999, 12, 31, 6, 30, 0, 0, chicago)))
+
+	// An outbound call from the room is posted to the folio and answered
+	require.NoError(t, db.Create(&models.CallRecord{
+		UUID: uuid.New(), TenantID: tenant.ID, Extension: "101", DestinationNumber: "15551234567",
+		StartTime: time.Now(), BillableSec: 125, GatewayName: "trunk", Cost: 1.25,
+	}).Error)
+	var posting models.PMSPosting
+	require.Eventually(t, func() bool {
+		db.Limit(1).Find(&posting)
+		return posting.Status == models.PMSPostingPosted
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int64(125), posting.Amount)
+	assert.Equal(t, "101", posting.RoomNumber)
+
+	// Room move carries the guest and wake-up call over
+	require.NoError(t, sim.Send(pms.NewRecord(pms.RecGuestChange, pms.FieldRoom, "102", pms.FieldOldRoom, "101")))
+	require.Eventually(t, func() bool { return room("102").Status == "occupied" }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "vacant", room("101").Status)
+	assert.Equal(t, "John Smith", room("102").GuestName)
+	assert.True(t, room("102").WakeupEnabled)
+	assert.Equal(t, "Room 101", callerID("101"))
+
+	// DND from the PMS reaches the extension
+	require.NoError(t, sim.Send(pms.NewRecord(pms.RecRoomEquip, pms.FieldRoom, "102", pms.FieldDND, "Y")))
+	require.Eventually(t, func() bool { return room("102").DNDEnabled }, 5*time.Second, 20*time.Millisecond)
+
+	// Guest out purges the room's voicemail and restores the caller ID
+	var box models.VoicemailBox
+	db.Where("extension = ?", "102").First(&box)
+	require.NoError(t, db.Create(&models.VoicemailMessage{UUID: uuid.New(), BoxID: box.ID, TenantID: tenant.ID}).Error)
+	require.NoError(t, sim.Send(pms.NewRecord(pms.RecGuestOut, pms.FieldRoom, "102")))
+	require.Eventually(t, func() bool { return room("102").Status == "vacant" }, 5*time.Second, 20*time.Millisecond)
+	var remaining int64
+	db.Model(&models.VoicemailMessage{}).Where("box_id = ?", box.ID).Count(&remaining)
+	assert.Zero(t, remaining)
+	assert.Equal(t, "Room 102", callerID("102"))
+
+	var events []models.HotelRoomEvent
+	db.Where("room_id = ?", room("102").ID).Order("id").Find(&events)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.RoomEventCheckIn, events[0].Event)
+	assert.Equal(t, models.RoomEventCheckOut, events[1].Event)
+}
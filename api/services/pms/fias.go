@@ -0,0 +1,203 @@
+package pms
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FIAS framing: each record is STX <type>|<field>|<field>|... ETX, where a
+// field is a two-character ID followed by its value.
+const (
+	stx = 0x02
+	etx = 0x03
+)
+
+// FIAS record types used by the connector
+const (
+	RecLinkStart   = "LS"
+	RecLinkDesc    = "LD"
+	RecLinkRecord  = "LR"
+	RecLinkAlive   = "LA"
+	RecLinkEnd     = "LE"
+	RecResyncReq   = "DR"
+	RecResyncStart = "DS"
+	RecResyncEnd   = "DE"
+	RecGuestIn     = "GI"
+	RecGuestOut    = "GO"
+	RecGuestChange = "GC"
+	RecRoomEquip   = "RE"
+	RecWakeupReq   = "WR"
+	RecWakeupClear = "WC"
+	RecWakeupAns   = "WA"
+	RecPosting     = "PS"
+	RecPostingAns  = "PA"
+)
+
+// FIAS field IDs used by the connector
+const (
+	FieldDate        = "DA" // YYMMDD
+	FieldTime        = "TI" // HHMMSS
+	FieldRoom        = "RN"
+	FieldOldRoom     = "RO"
+	FieldReservation = "G#"
+	FieldGuestName   = "GN"
+	FieldFirstName   = "GF"
+	FieldDND         = "DN" // Y/N
+	FieldAnswer      = "AS"
+	FieldPostingSeq  = "P#"
+	FieldPostingType = "PT"
+	FieldTotal       = "TA"
+	FieldDialed      = "DD"
+	FieldDuration    = "DU" // HHMMSS
+	FieldVersion     = "V#"
+	FieldIfType      = "IF"
+	FieldRecordID    = "RI"
+	FieldFieldList   = "FL"
+)
+
+// FIAS answer status values (AS field)
+const (
+	AnswerOK           = "OK"
+	AnswerNoResponse   = "NR" // wake-up call not answered
+	AnswerUnprocessed  = "UR"
+	AnswerCheckedOut   = "CO"
+	AnswerNotAllowed   = "NA"
+	AnswerGuestUnknown = "NG"
+)
+
+// Field is a single FIAS field
+type Field struct {
+	ID    string
+	Value string
+}
+
+// Record is a FIAS record: a two-letter type and its fields in wire order
+type Record struct {
+	Type   string
+	Fields []Field
+}
+
+// NewRecord builds a record from alternating field IDs and values
+func NewRecord(recType string, kv ...string) Record {
+	r := Record{Type: recType}
+	for i := 0; i+1 < len(kv); i += 2 {
+		r.Fields = append(r.Fields, Field{ID: kv[i], Value: kv[i+1]})
+	}
+	return r
+}
+
+// Get returns the first value of a field, or "" when absent
+func (r Record) Get(id string) string {
+	for _, f := range r.Fields {
+		if f.ID == id {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Has reports whether the record carries the field
+func (r Record) Has(id string) bool {
+	for _, f := range r.Fields {
+		if f.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the framed wire form of the record. The field separator
+// and framing bytes are stripped from values.
+func (r Record) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteByte(stx)
+	b.WriteString(r.Type)
+	b.WriteByte('|')
+	for _, f := range r.Fields {
+		b.WriteString(f.ID)
+		b.WriteString(sanitize(f.Value))
+		b.WriteByte('|')
+	}
+	b.WriteByte(etx)
+	return b.Bytes()
+}
+
+// String renders the record without framing, for logs
+func (r Record) String() string {
+	return strings.Trim(string(r.Encode()), "\x02\x03")
+}
+
+func sanitize(v string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '|' || c == stx || c == etx {
+			return -1
+		}
+		return c
+	}, v)
+}
+
+// ParseRecord parses an unframed record body such as "GI|RN101|GNSmith|"
+func ParseRecord(body string) (Record, error) {
+	parts := strings.Split(strings.TrimSuffix(body, "|"), "|")
+	if len(parts[0]) != 2 {
+		return Record{}, fmt.Errorf("invalid FIAS record type %q", parts[0])
+	}
+	r := Record{Type: parts[0]}
+	for _, p := range parts[1:] {
+		if len(p) < 2 {
+			continue
+		}
+		r.Fields = append(r.Fields, Field{ID: p[:2], Value: p[2:]})
+	}
+	return r, nil
+}
+
+// Reader reads framed FIAS records from a stream
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader wraps a stream carrying FIAS records
+func NewReader(r *bufio.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read returns the next record, skipping bytes outside STX/ETX framing
+func (fr *Reader) Read() (Record, error) {
+	for {
+		frame, err := fr.r.ReadBytes(etx)
+		if err != nil {
+			return Record{}, err
+		}
+		start := bytes.LastIndexByte(frame, stx)
+		if start < 0 {
+			continue // line noise or a partial frame
+		}
+		body := string(frame[start+1 : len(frame)-1])
+		if body == "" {
+			continue
+		}
+		return ParseRecord(body)
+	}
+}
+
+// FormatDate returns t as FIAS DA and TI values
+func FormatDate(t time.Time) (date, clock string) {
+	return t.Format("060102"), t.Format("150405")
+}
+
+// ParseDate parses FIAS DA/TI values in loc. TI may be HHMM or HHMMSS.
+func ParseDate(date, clock string, loc *time.Location) (time.Time, error) {
+	if len(clock) == 4 {
+		clock += "00"
+	}
+	return time.ParseInLocation("060102150405", date+clock, loc)
+}
+
+// FormatDuration renders seconds as FIAS HHMMSS
+func FormatDuration(secs int) string {
+	return fmt.Sprintf("%02d%02d%02d", secs/3600, (secs/60)%60, secs%60)
+}
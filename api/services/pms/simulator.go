@@ -0,0 +1,117 @@
+package pms
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// Simulator is a minimal PMS-side FIAS server for local testing. It accepts
+// one PBX connection at a time, completes the link handshake, accepts every
+// posting and records everything the PBX sends.
+type Simulator struct {
+	listener net.Listener
+	received chan Record
+
+	mu   sync.Mutex
+	conn net.Conn
+	up   chan struct{}
+}
+
+// NewSimulator listens on addr (e.g. "127.0.0.1:0" for a free port)
+func NewSimulator(addr string) (*Simulator, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Simulator{
+		listener: ln,
+		received: make(chan Record, 256),
+		up:       make(chan struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the simulator listens on
+func (s *Simulator) Addr() *net.TCPAddr {
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
+// Received delivers every record sent by the PBX
+func (s *Simulator) Received() <-chan Record {
+	return s.received
+}
+
+// WaitLink blocks until the PBX completed the link handshake
+func (s *Simulator) WaitLink(timeout time.Duration) bool {
+	select {
+	case <-s.up:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Send writes a record to the connected PBX
+func (s *Simulator) Send(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return net.ErrClosed
+	}
+	_, err := s.conn.Write(rec.Encode())
+	return err
+}
+
+// Close stops the simulator
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	return s.listener.Close()
+}
+
+func (s *Simulator) accept() {
+	var once sync.Once
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
+
+		reader := NewReader(bufio.NewReader(conn))
+		for {
+			rec, err := reader.Read()
+			if err != nil {
+				break
+			}
+			switch rec.Type {
+			case RecLinkStart:
+				date, clock := FormatDate(time.Now())
+				s.Send(NewRecord(RecLinkStart, FieldDate, date, FieldTime, clock))
+			case RecLinkAlive:
+				date, clock := FormatDate(time.Now())
+				s.Send(NewRecord(RecLinkAlive, FieldDate, date, FieldTime, clock))
+				once.Do(func() { close(s.up) })
+			case RecPosting:
+				s.Send(NewRecord(RecPostingAns,
+					FieldRoom, rec.Get(FieldRoom),
+					FieldAnswer, AnswerOK,
+					FieldPostingSeq, rec.Get(FieldPostingSeq),
+				))
+			}
+			select {
+			case s.received <- rec:
+			default:
+			}
+		}
+		conn.Close()
+	}
+}
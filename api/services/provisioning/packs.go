@@ -0,0 +1,101 @@
+// Package provisioning ships the built-in vendor template packs and the
+// tooling around rendered phone configs: syntax validation and diffs.
+package provisioning
+
+import (
+	"callsign/models"
+	"embed"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//go:embed packs/*.tmpl
+var packFiles embed.FS
+
+// Pack is a maintained vendor template. Each pack covers a phone family and
+// exposes {{block}}s (lines, codecs, keys, time, directory, firmware, custom)
+// that model and tenant templates override through ParentID.
+type Pack struct {
+	Key              string
+	Name             string
+	Manufacturer     string
+	Family           string
+	ConfigType       string
+	UserAgentPattern string
+	MACPattern       string
+	file             string
+}
+
+// Packs lists the built-in template packs
+func Packs() []Pack {
+	return []Pack{
+		{Key: "yealink", Name: "Yealink T4x/T5x", Manufacturer: "Yealink", Family: "T4x/T5x",
+			ConfigType: "cfg", UserAgentPattern: "(?i)yealink", file: "yealink.tmpl"},
+		{Key: "poly", Name: "Poly VVX/CCX (UC Software)", Manufacturer: "Poly", Family: "VVX/CCX",
+			ConfigType: "xml", UserAgentPattern: "(?i)(poly|polycom)", file: "poly.tmpl"},
+		{Key: "grandstream", Name: "Grandstream GXP/GRP", Manufacturer: "Grandstream", Family: "GXP/GRP",
+			ConfigType: "xml", UserAgentPattern: "(?i)grandstream", file: "grandstream.tmpl"},
+		{Key: "snom", Name: "Snom D series", Manufacturer: "Snom", Family: "D3xx/D7xx",
+			ConfigType: "xml", UserAgentPattern: "(?i)snom", file: "snom.tmpl"},
+		{Key: "fanvil", Name: "Fanvil X series", Manufacturer: "Fanvil", Family: "X",
+			ConfigType: "cfg", UserAgentPattern: "(?i)fanvil", file: "fanvil.tmpl"},
+		{Key: "cisco-spa", Name: "Cisco SPA3xx/5xx", Manufacturer: "Cisco", Family: "SPA",
+			ConfigType: "xml", UserAgentPattern: "(?i)(cisco|linksys)", file: "cisco.tmpl"},
+	}
+}
+
+// Content returns the pack's template source
+func (p Pack) Content() (string, error) {
+	b, err := packFiles.ReadFile("packs/" + p.file)
+	return string(b), err
+}
+
+// SyncPacks creates or refreshes the system templates maintained from the
+// built-in packs. Packs an admin deleted stay deleted; admin edits to pack
+// templates are overwritten, so customisations belong in child templates.
+func SyncPacks(db *gorm.DB) error {
+	for _, p := range Packs() {
+		content, err := p.Content()
+		if err != nil {
+			return fmt.Errorf("pack %s: %w", p.Key, err)
+		}
+
+		var tmpl models.DeviceTemplate
+		err = db.Unscoped().Where("pack = ? AND tenant_id IS NULL", p.Key).Limit(1).Find(&tmpl).Error
+		switch {
+		case err != nil:
+			return fmt.Errorf("pack %s: %w", p.Key, err)
+		case tmpl.ID == 0:
+			tmpl = models.DeviceTemplate{
+				Name:             p.Name,
+				Description:      "Built-in " + p.Name + " template pack",
+				Manufacturer:     p.Manufacturer,
+				Family:           p.Family,
+				ConfigTemplate:   content,
+				ConfigType:       p.ConfigType,
+				UserAgentPattern: p.UserAgentPattern,
+				MACPattern:       p.MACPattern,
+				Pack:             p.Key,
+				IsSystem:         true,
+				Enabled:          true,
+			}
+			if err := db.Create(&tmpl).Error; err != nil {
+				return fmt.Errorf("pack %s: %w", p.Key, err)
+			}
+			log.Infof("Provisioning: installed %s template pack", p.Name)
+		case tmpl.DeletedAt.Valid:
+			continue
+		case tmpl.ConfigTemplate != content || tmpl.ConfigType != p.ConfigType:
+			if err := db.Model(&tmpl).Updates(map[string]interface{}{
+				"config_template": content,
+				"config_type":     p.ConfigType,
+			}).Error; err != nil {
+				return fmt.Errorf("pack %s: %w", p.Key, err)
+			}
+			log.Infof("Provisioning: updated %s template pack", p.Name)
+		}
+	}
+	return nil
+}
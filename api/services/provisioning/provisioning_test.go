@@ -0,0 +1,93 @@
+package provisioning_test
+
+import (
+	"bytes"
+	"callsign/models"
+	"callsign/services/provisioning"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPacksRenderValidConfig(t *testing.T) {
+	vars := provisioning.SampleVariables()
+
+	for _, p := range provisioning.Packs() {
+		t.Run(p.Key, func(t *testing.T) {
+			content, err := p.Content()
+			require.NoError(t, err)
+
+			chain := models.TemplateChain{{Name: p.Name, ConfigTemplate: content, ConfigType: p.ConfigType}}
+			var out bytes.Buffer
+			require.NoError(t, chain.Render(&out, vars))
+			require.NoError(t, provisioning.Validate(p.ConfigType, out.Bytes()), out.String())
+
+			config := out.String()
+			assert.Contains(t, config, "1002")       // second line
+			assert.Contains(t, config, "park+*5701") // park BLF key
+			assert.Contains(t, config, "15550100")   // speed dial key
+			assert.Contains(t, config, "pool.ntp.org")
+			assert.NotContains(t, config, "<no value>")
+		})
+	}
+}
+
+func TestSyncPacks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Firmware{}, &models.DeviceTemplate{}))
+
+	require.NoError(t, provisioning.SyncPacks(db))
+	var count int64
+	db.Model(&models.DeviceTemplate{}).Where("pack <> ''").Count(&count)
+	assert.Equal(t, int64(len(provisioning.Packs())), count)
+
+	// Stale content is refreshed, nothing is duplicated
+	require.NoError(t, db.Model(&models.DeviceTemplate{}).Where("pack = ?", "yealink").Update("config_template", "old").Error)
+	require.NoError(t, provisioning.SyncPacks(db))
+	var yealink models.DeviceTemplate
+	require.NoError(t, db.Where("pack = ?", "yealink").First(&yealink).Error)
+	assert.Contains(t, yealink.ConfigTemplate, "#!version:1.0.0.1")
+	db.Model(&models.DeviceTemplate{}).Where("pack <> ''").Count(&count)
+	assert.Equal(t, int64(len(provisioning.Packs())), count)
+
+	// A tenant override only redefines a block of the pack
+	override := models.DeviceTemplate{Name: "Acme Yealink", ParentID: &yealink.ID,
+		ConfigTemplate: `{{define "time"}}local_time.time_zone = +1{{end}}`}
+	chain, err := models.LoadTemplateChain(db, override)
+	require.NoError(t, err)
+	require.NoError(t, provisioning.ValidateChain(chain))
+	var out bytes.Buffer
+	require.NoError(t, chain.Render(&out, provisioning.SampleVariables()))
+	assert.Contains(t, out.String(), "local_time.time_zone = +1")
+	assert.Contains(t, out.String(), "account.1.user_name = 1001")
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, provisioning.Validate("xml", []byte(`<?xml version="1.0"?><a><b/></a>`)))
+	assert.Error(t, provisioning.Validate("xml", []byte(`<a><b></a>`)))
+	assert.Error(t, provisioning.Validate("xml", []byte(`<a/><b/>`)))
+	assert.Error(t, provisioning.Validate("xml", []byte(`<a>Smith & Co</a>`)))
+
+	assert.NoError(t, provisioning.Validate("json", []byte(`{"a": [1, 2]}`)))
+	assert.Error(t, provisioning.Validate("json", []byte(`{"a": }`)))
+
+	assert.NoError(t, provisioning.Validate("cfg", []byte("#!version:1.0.0.1\n[section]\naccount.1.enable = 1\nSNTP Server :pool.ntp.org\n")))
+	assert.Error(t, provisioning.Validate("cfg", []byte("account.1.enable = 1\njust some text\n")))
+}
+
+func TestDiff(t *testing.T) {
+	assert.Empty(t, provisioning.Diff("a", "b", "x\ny\n", "x\ny\n"))
+
+	old := "l1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\nl10\n"
+	updated := "l1\nl2\nL3\nl4\nl5\nl6\nl7\nl8\nl9\nl10\nl11\n"
+	diff := provisioning.Diff("last provisioned", "pending", old, updated)
+	assert.Equal(t, "--- last provisioned\n+++ pending\n"+
+		"@@ -1,6 +1,6 @@\n l1\n l2\n-l3\n+L3\n l4\n l5\n l6\n"+
+		"@@ -8,3 +8,4 @@\n l8\n l9\n l10\n+l11\n", diff)
+
+	assert.Contains(t, provisioning.Diff("a", "b", "", "new\n"), "+new\n")
+}
@@ -0,0 +1,133 @@
+package provisioning
+
+import (
+	"bytes"
+	"callsign/models"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Validate checks rendered config against the syntax of its declared
+// ConfigType. Unknown types are not checked.
+func Validate(configType string, content []byte) error {
+	switch configType {
+	case "xml":
+		return validateXML(content)
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal(content, &v); err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+	case "cfg":
+		return validateCfg(content)
+	}
+	return nil
+}
+
+func validateXML(content []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	dec.Strict = true
+	roots := 0
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XML: %v", err)
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		return fmt.Errorf("invalid XML: expected one root element, found %d", roots)
+	}
+	return nil
+}
+
+// validateCfg accepts the line-based formats phones use: key = value
+// (Yealink), key :value (Fanvil), [section] and <SECTION> headers, and
+// #, ; or // comments.
+func validateCfg(content []byte) error {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "",
+			strings.HasPrefix(line, "#"),
+			strings.HasPrefix(line, ";"),
+			strings.HasPrefix(line, "//"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"),
+			strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">"):
+			continue
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 || strings.TrimSpace(line[:sep]) == "" {
+			return fmt.Errorf("invalid cfg line %d: %q is not a key = value pair", i+1, line)
+		}
+	}
+	return nil
+}
+
+// SampleVariables is a representative device used to test-render templates
+// before they are saved
+func SampleVariables() models.ProvisioningVariables {
+	vars := models.ProvisioningVariables{
+		MAC:          "001565aabbcc",
+		DeviceName:   "Reception",
+		Model:        "T54W",
+		Manufacturer: "Yealink",
+		Server:       "pbx.example.com",
+		Domain:       "pbx.example.com",
+		ServerPort:   5060,
+		Transport:    "udp",
+		TenantName:   "Example & Co",
+		TenantDomain: "pbx.example.com",
+		Timestamp:    time.Now(),
+		NTPServer:    "pool.ntp.org",
+		DirectoryURL: "https://pbx.example.com/api/provision/t/s/001565aabbcc/directory",
+		FirmwareURL:  "https://pbx.example.com/api/provision/t/s/001565aabbcc/firmware/fw.rom",
+		Codecs:       models.ParseCodecs(""),
+		Custom:       map[string]string{},
+		Lines: map[int]models.LineVariables{
+			1: {LineNumber: 1, Extension: "1001", DisplayName: "Front <Desk>", Label: "1001",
+				UserID: "1001", AuthUser: "1001", Password: "s3cr&t", Server: "pbx.example.com", Enabled: true},
+			2: {LineNumber: 2, Extension: "1002", DisplayName: "Back Office", Label: "1002",
+				UserID: "1002", AuthUser: "1002", Password: "secret", Server: "pbx.example.com", Enabled: true},
+		},
+		Keys: []models.KeyVariables{
+			{Index: 1, Type: models.KeyTypeBLF, Label: "Sales", Value: "1003", BLF: "1003"},
+			{Index: 2, Type: models.KeyTypeSpeedDial, Label: "Support", Value: "15550100"},
+			{Index: 3, Type: models.KeyTypePark, Label: "Park 1", Value: "*5701", BLF: "park+*5701"},
+		},
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		loc = time.UTC
+	}
+	vars.SetTimezone(loc, vars.Timestamp)
+	return vars
+}
+
+// ValidateChain test-renders a template chain with SampleVariables and
+// validates the output against the chain's ConfigType
+func ValidateChain(chain models.TemplateChain) error {
+	var out bytes.Buffer
+	if err := chain.Render(&out, SampleVariables()); err != nil {
+		return err
+	}
+	return Validate(chain.ConfigType(), out.Bytes())
+}
@@ -0,0 +1,213 @@
+package rating
+
+import (
+	"callsign/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxImportErrors caps the row errors reported for a rejected import
+const maxImportErrors = 20
+
+// ImportRow is one destination in a deck import. Increments may be given
+// as "6/6" or as the two separate fields; both are optional.
+type ImportRow struct {
+	Prefix           string  `json:"prefix"`
+	Description      string  `json:"description"`
+	Rate             float64 `json:"rate"`
+	ConnectionFee    float64 `json:"connection_fee"`
+	Increments       string  `json:"increments"`
+	InitialIncrement int     `json:"initial_increment"`
+	Increment        int     `json:"increment"`
+}
+
+// ImportError reports the rows that made an import fail. Nothing is written
+// when any row is invalid.
+type ImportError struct {
+	Rows []string
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d invalid rows: %s", len(e.Rows), strings.Join(e.Rows, "; "))
+}
+
+// ImportResult summarises a deck import
+type ImportResult struct {
+	Imported int   `json:"imported"`
+	Cleared  int64 `json:"cleared"` // entries removed before a replacing import
+}
+
+// ParseCSV reads deck rows from CSV with a header row. Recognised columns
+// are prefix and rate (required), description (or destination),
+// connection_fee, increments, initial_increment and increment; others are
+// ignored.
+func ParseCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["prefix"]; !ok {
+		return nil, errors.New("missing prefix column")
+	}
+	if _, ok := cols["rate"]; !ok {
+		return nil, errors.New("missing rate column")
+	}
+	if _, ok := cols["description"]; !ok {
+		if i, ok := cols["destination"]; ok {
+			cols["description"] = i
+		}
+	}
+
+	var rows []ImportRow
+	var bad []string
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := ImportRow{
+			Prefix:      field("prefix"),
+			Description: field("description"),
+			Increments:  field("increments"),
+		}
+		var parseErr error
+		parse := func(name string, dst *float64) {
+			if v := field(name); v != "" && parseErr == nil {
+				*dst, parseErr = strconv.ParseFloat(v, 64)
+			}
+		}
+		parseInt := func(name string, dst *int) {
+			if v := field(name); v != "" && parseErr == nil {
+				*dst, parseErr = strconv.Atoi(v)
+			}
+		}
+		parse("rate", &row.Rate)
+		parse("connection_fee", &row.ConnectionFee)
+		parseInt("initial_increment", &row.InitialIncrement)
+		parseInt("increment", &row.Increment)
+		if parseErr != nil {
+			bad = append(bad, fmt.Sprintf("line %d: %v", line, parseErr))
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(bad) > 0 {
+		return nil, &ImportError{Rows: bad[:min(len(bad), maxImportErrors)]}
+	}
+	return rows, nil
+}
+
+// ParseJSON reads deck rows from a JSON array of ImportRow objects
+func ParseJSON(r io.Reader) ([]ImportRow, error) {
+	var rows []ImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return rows, nil
+}
+
+// Import upserts rows into a deck by prefix. With replace, the deck is
+// cleared first so prefixes missing from the import disappear. Rows are
+// validated first and the import is all-or-nothing; a prefix repeated in
+// the import keeps its last row.
+func Import(db *gorm.DB, deck *models.RateDeck, rows []ImportRow, replace bool) (*ImportResult, error) {
+	entries := make([]models.RateDeckEntry, 0, len(rows))
+	index := make(map[string]int)
+	var bad []string
+	for i, row := range rows {
+		entry, err := row.entry(deck.ID)
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("row %d: %v", i+1, err))
+			continue
+		}
+		if j, ok := index[entry.Prefix]; ok {
+			entries[j] = entry
+			continue
+		}
+		index[entry.Prefix] = len(entries)
+		entries = append(entries, entry)
+	}
+	if len(bad) > 0 {
+		return nil, &ImportError{Rows: bad[:min(len(bad), maxImportErrors)]}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("import has no rows")
+	}
+
+	result := &ImportResult{Imported: len(entries)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			del := tx.Where("rate_deck_id = ?", deck.ID).Delete(&models.RateDeckEntry{})
+			if del.Error != nil {
+				return del.Error
+			}
+			result.Cleared = del.RowsAffected
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "rate_deck_id"}, {Name: "prefix"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"description", "rate", "connection_fee", "initial_increment", "increment", "updated_at",
+			}),
+		}).CreateInBatches(&entries, 500).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// entry validates the row and converts it to a deck entry
+func (row ImportRow) entry(deckID uint) (models.RateDeckEntry, error) {
+	prefix := strings.TrimPrefix(strings.TrimSpace(row.Prefix), "+")
+	if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+		return models.RateDeckEntry{}, fmt.Errorf("prefix %q must be digits", row.Prefix)
+	}
+	if row.Rate < 0 || row.ConnectionFee < 0 {
+		return models.RateDeckEntry{}, fmt.Errorf("prefix %s: negative rate", prefix)
+	}
+	entry := models.RateDeckEntry{
+		RateDeckID:       deckID,
+		Prefix:           prefix,
+		Description:      strings.TrimSpace(row.Description),
+		Rate:             row.Rate,
+		ConnectionFee:    row.ConnectionFee,
+		InitialIncrement: row.InitialIncrement,
+		Increment:        row.Increment,
+	}
+	if row.Increments != "" {
+		initial, increment, err := models.ParseIncrements(row.Increments)
+		if err != nil {
+			return models.RateDeckEntry{}, fmt.Errorf("prefix %s: %v", prefix, err)
+		}
+		entry.InitialIncrement, entry.Increment = initial, increment
+	}
+	if entry.InitialIncrement < 0 || entry.Increment < 0 {
+		return models.RateDeckEntry{}, fmt.Errorf("prefix %s: negative increment", prefix)
+	}
+	return entry, nil
+}
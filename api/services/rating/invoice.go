@@ -0,0 +1,227 @@
+package rating
+
+import (
+	"callsign/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceLine totals a tenant's rated calls to one destination prefix at
+// one rate
+type InvoiceLine struct {
+	Prefix      string  `json:"prefix"`
+	Description string  `json:"description"`
+	Rate        float64 `json:"rate"`
+	Currency    string  `json:"currency"`
+	Calls       int     `json:"calls"`
+	BilledSec   int     `json:"billed_sec"`
+	Minutes     float64 `json:"minutes"`
+	Amount      float64 `json:"amount"`
+	CarrierCost float64 `json:"carrier_cost,omitempty"`
+}
+
+// Invoice summarises a tenant's carrier calls for one calendar month in the
+// tenant's timezone
+type Invoice struct {
+	TenantID    uint      `json:"tenant_id"`
+	TenantName  string    `json:"tenant_name"`
+	Month       string    `json:"month"` // YYYY-MM
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Currency    string    `json:"currency"`
+
+	Calls        int     `json:"calls"`
+	UnratedCalls int     `json:"unrated_calls"` // destinations missing from the tenant's deck
+	BilledSec    int     `json:"billed_sec"`
+	Minutes      float64 `json:"minutes"`
+	Total        float64 `json:"total"`
+	CarrierCost  float64 `json:"carrier_cost,omitempty"`
+	Margin       float64 `json:"margin,omitempty"`
+
+	Lines []InvoiceLine `json:"lines,omitempty"`
+}
+
+// Retail strips the carrier cost and margin, for showing an invoice to the
+// tenant it bills
+func (inv *Invoice) Retail() {
+	inv.CarrierCost, inv.Margin = 0, 0
+	for i := range inv.Lines {
+		inv.Lines[i].CarrierCost = 0
+	}
+}
+
+// ParseMonth reads a YYYY-MM billing month; empty means the current month
+func ParseMonth(s string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	month, err := time.Parse("2006-01", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", s)
+	}
+	return month, nil
+}
+
+// MonthlyInvoice builds the tenant's invoice for month, with per-destination
+// lines when withLines is set
+func MonthlyInvoice(db *gorm.DB, tenant *models.Tenant, month time.Time, withLines bool) (*Invoice, error) {
+	loc := tenant.Location()
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 1, 0)
+	inv := &Invoice{
+		TenantID:    tenant.ID,
+		TenantName:  tenant.Name,
+		Month:       start.Format("2006-01"),
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+
+	var rows []struct {
+		RateDeckID  *uint
+		RatePrefix  string
+		Rate        float64
+		Currency    string
+		Calls       int
+		BilledSec   int
+		Amount      float64
+		CarrierCost float64
+	}
+	err := db.Model(&models.CallRecord{}).
+		Select("rate_deck_id, rate_prefix, rate, currency, COUNT(*) AS calls, "+
+			"COALESCE(SUM(billed_sec), 0) AS billed_sec, COALESCE(SUM(cost), 0) AS amount, "+
+			"COALESCE(SUM(carrier_cost), 0) AS carrier_cost").
+		Where("tenant_id = ? AND gateway_name <> '' AND start_time >= ? AND start_time < ?", tenant.ID, start, end).
+		Group("rate_deck_id, rate_prefix, rate, currency").
+		Order("rate_prefix, rate").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("invoice for tenant %d: %w", tenant.ID, err)
+	}
+
+	descriptions := make(map[string]string)
+	for _, row := range rows {
+		inv.Calls += row.Calls
+		inv.CarrierCost += row.CarrierCost
+		if row.RateDeckID == nil {
+			inv.UnratedCalls += row.Calls
+			continue
+		}
+		inv.BilledSec += row.BilledSec
+		inv.Total += row.Amount
+		if inv.Currency == "" {
+			inv.Currency = row.Currency
+		}
+		if !withLines {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%s", *row.RateDeckID, row.RatePrefix)
+		desc, ok := descriptions[key]
+		if !ok {
+			var entry models.RateDeckEntry
+			db.Where("rate_deck_id = ? AND prefix = ?", *row.RateDeckID, row.RatePrefix).Limit(1).Find(&entry)
+			desc = entry.Description
+			descriptions[key] = desc
+		}
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			Prefix:      row.RatePrefix,
+			Description: desc,
+			Rate:        row.Rate,
+			Currency:    row.Currency,
+			Calls:       row.Calls,
+			BilledSec:   row.BilledSec,
+			Minutes:     roundMoney(float64(row.BilledSec) / 60),
+			Amount:      roundMoney(row.Amount),
+			CarrierCost: roundMoney(row.CarrierCost),
+		})
+	}
+	inv.Minutes = roundMoney(float64(inv.BilledSec) / 60)
+	inv.Total = roundMoney(inv.Total)
+	inv.CarrierCost = roundMoney(inv.CarrierCost)
+	inv.Margin = roundMoney(inv.Total - inv.CarrierCost)
+	return inv, nil
+}
+
+// MonthlyInvoices builds the summary (without lines) of every tenant that
+// made carrier calls in month
+func MonthlyInvoices(db *gorm.DB, month time.Time) ([]Invoice, error) {
+	// Widen by a day on each side to cover every tenant timezone;
+	// MonthlyInvoice applies the exact boundaries
+	from := month.AddDate(0, 0, -1)
+	to := month.AddDate(0, 1, 1)
+	var tenantIDs []uint
+	if err := db.Model(&models.CallRecord{}).Distinct("tenant_id").
+		Where("gateway_name <> '' AND start_time >= ? AND start_time < ?", from, to).
+		Order("tenant_id").
+		Pluck("tenant_id", &tenantIDs).Error; err != nil {
+		return nil, err
+	}
+
+	invoices := make([]Invoice, 0, len(tenantIDs))
+	for _, id := range tenantIDs {
+		var tenant models.Tenant
+		if err := db.Limit(1).Find(&tenant, id).Error; err != nil {
+			return nil, err
+		}
+		if tenant.ID == 0 {
+			continue
+		}
+		inv, err := MonthlyInvoice(db, &tenant, month, false)
+		if err != nil {
+			return nil, err
+		}
+		if inv.Calls > 0 {
+			invoices = append(invoices, *inv)
+		}
+	}
+	return invoices, nil
+}
+
+// WriteInvoicesCSV writes one summary row per tenant
+func WriteInvoicesCSV(w io.Writer, invoices []Invoice) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tenant_id", "tenant", "month", "currency", "calls", "unrated_calls",
+		"billed_minutes", "total", "carrier_cost", "margin"})
+	for _, inv := range invoices {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(inv.TenantID), 10), inv.TenantName, inv.Month, inv.Currency,
+			strconv.Itoa(inv.Calls), strconv.Itoa(inv.UnratedCalls),
+			formatAmount(inv.Minutes), formatAmount(inv.Total),
+			formatAmount(inv.CarrierCost), formatAmount(inv.Margin),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteInvoiceCSV writes a tenant invoice's destination lines followed by a
+// total row
+func WriteInvoiceCSV(w io.Writer, inv *Invoice) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"prefix", "description", "rate_per_minute", "currency", "calls", "billed_minutes", "amount"})
+	for _, line := range inv.Lines {
+		cw.Write([]string{
+			line.Prefix, line.Description, strconv.FormatFloat(line.Rate, 'f', -1, 64), line.Currency,
+			strconv.Itoa(line.Calls), formatAmount(line.Minutes), formatAmount(line.Amount),
+		})
+	}
+	cw.Write([]string{"", "Total " + inv.Month, "", inv.Currency,
+		strconv.Itoa(inv.Calls - inv.UnratedCalls), formatAmount(inv.Minutes), formatAmount(inv.Total)})
+	cw.Flush()
+	return cw.Error()
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
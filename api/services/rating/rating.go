@@ -0,0 +1,251 @@
+// Package rating prices call detail records against rate decks: the
+// tenant's retail deck fills CallRecord.Cost, the gateway's carrier deck
+// fills CallRecord.CarrierCost. It also imports decks and builds the
+// monthly per-tenant invoice summaries.
+package rating
+
+import (
+	"callsign/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rerateBatch is how many records Rerate loads and updates at a time
+const rerateBatch = 500
+
+// ratingColumns are the CallRecord columns Rate writes
+var ratingColumns = []string{
+	"rate_deck_id", "rate_prefix", "rate", "cost", "currency", "billed_sec",
+	"carrier_deck_id", "carrier_rate", "carrier_cost", "carrier_currency", "rated_at",
+}
+
+// Rate fills the rating columns of a CDR. Only calls that reached a carrier
+// gateway are rated; a destination missing from a deck leaves that side
+// unpriced.
+func Rate(db *gorm.DB, rec *models.CallRecord) error {
+	return newRater(db).rate(rec)
+}
+
+// rater caches deck lookups across the records of one rating run
+type rater struct {
+	db           *gorm.DB
+	tenantDecks  map[uint]*models.RateDeck
+	gatewayDecks map[string]*models.RateDeck
+}
+
+func newRater(db *gorm.DB) *rater {
+	return &rater{
+		db:           db,
+		tenantDecks:  make(map[uint]*models.RateDeck),
+		gatewayDecks: make(map[string]*models.RateDeck),
+	}
+}
+
+func (r *rater) rate(rec *models.CallRecord) error {
+	if rec.GatewayName == "" {
+		return nil
+	}
+	now := time.Now()
+	rec.RateDeckID, rec.RatePrefix, rec.Rate, rec.Cost, rec.BilledSec = nil, "", 0, 0, 0
+	rec.CarrierDeckID, rec.CarrierRate, rec.CarrierCost, rec.CarrierCurrency = nil, 0, 0, ""
+	rec.RatedAt = &now
+
+	number := NormalizeNumber(rec.DestinationNumber)
+	if number == "" {
+		return nil
+	}
+
+	deck, err := r.tenantDeck(rec.TenantID)
+	if err != nil {
+		return err
+	}
+	if deck != nil {
+		entry, err := Lookup(r.db, deck.ID, number)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			rec.Cost, rec.BilledSec = entry.Charge(deck, rec.BillableSec)
+			rec.RateDeckID = &deck.ID
+			rec.RatePrefix = entry.Prefix
+			rec.Rate = entry.Rate
+			rec.Currency = deck.Currency
+		}
+	}
+
+	carrier, err := r.gatewayDeck(rec.TenantID, rec.GatewayName)
+	if err != nil {
+		return err
+	}
+	if carrier != nil {
+		entry, err := Lookup(r.db, carrier.ID, number)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			rec.CarrierCost, _ = entry.Charge(carrier, rec.BillableSec)
+			rec.CarrierDeckID = &carrier.ID
+			rec.CarrierRate = entry.Rate
+			rec.CarrierCurrency = carrier.Currency
+		}
+	}
+	return nil
+}
+
+// tenantDeck resolves the tenant's retail deck, falling back to its
+// profile's. Disabled decks rate nothing.
+func (r *rater) tenantDeck(tenantID uint) (*models.RateDeck, error) {
+	if deck, ok := r.tenantDecks[tenantID]; ok {
+		return deck, nil
+	}
+	var tenant models.Tenant
+	if err := r.db.Preload("Profile").Limit(1).Find(&tenant, tenantID).Error; err != nil {
+		return nil, fmt.Errorf("rating: tenant %d: %w", tenantID, err)
+	}
+	deckID := tenant.RateDeckID
+	if deckID == nil && tenant.Profile != nil {
+		deckID = tenant.Profile.RateDeckID
+	}
+	deck, err := r.deck(deckID)
+	if err != nil {
+		return nil, err
+	}
+	r.tenantDecks[tenantID] = deck
+	return deck, nil
+}
+
+// gatewayDeck resolves the carrier deck of the named gateway, preferring a
+// tenant's own gateway over a system one of the same name
+func (r *rater) gatewayDeck(tenantID uint, name string) (*models.RateDeck, error) {
+	key := fmt.Sprintf("%d/%s", tenantID, name)
+	if deck, ok := r.gatewayDecks[key]; ok {
+		return deck, nil
+	}
+	var gateways []models.Gateway
+	if err := r.db.Where("gateway_name = ? AND (tenant_id IS NULL OR tenant_id = ?)", name, tenantID).
+		Find(&gateways).Error; err != nil {
+		return nil, fmt.Errorf("rating: gateway %s: %w", name, err)
+	}
+	var deckID *uint
+	for _, gw := range gateways {
+		if gw.RateDeckID != nil && (deckID == nil || gw.TenantID != nil) {
+			deckID = gw.RateDeckID
+		}
+	}
+	deck, err := r.deck(deckID)
+	if err != nil {
+		return nil, err
+	}
+	r.gatewayDecks[key] = deck
+	return deck, nil
+}
+
+func (r *rater) deck(id *uint) (*models.RateDeck, error) {
+	if id == nil {
+		return nil, nil
+	}
+	var deck models.RateDeck
+	if err := r.db.Limit(1).Find(&deck, *id).Error; err != nil {
+		return nil, fmt.Errorf("rating: deck %d: %w", *id, err)
+	}
+	if deck.ID == 0 || !deck.Enabled {
+		return nil, nil
+	}
+	return &deck, nil
+}
+
+// Lookup returns the deck entry with the longest prefix matching number, or
+// nil when no prefix matches
+func Lookup(db *gorm.DB, deckID uint, number string) (*models.RateDeckEntry, error) {
+	if number == "" {
+		return nil, nil
+	}
+	prefixes := make([]string, 0, len(number))
+	for i := len(number); i > 0; i-- {
+		prefixes = append(prefixes, number[:i])
+	}
+	var entry models.RateDeckEntry
+	err := db.Where("rate_deck_id = ? AND prefix IN ?", deckID, prefixes).
+		Order("LENGTH(prefix) DESC").
+		Limit(1).
+		Find(&entry).Error
+	if err != nil {
+		return nil, fmt.Errorf("rating: lookup %s: %w", number, err)
+	}
+	if entry.ID == 0 {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// NormalizeNumber reduces a dialed number to the digits decks are keyed
+// on: formatting and a leading + are dropped, as are the 00 and 011
+// international access codes.
+func NormalizeNumber(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	switch {
+	case strings.HasPrefix(digits, "011"):
+		return digits[3:]
+	case strings.HasPrefix(digits, "00"):
+		return digits[2:]
+	}
+	return digits
+}
+
+// RerateScope selects the records Rerate re-prices. Zero fields don't
+// filter; Since is required so closed periods aren't rewritten by accident.
+type RerateScope struct {
+	DeckID   uint // records priced with the deck, or whose tenant/gateway now uses it
+	TenantID uint
+	Since    time.Time
+}
+
+// Rerate re-prices the carrier calls in scope with the current decks and
+// assignments. Records already copied to ClickHouse are flagged so the sync
+// job pushes their new rating. Returns the number of records re-rated.
+func Rerate(db *gorm.DB, scope RerateScope) (int, error) {
+	if scope.Since.IsZero() {
+		return 0, fmt.Errorf("rating: rerate needs a start time")
+	}
+	query := db.Model(&models.CallRecord{}).
+		Where("gateway_name <> '' AND start_time >= ?", scope.Since)
+	if scope.TenantID != 0 {
+		query = query.Where("tenant_id = ?", scope.TenantID)
+	}
+	if scope.DeckID != 0 {
+		profiles := db.Model(&models.TenantProfile{}).Select("id").Where("rate_deck_id = ?", scope.DeckID)
+		tenants := db.Model(&models.Tenant{}).Select("id").
+			Where("rate_deck_id = ? OR (rate_deck_id IS NULL AND profile_id IN (?))", scope.DeckID, profiles)
+		gateways := db.Model(&models.Gateway{}).Select("gateway_name").Where("rate_deck_id = ?", scope.DeckID)
+		query = query.Where("rate_deck_id = ? OR carrier_deck_id = ? OR tenant_id IN (?) OR gateway_name IN (?)",
+			scope.DeckID, scope.DeckID, tenants, gateways)
+	}
+
+	r := newRater(db)
+	total := 0
+	var records []models.CallRecord
+	result := query.FindInBatches(&records, rerateBatch, func(tx *gorm.DB, batch int) error {
+		for i := range records {
+			rec := &records[i]
+			if err := r.rate(rec); err != nil {
+				return err
+			}
+			rec.RerateSyncPending = rec.SyncedToClickHouse
+			if err := db.Model(rec).Select(append(ratingColumns, "rerate_sync_pending")).Updates(rec).Error; err != nil {
+				return fmt.Errorf("rating: update %s: %w", rec.UUID, err)
+			}
+		}
+		total += len(records)
+		return nil
+	})
+	return total, result.Error
+}
@@ -0,0 +1,135 @@
+package rating_test
+
+import (
+	"bytes"
+	"callsign/models"
+	"callsign/services/rating"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Tenant{}, &models.TenantProfile{}, &models.Gateway{},
+		&models.CallRecord{}, &models.RateDeck{}, &models.RateDeckEntry{}))
+	return db
+}
+
+func importDeck(t *testing.T, db *gorm.DB, name, increments, csv string) *models.RateDeck {
+	initial, increment, err := models.ParseIncrements(increments)
+	require.NoError(t, err)
+	deck := &models.RateDeck{Name: name, Currency: "USD", Enabled: true,
+		InitialIncrement: initial, Increment: increment}
+	require.NoError(t, db.Create(deck).Error)
+	rows, err := rating.ParseCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+	_, err = rating.Import(db, deck, rows, false)
+	require.NoError(t, err)
+	return deck
+}
+
+func TestBilledSeconds(t *testing.T) {
+	assert.Equal(t, 0, models.BilledSeconds(0, 60, 60))
+	assert.Equal(t, 60, models.BilledSeconds(1, 60, 60))
+	assert.Equal(t, 120, models.BilledSeconds(61, 60, 60))
+	assert.Equal(t, 66, models.BilledSeconds(61, 6, 6))
+	assert.Equal(t, 30, models.BilledSeconds(7, 30, 6))
+	assert.Equal(t, 36, models.BilledSeconds(31, 30, 6))
+
+	_, _, err := models.ParseIncrements("6/0")
+	assert.Error(t, err)
+	initial, increment, err := models.ParseIncrements("30/6")
+	require.NoError(t, err)
+	assert.Equal(t, []int{30, 6}, []int{initial, increment})
+}
+
+func TestRateAndInvoice(t *testing.T) {
+	db := setupDB(t)
+
+	retail := importDeck(t, db, "Retail", "6/6",
+		"prefix,destination,rate,connection_fee\n1,USA,0.012,0\n44,UK,0.05,0\n4420,UK - London,0.02,0.01\n")
+	carrier := importDeck(t, db, "Carrier", "60/60", "prefix,rate\n1,0.004\n44,0.01\n")
+
+	profile := models.TenantProfile{Name: "Reseller", RateDeckID: &retail.ID}
+	require.NoError(t, db.Create(&profile).Error)
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.example.com", ProfileID: &profile.ID}
+	require.NoError(t, db.Create(&tenant).Error)
+	require.NoError(t, db.Create(&models.Gateway{GatewayName: "carrier1", Proxy: "sip.carrier", RateDeckID: &carrier.ID}).Error)
+
+	start := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+	calls := []*models.CallRecord{
+		{TenantID: tenant.ID, GatewayName: "carrier1", DestinationNumber: "+44 20 7946 0000", BillableSec: 61, StartTime: start},
+		{TenantID: tenant.ID, GatewayName: "carrier1", DestinationNumber: "011441619460000", BillableSec: 30, StartTime: start},
+		{TenantID: tenant.ID, GatewayName: "carrier1", DestinationNumber: "81312345678", BillableSec: 30, StartTime: start},
+		{TenantID: tenant.ID, DestinationNumber: "1002", BillableSec: 30, StartTime: start}, // internal, not rated
+	}
+	for _, rec := range calls {
+		require.NoError(t, rating.Rate(db, rec))
+		require.NoError(t, db.Create(rec).Error)
+	}
+
+	// Longest prefix wins: 4420 over 44, 66s billed in 6/6
+	london := calls[0]
+	assert.Equal(t, "4420", london.RatePrefix)
+	assert.Equal(t, 66, london.BilledSec)
+	assert.InDelta(t, 0.01+0.02*66/60, london.Cost, 0.00001)
+	assert.InDelta(t, 0.02, london.CarrierCost, 0.00001) // 120s at 0.01 in 60/60
+	assert.Equal(t, "44", calls[1].RatePrefix)
+	assert.Nil(t, calls[2].RateDeckID) // Japan is not in the deck
+	assert.Nil(t, calls[3].RatedAt)
+
+	inv, err := rating.MonthlyInvoice(db, &tenant, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, inv.Calls)
+	assert.Equal(t, 1, inv.UnratedCalls)
+	require.Len(t, inv.Lines, 2)
+	assert.Equal(t, "UK - London", inv.Lines[1].Description)
+	assert.InDelta(t, london.Cost+calls[1].Cost, inv.Total, 0.0001)
+
+	var out bytes.Buffer
+	require.NoError(t, rating.WriteInvoiceCSV(&out, inv))
+	assert.Contains(t, out.String(), "4420,UK - London,0.02,USD,1,1.1000,")
+
+	// A deck change re-rates, and flags records ClickHouse already has
+	require.NoError(t, db.Model(&models.CallRecord{}).Where("id = ?", london.ID).Update("synced_to_click_house", true).Error)
+	rows, err := rating.ParseCSV(strings.NewReader("prefix,rate\n4420,0.03\n"))
+	require.NoError(t, err)
+	_, err = rating.Import(db, retail, rows, false)
+	require.NoError(t, err)
+
+	count, err := rating.Rerate(db, rating.RerateScope{DeckID: retail.ID, Since: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	var rerated models.CallRecord
+	require.NoError(t, db.First(&rerated, london.ID).Error)
+	assert.InDelta(t, 0.03*66/60, rerated.Cost, 0.00001)
+	assert.True(t, rerated.RerateSyncPending)
+}
+
+func TestImportRejectsInvalidRows(t *testing.T) {
+	db := setupDB(t)
+	deck := &models.RateDeck{Name: "Bad", Enabled: true, InitialIncrement: 60, Increment: 60}
+	require.NoError(t, db.Create(deck).Error)
+
+	_, err := rating.ParseCSV(strings.NewReader("destination,rate\nUK,0.1\n"))
+	assert.Error(t, err)
+
+	rows, err := rating.ParseJSON(strings.NewReader(`[{"prefix":"44","rate":0.1},{"prefix":"4x","rate":0.1},{"prefix":"1","rate":0.1,"increments":"6/x"}]`))
+	require.NoError(t, err)
+	_, err = rating.Import(db, deck, rows, false)
+	var importErr *rating.ImportError
+	require.ErrorAs(t, err, &importErr)
+	assert.Len(t, importErr.Rows, 2)
+
+	var count int64
+	db.Model(&models.RateDeckEntry{}).Count(&count)
+	assert.Zero(t, count)
+}
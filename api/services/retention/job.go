@@ -0,0 +1,383 @@
+// Package retention enforces call recording retention policies and storage
+// quotas: expired recordings are archived or purged, and tenants over their
+// TenantProfile storage allowance are refused or rotated.
+package retention
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/storage"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is returned by CheckQuota when a tenant is over its
+// recording storage allowance and its policy refuses new recordings.
+var ErrQuotaExceeded = errors.New("recording storage quota exceeded")
+
+// Job runs retention and quota enforcement for call recordings
+type Job struct {
+	db          *gorm.DB
+	archivePath string
+	storage     *storage.Manager
+	batch       int
+}
+
+// NewJob creates a new retention job
+func NewJob(db *gorm.DB, cfg *config.Config) *Job {
+	return &Job{
+		db:          db,
+		archivePath: cfg.RecordingArchivePath,
+		batch:       500,
+	}
+}
+
+// SetStorage sets the object storage manager used to delete purged files
+func (j *Job) SetStorage(m *storage.Manager) {
+	j.storage = m
+}
+
+// StartPeriodic runs the job on an interval in the background
+func (j *Job) StartPeriodic(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := j.Run(); err != nil {
+				log.Errorf("Recording retention job failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Run backfills file sizes, applies retention to expired recordings and
+// rotates tenants that are over quota
+func (j *Job) Run() error {
+	start := time.Now()
+
+	j.backfillSizes()
+
+	expired, err := j.processExpired()
+	if err != nil {
+		return err
+	}
+
+	archivePurged, err := j.purgeArchived()
+	if err != nil {
+		return err
+	}
+
+	rotated, err := j.enforceQuotas()
+	if err != nil {
+		return err
+	}
+
+	if expired > 0 || archivePurged > 0 || rotated > 0 {
+		log.WithFields(log.Fields{
+			"expired":        expired,
+			"archive_purged": archivePurged,
+			"rotated":        rotated,
+			"duration":       time.Since(start).String(),
+		}).Info("Recording retention job completed")
+	}
+	return nil
+}
+
+// backfillSizes records the on-disk size of completed recordings that were
+// saved before the file was finalised
+func (j *Job) backfillSizes() {
+	var recs []models.CallRecording
+	j.db.Where("file_size = 0 AND file_path <> '' AND end_time > start_time").
+		Limit(j.batch).Find(&recs)
+
+	for i := range recs {
+		if info, err := os.Stat(recs[i].FilePath); err == nil && info.Size() > 0 {
+			j.db.Model(&recs[i]).Update("file_size", info.Size())
+		}
+	}
+}
+
+// processExpired archives or purges recordings past their expiry date.
+// Legal holds and already-archived recordings are never touched.
+func (j *Job) processExpired() (int, error) {
+	now := time.Now()
+	policies := make(map[uint]models.RecordingPolicy)
+	var lastID uint
+	count := 0
+
+	for {
+		var recs []models.CallRecording
+		err := j.db.Where("id > ? AND expires_at > ? AND expires_at <= ? AND legal_hold = ? AND archived = ?",
+			lastID, time.Time{}, now, false, false).
+			Order("id ASC").Limit(j.batch).Find(&recs).Error
+		if err != nil {
+			return count, fmt.Errorf("failed to load expired recordings: %w", err)
+		}
+		if len(recs) == 0 {
+			return count, nil
+		}
+
+		for i := range recs {
+			rec := &recs[i]
+			lastID = rec.ID
+
+			policy, ok := policies[rec.TenantID]
+			if !ok {
+				policy = models.LoadRecordingPolicy(j.db, rec.TenantID)
+				policies[rec.TenantID] = policy
+			}
+
+			switch {
+			case policy.ArchiveBeforeDelete:
+				if err := j.archive(rec); err != nil {
+					log.WithField("recording_id", rec.ID).Warnf("Recording archive failed: %v", err)
+					continue
+				}
+			case policy.AutoDeleteExpired:
+				if err := j.purge(rec, "expired"); err != nil {
+					log.WithField("recording_id", rec.ID).Warnf("Recording purge failed: %v", err)
+					continue
+				}
+			default:
+				continue
+			}
+			count++
+		}
+	}
+}
+
+// purgeArchived deletes archived recordings once the tenant's archive
+// retention has passed, completing archive-then-delete. Legal holds are kept.
+func (j *Job) purgeArchived() (int, error) {
+	var tenantIDs []uint
+	if err := j.db.Model(&models.CallRecording{}).
+		Where("archived = ? AND legal_hold = ?", true, false).
+		Distinct().Pluck("tenant_id", &tenantIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to load archived recordings: %w", err)
+	}
+
+	count := 0
+	for _, tenantID := range tenantIDs {
+		policy := models.LoadRecordingPolicy(j.db, tenantID)
+		if policy.ArchiveRetentionDays <= 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -policy.ArchiveRetentionDays)
+
+		var lastID uint
+		for {
+			var recs []models.CallRecording
+			err := j.db.Where("id > ? AND tenant_id = ? AND archived = ? AND legal_hold = ? AND archived_at <= ?",
+				lastID, tenantID, true, false, cutoff).
+				Order("id ASC").Limit(j.batch).Find(&recs).Error
+			if err != nil {
+				return count, fmt.Errorf("failed to load archived recordings: %w", err)
+			}
+			if len(recs) == 0 {
+				break
+			}
+			for i := range recs {
+				lastID = recs[i].ID
+				if err := j.purge(&recs[i], "archive_expired"); err != nil {
+					log.WithField("recording_id", recs[i].ID).Warnf("Archived recording purge failed: %v", err)
+					continue
+				}
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// enforceQuotas rotates out the oldest recordings for tenants that are over
+// quota and have opted into rotation. Archived recordings still occupy
+// storage, so they count toward the quota and are rotated out first.
+func (j *Job) enforceQuotas() (int, error) {
+	var rows []struct {
+		TenantID uint
+		Bytes    int64
+	}
+	err := j.db.Model(&models.CallRecording{}).
+		Select("tenant_id, COALESCE(SUM(file_size), 0) AS bytes").
+		Group("tenant_id").Scan(&rows).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute recording usage: %w", err)
+	}
+
+	count := 0
+	for _, row := range rows {
+		policy := models.LoadRecordingPolicy(j.db, row.TenantID)
+		if policy.QuotaBytes <= 0 || row.Bytes <= policy.QuotaBytes || policy.QuotaAction != models.RecordingQuotaRotate {
+			continue
+		}
+		n, _ := j.rotate(row.TenantID, row.Bytes-policy.QuotaBytes)
+		count += n
+	}
+	return count, nil
+}
+
+// rotate purges the tenant's oldest recordings until at least need bytes are freed
+func (j *Job) rotate(tenantID uint, need int64) (int, int64) {
+	var freed int64
+	count := 0
+
+	for freed < need {
+		var recs []models.CallRecording
+		j.db.Where("tenant_id = ? AND legal_hold = ? AND file_size > 0", tenantID, false).
+			Order("archived DESC, start_time ASC, id ASC").Limit(50).Find(&recs)
+		if len(recs) == 0 {
+			break
+		}
+
+		progressed := false
+		for i := range recs {
+			if freed >= need {
+				break
+			}
+			if err := j.purge(&recs[i], "quota_rotation"); err != nil {
+				log.WithField("recording_id", recs[i].ID).Warnf("Recording rotation failed: %v", err)
+				continue
+			}
+			freed += recs[i].FileSize
+			count++
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	if count > 0 {
+		log.WithFields(log.Fields{
+			"tenant_id": tenantID,
+			"purged":    count,
+			"freed":     freed,
+		}).Info("Rotated recordings to stay within storage quota")
+	}
+	return count, freed
+}
+
+// CheckQuota reports whether the tenant may start a new recording. Tenants
+// with a rotate policy have space reclaimed instead of being refused.
+func (j *Job) CheckQuota(tenantID uint) error {
+	policy := models.LoadRecordingPolicy(j.db, tenantID)
+	if policy.QuotaBytes <= 0 {
+		return nil
+	}
+
+	used := usedBytes(j.db, tenantID)
+	if used < policy.QuotaBytes {
+		return nil
+	}
+
+	if policy.QuotaAction == models.RecordingQuotaRotate {
+		// Free a little headroom beyond the quota so the next recording fits
+		headroom := policy.QuotaBytes / 100
+		if _, freed := j.rotate(tenantID, used-policy.QuotaBytes+headroom); used-freed < policy.QuotaBytes {
+			return nil
+		}
+	}
+	return ErrQuotaExceeded
+}
+
+// archive moves the recording file into the archive tree and flags the row.
+// Recordings already held in a remote backend stay where they are.
+func (j *Job) archive(rec *models.CallRecording) error {
+	dest := rec.FilePath
+	if rec.FilePath != "" && j.archivePath != "" && !j.storage.Remote() {
+		dest = filepath.Join(j.archivePath, strconv.FormatUint(uint64(rec.TenantID), 10), filepath.Base(rec.FilePath))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := moveFile(rec.FilePath, dest); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		j.storage.Relocate(rec.FilePath, dest)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"archived":    true,
+		"archived_at": now,
+		"file_path":   dest,
+	}
+	if dest != rec.FilePath {
+		updates["storage_type"] = "archive"
+	}
+	if err := j.db.Model(rec).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	j.audit(rec, models.AuditActionUpdate, map[string]interface{}{
+		"event":        "recording_archived",
+		"archive_path": dest,
+		"expires_at":   rec.ExpiresAt,
+	})
+	return nil
+}
+
+// purge removes the recording file, its transcriptions and the row itself
+func (j *Job) purge(rec *models.CallRecording, reason string) error {
+	if rec.FilePath != "" {
+		if err := j.storage.Delete(context.Background(), rec.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err := j.db.Transaction(func(tx *gorm.DB) error {
+		sub := tx.Model(&models.Transcription{}).Select("id").Where("call_recording_id = ?", rec.ID)
+		if err := tx.Unscoped().Where("transcription_id IN (?)", sub).Delete(&models.TranscriptionSegment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("call_recording_id = ?", rec.ID).Delete(&models.Transcription{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(rec).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	j.audit(rec, models.AuditActionDelete, map[string]interface{}{
+		"event":  "recording_purged",
+		"reason": reason,
+	})
+	return nil
+}
+
+// audit writes a system audit entry for a retention action
+func (j *Job) audit(rec *models.CallRecording, action models.AuditAction, details map[string]interface{}) {
+	details["call_uuid"] = rec.CallUUID
+	details["file_path"] = rec.FilePath
+	details["file_size"] = rec.FileSize
+	err := models.CreateAuditLog(j.db, rec.TenantID, 0, "retention", "system", "", "",
+		action, "call_recording", strconv.FormatUint(uint64(rec.ID), 10), true, nil, details)
+	if err != nil {
+		log.Warnf("Failed to write retention audit log: %v", err)
+	}
+}
+
+// moveFile renames src to dst, falling back to copy+remove across filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,83 @@
+package retention
+
+import (
+	"callsign/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Usage summarises a tenant's recording storage against its policy
+type Usage struct {
+	TenantID         uint                   `json:"tenant_id"`
+	Recordings       int64                  `json:"recordings"`
+	UsedBytes        int64                  `json:"used_bytes"` // Live and archived recordings, counted against the quota
+	ArchivedCount    int64                  `json:"archived_count"`
+	ArchivedBytes    int64                  `json:"archived_bytes"`
+	LegalHoldCount   int64                  `json:"legal_hold_count"`
+	ExpiringIn7Days  int64                  `json:"expiring_in_7_days"`
+	OldestRecording  *time.Time             `json:"oldest_recording,omitempty"`
+	QuotaBytes       int64                  `json:"quota_bytes"` // 0 = unlimited
+	QuotaUsedPercent float64                `json:"quota_used_percent"`
+	OverQuota        bool                   `json:"over_quota"`
+	Policy           models.RecordingPolicy `json:"policy"`
+}
+
+// usedBytes sums the size of a tenant's recordings, archived ones included
+func usedBytes(db *gorm.DB, tenantID uint) int64 {
+	var used int64
+	db.Model(&models.CallRecording{}).
+		Select("COALESCE(SUM(file_size), 0)").
+		Where("tenant_id = ?", tenantID).
+		Scan(&used)
+	return used
+}
+
+// TenantUsage builds the recording usage report for a tenant
+func TenantUsage(db *gorm.DB, tenantID uint) Usage {
+	u := Usage{
+		TenantID: tenantID,
+		Policy:   models.LoadRecordingPolicy(db, tenantID),
+	}
+	u.QuotaBytes = u.Policy.QuotaBytes
+
+	base := func() *gorm.DB {
+		return db.Model(&models.CallRecording{}).Where("tenant_id = ?", tenantID)
+	}
+
+	var live struct {
+		Count int64
+		Bytes int64
+	}
+	base().Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("archived = ?", false).Scan(&live)
+	u.Recordings = live.Count
+	u.UsedBytes = live.Bytes
+
+	var archived struct {
+		Count int64
+		Bytes int64
+	}
+	base().Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("archived = ?", true).Scan(&archived)
+	u.ArchivedCount = archived.Count
+	u.ArchivedBytes = archived.Bytes
+	u.UsedBytes += archived.Bytes
+
+	base().Where("legal_hold = ?", true).Count(&u.LegalHoldCount)
+
+	now := time.Now()
+	base().Where("archived = ? AND legal_hold = ? AND expires_at > ? AND expires_at <= ?",
+		false, false, time.Time{}, now.AddDate(0, 0, 7)).Count(&u.ExpiringIn7Days)
+
+	var oldest models.CallRecording
+	if err := base().Where("archived = ?", false).Order("start_time ASC").First(&oldest).Error; err == nil && !oldest.StartTime.IsZero() {
+		u.OldestRecording = &oldest.StartTime
+	}
+
+	if u.QuotaBytes > 0 {
+		u.QuotaUsedPercent = float64(u.UsedBytes) / float64(u.QuotaBytes) * 100
+		u.OverQuota = u.UsedBytes >= u.QuotaBytes
+	}
+	return u
+}
@@ -0,0 +1,64 @@
+// Package storage abstracts where recordings, voicemail, fax documents, media
+// and TTS audio are kept. FreeSWITCH always reads and writes local files; the
+// Manager mirrors those files to the configured backend (local disk or an
+// S3-compatible object store), verifies checksums and fetches them back on
+// demand when the local copy has been evicted.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an object does not exist in the backend
+	ErrNotFound = errors.New("storage object not found")
+
+	// ErrPresignUnsupported is returned by backends that can't issue signed URLs
+	ErrPresignUnsupported = errors.New("presigned URLs not supported by backend")
+
+	// ErrChecksumMismatch is returned when stored content doesn't match its recorded checksum
+	ErrChecksumMismatch = errors.New("storage checksum mismatch")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key            string
+	Size           int64
+	ContentType    string
+	ETag           string
+	ChecksumSHA256 string // From object metadata, when the backend stores it
+	ModTime        time.Time
+}
+
+// PutOptions carries metadata for an upload
+type PutOptions struct {
+	ContentType    string
+	ChecksumSHA256 string // Hex SHA-256 of the content; verified by the backend when supported
+}
+
+// Backend is an object store
+type Backend interface {
+	// Name returns the backend type ("filesystem", "s3")
+	Name() string
+
+	// Bucket returns the bucket or root the backend writes to
+	Bucket() string
+
+	// Put stores size bytes from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error
+
+	// Get opens the object for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+
+	// Stat returns object metadata without reading the content
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+
+	// PresignGet returns a time-limited URL for direct download
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
@@ -0,0 +1,8 @@
+package storage
+
+import "time"
+
+// Presign exposes presigned URL generation at a fixed time for tests
+func Presign(b *S3Backend, key string, ttl time.Duration, now time.Time) string {
+	return b.presign(key, ttl, now)
+}
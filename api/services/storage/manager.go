@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BackendLocalOnly marks objects that only exist at their local path
+const BackendLocalOnly = "local"
+
+// Manager mirrors locally written files to the storage backend and resolves
+// reads back to either the local copy or the backend. A nil *Manager is valid
+// and behaves as plain local disk, so callers don't need to nil-check.
+type Manager struct {
+	db         *gorm.DB
+	backend    Backend // nil = files stay on local disk only
+	keepLocal  bool
+	presignTTL time.Duration
+}
+
+// NewManager builds the manager from configuration
+func NewManager(db *gorm.DB, cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		db:         db,
+		keepLocal:  cfg.StorageKeepLocal,
+		presignTTL: time.Duration(cfg.StoragePresignTTL) * time.Second,
+	}
+
+	switch cfg.StorageBackend {
+	case "", "local":
+		if cfg.StorageLocalRoot != "" {
+			m.backend = NewLocalBackend(cfg.StorageLocalRoot)
+		}
+	case "s3":
+		b, err := NewS3Backend(S3Config{
+			Endpoint:  cfg.StorageS3Endpoint,
+			Region:    cfg.StorageS3Region,
+			Bucket:    cfg.StorageS3Bucket,
+			AccessKey: cfg.StorageS3AccessKey,
+			SecretKey: cfg.StorageS3SecretKey,
+			PathStyle: cfg.StorageS3PathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.backend = b
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+
+	return m, nil
+}
+
+// NewManagerWithBackend creates a manager around an explicit backend
+func NewManagerWithBackend(db *gorm.DB, backend Backend, keepLocal bool, presignTTL time.Duration) *Manager {
+	return &Manager{db: db, backend: backend, keepLocal: keepLocal, presignTTL: presignTTL}
+}
+
+// BackendName returns the active backend type
+func (m *Manager) BackendName() string {
+	if m == nil || m.backend == nil {
+		return BackendLocalOnly
+	}
+	return m.backend.Name()
+}
+
+// Remote reports whether files are mirrored to a backend
+func (m *Manager) Remote() bool {
+	return m != nil && m.backend != nil
+}
+
+// Store registers a locally written file, uploading it to the backend when
+// one is configured. Evictable categories lose their local copy after a
+// verified upload unless keep-local is set.
+func (m *Manager) Store(ctx context.Context, category models.StorageCategory, tenantID uint, localPath, contentType string) (*models.StorageObject, error) {
+	if m == nil || localPath == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", localPath, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := checksumReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("checksum %s: %w", localPath, err)
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(localPath))
+	}
+
+	obj := m.lookup(localPath)
+	if obj == nil {
+		obj = &models.StorageObject{LocalPath: localPath}
+	}
+	prevBackend, prevKey := obj.Backend, obj.Key
+	obj.TenantID = tenantID
+	obj.Category = category
+	obj.Size = info.Size()
+	obj.ContentType = contentType
+	obj.ChecksumSHA256 = sum
+	obj.LocalCopy = true
+	obj.Backend = BackendLocalOnly
+	obj.Bucket = ""
+	obj.Key = localPath
+	obj.VerifyError = ""
+
+	if m.backend != nil {
+		// Re-uploads overwrite the existing object rather than orphaning it
+		key := prevKey
+		if prevBackend != m.backend.Name() || key == "" {
+			key = objectKey(category, tenantID, localPath)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := m.backend.Put(ctx, key, f, info.Size(), PutOptions{ContentType: contentType, ChecksumSHA256: sum}); err != nil {
+			return nil, fmt.Errorf("upload %s: %w", localPath, err)
+		}
+		obj.Backend = m.backend.Name()
+		obj.Bucket = m.backend.Bucket()
+		obj.Key = key
+
+		if err := m.verifyRemote(ctx, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	obj.VerifiedAt = &now
+	if err := m.save(obj); err != nil {
+		return nil, err
+	}
+
+	if m.backend != nil && !m.keepLocal && category.Evictable() {
+		f.Close()
+		if err := os.Remove(localPath); err == nil {
+			obj.LocalCopy = false
+			m.db.Model(obj).Update("local_copy", false)
+		}
+	}
+
+	return obj, nil
+}
+
+// StoreAsync stores the file in the background, logging failures
+func (m *Manager) StoreAsync(category models.StorageCategory, tenantID uint, localPath, contentType string) {
+	if m == nil || localPath == "" {
+		return
+	}
+	go func() {
+		if _, err := m.Store(context.Background(), category, tenantID, localPath, contentType); err != nil {
+			log.WithFields(log.Fields{
+				"category": category,
+				"path":     localPath,
+			}).Warnf("Storage upload failed (will retry in migration): %v", err)
+		}
+	}()
+}
+
+// Lookup returns the storage record for a local path, if any
+func (m *Manager) Lookup(localPath string) (*models.StorageObject, bool) {
+	if m == nil {
+		return nil, false
+	}
+	obj := m.lookup(localPath)
+	return obj, obj != nil
+}
+
+func (m *Manager) lookup(localPath string) *models.StorageObject {
+	var obj models.StorageObject
+	if err := m.db.Unscoped().Where("local_path = ?", localPath).First(&obj).Error; err != nil {
+		return nil
+	}
+	return &obj
+}
+
+func (m *Manager) save(obj *models.StorageObject) error {
+	obj.DeletedAt = gorm.DeletedAt{}
+	return m.db.Unscoped().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "local_path"}},
+		UpdateAll: true,
+	}).Save(obj).Error
+}
+
+// Open returns a reader for a file: the local copy when present, otherwise
+// the backend object with checksum verification on read.
+func (m *Manager) Open(ctx context.Context, localPath string) (io.ReadCloser, int64, error) {
+	if f, err := os.Open(localPath); err == nil {
+		info, statErr := f.Stat()
+		if statErr != nil {
+			f.Close()
+			return nil, 0, statErr
+		}
+		return f, info.Size(), nil
+	} else if m == nil {
+		return nil, 0, err
+	}
+
+	obj, ok := m.Lookup(localPath)
+	if !ok || obj.Backend == BackendLocalOnly || m.backend == nil {
+		return nil, 0, ErrNotFound
+	}
+
+	rc, info, err := m.backend.Get(ctx, obj.Key)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := info.Size
+	if size <= 0 {
+		size = obj.Size
+	}
+	return newVerifyingReader(rc, obj.ChecksumSHA256), size, nil
+}
+
+// Localize makes sure the file exists at its local path, downloading and
+// verifying it from the backend if the local copy was evicted. FreeSWITCH
+// playback and attachment readers call this before touching the path.
+func (m *Manager) Localize(ctx context.Context, localPath string) (string, error) {
+	if _, err := os.Stat(localPath); err == nil {
+		return localPath, nil
+	}
+	if m == nil || m.backend == nil {
+		return localPath, ErrNotFound
+	}
+
+	obj, ok := m.Lookup(localPath)
+	if !ok || obj.Backend == BackendLocalOnly {
+		return localPath, ErrNotFound
+	}
+
+	rc, _, err := m.backend.Get(ctx, obj.Key)
+	if err != nil {
+		return localPath, err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return localPath, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".fetch-*")
+	if err != nil {
+		return localPath, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, newVerifyingReader(rc, obj.ChecksumSHA256)); err != nil {
+		tmp.Close()
+		return localPath, err
+	}
+	if err := tmp.Close(); err != nil {
+		return localPath, err
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return localPath, err
+	}
+
+	m.db.Model(obj).Update("local_copy", true)
+	return localPath, nil
+}
+
+// SignedURL returns a presigned download URL when the file is only available
+// remotely and presigned reads are enabled
+func (m *Manager) SignedURL(localPath string) (string, bool) {
+	if m == nil || m.backend == nil || m.presignTTL <= 0 {
+		return "", false
+	}
+	if _, err := os.Stat(localPath); err == nil {
+		return "", false
+	}
+	obj, ok := m.Lookup(localPath)
+	if !ok || obj.Backend == BackendLocalOnly {
+		return "", false
+	}
+	url, err := m.backend.PresignGet(obj.Key, m.presignTTL)
+	if err != nil {
+		return "", false
+	}
+	return url, true
+}
+
+// Relocate points a local-only record at a file's new path after it was moved
+// on disk. Objects held in a backend keep their key.
+func (m *Manager) Relocate(oldPath, newPath string) {
+	if m == nil || oldPath == newPath {
+		return
+	}
+	obj, ok := m.Lookup(oldPath)
+	if !ok {
+		return
+	}
+	updates := map[string]interface{}{"local_path": newPath}
+	if obj.Backend == BackendLocalOnly {
+		updates["key"] = newPath
+	}
+	m.db.Model(obj).Updates(updates)
+}
+
+// Delete removes the local file, the backend object and the storage record
+func (m *Manager) Delete(ctx context.Context, localPath string) error {
+	if localPath == "" {
+		return nil
+	}
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if m == nil {
+		return nil
+	}
+
+	obj, ok := m.Lookup(localPath)
+	if !ok {
+		return nil
+	}
+	if obj.Backend != BackendLocalOnly && m.backend != nil {
+		if err := m.backend.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return m.db.Unscoped().Delete(obj).Error
+}
+
+// Verify re-checks an object's checksum against the local copy or backend
+// metadata and records the result
+func (m *Manager) Verify(ctx context.Context, obj *models.StorageObject) error {
+	var err error
+	if obj.Backend == BackendLocalOnly || m.backend == nil {
+		err = verifyLocal(obj)
+	} else {
+		err = m.verifyRemote(ctx, obj)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"verified_at": now, "verify_error": ""}
+	if err != nil {
+		updates["verify_error"] = err.Error()
+	}
+	m.db.Model(obj).Updates(updates)
+	return err
+}
+
+// verifyRemote compares backend metadata with the recorded size and checksum
+func (m *Manager) verifyRemote(ctx context.Context, obj *models.StorageObject) error {
+	info, err := m.backend.Stat(ctx, obj.Key)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", obj.Key, err)
+	}
+	if info.Size != obj.Size {
+		return fmt.Errorf("%w: %s size %d, expected %d", ErrChecksumMismatch, obj.Key, info.Size, obj.Size)
+	}
+	if info.ChecksumSHA256 != "" && !strings.EqualFold(info.ChecksumSHA256, obj.ChecksumSHA256) {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, obj.Key)
+	}
+	return nil
+}
+
+func verifyLocal(obj *models.StorageObject) error {
+	f, err := os.Open(obj.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum, err := checksumReader(f)
+	if err != nil {
+		return err
+	}
+	if sum != obj.ChecksumSHA256 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, obj.LocalPath)
+	}
+	return nil
+}
+
+// objectKey builds a unique backend key: category/tenant/yyyy/mm/uuid-name
+func objectKey(category models.StorageCategory, tenantID uint, localPath string) string {
+	now := time.Now().UTC()
+	return fmt.Sprintf("%s/%d/%s/%s-%s", category, tenantID, now.Format("2006/01"),
+		uuid.New().String()[:8], filepath.Base(localPath))
+}
+
+func checksumReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyingReader hashes content as it is read and fails at EOF on mismatch
+type verifyingReader struct {
+	rc       io.ReadCloser
+	h        hash.Hash
+	expected string
+}
+
+func newVerifyingReader(rc io.ReadCloser, expected string) io.ReadCloser {
+	if expected == "" {
+		return rc
+	}
+	return &verifyingReader{rc: rc, h: sha256.New(), expected: expected}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.rc.Read(p)
+	v.h.Write(p[:n])
+	if errors.Is(err, io.EOF) && hex.EncodeToString(v.h.Sum(nil)) != v.expected {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.rc.Close()
+}
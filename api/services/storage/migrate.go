@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"callsign/models"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// candidate is a file referenced by a DB row that may need migrating
+type candidate struct {
+	ID       uint
+	TenantID uint
+	Path     string
+}
+
+// migrationSource describes one table column holding file paths
+type migrationSource struct {
+	category models.StorageCategory
+	table    string
+	column   string
+	// resolve maps the stored column value to an absolute path (nil = as-is)
+	resolve func(string) string
+	// after runs once the file is stored (e.g. to update the owning row)
+	after func(db *gorm.DB, c candidate, obj *models.StorageObject)
+}
+
+// Migrator uploads files that predate the storage backend (or failed to
+// upload at write time) and periodically re-verifies stored checksums
+type Migrator struct {
+	m           *Manager
+	db          *gorm.DB
+	sources     []migrationSource
+	batch       int
+	verifyEvery time.Duration
+}
+
+// NewMigrator creates a migrator covering recordings, voicemail, fax and media.
+// mediaRoot is the base directory MediaFile paths are relative to.
+func NewMigrator(m *Manager, db *gorm.DB, mediaRoot string) *Migrator {
+	return &Migrator{
+		m:           m,
+		db:          db,
+		batch:       200,
+		verifyEvery: 7 * 24 * time.Hour,
+		sources: []migrationSource{
+			{
+				category: models.StorageCategoryRecording,
+				table:    "call_recordings",
+				column:   "file_path",
+				after: func(db *gorm.DB, c candidate, obj *models.StorageObject) {
+					updates := map[string]interface{}{"storage_type": obj.Backend}
+					if obj.Backend != BackendLocalOnly {
+						updates["storage_url"] = obj.Bucket + "/" + obj.Key
+					}
+					db.Model(&models.CallRecording{}).Where("id = ?", c.ID).Updates(updates)
+				},
+			},
+			{category: models.StorageCategoryVoicemail, table: "voicemail_messages", column: "file_path"},
+			{category: models.StorageCategoryFax, table: "fax_jobs", column: "file_name"},
+			{category: models.StorageCategoryFax, table: "fax_jobs", column: "pdf_file_name"},
+			{category: models.StorageCategoryMedia, table: "recordings", column: "file_path"},
+			{
+				category: models.StorageCategoryMedia,
+				table:    "media_files",
+				column:   "path",
+				resolve: func(p string) string {
+					if filepath.IsAbs(p) {
+						return p
+					}
+					return filepath.Join(mediaRoot, p)
+				},
+			},
+		},
+	}
+}
+
+// Start runs the migrator on an interval in the background
+func (g *Migrator) Start(interval time.Duration) {
+	go func() {
+		g.Run(context.Background())
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.Run(context.Background())
+		}
+	}()
+}
+
+// Run performs one migration and verification pass
+func (g *Migrator) Run(ctx context.Context) {
+	start := time.Now()
+	migrated := 0
+	for _, src := range g.sources {
+		migrated += g.migrateSource(ctx, src)
+	}
+	verified, failed := g.verify(ctx)
+
+	if migrated > 0 || failed > 0 {
+		log.WithFields(log.Fields{
+			"backend":  g.m.BackendName(),
+			"migrated": migrated,
+			"verified": verified,
+			"failed":   failed,
+			"duration": time.Since(start).String(),
+		}).Info("Storage migration pass completed")
+	}
+}
+
+// migrateSource stores every file in a column that isn't yet on the active backend
+func (g *Migrator) migrateSource(ctx context.Context, src migrationSource) int {
+	backend := g.m.BackendName()
+	var lastID uint
+	count := 0
+
+	for {
+		var rows []candidate
+		q := g.db.Table(src.table).
+			Select("id, tenant_id, "+src.column+" AS path").
+			Where("id > ? AND deleted_at IS NULL AND "+src.column+" <> ''", lastID)
+		if src.resolve == nil {
+			// Skip rows already stored on this backend
+			q = q.Where("NOT EXISTS (SELECT 1 FROM storage_objects so WHERE so.local_path = "+src.table+"."+src.column+" AND so.backend = ?)", backend)
+		}
+		if err := q.Order("id ASC").Limit(g.batch).Scan(&rows).Error; err != nil {
+			log.Warnf("Storage migration: failed to scan %s: %v", src.table, err)
+			return count
+		}
+		if len(rows) == 0 {
+			return count
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			if src.resolve != nil {
+				row.Path = src.resolve(row.Path)
+				if obj, ok := g.m.Lookup(row.Path); ok && obj.Backend == backend {
+					continue
+				}
+			}
+			if _, err := os.Stat(row.Path); err != nil {
+				continue
+			}
+
+			obj, err := g.m.Store(ctx, src.category, row.TenantID, row.Path, "")
+			if err != nil {
+				log.WithField("path", row.Path).Warnf("Storage migration failed: %v", err)
+				continue
+			}
+			if src.after != nil && obj != nil {
+				src.after(g.db, row, obj)
+			}
+			count++
+		}
+	}
+}
+
+// verify re-checks objects whose last verification is stale
+func (g *Migrator) verify(ctx context.Context) (int, int) {
+	var objs []models.StorageObject
+	g.db.Where("verified_at IS NULL OR verified_at < ?", time.Now().Add(-g.verifyEvery)).
+		Order("verified_at ASC").Limit(g.batch).Find(&objs)
+
+	failed := 0
+	for i := range objs {
+		if err := g.m.Verify(ctx, &objs[i]); err != nil {
+			failed++
+			log.WithFields(log.Fields{
+				"path": objs[i].LocalPath,
+				"key":  objs[i].Key,
+			}).Warnf("Storage verification failed: %v", err)
+		}
+	}
+	return len(objs), failed
+}
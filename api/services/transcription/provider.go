@@ -0,0 +1,62 @@
+// Package transcription turns call recordings and voicemail messages into
+// text using a pluggable speech-to-text provider.
+package transcription
+
+import (
+	"callsign/models"
+	"context"
+	"errors"
+)
+
+// ErrUnsupportedProvider is returned when a tenant selects a provider that has
+// no registered implementation.
+var ErrUnsupportedProvider = errors.New("transcription provider not supported")
+
+// Request describes a single audio file to transcribe
+type Request struct {
+	FilePath  string // Local path to the audio file
+	Language  string // Preferred language (ISO 639-1), empty for auto-detect
+	Model     string // Provider model name (e.g. Whisper "base")
+	Diarize   bool   // Label speakers when the provider supports it
+	Sentiment bool   // Request sentiment analysis when supported
+	Summary   bool   // Request a summary when supported
+}
+
+// Segment is a timed span of transcribed speech
+type Segment struct {
+	StartMs    int
+	EndMs      int
+	Text       string
+	Speaker    string
+	Confidence float64
+	WordsJSON  string // Optional word-level timing as JSON
+}
+
+// Result is the provider's output for a request
+type Result struct {
+	Text       string
+	Language   string
+	Confidence float64
+	Segments   []Segment
+	JobID      string // Provider job reference, if any
+	RawJSON    string // Raw provider response, stored for playback sync
+
+	// Optional analytics (left empty by providers that don't support them)
+	SentimentScore float64
+	SentimentLabel string
+	Summary        string
+	Keywords       string
+}
+
+// Provider is a speech-to-text backend
+type Provider interface {
+	// Name returns the provider identifier (e.g. "whisper")
+	Name() string
+
+	// Transcribe converts the audio file into text
+	Transcribe(ctx context.Context, req Request) (*Result, error)
+}
+
+// ProviderFactory builds a provider for a tenant's configuration. apiKey is
+// the decrypted TranscriptionConfig key (empty when none is stored).
+type ProviderFactory func(cfg *models.TranscriptionConfig, apiKey string) (Provider, error)
@@ -0,0 +1,179 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WhisperProvider implements Provider against an OpenAI-compatible
+// /v1/audio/transcriptions endpoint. This covers the hosted OpenAI API as well
+// as local Whisper servers (faster-whisper-server, whisper.cpp, LocalAI).
+type WhisperProvider struct {
+	name       string
+	endpoint   string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewWhisperProvider creates a provider for the given base URL or full
+// transcriptions endpoint. model is used when the request doesn't set one.
+func NewWhisperProvider(name, endpoint, apiKey, model string) *WhisperProvider {
+	return &WhisperProvider{
+		name:     name,
+		endpoint: transcriptionsURL(endpoint),
+		apiKey:   apiKey,
+		model:    model,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+func (p *WhisperProvider) Name() string {
+	return p.name
+}
+
+// transcriptionsURL expands a base URL to the transcriptions endpoint
+func transcriptionsURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	switch {
+	case strings.HasSuffix(endpoint, "/audio/transcriptions"):
+		return endpoint
+	case strings.HasSuffix(endpoint, "/v1"):
+		return endpoint + "/audio/transcriptions"
+	default:
+		return endpoint + "/v1/audio/transcriptions"
+	}
+}
+
+// whisperResponse is the verbose_json response format
+type whisperResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Segments []struct {
+		Start      float64 `json:"start"`
+		End        float64 `json:"end"`
+		Text       string  `json:"text"`
+		AvgLogprob float64 `json:"avg_logprob"`
+		Speaker    string  `json:"speaker,omitempty"` // whisperX-style diarization
+		Words      []struct {
+			Word  string  `json:"word"`
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+		} `json:"words,omitempty"`
+	} `json:"segments"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Transcribe uploads the file and parses the verbose_json response
+func (p *WhisperProvider) Transcribe(ctx context.Context, req Request) (*Result, error) {
+	f, err := os.Open(req.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("open audio: %w", err)
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filepath.Base(req.FilePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, fmt.Errorf("read audio: %w", err)
+	}
+
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+	mw.WriteField("model", model)
+	mw.WriteField("response_format", "verbose_json")
+	mw.WriteField("timestamp_granularities[]", "segment")
+	if req.Language != "" && req.Language != "auto" {
+		mw.WriteField("language", req.Language)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", mw.FormDataContentType())
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var parsed whisperResponse
+	jsonErr := json.Unmarshal(raw, &parsed)
+
+	if resp.StatusCode >= 400 {
+		msg := strings.TrimSpace(string(raw))
+		if jsonErr == nil && parsed.Error != nil {
+			msg = parsed.Error.Message
+		}
+		return nil, fmt.Errorf("%s returned %d: %s", p.name, resp.StatusCode, msg)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", jsonErr)
+	}
+
+	result := &Result{
+		Text:     strings.TrimSpace(parsed.Text),
+		Language: parsed.Language,
+		RawJSON:  string(raw),
+	}
+
+	var confSum float64
+	for _, s := range parsed.Segments {
+		seg := Segment{
+			StartMs: int(s.Start * 1000),
+			EndMs:   int(s.End * 1000),
+			Text:    strings.TrimSpace(s.Text),
+			Speaker: s.Speaker,
+		}
+		// avg_logprob is the mean token log-probability; exp() maps it to 0-1
+		if s.AvgLogprob != 0 {
+			seg.Confidence = math.Exp(s.AvgLogprob)
+		}
+		if len(s.Words) > 0 {
+			if words, err := json.Marshal(s.Words); err == nil {
+				seg.WordsJSON = string(words)
+			}
+		}
+		confSum += seg.Confidence
+		result.Segments = append(result.Segments, seg)
+	}
+	if len(result.Segments) > 0 {
+		result.Confidence = confSum / float64(len(result.Segments))
+	}
+
+	return result, nil
+}
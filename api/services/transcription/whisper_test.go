@@ -0,0 +1,80 @@
+package transcription_test
+
+import (
+	"callsign/services/transcription"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAudio(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "call.wav")
+	require.NoError(t, os.WriteFile(path, []byte("RIFF....WAVE"), 0644))
+	return path
+}
+
+func TestWhisperProviderParsesVerboseJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/transcriptions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "small", r.FormValue("model"))
+		assert.Equal(t, "verbose_json", r.FormValue("response_format"))
+		assert.Equal(t, "en", r.FormValue("language"))
+		_, _, err := r.FormFile("file")
+		assert.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"text": " Hello, thanks for calling. How can I help? ",
+			"language": "english",
+			"segments": [
+				{"start": 0.0, "end": 1.5, "text": " Hello, thanks for calling.", "avg_logprob": -0.1},
+				{"start": 1.5, "end": 3.25, "text": " How can I help?", "avg_logprob": -0.3, "speaker": "SPEAKER_01"}
+			]
+		}`))
+	}))
+	defer srv.Close()
+
+	p := transcription.NewWhisperProvider("whisper", srv.URL, "secret", "base")
+	res, err := p.Transcribe(context.Background(), transcription.Request{
+		FilePath: writeAudio(t),
+		Language: "en",
+		Model:    "small",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, thanks for calling. How can I help?", res.Text)
+	assert.Equal(t, "english", res.Language)
+	require.Len(t, res.Segments, 2)
+	assert.Equal(t, 1500, res.Segments[1].StartMs)
+	assert.Equal(t, 3250, res.Segments[1].EndMs)
+	assert.Equal(t, "How can I help?", res.Segments[1].Text)
+	assert.Equal(t, "SPEAKER_01", res.Segments[1].Speaker)
+	assert.InDelta(t, 0.905, res.Segments[0].Confidence, 0.001)
+	assert.Greater(t, res.Confidence, 0.0)
+	assert.NotEmpty(t, res.RawJSON)
+}
+
+func TestWhisperProviderReportsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"message": "model loading"}}`))
+	}))
+	defer srv.Close()
+
+	p := transcription.NewWhisperProvider("whisper", srv.URL+"/v1", "", "base")
+	_, err := p.Transcribe(context.Background(), transcription.Request{FilePath: writeAudio(t)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Contains(t, err.Error(), "model loading")
+
+	_, err = p.Transcribe(context.Background(), transcription.Request{FilePath: "/nonexistent.wav"})
+	assert.Error(t, err)
+}
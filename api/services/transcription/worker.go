@@ -0,0 +1,643 @@
+package transcription
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/encryption"
+	"callsign/services/storage"
+	"callsign/services/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	batchSize  = 10
+	jobTimeout = 15 * time.Minute
+	retryBase  = time.Minute
+)
+
+// Worker discovers new call recordings and voicemail messages that match the
+// tenant's TranscriptionConfig, queues a Transcription row for each and runs
+// them through the tenant's provider with retry and backoff.
+type Worker struct {
+	db          *gorm.DB
+	cfg         *config.Config
+	hub         *websocket.Hub
+	encMgr      *encryption.Manager
+	storage     *storage.Manager
+	interval    time.Duration
+	maxAttempts int
+
+	providers   map[models.TranscriptionProvider]ProviderFactory
+	providersMu sync.RWMutex
+
+	// Called once a voicemail job completes or exhausts its attempts
+	onVoicemailDone func(messageID uint)
+
+	wake    chan struct{}
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewWorker creates a transcription worker with the built-in providers registered
+func NewWorker(db *gorm.DB, cfg *config.Config) *Worker {
+	interval := time.Duration(cfg.TranscriptionPollSeconds) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	maxAttempts := cfg.TranscriptionMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	w := &Worker{
+		db:          db,
+		cfg:         cfg,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		providers:   make(map[models.TranscriptionProvider]ProviderFactory),
+		wake:        make(chan struct{}, 1),
+		stopped:     make(chan struct{}),
+	}
+
+	if mgr, err := encryption.NewManagerFromConfig(cfg.EncryptionKey, cfg.EncryptionSalt); err == nil {
+		w.encMgr = mgr
+	}
+
+	// Local Whisper server (OpenAI-compatible API)
+	w.RegisterProvider(models.TranscriptionProviderWhisper, func(tc *models.TranscriptionConfig, apiKey string) (Provider, error) {
+		endpoint := tc.APIEndpoint
+		if endpoint == "" {
+			endpoint = cfg.WhisperURL
+		}
+		if endpoint == "" {
+			return nil, fmt.Errorf("no whisper endpoint configured")
+		}
+		model := tc.WhisperModel
+		if model == "" {
+			model = "base"
+		}
+		return NewWhisperProvider("whisper", endpoint, apiKey, model), nil
+	})
+
+	// Hosted OpenAI transcription
+	w.RegisterProvider(models.TranscriptionProviderOpenAI, func(tc *models.TranscriptionConfig, apiKey string) (Provider, error) {
+		endpoint := tc.APIEndpoint
+		if endpoint == "" {
+			endpoint = "https://api.openai.com/v1"
+		}
+		if apiKey == "" {
+			apiKey = cfg.OpenAIAPIKey
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("no OpenAI API key configured")
+		}
+		return NewWhisperProvider("openai", endpoint, apiKey, "whisper-1"), nil
+	})
+
+	return w
+}
+
+// SetWSHub sets the WebSocket hub used for completion notifications
+func (w *Worker) SetWSHub(hub *websocket.Hub) {
+	w.hub = hub
+}
+
+// SetStorage sets the object storage manager used to fetch evicted audio
+func (w *Worker) SetStorage(m *storage.Manager) {
+	w.storage = m
+}
+
+// OnVoicemailDone sets a callback run (in its own goroutine) when a
+// voicemail message's transcription completes or finally fails, so deferred
+// notifications can go out with or without the transcript
+func (w *Worker) OnVoicemailDone(fn func(messageID uint)) {
+	w.onVoicemailDone = fn
+}
+
+// RegisterProvider adds or replaces the factory for a provider type
+func (w *Worker) RegisterProvider(name models.TranscriptionProvider, factory ProviderFactory) {
+	w.providersMu.Lock()
+	defer w.providersMu.Unlock()
+	w.providers[name] = factory
+}
+
+// Start begins polling for new recordings and pending transcriptions
+func (w *Worker) Start() {
+	// Jobs left in processing by a previous run will never complete
+	w.db.Model(&models.Transcription{}).
+		Where("status = ?", models.TranscriptionProcessing).
+		Update("status", models.TranscriptionPending)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	go func() {
+		defer close(w.stopped)
+		log.Info("Transcription worker started")
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Info("Transcription worker stopping")
+				return
+			case <-ticker.C:
+			case <-w.wake:
+			}
+			w.discoverRecordings()
+			w.discoverVoicemail()
+			w.processBatch(ctx)
+		}
+	}()
+}
+
+// Stop gracefully stops the worker
+func (w *Worker) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+		<-w.stopped
+	}
+}
+
+// Wake triggers a poll without waiting for the next tick
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueRecording queues (or re-queues) a recording for transcription,
+// regardless of the tenant's auto-transcribe rules.
+func (w *Worker) EnqueueRecording(tenantID, recordingID uint) (*models.Transcription, error) {
+	var rec models.CallRecording
+	if err := w.db.Where("id = ? AND tenant_id = ?", recordingID, tenantID).First(&rec).Error; err != nil {
+		return nil, fmt.Errorf("recording not found")
+	}
+	if rec.FilePath == "" {
+		return nil, fmt.Errorf("recording has no audio file")
+	}
+
+	job, err := w.requeue("call_recording_id = ?", rec.ID, models.Transcription{
+		TenantID:        rec.TenantID,
+		CallRecordingID: rec.ID,
+		Provider:        w.tenantConfig(rec.TenantID).Provider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.db.Model(&rec).Update("transcription_status", models.TranscriptionPending)
+	w.Wake()
+	return job, nil
+}
+
+// EnqueueVoicemail queues (or re-queues) a voicemail message for transcription
+func (w *Worker) EnqueueVoicemail(tenantID, messageID uint) (*models.Transcription, error) {
+	var msg models.VoicemailMessage
+	if err := w.db.Where("id = ? AND tenant_id = ?", messageID, tenantID).First(&msg).Error; err != nil {
+		return nil, fmt.Errorf("voicemail message not found")
+	}
+
+	job, err := w.requeue("voicemail_message_id = ?", msg.ID, models.Transcription{
+		TenantID:           msg.TenantID,
+		VoicemailMessageID: &msg.ID,
+		Provider:           w.tenantConfig(msg.TenantID).Provider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.db.Model(&msg).Update("transcription_status", models.TranscriptionPending)
+	w.Wake()
+	return job, nil
+}
+
+// requeue resets an existing job for the source or creates a new one
+func (w *Worker) requeue(where string, sourceID uint, job models.Transcription) (*models.Transcription, error) {
+	var existing models.Transcription
+	if err := w.db.Where(where, sourceID).Order("id DESC").First(&existing).Error; err == nil {
+		if existing.Status == models.TranscriptionProcessing {
+			return nil, fmt.Errorf("transcription already in progress")
+		}
+		w.db.Model(&existing).Updates(map[string]interface{}{
+			"status":          models.TranscriptionPending,
+			"provider":        job.Provider,
+			"attempts":        0,
+			"next_attempt_at": nil,
+			"error_message":   "",
+		})
+		return &existing, nil
+	}
+
+	job.Status = models.TranscriptionPending
+	if err := w.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue transcription: %w", err)
+	}
+	return &job, nil
+}
+
+// tenantConfig loads a tenant's transcription settings, falling back to
+// defaults (auto-transcribe off) when none are stored.
+func (w *Worker) tenantConfig(tenantID uint) *models.TranscriptionConfig {
+	var tc models.TranscriptionConfig
+	if err := w.db.Where("tenant_id = ?", tenantID).First(&tc).Error; err != nil {
+		return &models.TranscriptionConfig{
+			TenantID:            tenantID,
+			Provider:            models.TranscriptionProviderWhisper,
+			TranscribeInbound:   true,
+			TranscribeOutbound:  true,
+			TranscribeVoicemail: true,
+			MinDurationSeconds:  10,
+			Language:            "en",
+			WhisperModel:        "base",
+		}
+	}
+	if tc.Provider == "" {
+		tc.Provider = models.TranscriptionProviderWhisper
+	}
+	return &tc
+}
+
+// recordingEligible applies the tenant's auto-transcription rules to a recording
+func recordingEligible(tc *models.TranscriptionConfig, rec *models.CallRecording) bool {
+	if !tc.AutoTranscribe {
+		return false
+	}
+	if rec.ConferenceID != nil && !tc.TranscribeConference {
+		return false
+	}
+	switch rec.Direction {
+	case "inbound":
+		if !tc.TranscribeInbound {
+			return false
+		}
+	case "outbound":
+		if !tc.TranscribeOutbound {
+			return false
+		}
+	}
+
+	duration := rec.Duration
+	if duration == 0 && !rec.EndTime.IsZero() {
+		duration = int(rec.EndTime.Sub(rec.StartTime).Seconds())
+	}
+	return duration >= tc.MinDurationSeconds
+}
+
+// discoverRecordings queues completed recordings that haven't been considered yet.
+// Recordings still in progress have no end time and are picked up later.
+func (w *Worker) discoverRecordings() {
+	var recs []models.CallRecording
+	err := w.db.Where("transcription_status = ? AND end_time > start_time AND file_path <> ''", models.TranscriptionPending).
+		Where("NOT EXISTS (SELECT 1 FROM transcriptions t WHERE t.call_recording_id = call_recordings.id AND t.deleted_at IS NULL)").
+		Order("id ASC").Limit(100).Find(&recs).Error
+	if err != nil {
+		log.Errorf("Transcription worker: failed to scan recordings: %v", err)
+		return
+	}
+
+	configs := make(map[uint]*models.TranscriptionConfig)
+	for i := range recs {
+		rec := &recs[i]
+		tc, ok := configs[rec.TenantID]
+		if !ok {
+			tc = w.tenantConfig(rec.TenantID)
+			configs[rec.TenantID] = tc
+		}
+
+		if !recordingEligible(tc, rec) {
+			w.db.Model(rec).Update("transcription_status", models.TranscriptionSkipped)
+			continue
+		}
+
+		job := models.Transcription{
+			TenantID:        rec.TenantID,
+			CallRecordingID: rec.ID,
+			Status:          models.TranscriptionPending,
+			Provider:        tc.Provider,
+		}
+		if err := w.db.Create(&job).Error; err != nil {
+			log.Errorf("Transcription worker: failed to queue recording %d: %v", rec.ID, err)
+		}
+	}
+}
+
+// discoverVoicemail queues new voicemail messages for tenants that transcribe
+// voicemail. Deposits are already length-filtered by the voicemail module, so
+// MinDurationSeconds only applies to call recordings.
+func (w *Worker) discoverVoicemail() {
+	var msgs []models.VoicemailMessage
+	err := w.db.Where("transcription_status = ? AND file_path <> ''", models.TranscriptionPending).
+		Where("NOT EXISTS (SELECT 1 FROM transcriptions t WHERE t.voicemail_message_id = voicemail_messages.id AND t.deleted_at IS NULL)").
+		Order("id ASC").Limit(100).Find(&msgs).Error
+	if err != nil {
+		log.Errorf("Transcription worker: failed to scan voicemail: %v", err)
+		return
+	}
+
+	configs := make(map[uint]*models.TranscriptionConfig)
+	for i := range msgs {
+		msg := &msgs[i]
+		tc, ok := configs[msg.TenantID]
+		if !ok {
+			tc = w.tenantConfig(msg.TenantID)
+			configs[msg.TenantID] = tc
+		}
+
+		if !tc.AutoTranscribe || !tc.TranscribeVoicemail {
+			w.db.Model(msg).Update("transcription_status", models.TranscriptionSkipped)
+			continue
+		}
+
+		job := models.Transcription{
+			TenantID:           msg.TenantID,
+			VoicemailMessageID: &msg.ID,
+			Status:             models.TranscriptionPending,
+			Provider:           tc.Provider,
+		}
+		if err := w.db.Create(&job).Error; err != nil {
+			log.Errorf("Transcription worker: failed to queue voicemail %d: %v", msg.ID, err)
+		}
+	}
+}
+
+// processBatch runs pending and retry-ready jobs
+func (w *Worker) processBatch(ctx context.Context) {
+	var jobs []models.Transcription
+	err := w.db.Where(
+		"status = ? OR (status = ? AND attempts < ? AND next_attempt_at <= ?)",
+		models.TranscriptionPending, models.TranscriptionFailed, w.maxAttempts, time.Now(),
+	).Order("id ASC").Limit(batchSize).Find(&jobs).Error
+	if err != nil {
+		log.Errorf("Transcription worker: failed to fetch jobs: %v", err)
+		return
+	}
+
+	for i := range jobs {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			w.processJob(ctx, &jobs[i])
+		}
+	}
+}
+
+// source resolves the audio file behind a job
+type source struct {
+	filePath  string
+	recording *models.CallRecording
+	voicemail *models.VoicemailMessage
+}
+
+func (w *Worker) loadSource(job *models.Transcription) (*source, error) {
+	if job.VoicemailMessageID != nil {
+		var msg models.VoicemailMessage
+		if err := w.db.First(&msg, *job.VoicemailMessageID).Error; err != nil {
+			return nil, fmt.Errorf("voicemail message %d not found", *job.VoicemailMessageID)
+		}
+		return &source{filePath: msg.FilePath, voicemail: &msg}, nil
+	}
+
+	var rec models.CallRecording
+	if err := w.db.First(&rec, job.CallRecordingID).Error; err != nil {
+		return nil, fmt.Errorf("recording %d not found", job.CallRecordingID)
+	}
+	return &source{filePath: rec.FilePath, recording: &rec}, nil
+}
+
+// setSourceStatus mirrors the job status onto the recording or message
+func (w *Worker) setSourceStatus(src *source, status models.TranscriptionStatus) {
+	switch {
+	case src.recording != nil:
+		w.db.Model(src.recording).Update("transcription_status", status)
+	case src.voicemail != nil:
+		w.db.Model(src.voicemail).Update("transcription_status", status)
+	}
+}
+
+// provider builds the provider for a tenant's configuration
+func (w *Worker) provider(tc *models.TranscriptionConfig) (Provider, error) {
+	w.providersMu.RLock()
+	factory, ok := w.providers[tc.Provider]
+	w.providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, tc.Provider)
+	}
+
+	var apiKey string
+	if tc.APIKeyEncrypted != "" && w.encMgr != nil {
+		key, err := w.encMgr.Decrypt(tc.APIKeyEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt API key: %w", err)
+		}
+		apiKey = key
+	}
+	return factory(tc, apiKey)
+}
+
+// processJob transcribes one job and stores the result
+func (w *Worker) processJob(ctx context.Context, job *models.Transcription) {
+	logger := log.WithFields(log.Fields{
+		"transcription_id": job.ID,
+		"tenant_id":        job.TenantID,
+		"attempt":          job.Attempts + 1,
+	})
+
+	job.Attempts++
+	w.db.Model(job).Updates(map[string]interface{}{
+		"status":   models.TranscriptionProcessing,
+		"attempts": job.Attempts,
+	})
+
+	src, err := w.loadSource(job)
+	if err != nil {
+		logger.Warnf("Transcription source missing: %v", err)
+		w.failJob(job, nil, err, false)
+		return
+	}
+	w.setSourceStatus(src, models.TranscriptionProcessing)
+
+	if _, err := w.storage.Localize(ctx, src.filePath); err != nil {
+		logger.Warnf("Transcription audio missing: %v", err)
+		w.failJob(job, src, fmt.Errorf("audio file not found: %s", src.filePath), false)
+		return
+	}
+
+	tc := w.tenantConfig(job.TenantID)
+	provider, err := w.provider(tc)
+	if err != nil {
+		logger.Warnf("Transcription provider unavailable: %v", err)
+		w.failJob(job, src, err, !errors.Is(err, ErrUnsupportedProvider))
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	started := time.Now()
+	result, err := provider.Transcribe(jobCtx, Request{
+		FilePath:  src.filePath,
+		Language:  tc.Language,
+		Model:     tc.WhisperModel,
+		Diarize:   tc.EnableDiarize,
+		Sentiment: tc.EnableSentiment,
+		Summary:   tc.EnableSummary,
+	})
+	if err != nil {
+		logger.Warnf("Transcription failed: %v", err)
+		w.failJob(job, src, err, true)
+		return
+	}
+
+	if err := w.saveResult(job, src, provider.Name(), result, time.Since(started)); err != nil {
+		logger.Errorf("Failed to store transcription: %v", err)
+		w.failJob(job, src, err, true)
+		return
+	}
+
+	logger.WithField("words", job.WordCount).Info("Transcription completed")
+	w.notify(job, src)
+	w.voicemailDone(job)
+}
+
+// saveResult persists the text, segments and analytics in one transaction
+func (w *Worker) saveResult(job *models.Transcription, src *source, providerName string, result *Result, elapsed time.Duration) error {
+	speakers := make(map[string]struct{})
+	for _, seg := range result.Segments {
+		if seg.Speaker != "" {
+			speakers[seg.Speaker] = struct{}{}
+		}
+	}
+
+	job.Status = models.TranscriptionCompleted
+	job.Provider = models.TranscriptionProvider(providerName)
+	job.ProviderJobID = result.JobID
+	job.ErrorMessage = ""
+	job.ProcessingTimeMs = int(elapsed.Milliseconds())
+	job.FullText = result.Text
+	job.FullTextJSON = result.RawJSON
+	job.Language = result.Language
+	job.Confidence = result.Confidence
+	job.WordCount = len(strings.Fields(result.Text))
+	job.SpeakerCount = len(speakers)
+	job.SentimentScore = result.SentimentScore
+	job.SentimentLabel = result.SentimentLabel
+	job.Summary = result.Summary
+	job.Keywords = result.Keywords
+	job.NextAttemptAt = nil
+
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Segments").Save(job).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("transcription_id = ?", job.ID).Delete(&models.TranscriptionSegment{}).Error; err != nil {
+			return err
+		}
+
+		segments := make([]models.TranscriptionSegment, 0, len(result.Segments))
+		for _, seg := range result.Segments {
+			segments = append(segments, models.TranscriptionSegment{
+				TranscriptionID: job.ID,
+				StartMs:         seg.StartMs,
+				EndMs:           seg.EndMs,
+				Text:            seg.Text,
+				Speaker:         seg.Speaker,
+				Confidence:      seg.Confidence,
+				WordsJSON:       seg.WordsJSON,
+			})
+		}
+		if len(segments) > 0 {
+			if err := tx.Create(&segments).Error; err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case src.recording != nil:
+			return tx.Model(src.recording).Update("transcription_status", models.TranscriptionCompleted).Error
+		case src.voicemail != nil:
+			return tx.Model(src.voicemail).Updates(map[string]interface{}{
+				"transcription":        result.Text,
+				"transcription_status": models.TranscriptionCompleted,
+			}).Error
+		}
+		return nil
+	})
+}
+
+// failJob records a failure and schedules a retry with exponential backoff
+// (1m, 5m, 25m, ...). Non-retriable errors exhaust the job immediately.
+func (w *Worker) failJob(job *models.Transcription, src *source, cause error, retriable bool) {
+	attempts := job.Attempts
+	if !retriable {
+		attempts = w.maxAttempts
+	}
+
+	updates := map[string]interface{}{
+		"status":        models.TranscriptionFailed,
+		"error_message": cause.Error(),
+		"attempts":      attempts,
+	}
+	if attempts < w.maxAttempts {
+		delay := retryBase
+		for i := 1; i < attempts; i++ {
+			delay *= 5
+		}
+		updates["next_attempt_at"] = time.Now().Add(delay)
+	}
+	w.db.Model(job).Updates(updates)
+
+	if attempts >= w.maxAttempts {
+		if src != nil {
+			w.setSourceStatus(src, models.TranscriptionFailed)
+		}
+		// Even without the message loaded, release an email held back
+		// for the transcription
+		w.voicemailDone(job)
+	} else if src != nil {
+		w.setSourceStatus(src, models.TranscriptionPending)
+	}
+}
+
+// voicemailDone hands a finished voicemail job to the OnVoicemailDone callback
+func (w *Worker) voicemailDone(job *models.Transcription) {
+	if w.onVoicemailDone == nil || job.VoicemailMessageID == nil {
+		return
+	}
+	go w.onVoicemailDone(*job.VoicemailMessageID)
+}
+
+// notify pushes a completion event to the tenant's WebSocket clients
+func (w *Worker) notify(job *models.Transcription, src *source) {
+	if w.hub == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"transcription_id": job.ID,
+		"status":           job.Status,
+		"word_count":       job.WordCount,
+		"language":         job.Language,
+	}
+
+	if src.voicemail != nil {
+		data["message_id"] = src.voicemail.ID
+		data["box_id"] = src.voicemail.BoxID
+		data["transcription"] = job.FullText
+		w.hub.BroadcastToTenant(job.TenantID, websocket.EventVoicemail, "transcription_completed", data)
+		return
+	}
+
+	data["recording_id"] = job.CallRecordingID
+	w.hub.BroadcastToTenant(job.TenantID, websocket.EventNotification, "transcription_completed", data)
+}
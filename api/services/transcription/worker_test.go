@@ -0,0 +1,108 @@
+package transcription_test
+
+import (
+	"callsign/config"
+	"callsign/models"
+	"callsign/services/transcription"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupWorker(t *testing.T, handler http.HandlerFunc) (*gorm.DB, *transcription.Worker) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // the worker goroutine must see the same in-memory DB
+	require.NoError(t, db.AutoMigrate(&models.VoicemailMessage{}, &models.Transcription{},
+		&models.TranscriptionSegment{}, &models.TranscriptionConfig{}))
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	w := transcription.NewWorker(db, &config.Config{
+		WhisperURL:               srv.URL,
+		TranscriptionPollSeconds: 3600,
+		TranscriptionMaxAttempts: 1,
+	})
+	return db, w
+}
+
+// runVoicemail queues a message, runs the worker and waits for the
+// OnVoicemailDone callback
+func runVoicemail(t *testing.T, db *gorm.DB, w *transcription.Worker) models.VoicemailMessage {
+	msg := models.VoicemailMessage{TenantID: 1, BoxID: 1, FilePath: writeAudio(t), IsNew: true}
+	require.NoError(t, db.Create(&msg).Error)
+
+	done := make(chan uint, 1)
+	w.OnVoicemailDone(func(messageID uint) { done <- messageID })
+	_, err := w.EnqueueVoicemail(1, msg.ID)
+	require.NoError(t, err)
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case id := <-done:
+		assert.Equal(t, msg.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnVoicemailDone was not called")
+	}
+	require.NoError(t, db.First(&msg, msg.ID).Error)
+	return msg
+}
+
+func TestWorkerTranscribesVoicemail(t *testing.T) {
+	db, w := setupWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text": " Please call me back about the invoice. ", "language": "en"}`))
+	})
+
+	msg := runVoicemail(t, db, w)
+	assert.Equal(t, models.TranscriptionCompleted, msg.TranscriptionStatus)
+	assert.Equal(t, "Please call me back about the invoice.", msg.Transcription)
+}
+
+func TestWorkerReportsFailedVoicemail(t *testing.T) {
+	db, w := setupWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusInternalServerError)
+	})
+
+	msg := runVoicemail(t, db, w)
+	assert.Equal(t, models.TranscriptionFailed, msg.TranscriptionStatus)
+	assert.Empty(t, msg.Transcription)
+}
+
+func TestWorkerReportsVoicemailWithMissingSource(t *testing.T) {
+	db, w := setupWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("provider called for a missing message")
+	})
+
+	msg := models.VoicemailMessage{TenantID: 1, BoxID: 1, FilePath: writeAudio(t), IsNew: true, NotifyPending: true}
+	require.NoError(t, db.Create(&msg).Error)
+	_, err := w.EnqueueVoicemail(1, msg.ID)
+	require.NoError(t, err)
+	// Deleted before the worker got to it
+	require.NoError(t, db.Delete(&msg).Error)
+
+	done := make(chan uint, 1)
+	w.OnVoicemailDone(func(messageID uint) { done <- messageID })
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case id := <-done:
+		assert.Equal(t, msg.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnVoicemailDone was not called")
+	}
+	var job models.Transcription
+	require.NoError(t, db.Where("voicemail_message_id = ?", msg.ID).First(&job).Error)
+	assert.Equal(t, models.TranscriptionFailed, job.Status)
+}
@@ -8,15 +8,18 @@ import (
 	"gorm.io/gorm"
 
 	"callsign/config"
+	"callsign/models"
+	"callsign/services/storage"
 )
 
 // Service orchestrates TTS synthesis with caching.
 // On first request for a given text+engine+voice, it synthesizes the audio
 // and stores the WAV on disk. Subsequent requests return the cached file.
 type Service struct {
-	Cache  *TTSCache
-	Config *config.Config
-	DB     *gorm.DB
+	Cache   *TTSCache
+	Config  *config.Config
+	DB      *gorm.DB
+	Storage *storage.Manager // Mirrors synthesized audio; files always stay local
 }
 
 // NewService creates and initialises the TTS service.
@@ -61,6 +64,7 @@ func (s *Service) SynthesizeToFile(text, engine, voice string) (string, error) {
 	}
 
 	s.Cache.Put(key, outPath)
+	s.Storage.StoreAsync(models.StorageCategoryTTS, 0, outPath, "audio/wav")
 	log.WithFields(log.Fields{
 		"engine": engine,
 		"voice":  voice,
@@ -199,6 +199,11 @@ func (h *Hub) NotifyConferenceEvent(tenantID uint, action string, confData map[s
 	h.BroadcastToTenant(tenantID, EventConference, action, confData)
 }
 
+// NotifyQueueEvent notifies about queue changes (callbacks, agents, callers)
+func (h *Hub) NotifyQueueEvent(tenantID uint, action string, queueData map[string]interface{}) {
+	h.BroadcastToTenant(tenantID, EventQueue, action, queueData)
+}
+
 // NotifyStats broadcasts statistics update
 func (h *Hub) NotifyStats(tenantID uint, stats map[string]interface{}) {
 	h.BroadcastToTenant(tenantID, EventStats, "update", stats)
@@ -215,6 +220,11 @@ func (h *Hub) NotifyChatMessage(tenantID uint, threadID uint, msgData map[string
 	h.BroadcastToTenant(tenantID, EventChat, "new_message", msgData)
 }
 
+// NotifyChatQueueEvent notifies about chat queue routing (offers, assignments, SLA breaches)
+func (h *Hub) NotifyChatQueueEvent(tenantID uint, action string, data map[string]interface{}) {
+	h.BroadcastToTenant(tenantID, EventChat, action, data)
+}
+
 // NotifyMessageStatus notifies about a message delivery status change
 func (h *Hub) NotifyMessageStatus(tenantID uint, messageID uint, status string) {
 	h.BroadcastToTenant(tenantID, EventSMS, "status_update", map[string]interface{}{